@@ -89,6 +89,17 @@ func (d DirectoryURL) doCreate(ctx context.Context, ifNoneMatch *string) (*Direc
 	return (*DirectoryCreateResponse)(resp), err
 }
 
+// SetPermissions gives the directory the POSIX permissions (in octal, e.g. "0755")
+func (d DirectoryURL) SetPermissions(ctx context.Context, permissions string) (*PathUpdateResponse, error) {
+	// as in FileURL.FlushData, the go http client has a problem with PATCH, so the verb is overridden
+	overrideHttpVerb := "PATCH"
+	return d.directoryClient.Update(ctx, PathUpdateActionSetAccessControl, d.filesystem, d.pathParameter, nil,
+		nil, nil, nil, nil,
+		nil, nil, nil, nil, nil,
+		nil, nil, nil, nil, &permissions, nil,
+		nil, nil, nil, nil, &overrideHttpVerb, nil, nil, nil, nil)
+}
+
 // Delete removes the specified empty directory. Note that the directory must be empty before it can be deleted..
 // For more information, see https://docs.microsoft.com/rest/api/storageservices/delete-directory.
 func (d DirectoryURL) Delete(ctx context.Context, continuationString *string, recursive bool) (*DirectoryDeleteResponse, error) {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/base64"
 	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	"io"
@@ -73,6 +75,36 @@ func (f FileURL) Create(ctx context.Context, headers BlobFSHTTPHeaders) (*PathCr
 		nil)
 }
 
+// CreateWithPermissions creates a new file or replaces a file, as Create does. The file is given the POSIX permissions
+// (in octal, e.g. "0644"), without any umask being applied to them, and the properties, which the service keeps with
+// the file in the same way as it keeps the metadata of a blob.
+func (f FileURL) CreateWithPermissions(ctx context.Context, headers BlobFSHTTPHeaders, permissions string, properties map[string]string) (*PathCreateResponse, error) {
+	umask := "0000" // otherwise the service applies a default umask of 0027
+	var xMsProperties *string
+	if len(properties) > 0 {
+		encoded := encodePathProperties(properties)
+		xMsProperties = &encoded
+	}
+	return f.fileClient.Create(ctx, f.fileSystemName, f.path, PathResourceFile,
+		nil, PathRenameModeNone, nil, nil, nil, nil,
+		&headers.CacheControl, &headers.ContentType, &headers.ContentEncoding, &headers.ContentLanguage, &headers.ContentDisposition,
+		nil, nil, nil, xMsProperties, &permissions, &umask,
+		nil, nil, nil, nil, nil,
+		nil, nil, nil, nil, nil,
+		nil)
+}
+
+// encodePathProperties formats properties as the x-ms-properties header wants them: a comma-separated list of name=value pairs,
+// with each value base64 encoded
+func encodePathProperties(properties map[string]string) string {
+	pairs := make([]string, 0, len(properties))
+	for name, value := range properties {
+		pairs = append(pairs, name+"="+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 // Download downloads count bytes of data from the start offset. If count is CountToEnd (0), then data is read from specified offset to the end.
 // The response includes all of the file’s properties. However, passing true for rangeGetContentMD5 returns the range’s MD5 in the ContentMD5
 // response header/property if the range is <= 4MB; the HTTP request fails with 400 (Bad Request) if the requested range is greater than 4MB.
@@ -138,6 +170,45 @@ func (f FileURL) GetProperties(ctx context.Context) (*PathGetPropertiesResponse,
 		nil, nil, nil, nil, nil)
 }
 
+// BlobFSAccessControl is the ownership, and the POSIX access control list, of a file or directory
+type BlobFSAccessControl struct {
+	Owner string
+	Group string
+	// ACL holds both the access and the default entries, e.g. "user::rwx,user:<object ID>:r-x,group::r-x,mask::r-x,other::---,default:user::rwx"
+	ACL string
+}
+
+// GetAccessControl returns the ownership and access control list of the file (or of the directory, if the URL is one).
+// Users and groups are given as object IDs, rather than as user principal names.
+func (f FileURL) GetAccessControl(ctx context.Context) (BlobFSAccessControl, error) {
+	upn := false
+	resp, err := f.fileClient.GetProperties(ctx, f.fileSystemName, f.path, PathGetPropertiesActionGetAccessControl, &upn,
+		nil, nil, nil,
+		nil, nil, nil, nil, nil)
+	if err != nil {
+		return BlobFSAccessControl{}, err
+	}
+	return BlobFSAccessControl{Owner: resp.XMsOwner(), Group: resp.XMsGroup(), ACL: resp.XMsACL()}, nil
+}
+
+// SetAccessControl replaces the ownership, and the whole access control list, of the file (or of the directory, if the URL is one).
+// An empty owner or group is left as it is. Changing the owner requires super-user access.
+func (f FileURL) SetAccessControl(ctx context.Context, ac BlobFSAccessControl) (*PathUpdateResponse, error) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	// as in FlushData, the go http client has a problem with PATCH, so the verb is overridden
+	overrideHttpVerb := "PATCH"
+	return f.fileClient.Update(ctx, PathUpdateActionSetAccessControl, f.fileSystemName, f.path, nil,
+		nil, nil, nil, nil,
+		nil, nil, nil, nil, nil,
+		nil, nil, optional(ac.Owner), optional(ac.Group), nil, optional(ac.ACL),
+		nil, nil, nil, nil, &overrideHttpVerb, nil, nil, nil, nil)
+}
+
 // UploadRange writes bytes to a file.
 // offset indicates the offset at which to begin writing, in bytes.
 // custom headers are not valid on this operation
@@ -155,6 +155,7 @@ func (raw rawBenchmarkCmdArgs) cook() (cookedCopyCmdArgs, error) {
 	c.blobType = raw.blobType
 	c.output = raw.output
 	c.logVerbosity = raw.logVerbosity
+	c.logFormat = common.ELogFormat.Text().String()
 
 	cooked, err := c.cookWithId(jobID)
 	if err != nil {
@@ -227,6 +228,7 @@ func (raw rawBenchmarkCmdArgs) createCleanupJobArgs(benchmarkDest common.Resourc
 	rc.src = u.String()             // the SOURCE for the deletion is the the dest from the benchmark
 	rc.recursive = true
 	rc.logVerbosity = logVerbosity
+	rc.logFormat = common.ELogFormat.Text().String()
 
 	switch inferArgumentLocation(rc.src) {
 	case common.ELocation.Blob():
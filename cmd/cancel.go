@@ -23,6 +23,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/spf13/cobra"
@@ -32,9 +33,14 @@ import (
 // TODO but that's not the plan anymore
 type rawCancelCmdArgs struct {
 	jobID string
+	all   bool
 }
 
 func (raw rawCancelCmdArgs) cook() (cookedCancelCmdArgs, error) {
+	if raw.all {
+		return cookedCancelCmdArgs{all: true}, nil
+	}
+
 	//parsing the given JobId to validate its format correctness
 	jobID, err := common.ParseJobID(raw.jobID)
 	if err != nil {
@@ -47,6 +53,7 @@ func (raw rawCancelCmdArgs) cook() (cookedCancelCmdArgs, error) {
 
 type cookedCancelCmdArgs struct {
 	jobID common.JobID
+	all   bool
 }
 
 // handles the cancel command
@@ -70,8 +77,14 @@ func init() {
 		Short:      "Stops an ongoing job with the given Job ID",
 		Long:       "Stops an ongoing job with the given Job ID",
 		Args: func(cmd *cobra.Command, args []string) error {
-			// the cancel command requires a JobId argument
+			// the cancel command requires a JobId argument, unless all jobs are to be cancelled
 			// it then cancels all parts of the specified job
+			if raw.all {
+				if len(args) != 0 {
+					return errors.New("a jobID cannot be given together with --all")
+				}
+				return nil
+			}
 
 			// If no argument is passed then it is not valid
 			if len(args) != 1 {
@@ -86,6 +99,11 @@ func init() {
 				glcm.Error("failed to parse user input due to error " + err.Error())
 			}
 
+			if cooked.all {
+				cancelAllJobs()
+				return
+			}
+
 			err = cooked.process()
 			if err != nil {
 				glcm.Error("failed to perform copy command due to error " + err.Error())
@@ -98,4 +116,35 @@ func init() {
 		Hidden: true,
 	}
 	rootCmd.AddCommand(cancelCmd)
+	cancelCmd.PersistentFlags().BoolVar(&raw.all, "all", false, "Cancel every job that is in progress, instead of the one with a given Job ID. Jobs that are already finished, paused or cancelled are left alone.")
+}
+
+// cancelAllJobs cancels every job that is in progress, and reports which ones were cancelled
+func cancelAllJobs() {
+	var response common.CancelAllJobsResponse
+	Rpc(common.ERpcCmd.CancelAllJobs(), nil, &response)
+
+	exitCode := common.EExitCode.Success()
+	if response.ErrorMsg != "" {
+		exitCode = common.EExitCode.Error()
+	}
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			return common.GetJsonStringFromTemplate(response)
+		}
+
+		var sb strings.Builder
+		if len(response.CancelledJobIDs) == 0 {
+			sb.WriteString("No jobs were in progress, so none were cancelled.")
+		} else {
+			sb.WriteString(fmt.Sprintf("Cancelled %d job(s):", len(response.CancelledJobIDs)))
+			for _, jobID := range response.CancelledJobIDs {
+				sb.WriteString("\n" + jobID.String())
+			}
+		}
+		if response.ErrorMsg != "" {
+			sb.WriteString("\nSome jobs could not be cancelled: " + response.ErrorMsg)
+		}
+		return sb.String()
+	}, exitCode)
 }
@@ -23,17 +23,23 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"crypto/md5"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 
@@ -64,6 +70,10 @@ type rawCopyCmdArgs struct {
 	src    string
 	dst    string
 	fromTo string
+	// whether the source is stdin, i.e. a shorthand for --from-to PipeBlob
+	fromStdin bool
+	// whether the destination is stdout, i.e. a shorthand for --from-to BlobPipe
+	toStdout bool
 	//blobUrlForRedirection string
 
 	// new include/exclude only apply to file names
@@ -72,23 +82,33 @@ type rawCopyCmdArgs struct {
 	exclude               string
 	includePath           string // NOTE: This gets handled like list-of-files! It may LOOK like a bug, but it is not.
 	excludePath           string
+	includeRegex          string
+	excludeRegex          string
 	includeFileAttributes string
 	excludeFileAttributes string
 	includeBefore         string
 	includeAfter          string
+	minSize               string
+	maxSize               string
 	legacyInclude         string // used only for warnings
 	legacyExclude         string // used only for warnings
 	listOfVersionIDs      string
 
 	// filters from flags
-	listOfFilesToCopy string
-	recursive         bool
-	followSymlinks    bool
-	autoDecompress    bool
+	listOfFilesToCopy  string
+	listOfDestinations string
+	recursive          bool
+	followSymlinks     bool
+	autoDecompress     bool
+	gzipUpload         bool
+	gzipMinSize        string
+	gzipExtensions     string
 	// forceWrite flag is used to define the User behavior
 	// to overwrite the existing blobs or not.
 	forceWrite      string
 	forceIfReadOnly bool
+	// only applies when forceWrite is ifSourceNewer
+	sourceNewerTolerance time.Duration
 
 	// options from flags
 	blockSizeMB              float64
@@ -99,19 +119,35 @@ type rawCopyCmdArgs struct {
 	contentLanguage          string
 	cacheControl             string
 	noGuessMimeType          bool
+	contentTypeOverrides     string
 	preserveLastModifiedTime bool
+	explicitPreserveLMT      bool // whether --preserve-last-modified-time was given, rather than left at its default
 	putMd5                   bool
 	md5ValidationOption      string
+	checksumAlgorithm        string
 	CheckLength              bool
 	deleteSnapshotsOption    string
+	dryrun                   bool
+	parallelTransfers        uint16
+	maxDuration              time.Duration
+	maxRetries               int32
+	retryChangedFiles        bool
+	transfersPerPart         uint32
+	transferOrder            string
+	maxTotalBytes            uint64
+	capMbpsSchedule          string
+	sasRefreshCommand        string
 
 	blobTags string
+	// whether the tags of the source blobs are copied to the destination blobs, in blob to blob copies
+	s2sPreserveBlobTags bool
 	// defines the type of the blob at the destination in case of upload / account to account copy
 	blobType      string
 	blockBlobTier string
 	pageBlobTier  string
 	output        string // TODO: Is this unused now? replaced with param at root level?
 	logVerbosity  string
+	logFormat     string
 	// list of blobTypes to exclude while enumerating the transfer
 	excludeBlobType string
 	// Opt-in flag to persist SMB ACLs to Azure Files.
@@ -120,6 +156,15 @@ type rawCopyCmdArgs struct {
 	// Opt-in flag to persist additional SMB properties to Azure Files. Named ...info instead of ...properties
 	// because the latter was similar enough to preserveSMBPermissions to induce user error
 	preserveSMBInfo bool
+	// Opt-in flag to persist POSIX permission bits and ownership between a Linux/Unix file system and Blob storage
+	preservePOSIXProperties bool
+	// Opt-in flag to copy the owner, group and ACL of each file between ADLS Gen2 accounts
+	preserveACLs bool
+	// Opt-in flag to copy the immutability policy and legal hold of each blob between blob accounts
+	preserveImmutability bool
+	// the expiry (in RFC 3339 form) and mode of an immutability policy to give every blob that is written
+	immutabilityUntil string
+	immutabilityMode  string
 	// Flag to enable Window's special privileges
 	backupMode bool
 	// whether user wants to preserve full properties during service to service copy, the default value is true.
@@ -136,6 +181,10 @@ type rawCopyCmdArgs struct {
 	// whether user wants to check if source has changed after enumerating, the default value is true.
 	// For S2S copy, as source is a remote resource, validating whether source has changed need additional request costs.
 	s2sSourceChangeValidation bool
+	// whether archived source blobs should be rehydrated and waited for, rather than failing the transfer.
+	s2sRehydrateArchivedSource bool
+	// specify how the service is asked to copy blobs from blobs
+	s2sCopyMethod string
 	// specify how user wants to handle invalid metadata.
 	s2sInvalidMetadataHandleOption string
 
@@ -144,6 +193,28 @@ type rawCopyCmdArgs struct {
 
 	// whether to include blobs that have metadata 'hdi_isfolder = true'
 	includeDirectoryStubs bool
+
+	// whether to also copy each source blob's snapshots, each to a destination whose name includes the snapshot time
+	includeSnapshots bool
+
+	flattenDirectories         bool
+	destinationCollisionOption string
+	emptyFolderMarkers         bool
+
+	stripPrefix          string
+	addPrefix            string
+	prefixMismatchOption string
+
+	ifMatch     string
+	ifNoneMatch string
+
+	createDestination             bool
+	createDestinationPublicAccess string
+
+	// whether blob data is encrypted with the customer-provided key given in the environment
+	cpkByValue bool
+
+	listOnly bool
 }
 
 func (raw *rawCopyCmdArgs) parsePatterns(pattern string) (cookedPatterns []string) {
@@ -275,6 +346,18 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		return cooked, err
 	}
 
+	if err = validateSASNotExpired(cooked.source.SAS, "source", time.Now()); err != nil {
+		return cooked, err
+	}
+	if err = validateSASNotExpired(cooked.destination.SAS, "destination", time.Now()); err != nil {
+		return cooked, err
+	}
+	// a job whose tokens are refreshed need not finish before they expire
+	cooked.sasRefreshCommand = raw.sasRefreshCommand
+	if cooked.sasRefreshCommand == "" {
+		cooked.sasExpiry = newSASExpiryWatcher(cooked.source.SAS, cooked.destination.SAS)
+	}
+
 	cooked.fromTo = fromTo
 	cooked.recursive = raw.recursive
 	cooked.followSymlinks = raw.followSymlinks
@@ -288,6 +371,13 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if err != nil {
 		return cooked, err
 	}
+	if raw.sourceNewerTolerance < 0 {
+		return cooked, errors.New("source-newer-tolerance must not be negative")
+	}
+	if raw.sourceNewerTolerance != 0 && cooked.forceWrite != common.EOverwriteOption.IfSourceNewer() {
+		return cooked, errors.New("source-newer-tolerance can only be used when overwrite is ifSourceNewer")
+	}
+	cooked.sourceNewerTolerance = raw.sourceNewerTolerance
 	allowAutoDecompress := fromTo == common.EFromTo.BlobLocal() || fromTo == common.EFromTo.FileLocal()
 	if raw.autoDecompress && !allowAutoDecompress {
 		return cooked, errors.New("automatic decompression is only supported for downloads from Blob and Azure Files") // as at Sept 2019, our ADLS Gen 2 Swagger does not include content-encoding for directory (path) listings so we can't support it there
@@ -330,6 +420,10 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if err != nil {
 		return cooked, err
 	}
+	err = cooked.logFormat.Parse(raw.logFormat)
+	if err != nil {
+		return cooked, err
+	}
 
 	// Everything uses the new implementation of list-of-files now.
 	// This handles both list-of-files and include-path as a list enumerator.
@@ -340,7 +434,7 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		return cooked, fmt.Errorf("the include and exclude parameters have been replaced by include-pattern; include-path; exclude-pattern and exclude-path. For info, run: azcopy copy help")
 	}
 
-	if (len(raw.include) > 0 || len(raw.exclude) > 0) && cooked.fromTo == common.EFromTo.BlobFSTrash() {
+	if (len(raw.include) > 0 || len(raw.exclude) > 0 || len(raw.includeRegex) > 0 || len(raw.excludeRegex) > 0) && cooked.fromTo == common.EFromTo.BlobFSTrash() {
 		return cooked, fmt.Errorf("include/exclude flags are not supported for this destination")
 		// note there's another, more rigorous check, in removeBfsResources()
 	}
@@ -350,18 +444,30 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 
 	// unbuffered so this reads as we need it to rather than all at once in bulk
 	listChan := make(chan string)
-	var f *os.File
+	var f, destinationsFile *os.File
 
+	if raw.listOfDestinations != "" && raw.listOfFilesToCopy == "" {
+		return cooked, errors.New("list-of-destinations can only be used together with list-of-files")
+	}
 	if raw.listOfFilesToCopy != "" {
 		f, err = os.Open(raw.listOfFilesToCopy)
 
 		if err != nil {
 			return cooked, fmt.Errorf("cannot open %s file passed with the list-of-file flag", raw.listOfFilesToCopy)
 		}
-	}
 
-	// Prepare UTF-8 byte order marker
-	utf8BOM := string([]byte{0xEF, 0xBB, 0xBF})
+		if raw.listOfDestinations != "" {
+			destinationsFile, err = os.Open(raw.listOfDestinations)
+			if err != nil {
+				return cooked, fmt.Errorf("cannot open %s file passed with the list-of-destinations flag", raw.listOfDestinations)
+			}
+		}
+
+		// the lists are read as they are enumerated, so check them all first, rather than stopping a job that is already running
+		if err = checkListOfFilesAndRewind(f, destinationsFile); err != nil {
+			return cooked, err
+		}
+	}
 
 	go func() {
 		defer close(listChan)
@@ -375,20 +481,19 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		}
 
 		if f != nil {
-			scanner := bufio.NewScanner(f)
-			checkBOM := false
+			var destinations io.Reader
+			if destinationsFile != nil {
+				destinations = destinationsFile
+			}
+			reader := newListOfFilesReader(f, destinations)
 			headerLineNum := 0
 			firstLineIsCurlyBrace := false
 
-			for scanner.Scan() {
-				v := scanner.Text()
-
-				// Check if the UTF-8 BOM is on the first line and remove it if necessary.
-				// Note that the UTF-8 BOM can be present on the same line feed as the first line of actual data, so just use TrimPrefix.
-				// If the line feed were separate, the empty string would be skipped later.
-				if !checkBOM {
-					v = strings.TrimPrefix(v, utf8BOM)
-					checkBOM = true
+			for {
+				// the lists were checked before enumerating them, so there's no error to report here
+				_, v, dst, ok, _ := reader.next()
+				if !ok {
+					break
 				}
 
 				// provide clear warning if user uses old (obsolete) format by mistake
@@ -408,7 +513,7 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 					headerLineNum++
 				}
 
-				addToChannel(v, "list-of-files")
+				addToChannel(listOfFilesEntry(v, dst), "list-of-files")
 			}
 		}
 
@@ -430,10 +535,13 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		cooked.listOfFilesChannel = listChan
 	}
 
+	// durations are relative to the same instant, so that a window like --include-after=48h --include-before=24h is exact
+	timeNow := time.Now()
+
 	if raw.includeBefore != "" {
 		// must set chooseEarliest = false, so that if there's an ambiguous local date, the latest will be returned
 		// (since that's safest for includeBefore.  Better to choose the later time and do more work, than the earlier one and fail to pick up a changed file
-		parsedIncludeBefore, err := includeBeforeDateFilter{}.ParseISO8601(raw.includeBefore, false)
+		parsedIncludeBefore, err := includeBeforeDateFilter{}.ParseISO8601OrDuration(raw.includeBefore, false, timeNow)
 		if err != nil {
 			return cooked, err
 		}
@@ -443,13 +551,38 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if raw.includeAfter != "" {
 		// must set chooseEarliest = true, so that if there's an ambiguous local date, the earliest will be returned
 		// (since that's safest for includeAfter.  Better to choose the earlier time and do more work, than the later one and fail to pick up a changed file
-		parsedIncludeAfter, err := includeAfterDateFilter{}.ParseISO8601(raw.includeAfter, true)
+		parsedIncludeAfter, err := includeAfterDateFilter{}.ParseISO8601OrDuration(raw.includeAfter, true, timeNow)
 		if err != nil {
 			return cooked, err
 		}
 		cooked.includeAfter = &parsedIncludeAfter
 	}
 
+	if cooked.includeBefore != nil && cooked.includeAfter != nil && cooked.includeAfter.After(*cooked.includeBefore) {
+		return cooked, fmt.Errorf("the time given for %s (%s) is later than the time given for %s (%s), so no files would be included",
+			common.IncludeAfterFlagName, formatAsUTC(*cooked.includeAfter), common.IncludeBeforeFlagName, formatAsUTC(*cooked.includeBefore))
+	}
+
+	if raw.minSize != "" {
+		minSize, err := parseSizeFilterValue(raw.minSize, "min-size")
+		if err != nil {
+			return cooked, err
+		}
+		cooked.minSize = &minSize
+	}
+
+	if raw.maxSize != "" {
+		maxSize, err := parseSizeFilterValue(raw.maxSize, "max-size")
+		if err != nil {
+			return cooked, err
+		}
+		cooked.maxSize = &maxSize
+	}
+
+	if cooked.minSize != nil && cooked.maxSize != nil && *cooked.minSize > *cooked.maxSize {
+		return cooked, fmt.Errorf("min-size (%d bytes) is larger than max-size (%d bytes), so no files would be included", *cooked.minSize, *cooked.maxSize)
+	}
+
 	versionsChan := make(chan string)
 	var filePtr *os.File
 	// Get file path from user which would contain list of all versionIDs
@@ -490,25 +623,108 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	}
 
 	cooked.metadata = raw.metadata
-	cooked.contentType = raw.contentType
-	cooked.contentEncoding = raw.contentEncoding
-	cooked.contentLanguage = raw.contentLanguage
-	cooked.contentDisposition = raw.contentDisposition
-	cooked.cacheControl = raw.cacheControl
+	cooked.contentType = truncateCustomHeader(raw.contentType, "content-type")
+	cooked.contentEncoding = truncateCustomHeader(raw.contentEncoding, "content-encoding")
+	cooked.contentLanguage = truncateCustomHeader(raw.contentLanguage, "content-language")
+	cooked.contentDisposition = truncateCustomHeader(raw.contentDisposition, "content-disposition")
+	cooked.cacheControl = truncateCustomHeader(raw.cacheControl, "cache-control")
 	cooked.noGuessMimeType = raw.noGuessMimeType
-	cooked.preserveLastModifiedTime = raw.preserveLastModifiedTime
 	cooked.includeDirectoryStubs = raw.includeDirectoryStubs
 
+	cooked.includeSnapshots = raw.includeSnapshots
+	if cooked.includeSnapshots && cooked.fromTo.From() != common.ELocation.Blob() {
+		return cooked, errors.New("snapshots can only be included when copying from blob storage")
+	}
+	if cooked.includeSnapshots && raw.listOfVersionIDs != "" {
+		return cooked, errors.New("include-snapshots cannot be used together with list-of-versions")
+	}
+
+	cooked.flattenDirectories = raw.flattenDirectories
+	if cooked.flattenDirectories && cooked.fromTo != common.EFromTo.LocalBlob() {
+		return cooked, errors.New("flatten-directories is only supported when uploading from a local directory to blob storage")
+	}
+	err = cooked.destinationCollisionOption.Parse(raw.destinationCollisionOption)
+	if err != nil {
+		return cooked, err
+	}
+	if !cooked.flattenDirectories && raw.stripPrefix == "" && raw.addPrefix == "" && raw.listOfFilesToCopy == "" &&
+		cooked.destinationCollisionOption != common.DefaultDestinationCollisionOption {
+		return cooked, errors.New("destination-collision-policy can only be used together with flatten-directories, strip-prefix, add-prefix or list-of-files, " +
+			"since only they can give two files the same destination")
+	}
+
+	cooked.stripPrefix = normalizeDestinationPrefix(raw.stripPrefix)
+	cooked.addPrefix = normalizeDestinationPrefix(raw.addPrefix)
+	if raw.stripPrefix != "" && cooked.stripPrefix == "" {
+		return cooked, fmt.Errorf("invalid strip-prefix '%s'", raw.stripPrefix)
+	}
+	if (cooked.stripPrefix != "" || cooked.addPrefix != "") && cooked.flattenDirectories {
+		return cooked, errors.New("strip-prefix and add-prefix cannot be used together with flatten-directories")
+	}
+	err = cooked.prefixMismatchOption.Parse(raw.prefixMismatchOption)
+	if err != nil {
+		return cooked, err
+	}
+	if cooked.stripPrefix == "" && cooked.prefixMismatchOption != common.DefaultPrefixMismatchOption {
+		return cooked, errors.New("strip-prefix-mismatch can only be used together with strip-prefix")
+	}
+
+	if raw.cpkByValue {
+		if cooked.fromTo != common.EFromTo.LocalBlob() && cooked.fromTo != common.EFromTo.BlobLocal() {
+			return cooked, errors.New("cpk-by-value is only supported when uploading to or downloading from blob storage")
+		}
+		cpkInfo, err := common.GetCpkInfoFromEnvironment()
+		if err != nil {
+			return cooked, err
+		}
+		cooked.cpkInfo = &cpkInfo
+	}
+
 	if cooked.fromTo.To() != common.ELocation.Blob() && raw.blobTags != "" {
 		return cooked, errors.New("blob tags can only be set when transferring to blob storage")
 	}
-	blobTags := common.ToCommonBlobTagsMap(raw.blobTags)
+	blobTags, err := common.ParseBlobTags(raw.blobTags)
+	if err != nil {
+		return cooked, err
+	}
 	err = validateBlobTagsKeyValue(blobTags)
 	if err != nil {
 		return cooked, err
 	}
 	cooked.blobTags = blobTags
 
+	cooked.createDestination = raw.createDestination
+	if cooked.createDestination && !cooked.fromTo.To().IsRemote() {
+		return cooked, errors.New("create-destination is only supported when the destination is Blob, File or ADLS Gen2 storage")
+	}
+	err = cooked.createDestinationPublicAccess.Parse(raw.createDestinationPublicAccess)
+	if err != nil {
+		return cooked, err
+	}
+	if cooked.createDestinationPublicAccess != common.EPublicAccessLevel.None() &&
+		(!cooked.createDestination || cooked.fromTo.To() != common.ELocation.Blob()) {
+		return cooked, errors.New("create-destination-public-access can only be used with create-destination, when the destination is Blob storage")
+	}
+
+	if err = validateDestAccessConditions(raw.ifMatch, raw.ifNoneMatch, cooked.fromTo, cooked.forceWrite); err != nil {
+		return cooked, err
+	}
+	cooked.ifMatch = raw.ifMatch
+	cooked.ifNoneMatch = raw.ifNoneMatch
+
+	cooked.s2sPreserveBlobTags = raw.s2sPreserveBlobTags
+	if cooked.s2sPreserveBlobTags {
+		if cooked.fromTo != common.EFromTo.BlobBlob() {
+			return cooked, errors.New("s2s-preserve-blob-tags is only supported when copying from blob storage to blob storage")
+		}
+		if raw.blobTags != "" {
+			return cooked, errors.New("s2s-preserve-blob-tags cannot be used together with blob-tags")
+		}
+		if raw.listOfVersionIDs != "" {
+			return cooked, errors.New("s2s-preserve-blob-tags cannot be used together with list-of-versions")
+		}
+	}
+
 	// Make sure the given input is the one of the enums given by the blob SDK
 	err = cooked.deleteSnapshotsOption.Parse(raw.deleteSnapshotsOption)
 	if err != nil {
@@ -519,14 +735,53 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		cooked.noGuessMimeType = true // As specified in the help text, noGuessMimeType is inferred here.
 	}
 
+	if raw.contentTypeOverrides != "" {
+		if cooked.fromTo.From() != common.ELocation.Local() {
+			return cooked, errors.New("content-type-overrides is only supported when uploading")
+		}
+		if cooked.noGuessMimeType {
+			return cooked, errors.New("content-type-overrides cannot be used with content-type or no-guess-mime-type")
+		}
+		cooked.contentTypeOverrides, err = loadContentTypeOverrides(raw.contentTypeOverrides)
+		if err != nil {
+			return cooked, err
+		}
+	}
+
 	cooked.putMd5 = raw.putMd5
 	err = cooked.md5ValidationOption.Parse(raw.md5ValidationOption)
 	if err != nil {
 		return cooked, err
 	}
+	err = cooked.checksumAlgorithm.Parse(raw.checksumAlgorithm)
+	if err != nil {
+		return cooked, err
+	}
 	globalBlobFSMd5ValidationOption = cooked.md5ValidationOption // workaround, to avoid having to pass this all the way through the chain of methods in enumeration, just for one weird and (presumably) temporary workaround
 
 	cooked.CheckLength = raw.CheckLength
+	cooked.dryrunMode = raw.dryrun
+	cooked.listOnly = raw.listOnly
+	if cooked.listOnly && cooked.dryrunMode {
+		return cooked, errors.New("list-only cannot be used together with dry-run")
+	}
+	cooked.parallelTransfers = raw.parallelTransfers
+	if raw.maxDuration < 0 {
+		return cooked, fmt.Errorf("invalid max-duration %v, it must not be negative", raw.maxDuration)
+	}
+	cooked.maxDuration = raw.maxDuration
+	if raw.maxRetries < -1 {
+		return cooked, fmt.Errorf("invalid max-retries %v, it must be 0 or more, or -1 for the engine default", raw.maxRetries)
+	}
+	cooked.maxRetries = raw.maxRetries
+	if err = validateTransfersPerPart(raw.transfersPerPart); err != nil {
+		return cooked, err
+	}
+	cooked.transfersPerPart = raw.transfersPerPart
+	if err = cooked.transferOrder.Parse(raw.transferOrder); err != nil {
+		return cooked, err
+	}
+	cooked.maxTotalBytes = raw.maxTotalBytes
 	// length of devnull will be 0, thus this will always fail unless downloading an empty file
 	if cooked.destination.Value == common.Dev_Null {
 		cooked.CheckLength = false
@@ -534,6 +789,20 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 
 	// if redirection is triggered, avoid printing any output
 	if cooked.isRedirection() {
+		if cooked.dryrunMode {
+			return cooked, errors.New("dry-run is not supported when piping data in or out of AzCopy")
+		}
+		if cooked.listOnly {
+			return cooked, errors.New("list-only is not supported when piping data in or out of AzCopy")
+		}
+		if cooked.fromTo == common.EFromTo.PipeBlob() {
+			err = validateRedirectionBlob(cooked.destination, "destination of an upload from stdin")
+		} else {
+			err = validateRedirectionBlob(cooked.source, "source of a download to stdout")
+		}
+		if err != nil {
+			return cooked, err
+		}
 		glcm.SetOutputFormat(common.EOutputFormat.None())
 	}
 
@@ -550,6 +819,38 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		return cooked, err
 	}
 
+	if err = validatePreserveLastModifiedTime(raw.preserveLastModifiedTime, raw.explicitPreserveLMT, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	// the flag is on by default, so it only takes effect where there is a local file to stamp
+	cooked.preserveLastModifiedTime = raw.preserveLastModifiedTime && cooked.fromTo.IsDownload()
+
+	cooked.preservePOSIXProperties = raw.preservePOSIXProperties
+	if err = validatePreservePOSIXProperties(cooked.preservePOSIXProperties, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	cooked.preserveACLs = raw.preserveACLs
+	if err = validatePreserveACLs(cooked.preserveACLs, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	cooked.preserveImmutability = raw.preserveImmutability
+	if err = validatePreserveImmutability(cooked.preserveImmutability, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	if cooked.immutabilityPolicyExpiresOn, cooked.immutabilityPolicyMode, err = parseImmutabilityPolicy(raw.immutabilityUntil, raw.immutabilityMode, cooked.fromTo, time.Now()); err != nil {
+		return cooked, err
+	}
+	// directories are listed as stub blobs, and copying those is what gives each destination directory its ACL
+	cooked.includeDirectoryStubs = cooked.includeDirectoryStubs || cooked.preserveACLs
+
+	cooked.emptyFolderMarkers = raw.emptyFolderMarkers
+	if err = validateEmptyFolderMarkers(cooked.emptyFolderMarkers, cooked.fromTo, cooked.recursive, cooked.flattenDirectories); err != nil {
+		return cooked, err
+	}
+	// the markers are the directory stubs, which the enumeration otherwise leaves out
+	cooked.includeDirectoryStubs = cooked.includeDirectoryStubs || (cooked.emptyFolderMarkers && cooked.fromTo.IsDownload())
+
 	if err = crossValidateSymlinksAndPermissions(cooked.followSymlinks, cooked.preserveSMBPermissions.IsTruthy()); err != nil {
 		return cooked, err
 	}
@@ -567,9 +868,6 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		if cooked.blobType != common.EBlobType.Detect() {
 			return cooked, fmt.Errorf("blob-type is not supported on ADLS Gen 2")
 		}
-		if cooked.preserveLastModifiedTime {
-			return cooked, fmt.Errorf("preserve-last-modified-time is not supported while uploading")
-		}
 		if cooked.blockBlobTier != common.EBlockBlobTier.None() ||
 			cooked.pageBlobTier != common.EPageBlobTier.None() {
 			return cooked, fmt.Errorf("blob-tier is not supported while uploading to ADLS Gen 2")
@@ -590,9 +888,6 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 			return cooked, fmt.Errorf("s2s-detect-source-changed is not supported while uploading")
 		}
 	case common.EFromTo.LocalBlob():
-		if cooked.preserveLastModifiedTime {
-			return cooked, fmt.Errorf("preserve-last-modified-time is not supported while uploading to Blob Storage")
-		}
 		if cooked.s2sPreserveProperties {
 			return cooked, fmt.Errorf("s2s-preserve-properties is not supported while uploading to Blob Storage")
 		}
@@ -606,9 +901,6 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 			return cooked, fmt.Errorf("s2s-detect-source-changed is not supported while uploading to Blob Storage")
 		}
 	case common.EFromTo.LocalFile():
-		if cooked.preserveLastModifiedTime {
-			return cooked, fmt.Errorf("preserve-last-modified-time is not supported while uploading")
-		}
 		if cooked.blockBlobTier != common.EBlockBlobTier.None() ||
 			cooked.pageBlobTier != common.EPageBlobTier.None() {
 			return cooked, fmt.Errorf("blob-tier is not supported while uploading to Azure File")
@@ -661,9 +953,6 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 		common.EFromTo.BlobBlob(),
 		common.EFromTo.FileBlob(),
 		common.EFromTo.FileFile():
-		if cooked.preserveLastModifiedTime {
-			return cooked, fmt.Errorf("preserve-last-modified-time is not supported while copying from service to service")
-		}
 		if cooked.followSymlinks {
 			return cooked, fmt.Errorf("follow-symlinks flag is not supported while copying from service to service")
 		}
@@ -690,6 +979,30 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	if err = validateMd5Option(cooked.md5ValidationOption, cooked.fromTo); err != nil {
 		return cooked, err
 	}
+	if err = validateChecksumAlgorithm(cooked.checksumAlgorithm, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+	if err = validateAppendOverwrite(cooked.forceWrite, cooked.blobType, cooked.fromTo, cooked.putMd5); err != nil {
+		return cooked, err
+	}
+	if err = validateGzipUpload(raw.gzipUpload, cooked.fromTo, cooked.blobType, cooked.contentEncoding); err != nil {
+		return cooked, err
+	}
+	if (raw.gzipMinSize != "" || raw.gzipExtensions != "") && !raw.gzipUpload {
+		return cooked, errors.New("gzip-min-size and gzip-extensions can only be used with gzip")
+	}
+	cooked.gzipUpload = raw.gzipUpload
+	if raw.gzipMinSize != "" {
+		if cooked.gzipMinSize, err = parseSizeFilterValue(raw.gzipMinSize, "gzip-min-size"); err != nil {
+			return cooked, err
+		}
+	}
+	if cooked.gzipExtensions, err = parseGzipExtensions(raw.gzipExtensions); err != nil {
+		return cooked, err
+	}
+	if err = validateIfNotExistsOverwrite(cooked.forceWrite, cooked.fromTo); err != nil {
+		return cooked, err
+	}
 
 	// Because of some of our defaults, these must live down here and can't be properly checked.
 	// TODO: Remove the above checks where they can't be done.
@@ -697,6 +1010,29 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	cooked.s2sGetPropertiesInBackend = raw.s2sGetPropertiesInBackend
 	cooked.s2sPreserveAccessTier = raw.s2sPreserveAccessTier
 	cooked.s2sSourceChangeValidation = raw.s2sSourceChangeValidation
+	cooked.retryChangedFiles = raw.retryChangedFiles
+	if err = validateRetryChangedFiles(cooked.retryChangedFiles, cooked.fromTo, cooked.s2sSourceChangeValidation); err != nil {
+		return cooked, err
+	}
+	if cooked.bandwidthSchedule, err = common.ParseBandwidthSchedule(raw.capMbpsSchedule); err != nil {
+		return cooked, fmt.Errorf("invalid cap-mbps-schedule: %w", err)
+	}
+	cooked.s2sRehydrateArchivedSource = raw.s2sRehydrateArchivedSource
+	if cooked.s2sRehydrateArchivedSource && !(cooked.fromTo.IsS2S() && cooked.fromTo.From() == common.ELocation.Blob()) {
+		return cooked, fmt.Errorf("s2s-rehydrate-archived-source is only supported when copying from Blob Storage to another service")
+	}
+
+	if err = cooked.s2sCopyMethod.Parse(raw.s2sCopyMethod); err != nil {
+		return cooked, fmt.Errorf("error parsing s2s-copy-method: %w", err)
+	}
+	if cooked.s2sCopyMethod == common.ES2SCopyMethod.AsyncCopy() {
+		if cooked.fromTo != common.EFromTo.BlobBlob() {
+			return cooked, fmt.Errorf("s2s-copy-method AsyncCopy is only supported when copying from Blob Storage to Blob Storage")
+		}
+		if cooked.blobType != common.EBlobType.Detect() {
+			return cooked, fmt.Errorf("s2s-copy-method AsyncCopy cannot change the blob type, so it cannot be used with blob-type")
+		}
+	}
 
 	// If the user has provided some input with excludeBlobType flag, parse the input.
 	if len(raw.excludeBlobType) > 0 {
@@ -722,6 +1058,14 @@ func (raw rawCopyCmdArgs) cookWithId(jobId common.JobID) (cookedCopyCmdArgs, err
 	cooked.excludePatterns = raw.parsePatterns(raw.exclude)
 	cooked.excludePathPatterns = raw.parsePatterns(raw.excludePath)
 
+	// compile the regexes now, so that a bad one is reported before we start enumerating
+	if cooked.includeRegexFilters, err = buildRegexFilters(raw.parsePatterns(raw.includeRegex), true); err != nil {
+		return cooked, fmt.Errorf("error parsing include-regex: %w", err)
+	}
+	if cooked.excludeRegexFilters, err = buildRegexFilters(raw.parsePatterns(raw.excludeRegex), false); err != nil {
+		return cooked, fmt.Errorf("error parsing exclude-regex: %w", err)
+	}
+
 	if (raw.includeFileAttributes != "" || raw.excludeFileAttributes != "") && fromTo.From() != common.ELocation.Local() {
 		return cooked, errors.New("cannot check file attributes on remote objects")
 	}
@@ -751,9 +1095,16 @@ func (raw *rawCopyCmdArgs) setMandatoryDefaults() {
 	raw.blockBlobTier = common.EBlockBlobTier.None().String()
 	raw.pageBlobTier = common.EPageBlobTier.None().String()
 	raw.md5ValidationOption = common.DefaultHashValidationOption.String()
+	raw.checksumAlgorithm = common.EHashAlgorithm.MD5().String()
 	raw.s2sInvalidMetadataHandleOption = common.DefaultInvalidMetadataHandleOption.String()
 	raw.forceWrite = common.EOverwriteOption.True().String()
 	raw.preserveOwner = common.PreserveOwnerDefault
+	raw.preserveLastModifiedTime = common.PreserveLastModifiedTimeDefault
+	raw.destinationCollisionOption = common.DefaultDestinationCollisionOption.String()
+	raw.prefixMismatchOption = common.DefaultPrefixMismatchOption.String()
+	raw.transferOrder = common.ETransferOrder.Plan().String()
+	raw.s2sCopyMethod = common.DefaultS2SCopyMethod.String()
+	raw.maxRetries = -1
 }
 
 func validateForceIfReadOnly(toForce bool, fromTo common.FromTo) error {
@@ -769,10 +1120,13 @@ func validateForceIfReadOnly(toForce bool, fromTo common.FromTo) error {
 }
 
 func validatePreserveSMBPropertyOption(toPreserve bool, fromTo common.FromTo, overwrite *common.OverwriteOption, flagName string) error {
+	// Blobs have no SMB properties of their own, but they can keep those of Windows files in their metadata
 	if toPreserve && !(fromTo == common.EFromTo.LocalFile() ||
 		fromTo == common.EFromTo.FileLocal() ||
-		fromTo == common.EFromTo.FileFile()) {
-		return fmt.Errorf("%s is set but the job is not between SMB-aware resources", flagName)
+		fromTo == common.EFromTo.FileFile() ||
+		fromTo == common.EFromTo.LocalBlob() ||
+		fromTo == common.EFromTo.BlobLocal()) {
+		return fmt.Errorf("%s is set but the job is not between SMB-aware resources, or between Windows and Blob storage", flagName)
 	}
 
 	if toPreserve && (fromTo.IsUpload() || fromTo.IsDownload()) && runtime.GOOS != "windows" {
@@ -786,6 +1140,87 @@ func validatePreserveSMBPropertyOption(toPreserve bool, fromTo common.FromTo, ov
 	return nil
 }
 
+func validatePreservePOSIXProperties(toPreserve bool, fromTo common.FromTo) error {
+	if !toPreserve {
+		return nil
+	}
+	if fromTo != common.EFromTo.LocalBlob() && fromTo != common.EFromTo.BlobLocal() && fromTo != common.EFromTo.LocalBlobFS() {
+		return errors.New("preserve-posix-properties is only supported for uploads to, and downloads from, Blob storage, and for uploads to ADLS Gen2")
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("preserve-posix-properties is not supported on Windows")
+	}
+	return nil
+}
+
+func validatePreserveACLs(toPreserve bool, fromTo common.FromTo) error {
+	if toPreserve && fromTo != common.EFromTo.BlobBlob() {
+		return errors.New("preserve-acls is only supported for copies between Blob storage accounts that have a hierarchical namespace (ADLS Gen2)")
+	}
+	return nil
+}
+
+func validatePreserveImmutability(toPreserve bool, fromTo common.FromTo) error {
+	if toPreserve && fromTo != common.EFromTo.BlobBlob() {
+		return errors.New("preserve-immutability is only supported for copies between Blob storage accounts")
+	}
+	return nil
+}
+
+// parseImmutabilityPolicy reads the immutability policy that immutability-until and immutability-mode give to every blob that is written.
+// The expiry is zero if there is no such policy.
+func parseImmutabilityPolicy(until, mode string, fromTo common.FromTo, now time.Time) (time.Time, common.ImmutabilityPolicyMode, error) {
+	policyMode := common.EImmutabilityPolicyMode.Unlocked()
+	if until == "" {
+		if mode != "" {
+			return time.Time{}, policyMode, errors.New("immutability-mode can only be used with immutability-until")
+		}
+		return time.Time{}, policyMode, nil
+	}
+	if fromTo.To() != common.ELocation.Blob() {
+		return time.Time{}, policyMode, errors.New("immutability-until is only supported when the destination is Blob storage")
+	}
+	expiresOn, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return time.Time{}, policyMode, fmt.Errorf("immutability-until must be a date and time in RFC 3339 form, such as 2030-01-02T15:04:05Z: %w", err)
+	}
+	if !expiresOn.After(now) {
+		return time.Time{}, policyMode, errors.New("immutability-until must be in the future")
+	}
+	if mode != "" {
+		if err = policyMode.Parse(mode); err != nil {
+			return time.Time{}, policyMode, fmt.Errorf("error parsing the immutability-mode %s provided: %w", mode, err)
+		}
+	}
+	return expiresOn, policyMode, nil
+}
+
+func validateRetryChangedFiles(retry bool, fromTo common.FromTo, s2sSourceChangeValidation bool) error {
+	if !retry || fromTo.IsUpload() || (fromTo.IsS2S() && s2sSourceChangeValidation) {
+		return nil
+	}
+	if fromTo.IsS2S() {
+		return errors.New("retry-changed-files can only be used on service-to-service copies when s2s-detect-source-changed is also set")
+	}
+	return errors.New("retry-changed-files is only supported for uploads and service-to-service copies")
+}
+
+func validateEmptyFolderMarkers(markers bool, fromTo common.FromTo, recursive, flattenDirectories bool) error {
+	if !markers {
+		return nil
+	}
+	if fromTo != common.EFromTo.LocalBlob() && fromTo != common.EFromTo.BlobLocal() {
+		return errors.New("empty-folder-markers is only supported for uploads to, and downloads from, Blob storage")
+	}
+	if !recursive {
+		return errors.New("empty-folder-markers can only be used together with recursive, since only then are folders processed")
+	}
+	if flattenDirectories {
+		return errors.New("empty-folder-markers cannot be used together with flatten-directories, which uploads no folders")
+	}
+	return nil
+}
+
 func validatePreserveOwner(preserve bool, fromTo common.FromTo) error {
 	if fromTo.IsDownload() {
 		return nil // it can be used in downloads
@@ -796,6 +1231,18 @@ func validatePreserveOwner(preserve bool, fromTo common.FromTo) error {
 	return nil
 }
 
+// validatePreserveLastModifiedTime rejects asking for the last modified time to be preserved where there is no local file to stamp.
+// The flag is on by default, so only an explicit true is rejected; turning it off has no effect, so that is allowed anywhere.
+func validatePreserveLastModifiedTime(preserve bool, explicit bool, fromTo common.FromTo) error {
+	if fromTo.IsDownload() {
+		return nil // it can be used in downloads
+	}
+	if preserve && explicit {
+		return fmt.Errorf("flag --%s can only be used on downloads", common.PreserveLastModifiedTimeFlagName)
+	}
+	return nil
+}
+
 func crossValidateSymlinksAndPermissions(followSymlinks, preservePermissions bool) error {
 	if followSymlinks && preservePermissions {
 		return errors.New("cannot follow symlinks when preserving permissions (since the correct permission inheritance behaviour for symlink targets is undefined)")
@@ -837,6 +1284,154 @@ func validateMd5Option(option common.HashValidationOption, fromTo common.FromTo)
 	return nil
 }
 
+// validateIfNotExistsOverwrite checks that overwrite is only 'ifNotExists' when the destination can be written on the condition that it doesn't exist
+func validateIfNotExistsOverwrite(overwrite common.OverwriteOption, fromTo common.FromTo) error {
+	if overwrite == common.EOverwriteOption.IfNotExists() && fromTo.To() != common.ELocation.Blob() {
+		return errors.New("overwrite is 'ifNotExists', but it is only supported when the destination is Blob storage")
+	}
+	return nil
+}
+
+// only append blobs can be appended to. And, since the source then becomes only the tail of the destination,
+// the destination's Content-MD5 cannot be computed from the source
+func validateAppendOverwrite(overwrite common.OverwriteOption, blobType common.BlobType, fromTo common.FromTo, putMd5 bool) error {
+	if overwrite != common.EOverwriteOption.Append() {
+		return nil
+	}
+	if fromTo.To() != common.ELocation.Blob() || blobType != common.EBlobType.AppendBlob() {
+		return errors.New("overwrite is 'append', but it is only supported when the destination is Blob storage and blob-type is AppendBlob")
+	}
+	if putMd5 {
+		return errors.New("put-md5 is not supported when overwrite is 'append'")
+	}
+	return nil
+}
+
+// validateDestAccessConditions checks that if-match and if-none-match are only used where the service can make writing the destination
+// conditional on its ETag, and with overwrite modes that leave that decision to the service
+func validateDestAccessConditions(ifMatch, ifNoneMatch string, fromTo common.FromTo, overwrite common.OverwriteOption) error {
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+	if fromTo.To() != common.ELocation.Blob() {
+		return errors.New("if-match and if-none-match are only supported when the destination is Blob storage")
+	}
+	if ifMatch != "" && ifNoneMatch != "" {
+		return errors.New("if-match and if-none-match cannot be used together")
+	}
+	if ifMatch != "" && overwrite != common.EOverwriteOption.True() {
+		// any other overwrite mode decides for itself whether an existing blob is written, often without trying to write it
+		return errors.New("if-match can only be used when overwrite is true")
+	}
+	if overwrite == common.EOverwriteOption.Append() {
+		return errors.New("if-none-match cannot be used when overwrite is 'append'")
+	}
+	if overwrite == common.EOverwriteOption.IfNotExists() {
+		return errors.New("if-none-match cannot be used when overwrite is 'ifNotExists', which already writes blobs only if they don't exist")
+	}
+	return nil
+}
+
+// Files can only be compressed as they are uploaded when they become block blobs, since the blocks are cut from the compressed data.
+// The content encoding of the blobs that are compressed is always gzip, so it can't be set as well.
+func validateGzipUpload(gzipUpload bool, fromTo common.FromTo, blobType common.BlobType, contentEncoding string) error {
+	if !gzipUpload {
+		return nil
+	}
+	if fromTo != common.EFromTo.LocalBlob() {
+		return errors.New("gzip is only supported when uploading to Blob storage")
+	}
+	if blobType != common.EBlobType.Detect() && blobType != common.EBlobType.BlockBlob() {
+		return errors.New("gzip is only supported for block blobs")
+	}
+	if contentEncoding != "" {
+		return errors.New("content-encoding cannot be used with gzip, which sets the content encoding of the files it compresses to 'gzip'")
+	}
+	return nil
+}
+
+// parseGzipExtensions turns the semicolon-separated extensions given to gzip-extensions, such as "log;.JSON", into the form that
+// the plan file keeps them in: lower case, each with its leading dot, e.g. ".log;.json"
+func parseGzipExtensions(raw string) (string, error) {
+	var extensions []string
+	for _, ext := range strings.Split(raw, ";") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	result := strings.Join(extensions, ";")
+	if len(result) > ste.CustomHeaderMaxBytes {
+		return "", fmt.Errorf("gzip-extensions is too long; it must be at most %d characters", ste.CustomHeaderMaxBytes)
+	}
+	return result, nil
+}
+
+// SHA-256 hashes are kept in blob metadata, so only blob uploads and downloads can put or check them
+func validateChecksumAlgorithm(algorithm common.HashAlgorithm, fromTo common.FromTo) error {
+	if algorithm != common.EHashAlgorithm.MD5() && fromTo != common.EFromTo.LocalBlob() && fromTo != common.EFromTo.BlobLocal() {
+		return fmt.Errorf("checksum-algorithm %s is only supported when uploading to, or downloading from, Blob storage", algorithm)
+	}
+	return nil
+}
+
+// truncateCustomHeader shortens the value given for a header flag to what the job plan file can hold.
+// The user is warned, since the header will not be set exactly as given.
+func truncateCustomHeader(value string, flagName string) string {
+	if len(value) <= ste.CustomHeaderMaxBytes {
+		return value
+	}
+
+	// cut before the character that the limit falls in, so as not to leave part of a multi-byte character at the end
+	cut := ste.CustomHeaderMaxBytes
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	truncated := value[:cut]
+	glcm.Info(fmt.Sprintf("The value of --%s is longer than %d bytes and has been truncated to %q.", flagName, ste.CustomHeaderMaxBytes, truncated))
+	return truncated
+}
+
+// loadContentTypeOverrides reads the JSON object given with --content-type-overrides, which maps file extensions to content types.
+// Extensions are matched case-insensitively, with or without their leading dot.
+func loadContentTypeOverrides(filePath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s file passed with the content-type-overrides flag: %w", filePath, err)
+	}
+
+	var raw map[string]string
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("the content-type-overrides file must be a JSON object of extensions to content types: %w", err)
+	}
+
+	overrides := make(map[string]string, len(raw))
+	for ext, contentType := range raw {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			return nil, errors.New("the content-type-overrides file contains an empty extension")
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		contentType = strings.TrimSpace(contentType)
+		if contentType == "" {
+			return nil, fmt.Errorf("the content-type-overrides file has no content type for %s", ext)
+		}
+		// unlike --content-type, a truncated type would be applied silently to every matching file, so refuse it instead
+		if len(contentType) > ste.CustomHeaderMaxBytes {
+			return nil, fmt.Errorf("the content type for %s in the content-type-overrides file is longer than %d bytes", ext, ste.CustomHeaderMaxBytes)
+		}
+		overrides[ext] = contentType
+	}
+	return overrides, nil
+}
+
 // Valid tag key and value characters include:
 // 1. Lowercase and uppercase letters (a-z, A-Z)
 // 2. Digits (0-9)
@@ -859,37 +1454,45 @@ func validateBlobTagsKeyValue(bt common.BlobTags) error {
 	if len(bt) > 10 {
 		return errors.New("at-most 10 tags can be associated with a blob")
 	}
-	for k, v := range bt {
-		key, err := url.QueryUnescape(k)
-		if err != nil {
-			return err
-		}
-		value, err := url.QueryUnescape(v)
-		if err != nil {
-			return err
-		}
-
+	for key, value := range bt {
 		if key == "" || len(key) > 128 || len(value) > 256 {
 			return errors.New("tag keys must be between 1 and 128 characters, and tag values must be between 0 and 256 characters")
 		}
 
 		if !isValidBlobTagsKeyValue(key) {
-			return errors.New("incorrect character set used in key: " + k)
+			return errors.New("incorrect character set used in key: " + key)
 		}
 
 		if !isValidBlobTagsKeyValue(value) {
-			return errors.New("incorrect character set used in value: " + v)
+			return errors.New("incorrect character set used in value: " + value)
 		}
 	}
 	return nil
 }
 
+// validateRedirectionBlob checks that the blob that data is piped into, or out of, is a single, named, blob.
+// Unlike a file, a stream gives no name to append to a container or virtual directory, and can only hold one blob.
+// role describes the blob in the error, e.g. "destination of an upload from stdin".
+func validateRedirectionBlob(blob common.ResourceString, role string) error {
+	u, err := blob.FullURL()
+	if err != nil {
+		return fmt.Errorf("cannot parse the URL of the %s due to error: %s", role, err.Error())
+	}
+	blobName := azblob.NewBlobURLParts(*u).BlobName
+	if blobName == "" || strings.HasSuffix(blobName, common.AZCOPY_PATH_SEPARATOR_STRING) || strings.Contains(blobName, "*") {
+		return fmt.Errorf("the %s must be a single blob, not a container or virtual directory", role)
+	}
+	return nil
+}
+
 // represents the processed copy command input from the user
 type cookedCopyCmdArgs struct {
 	// from arguments
 	source      common.ResourceString
 	destination common.ResourceString
 	fromTo      common.FromTo
+	// warns if the job looks set to outlast its SAS tokens. Nil if they do not expire.
+	sasExpiry *sasExpiryWatcher
 
 	// new include/exclude only apply to file names
 	// implemented for remove (and sync) only
@@ -897,10 +1500,14 @@ type cookedCopyCmdArgs struct {
 	includePatterns       []string
 	excludePatterns       []string
 	excludePathPatterns   []string
+	includeRegexFilters   []objectFilter
+	excludeRegexFilters   []objectFilter
 	includeFileAttributes []string
 	excludeFileAttributes []string
 	includeBefore         *time.Time
 	includeAfter          *time.Time
+	minSize               *int64
+	maxSize               *int64
 
 	// list of version ids
 	listOfVersionIDs chan string
@@ -911,7 +1518,13 @@ type cookedCopyCmdArgs struct {
 	followSymlinks     bool
 	forceWrite         common.OverwriteOption // says whether we should try to overwrite
 	forceIfReadOnly    bool                   // says whether we should _force_ any overwrites (triggered by forceWrite) to work on Azure Files objects that are set to read-only
-	autoDecompress     bool
+	// how much newer the source must be than the destination, when forceWrite is ifSourceNewer
+	sourceNewerTolerance time.Duration
+	autoDecompress       bool
+	// when uploading block blobs, compress (some of) the files with gzip on the way
+	gzipUpload     bool
+	gzipMinSize    int64
+	gzipExtensions string
 
 	// options from flags
 	blockSize int64
@@ -921,6 +1534,7 @@ type cookedCopyCmdArgs struct {
 	// Blob index tags categorize data in your storage account utilizing key-value tag attributes.
 	// These tags are automatically indexed and exposed as a queryable multi-dimensional index to easily find data.
 	blobTags                 common.BlobTags
+	s2sPreserveBlobTags      bool
 	blockBlobTier            common.BlockBlobTier
 	pageBlobTier             common.PageBlobTier
 	metadata                 string
@@ -930,12 +1544,37 @@ type cookedCopyCmdArgs struct {
 	contentDisposition       string
 	cacheControl             string
 	noGuessMimeType          bool
+	contentTypeOverrides     map[string]string
 	preserveLastModifiedTime bool
 	deleteSnapshotsOption    common.DeleteSnapshotsOption
 	putMd5                   bool
 	md5ValidationOption      common.HashValidationOption
+	checksumAlgorithm        common.HashAlgorithm
 	CheckLength              bool
 	logVerbosity             common.LogLevel
+	logFormat                common.LogFormat
+	// if true, the job plan is written out and the planned transfers are listed, but nothing is transferred
+	dryrunMode bool
+	// what the planned transfers of a dry run would cost, as they are enumerated
+	dryrunEstimate dryRunCostEstimate
+	// the maximum number of this job's transfers to have in progress at once. 0 means use the engine default
+	parallelTransfers uint16
+	// how long each run of the job may last before it stops starting transfers and is cancelled. 0 means no limit
+	maxDuration time.Duration
+	// how many times each failed transfer may be retried, over all resumes of the job. -1 means use the engine default
+	maxRetries int32
+	// whether a file that changes while it is being sent is started again at once, rather than failed
+	retryChangedFiles bool
+	// the most transfers that each job part is given. 0 means use the default
+	transfersPerPart uint32
+	// the order in which the transfers of each job part are scheduled
+	transferOrder common.TransferOrder
+	// the most data that the job may transfer, over all its runs. 0 means no limit
+	maxTotalBytes uint64
+	// the bandwidth cap by time of day while the job runs. Empty if the cap doesn't vary
+	bandwidthSchedule common.BandwidthSchedule
+	// the command line that prints a new SAS token when one is about to expire. Empty if the tokens are not refreshed
+	sasRefreshCommand string
 	// commandString hold the user given command which is logged to the Job log file
 	commandString string
 
@@ -963,6 +1602,15 @@ type cookedCopyCmdArgs struct {
 	preserveSMBPermissions common.PreservePermissionsOption
 	// Whether the user wants to preserve the SMB properties ...
 	preserveSMBInfo bool
+	// Whether the user wants to preserve POSIX permission bits and ownership, by way of blob metadata
+	preservePOSIXProperties bool
+	// Whether the user wants to copy the owner, group and ACL of each file between ADLS Gen2 accounts
+	preserveACLs bool
+	// Whether the user wants to copy the immutability policy and legal hold of each blob between blob accounts
+	preserveImmutability bool
+	// the immutability policy to give every blob that is written, if immutabilityPolicyExpiresOn is not zero
+	immutabilityPolicyExpiresOn time.Time
+	immutabilityPolicyMode      common.ImmutabilityPolicyMode
 
 	// Whether to enable Windows special privileges
 	backupMode bool
@@ -981,6 +1629,10 @@ type cookedCopyCmdArgs struct {
 	// whether user wants to check if source has changed after enumerating, the default value is true.
 	// For S2S copy, as source is a remote resource, validating whether source has changed need additional request costs.
 	s2sSourceChangeValidation bool
+	// whether archived source blobs should be rehydrated and waited for, rather than failing the transfer.
+	s2sRehydrateArchivedSource bool
+	// specify how the service is asked to copy blobs from blobs
+	s2sCopyMethod common.S2SCopyMethod
 	// specify how user wants to handle invalid metadata.
 	s2sInvalidMetadataHandleOption common.InvalidMetadataHandleOption
 
@@ -993,6 +1645,42 @@ type cookedCopyCmdArgs struct {
 
 	// whether to include blobs that have metadata 'hdi_isfolder = true'
 	includeDirectoryStubs bool
+
+	// whether to also copy each source blob's snapshots, each to a destination whose name includes the snapshot time
+	includeSnapshots bool
+
+	// whether the files found in the subdirectories of a local source are uploaded under their names alone, rather than under their relative paths
+	flattenDirectories bool
+	// what to do when flattening or renaming gives two files the same destination
+	destinationCollisionOption common.DestinationCollisionOption
+	// whether empty folders are uploaded as zero-byte marker blobs, and such blobs downloaded as folders
+	emptyFolderMarkers bool
+
+	// the prefix that is removed from the relative path of each source file, to give its path at the destination
+	stripPrefix string
+	// the prefix that is put in front of the relative path of each source file (after stripPrefix is removed), to give its path at the destination
+	addPrefix string
+	// what to do with a source file whose relative path doesn't start with stripPrefix
+	prefixMismatchOption common.PrefixMismatchOption
+
+	// whether the destination container (or share, or file system) is created before the transfers start, if it doesn't exist yet
+	createDestination bool
+	// how much of a container created by createDestination can be read anonymously
+	createDestinationPublicAccess common.PublicAccessLevel
+
+	// the ETag the destination blob must have (or "*" for any), for it to be written
+	ifMatch string
+	// the ETag the destination blob must not have (or "*" for it not to exist at all), for it to be written
+	ifNoneMatch string
+
+	// the customer-provided key with which blob data is encrypted, or nil to use the service's own keys
+	cpkInfo *common.CpkInfo
+
+	// whether the transfers are only listed, as they are enumerated, rather than planned and run.
+	// Unlike a dry run, no job (and so no plan file) is created.
+	listOnly           bool
+	listOnlyFileCount  uint32
+	listOnlyTotalBytes uint64
 }
 
 func (cca *cookedCopyCmdArgs) isRedirection() bool {
@@ -1075,18 +1763,84 @@ func (cca *cookedCopyCmdArgs) processRedirectionDownload(blobResource common.Res
 		return fmt.Errorf("fatal: cannot download blob due to error: %s", err.Error())
 	}
 
+	// a blob that must have an MD5, but has none, is refused before any of it is written, just as a job's download would be
+	expectedMD5 := blobStream.ContentMD5()
+	if len(expectedMD5) == 0 && cca.md5ValidationOption == common.EHashValidationOption.FailIfDifferentOrMissing() {
+		return fmt.Errorf("fatal: %s", ste.CheckStreamedMD5(expectedMD5, nil, cca.md5ValidationOption, nil))
+	}
+
 	blobBody := blobStream.Body(azblob.RetryReaderOptions{MaxRetryRequests: ste.MaxRetryPerDownloadBody})
 	defer blobBody.Close()
 
-	// step 4: pipe everything into Stdout
-	_, err = io.Copy(os.Stdout, blobBody)
+	// step 4: pipe everything into Stdout. The body is read as a single stream, so it reaches Stdout in order.
+	// Progress goes to Stderr, so that Stdout holds nothing but the blob.
+	hasher := md5.New()
+	progress := newRedirectionProgress(os.Stderr, blobStream.ContentLength())
+	_, err = io.Copy(io.MultiWriter(os.Stdout, hasher, progress), blobBody)
+	progress.stop()
 	if err != nil {
 		return fmt.Errorf("fatal: cannot download blob to Stdout due to error: %s", err.Error())
 	}
 
+	warn := func(msg string) { fmt.Fprintln(os.Stderr, "WARNING: "+msg) }
+	if err = ste.CheckStreamedMD5(expectedMD5, hasher.Sum(nil), cca.md5ValidationOption, warn); err != nil {
+		return fmt.Errorf("fatal: the blob was written to Stdout, but %s", err.Error())
+	}
 	return nil
 }
 
+// redirectionProgressInterval is how often the progress of a download to Stdout is reported
+const redirectionProgressInterval = 2 * time.Second
+
+// redirectionProgress is an io.Writer that counts the bytes written through it, and reports them to out every
+// redirectionProgressInterval, until it is stopped
+type redirectionProgress struct {
+	out          io.Writer
+	total        int64
+	atomicCount  int64
+	done         chan struct{}
+	reporterDone chan struct{}
+}
+
+func newRedirectionProgress(out io.Writer, total int64) *redirectionProgress {
+	p := &redirectionProgress{out: out, total: total, done: make(chan struct{}), reporterDone: make(chan struct{})}
+	go func() {
+		defer close(p.reporterDone)
+		ticker := time.NewTicker(redirectionProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *redirectionProgress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.atomicCount, int64(len(b)))
+	return len(b), nil
+}
+
+func (p *redirectionProgress) report() {
+	count := atomic.LoadInt64(&p.atomicCount)
+	percent := 100.0
+	if p.total > 0 {
+		percent = 100 * float64(count) / float64(p.total)
+	}
+	fmt.Fprintf(p.out, "%v of %v bytes written to Stdout (%.1f%%)\n", count, p.total, percent)
+}
+
+// stop ends the periodic reports, with a final one
+func (p *redirectionProgress) stop() {
+	close(p.done)
+	<-p.reporterDone
+	p.report()
+}
+
 func (cca *cookedCopyCmdArgs) processRedirectionUpload(blobResource common.ResourceString, blockSize int64) error {
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
@@ -1128,6 +1882,10 @@ func (cca *cookedCopyCmdArgs) processRedirectionUpload(blobResource common.Resou
 // dispatches the job order (in parts) to the storage engine
 func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
+	if cca.cpkInfo != nil {
+		// the source blobs must be read with the key during enumeration too
+		ctx = context.WithValue(ctx, ste.CpkInfoOverride, *cca.cpkInfo)
+	}
 
 	// Note: credential info here is only used by remove at the moment.
 	// TODO: Get the entirety of remove into the new copyEnumeratorInit script so we can remove this
@@ -1161,34 +1919,55 @@ func (cca *cookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 	// initialize the fields that are constant across all job part orders,
 	// and for which we have sufficient info now to set them
 	jobPartOrder := common.CopyJobPartOrderRequest{
-		JobID:           cca.jobID,
-		FromTo:          cca.fromTo,
-		ForceWrite:      cca.forceWrite,
-		ForceIfReadOnly: cca.forceIfReadOnly,
-		AutoDecompress:  cca.autoDecompress,
-		Priority:        common.EJobPriority.Normal(),
-		LogLevel:        cca.logVerbosity,
-		ExcludeBlobType: cca.excludeBlobType,
+		JobID:                cca.jobID,
+		FromTo:               cca.fromTo,
+		ForceWrite:           cca.forceWrite,
+		ForceIfReadOnly:      cca.forceIfReadOnly,
+		SourceNewerTolerance: cca.sourceNewerTolerance,
+		TTLAfterCompletion:   cmdLineJobPlanTTL,
+		Concurrency:          cca.parallelTransfers,
+		MaxDuration:          cca.maxDuration,
+		MaxRetries:           cca.maxRetries,
+		RetryChangedFiles:    cca.retryChangedFiles,
+		TransferOrder:        cca.transferOrder,
+		MaxTotalBytes:        cca.maxTotalBytes,
+		BandwidthSchedule:    cca.bandwidthSchedule,
+		SASRefreshCommand:    cca.sasRefreshCommand,
+		AutoDecompress:       cca.autoDecompress,
+		Priority:             common.EJobPriority.Normal(),
+		LogLevel:             cca.logVerbosity,
+		LogFormat:            cca.logFormat,
+		ExcludeBlobType:      cca.excludeBlobType,
 		BlobAttributes: common.BlobTransferAttributes{
-			BlobType:                 cca.blobType,
-			BlockSizeInBytes:         cca.blockSize,
-			ContentType:              cca.contentType,
-			ContentEncoding:          cca.contentEncoding,
-			ContentLanguage:          cca.contentLanguage,
-			ContentDisposition:       cca.contentDisposition,
-			CacheControl:             cca.cacheControl,
-			BlockBlobTier:            cca.blockBlobTier,
-			PageBlobTier:             cca.pageBlobTier,
-			Metadata:                 cca.metadata,
-			NoGuessMimeType:          cca.noGuessMimeType,
-			PreserveLastModifiedTime: cca.preserveLastModifiedTime,
-			PutMd5:                   cca.putMd5,
-			MD5ValidationOption:      cca.md5ValidationOption,
-			DeleteSnapshotsOption:    cca.deleteSnapshotsOption,
-			BlobTagsString:           cca.blobTags.ToString(),
+			BlobType:                    cca.blobType,
+			BlockSizeInBytes:            cca.blockSize,
+			ContentType:                 cca.contentType,
+			ContentEncoding:             cca.contentEncoding,
+			ContentLanguage:             cca.contentLanguage,
+			ContentDisposition:          cca.contentDisposition,
+			CacheControl:                cca.cacheControl,
+			BlockBlobTier:               cca.blockBlobTier,
+			PageBlobTier:                cca.pageBlobTier,
+			Metadata:                    cca.metadata,
+			NoGuessMimeType:             cca.noGuessMimeType,
+			PreserveLastModifiedTime:    cca.preserveLastModifiedTime,
+			PutMd5:                      cca.putMd5,
+			MD5ValidationOption:         cca.md5ValidationOption,
+			ChecksumAlgorithm:           cca.checksumAlgorithm,
+			DeleteSnapshotsOption:       cca.deleteSnapshotsOption,
+			BlobTagsString:              cca.blobTags.ToString(),
+			GzipUpload:                  cca.gzipUpload,
+			GzipMinSize:                 cca.gzipMinSize,
+			GzipExtensions:              cca.gzipExtensions,
+			ImmutabilityPolicyExpiresOn: cca.immutabilityPolicyExpiresOn,
+			ImmutabilityPolicyMode:      cca.immutabilityPolicyMode,
 		},
-		CommandString:  cca.commandString,
-		CredentialInfo: cca.credentialInfo,
+		CommandString:        cca.commandString,
+		CredentialInfo:       cca.credentialInfo,
+		ContentTypeOverrides: cca.contentTypeOverrides,
+	}
+	if cca.cpkInfo != nil {
+		jobPartOrder.CpkKeySha256 = cca.cpkInfo.EncryptionKeySha256
 	}
 
 	from := cca.fromTo.From()
@@ -1295,6 +2074,130 @@ func (cca *cookedCopyCmdArgs) waitUntilJobCompletion(blocking bool) {
 	}
 }
 
+// dryRunCostEstimate is what running the planned transfers of a dry run would roughly cost, for users to check against the price list
+type dryRunCostEstimate struct {
+	// the requests that move the data (see ste.EstimateTransferRequests)
+	EstimatedRequests uint64 `json:",string"`
+	// the bytes read out of a remote source, which are charged as egress by downloads and, across regions, by service to service copies
+	EstimatedEgressBytes uint64 `json:",string"`
+}
+
+// add counts the cost of the given planned transfer into the estimate
+func (e *dryRunCostEstimate) add(fromTo common.FromTo, blobType common.BlobType, blockSize int64, transfer common.CopyTransfer) {
+	if transfer.EntityType != common.EEntityType.File() {
+		return // folders have no data to move
+	}
+	e.EstimatedRequests += ste.EstimateTransferRequests(fromTo, blobType, transfer.SourceSize, blockSize)
+	if fromTo.From().IsRemote() {
+		e.EstimatedEgressBytes += uint64(transfer.SourceSize)
+	}
+}
+
+// remove takes the cost of a planned transfer, that is no longer to run, back out of the estimate
+func (e *dryRunCostEstimate) remove(fromTo common.FromTo, blobType common.BlobType, blockSize int64, transfer common.CopyTransfer) {
+	if transfer.EntityType != common.EEntityType.File() {
+		return
+	}
+	e.EstimatedRequests -= ste.EstimateTransferRequests(fromTo, blobType, transfer.SourceSize, blockSize)
+	if fromTo.From().IsRemote() {
+		e.EstimatedEgressBytes -= uint64(transfer.SourceSize)
+	}
+}
+
+// reportDryRunAndExit summarizes the plan written for a dry-run job and exits, since none of its transfers will ever run
+func (cca *cookedCopyCmdArgs) reportDryRunAndExit() {
+	var summary common.ListJobSummaryResponse
+	Rpc(common.ERpcCmd.ListJobSummary(), &cca.jobID, &summary)
+
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			jsonOutput, err := json.Marshal(struct {
+				common.ListJobSummaryResponse
+				dryRunCostEstimate
+			}{summary, cca.dryrunEstimate})
+			common.PanicIfErr(err)
+			return string(jsonOutput)
+		}
+
+		return fmt.Sprintf("DRYRUN: job %s planned %v transfers totalling %v bytes. No data was transferred. "+
+			"Running the job would take about %v requests, and read %v bytes out of the source storage (its egress). "+
+			"Use 'azcopy jobs show %s' to inspect the plan, and 'azcopy jobs remove %s' to delete it.",
+			summary.JobID, summary.TotalTransfers, summary.TotalBytesExpected, cca.dryrunEstimate.EstimatedRequests, cca.dryrunEstimate.EstimatedEgressBytes,
+			summary.JobID, summary.JobID)
+	}, cca.getSuccessExitCode())
+}
+
+// reportListOnlyTransfer prints a transfer found by a list-only enumeration, in place of adding it to a job part
+func (cca *cookedCopyCmdArgs) reportListOnlyTransfer(e *common.CopyJobPartOrderRequest, transfer common.CopyTransfer) {
+	entry := common.ListOnlyTransferJsonTemplate{
+		SchemaVersion: common.JsonOutputSchemaVersion,
+		Path:          listOnlyTransferPath(e.SourceRoot.Value, transfer, cca.fromTo.From()),
+		SourceSize:    transfer.SourceSize,
+		ModifiedTime:  transfer.LastModifiedTime,
+	}
+	if transfer.EntityType == common.EEntityType.Folder() {
+		entry.Path += common.AZCOPY_PATH_SEPARATOR_STRING
+	} else {
+		cca.listOnlyFileCount++
+		cca.listOnlyTotalBytes += uint64(transfer.SourceSize)
+	}
+
+	if azcopyOutputFormat == common.EOutputFormat.Json() {
+		// each entry is a message of its own, so that it can be consumed as it is enumerated
+		glcm.Progress(func(common.OutputFormat) string {
+			return common.GetJsonStringFromTemplate(entry)
+		})
+		return
+	}
+	glcm.Info(fmt.Sprintf("%s; Content Length: %d; Last Modified: %s", entry.Path, entry.SourceSize, entry.ModifiedTime.Format(time.RFC3339)))
+}
+
+// listOnlyTransferPath returns the unescaped path of the transfer's source, relative to the source root,
+// or the name of the source itself if it is a single file (in which case the transfer has no relative path)
+func listOnlyTransferPath(sourceRoot string, transfer common.CopyTransfer, from common.Location) string {
+	relativePath := strings.TrimPrefix(transfer.Source, common.AZCOPY_PATH_SEPARATOR_STRING)
+	if !from.IsRemote() {
+		return common.IffString(relativePath == "", filepath.Base(sourceRoot), relativePath)
+	}
+
+	if relativePath == "" {
+		if u, err := url.Parse(sourceRoot); err == nil {
+			return path.Base(u.Path) // already unescaped
+		}
+		return path.Base(sourceRoot)
+	}
+	if unescaped, err := url.PathUnescape(relativePath); err == nil {
+		relativePath = unescaped
+	}
+	return relativePath
+}
+
+// reportListOnlyAndExit summarizes a list-only enumeration and exits
+func (cca *cookedCopyCmdArgs) reportListOnlyAndExit() {
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			return common.GetJsonStringFromTemplate(common.ListOnlySummaryJsonTemplate{
+				SchemaVersion: common.JsonOutputSchemaVersion,
+				FileCount:     cca.listOnlyFileCount,
+				TotalBytes:    cca.listOnlyTotalBytes,
+			})
+		}
+
+		return fmt.Sprintf("LISTONLY: found %v files totalling %v bytes. No job was created.", cca.listOnlyFileCount, cca.listOnlyTotalBytes)
+	}, common.EExitCode.Success())
+}
+
+// Pause stops the job starting any more transfers, so that it can be resumed later, and lets those in flight finish.
+// A job that could not be resumed as a whole is cancelled instead.
+func (cca *cookedCopyCmdArgs) Pause(lcm common.LifecycleMgr) {
+	// a job whose enumeration is not complete is missing parts, and the follow-up of a job is not run when it is resumed
+	if !cca.isEnumerationComplete || cca.hasFollowup() {
+		cca.Cancel(lcm)
+		return
+	}
+	pauseJob(lcm, cca.jobID)
+}
+
 func (cca *cookedCopyCmdArgs) Cancel(lcm common.LifecycleMgr) {
 	// prompt for confirmation, except when enumeration is complete
 	if !cca.isEnumerationComplete {
@@ -1389,7 +2292,7 @@ Number of Transfers Completed: %v
 Number of Transfers Failed: %v
 Number of Transfers Skipped: %v
 TotalBytesTransferred: %v
-Final Job Status: %v%s%s
+Final Job Status: %v%s%s%s
 `,
 					summary.JobID.String(),
 					ste.ToFixed(duration.Minutes(), 4),
@@ -1400,7 +2303,8 @@ Final Job Status: %v%s%s
 					summary.TransfersFailed,
 					summary.TransfersSkipped,
 					summary.TotalBytesTransferred,
-					summary.JobStatus,
+					formatJobStatus(summary.JobStatus, summary.CancelReason),
+					formatTransferTimings(summary),
 					screenStats,
 					formatPerfAdvice(summary.PerformanceAdvice))
 
@@ -1427,6 +2331,14 @@ Final Job Status: %v%s%s
 		}
 	}
 
+	if summary.JobStatus == common.EJobStatus.Paused() {
+		exitPausedJob(lcm, summary)
+	}
+
+	if warning := cca.sasExpiry.check(summary, duration, time.Now()); warning != "" {
+		lcm.Info("WARNING: " + warning)
+	}
+
 	var computeThroughput = func() float64 {
 		// compute the average throughput for the last time interval
 		bytesInMb := float64(float64(summary.BytesOverWire-cca.intervalBytesTransferred) / float64(base10Mega))
@@ -1480,6 +2392,23 @@ Final Job Status: %v%s%s
 	return
 }
 
+// formatJobStatus describes the final status of a job, noting when it was cancelled because it overran its maximum duration,
+// rather than on request.
+func formatJobStatus(status common.JobStatus, reason common.JobCancelReason) string {
+	if status != common.EJobStatus.Cancelled() {
+		return status.String()
+	}
+	switch reason {
+	case common.EJobCancelReason.MaxDurationExceeded():
+		return fmt.Sprintf("%v (the job ran for longer than its maximum duration)", status)
+	case common.EJobCancelReason.SASExpired():
+		return fmt.Sprintf("%v (the SAS token expired; resume the job with a new one)", status)
+	case common.EJobCancelReason.MaxTotalBytesReached():
+		return fmt.Sprintf("%v (the job would have gone past its maximum total bytes)", status)
+	}
+	return status.String()
+}
+
 func formatPerfAdvice(advice []common.PerformanceAdvice) string {
 	if len(advice) == 0 {
 		return ""
@@ -1575,6 +2504,28 @@ func init() {
 		Long:       copyCmdLongDescription,
 		Example:    copyCmdExample,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if raw.fromStdin && raw.toStdout {
+				return errors.New("from-stdin and to-stdout cannot be used together")
+			}
+			if raw.fromStdin {
+				if len(args) != 1 {
+					return errors.New("from-stdin takes just one argument, the destination blob")
+				}
+				if raw.fromTo != "" && !strings.EqualFold(raw.fromTo, common.EFromTo.PipeBlob().String()) {
+					return fmt.Errorf("from-stdin cannot be used with from-to %s", raw.fromTo)
+				}
+				raw.fromTo = common.EFromTo.PipeBlob().String()
+			}
+			if raw.toStdout {
+				if len(args) != 1 {
+					return errors.New("to-stdout takes just one argument, the source blob")
+				}
+				if raw.fromTo != "" && !strings.EqualFold(raw.fromTo, common.EFromTo.BlobPipe().String()) {
+					return fmt.Errorf("to-stdout cannot be used with from-to %s", raw.fromTo)
+				}
+				raw.fromTo = common.EFromTo.BlobPipe().String()
+			}
+
 			if len(args) == 1 { // redirection
 				// Enforce the usage of from-to flag when pipes are involved
 				if raw.fromTo == "" {
@@ -1607,6 +2558,7 @@ func init() {
 				glcm.EnableInputWatcher()
 				if cancelFromStdin {
 					glcm.EnableCancelFromStdIn()
+					glcm.EnableBandwidthCapFromStdIn(setBandwidthCap)
 				}
 			} else {
 				return errors.New("wrong number of arguments, please refer to the help page on usage of this command")
@@ -1614,6 +2566,7 @@ func init() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			raw.explicitPreserveLMT = cmd.Flags().Changed(common.PreserveLastModifiedTimeFlagName)
 			cooked, err := raw.cook()
 			if err != nil {
 				glcm.Error("failed to parse user input due to error: " + err.Error())
@@ -1634,26 +2587,51 @@ func init() {
 
 	// filters change which files get transferred
 	cpCmd.PersistentFlags().BoolVar(&raw.followSymlinks, "follow-symlinks", false, "Follow symbolic links when uploading from local file system.")
-	cpCmd.PersistentFlags().StringVar(&raw.includeBefore, common.IncludeBeforeFlagName, "", "Include only those files modified before or on the given date/time. The value should be in ISO8601 format. If no timezone is specified, the value is assumed to be in the local timezone of the machine running AzCopy. E.g. '2020-08-19T15:04:00Z' for a UTC time, or '2020-08-19' for midnight (00:00) in the local timezone. As of AzCopy 10.7, this flag applies only to files, not folders, so folder properties won't be copied when using this flag with --preserve-smb-info or --preserve-smb-permissions.")
-	cpCmd.PersistentFlags().StringVar(&raw.includeAfter, common.IncludeAfterFlagName, "", "Include only those files modified on or after the given date/time. The value should be in ISO8601 format. If no timezone is specified, the value is assumed to be in the local timezone of the machine running AzCopy. E.g. '2020-08-19T15:04:00Z' for a UTC time, or '2020-08-19' for midnight (00:00) in the local timezone. As of AzCopy 10.5, this flag applies only to files, not folders, so folder properties won't be copied when using this flag with --preserve-smb-info or --preserve-smb-permissions.")
+	cpCmd.PersistentFlags().StringVar(&raw.includeBefore, common.IncludeBeforeFlagName, "", "Include only those files modified before or on the given date/time. The value should be in ISO8601 format, or be a duration before the current time, such as '24h'. If no timezone is specified, the value is assumed to be in the local timezone of the machine running AzCopy. E.g. '2020-08-19T15:04:00Z' for a UTC time, or '2020-08-19' for midnight (00:00) in the local timezone. As of AzCopy 10.7, this flag applies only to files, not folders, so folder properties won't be copied when using this flag with --preserve-smb-info or --preserve-smb-permissions.")
+	cpCmd.PersistentFlags().StringVar(&raw.includeAfter, common.IncludeAfterFlagName, "", "Include only those files modified on or after the given date/time. The value should be in ISO8601 format, or be a duration before the current time, such as '24h'. If no timezone is specified, the value is assumed to be in the local timezone of the machine running AzCopy. E.g. '2020-08-19T15:04:00Z' for a UTC time, or '2020-08-19' for midnight (00:00) in the local timezone. As of AzCopy 10.5, this flag applies only to files, not folders, so folder properties won't be copied when using this flag with --preserve-smb-info or --preserve-smb-permissions.")
 	cpCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "", "Include only these files when copying. "+
-		"This option supports wildcard characters (*). Separate files by using a ';'.")
+		"This option supports wildcard characters (* and ?). Separate files by using a ';'. Patterns are case-sensitive, and match the file name, "+
+		"unless they contain a '/', in which case they match the path relative to the source (For example: *.pdf;reports/*/summary.docx).")
 	cpCmd.PersistentFlags().StringVar(&raw.includePath, "include-path", "", "Include only these paths when copying. "+
 		"This option does not support wildcard characters (*). Checks relative path prefix (For example: myFolder;myFolder/subDirName/file.pdf).")
 	cpCmd.PersistentFlags().StringVar(&raw.excludePath, "exclude-path", "", "Exclude these paths when copying. "+ // Currently, only exclude-path is supported alongside account traversal.
 		"This option does not support wildcard characters (*). Checks relative path prefix(For example: myFolder;myFolder/subDirName/file.pdf). When used in combination with account traversal, paths do not include the container name.")
 	// This flag is implemented only for Storage Explorer.
-	cpCmd.PersistentFlags().StringVar(&raw.listOfFilesToCopy, "list-of-files", "", "Defines the location of text file which has the list of only files to be copied.")
-	cpCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude these files when copying. This option supports wildcard characters (*)")
-	cpCmd.PersistentFlags().StringVar(&raw.forceWrite, "overwrite", "true", "Overwrite the conflicting files and blobs at the destination if this flag is set to true. (default 'true') Possible values include 'true', 'false', 'prompt', and 'ifSourceNewer'. For destinations that support folders, conflicting folder-level properties will be overwritten this flag is 'true' or if a positive response is provided to the prompt.")
+	cpCmd.PersistentFlags().StringVar(&raw.listOfFilesToCopy, "list-of-files", "", "Defines the location of text file which has the list of only files to be copied. "+
+		"Each line holds a path relative to the source, which may be a directory. The whole list is checked before anything is copied, and a malformed line fails the command, naming its line number.")
+	cpCmd.PersistentFlags().StringVar(&raw.listOfDestinations, "list-of-destinations", "", "Defines the location of a text file whose lines give the destinations of the lines of list-of-files. "+
+		"Line n holds a path relative to the destination, to copy the source on line n of list-of-files there instead of to the same relative path, or is empty to leave it at that path. "+
+		"Neither --flatten-directories nor the prefix flags change such destinations.")
+	cpCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude these files when copying. This option supports wildcard characters (* and ?), "+
+		"and its patterns match in the same way as those of include-pattern. A file that matches both an include and an exclude pattern is excluded.")
+	cpCmd.PersistentFlags().StringVar(&raw.minSize, "min-size", "", "Include only those files whose size is at least the given number of bytes. "+
+		"The size may be followed by K, M, G or T (powers of 1024). E.g. '1KB' or '10MiB'. Files that are filtered out are not transferred, and are not counted as skipped.")
+	cpCmd.PersistentFlags().StringVar(&raw.maxSize, "max-size", "", "Include only those files whose size is at most the given number of bytes. "+
+		"The size may be followed by K, M, G or T (powers of 1024). E.g. '1KB' or '10MiB'. Files that are filtered out are not transferred, and are not counted as skipped.")
+	cpCmd.PersistentFlags().StringVar(&raw.includeRegex, "include-regex", "", "Include only the files whose path relative to the source matches one of these regular expressions. "+
+		"Separate the expressions by using a ';'. When combined with include-pattern, a file must satisfy both (For example: ^reports/20[0-9]{2}/.*\\.pdf$).")
+	cpCmd.PersistentFlags().StringVar(&raw.excludeRegex, "exclude-regex", "", "Exclude the files whose path relative to the source matches any of these regular expressions. "+
+		"Separate the expressions by using a ';'. A file that is excluded by either exclude-regex or exclude-pattern is not copied.")
+	cpCmd.PersistentFlags().StringVar(&raw.forceWrite, "overwrite", "true", "Overwrite the conflicting files and blobs at the destination if this flag is set to true. (default 'true') Possible values include 'true', 'false', 'prompt', 'ifSourceNewer', 'append', and 'ifNotExists'. With 'append', which requires blob-type AppendBlob, the source is appended to destination blobs that already exist. "+
+		"'ifNotExists', which requires a Blob destination, skips existing blobs like 'false', but without looking each one up first: the service refuses to write a blob that already exists. This saves a request per file when most destinations already exist. For destinations that support folders, conflicting folder-level properties will be overwritten this flag is 'true' or if a positive response is provided to the prompt.")
 	cpCmd.PersistentFlags().BoolVar(&raw.autoDecompress, "decompress", false, "Automatically decompress files when downloading, if their content-encoding indicates that they are compressed. The supported content-encoding values are 'gzip' and 'deflate'. File extensions of '.gz'/'.gzip' or '.zz' aren't necessary, but will be removed if present.")
+	cpCmd.PersistentFlags().BoolVar(&raw.gzipUpload, "gzip", false, "Compress files with gzip as they are uploaded to block blobs, so that they are stored compressed, with a content-encoding of 'gzip'. "+
+		"The blobs are decompressed by clients that honor the content-encoding, and by downloads that use --decompress. Their length is that of the compressed data.")
+	cpCmd.PersistentFlags().StringVar(&raw.gzipMinSize, "gzip-min-size", "", "Only compress the files of at least this size, e.g. 1MiB, when using --gzip. Smaller files are uploaded as they are.")
+	cpCmd.PersistentFlags().StringVar(&raw.gzipExtensions, "gzip-extensions", "", "Only compress the files with one of these extensions, separated by semicolons, e.g. '.log;.json;.csv', when using --gzip. Other files are uploaded as they are.")
 	cpCmd.PersistentFlags().BoolVar(&raw.recursive, "recursive", false, "Look into sub-directories recursively when uploading from local file system.")
 	cpCmd.PersistentFlags().StringVar(&raw.fromTo, "from-to", "", "Optionally specifies the source destination combination. For Example: LocalBlob, BlobLocal, LocalBlobFS. Piping: BlobPipe, PipeBlob")
+	cpCmd.PersistentFlags().BoolVar(&raw.fromStdin, "from-stdin", false, "Upload the data piped into AzCopy to the blob given as the only argument, as a block blob. "+
+		"The data is staged in blocks of block-size-mb as it arrives, and committed at the end of the input, so no temporary file is needed. "+
+		"Same as --from-to PipeBlob. Since AzCopy runs no job for it, such an upload cannot be resumed.")
+	cpCmd.PersistentFlags().BoolVar(&raw.toStdout, "to-stdout", false, "Download the blob given as the only argument to stdout, in order, e.g. to pipe it into another command. "+
+		"Its MD5 hash is checked as set by check-md5, once the whole blob has been written, and progress is reported on stderr. Same as --from-to BlobPipe.")
 	cpCmd.PersistentFlags().StringVar(&raw.excludeBlobType, "exclude-blob-type", "", "Optionally specifies the type of blob (BlockBlob/ PageBlob/ AppendBlob) to exclude when copying blobs from the container "+
 		"or the account. Use of this flag is not applicable for copying data from non azure-service to service. More than one blob should be separated by ';'. ")
 	// options change how the transfers are performed
 	cpCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage, and downloading from Azure Storage. The default value is automatically calculated based on file size. Decimal fractions are allowed (For example: 0.25).")
 	cpCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "Define the log verbosity for the log file, available levels: INFO(all requests/responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs). (default 'INFO').")
+	cpCmd.PersistentFlags().StringVar(&raw.logFormat, "log-format", common.ELogFormat.Text().String(), "Define how the entries of the log file are written, available formats: Text(readable by people) and Json(one JSON object per line, with the timestamp, level, job ID, event type and transfer path of the entry, for log aggregators to ingest).")
 	cpCmd.PersistentFlags().StringVar(&raw.blobType, "blob-type", "Detect", "Defines the type of blob at the destination. This is used for uploading blobs and when copying between accounts (default 'Detect'). Valid values include 'Detect', 'BlockBlob', 'PageBlob', and 'AppendBlob'. "+
 		"When copying between accounts, a value of 'Detect' causes AzCopy to use the type of source blob to determine the type of the destination blob. When uploading a file, 'Detect' determines if the file is a VHD or a VHDX file based on the file extension. If the file is either a VHD or VHDX file, AzCopy treats the file as a page blob.")
 	cpCmd.PersistentFlags().StringVar(&raw.blockBlobTier, "block-blob-tier", "None", "upload block blob to Azure Storage using this blob tier.")
@@ -1665,26 +2643,105 @@ func init() {
 	cpCmd.PersistentFlags().StringVar(&raw.contentLanguage, "content-language", "", "Set the content-language header. Returned on download.")
 	cpCmd.PersistentFlags().StringVar(&raw.cacheControl, "cache-control", "", "Set the cache-control header. Returned on download.")
 	cpCmd.PersistentFlags().BoolVar(&raw.noGuessMimeType, "no-guess-mime-type", false, "Prevents AzCopy from detecting the content-type based on the extension or content of the file.")
-	cpCmd.PersistentFlags().BoolVar(&raw.preserveLastModifiedTime, "preserve-last-modified-time", false, "Only available when destination is file system.")
-	cpCmd.PersistentFlags().BoolVar(&raw.preserveSMBPermissions, "preserve-smb-permissions", false, "False by default. Preserves SMB ACLs between aware resources (Windows and Azure Files). For downloads, you will also need the --backup flag to restore permissions where the new Owner will not be the user running AzCopy. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern).")
+	cpCmd.PersistentFlags().StringVar(&raw.contentTypeOverrides, "content-type-overrides", "", "Path to a JSON file mapping file extensions to content types, e.g. {\".md\": \"text/markdown\"}. Used ahead of AzCopy's own detection when uploading.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preserveLastModifiedTime, common.PreserveLastModifiedTimeFlagName, common.PreserveLastModifiedTimeDefault, "Only has an effect in downloads. If true (the default), each downloaded file's last modified time is set to that of its source. If the local file system does not allow it, a warning is logged and the file keeps the time it was written.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preserveSMBPermissions, "preserve-smb-permissions", false, "False by default. Preserves SMB ACLs between aware resources (Windows and Azure Files). For downloads, you will also need the --backup flag to restore permissions where the new Owner will not be the user running AzCopy. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern). For uploads from Windows to Blob storage, the ACLs are kept in the blob's metadata, so that downloading with this flag restores them.")
 	cpCmd.PersistentFlags().BoolVar(&raw.preserveOwner, common.PreserveOwnerFlagName, common.PreserveOwnerDefault, "Only has an effect in downloads, and only when --preserve-smb-permissions is used. If true (the default), the file Owner and Group are preserved in downloads. If set to false, --preserve-smb-permissions will still preserve ACLs but Owner and Group will be based on the user running AzCopy")
-	cpCmd.PersistentFlags().BoolVar(&raw.preserveSMBInfo, "preserve-smb-info", false, "False by default. Preserves SMB property info (last write time, creation time, attribute bits) between SMB-aware resources (Windows and Azure Files). Only the attribute bits supported by Azure Files will be transferred; any others will be ignored. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern). The info transferred for folders is the same as that for files, except for Last Write Time which is never preserved for folders.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preserveSMBInfo, "preserve-smb-info", false, "False by default. Preserves SMB property info (last write time, creation time, attribute bits) between SMB-aware resources (Windows and Azure Files). Only the attribute bits supported by Azure Files will be transferred; any others will be ignored. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern). The info transferred for folders is the same as that for files, except for Last Write Time which is never preserved for folders. For uploads from Windows to Blob storage, the info is kept in the blob's metadata, so that downloading with this flag restores it.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preservePOSIXProperties, "preserve-posix-properties", false, "False by default. Preserves POSIX permission bits, owner and group between a Linux/Unix file system and Blob storage. They are stored in the blob's metadata on upload, and applied to the file on download. If AzCopy is not allowed to change a downloaded file's owner, the permission bits are still applied and a warning is logged. "+
+		"On upload to ADLS Gen2, files and folders are also given the permission bits natively, and files keep all three in their properties, from which a download through the blob endpoint restores them.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preserveACLs, "preserve-acls", false, "False by default. Only applies to copies between Blob storage accounts that have a hierarchical namespace (ADLS Gen2). "+
+		"Gives each destination file the owner, owning group and POSIX access control list of its source, after the file has been written. "+
+		"With --recursive, directories are copied too, so that they keep theirs. The identity running AzCopy must be allowed to change ownership at the destination.")
+	cpCmd.PersistentFlags().BoolVar(&raw.preserveImmutability, "preserve-immutability", false, "False by default. Only applies to copies between Blob storage accounts. "+
+		"Gives each destination blob the immutability policy and legal hold of its source, after the blob has been written. "+
+		"If the destination container does not have version-level immutability enabled, a warning is given and the blobs are copied without them.")
+	cpCmd.PersistentFlags().StringVar(&raw.immutabilityUntil, "immutability-until", "", "Gives every blob that is written an immutability policy that lasts until this date and time, in RFC 3339 form (e.g. '2030-01-02T15:04:05Z'). "+
+		"It takes the place of any policy preserved with --preserve-immutability. Only applies when the destination is Blob storage, and, as with --preserve-immutability, is skipped with a warning if the destination does not support it.")
+	cpCmd.PersistentFlags().StringVar(&raw.immutabilityMode, "immutability-mode", "", "The mode of the policy given by --immutability-until: 'Unlocked' (the default) or 'Locked'. "+
+		"A locked policy can only be extended, and until it expires the blobs cannot be changed or deleted.")
+	cpCmd.PersistentFlags().DurationVar(&raw.sourceNewerTolerance, "source-newer-tolerance", 0, "Only applies when overwrite is 'ifSourceNewer'. A source is then only transferred if it was modified more than this long (e.g. '2s') after the destination, to allow for clock skew between the machines. Last modified times are compared to the whole second.")
 	cpCmd.PersistentFlags().BoolVar(&raw.forceIfReadOnly, "force-if-read-only", false, "When overwriting an existing file on Windows or Azure Files, force the overwrite to work even if the existing file has its read-only attribute set")
 	cpCmd.PersistentFlags().BoolVar(&raw.backupMode, common.BackupModeFlagName, false, "Activates Windows' SeBackupPrivilege for uploads, or SeRestorePrivilege for downloads, to allow AzCopy to see read all files, regardless of their file system permissions, and to restore all permissions. Requires that the account running AzCopy already has these permissions (e.g. has Administrator rights or is a member of the 'Backup Operators' group). All this flag does is activate privileges that the account already has")
 	cpCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "Create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob or file. (By default the hash is NOT created.) Only available when uploading.")
-	cpCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. Only available when downloading. Available options: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent')")
+	cpCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. Only available when downloading. Available options: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. NoCheck also skips hashing the downloaded data, for workloads where that costs too much. (default 'FailIfDifferent')")
+	cpCmd.PersistentFlags().StringVar(&raw.checksumAlgorithm, "checksum-algorithm", common.EHashAlgorithm.MD5().String(), "Specifies the hash algorithm used by put-md5 and check-md5. Available options: MD5, SHA256. MD5 hashes are kept in the Content-MD5 property; SHA256 hashes are kept in the '"+common.SHA256MetadataKey+"' metadata of the blob, and are only available when uploading to, or downloading from, Blob storage.")
 	cpCmd.PersistentFlags().StringVar(&raw.includeFileAttributes, "include-attributes", "", "(Windows only) Include files whose attributes match the attribute list. For example: A;S;R")
 	cpCmd.PersistentFlags().StringVar(&raw.excludeFileAttributes, "exclude-attributes", "", "(Windows only) Exclude files whose attributes match the attribute list. For example: A;S;R")
 	cpCmd.PersistentFlags().BoolVar(&raw.CheckLength, "check-length", true, "Check the length of a file on the destination after the transfer. If there is a mismatch between source and destination, the transfer is marked as failed.")
+	cpCmd.PersistentFlags().Uint16Var(&raw.parallelTransfers, "parallel-transfers", 0, "Limit how many of this job's files are transferred at once. "+
+		"The limit is saved with the job, so it also applies when the job is resumed. By default, the engine's own concurrency applies.")
+	cpCmd.PersistentFlags().DurationVar(&raw.maxDuration, "max-duration", 0, "Stop the job once it has run for this long (e.g. '8h'). Transfers in progress are allowed to finish, but no more are started, "+
+		"and the job ends as Cancelled. Resuming the job gives it the same duration again. By default, there is no limit.")
+	cpCmd.PersistentFlags().Int32Var(&raw.maxRetries, "max-retries", -1, "Number of times each failed transfer may be retried when the job is resumed, before it is left as failed. "+
+		"0 means failed transfers are never retried. The number is saved with the job, so it also applies when the job is resumed from another AzCopy session. "+
+		"By default (or when -1), the engine's own limit of "+fmt.Sprint(ste.TransferMaxRetries)+" applies.")
+	cpCmd.PersistentFlags().BoolVar(&raw.retryChangedFiles, "retry-changed-files", false, "Start a file again straight away if it changes while it is being uploaded, up to --max-retries times, "+
+		"instead of failing it with 'source changed during transfer' and leaving it for the job to be resumed.")
+	cpCmd.PersistentFlags().Uint32Var(&raw.transfersPerPart, "transfers-per-part", 0, transfersPerPartFlagDescription)
+	cpCmd.PersistentFlags().StringVar(&raw.transferOrder, "transfer-order", common.ETransferOrder.Plan().String(), transferOrderFlagDescription)
+	cpCmd.PersistentFlags().Uint64Var(&raw.maxTotalBytes, "max-total-bytes", 0, "Stop the job before it transfers more than this many bytes in all, e.g. to stay within the quota of a file share. "+
+		"No transfer is started that would take the job past the limit; instead the job is cancelled once the transfers in progress have finished, "+
+		"and the transfers that were left out are recorded with the status ExceededMaxTotalBytes. Data that is sent again, e.g. by a retry, counts again. "+
+		"The limit is saved with the job, and covers all its runs. By default (or when 0), there is no limit.")
+	cpCmd.PersistentFlags().StringVar(&raw.capMbpsSchedule, "cap-mbps-schedule", "", "Vary the bandwidth cap, in megabits per second, by the local time of day, e.g. '09:00-17:00=100,22:00-06:00=0'. "+
+		"Each window includes its start and excludes its end, a window that ends before it starts runs past midnight, and where windows overlap the first one listed applies. "+
+		"Outside the windows, --cap-mbps applies. 0 means no cap. The schedule is saved with the job, so it also applies when the job is resumed.")
+	cpCmd.PersistentFlags().StringVar(&raw.sasRefreshCommand, "sas-refresh-command", "", "Command line that prints a new SAS token, for jobs that may outlast their SAS tokens. "+
+		"It is run in a shell ten minutes before a token expires, with "+ste.SASRoleEnvVar+" set to 'source' or 'destination' to say which token is wanted, "+
+		"and could e.g. call an endpoint with curl. Transfers in progress switch to the new token. By default, the job stops when a token expires.")
+	cpCmd.PersistentFlags().BoolVar(&raw.listOnly, "list-only", false, "Lists the files that would be copied by this command, with their sizes and last modified times, as they are found. "+
+		"The same filters apply as to a real copy, but no job is created, so nothing is written to the job plan folder. Use it to estimate the size of a job before running it.")
+	cpCmd.PersistentFlags().BoolVar(&raw.dryrun, "dry-run", false, "Prints the files that would be copied by this command, and writes the job plan so it can be inspected with 'azcopy jobs show', but does not transfer any data. "+
+		"The summary includes an estimate of the requests the job would make, and of the bytes it would read out of the source storage (its egress).")
 	cpCmd.PersistentFlags().BoolVar(&raw.s2sPreserveProperties, "s2s-preserve-properties", true, "Preserve full properties during service to service copy. "+
 		"For AWS S3 and Azure File non-single file source, the list operation doesn't return full properties of objects and files. To preserve full properties, AzCopy needs to send one additional request per object or file.")
 	cpCmd.PersistentFlags().BoolVar(&raw.s2sPreserveAccessTier, "s2s-preserve-access-tier", true, "Preserve access tier during service to service copy. "+
 		"Please refer to [Azure Blob storage: hot, cool, and archive access tiers](https://docs.microsoft.com/azure/storage/blobs/storage-blob-storage-tiers) to ensure destination storage account supports setting access tier. "+
 		"In the cases that setting access tier is not supported, please use s2sPreserveAccessTier=false to bypass copying access tier. (default true). ")
 	cpCmd.PersistentFlags().BoolVar(&raw.s2sSourceChangeValidation, "s2s-detect-source-changed", false, "Detect if the source file/blob changes while it is being read. (This parameter only applies to service to service copies, because the corresponding check is permanently enabled for uploads and downloads.)")
+	cpCmd.PersistentFlags().BoolVar(&raw.s2sRehydrateArchivedSource, "s2s-rehydrate-archived-source", false, "Rehydrate source blobs that are in the archive tier, and wait for them to become readable, instead of failing them. "+
+		"Note that this changes the tier of the source blob to Hot, and rehydration can take many hours. (This parameter only applies to copies from Blob Storage.)")
+	cpCmd.PersistentFlags().StringVar(&raw.s2sCopyMethod, "s2s-copy-method", common.DefaultS2SCopyMethod.String(), "Specifies how the service is asked to copy blobs from Blob Storage to Blob Storage. Available options: PutFromURL, AsyncCopy. (default 'PutFromURL'). "+
+		"With PutFromURL, AzCopy copies each blob chunk by chunk and tracks the progress of every chunk. With AsyncCopy, AzCopy starts a Copy Blob operation for each blob, and waits for the service to report that it has finished, which can help for large blobs within one region. "+
+		"In neither case does the data pass through the machine running AzCopy.")
 	cpCmd.PersistentFlags().StringVar(&raw.s2sInvalidMetadataHandleOption, "s2s-handle-invalid-metadata", common.DefaultInvalidMetadataHandleOption.String(), "Specifies how invalid metadata keys are handled. Available options: ExcludeIfInvalid, FailIfInvalid, RenameIfInvalid. (default 'ExcludeIfInvalid').")
 	cpCmd.PersistentFlags().StringVar(&raw.listOfVersionIDs, "list-of-versions", "", "Specifies a file where each version id is listed on a separate line. Ensure that the source must point to a single blob and all the version ids specified in the file using this flag must belong to the source blob only. AzCopy will download the specified versions in the destination folder provided.")
+	cpCmd.PersistentFlags().BoolVar(&raw.includeSnapshots, "include-snapshots", false, "Also copy the snapshots of each source blob. "+
+		"Each snapshot is copied to its own destination, named after the blob and prefixed with the snapshot time (with ':' replaced by '-').")
+	cpCmd.PersistentFlags().BoolVar(&raw.flattenDirectories, "flatten-directories", false, "Upload the files found in subdirectories of the source under their names alone, "+
+		"rather than under their paths relative to the source, so that no virtual directories are created at the destination. (This parameter only applies to uploads to Blob Storage.)")
+	cpCmd.PersistentFlags().BoolVar(&raw.emptyFolderMarkers, "empty-folder-markers", false, "Upload each empty folder of the source as a zero-byte blob named after it, "+
+		"with the metadata "+common.FolderMarkerMetadataKey+"=true by which ADLS Gen2 and HDFS mark directories, since Blob Storage has no folders of its own. "+
+		"On download, create a folder for each such blob, instead of skipping it. (This parameter only applies to uploads to, and downloads from, Blob Storage, with --recursive.)")
+	cpCmd.PersistentFlags().StringVar(&raw.destinationCollisionOption, "destination-collision-policy", common.DefaultDestinationCollisionOption.String(), "Specifies what happens when flatten-directories, "+
+		"strip-prefix, add-prefix or list-of-destinations give two files the same destination. "+
+		"Available options: FailOnCollision, AppendSuffix, Overwrite. AppendSuffix names the second such file found name-1.ext, the third name-2.ext and so on. "+
+		"Overwrite copies only the last such file found. It fails the job if an earlier one's transfer had already been scheduled, since both would then be copied; "+
+		"a larger transfers-per-part avoids that. "+
+		"The destinations are decided as the job is planned, so resuming it gives them the same names. (default 'FailOnCollision').")
+	cpCmd.PersistentFlags().StringVar(&raw.stripPrefix, "strip-prefix", "", "Remove this leading directory path from the path of each source file, relative to the source, to give its path at the destination. "+
+		"For example, with --strip-prefix=data/2023, the source file data/2023/file.txt is copied to file.txt.")
+	cpCmd.PersistentFlags().StringVar(&raw.addPrefix, "add-prefix", "", "Put this directory path in front of the path of each source file, relative to the source (after strip-prefix is removed), to give its path at the destination. "+
+		"For example, with --strip-prefix=data/2023 --add-prefix=archive, the source file data/2023/file.txt is copied to archive/file.txt.")
+	cpCmd.PersistentFlags().StringVar(&raw.prefixMismatchOption, "strip-prefix-mismatch", common.DefaultPrefixMismatchOption.String(), "Specifies what happens to a source file whose path does not start with strip-prefix. "+
+		"Available options: Fail, Skip. (default 'Fail').")
+	cpCmd.PersistentFlags().BoolVar(&raw.createDestination, "create-destination", false, "Create the destination container, file share or ADLS Gen2 file system before transferring, if it does not exist yet. "+
+		"Without this flag, an upload to a container that does not exist fails before any file is transferred.")
+	cpCmd.PersistentFlags().StringVar(&raw.createDestinationPublicAccess, "create-destination-public-access", "None", "Specifies which contents of a container created by create-destination can be read anonymously. "+
+		"Available options: None, Blob, Container. (default 'None'). (This parameter only applies when the destination is Blob storage.)")
+	cpCmd.PersistentFlags().StringVar(&raw.ifMatch, "if-match", "", "Only write a destination blob if its ETag matches this value, or, given '*', if it already exists. "+
+		"A transfer whose destination does not match fails with the status PreconditionFailed, and the destination is left as it was. "+
+		"This is mainly useful when transferring a single blob. (This parameter only applies when the destination is Blob Storage, and overwrite is true.)")
+	cpCmd.PersistentFlags().StringVar(&raw.ifNoneMatch, "if-none-match", "", "Only write a destination blob if its ETag does not match this value, or, given '*', if it does not exist yet. "+
+		"A transfer whose destination matches fails with the status PreconditionFailed, and the destination is left as it was. "+
+		"(This parameter only applies when the destination is Blob Storage.)")
 	cpCmd.PersistentFlags().StringVar(&raw.blobTags, "blob-tags", "", "Set tags on blobs to categorize data in your storage account")
+	cpCmd.PersistentFlags().BoolVar(&raw.cpkByValue, "cpk-by-value", false, "Encrypt the uploaded blobs, or decrypt the downloaded ones, with a customer-provided key, rather than with keys managed by the service. "+
+		"The base64 encoded 256-bit key is read from the "+common.EEnvironmentVariable.CPKEncryptionKey().Name+" environment variable, and only its SHA-256 is stored in the job plan files. "+
+		"The same key must be given when the job is resumed. (This parameter only applies to uploads to and downloads from Blob Storage.)")
+	cpCmd.PersistentFlags().BoolVar(&raw.s2sPreserveBlobTags, "s2s-preserve-blob-tags", false, "Copy the index tags of each source blob to its destination. "+
+		"This requires permission to read the tags of the source blobs. (This parameter only applies to copies from Blob Storage to Blob Storage.)")
 	// s2sGetPropertiesInBackend is an optional flag for controlling whether S3 object's or Azure file's full properties are get during enumerating in frontend or
 	// right before transferring in ste(backend).
 	// The traditional behavior of all existing enumerator is to get full properties during enumerating(more specifically listing),
@@ -1698,6 +2755,7 @@ func init() {
 	// permanently hidden
 	// Hide the list-of-files flag since it is implemented only for Storage Explorer.
 	cpCmd.PersistentFlags().MarkHidden("list-of-files")
+	cpCmd.PersistentFlags().MarkHidden("list-of-destinations")
 	cpCmd.PersistentFlags().MarkHidden("s2s-get-properties-in-backend")
 
 	// temp, to assist users with change in param names, by providing a clearer message when these obsolete ones are accidentally used
@@ -1705,6 +2763,9 @@ func init() {
 	cpCmd.PersistentFlags().StringVar(&raw.legacyExclude, "exclude", "", "Legacy exclude param. DO NOT USE")
 	cpCmd.PersistentFlags().MarkHidden("include")
 	cpCmd.PersistentFlags().MarkHidden("exclude")
+	// the old name of destination-collision-policy, from when it only applied to flatten-directories
+	cpCmd.PersistentFlags().StringVar(&raw.destinationCollisionOption, "flatten-collision-policy", common.DefaultDestinationCollisionOption.String(), "Legacy name of destination-collision-policy.")
+	cpCmd.PersistentFlags().MarkHidden("flatten-collision-policy")
 
 	// Hide the flush-threshold flag since it is implemented only for CI.
 	cpCmd.PersistentFlags().Uint32Var(&ste.ADLSFlushThreshold, "flush-threshold", 7500, "Adjust the number of blocks to flush at once on accounts that have a hierarchical namespace.")
@@ -15,25 +15,23 @@ var enumerationParallelStatFiles = false
 
 // addTransfer accepts a new transfer, if the threshold is reached, dispatch a job part order.
 func addTransfer(e *common.CopyJobPartOrderRequest, transfer common.CopyTransfer, cca *cookedCopyCmdArgs) error {
-	// Remove the source and destination roots from the path to save space in the plan files
-	transfer.Source = strings.TrimPrefix(transfer.Source, e.SourceRoot.Value)
-	transfer.Destination = strings.TrimPrefix(transfer.Destination, e.DestinationRoot.Value)
+	if cca.listOnly {
+		cca.reportListOnlyTransfer(e, transfer)
+		return nil
+	}
+	transfer = prepareTransfer(e, transfer, cca)
+	if cca.dryrunMode {
+		cca.dryrunEstimate.add(cca.fromTo, cca.blobType, cca.blockSize, transfer)
+	}
 
-	// dispatch the transfers once the number reaches NumOfFilesPerDispatchJobPart
+	// dispatch the transfers once the number reaches the part size (see --transfers-per-part)
 	// we do this so that in the case of large transfer, the transfer engine can get started
 	// while the frontend is still gathering more transfers
-	if len(e.Transfers) == NumOfFilesPerDispatchJobPart {
+	if len(e.Transfers) == transfersPerPartOrDefault(cca.transfersPerPart) {
+		reportDryRunCopies(e, cca)
 		shuffleTransfers(e.Transfers)
-		resp := common.CopyJobPartOrderResponse{}
-
-		Rpc(common.ERpcCmd.CopyJobPartOrder(), (*common.CopyJobPartOrderRequest)(e), &resp)
-
-		if !resp.JobStarted {
-			return fmt.Errorf("copy job part order with JobId %s and part number %d failed because %s", e.JobID, e.PartNum, resp.ErrorMsg)
-		}
-		// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
-		if e.PartNum == 0 {
-			cca.waitUntilJobCompletion(false)
+		if err := dispatchPart(e, cca); err != nil {
+			return err
 		}
 		e.Transfers = []common.CopyTransfer{}
 		e.PartNum++
@@ -46,6 +44,52 @@ func addTransfer(e *common.CopyJobPartOrderRequest, transfer common.CopyTransfer
 	return nil
 }
 
+// dispatchPart sends a full part, that isn't the last one, to the engine
+func dispatchPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) error {
+	resp := common.CopyJobPartOrderResponse{}
+
+	Rpc(common.ERpcCmd.CopyJobPartOrder(), (*common.CopyJobPartOrderRequest)(e), &resp)
+
+	if !resp.JobStarted {
+		return fmt.Errorf("copy job part order with JobId %s and part number %d failed because %s", e.JobID, e.PartNum, resp.ErrorMsg)
+	}
+	// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
+	// a dry run has no progress to report, since its transfers are never scheduled.
+	if e.PartNum == 0 && !cca.dryrunMode {
+		cca.waitUntilJobCompletion(false)
+	}
+	return nil
+}
+
+// replaceTransfer puts a new transfer in the place of the one at index in the part being built, and returns the one it replaced
+func replaceTransfer(e *common.CopyJobPartOrderRequest, index int, transfer common.CopyTransfer, cca *cookedCopyCmdArgs) (replaced common.CopyTransfer) {
+	replaced = e.Transfers[index]
+	e.Transfers[index] = prepareTransfer(e, transfer, cca)
+	if cca.dryrunMode {
+		cca.dryrunEstimate.remove(cca.fromTo, cca.blobType, cca.blockSize, replaced)
+		cca.dryrunEstimate.add(cca.fromTo, cca.blobType, cca.blockSize, transfer)
+	}
+	return replaced
+}
+
+func prepareTransfer(e *common.CopyJobPartOrderRequest, transfer common.CopyTransfer, cca *cookedCopyCmdArgs) common.CopyTransfer {
+	// Remove the source and destination roots from the path to save space in the plan files
+	transfer.Source = strings.TrimPrefix(transfer.Source, e.SourceRoot.Value)
+	transfer.Destination = strings.TrimPrefix(transfer.Destination, e.DestinationRoot.Value)
+	return transfer
+}
+
+// reportDryRunCopies prints, in a dry run, the transfers of a part that is about to be dispatched. They are only printed then, since until
+// then a transfer can still be replaced (see replaceTransfer).
+func reportDryRunCopies(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) {
+	if !cca.dryrunMode {
+		return
+	}
+	for _, transfer := range e.Transfers {
+		glcm.Info(fmt.Sprintf("DRYRUN: copy %s -> %s (%d bytes)", e.SourceRoot.Value+transfer.Source, e.DestinationRoot.Value+transfer.Destination, transfer.SourceSize))
+	}
+}
+
 // this function shuffles the transfers before they are dispatched
 // this is done to avoid hitting the same partition continuously in an append only pattern
 // TODO this should probably be removed after the high throughput block blob feature is implemented on the service side
@@ -56,6 +100,13 @@ func shuffleTransfers(transfers []common.CopyTransfer) {
 // we need to send a last part with isFinalPart set to true, along with whatever transfers that still haven't been sent
 // dispatchFinalPart sends a last part with isFinalPart set to true, along with whatever transfers that still haven't been sent.
 func dispatchFinalPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs) error {
+	if cca.listOnly {
+		// there is no job to dispatch the part to
+		cca.reportListOnlyAndExit()
+		return nil
+	}
+
+	reportDryRunCopies(e, cca)
 	shuffleTransfers(e.Transfers)
 	e.IsFinalPart = true
 	var resp common.CopyJobPartOrderResponse
@@ -79,6 +130,10 @@ func dispatchFinalPart(e *common.CopyJobPartOrderRequest, cca *cookedCopyCmdArgs
 	// set the flag on cca, to indicate the enumeration is done
 	cca.isEnumerationComplete = true
 
+	if cca.dryrunMode {
+		cca.reportDryRunAndExit()
+	}
+
 	// if the current part order sent to engine is 0, then start fetching the Job Progress summary.
 	if e.PartNum == 0 {
 		cca.waitUntilJobCompletion(false)
@@ -21,6 +21,19 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/Azure/azure-storage-azcopy/common"
 	chk "gopkg.in/check.v1"
 )
@@ -61,3 +74,513 @@ func (s *copyEnumeratorHelperTestSuite) TestAddTransferPathRootsTrimmed(c *chk.C
 	c.Assert(request.Transfers[0].Source, chk.Equals, "c.txt")
 	c.Assert(request.Transfers[0].Destination, chk.Equals, "c.txt")
 }
+
+func (s *copyEnumeratorHelperTestSuite) TestMakeEscapedRelativePathForSnapshot(c *chk.C) {
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobLocal(), destination: newLocalRes("y/z"), stripTopDir: true}
+	object := storedObject{name: "c.txt", relativePath: "a/c.txt", blobSnapshotID: "2021-03-04T05:06:07.1234567Z"}
+
+	// the source is the blob itself; its snapshot is carried separately
+	c.Assert(cca.makeEscapedRelativePath(true, true, object), chk.Equals, "/a/c.txt")
+	// each snapshot gets a destination of its own
+	c.Assert(cca.makeEscapedRelativePath(false, true, object), chk.Equals, "/a/2021-03-04T05-06-07.1234567Z-c.txt")
+
+	object.blobSnapshotID = ""
+	c.Assert(cca.makeEscapedRelativePath(false, true, object), chk.Equals, "/a/c.txt")
+}
+
+// addCollidingTransfers resolves the destination of each of the given files, as flattening or renaming named them, and adds its transfer
+func addCollidingTransfers(c *chk.C, names *destinationNameTracker, e *common.CopyJobPartOrderRequest, files [][2]string) {
+	for _, file := range files {
+		dst, err := names.resolve(file[0], file[1])
+		c.Assert(err, chk.IsNil)
+		err = names.addTransfer(e, dst, common.CopyTransfer{Source: file[0], Destination: dst.relativePath, EntityType: common.EEntityType.File()}, &cookedCopyCmdArgs{}, nil)
+		c.Assert(err, chk.IsNil)
+	}
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerAppendSuffix(c *chk.C) {
+	var reports []string
+	names := newDestinationNameTracker(common.EDestinationCollisionOption.AppendSuffix(), func(message string) { reports = append(reports, message) })
+	e := common.CopyJobPartOrderRequest{}
+	addCollidingTransfers(c, names, &e, [][2]string{
+		{"a.txt", "a.txt"},
+		{"dir1/b.txt", "b.txt"},
+		{"dir1/dir2/a.txt", "a.txt"},
+		{"dir3/a.txt", "a.txt"},
+		{"dir3/a-1.txt", "a-1.txt"},
+		{"dir1/dir2/noext", "noext"},
+		{"dir3/noext", "noext"},
+		// renaming keeps the directories of the destination, and the suffix goes on the name alone
+		{"2023/logs/x.log", "archive/x.log"},
+		{"2024/logs/x.log", "archive/x.log"},
+	})
+
+	var destinations []string
+	for _, t := range e.Transfers {
+		destinations = append(destinations, t.Destination)
+	}
+	c.Assert(destinations, chk.DeepEquals, []string{"a.txt", "b.txt", "a-1.txt", "a-2.txt", "a-1-1.txt", "noext", "noext-1", "archive/x.log", "archive/x-1.log"})
+	c.Assert(reports, chk.HasLen, 5)
+	c.Assert(reports[0], chk.Equals, "'dir1/dir2/a.txt' is copied to 'a-1.txt', since 'a.txt' is already copied to 'a.txt'")
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerOverwrite(c *chk.C) {
+	var reports []string
+	names := newDestinationNameTracker(common.EDestinationCollisionOption.Overwrite(), func(message string) { reports = append(reports, message) })
+	e := common.CopyJobPartOrderRequest{}
+	addCollidingTransfers(c, names, &e, [][2]string{
+		{"dir1/a.txt", "a.txt"},
+		{"dir1/b.txt", "b.txt"},
+		{"dir2/a.txt", "a.txt"},
+		{"dir3/a.txt", "a.txt"},
+	})
+
+	// the last file found replaces the transfers of the others, while they are in the part being built
+	c.Assert(e.Transfers, chk.HasLen, 2)
+	c.Assert(e.Transfers[0].Source, chk.Equals, "dir3/a.txt")
+	c.Assert(e.Transfers[0].Destination, chk.Equals, "a.txt")
+	c.Assert(e.Transfers[1].Source, chk.Equals, "dir1/b.txt")
+	c.Assert(reports, chk.DeepEquals, []string{
+		"only 'dir2/a.txt' is copied to 'a.txt', in place of 'dir1/a.txt'",
+		"only 'dir3/a.txt' is copied to 'a.txt', in place of 'dir2/a.txt'",
+	})
+
+	// once the part has been dispatched, its transfers stay, so the later file can't be copied in place of the earlier one
+	e.Transfers = nil
+	e.PartNum++
+	reports = nil
+	dst, err := names.resolve("dir4/b.txt", "b.txt")
+	c.Assert(err, chk.IsNil)
+	err = names.addTransfer(&e, dst, common.CopyTransfer{Source: "dir4/b.txt", Destination: "b.txt", EntityType: common.EEntityType.File()}, &cookedCopyCmdArgs{}, nil)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "since the transfer of 'dir1/b.txt' has already been scheduled"), chk.Equals, true)
+	c.Assert(e.Transfers, chk.HasLen, 0)
+	c.Assert(reports, chk.HasLen, 0)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerOverwriteDryRun(c *chk.C) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	names := newDestinationNameTracker(common.EDestinationCollisionOption.Overwrite(), func(string) {})
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.LocalBlob(), dryrunMode: true}
+	e := common.CopyJobPartOrderRequest{SourceRoot: newLocalRes("/src/"), DestinationRoot: newLocalRes("/dst/")}
+	for _, src := range []string{"dir1/a.txt", "dir2/a.txt"} {
+		dst, err := names.resolve(src, "a.txt")
+		c.Assert(err, chk.IsNil)
+		err = names.addTransfer(&e, dst, common.CopyTransfer{Source: "/src/" + src, Destination: "/dst/a.txt", EntityType: common.EEntityType.File(), SourceSize: 3}, cca, nil)
+		c.Assert(err, chk.IsNil)
+	}
+
+	// only the file that is copied in the end is printed, and only once
+	reportDryRunCopies(&e, cca)
+	close(mockedLcm.infoLog)
+	var printed []string
+	for msg := range mockedLcm.infoLog {
+		printed = append(printed, msg)
+	}
+	c.Assert(printed, chk.DeepEquals, []string{"DRYRUN: copy /src/dir2/a.txt -> /dst/a.txt (3 bytes)"})
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerListOfFiles(c *chk.C) {
+	names := newDestinationNameTracker(common.DefaultDestinationCollisionOption, func(string) { c.Fail() })
+	e := common.CopyJobPartOrderRequest{}
+
+	// an entry that names its destination can collide with one that doesn't
+	addCollidingTransfers(c, names, &e, [][2]string{{"a.txt", "a.txt"}})
+	_, err := names.resolve("dir/b.txt", "a.txt")
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "'a.txt' is already copied there"), chk.Equals, true)
+
+	// while a file that is named twice is copied once
+	dst, err := names.resolve("a.txt", "a.txt")
+	c.Assert(err, chk.IsNil)
+	c.Assert(dst, chk.IsNil)
+	c.Assert(e.Transfers, chk.HasLen, 1)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerFailOnCollision(c *chk.C) {
+	names := newDestinationNameTracker(common.EDestinationCollisionOption.FailOnCollision(), func(string) { c.Fail() })
+	e := common.CopyJobPartOrderRequest{}
+	addCollidingTransfers(c, names, &e, [][2]string{{"dir1/dir2/a.txt", "a.txt"}, {"dir1/b.txt", "b.txt"}})
+	c.Assert(e.Transfers, chk.HasLen, 2)
+
+	_, err := names.resolve("dir3/a.txt", "a.txt")
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "'dir1/dir2/a.txt' is already copied there"), chk.Equals, true)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationNameTrackerOverwriteCounts(c *chk.C) {
+	names := newDestinationNameTracker(common.EDestinationCollisionOption.Overwrite(), func(string) {})
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobBlob(), blobType: common.EBlobType.BlockBlob(), blockSize: 8 * 1024 * 1024, dryrunMode: true}
+	quota := newShareQuotaTracker("share", 1, 0, func(string) { c.Fail() })
+	e := common.CopyJobPartOrderRequest{}
+	for _, file := range []struct {
+		src  string
+		size int64
+	}{{"dir1/a.txt", 600 * 1024 * 1024}, {"dir2/a.txt", 700 * 1024 * 1024}} {
+		dst, err := names.resolve(file.src, "a.txt")
+		c.Assert(err, chk.IsNil)
+		// both files together would not fit in the share, but only the second is copied, so there's no warning
+		err = names.addTransfer(&e, dst, common.CopyTransfer{Source: file.src, Destination: "a.txt", EntityType: common.EEntityType.File(), SourceSize: file.size}, cca, quota)
+		c.Assert(err, chk.IsNil)
+	}
+	c.Assert(e.Transfers, chk.HasLen, 1)
+	c.Assert(quota.totalBytes, chk.Equals, int64(700*1024*1024))
+
+	// the estimate is that of the transfer that is left
+	var expected dryRunCostEstimate
+	expected.add(cca.fromTo, cca.blobType, cca.blockSize, e.Transfers[0])
+	c.Assert(cca.dryrunEstimate, chk.Equals, expected)
+	c.Assert(cca.dryrunEstimate.EstimatedEgressBytes, chk.Equals, uint64(700*1024*1024))
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestEmptyFolderMarkersRoundTrip(c *chk.C) {
+	srcDir := c.MkDir()
+	for _, dir := range []string{"a/b/c", "a/d", "e", "f/g"} {
+		c.Assert(os.MkdirAll(filepath.Join(srcDir, filepath.FromSlash(dir)), os.ModePerm), chk.IsNil)
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(srcDir, "e", "file.txt"), []byte("data"), 0666), chk.IsNil)
+	fpo := common.EFolderPropertiesOption.AllFoldersExceptRoot()
+
+	// on upload, only the empty folders become transfers, of no size
+	upload := &cookedCopyCmdArgs{fromTo: common.EFromTo.LocalBlob(), source: newLocalRes(srcDir), emptyFolderMarkers: true}
+	var markers []string
+	err := newLocalTraverser(srcDir, true, false, nil).traverse(noPreProccessor, func(object storedObject) error {
+		object, ok := upload.toFolderMarker(object)
+		if !ok || object.entityType != common.EEntityType.Folder() {
+			return nil
+		}
+		if transfer, shouldSend := object.ToNewCopyTransfer(false, object.relativePath, object.relativePath, false, fpo); shouldSend {
+			c.Assert(transfer.SourceSize, chk.Equals, int64(0))
+			markers = append(markers, filepath.ToSlash(object.relativePath))
+		}
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	sort.Strings(markers)
+	c.Assert(markers, chk.DeepEquals, []string{"a/b/c", "a/d", "f/g"})
+
+	// on download, the blobs that the markers were uploaded as become folders again, while other blobs stay files
+	download := &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobLocal(), emptyFolderMarkers: true}
+	markerMetadata := common.Metadata{common.FolderMarkerMetadataKey: "true"}
+	for _, marker := range markers {
+		object, ok := download.toFolderMarker(storedObject{name: path.Base(marker), relativePath: marker, entityType: common.EEntityType.File(), Metadata: markerMetadata})
+		c.Assert(ok, chk.Equals, true)
+		c.Assert(object.entityType, chk.Equals, common.EEntityType.Folder())
+		_, shouldSend := object.ToNewCopyTransfer(false, marker, marker, false, fpo)
+		c.Assert(shouldSend, chk.Equals, true)
+	}
+	object, ok := download.toFolderMarker(storedObject{name: "file.txt", relativePath: "e/file.txt", entityType: common.EEntityType.File(), size: 4})
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(object.entityType, chk.Equals, common.EEntityType.File())
+	c.Assert(object.size, chk.Equals, int64(4))
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestMakeEscapedRelativePathForFlattenedFile(c *chk.C) {
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.LocalBlob(), source: newLocalRes("/data/src"), destination: newRemoteRes("https://fake.blob.core.windows.net/container"),
+		flattenDirectories: true}
+	object := storedObject{name: "c d.txt", relativePath: "a/b/c d.txt", entityType: common.EEntityType.File()}
+
+	flattened := object
+	flattened.relativePath = flattenedName(object.relativePath)
+
+	// the source keeps its path, while the destination is named after the file alone, under the source directory's name
+	c.Assert(cca.makeEscapedRelativePath(true, true, object), chk.Equals, "/a/b/c d.txt")
+	c.Assert(cca.makeEscapedRelativePath(false, true, flattened), chk.Equals, "/src/c%20d.txt")
+
+	cca.stripTopDir = true
+	c.Assert(cca.makeEscapedRelativePath(false, true, flattened), chk.Equals, "/c%20d.txt")
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestAddTransferListOnly(c *chk.C) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10), exitLog: make(chan string, 1)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	request := common.CopyJobPartOrderRequest{
+		SourceRoot:      newRemoteRes("https://fake.blob.core.windows.net/container/dir"),
+		DestinationRoot: newLocalRes("/y/z"),
+	}
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobLocal(), listOnly: true}
+	lmt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, transfer := range []common.CopyTransfer{
+		{Source: "/a/b%20c.txt", SourceSize: 10, LastModifiedTime: lmt, EntityType: common.EEntityType.File()},
+		{Source: "/a", EntityType: common.EEntityType.Folder()},
+		{Source: "/d.txt", SourceSize: 5, LastModifiedTime: lmt, EntityType: common.EEntityType.File()},
+	} {
+		c.Assert(addTransfer(&request, transfer, cca), chk.IsNil)
+	}
+
+	// nothing is added to the job part, since there is no job
+	c.Assert(request.Transfers, chk.HasLen, 0)
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "a/b c.txt; Content Length: 10; Last Modified: 2021-03-04T05:06:07Z")
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "a/; Content Length: 0; Last Modified: 0001-01-01T00:00:00Z")
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "d.txt; Content Length: 5; Last Modified: 2021-03-04T05:06:07Z")
+
+	cca.reportListOnlyAndExit()
+	c.Assert(<-mockedLcm.exitLog, chk.Equals, "LISTONLY: found 2 files totalling 15 bytes. No job was created.")
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestListOnlyTransferPathOfSingleFile(c *chk.C) {
+	singleFile := common.CopyTransfer{Source: ""}
+
+	c.Assert(listOnlyTransferPath("https://fake.blob.core.windows.net/container/dir/b%20c.txt", singleFile, common.ELocation.Blob()), chk.Equals, "b c.txt")
+	c.Assert(listOnlyTransferPath(filepath.Join("data", "b c.txt"), singleFile, common.ELocation.Local()), chk.Equals, "b c.txt")
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDestinationPrefixRenamer(c *chk.C) {
+	c.Assert(newDestinationPrefixRenamer("", "", common.DefaultPrefixMismatchOption), chk.IsNil)
+	c.Assert(normalizeDestinationPrefix(`\data\2023\`), chk.Equals, "data/2023")
+
+	file := common.EEntityType.File()
+	folder := common.EEntityType.Folder()
+	for _, testCase := range []struct {
+		stripPrefix, addPrefix string
+		relativePath           string
+		entityType             common.EntityType
+		expected               string
+		expectedOk             bool
+	}{
+		// add only
+		{"", "archive", "data/2023/file.txt", file, "archive/data/2023/file.txt", true},
+		{"", "archive/old", "file.txt", file, "archive/old/file.txt", true},
+		{"", "archive", "", folder, "archive", true},
+		// strip only
+		{"data/2023", "", "data/2023/file.txt", file, "file.txt", true},
+		{"data/2023", "", "data/2023/sub/file.txt", file, "sub/file.txt", true},
+		{"data/2023", "", "data/2023/sub", folder, "sub", true},
+		{"data", "", "database/file.txt", file, "", false}, // only whole directories are stripped
+		// the folders the prefix is made of are not transferred, but are not mismatches either
+		{"data/2023", "", "", folder, "", false},
+		{"data/2023", "", "data", folder, "", false},
+		{"data/2023", "", "data/2023", folder, "", false},
+		// combined
+		{"data/2023", "archive", "data/2023/file.txt", file, "archive/file.txt", true},
+		{"data/2023", "archive", "data/2023/sub/file.txt", file, "archive/sub/file.txt", true},
+	} {
+		renamer := newDestinationPrefixRenamer(testCase.stripPrefix, testCase.addPrefix, common.EPrefixMismatchOption.Skip())
+		renamed, ok, err := renamer.rename(testCase.relativePath, testCase.entityType)
+		c.Assert(err, chk.IsNil)
+		c.Assert(ok, chk.Equals, testCase.expectedOk, chk.Commentf(testCase.relativePath))
+		c.Assert(renamed, chk.Equals, testCase.expected, chk.Commentf(testCase.relativePath))
+	}
+
+	// by default, a file that doesn't start with the prefix fails the job
+	renamer := newDestinationPrefixRenamer("data/2023", "archive", common.DefaultPrefixMismatchOption)
+	_, _, err := renamer.rename("data/2022/file.txt", file)
+	c.Assert(err, chk.NotNil)
+	_, ok, err := renamer.rename("data", folder)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ok, chk.Equals, false)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestMakeEscapedRelativePathForRenamedFile(c *chk.C) {
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.LocalBlob(), source: newLocalRes("/src"), destination: newRemoteRes("https://fake.blob.core.windows.net/container"),
+		stripTopDir: true}
+	object := storedObject{name: "file.txt", relativePath: "data/2023/file.txt", entityType: common.EEntityType.File()}
+
+	renamed := object
+	renamedPath, ok, err := newDestinationPrefixRenamer("data/2023", "archive", common.DefaultPrefixMismatchOption).rename(object.relativePath, object.entityType)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ok, chk.Equals, true)
+	renamed.relativePath = renamedPath
+
+	// the source keeps its path, while the destination moves to under the new prefix
+	c.Assert(cca.makeEscapedRelativePath(true, true, object), chk.Equals, "/data/2023/file.txt")
+	c.Assert(cca.makeEscapedRelativePath(false, true, renamed), chk.Equals, "/archive/file.txt")
+}
+
+// newFakeContainerService serves the container operations of a blob service, in which only the containers in existing exist,
+// and into which a create fails with 409 as if another client had just created the container
+func newFakeContainerService(c *chk.C, existing map[string]bool, raceOnCreate bool) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		c.Check(r.URL.Query().Get("restype"), chk.Equals, "container")
+		name := r.URL.Path[len("/account/"):]
+		switch {
+		case r.Method == http.MethodGet && existing[name]:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet:
+			w.Header().Set("x-ms-error-code", "ContainerNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut && raceOnCreate:
+			existing[name] = true
+			w.Header().Set("x-ms-error-code", "ContainerAlreadyExists")
+			w.WriteHeader(http.StatusConflict)
+		case r.Method == http.MethodPut:
+			c.Check(r.Header.Get("x-ms-blob-public-access"), chk.Equals, "blob")
+			existing[name] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	return server, &requests
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestCreateDstContainer(c *chk.C) {
+	ctx := context.Background()
+	for _, raceOnCreate := range []bool{false, true} {
+		server, requests := newFakeContainerService(c, map[string]bool{"existing": true}, raceOnCreate)
+		cca := &cookedCopyCmdArgs{
+			fromTo:                        common.EFromTo.LocalBlob(),
+			destination:                   common.ResourceString{Value: server.URL + "/account/missing", SAS: "sig=fake"},
+			createDestinationPublicAccess: common.EPublicAccessLevel.Blob(),
+		}
+
+		// a container that exists already is left alone
+		c.Assert(cca.dstContainerNotFound("existing", ctx), chk.Equals, false)
+		c.Assert(cca.createDstContainer("existing", cca.destination, ctx, map[string]bool{}), chk.IsNil)
+		c.Assert(*requests, chk.DeepEquals, []string{"GET /account/existing", "GET /account/existing"})
+
+		// a missing one is created, and losing the race to create it is fine too
+		*requests = nil
+		c.Assert(cca.dstContainerNotFound("missing", ctx), chk.Equals, true)
+		c.Assert(cca.createDstContainer("missing", cca.destination, ctx, map[string]bool{}), chk.IsNil)
+		c.Assert(*requests, chk.DeepEquals, []string{"GET /account/missing", "GET /account/missing", "PUT /account/missing"})
+		c.Assert(cca.dstContainerNotFound("missing", ctx), chk.Equals, false)
+		server.Close()
+	}
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDstContainerNotFoundOnOtherErrors(c *chk.C) {
+	// not being allowed to look doesn't mean the container is missing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	cca := &cookedCopyCmdArgs{
+		fromTo:      common.EFromTo.LocalBlob(),
+		destination: common.ResourceString{Value: server.URL + "/account/container", SAS: "sig=fake"},
+	}
+	c.Assert(cca.dstContainerNotFound("container", context.Background()), chk.Equals, false)
+}
+
+// dispatchedPart is what a job part order looked like when it was sent to the engine
+type dispatchedPart struct {
+	partNum      common.PartNumber
+	isFinalPart  bool
+	numTransfers int
+}
+
+// recordDispatchedParts replaces Rpc with one that records each job part order, until the returned func is called
+func recordDispatchedParts() (parts *[]dispatchedPart, restore func()) {
+	parts = &[]dispatchedPart{}
+	originalRpc := Rpc
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		order := request.(*common.CopyJobPartOrderRequest)
+		*parts = append(*parts, dispatchedPart{order.PartNum, order.IsFinalPart, len(order.Transfers)})
+		*(response.(*common.CopyJobPartOrderResponse)) = common.CopyJobPartOrderResponse{JobStarted: true}
+	}
+	return parts, func() { Rpc = originalRpc }
+}
+
+// checkDispatchedParts asserts that numTransfers transfers were split into parts of transfersPerPart, the last one being final
+func checkDispatchedParts(c *chk.C, parts []dispatchedPart, numTransfers, transfersPerPart int) {
+	expectedParts := (numTransfers + transfersPerPart - 1) / transfersPerPart
+	c.Assert(parts, chk.HasLen, expectedParts)
+	for i, part := range parts {
+		c.Assert(part.partNum, chk.Equals, common.PartNumber(i))
+		c.Assert(part.isFinalPart, chk.Equals, i == expectedParts-1)
+		if i < expectedParts-1 {
+			c.Assert(part.numTransfers, chk.Equals, transfersPerPart)
+		} else {
+			c.Assert(part.numTransfers, chk.Equals, numTransfers-transfersPerPart*(expectedParts-1))
+		}
+	}
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestAddTransferSplitsJobIntoParts(c *chk.C) {
+	originalLcm := glcm
+	glcm = &mockedLifecycleManager{}
+	defer func() { glcm = originalLcm }()
+
+	for _, numTransfers := range []int{1, 99, 100, 101, 250} {
+		parts, restore := recordDispatchedParts()
+		request := common.CopyJobPartOrderRequest{SourceRoot: newLocalRes("a/"), DestinationRoot: newLocalRes("z/")}
+		cca := &cookedCopyCmdArgs{transfersPerPart: minTransfersPerPart}
+
+		for i := 0; i < numTransfers; i++ {
+			name := fmt.Sprintf("%d.txt", i)
+			c.Assert(addTransfer(&request, common.CopyTransfer{Source: "a/" + name, Destination: "z/" + name}, cca), chk.IsNil)
+		}
+		c.Assert(dispatchFinalPart(&request, cca), chk.IsNil)
+		restore()
+
+		checkDispatchedParts(c, *parts, numTransfers, minTransfersPerPart)
+	}
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestTransferProcessorSplitsJobIntoParts(c *chk.C) {
+	const numTransfers, transfersPerPart = 1001, 200
+	parts, restore := recordDispatchedParts()
+	defer restore()
+
+	processor := newCopyTransferProcessor(&common.CopyJobPartOrderRequest{FromTo: common.EFromTo.LocalBlob()}, transfersPerPart,
+		newLocalRes("a"), newRemoteRes("https://fake.blob.core.windows.net/container"), nil, nil, false)
+	for i := 0; i < numTransfers; i++ {
+		name := fmt.Sprintf("%d.txt", i)
+		c.Assert(processor.scheduleCopyTransfer(storedObject{name: name, relativePath: name, entityType: common.EEntityType.File()}), chk.IsNil)
+	}
+	_, err := processor.dispatchFinalPart()
+	c.Assert(err, chk.IsNil)
+
+	checkDispatchedParts(c, *parts, numTransfers, transfersPerPart)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestTransfersPerPartBounds(c *chk.C) {
+	c.Assert(transfersPerPartOrDefault(0), chk.Equals, NumOfFilesPerDispatchJobPart)
+	c.Assert(transfersPerPartOrDefault(500), chk.Equals, 500)
+
+	c.Assert(validateTransfersPerPart(0), chk.IsNil)
+	c.Assert(validateTransfersPerPart(minTransfersPerPart), chk.IsNil)
+	c.Assert(validateTransfersPerPart(maxTransfersPerPart), chk.IsNil)
+	c.Assert(validateTransfersPerPart(minTransfersPerPart-1), chk.ErrorMatches, "invalid transfers-per-part 99, it must be between 100 and 1000000")
+	c.Assert(validateTransfersPerPart(maxTransfersPerPart+1), chk.NotNil)
+}
+
+func (s *copyEnumeratorHelperTestSuite) TestDryRunCostEstimate(c *chk.C) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10), exitLog: make(chan string, 1)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	const mib = 1024 * 1024
+	request := common.CopyJobPartOrderRequest{
+		SourceRoot:      newRemoteRes("https://fake.blob.core.windows.net/container"),
+		DestinationRoot: newLocalRes("/y"),
+	}
+	cca := &cookedCopyCmdArgs{fromTo: common.EFromTo.BlobLocal(), blobType: common.EBlobType.Detect(), blockSize: 4 * mib, dryrunMode: true}
+	for _, transfer := range []common.CopyTransfer{
+		{Source: "/a.txt", Destination: "/a.txt", SourceSize: 10 * mib, EntityType: common.EEntityType.File()},
+		{Source: "/empty.txt", Destination: "/empty.txt", EntityType: common.EEntityType.File()},
+		{Source: "/dir", Destination: "/dir", EntityType: common.EEntityType.Folder()},
+	} {
+		c.Assert(addTransfer(&request, transfer, cca), chk.IsNil)
+	}
+
+	// downloading reads 3 blocks of the first file, and the (empty) second one; folders cost nothing
+	c.Assert(cca.dryrunEstimate, chk.Equals, dryRunCostEstimate{EstimatedRequests: 4, EstimatedEgressBytes: 10 * mib})
+
+	// nothing leaves the source storage when uploading
+	upload := dryRunCostEstimate{}
+	upload.add(common.EFromTo.LocalBlob(), common.EBlobType.BlockBlob(), 4*mib, common.CopyTransfer{SourceSize: 10 * mib})
+	c.Assert(upload, chk.Equals, dryRunCostEstimate{EstimatedRequests: 4})
+
+	originalRpc := Rpc
+	Rpc = func(cmd common.RpcCmd, request interface{}, response interface{}) {
+		*(response.(*common.ListJobSummaryResponse)) = common.ListJobSummaryResponse{JobID: cca.jobID, TotalTransfers: 3, TotalBytesExpected: 10 * mib}
+	}
+	defer func() { Rpc = originalRpc }()
+	cca.reportDryRunAndExit()
+	c.Assert(<-mockedLcm.exitLog, chk.Matches, "DRYRUN: .* planned 3 transfers totalling 10485760 bytes\\. No data was transferred\\. "+
+		"Running the job would take about 4 requests, and read 10485760 bytes out of the source storage \\(its egress\\)\\. .*")
+}
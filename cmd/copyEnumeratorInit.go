@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -17,6 +21,7 @@ import (
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/azure-storage-file-go/azfile"
 
+	"github.com/Azure/azure-storage-azcopy/azbfs"
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/Azure/azure-storage-azcopy/ste"
 )
@@ -40,6 +45,9 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 
 	jobPartOrder.PreserveSMBPermissions = cca.preserveSMBPermissions
 	jobPartOrder.PreserveSMBInfo = cca.preserveSMBInfo
+	jobPartOrder.PreservePOSIXProperties = cca.preservePOSIXProperties
+	jobPartOrder.PreserveACLs = cca.preserveACLs
+	jobPartOrder.PreserveImmutability = cca.preserveImmutability
 
 	// Infer on download so that we get LMT and MD5 on files download
 	// On S2S transfers the following rules apply:
@@ -47,14 +55,19 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	// If source change validation is enabled on files to remote, turn it on (consider a separate flag entirely?)
 	getRemoteProperties := cca.forceWrite == common.EOverwriteOption.IfSourceNewer() ||
 		(cca.fromTo.From() == common.ELocation.File() && !cca.fromTo.To().IsRemote()) || // If download, we still need LMT and MD5 from files.
-		(cca.fromTo.From() == common.ELocation.File() && cca.fromTo.To().IsRemote() && (cca.s2sSourceChangeValidation || cca.includeAfter != nil)) || // If S2S from File to *, and sourceChangeValidation is enabled, we get properties so that we have LMTs. Likewise if we are using includeAfter, which requires LMTs.
+		(cca.fromTo.From() == common.ELocation.File() && cca.fromTo.To().IsRemote() && (cca.s2sSourceChangeValidation || cca.includeAfter != nil || cca.includeBefore != nil)) || // If S2S from File to *, and sourceChangeValidation is enabled, we get properties so that we have LMTs. Likewise if we are using includeAfter or includeBefore, which require LMTs.
 		(cca.fromTo.From().IsRemote() && cca.fromTo.To().IsRemote() && cca.s2sPreserveProperties && !cca.s2sGetPropertiesInBackend) // If S2S and preserve properties AND get properties in backend is on, turn this off, as properties will be obtained in the backend.
 	jobPartOrder.S2SGetPropertiesInBackend = cca.s2sPreserveProperties && !getRemoteProperties && cca.s2sGetPropertiesInBackend // Infer GetProperties if GetPropertiesInBackend is enabled.
 	jobPartOrder.S2SSourceChangeValidation = cca.s2sSourceChangeValidation
+	jobPartOrder.S2SRehydrateArchivedSource = cca.s2sRehydrateArchivedSource
+	jobPartOrder.S2SCopyMethod = cca.s2sCopyMethod
 	jobPartOrder.DestLengthValidation = cca.CheckLength
 	jobPartOrder.S2SInvalidMetadataHandleOption = cca.s2sInvalidMetadataHandleOption
+	jobPartOrder.DryRun = cca.dryrunMode
+	jobPartOrder.DestinationCollisionOption = cca.destinationCollisionOption
 
-	traverser, err = initResourceTraverser(cca.source, cca.fromTo.From(), &ctx, &srcCredInfo, &cca.followSymlinks, cca.listOfFilesChannel, cca.recursive, getRemoteProperties, cca.includeDirectoryStubs, func(common.EntityType) {}, cca.listOfVersionIDs)
+	traverser, err = initResourceTraverser(cca.source, cca.fromTo.From(), &ctx, &srcCredInfo, &cca.followSymlinks, cca.listOfFilesChannel, cca.recursive, getRemoteProperties, cca.includeDirectoryStubs, func(common.EntityType) {}, cca.listOfVersionIDs,
+		blobTraverserOptions{includeSnapshots: cca.includeSnapshots, s2sPreserveSourceTags: cca.s2sPreserveBlobTags, s2sPreserveImmutability: cca.preserveImmutability})
 
 	if err != nil {
 		return nil, err
@@ -71,6 +84,18 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	if cca.listOfVersionIDs != nil && (!(cca.fromTo == common.EFromTo.BlobLocal() || cca.fromTo == common.EFromTo.BlobTrash()) || isSourceDir || !isDestDir) {
 		log.Fatalf("Either source is not a blob or destination is not a local folder")
 	}
+	// a version of a blob is copied by giving its versionId in the source URL, which then travels with the source's extra query
+	if cca.fromTo.From() == common.ELocation.Blob() && versionIDFromQuery(cca.source.ExtraQuery) != "" {
+		if isSourceDir {
+			return nil, errors.New("a versionId can only be given in the source URL when the source is a single blob")
+		}
+		if cca.listOfVersionIDs != nil || cca.includeSnapshots {
+			return nil, errors.New("a versionId in the source URL cannot be used together with list-of-versions or include-snapshots")
+		}
+	}
+	if cca.includeSnapshots && !isSourceDir && !isDestDir {
+		return nil, errors.New("the destination must be a directory when including the snapshots of a single blob, since each snapshot is copied to a name of its own")
+	}
 	srcLevel, err := determineLocationLevel(cca.source.Value, cca.fromTo.From(), true)
 
 	if err != nil {
@@ -93,6 +118,10 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		return nil, errors.New("cannot combine list-of-files or include-path with account traversal")
 	}
 
+	if cca.includeSnapshots && srcLevel == ELocationLevel.Service() {
+		return nil, errors.New("snapshots can only be included when the source is a container, directory or blob, not an account")
+	}
+
 	if (srcLevel == ELocationLevel.Object() || cca.fromTo.From().IsLocal()) && dstLevel == ELocationLevel.Service() {
 		return nil, errors.New("cannot transfer individual files/folders to the root of a service. Add a container or directory to the destination URL")
 	}
@@ -118,6 +147,16 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 			return nil, err
 		}
 
+		if cca.createDestination && dstContainerName != "" {
+			// the user asked for the container, so unlike the best-effort creation below, failing to create it fails the job
+			if err = cca.createDstContainer(dstContainerName, cca.destination, ctx, existingContainers); err != nil {
+				return nil, fmt.Errorf("failed to create the destination container %s: %s", dstContainerName, err)
+			}
+		} else if !cca.fromTo.From().IsRemote() && dstContainerName != "" && !cca.listOnly && cca.dstContainerNotFound(dstContainerName, ctx) {
+			// otherwise every single upload would fail, each with a less helpful message
+			return nil, fmt.Errorf("the destination container %s does not exist. Create it first, or use --create-destination", dstContainerName)
+		}
+
 		// only create the destination container in S2S scenarios
 		if cca.fromTo.From().IsRemote() && dstContainerName != "" { // if the destination has a explicit container name
 			// Attempt to create the container. If we fail, fail silently.
@@ -194,12 +233,46 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	// decide our folder transfer strategy
 	var message string
 	jobPartOrder.Fpo, message = newFolderPropertyOption(cca.fromTo, cca.recursive, cca.stripTopDir, filters, cca.preserveSMBInfo, cca.preserveSMBPermissions.IsTruthy())
+	if cca.emptyFolderMarkers {
+		// the folders below the source are processed as markers; the source itself needs none
+		jobPartOrder.Fpo = common.EFolderPropertiesOption.AllFoldersExceptRoot()
+		message = common.IffString(cca.fromTo.IsUpload(),
+			"Any empty folders will be processed, as zero-byte marker blobs, because --empty-folder-markers was specified",
+			"Any folder marker blobs will be processed as folders, because --empty-folder-markers was specified")
+	}
 	glcm.Info(message)
 	if ste.JobsAdmin != nil {
 		ste.JobsAdmin.LogToJobLog(message, pipeline.LogInfo)
 	}
 
+	prefixRenamer := newDestinationPrefixRenamer(cca.stripPrefix, cca.addPrefix, cca.prefixMismatchOption)
+	// files can only be given the same destination when they are flattened or renamed. A list of files (or include-path) renames
+	// only the entries that name their destination, but those can take the destination of any other entry, so all of them are tracked.
+	var destinationNames *destinationNameTracker
+	if cca.flattenDirectories || prefixRenamer != nil || cca.listOfFilesChannel != nil {
+		destinationNames = newDestinationNameTracker(cca.destinationCollisionOption, func(message string) {
+			if cca.dryrunMode {
+				glcm.Info("DRYRUN: destination collision: " + message)
+			}
+			if ste.JobsAdmin != nil {
+				ste.JobsAdmin.LogToJobLog("destination collision: "+message, pipeline.LogWarning)
+			}
+		})
+	}
+
+	var shareQuota *shareQuotaTracker
+	if cca.fromTo.To() == common.ELocation.File() && dstContainerName != "" && !cca.dryrunMode && !cca.listOnly {
+		shareQuota = cca.newDstShareQuotaTracker(ctx, dstContainerName)
+	}
+
 	processor := func(object storedObject) error {
+		if cca.emptyFolderMarkers {
+			var ok bool
+			if object, ok = cca.toFolderMarker(object); !ok {
+				return nil
+			}
+		}
+
 		// Start by resolving the name and creating the container
 		if object.containerName != "" {
 			// set up the destination container name.
@@ -231,7 +304,43 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		}
 
 		srcRelPath := cca.makeEscapedRelativePath(true, isDestDir, object)
-		dstRelPath := cca.makeEscapedRelativePath(false, isDestDir, object)
+
+		// the destination of a flattened file is named after the file alone
+		dstObject := object
+		if object.dstRelativePath != "" {
+			// the list of files named the destination itself
+			dstObject.relativePath = object.dstRelativePath
+		} else if cca.flattenDirectories && object.entityType == common.EEntityType.File() && !object.isSingleSourceFile() {
+			dstObject.relativePath = flattenedName(object.relativePath)
+		}
+		if prefixRenamer != nil && !object.isSingleSourceFile() && object.dstRelativePath == "" {
+			renamedPath, ok, err := prefixRenamer.rename(object.relativePath, object.entityType)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				if ste.JobsAdmin != nil {
+					ste.JobsAdmin.LogToJobLog(fmt.Sprintf("skipping %s, since it has no destination once the prefix %s is stripped", object.relativePath, cca.stripPrefix), pipeline.LogInfo)
+				}
+				return nil
+			}
+			dstObject.relativePath = renamedPath
+		}
+		var dst *trackedDestination
+		if destinationNames != nil && object.entityType == common.EEntityType.File() {
+			if dst, err = destinationNames.resolve(object.relativePath, dstObject.relativePath); err != nil {
+				return err
+			}
+			if dst == nil {
+				return nil // e.g. the list of files names it twice
+			}
+			dstObject.relativePath = dst.relativePath
+		}
+		dstRelPath := cca.makeEscapedRelativePath(false, isDestDir, dstObject)
+		if (prefixRenamer != nil || object.dstRelativePath != "") && len(dstRelPath) > math.MaxInt16 {
+			// the plan can't record a longer destination; see JobPartPlanTransfer.DstLength
+			return fmt.Errorf("the destination path of %s is longer than the %d characters AzCopy supports, once it is renamed", object.relativePath, math.MaxInt16)
+		}
 
 		transfer, shouldSendToSte := object.ToNewCopyTransfer(
 			cca.autoDecompress && cca.fromTo.IsDownload(),
@@ -240,8 +349,20 @@ func (cca *cookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 			jobPartOrder.Fpo,
 		)
 		transfer.BlobTags = cca.blobTags
+		if cca.s2sPreserveBlobTags {
+			transfer.BlobTags = object.blobTags
+		}
+		transfer.BlobImmutability = object.blobImmutability
+		transfer.DestIfMatch = cca.ifMatch
+		transfer.DestIfNoneMatch = cca.ifNoneMatch
 
 		if shouldSendToSte {
+			if dst != nil {
+				return destinationNames.addTransfer(&jobPartOrder, dst, transfer, cca, shareQuota)
+			}
+			if transfer.EntityType == common.EEntityType.File() {
+				shareQuota.add(transfer.SourceSize)
+			}
 			return addTransfer(&jobPartOrder, transfer, cca)
 		} else {
 			return nil
@@ -268,7 +389,7 @@ func (cca *cookedCopyCmdArgs) isDestDirectory(dst common.ResourceString, ctx *co
 		return false
 	}
 
-	rt, err := initResourceTraverser(dst, cca.fromTo.To(), ctx, &dstCredInfo, nil, nil, false, false, false, func(common.EntityType) {}, cca.listOfVersionIDs)
+	rt, err := initResourceTraverser(dst, cca.fromTo.To(), ctx, &dstCredInfo, nil, nil, false, false, false, func(common.EntityType) {}, cca.listOfVersionIDs, blobTraverserOptions{})
 
 	if err != nil {
 		return false
@@ -289,6 +410,14 @@ func (cca *cookedCopyCmdArgs) initModularFilters() []objectFilter {
 		filters = append(filters, &includeAfterDateFilter{threshold: *cca.includeAfter})
 	}
 
+	if cca.minSize != nil {
+		filters = append(filters, &minSizeFilter{threshold: *cca.minSize})
+	}
+
+	if cca.maxSize != nil {
+		filters = append(filters, &maxSizeFilter{threshold: *cca.maxSize})
+	}
+
 	if len(cca.includePatterns) != 0 {
 		filters = append(filters, &includeFilter{patterns: cca.includePatterns}) // TODO should this call buildIncludeFilters?
 	}
@@ -299,6 +428,9 @@ func (cca *cookedCopyCmdArgs) initModularFilters() []objectFilter {
 		}
 	}
 
+	filters = append(filters, cca.includeRegexFilters...)
+	filters = append(filters, cca.excludeRegexFilters...)
+
 	// include-path is not a filter, therefore it does not get handled here.
 	// Check up in cook() around the list-of-files implementation as include-path gets included in the same way.
 
@@ -337,6 +469,10 @@ func (cca *cookedCopyCmdArgs) initModularFilters() []objectFilter {
 }
 
 func (cca *cookedCopyCmdArgs) createDstContainer(containerName string, dstWithSAS common.ResourceString, ctx context.Context, existingContainers map[string]bool) (err error) {
+	if cca.listOnly {
+		// a listing must not change the destination
+		return nil
+	}
 	if _, ok := existingContainers[containerName]; ok {
 		return
 	}
@@ -380,7 +516,7 @@ func (cca *cookedCopyCmdArgs) createDstContainer(containerName string, dstWithSA
 			return err // Container already exists, return gracefully
 		}
 
-		_, err = bcu.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone)
+		_, err = bcu.Create(ctx, azblob.Metadata{}, cca.createDestinationPublicAccess.ToPublicAccessType())
 
 		if stgErr, ok := err.(azblob.StorageError); ok {
 			if stgErr.ServiceCode() != azblob.ServiceCodeContainerAlreadyExists {
@@ -422,6 +558,36 @@ func (cca *cookedCopyCmdArgs) createDstContainer(containerName string, dstWithSA
 		} else {
 			return err
 		}
+	case common.ELocation.BlobFS():
+		accountRoot, err := GetAccountRoot(dstWithSAS, cca.fromTo.To())
+
+		if err != nil {
+			return err
+		}
+
+		dstURL, err := url.Parse(accountRoot)
+
+		if err != nil {
+			return err
+		}
+
+		fsURL := azbfs.NewServiceURL(*dstURL, dstPipeline).NewFileSystemURL(containerName)
+		_, err = fsURL.GetProperties(ctx)
+
+		if err == nil {
+			return err
+		}
+
+		_, err = fsURL.Create(ctx)
+
+		// another instance may have just created it
+		if stgErr, ok := err.(azbfs.StorageError); ok {
+			if stgErr.ServiceCode() != azbfs.ServiceCodeFileSystemAlreadyExists {
+				return err
+			}
+		} else {
+			return err
+		}
 	default:
 		panic(fmt.Sprintf("cannot create a destination container at location %s.", cca.fromTo.To()))
 	}
@@ -429,6 +595,43 @@ func (cca *cookedCopyCmdArgs) createDstContainer(containerName string, dstWithSA
 	return
 }
 
+// dstContainerNotFound returns true only if the service says that the destination container (or share, or file system) doesn't exist.
+// Any other outcome, such as not being allowed to look, returns false, and leaves it to the transfers to report any problem.
+func (cca *cookedCopyCmdArgs) dstContainerNotFound(containerName string, ctx context.Context) bool {
+	dstCredInfo, _, err := getCredentialInfoForLocation(ctx, cca.fromTo.To(), cca.destination.Value, cca.destination.SAS, false)
+	if err != nil {
+		return false
+	}
+	dstPipeline, err := initPipeline(ctx, cca.fromTo.To(), dstCredInfo)
+	if err != nil {
+		return false
+	}
+	accountRoot, err := GetAccountRoot(cca.destination, cca.fromTo.To())
+	if err != nil {
+		return false
+	}
+	dstURL, err := url.Parse(accountRoot)
+	if err != nil {
+		return false
+	}
+
+	switch cca.fromTo.To() {
+	case common.ELocation.Blob():
+		_, err = azblob.NewServiceURL(*dstURL, dstPipeline).NewContainerURL(containerName).GetProperties(ctx, azblob.LeaseAccessConditions{})
+	case common.ELocation.File():
+		_, err = azfile.NewServiceURL(*dstURL, dstPipeline).NewShareURL(containerName).GetProperties(ctx)
+	case common.ELocation.BlobFS():
+		_, err = azbfs.NewServiceURL(*dstURL, dstPipeline).NewFileSystemURL(containerName).GetProperties(ctx)
+	default:
+		return false
+	}
+
+	if respErr, ok := err.(interface{ Response() *http.Response }); ok && respErr.Response() != nil {
+		return respErr.Response().StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
 // Because some invalid characters weren't being properly encoded by url.PathEscape, we're going to instead manually encode them.
 var encodedInvalidCharacters = map[rune]string{
 	'<':  "%3C",
@@ -494,6 +697,189 @@ func pathEncodeRules(path string, fromTo common.FromTo, source bool) string {
 	return path
 }
 
+// snapshotNamePrefix returns the prefix that distinguishes the destination name of a blob snapshot from that of its base blob,
+// or "" if the object is not a snapshot. Colons are replaced, since they are not valid in all destinations.
+func snapshotNamePrefix(object storedObject) string {
+	if object.blobSnapshotID == "" {
+		return ""
+	}
+	return strings.ReplaceAll(object.blobSnapshotID, ":", "-") + "-"
+}
+
+// toFolderMarker prepares an object of a job with --empty-folder-markers. On upload, only the empty folders are kept, each to be sent
+// as a marker blob of no size, and on download, the marker blobs become the folders they stand for. ok is false if the object is skipped.
+func (cca *cookedCopyCmdArgs) toFolderMarker(object storedObject) (marker storedObject, ok bool) {
+	switch {
+	case cca.fromTo.IsUpload() && object.entityType == common.EEntityType.Folder():
+		if !isEmptyLocalFolder(filepath.Join(cca.source.ValueLocal(), object.relativePath)) {
+			return object, false // its files are enough to make it at the destination
+		}
+		object.size = 0
+	case cca.fromTo.IsDownload() && object.entityType == common.EEntityType.File() && copyHandlerUtil{}.doesBlobRepresentAFolder(object.Metadata.ToAzBlobMetadata()):
+		object.entityType = common.EEntityType.Folder()
+		object.size = 0
+	}
+	return object, true
+}
+
+// isEmptyLocalFolder returns false for a folder that can't be listed, since it isn't known to be empty
+func isEmptyLocalFolder(folderPath string) bool {
+	f, err := os.Open(folderPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
+
+// flattenedName returns the name under which the file at relativePath is uploaded, when its directory tree is flattened
+func flattenedName(relativePath string) string {
+	return path.Base(strings.Replace(relativePath, common.OS_PATH_SEPARATOR, common.AZCOPY_PATH_SEPARATOR_STRING, -1))
+}
+
+// destinationNameTracker resolves the collisions between files that flattening or renaming gives the same destination.
+// It is not safe for concurrent use, which is fine since the processor is called serially.
+type destinationNameTracker struct {
+	collisionOption common.DestinationCollisionOption
+	destinations    map[string]*trackedDestination
+	// report is told about each collision, and how it was resolved
+	report func(message string)
+}
+
+// trackedDestination is a destination relative path that has been given to a file
+type trackedDestination struct {
+	relativePath    string
+	srcRelativePath string
+	// where the file's transfer is in the job order. It can only be replaced while its part is the one being built.
+	partNum common.PartNumber
+	index   int
+	// under Overwrite, the source that a later file with the destination is taking it from, until its transfer is added
+	displacedSrc string
+}
+
+func newDestinationNameTracker(collisionOption common.DestinationCollisionOption, report func(message string)) *destinationNameTracker {
+	return &destinationNameTracker{collisionOption: collisionOption, destinations: make(map[string]*trackedDestination), report: report}
+}
+
+// resolve gives the file at srcRelativePath, which flattening or renaming has given dstRelativePath, its destination.
+// The file's transfer must then be added with addTransfer. If the file has already been given that destination, it has nothing to add,
+// so nil is returned.
+func (t *destinationNameTracker) resolve(srcRelativePath, dstRelativePath string) (*trackedDestination, error) {
+	dstRelativePath = strings.Replace(dstRelativePath, common.OS_PATH_SEPARATOR, common.AZCOPY_PATH_SEPARATOR_STRING, -1)
+	earlier, found := t.destinations[dstRelativePath]
+	if !found {
+		return t.track(srcRelativePath, dstRelativePath), nil
+	}
+	if earlier.srcRelativePath == srcRelativePath {
+		return nil, nil
+	}
+
+	switch t.collisionOption {
+	case common.EDestinationCollisionOption.Overwrite():
+		earlier.displacedSrc = earlier.srcRelativePath
+		earlier.srcRelativePath = srcRelativePath
+		return earlier, nil
+	case common.EDestinationCollisionOption.AppendSuffix():
+		dir, name := path.Split(dstRelativePath)
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s%s-%d%s", dir, stem, i, ext)
+			if _, found = t.destinations[candidate]; !found {
+				t.report(fmt.Sprintf("'%s' is copied to '%s', since '%s' is already copied to '%s'", srcRelativePath, candidate, earlier.srcRelativePath, dstRelativePath))
+				return t.track(srcRelativePath, candidate), nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cannot copy '%s' to '%s', since '%s' is already copied there. Use --destination-collision-policy=%s to give such files distinct names, "+
+			"or --destination-collision-policy=%s to copy only the last of them", srcRelativePath, dstRelativePath, earlier.srcRelativePath,
+			common.EDestinationCollisionOption.AppendSuffix(), common.EDestinationCollisionOption.Overwrite())
+	}
+}
+
+func (t *destinationNameTracker) track(srcRelativePath, dstRelativePath string) *trackedDestination {
+	dst := &trackedDestination{relativePath: dstRelativePath, srcRelativePath: srcRelativePath, index: -1}
+	t.destinations[dstRelativePath] = dst
+	return dst
+}
+
+// addTransfer adds the transfer of the file that resolve gave dst to the job order, and counts it against the share quota. Under Overwrite,
+// it takes the place of the transfer of the file that had the destination before. That can't be done once that transfer's part
+// has been dispatched, since both files would then be copied, in no telling which order, so an error is returned instead.
+func (t *destinationNameTracker) addTransfer(e *common.CopyJobPartOrderRequest, dst *trackedDestination, transfer common.CopyTransfer, cca *cookedCopyCmdArgs,
+	shareQuota *shareQuotaTracker) error {
+	if displaced := dst.displacedSrc; displaced != "" {
+		dst.displacedSrc = ""
+		if dst.partNum != e.PartNum || dst.index < 0 {
+			return fmt.Errorf("cannot copy '%s' to '%s' in place of '%s', since the transfer of '%s' has already been scheduled. "+
+				"Use a larger --transfers-per-part, so that both are planned in the same part, or --destination-collision-policy=%s to give them distinct names",
+				dst.srcRelativePath, dst.relativePath, displaced, displaced, common.EDestinationCollisionOption.AppendSuffix())
+		}
+		t.report(fmt.Sprintf("only '%s' is copied to '%s', in place of '%s'", dst.srcRelativePath, dst.relativePath, displaced))
+		replaced := replaceTransfer(e, dst.index, transfer, cca)
+		shareQuota.remove(replaced.SourceSize)
+		shareQuota.add(transfer.SourceSize)
+		return nil
+	}
+
+	shareQuota.add(transfer.SourceSize)
+	if err := addTransfer(e, transfer, cca); err != nil {
+		return err
+	}
+	dst.partNum, dst.index = e.PartNum, len(e.Transfers)-1
+	return nil
+}
+
+// normalizeDestinationPrefix gives a prefix from the command line the form of the relative paths it is matched against and joined to,
+// i.e. separated by forward slashes, without a leading or trailing one
+func normalizeDestinationPrefix(prefix string) string {
+	prefix = strings.Replace(prefix, `\`, common.AZCOPY_PATH_SEPARATOR_STRING, -1)
+	return strings.Trim(prefix, common.AZCOPY_PATH_SEPARATOR_STRING)
+}
+
+// destinationPrefixRenamer moves each file's destination from under one directory prefix of its relative path to under another
+type destinationPrefixRenamer struct {
+	stripPrefix    string
+	addPrefix      string
+	mismatchOption common.PrefixMismatchOption
+}
+
+// newDestinationPrefixRenamer returns nil if neither prefix is given, since then every file keeps its relative path
+func newDestinationPrefixRenamer(stripPrefix, addPrefix string, mismatchOption common.PrefixMismatchOption) *destinationPrefixRenamer {
+	if stripPrefix == "" && addPrefix == "" {
+		return nil
+	}
+	return &destinationPrefixRenamer{stripPrefix: stripPrefix, addPrefix: addPrefix, mismatchOption: mismatchOption}
+}
+
+// rename returns the relative path that the object at relativePath is to have at the destination,
+// or false if the object is not to be transferred at all.
+func (r *destinationPrefixRenamer) rename(relativePath string, entityType common.EntityType) (string, bool, error) {
+	relativePath = strings.Replace(relativePath, common.OS_PATH_SEPARATOR, common.AZCOPY_PATH_SEPARATOR_STRING, -1)
+
+	if r.stripPrefix != "" {
+		switch {
+		case strings.HasPrefix(relativePath, r.stripPrefix+common.AZCOPY_PATH_SEPARATOR_STRING):
+			relativePath = strings.TrimPrefix(relativePath, r.stripPrefix+common.AZCOPY_PATH_SEPARATOR_STRING)
+		case entityType == common.EEntityType.Folder() &&
+			(relativePath == "" || relativePath == r.stripPrefix || strings.HasPrefix(r.stripPrefix, relativePath+common.AZCOPY_PATH_SEPARATOR_STRING)):
+			// the folders that the prefix itself is made of have nowhere to go, once it is stripped. That's not a mismatch.
+			return "", false, nil
+		case r.mismatchOption == common.EPrefixMismatchOption.Skip():
+			return "", false, nil
+		default:
+			return "", false, fmt.Errorf("cannot strip the prefix '%s' from '%s', since the path does not start with it. "+
+				"Use --strip-prefix-mismatch=%s to skip such files", r.stripPrefix, relativePath, common.EPrefixMismatchOption.Skip())
+		}
+	}
+
+	if r.addPrefix != "" {
+		relativePath = path.Join(r.addPrefix, relativePath)
+	}
+	return relativePath, true, nil
+}
+
 func (cca *cookedCopyCmdArgs) makeEscapedRelativePath(source bool, dstIsDir bool, object storedObject) (relativePath string) {
 	// write straight to /dev/null, do not determine a indirect path
 	if !source && cca.destination.Value == common.Dev_Null {
@@ -515,7 +901,7 @@ func (cca *cookedCopyCmdArgs) makeEscapedRelativePath(source bool, dstIsDir bool
 				if len(object.blobVersionID) > 0 {
 					processedVID = strings.ReplaceAll(object.blobVersionID, ":", "-") + "-"
 				}
-				relativePath += "/" + processedVID + object.name
+				relativePath += "/" + processedVID + snapshotNamePrefix(object) + object.name
 			} else {
 				relativePath = ""
 			}
@@ -530,6 +916,11 @@ func (cca *cookedCopyCmdArgs) makeEscapedRelativePath(source bool, dstIsDir bool
 		relativePath = "" // otherwise we get "/" from the line below, and that breaks some clients, e.g. blobFS
 	} else {
 		relativePath = "/" + strings.Replace(object.relativePath, common.OS_PATH_SEPARATOR, common.AZCOPY_PATH_SEPARATOR_STRING, -1)
+		if !source && object.blobSnapshotID != "" {
+			// each snapshot of a blob needs its own destination, so prefix the name (i.e. the last segment of the path) with the snapshot time
+			i := strings.LastIndex(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+			relativePath = relativePath[:i+1] + snapshotNamePrefix(object) + relativePath[i+1:]
+		}
 	}
 
 	if common.IffString(source, object.containerName, object.dstContainerName) != "" {
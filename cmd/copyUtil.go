@@ -38,8 +38,29 @@ import (
 
 const (
 	NumOfFilesPerDispatchJobPart = 10000
+
+	// the bounds of --transfers-per-part. With smaller parts, a large job needs more plan files than the engine can keep open,
+	// and with larger ones, the transfers of the part being built take up too much memory
+	minTransfersPerPart = 100
+	maxTransfersPerPart = 1000000
 )
 
+// validateTransfersPerPart checks the --transfers-per-part value, where 0 means the default
+func validateTransfersPerPart(transfersPerPart uint32) error {
+	if transfersPerPart != 0 && (transfersPerPart < minTransfersPerPart || transfersPerPart > maxTransfersPerPart) {
+		return fmt.Errorf("invalid transfers-per-part %d, it must be between %d and %d", transfersPerPart, minTransfersPerPart, maxTransfersPerPart)
+	}
+	return nil
+}
+
+// transfersPerPartOrDefault returns how many transfers go in each job part, given the --transfers-per-part value
+func transfersPerPartOrDefault(transfersPerPart uint32) int {
+	if transfersPerPart == 0 {
+		return NumOfFilesPerDispatchJobPart
+	}
+	return int(transfersPerPart)
+}
+
 type copyHandlerUtil struct{}
 
 // TODO: Need be replaced with anonymous embedded field technique.
@@ -197,7 +218,7 @@ func (util copyHandlerUtil) doesBlobRepresentAFolder(metadata azblob.Metadata) b
 	// HDFS driver creates a blob for the empty directories (let’s call it ‘myfolder’)
 	// and names all the blobs under ‘myfolder’ as such: ‘myfolder/myblob’
 	// The empty directory has meta-data 'hdi_isfolder = true'
-	return metadata["hdi_isfolder"] == "true"
+	return metadata[common.FolderMarkerMetadataKey] == "true"
 }
 
 func startsWith(s string, t string) bool {
@@ -21,8 +21,15 @@
 package cmd
 
 import (
-	chk "gopkg.in/check.v1"
 	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 )
 
 type copyUtilTestSuite struct{}
@@ -79,3 +86,253 @@ func (s *copyUtilTestSuite) TestIPIsContainerOrBlob(c *chk.C) {
 	c.Assert(isContainerURL, chk.Equals, true) // URL endpoints do not contain the account in the path, making the container the first entry.
 	// The behaviour isn't too different from here.
 }
+
+func (s *copyUtilTestSuite) TestValidateBlobTagsKeyValue(c *chk.C) {
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{"project": "azcopy", "path": "dir/a b+c-d.e:f=g_h", "empty": ""}), chk.IsNil)
+
+	tooMany := common.BlobTags{}
+	for i := 0; i < 11; i++ {
+		tooMany["key"+strings.Repeat("a", i)] = "value"
+	}
+	c.Assert(validateBlobTagsKeyValue(tooMany), chk.NotNil)
+
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{"": "value"}), chk.NotNil)
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{strings.Repeat("k", 129): "value"}), chk.NotNil)
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{"key": strings.Repeat("v", 257)}), chk.NotNil)
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{"key&": "value"}), chk.NotNil)
+	c.Assert(validateBlobTagsKeyValue(common.BlobTags{"key": "value%"}), chk.NotNil)
+}
+
+func (s *copyUtilTestSuite) TestGzipUploadOptions(c *chk.C) {
+	c.Assert(validateGzipUpload(true, common.EFromTo.LocalBlob(), common.EBlobType.Detect(), ""), chk.IsNil)
+	c.Assert(validateGzipUpload(true, common.EFromTo.LocalBlob(), common.EBlobType.BlockBlob(), ""), chk.IsNil)
+	c.Assert(validateGzipUpload(true, common.EFromTo.LocalFile(), common.EBlobType.Detect(), ""), chk.NotNil)
+	c.Assert(validateGzipUpload(true, common.EFromTo.BlobBlob(), common.EBlobType.Detect(), ""), chk.NotNil)
+	c.Assert(validateGzipUpload(true, common.EFromTo.LocalBlob(), common.EBlobType.PageBlob(), ""), chk.NotNil)
+	c.Assert(validateGzipUpload(true, common.EFromTo.LocalBlob(), common.EBlobType.Detect(), "br"), chk.NotNil)
+	c.Assert(validateGzipUpload(false, common.EFromTo.LocalFile(), common.EBlobType.PageBlob(), "br"), chk.IsNil)
+
+	extensions, err := parseGzipExtensions(" log;.JSON;;csv ")
+	c.Assert(err, chk.IsNil)
+	c.Assert(extensions, chk.Equals, ".log;.json;.csv")
+	extensions, err = parseGzipExtensions("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(extensions, chk.Equals, "")
+	_, err = parseGzipExtensions(strings.Repeat(".ext;", 60))
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyUtilTestSuite) TestImmutabilityOptions(c *chk.C) {
+	c.Assert(validatePreserveImmutability(true, common.EFromTo.BlobBlob()), chk.IsNil)
+	c.Assert(validatePreserveImmutability(true, common.EFromTo.LocalBlob()), chk.NotNil)
+	c.Assert(validatePreserveImmutability(false, common.EFromTo.LocalBlob()), chk.IsNil)
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	expiresOn, mode, err := parseImmutabilityPolicy("2030-01-02T15:04:05Z", "", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(expiresOn.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)), chk.Equals, true)
+	c.Assert(mode, chk.Equals, common.EImmutabilityPolicyMode.Unlocked())
+	_, mode, err = parseImmutabilityPolicy("2030-01-02T15:04:05+02:00", "locked", common.EFromTo.BlobBlob(), now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(mode, chk.Equals, common.EImmutabilityPolicyMode.Locked())
+
+	// no policy at all
+	expiresOn, _, err = parseImmutabilityPolicy("", "", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(expiresOn.IsZero(), chk.Equals, true)
+
+	_, _, err = parseImmutabilityPolicy("", "Locked", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.NotNil)
+	_, _, err = parseImmutabilityPolicy("2030-01-02T15:04:05Z", "", common.EFromTo.LocalFile(), now)
+	c.Assert(err, chk.NotNil)
+	_, _, err = parseImmutabilityPolicy("2030-01-02", "", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.NotNil)
+	_, _, err = parseImmutabilityPolicy("2020-01-02T15:04:05Z", "", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.NotNil)
+	_, _, err = parseImmutabilityPolicy("2030-01-02T15:04:05Z", "Forever", common.EFromTo.LocalBlob(), now)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *copyUtilTestSuite) TestCookRemoveAndBenchmarkArgs(c *chk.C) {
+	// remove and bench register only some of copy's flags, and rely on setMandatoryDefaults for the rest
+	remove := rawCopyCmdArgs{src: "https://account.blob.core.windows.net/container/dir?sig=secret", fromTo: common.EFromTo.BlobTrash().String(),
+		recursive: true, logVerbosity: "INFO", logFormat: common.ELogFormat.Text().String()}
+	remove.setMandatoryDefaults()
+	remove.includeDirectoryStubs = true
+	cooked, err := remove.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.maxRetries, chk.Equals, int32(-1)) // i.e. the engine default
+
+	bench := rawBenchmarkCmdArgs{target: "https://account.blob.core.windows.net/container?sig=secret", sizePerFile: "1k", fileCount: 10, deleteTestData: true,
+		blobType: common.EBlobType.Detect().String(), output: common.EOutputFormat.Text().String(), logVerbosity: "INFO", mode: common.EBenchMarkMode.Upload().String()}
+	cooked, err = bench.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.maxRetries, chk.Equals, int32(-1))
+	// the cleanup job is a remove
+	c.Assert(cooked.followupJobArgs, chk.NotNil)
+	c.Assert(cooked.followupJobArgs.fromTo, chk.Equals, common.EFromTo.BlobTrash())
+}
+
+func (s *copyUtilTestSuite) TestCookFlattenWithMandatoryDefaults(c *chk.C) {
+	// the collision policy of flatten-directories must have a default for callers that don't register its flag
+	raw := rawCopyCmdArgs{src: c.MkDir(), dst: "https://account.blob.core.windows.net/container?sig=secret", fromTo: common.EFromTo.LocalBlob().String(),
+		recursive: true, flattenDirectories: true, logVerbosity: "INFO", logFormat: common.ELogFormat.Text().String()}
+	raw.setMandatoryDefaults()
+	cooked, err := raw.cook()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.flattenDirectories, chk.Equals, true)
+	c.Assert(cooked.destinationCollisionOption, chk.Equals, common.DefaultDestinationCollisionOption)
+}
+
+func (s *copyUtilTestSuite) TestCookChecksTheWholeListOfFiles(c *chk.C) {
+	cook := func(files, destinations []string) (cookedCopyCmdArgs, error) {
+		raw := rawCopyCmdArgs{src: c.MkDir(), dst: "https://account.blob.core.windows.net/container?sig=secret", fromTo: common.EFromTo.LocalBlob().String(),
+			recursive: true, logVerbosity: "INFO", logFormat: common.ELogFormat.Text().String()}
+		raw.setMandatoryDefaults()
+		if files != nil {
+			raw.listOfFilesToCopy = scenarioHelper{}.generateListOfFiles(c, files)
+		}
+		if destinations != nil {
+			raw.listOfDestinations = scenarioHelper{}.generateListOfFiles(c, destinations)
+		}
+		return raw.cook()
+	}
+
+	// the malformed line is found before enumeration starts, and fails the command rather than exiting part way through the job
+	_, err := cook([]string{"a.txt", "b.txt", "c.txt"}, []string{"", "", "../c.txt"})
+	c.Assert(err, chk.ErrorMatches, "line 3 of the list of files is malformed: .*")
+	_, err = cook(nil, []string{"renamed.txt"})
+	c.Assert(err, chk.ErrorMatches, "list-of-destinations can only be used together with list-of-files")
+
+	cooked, err := cook([]string{"a.txt", "b.txt"}, []string{"", "renamed.txt"})
+	c.Assert(err, chk.IsNil)
+	var entries []string
+	for entry := range cooked.listOfFilesChannel {
+		entries = append(entries, entry)
+	}
+	c.Assert(entries, chk.DeepEquals, []string{"a.txt", listOfFilesEntry("b.txt", "renamed.txt")})
+}
+
+func (s *copyUtilTestSuite) TestMaxRetriesOptions(c *chk.C) {
+	cook := func(maxRetries int32) (cookedCopyCmdArgs, error) {
+		raw := rawCopyCmdArgs{src: c.MkDir(), dst: "https://account.blob.core.windows.net/container?sig=secret", fromTo: common.EFromTo.LocalBlob().String(),
+			recursive: true, logVerbosity: "INFO", logFormat: common.ELogFormat.Text().String()}
+		raw.setMandatoryDefaults()
+		raw.maxRetries = maxRetries
+		return raw.cook()
+	}
+
+	// -1 leaves it to the engine, and 0 means no retries at all
+	for _, maxRetries := range []int32{-1, 0, 3} {
+		cooked, err := cook(maxRetries)
+		c.Assert(err, chk.IsNil)
+		c.Assert(cooked.maxRetries, chk.Equals, maxRetries)
+	}
+	_, err := cook(-2)
+	c.Assert(err, chk.ErrorMatches, "invalid max-retries -2, .*")
+}
+
+func (s *copyUtilTestSuite) TestPreserveLastModifiedTimeOptions(c *chk.C) {
+	// it is on by default, so only asking for it explicitly is an error where there is no local file to stamp
+	for _, fromTo := range []common.FromTo{common.EFromTo.LocalBlob(), common.EFromTo.BlobBlob()} {
+		c.Assert(validatePreserveLastModifiedTime(true, false, fromTo), chk.IsNil)
+		c.Assert(validatePreserveLastModifiedTime(false, true, fromTo), chk.IsNil)
+		c.Assert(validatePreserveLastModifiedTime(true, true, fromTo), chk.ErrorMatches, "flag --preserve-last-modified-time can only be used on downloads")
+	}
+	c.Assert(validatePreserveLastModifiedTime(true, true, common.EFromTo.BlobLocal()), chk.IsNil)
+	c.Assert(validatePreserveLastModifiedTime(false, true, common.EFromTo.BlobLocal()), chk.IsNil)
+
+	cook := func(fromTo common.FromTo, src, dst string, preserve, explicit bool) (cookedCopyCmdArgs, error) {
+		raw := rawCopyCmdArgs{src: src, dst: dst, fromTo: fromTo.String(), recursive: true, logVerbosity: "INFO", logFormat: common.ELogFormat.Text().String()}
+		raw.setMandatoryDefaults()
+		raw.preserveLastModifiedTime, raw.explicitPreserveLMT = preserve, explicit
+		return raw.cook()
+	}
+	container := "https://account.blob.core.windows.net/container?sig=secret"
+
+	// downloads preserve it unless told not to
+	cooked, err := cook(common.EFromTo.BlobLocal(), container, c.MkDir(), common.PreserveLastModifiedTimeDefault, false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.preserveLastModifiedTime, chk.Equals, true)
+	cooked, err = cook(common.EFromTo.BlobLocal(), container, c.MkDir(), false, true)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.preserveLastModifiedTime, chk.Equals, false)
+
+	// uploads ignore the default, and may turn it off, but not on
+	cooked, err = cook(common.EFromTo.LocalBlob(), c.MkDir(), container, common.PreserveLastModifiedTimeDefault, false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cooked.preserveLastModifiedTime, chk.Equals, false)
+	_, err = cook(common.EFromTo.LocalBlob(), c.MkDir(), container, false, true)
+	c.Assert(err, chk.IsNil)
+	_, err = cook(common.EFromTo.LocalBlob(), c.MkDir(), container, true, true)
+	c.Assert(err, chk.ErrorMatches, "flag --preserve-last-modified-time can only be used on downloads")
+}
+
+func (s *copyUtilTestSuite) TestTruncateCustomHeader(c *chk.C) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	// a value that fits is kept as it is, without a warning
+	fits := strings.Repeat("a", ste.CustomHeaderMaxBytes)
+	c.Assert(truncateCustomHeader(fits, "content-type"), chk.Equals, fits)
+	c.Assert(mockedLcm.infoLog, chk.HasLen, 0)
+
+	// a longer one is cut at the limit, with a warning
+	c.Assert(truncateCustomHeader(fits+"b", "content-type"), chk.Equals, fits)
+	c.Assert(strings.Contains(<-mockedLcm.infoLog, "--content-type is longer than"), chk.Equals, true)
+
+	// unless the limit falls inside a multi-byte character, which is then left out whole
+	for _, char := range []string{"é", "€", "😀"} {
+		for pad := 0; pad < len(char); pad++ {
+			value := strings.Repeat("a", ste.CustomHeaderMaxBytes-len(char)+1+pad) + char + "tail"
+			truncated := truncateCustomHeader(value, "content-language")
+			c.Assert(utf8.ValidString(truncated), chk.Equals, true)
+			c.Assert(strings.HasPrefix(value, truncated), chk.Equals, true)
+			c.Assert(len(truncated), chk.Equals, len(value)-len(char)-len("tail"))
+			<-mockedLcm.infoLog
+		}
+	}
+
+	// even when the value is all multi-byte characters
+	value := strings.Repeat("€", ste.CustomHeaderMaxBytes)
+	truncated := truncateCustomHeader(value, "cache-control")
+	c.Assert(truncated, chk.Equals, strings.Repeat("€", ste.CustomHeaderMaxBytes/len("€")))
+}
+
+func (s *copyUtilTestSuite) TestValidateRedirectionBlob(c *chk.C) {
+	blob := func(u string) common.ResourceString {
+		res, err := SplitResourceString(u, common.ELocation.Blob())
+		c.Assert(err, chk.IsNil)
+		return res
+	}
+	role := "destination of an upload from stdin"
+
+	c.Assert(validateRedirectionBlob(blob("https://account.blob.core.windows.net/container/dir/blob.txt?sig=secret"), role), chk.IsNil)
+	// there is no name in the stream to give a blob in a container or virtual directory, nor a way to fit it to a wildcard
+	for _, notABlob := range []string{
+		"https://account.blob.core.windows.net/container",
+		"https://account.blob.core.windows.net/container/",
+		"https://account.blob.core.windows.net/container/dir/",
+		"https://account.blob.core.windows.net/container/dir/*",
+	} {
+		c.Assert(validateRedirectionBlob(blob(notABlob), role), chk.ErrorMatches,
+			"the destination of an upload from stdin must be a single blob, not a container or virtual directory", chk.Commentf(notABlob))
+	}
+
+	// so both uploads from stdin and downloads to stdout are refused when they are cooked
+	originalLcm := glcm
+	glcm = &mockedLifecycleManager{}
+	defer func() { glcm = originalLcm }()
+	for _, raw := range []rawCopyCmdArgs{
+		{dst: "https://account.blob.core.windows.net/container?sig=secret", fromTo: common.EFromTo.PipeBlob().String()},
+		{src: "https://account.blob.core.windows.net/container/dir/?sig=secret", fromTo: common.EFromTo.BlobPipe().String()},
+	} {
+		raw.logVerbosity = "INFO"
+		raw.logFormat = common.ELogFormat.Text().String()
+		raw.setMandatoryDefaults()
+		_, err := raw.cook()
+		c.Assert(err, chk.ErrorMatches, "the (destination of an upload from stdin|source of a download to stdout) must be a single blob.*")
+	}
+}
@@ -65,6 +65,10 @@ Upload a single file by using OAuth and piping (block blobs only):
 
   - cat "/path/to/file.txt" | azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob]" --from-to PipeBlob
 
+Upload the output of a command, as it is produced, by using OAuth (block blobs only):
+
+  - tar -cz "/path/to/dir" | azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob.tar.gz]" --from-stdin
+
 Upload an entire directory by using a SAS token:
   
   - azcopy cp "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive=true
@@ -103,6 +107,10 @@ Download a single file by using OAuth and then piping the output to a file (bloc
   
   - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob]" --from-to BlobPipe > "/path/to/file.txt"
 
+Download a single file by using OAuth and piping it into another command, as it arrives:
+
+  - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/blob.tar.gz]" --to-stdout | tar -xz
+
 Download an entire directory by using a SAS token:
   
   - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" "/path/to/dir" --recursive=true
@@ -200,7 +208,8 @@ const showJobsCmdShortDescription = "Show detailed information for the given job
 const showJobsCmdLongDescription = `
 If you provide only a job ID, and not a flag, then this command returns the progress summary only.
 The byte counts and percent complete that appears when you run this command reflect only files that are completed in the job. They don't reflect partially completed files.
-If you set the with-status flag, then only the list of transfers associated with the given status appear.`
+If you set the with-status flag, then only the list of transfers associated with the given status appear.
+If you set the follow flag, then the progress of the job keeps being shown as it changes, along with the transfers whose status changes, until the job is done.`
 
 const resumeJobsCmdShortDescription = "Resume the existing job with the given job ID."
 
@@ -216,6 +225,17 @@ Note that you can customize the location where log and plan files are saved. See
 
 const removeJobsCmdExample = "  azcopy jobs rm e52247de-0323-b14d-4cc8-76e0be2e2d44"
 
+const exportJobsCmdShortDescription = "Export the plan of the given job ID to a portable file."
+
+const exportJobsCmdLongDescription = `
+Export the plan of the given job ID to a portable, human-readable JSON file, e.g. to attach to a support request.
+The file holds the settings of each part of the job, and the paths, size, status, retry count and failure reason of every transfer.
+The signatures of any URLs in it are redacted, and the metadata and extra query parameters of the job are left out.
+
+The job may be completed, failed, or still running; its plan files are only read, never changed. An existing file is never overwritten.`
+
+const exportJobsCmdExample = "  azcopy jobs export e52247de-0323-b14d-4cc8-76e0be2e2d44 --output-path=job.json"
+
 const cleanJobsCmdShortDescription = "Remove all log and plan files for all jobs"
 
 const cleanJobsCmdLongDescription = `
@@ -490,3 +510,13 @@ Run an upload that does not delete the transferred files. (These files can then
 
    - azcopy bench "https://[account].blob.core.windows.net/[container]?<SAS>" --file-count 100 --delete-test-data=false
 `
+
+// transferOrderFlagDescription is the help of the --transfer-order flag of the commands that start jobs
+const transferOrderFlagDescription = "Order in which the transfers of each part of the job are started: Plan (the order of the job's plan, " +
+	"in which the files of each part are shuffled, to spread the load over the service's partitions), " +
+	"LargestFirst (the largest files first, so that no long transfer is left until the end) or SmallestFirst (the smallest files first, so that most files are done early on). " +
+	"The order is not saved with the job, so a resumed job is started in plan order unless the order is given again."
+
+// transfersPerPartFlagDescription is the help of the --transfers-per-part flag of the commands that start jobs
+const transfersPerPartFlagDescription = "Number of transfers in each part of the job, between 100 and 1000000. The part being built is held in memory, and each part has its own plan file, " +
+	"so larger parts use more memory and smaller ones more plan files. The parts are saved with the job, so resuming it keeps them. By default (or when 0), each part has 10000 transfers."
@@ -0,0 +1,95 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	type JobsExportReq struct {
+		JobID      common.JobID
+		OutputPath string
+	}
+
+	commandLineInput := JobsExportReq{}
+
+	// export a single job's plan files to a portable file
+	jobsExportCmd := &cobra.Command{
+		Use:     "export [jobID]",
+		Short:   exportJobsCmdShortDescription,
+		Long:    exportJobsCmdLongDescription,
+		Example: exportJobsCmdExample,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("export job command requires the JobID")
+			}
+			// Parse the JobId
+			jobId, err := common.ParseJobID(args[0])
+			if err != nil {
+				return errors.New("invalid jobId given " + args[0])
+			}
+			commandLineInput.JobID = jobId
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			outputPath := commandLineInput.OutputPath
+			if outputPath == "" {
+				outputPath = commandLineInput.JobID.String() + ".json"
+			}
+			err := handleExportJob(commandLineInput.JobID, outputPath)
+			if err == nil {
+				glcm.Exit(func(format common.OutputFormat) string {
+					return fmt.Sprintf("Exported the plan of job %s to %s.", commandLineInput.JobID, outputPath)
+				}, common.EExitCode.Success())
+			} else {
+				glcm.Error(fmt.Sprintf("Failed to export the plan of job %s due to error: %s.", commandLineInput.JobID, err))
+			}
+		},
+	}
+
+	jobsCmd.AddCommand(jobsExportCmd)
+
+	jobsExportCmd.PersistentFlags().StringVar(&commandLineInput.OutputPath, "output-path", "", "The file to write the exported plan to. By default, it is <jobID>.json in the current directory.")
+}
+
+// handleExportJob writes the plan of the given job to a new file at outputPath, which is removed again if the export fails part way
+func handleExportJob(jobID common.JobID, outputPath string) error {
+	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, common.DEFAULT_FILE_PERM)
+	if err != nil {
+		return err
+	}
+
+	err = ste.ExportJobPlan(jobID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(outputPath)
+	}
+	return err
+}
@@ -21,7 +21,6 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -77,7 +76,7 @@ func init() {
 
 	lsCmd.PersistentFlags().StringVar(&commandLineInput.withStatus, "with-status", "All",
 		"List the jobs with given status, available values: All, Cancelled, Failed, InProgress, Completed,"+
-			" CompletedWithErrors, CompletedWithFailures, CompletedWithErrorsAndSkipped")
+			" CompletedWithErrors, CompletedWithFailures, CompletedWithErrorsAndSkipped, Unknown")
 }
 
 // HandleListJobsCommand sends the ListJobs request to transfer engine
@@ -99,19 +98,18 @@ func PrintExistingJobIds(listJobResponse common.ListJobsResponse) error {
 
 	glcm.Exit(func(format common.OutputFormat) string {
 		if format == common.EOutputFormat.Json() {
-			jsonOutput, err := json.Marshal(listJobResponse)
-			common.PanicIfErr(err)
-			return string(jsonOutput)
+			return common.GetJsonStringFromTemplate(getListJobsJsonTemplate(listJobResponse))
 		}
 
 		var sb strings.Builder
 		sb.WriteString("Existing Jobs \n")
 		for index := 0; index < len(listJobResponse.JobIDDetails); index++ {
 			jobDetail := listJobResponse.JobIDDetails[index]
-			sb.WriteString(fmt.Sprintf("JobId: %s\nStart Time: %s\nStatus: %s\nCommand: %s\n\n",
+			sb.WriteString(fmt.Sprintf("JobId: %s\nStart Time: %s\nStatus: %s\nNumber of Transfers: %d\nCommand: %s\n\n",
 				jobDetail.JobId.String(),
 				time.Unix(0, jobDetail.StartTime).Format(time.RFC850),
 				jobDetail.JobStatus,
+				jobDetail.NumTransfers,
 				jobDetail.CommandString))
 		}
 		return sb.String()
@@ -119,6 +117,22 @@ func PrintExistingJobIds(listJobResponse common.ListJobsResponse) error {
 	return nil
 }
 
+func getListJobsJsonTemplate(listJobResponse common.ListJobsResponse) common.ListJobsJsonTemplate {
+	template := common.ListJobsJsonTemplate{
+		SchemaVersion: common.JsonOutputSchemaVersion,
+		ErrorMessage:  listJobResponse.ErrorMessage,
+		JobIDDetails:  make([]common.JobDetailsJsonTemplate, 0, len(listJobResponse.JobIDDetails)),
+	}
+	for _, jobDetail := range listJobResponse.JobIDDetails {
+		template.JobIDDetails = append(template.JobIDDetails, common.JobDetailsJsonTemplate{
+			JobIDDetails:   jobDetail,
+			JobStatusCode:  common.NewJobStatusCodeJsonTemplate(jobDetail.JobStatus),
+			ThroughputMBps: averageThroughputMBps(jobDetail.BytesTransferred, jobDetail.ElapsedSeconds),
+		})
+	}
+	return template
+}
+
 func sortJobs(jobsDetails []common.JobIDDetails) {
 	// sort the jobs so that the latest one is shown first
 	sort.Slice(jobsDetails, func(i, j int) bool {
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -65,3 +66,30 @@ func (s *jobsListTestSuite) TestSortJobs(c *chk.C) {
 	c.Assert(jobsList[1], chk.DeepEquals, job1)
 	c.Assert(jobsList[2], chk.DeepEquals, job2)
 }
+
+func (s *jobsListTestSuite) TestListJobsJsonOutput(c *chk.C) {
+	jobID := common.NewJobID()
+	resp := common.ListJobsResponse{JobIDDetails: []common.JobIDDetails{{
+		JobId:            jobID,
+		JobStatus:        common.EJobStatus.Completed(),
+		NumTransfers:     3,
+		BytesTransferred: 8000000,
+		ElapsedSeconds:   4,
+	}}}
+
+	// act
+	var output map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(common.GetJsonStringFromTemplate(getListJobsJsonTemplate(resp))), &output), chk.IsNil)
+
+	// verify
+	c.Assert(output["SchemaVersion"], chk.Equals, float64(common.JsonOutputSchemaVersion))
+	jobs := output["JobIDDetails"].([]interface{})
+	c.Assert(jobs, chk.HasLen, 1)
+	job := jobs[0].(map[string]interface{})
+	c.Assert(job["JobId"], chk.Equals, jobID.String())
+	c.Assert(job["JobStatus"], chk.Equals, "Completed") // as before the schema was versioned
+	c.Assert(job["JobStatusCode"], chk.DeepEquals, map[string]interface{}{"Code": float64(4), "Name": "Completed"})
+	c.Assert(job["NumTransfers"], chk.Equals, float64(3))
+	c.Assert(job["BytesTransferred"], chk.Equals, "8000000")
+	c.Assert(job["ThroughputMBps"], chk.Equals, float64(2))
+}
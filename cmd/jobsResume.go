@@ -80,6 +80,11 @@ func (cca *resumeJobController) Cancel(lcm common.LifecycleMgr) {
 	}
 }
 
+// Pause stops the job starting any more transfers, so that it can be resumed again later, and lets those in flight finish
+func (cca *resumeJobController) Pause(lcm common.LifecycleMgr) {
+	pauseJob(lcm, cca.jobID)
+}
+
 // TODO: can we combine this with the copy one (and the sync one?)
 func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) (totalKnownCount uint32) {
 	// fetch a job status
@@ -107,7 +112,7 @@ func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) (t
 				return string(jsonOutput)
 			} else {
 				return fmt.Sprintf(
-					"\n\nJob %s summary\nElapsed Time (Minutes): %v\nNumber of File Transfers: %v\nNumber of Folder Property Transfers: %v\nTotal Number Of Transfers: %v\nNumber of Transfers Completed: %v\nNumber of Transfers Failed: %v\nNumber of Transfers Skipped: %v\nTotalBytesTransferred: %v\nFinal Job Status: %v\n",
+					"\n\nJob %s summary\nElapsed Time (Minutes): %v\nNumber of File Transfers: %v\nNumber of Folder Property Transfers: %v\nTotal Number Of Transfers: %v\nNumber of Transfers Completed: %v\nNumber of Transfers Failed: %v\nNumber of Transfers Skipped: %v\nTotalBytesTransferred: %v\nFinal Job Status: %v%s\n",
 					summary.JobID.String(),
 					ste.ToFixed(duration.Minutes(), 4),
 					summary.FileTransfers,
@@ -117,10 +122,14 @@ func (cca *resumeJobController) ReportProgressOrExit(lcm common.LifecycleMgr) (t
 					summary.TransfersFailed,
 					summary.TransfersSkipped,
 					summary.TotalBytesTransferred,
-					summary.JobStatus)
+					formatJobStatus(summary.JobStatus, summary.CancelReason),
+					formatTransferTimings(summary))
 			}
 		}, exitCode)
 	}
+	if summary.JobStatus == common.EJobStatus.Paused() {
+		exitPausedJob(lcm, summary)
+	}
 
 	var computeThroughput = func() float64 {
 		// compute the average throughput for the last time interval
@@ -202,6 +211,21 @@ func init() {
 		"Files should be separated by ';'.")
 	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.excludeTransfer, "exclude", "", "Filter: exclude these failed transfer(s) when resuming the job. "+
 		"Files should be separated by ';'.")
+	resumeCmd.PersistentFlags().BoolVar(&resumeCmdArgs.failedOnly, "failed-only", false, "Only retry the transfers that failed, leaving all others untouched. "+
+		"The job must have finished; the source is not scanned again.")
+	resumeCmd.PersistentFlags().BoolVar(&resumeCmdArgs.verifySource, "verify-source", false, "Before resuming, check the size and last modified time of the sources of the files "+
+		"that are still to be transferred against those recorded when the job was created, and refuse to resume the job if any have changed, "+
+		"since the destination would then be a mix of old and new data.")
+	resumeCmd.PersistentFlags().Uint32Var(&resumeCmdArgs.verifySourceSample, "verify-source-sample", 100, "With --verify-source, check this many of the files, picked at random. 0 checks them all.")
+	resumeCmd.PersistentFlags().BoolVar(&resumeCmdArgs.force, "force", false, "With --verify-source, resume the job even if its source has changed, only warning about it.")
+	resumeCmd.PersistentFlags().Uint16Var(&resumeCmdArgs.parallelTransfers, "parallel-transfers", 0, "Limit how many of the job's transfers are in progress at once. "+
+		"By default, the limit given when the job was started is kept.")
+	resumeCmd.PersistentFlags().Uint64Var(&resumeCmdArgs.maxTotalBytes, "max-total-bytes", 0, "Limit how many bytes the job may transfer in all, over all its runs (see 'azcopy copy --help'), "+
+		"e.g. to let a job that reached its limit go on. By default, the limit given when the job was started is kept.")
+	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.transferOrder, "transfer-order", common.ETransferOrder.Plan().String(), "Order in which the transfers of each part of the job are started: "+
+		"Plan, LargestFirst or SmallestFirst (see 'azcopy copy --help'). Like the SAS tokens, it is not saved with the job, so it must be given again on each resume.")
+	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.sasRefreshCommand, "sas-refresh-command", "", "Command line that prints a new SAS token, run when a token is about to expire (see 'azcopy copy --help'). "+
+		"Like the SAS tokens, it is not saved with the job, so it must be given again on each resume.")
 	// oauth options
 	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.SourceSAS, "source-sas", "", "Source SAS token of the source for a given Job ID.")
 	resumeCmd.PersistentFlags().StringVar(&resumeCmdArgs.DestinationSAS, "destination-sas", "", "destination SAS token of the destination for a given Job ID.")
@@ -211,11 +235,43 @@ type resumeCmdArgs struct {
 	jobID           string
 	includeTransfer string
 	excludeTransfer string
+	failedOnly      bool
+	// 0 keeps the concurrency stored in the job's plan
+	parallelTransfers uint16
+	// 0 keeps the data limit stored in the job's plan
+	maxTotalBytes uint64
+	// the command line that prints a new SAS token when one is about to expire. Empty if the tokens are not refreshed
+	sasRefreshCommand string
+	// the order in which the transfers of each job part are scheduled. It isn't stored in the plan, so it defaults to the plan order
+	transferOrder string
+	// whether to check that the source hasn't changed since the job was created (see sourceCheck), for how many files (0 for all),
+	// and whether to resume the job anyway if it has
+	verifySource       bool
+	verifySourceSample uint32
+	force              bool
 
 	SourceSAS      string
 	DestinationSAS string
 }
 
+// verifySourceUnchanged runs the given check of the job's source, and returns an error if the source has changed,
+// unless the job is to be resumed anyway, in which case the changes are only reported
+func (rca resumeCmdArgs) verifySourceUnchanged(ctx context.Context, jobID common.JobID, check sourceCheck) error {
+	changes, checked, err := check.run(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		glcm.Info(fmt.Sprintf("None of the %d sources that were checked have changed since job %s was created.", checked, jobID))
+		return nil
+	}
+	if rca.force {
+		glcm.Info("WARNING: " + describeSourceChanges(changes, checked) + ". The job is resumed anyway, since --force was given.")
+		return nil
+	}
+	return fmt.Errorf("cannot resume job %s, since %s. Resume it with --force if that is expected", jobID, describeSourceChanges(changes, checked))
+}
+
 // processes the resume command,
 // dispatches the resume Job order to the storage engine.
 func (rca resumeCmdArgs) process() error {
@@ -225,6 +281,10 @@ func (rca resumeCmdArgs) process() error {
 		// If parsing gives an error, hence it is not a valid JobId format
 		return fmt.Errorf("error parsing the jobId %s. Failed with error %s", rca.jobID, err.Error())
 	}
+	var transferOrder common.TransferOrder
+	if err = transferOrder.Parse(rca.transferOrder); err != nil {
+		return fmt.Errorf("error parsing the transfer order %s. Failed with error %s", rca.transferOrder, err.Error())
+	}
 
 	includeTransfer := make(map[string]int)
 	excludeTransfer := make(map[string]int)
@@ -274,11 +334,28 @@ func (rca resumeCmdArgs) process() error {
 		return errors.New("resuming benchmark jobs is not supported")
 	}
 
+	if err = validateSASNotExpired(rca.SourceSAS, "source", time.Now()); err != nil {
+		return err
+	}
+	if err = validateSASNotExpired(rca.DestinationSAS, "destination", time.Now()); err != nil {
+		return err
+	}
+
 	ctx := context.TODO()
 	// Initialize credential info.
 	credentialInfo := common.CredentialInfo{}
+	// A job that was started with Azure AD is resumed the same way, unless it is given a SAS token instead for the side that
+	// Azure AD authenticated: the destination, unless there is none to write to. The SAS token of a server-to-server source is separate.
+	// Otherwise, the credential type is worked out again, as for a new job.
 	// TODO: Replace context with root context
-	if credentialInfo.CredentialType, err = getCredentialType(ctx, rawFromToInfo{
+	oauthSideSAS := rca.DestinationSAS
+	if fromTo := getJobFromToResponse.FromTo; fromTo.IsDownload() || fromTo.To() == common.ELocation.Unknown() {
+		oauthSideSAS = rca.SourceSAS
+	}
+	startedWithOAuth := getJobFromToResponse.CredentialType == common.ECredentialType.OAuthToken() && oauthSideSAS == ""
+	if startedWithOAuth {
+		credentialInfo.CredentialType = common.ECredentialType.OAuthToken()
+	} else if credentialInfo.CredentialType, err = getCredentialType(ctx, rawFromToInfo{
 		fromTo:         getJobFromToResponse.FromTo,
 		source:         getJobFromToResponse.Source,
 		destination:    getJobFromToResponse.Destination,
@@ -286,26 +363,53 @@ func (rca resumeCmdArgs) process() error {
 		destinationSAS: rca.DestinationSAS,
 	}); err != nil {
 		return err
-	} else if credentialInfo.CredentialType == common.ECredentialType.OAuthToken() {
+	}
+	if credentialInfo.CredentialType == common.ECredentialType.OAuthToken() {
 		uotm := GetUserOAuthTokenManagerInstance()
 		// Get token from env var or cache.
 		if tokenInfo, err := uotm.GetTokenInfo(ctx); err != nil {
+			if startedWithOAuth {
+				return fmt.Errorf("job %v was started with Azure AD authentication, so it must be resumed the same way. "+
+					"Please log in with 'azcopy login' (or set the environment variables for automatic login), or give SAS tokens: %v", jobID, err)
+			}
 			return err
 		} else {
 			credentialInfo.OAuthTokenInfo = *tokenInfo
 		}
 	}
 
+	if rca.verifySource {
+		check := sourceCheck{
+			fromTo:     getJobFromToResponse.FromTo,
+			sourceSAS:  rca.SourceSAS,
+			sampleSize: int(rca.verifySourceSample),
+			failedOnly: rca.failedOnly,
+		}
+		// a download authenticates to its source; other remote sources are authenticated by their SAS token, or by their own keys
+		check.credentialInfo = common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}
+		if getJobFromToResponse.FromTo.IsDownload() {
+			check.credentialInfo = credentialInfo
+		}
+		if err = rca.verifySourceUnchanged(ctx, jobID, check); err != nil {
+			return err
+		}
+	}
+
 	// Send resume job request.
 	var resumeJobResponse common.CancelPauseResumeResponse
 	Rpc(common.ERpcCmd.ResumeJob(),
 		&common.ResumeJobRequest{
-			JobID:           jobID,
-			SourceSAS:       rca.SourceSAS,
-			DestinationSAS:  rca.DestinationSAS,
-			CredentialInfo:  credentialInfo,
-			IncludeTransfer: includeTransfer,
-			ExcludeTransfer: excludeTransfer,
+			JobID:             jobID,
+			SourceSAS:         rca.SourceSAS,
+			DestinationSAS:    rca.DestinationSAS,
+			CredentialInfo:    credentialInfo,
+			IncludeTransfer:   includeTransfer,
+			ExcludeTransfer:   excludeTransfer,
+			FailedOnly:        rca.failedOnly,
+			Concurrency:       rca.parallelTransfers,
+			MaxTotalBytes:     rca.maxTotalBytes,
+			SASRefreshCommand: rca.sasRefreshCommand,
+			TransferOrder:     transferOrder,
 		},
 		&resumeJobResponse)
 
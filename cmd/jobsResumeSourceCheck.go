@@ -0,0 +1,215 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// maxReportedSourceChanges is how many of the changed sources are named when a resume is refused; the rest are only counted
+const maxReportedSourceChanges = 10
+
+// resumeSourceChange is the source of one of a job's transfers that is no longer what the job's plan says it was
+type resumeSourceChange struct {
+	source string
+	reason string
+	// the place of the source in the order in which the check found it
+	index int
+}
+
+// sourceCheck re-reads the properties of the sources of a job that is about to be resumed
+type sourceCheck struct {
+	fromTo    common.FromTo
+	sourceSAS string
+	// how to authenticate to a remote source
+	credentialInfo common.CredentialInfo
+	// how many of the job's files to check, picked at random. 0 checks them all
+	sampleSize int
+	failedOnly bool
+}
+
+// walkJobTransfers streams the transfers of a job from its plan files. Tests replace it
+var walkJobTransfers = func(jobID common.JobID, ofStatus common.TransferStatus, visit func(common.TransferDetail) error) error {
+	return ste.JobsAdmin.WalkJobTransfers(jobID, ofStatus, visit)
+}
+
+// sourceToCheck is a transfer whose source is to be checked, with its place in the order in which the check found it
+type sourceToCheck struct {
+	index  int
+	detail common.TransferDetail
+}
+
+// run checks the size and last modified time of the sources of the job's files that resuming it may transfer against the job's plan.
+// It returns the sources that have changed since the job was created, and how many were checked.
+// Files that were already transferred, or skipped, are not checked, since they are not transferred again.
+// The transfers are streamed from the plan, and a sample is kept as they go by, so memory use doesn't grow with the size of the job.
+// Up to enumerationParallelism sources are checked at once, over one pipeline.
+func (s sourceCheck) run(ctx context.Context, jobID common.JobID) (changes []resumeSourceChange, checked int, err error) {
+	ofStatus := common.ETransferStatus.All()
+	if s.failedOnly {
+		ofStatus = common.ETransferStatus.Failed()
+	}
+	p, err := initPipeline(ctx, s.fromTo.From(), s.credentialInfo)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	toCheck := make(chan sourceToCheck)
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < enumerationParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range toCheck {
+				if change := s.checkSource(ctx, p, file.detail); change != nil {
+					change.index = file.index
+					mu.Lock()
+					changes = append(changes, *change)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// without a sample size, every file is checked as it is found. With one, a uniform sample is kept by reservoir sampling
+	var sample []common.TransferDetail
+	files := 0
+	walkErr := walkJobTransfers(jobID, ofStatus, func(detail common.TransferDetail) error {
+		if detail.IsFolderProperties || detail.TransferStatus == common.ETransferStatus.Success() || detail.TransferStatus.WasSkipped() {
+			return nil
+		}
+		switch {
+		case s.sampleSize <= 0:
+			toCheck <- sourceToCheck{files, detail}
+		case files < s.sampleSize:
+			sample = append(sample, detail)
+		default:
+			if j := rand.Intn(files + 1); j < s.sampleSize {
+				sample[j] = detail
+			}
+		}
+		files++
+		return nil
+	})
+	if walkErr == nil {
+		for i, detail := range sample {
+			toCheck <- sourceToCheck{i, detail}
+		}
+	}
+	close(toCheck)
+	wg.Wait()
+	if walkErr != nil {
+		return nil, 0, fmt.Errorf("cannot list the transfers of job %s: %w", jobID, walkErr)
+	}
+	checked = files
+	if sample != nil {
+		checked = len(sample)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].index < changes[j].index })
+	return changes, checked, nil
+}
+
+// checkSource returns how the given source of the job has changed since the job was created, or nil if it hasn't
+func (s sourceCheck) checkSource(ctx context.Context, p pipeline.Pipeline, file common.TransferDetail) *resumeSourceChange {
+	modifiedTime, size, err := s.statSource(ctx, p, file.Src)
+	switch {
+	case err != nil:
+		return &resumeSourceChange{source: file.Src, reason: fmt.Sprintf("it can no longer be read (%v)", err)}
+	case size != file.SourceSize:
+		return &resumeSourceChange{source: file.Src, reason: fmt.Sprintf("its size is now %d bytes, rather than %d", size, file.SourceSize)}
+	case !file.SourceModifiedTime.IsZero() && !modifiedTime.Equal(file.SourceModifiedTime):
+		return &resumeSourceChange{source: file.Src, reason: fmt.Sprintf("it was modified at %s, after the job was created", modifiedTime.UTC().Format(time.RFC3339))}
+	}
+	return nil
+}
+
+// statSource returns the last modified time and the size of the given source of the job.
+// Remote sources are read over p, which is shared by all of them, where their location has pipelines.
+func (s sourceCheck) statSource(ctx context.Context, p pipeline.Pipeline, source string) (modifiedTime time.Time, size int64, err error) {
+	location := s.fromTo.From()
+	if location == common.ELocation.Local() {
+		info, err := common.OSStat(source)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		return info.ModTime(), info.Size(), nil
+	}
+
+	resource, err := SplitResourceString(source, location)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	resource.SAS = s.sourceSAS
+	resourceURL, err := resource.FullURL()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	var traverser resourceTraverser
+	switch location {
+	case common.ELocation.Blob():
+		traverser = newBlobTraverser(resourceURL, p, ctx, false, false, nil, blobTraverserOptions{})
+	case common.ELocation.File():
+		traverser = newFileTraverser(resourceURL, p, ctx, false, true, nil)
+	case common.ELocation.BlobFS():
+		traverser = newBlobFSTraverser(resourceURL, p, ctx, false, nil)
+	default:
+		// S3 has no pipeline, so its traverser makes its own client
+		if traverser, err = initResourceTraverser(resource, location, &ctx, &s.credentialInfo, nil, nil, false, true, false, func(common.EntityType) {}, nil, blobTraverserOptions{}); err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+	found := false
+	err = traverser.traverse(noPreProccessor, func(object storedObject) error {
+		modifiedTime, size, found = object.lastModifiedTime, object.size, true
+		return nil
+	}, nil)
+	if err == nil && !found {
+		err = fmt.Errorf("%s was not found", source)
+	}
+	return modifiedTime, size, err
+}
+
+// describeSourceChanges summarizes the changed sources found by a sourceCheck, naming the first few of them
+func describeSourceChanges(changes []resumeSourceChange, checked int) string {
+	var reasons []string
+	for _, change := range changes {
+		if len(reasons) == maxReportedSourceChanges {
+			reasons = append(reasons, fmt.Sprintf("and %d more", len(changes)-maxReportedSourceChanges))
+			break
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", change.source, change.reason))
+	}
+	return fmt.Sprintf("%d of the %d sources that were checked have changed since the job was created: %s",
+		len(changes), checked, strings.Join(reasons, "; "))
+}
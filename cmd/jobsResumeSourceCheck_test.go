@@ -0,0 +1,207 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type resumeSourceCheckTestSuite struct{}
+
+var _ = chk.Suite(&resumeSourceCheckTestSuite{})
+
+// planSourceFiles creates the given files, and returns the details that the plan of a job that was created just then holds of them
+func planSourceFiles(c *chk.C, dir string, names ...string) []common.TransferDetail {
+	var details []common.TransferDetail
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, []byte("original content"), 0644), chk.IsNil)
+		info, err := os.Stat(path)
+		c.Assert(err, chk.IsNil)
+		details = append(details, common.TransferDetail{Src: path, SourceSize: info.Size(), SourceModifiedTime: info.ModTime()})
+	}
+	return details
+}
+
+// mockJobTransfers replaces walkJobTransfers with one that streams the given transfers for any job, until the returned func is called
+func mockJobTransfers(details []common.TransferDetail) (restore func()) {
+	originalWalk := walkJobTransfers
+	walkJobTransfers = func(jobID common.JobID, ofStatus common.TransferStatus, visit func(common.TransferDetail) error) error {
+		for _, detail := range details {
+			if err := visit(detail); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return func() { walkJobTransfers = originalWalk }
+}
+
+func (s *resumeSourceCheckTestSuite) TestChangedSourcesAreFlagged(c *chk.C) {
+	dir := c.MkDir()
+	details := planSourceFiles(c, dir, "same.txt", "resized.txt", "touched.txt", "deleted.txt", "done.txt")
+	details[4].TransferStatus = common.ETransferStatus.Success()
+	details = append(details, common.TransferDetail{Src: dir, IsFolderProperties: true})
+	defer mockJobTransfers(details)()
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "resized.txt"), []byte("new content"), 0644), chk.IsNil)
+	later := time.Now().Add(time.Hour)
+	c.Assert(os.Chtimes(filepath.Join(dir, "touched.txt"), later, later), chk.IsNil)
+	c.Assert(os.Remove(filepath.Join(dir, "deleted.txt")), chk.IsNil)
+	// a file that was already transferred is not transferred again, so it doesn't matter that it changed
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "done.txt"), []byte("new content"), 0644), chk.IsNil)
+
+	check := sourceCheck{fromTo: common.EFromTo.LocalBlob()}
+	changes, checked, err := check.run(context.Background(), common.NewJobID())
+	c.Assert(err, chk.IsNil)
+	c.Assert(checked, chk.Equals, 4)
+	c.Assert(changes, chk.HasLen, 3)
+	c.Assert(changes[0].source, chk.Equals, filepath.Join(dir, "resized.txt"))
+	c.Assert(changes[0].reason, chk.Equals, "its size is now 11 bytes, rather than 16")
+	c.Assert(changes[1].source, chk.Equals, filepath.Join(dir, "touched.txt"))
+	c.Assert(changes[1].reason, chk.Matches, "it was modified at .*, after the job was created")
+	c.Assert(changes[2].source, chk.Equals, filepath.Join(dir, "deleted.txt"))
+	c.Assert(changes[2].reason, chk.Matches, "it can no longer be read .*")
+
+	// only a sample of the files is checked, if asked
+	check.sampleSize = 2
+	_, checked, err = check.run(context.Background(), common.NewJobID())
+	c.Assert(err, chk.IsNil)
+	c.Assert(checked, chk.Equals, 2)
+}
+
+func (s *resumeSourceCheckTestSuite) TestSampleIsDrawnFromTheWholeJob(c *chk.C) {
+	dir := c.MkDir()
+	var details []common.TransferDetail
+	for i := 0; i < 100; i++ {
+		// none of them exist, so each one that is checked is reported
+		details = append(details, common.TransferDetail{Src: filepath.Join(dir, fmt.Sprintf("%d", i))})
+	}
+	defer mockJobTransfers(details)()
+
+	check := sourceCheck{fromTo: common.EFromTo.LocalBlob(), sampleSize: 10}
+	everPicked := map[string]bool{}
+	for run := 0; run < 20; run++ {
+		changes, checked, err := check.run(context.Background(), common.NewJobID())
+		c.Assert(err, chk.IsNil)
+		c.Assert(checked, chk.Equals, 10)
+		c.Assert(changes, chk.HasLen, 10)
+		picked := map[string]bool{}
+		for _, change := range changes {
+			picked[change.source] = true
+			everPicked[change.source] = true
+		}
+		c.Assert(picked, chk.HasLen, 10) // no file is picked twice
+	}
+	// the samples differ, and aren't just the first files of the job. 20 uniform samples miss about 12 of the 100 files
+	c.Assert(len(everPicked) > 50, chk.Equals, true)
+}
+
+func (s *resumeSourceCheckTestSuite) TestRemoteSourcesAreCheckedConcurrently(c *chk.C) {
+	originalParallelism := enumerationParallelism
+	enumerationParallelism = 4
+	defer func() { enumerationParallelism = originalParallelism }()
+
+	modified := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	mu := &sync.Mutex{}
+	inFlight, maxInFlight, requests := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		requests++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", "16")
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var details []common.TransferDetail
+	for i := 0; i < 20; i++ {
+		details = append(details, common.TransferDetail{Src: fmt.Sprintf("%s/account/container/%d", server.URL, i), SourceSize: 16, SourceModifiedTime: modified})
+	}
+	details[7].SourceSize = 10
+	defer mockJobTransfers(details)()
+
+	check := sourceCheck{fromTo: common.EFromTo.BlobLocal(), credentialInfo: common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}}
+	changes, checked, err := check.run(context.Background(), common.NewJobID())
+	c.Assert(err, chk.IsNil)
+	c.Assert(checked, chk.Equals, 20)
+	c.Assert(changes, chk.HasLen, 1)
+	c.Assert(changes[0].source, chk.Equals, details[7].Src)
+	c.Assert(requests, chk.Equals, 20)
+	c.Assert(maxInFlight > 1, chk.Equals, true)
+	c.Assert(maxInFlight <= 4, chk.Equals, true)
+}
+
+func (s *resumeSourceCheckTestSuite) TestResumeIsRefusedUnlessForced(c *chk.C) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	dir := c.MkDir()
+	defer mockJobTransfers(planSourceFiles(c, dir, "a.txt", "b.txt"))()
+	jobID := common.NewJobID()
+	check := sourceCheck{fromTo: common.EFromTo.LocalBlob()}
+
+	// an unchanged source is fine
+	c.Assert(resumeCmdArgs{}.verifySourceUnchanged(context.Background(), jobID, check), chk.IsNil)
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "None of the 2 sources that were checked have changed since job "+jobID.String()+" was created.")
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "b.txt"), nil, 0644), chk.IsNil)
+	err := resumeCmdArgs{}.verifySourceUnchanged(context.Background(), jobID, check)
+	c.Assert(err, chk.ErrorMatches, "cannot resume job .*, since 1 of the 2 sources that were checked have changed since the job was created: "+
+		".*b.txt: its size is now 0 bytes, rather than 16. Resume it with --force if that is expected")
+
+	// unless it is forced, which only warns
+	c.Assert(resumeCmdArgs{force: true}.verifySourceUnchanged(context.Background(), jobID, check), chk.IsNil)
+	c.Assert(<-mockedLcm.infoLog, chk.Matches, "WARNING: 1 of the 2 sources .* The job is resumed anyway, since --force was given.")
+}
+
+func (s *resumeSourceCheckTestSuite) TestDescribeSourceChangesNamesTheFirstFew(c *chk.C) {
+	var changes []resumeSourceChange
+	for i := 0; i < maxReportedSourceChanges+3; i++ {
+		changes = append(changes, resumeSourceChange{source: "f", reason: "r"})
+	}
+	description := describeSourceChanges(changes, 20)
+	c.Assert(description, chk.Matches, "13 of the 20 sources that were checked have changed since the job was created: (f: r; ){10}and 3 more")
+}
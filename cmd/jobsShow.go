@@ -21,19 +21,23 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
-
-	"encoding/json"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 	"github.com/spf13/cobra"
 )
 
 type ListReq struct {
 	JobID    common.JobID
 	OfStatus string
+	// stream the job's progress until it is done, polling every FollowInterval seconds
+	Follow         bool
+	FollowInterval uint32
 }
 
 func init() {
@@ -57,6 +61,16 @@ func init() {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			if commandLineInput.Follow {
+				err := HandleFollowCommand(commandLineInput)
+				if err == nil {
+					glcm.Exit(nil, common.EExitCode.Success())
+				} else {
+					glcm.Error(err.Error())
+				}
+				return
+			}
+
 			listRequest := common.ListRequest{}
 			listRequest.JobID = commandLineInput.JobID
 			listRequest.OfStatus = commandLineInput.OfStatus
@@ -73,7 +87,63 @@ func init() {
 	jobsCmd.AddCommand(shJob)
 
 	// filters
-	shJob.PersistentFlags().StringVar(&commandLineInput.OfStatus, "with-status", "", "Only list the transfers of job with this status, available values: Started, Success, Failed.")
+	shJob.PersistentFlags().StringVar(&commandLineInput.OfStatus, "with-status", "", "Only list the transfers of job with this status, available values: Started, Stalled, Success, Failed.")
+	shJob.PersistentFlags().BoolVar(&commandLineInput.Follow, "follow", false, "Keep showing the progress of the job, and the transfers whose status changes, until the job is done. The job may be running in another AzCopy process.")
+	shJob.PersistentFlags().Uint32Var(&commandLineInput.FollowInterval, "follow-interval", 2, "How often, in seconds, to check the progress of the job when --follow is set.")
+}
+
+// HandleFollowCommand shows the progress of the job as it changes, until the job is done
+func HandleFollowCommand(listRequest ListReq) error {
+	if listRequest.OfStatus != "" {
+		return errors.New("the with-status flag can't be used together with the follow flag")
+	}
+	if listRequest.FollowInterval == 0 {
+		return errors.New("follow-interval must be at least one second")
+	}
+
+	interval := time.Duration(listRequest.FollowInterval) * time.Second
+	return ste.FollowJobProgress(context.Background(), listRequest.JobID, interval, func(update common.JobProgressUpdate) {
+		// in text, the changed transfers float up above the progress line; in JSON, they are part of the update
+		if azcopyOutputFormat == common.EOutputFormat.Text() {
+			for _, t := range update.ChangedTransfers {
+				glcm.Info(fmt.Sprintf("transfer--> source: %s destination: %s status %s", t.Src, t.Dst, t.TransferStatus.String()))
+			}
+		}
+		glcm.Progress(func(format common.OutputFormat) string {
+			if format == common.EOutputFormat.Json() {
+				return common.GetJsonStringFromTemplate(getJobProgressUpdateJsonTemplate(update))
+			}
+			return fmt.Sprintf("Job %s: %v, %v of %v transfers done (%v completed, %v failed, %v skipped), %v of %v bytes done (%.1f%%), %v bytes transferred (+%v)",
+				update.JobID.String(),
+				update.JobStatus,
+				update.TransfersCompleted+update.TransfersFailed+update.TransfersSkipped,
+				update.TotalTransfers,
+				update.TransfersCompleted,
+				update.TransfersFailed,
+				update.TransfersSkipped,
+				update.BytesCompleted,
+				update.TotalBytesPlanned,
+				update.BytesPercentComplete,
+				update.BytesTransferred,
+				update.BytesTransferredDelta)
+		})
+	})
+}
+
+func getJobProgressUpdateJsonTemplate(update common.JobProgressUpdate) common.JobProgressUpdateJsonTemplate {
+	template := common.JobProgressUpdateJsonTemplate{
+		SchemaVersion:     common.JsonOutputSchemaVersion,
+		JobProgressUpdate: update,
+		JobStatusCode:     common.NewJobStatusCodeJsonTemplate(update.JobStatus),
+		ChangedTransfers:  make([]common.TransferDetailJsonTemplate, 0, len(update.ChangedTransfers)),
+	}
+	for _, t := range update.ChangedTransfers {
+		template.ChangedTransfers = append(template.ChangedTransfers, common.TransferDetailJsonTemplate{
+			TransferDetail:     t,
+			TransferStatusCode: common.NewTransferStatusCodeJsonTemplate(t.TransferStatus),
+		})
+	}
+	return template
 }
 
 // handles the list command
@@ -86,48 +156,76 @@ func HandleShowCommand(listRequest common.ListRequest) error {
 		Rpc(rpcCmd, &listRequest.JobID, &resp)
 		PrintJobProgressSummary(resp)
 	} else {
-		lsRequest := common.ListJobTransfersRequest{}
-		lsRequest.JobID = listRequest.JobID
+		var ofStatus common.TransferStatus
 		// Parse the given expected Transfer Status
 		// If there is an error parsing, then kill return the error
-		err := lsRequest.OfStatus.Parse(listRequest.OfStatus)
+		err := ofStatus.Parse(listRequest.OfStatus)
 		if err != nil {
 			return fmt.Errorf("cannot parse the given Transfer Status %s", listRequest.OfStatus)
 		}
-		resp := common.ListJobTransfersResponse{}
-		rpcCmd = common.ERpcCmd.ListJobTransfers()
-		Rpc(rpcCmd, lsRequest, &resp)
-		PrintJobTransfers(resp)
+		return showJobTransfers(listRequest.JobID, ofStatus)
 	}
 	return nil
 }
 
-// PrintJobTransfers prints the response of listOrder command when list Order command requested the list of specific transfer of an existing job
-func PrintJobTransfers(listTransfersResponse common.ListJobTransfersResponse) {
-	if listTransfersResponse.ErrorMsg != "" {
-		glcm.Error("request failed with following message " + listTransfersResponse.ErrorMsg)
-	}
-
-	glcm.Exit(func(format common.OutputFormat) string {
-		if format == common.EOutputFormat.Json() {
-			jsonOutput, err := json.Marshal(listTransfersResponse)
-			common.PanicIfErr(err)
-			return string(jsonOutput)
+// showJobTransfers lists the transfers of an existing job that have the given status, streaming them from the job's plan files.
+// In text, each transfer is printed as it is read, so a large job is never held in memory; in JSON, they form one document.
+func showJobTransfers(jobID common.JobID, ofStatus common.TransferStatus) error {
+	if azcopyOutputFormat == common.EOutputFormat.Json() {
+		template := common.ListJobTransfersJsonTemplate{
+			SchemaVersion: common.JsonOutputSchemaVersion,
+			JobID:         jobID,
+			Details:       []common.TransferDetailJsonTemplate{},
 		}
-
-		var sb strings.Builder
-		sb.WriteString("----------- Transfers for JobId " + listTransfersResponse.JobID.String() + " -----------\n")
-		for index := 0; index < len(listTransfersResponse.Details); index++ {
-			folderChar := ""
-			if listTransfersResponse.Details[index].IsFolderProperties {
-				folderChar = "/"
-			}
-			sb.WriteString("transfer--> source: " + listTransfersResponse.Details[index].Src + folderChar + " destination: " +
-				listTransfersResponse.Details[index].Dst + folderChar + " status " + listTransfersResponse.Details[index].TransferStatus.String() + "\n")
+		err := walkJobTransfers(jobID, ofStatus, func(detail common.TransferDetail) error {
+			template.Details = append(template.Details, common.TransferDetailJsonTemplate{
+				TransferDetail:     detail,
+				TransferStatusCode: common.NewTransferStatusCodeJsonTemplate(detail.TransferStatus),
+			})
+			return nil
+		})
+		if err != nil {
+			return errors.New("request failed with following message " + err.Error())
 		}
+		glcm.Exit(func(format common.OutputFormat) string {
+			return common.GetJsonStringFromTemplate(template)
+		}, common.EExitCode.Success())
+		return nil
+	}
 
-		return sb.String()
-	}, common.EExitCode.Success())
+	glcm.Info("----------- Transfers for JobId " + jobID.String() + " -----------")
+	err := walkJobTransfers(jobID, ofStatus, func(detail common.TransferDetail) error {
+		glcm.Info(getTransferDetailText(detail))
+		return nil
+	})
+	if err != nil {
+		return errors.New("request failed with following message " + err.Error())
+	}
+	return nil
+}
+
+// getTransferDetailText describes one transfer, on one line, for the text output of the show command
+func getTransferDetailText(detail common.TransferDetail) string {
+	folderChar := ""
+	if detail.IsFolderProperties {
+		folderChar = "/"
+	}
+	var sb strings.Builder
+	sb.WriteString("transfer--> source: " + detail.Src + folderChar + " destination: " +
+		detail.Dst + folderChar + " status " + detail.TransferStatus.String())
+	if !detail.IsFolderProperties {
+		sb.WriteString(fmt.Sprintf(" size %v", detail.SourceSize))
+	}
+	if detail.DurationMilliseconds > 0 {
+		sb.WriteString(fmt.Sprintf(" duration %vms", detail.DurationMilliseconds))
+	}
+	if detail.DestVersionID != "" {
+		sb.WriteString(" version " + detail.DestVersionID)
+	}
+	if detail.ErrorMessage != "" {
+		sb.WriteString(" error: " + detail.ErrorMessage)
+	}
+	return sb.String()
 }
 
 // PrintJobProgressSummary prints the response of listOrder command when listOrder command requested the progress summary of an existing job
@@ -141,13 +239,22 @@ func PrintJobProgressSummary(summary common.ListJobSummaryResponse) {
 
 	glcm.Exit(func(format common.OutputFormat) string {
 		if format == common.EOutputFormat.Json() {
-			jsonOutput, err := json.Marshal(summary) // see note below re % complete being approximate. We can't include "approx" in the JSON.
-			common.PanicIfErr(err)
-			return string(jsonOutput)
+			// see note below re % complete being approximate. We can't include "approx" in the JSON.
+			return common.GetJsonStringFromTemplate(common.JobSummaryJsonTemplate{
+				SchemaVersion:          common.JsonOutputSchemaVersion,
+				ListJobSummaryResponse: summary,
+				JobStatusCode:          common.NewJobStatusCodeJsonTemplate(summary.JobStatus),
+				ThroughputMBps:         averageThroughputMBps(summary.CumulativeBytesTransferred, summary.CumulativeElapsedSeconds),
+			})
+		}
+
+		throughput := "n/a (no run of the job has ended yet)"
+		if summary.CumulativeElapsedSeconds > 0 {
+			throughput = fmt.Sprintf("%.2f", averageThroughputMBps(summary.CumulativeBytesTransferred, summary.CumulativeElapsedSeconds))
 		}
 
 		return fmt.Sprintf(
-			"\nJob %s summary\nNumber of File Transfers: %v\nNumber of Folder Property Transfers: %v\nTotal Number Of Transfers: %v\nNumber of Transfers Completed: %v\nNumber of Transfers Failed: %v\nNumber of Transfers Skipped: %v\nPercent Complete (approx): %.1f\nFinal Job Status: %v\n",
+			"\nJob %s summary\nNumber of File Transfers: %v\nNumber of Folder Property Transfers: %v\nTotal Number Of Transfers: %v\nNumber of Transfers Completed: %v\nNumber of Transfers Failed: %v\nNumber of Transfers Skipped: %v\nNumber of Transfers Stalled: %v\nNumber of Transfer Retries: %v\nAverage Transfer Duration (Milliseconds): %v\nTotal Bytes Transferred (all runs): %v\nElapsed Time (Minutes, all runs): %v\nAverage Throughput (MB/s): %s\nPercent Complete (approx): %.1f\nBytes Completed: %v of %v (%.1f%%)\nFinal Job Status: %v%s\n",
 			summary.JobID.String(),
 			summary.FileTransfers,
 			summary.FolderPropertyTransfers,
@@ -155,8 +262,43 @@ func PrintJobProgressSummary(summary common.ListJobSummaryResponse) {
 			summary.TransfersCompleted,
 			summary.TransfersFailed,
 			summary.TransfersSkipped,
+			summary.TransfersStalled,
+			summary.TransferRetries,
+			summary.AverageTransferMilliseconds,
+			summary.CumulativeBytesTransferred,
+			ste.ToFixed(summary.CumulativeElapsedSeconds/60, 4),
+			throughput,
 			summary.PercentComplete, // noted as approx in the format string because won't include in-flight files if this Show command is run from a different process
-			summary.JobStatus,
+			summary.BytesCompleted,
+			summary.TotalBytesPlanned,
+			summary.BytesPercentComplete,
+			formatJobStatus(summary.JobStatus, summary.CancelReason),
+			formatTransferTimings(summary),
 		)
 	}, common.EExitCode.Success())
 }
+
+// averageThroughputMBps returns the throughput, in MB/s, of moving the given bytes in the given time. It is zero if no time has elapsed.
+func averageThroughputMBps(bytesTransferred uint64, elapsedSeconds float64) float64 {
+	if elapsedSeconds <= 0 {
+		return 0
+	}
+	return float64(bytesTransferred) / elapsedSeconds / base10Mega
+}
+
+// formatTransferTimings describes the spread of the throughputs of the job's transfers, and lists the slowest of them.
+// Each line starts with a newline, and it is empty if no transfer has been timed.
+func formatTransferTimings(summary common.ListJobSummaryResponse) string {
+	var sb strings.Builder
+	if t := summary.TransferThroughput; t.TimedTransfers > 0 {
+		sb.WriteString(fmt.Sprintf("\nTransfer Throughput (MB/s, approx, over %v transfers): p50 %.2f, p90 %.2f, p99 %.2f",
+			t.TimedTransfers, t.P50MBps, t.P90MBps, t.P99MBps))
+	}
+	if len(summary.SlowestTransfers) > 0 {
+		sb.WriteString("\nSlowest Transfers:")
+		for _, t := range summary.SlowestTransfers {
+			sb.WriteString(fmt.Sprintf("\n  %vms %s -> %s", t.DurationMilliseconds, t.Src, t.Dst))
+		}
+	}
+	return sb.String()
+}
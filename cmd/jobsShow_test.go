@@ -0,0 +1,107 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type jobsShowTestSuite struct{}
+
+var _ = chk.Suite(&jobsShowTestSuite{})
+
+func (s *jobsShowTestSuite) TestFollowRejectsBadFlags(c *chk.C) {
+	c.Assert(HandleFollowCommand(ListReq{JobID: common.NewJobID(), Follow: true, FollowInterval: 2, OfStatus: "Failed"}), chk.NotNil)
+	c.Assert(HandleFollowCommand(ListReq{JobID: common.NewJobID(), Follow: true, FollowInterval: 0}), chk.NotNil)
+}
+
+func (s *jobsShowTestSuite) TestJobProgressUpdateJsonOutput(c *chk.C) {
+	update := common.JobProgressUpdate{
+		JobID:                 common.NewJobID(),
+		JobStatus:             common.EJobStatus.InProgress(),
+		TotalTransfers:        2,
+		TransfersCompleted:    1,
+		BytesTransferred:      300,
+		BytesTransferredDelta: 100,
+		ChangedTransfers:      []common.TransferDetail{{Src: "src", Dst: "dst", TransferStatus: common.ETransferStatus.Success()}},
+	}
+
+	// act
+	var output map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(common.GetJsonStringFromTemplate(getJobProgressUpdateJsonTemplate(update))), &output), chk.IsNil)
+
+	// verify
+	c.Assert(output["SchemaVersion"], chk.Equals, float64(common.JsonOutputSchemaVersion))
+	c.Assert(output["JobStatusCode"], chk.DeepEquals, map[string]interface{}{"Code": float64(0), "Name": "InProgress"})
+	c.Assert(output["BytesTransferredDelta"], chk.Equals, "100")
+	transfers := output["ChangedTransfers"].([]interface{})
+	c.Assert(transfers, chk.HasLen, 1)
+	transfer := transfers[0].(map[string]interface{})
+	c.Assert(transfer["Src"], chk.Equals, "src")
+	c.Assert(transfer["TransferStatus"], chk.Equals, "Success")
+	c.Assert(transfer["TransferStatusCode"], chk.DeepEquals, map[string]interface{}{"Code": float64(2), "Name": "Success"})
+}
+
+func (s *jobsShowTestSuite) TestTransfersAreStreamedInText(c *chk.C) {
+	details := []common.TransferDetail{
+		{Src: "/src/a", Dst: "https://dst/a", TransferStatus: common.ETransferStatus.Failed(), SourceSize: 5, ErrorMessage: "boom"},
+		{Src: "/src/dir", Dst: "https://dst/dir", TransferStatus: common.ETransferStatus.Failed(), IsFolderProperties: true},
+	}
+	defer mockJobTransfers(details)()
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10), exitLog: make(chan string, 1)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+	jobID := common.NewJobID()
+
+	// act
+	c.Assert(showJobTransfers(jobID, common.ETransferStatus.Failed()), chk.IsNil)
+
+	// verify: one line for the header, then one for each transfer, as it is read
+	c.Assert(mockedLcm.infoLog, chk.HasLen, 3)
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "----------- Transfers for JobId "+jobID.String()+" -----------")
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "transfer--> source: /src/a destination: https://dst/a status Failed size 5 error: boom")
+	c.Assert(<-mockedLcm.infoLog, chk.Equals, "transfer--> source: /src/dir/ destination: https://dst/dir/ status Failed")
+	c.Assert(mockedLcm.exitLog, chk.HasLen, 0)
+}
+
+func (s *jobsShowTestSuite) TestTransfersAreOneJsonDocument(c *chk.C) {
+	defer mockJobTransfers([]common.TransferDetail{{Src: "a", Dst: "b", TransferStatus: common.ETransferStatus.Success()}})()
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 10), exitLog: make(chan string, 1)}
+	originalLcm, originalFormat := glcm, azcopyOutputFormat
+	glcm, azcopyOutputFormat = mockedLcm, common.EOutputFormat.Json()
+	defer func() { glcm, azcopyOutputFormat = originalLcm, originalFormat }()
+	jobID := common.NewJobID()
+
+	// act
+	c.Assert(showJobTransfers(jobID, common.ETransferStatus.Success()), chk.IsNil)
+
+	// verify
+	c.Assert(mockedLcm.infoLog, chk.HasLen, 0)
+	var output common.ListJobTransfersResponse
+	c.Assert(json.Unmarshal([]byte(<-mockedLcm.exitLog), &output), chk.IsNil)
+	c.Assert(output.JobID, chk.Equals, jobID)
+	c.Assert(output.Details, chk.DeepEquals, []common.TransferDetail{{Src: "a", Dst: "b", TransferStatus: common.ETransferStatus.Success()}})
+}
@@ -252,6 +252,8 @@ func init() {
 	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
 		if cmd.Name() == loadCmd.Name() || (cmd.Parent() != nil && cmd.Parent().Name() == loadCmd.Name()) {
 			cmd.Flags().MarkHidden("cap-mbps")
+			cmd.Flags().MarkHidden("cap-upload-mbps")
+			cmd.Flags().MarkHidden("cap-download-mbps")
 			cmd.Flags().MarkHidden("trusted-microsoft-suffixes")
 		}
 		originalHelp(cmd, args)
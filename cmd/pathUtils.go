@@ -295,6 +295,21 @@ func splitQueryFromSaslessResource(resource string, loc common.Location) (mainUr
 	}
 }
 
+// versionIDFromQuery returns the blob version ID in the given query string (e.g. a ResourceString's ExtraQuery), or "" if there is none.
+// Like the service, it doesn't care about the case of the parameter name.
+func versionIDFromQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ""
+	}
+	for name, value := range values {
+		if strings.EqualFold(name, "versionId") && len(value) > 0 {
+			return value[0]
+		}
+	}
+	return ""
+}
+
 // All of the below functions only really do one thing at the moment.
 // They've been separated from copyEnumeratorInit.go in order to make the code more maintainable, should we want more destinations in the future.
 func getPathBeforeFirstWildcard(path string) string {
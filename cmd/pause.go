@@ -21,7 +21,9 @@
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/spf13/cobra"
@@ -37,7 +39,7 @@ func init() {
 		Use:        "pause",
 		SuggestFor: []string{"pase", "ause", "paue"},
 		Short:      "Pause the existing job with the given Job Id",
-		Long:       `Pause the existing job with the given Job Id`,
+		Long:       `Pause the existing job with the given Job Id. No more of its transfers are started, and those in flight are stopped, keeping what they have already saved so that they can carry on from there. The job stays paused, even if AzCopy is restarted, until it is resumed with 'azcopy jobs resume'.`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			// the pause command requires necessarily to have an argument
 			// pause jobId -- pause all the parts of an existing job for given jobId
@@ -73,7 +75,36 @@ func HandlePauseCommand(jobIdString string) {
 
 	var pauseJobResponse common.CancelPauseResumeResponse
 	Rpc(common.ERpcCmd.PauseJob(), jobID, &pauseJobResponse)
+	if !pauseJobResponse.CancelledPauseResumed {
+		glcm.Error(pauseJobResponse.ErrorMsg)
+	}
 	glcm.Exit(func(format common.OutputFormat) string {
-		return "Job " + jobID.String() + " paused successfully"
+		return "Job " + jobID.String() + " paused successfully. Its transfers in flight will stop, and they and the rest will wait until the job is resumed with 'azcopy jobs resume'"
 	}, common.EExitCode.Success())
 }
+
+// pauseJob pauses a job that is running in this process. If it can't be, e.g. because it has just finished, it is left to end
+// as it would have.
+func pauseJob(lcm common.LifecycleMgr, jobID common.JobID) {
+	var pauseJobResponse common.CancelPauseResumeResponse
+	Rpc(common.ERpcCmd.PauseJob(), jobID, &pauseJobResponse)
+	if !pauseJobResponse.CancelledPauseResumed {
+		lcm.Info("The job could not be paused: " + pauseJobResponse.ErrorMsg)
+	}
+}
+
+// exitPausedJob exits once a paused job's transfers in flight have stopped, and its plan files are up to date
+func exitPausedJob(lcm common.LifecycleMgr, summary common.ListJobSummaryResponse) {
+	lcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			jsonOutput, err := json.Marshal(summary)
+			common.PanicIfErr(err)
+			return string(jsonOutput)
+		}
+		return fmt.Sprintf("\n\nJob %s paused after %v of %v transfers were done. Resume it with 'azcopy jobs resume %s'.\n",
+			summary.JobID.String(),
+			summary.TransfersCompleted+summary.TransfersFailed+summary.TransfersSkipped,
+			summary.TotalTransfers,
+			summary.JobID.String())
+	}, common.EExitCode.Error())
+}
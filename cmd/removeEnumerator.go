@@ -47,7 +47,7 @@ func newRemoveEnumerator(cca *cookedCopyCmdArgs) (enumerator *copyEnumerator, er
 
 	// Include-path is handled by ListOfFilesChannel.
 	sourceTraverser, err = initResourceTraverser(cca.source, cca.fromTo.From(), &ctx, &cca.credentialInfo, nil,
-		cca.listOfFilesChannel, cca.recursive, false, cca.includeDirectoryStubs, func(common.EntityType) {}, cca.listOfVersionIDs)
+		cca.listOfFilesChannel, cca.recursive, false, cca.includeDirectoryStubs, func(common.EntityType) {}, cca.listOfVersionIDs, blobTraverserOptions{})
 
 	// report failure to create traverser
 	if err != nil {
@@ -71,7 +71,7 @@ func newRemoveEnumerator(cca *cookedCopyCmdArgs) (enumerator *copyEnumerator, er
 		ste.JobsAdmin.LogToJobLog(message, pipeline.LogInfo)
 	}
 
-	transferScheduler := newRemoveTransferProcessor(cca, NumOfFilesPerDispatchJobPart, fpo)
+	transferScheduler := newRemoveTransferProcessor(cca, transfersPerPartOrDefault(cca.transfersPerPart), fpo)
 
 	finalize := func() error {
 		jobInitiated, err := transferScheduler.dispatchFinalPart()
@@ -35,9 +35,13 @@ func newRemoveTransferProcessor(cca *cookedCopyCmdArgs, numOfTransfersPerPart in
 		CredentialInfo:  cca.credentialInfo,
 		ForceIfReadOnly: cca.forceIfReadOnly,
 
+		TTLAfterCompletion: cmdLineJobPlanTTL,
+
 		// flags
 		LogLevel:       cca.logVerbosity,
+		LogFormat:      cca.logFormat,
 		BlobAttributes: common.BlobTransferAttributes{DeleteSnapshotsOption: cca.deleteSnapshotsOption},
+		MaxRetries:     cca.maxRetries,
 	}
 
 	reportFirstPart := func(jobStarted bool) {
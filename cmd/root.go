@@ -25,6 +25,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/Azure/azure-pipeline-go/pipeline"
+	"io/ioutil"
+	"math"
 	"net/url"
 	"os"
 	"runtime"
@@ -46,8 +48,21 @@ var outputFormatRaw string
 var cancelFromStdin bool
 var azcopyOutputFormat common.OutputFormat
 var cmdLineCapMegaBitsPerSecond float64
+var cmdLineCapUploadMegaBitsPerSecond float64
+var cmdLineCapDownloadMegaBitsPerSecond float64
 var azcopyAwaitContinue bool
 var azcopyAwaitAllowOpenFiles bool
+var cmdLineJobPlanTTL time.Duration
+var cmdLineDisableJobPlanCleanup bool
+var cmdLineJobPlanLocation string
+var cmdLineMetricsAddress string
+
+// by default, the plan files of finished jobs are kept until they are removed with 'azcopy jobs clean' or 'azcopy jobs rm',
+// since a job that failed, or completed with errors, can still be resumed
+const defaultJobPlanTTL = time.Duration(0)
+
+// how often a long-running AzCopy looks for finished jobs whose plan files have expired
+const jobPlanCleanupInterval = time.Hour
 
 // It's not pretty that this one is read directly by credential util.
 // But doing otherwise required us passing it around in many places, even though really
@@ -76,6 +91,19 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
+		// the plan file stores the time to live in whole seconds
+		if cmdLineJobPlanTTL < 0 || cmdLineJobPlanTTL/time.Second > math.MaxUint32 {
+			return fmt.Errorf("invalid job-plan-ttl %v, it must be between zero and %v", cmdLineJobPlanTTL, time.Duration(math.MaxUint32)*time.Second)
+		}
+
+		// the flag takes precedence over the environment variable (or the default) that main resolved
+		if cmdLineJobPlanLocation != "" {
+			azcopyJobPlanFolder = cmdLineJobPlanLocation
+		}
+		if err = prepareJobPlanFolder(azcopyJobPlanFolder); err != nil {
+			return err
+		}
+
 		// warn Windows users re quoting (since our docs all use single quotes, but CMD needs double)
 		// Single ones just come through as part of the args, in CMD.
 		// Ideally, for usability, we'd ideally have this info come back in the result of url.Parse. But that's hard to
@@ -102,9 +130,30 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		for direction, mbps := range map[common.TransferDirection]float64{
+			common.ETransferDirection.Upload():   cmdLineCapUploadMegaBitsPerSecond,
+			common.ETransferDirection.Download(): cmdLineCapDownloadMegaBitsPerSecond,
+		} {
+			if mbps < 0 {
+				return fmt.Errorf("the bandwidth cap for %s must not be negative", strings.ToLower(direction.String()))
+			}
+			if mbps > 0 {
+				ste.JobsAdmin.SetDirectionalBandwidthCap(direction, mbps)
+			}
+		}
 		enumerationParallelism = concurrencySettings.EnumerationPoolSize.Value
 		enumerationParallelStatFiles = concurrencySettings.ParallelStatFiles.Value
 
+		if !cmdLineDisableJobPlanCleanup {
+			ste.JobsAdmin.StartJobPlanReaper(jobPlanCleanupInterval)
+		}
+
+		if cmdLineMetricsAddress != "" {
+			if err := ste.JobsAdmin.StartMetricsServer(cmdLineMetricsAddress); err != nil {
+				return err
+			}
+		}
+
 		// Log a clear ISO 8601-formatted start time, so it can be read and use in the --include-after parameter
 		// Subtract a few seconds, to ensure that this date DEFINITELY falls before the LMT of any file changed while this
 		// job is running. I.e. using this later with --include-after is _guaranteed_ to pick up all files that changed during
@@ -130,6 +179,28 @@ var rootCmd = &cobra.Command{
 var glcm = common.GetLifecycleMgr()
 var glcmSwapOnce = &sync.Once{}
 
+// prepareJobPlanFolder creates the job plan folder if need be, and checks that plan files can actually be written there,
+// so that a bad location is reported clearly up front, rather than as a failure part way through creating the first job
+func prepareJobPlanFolder(folder string) error {
+	fail := func(err error) error {
+		return fmt.Errorf("cannot use '%s' as the job plan folder: %v. Use --job-plan-location or %s to choose a folder that AzCopy can write to",
+			folder, err, common.EEnvironmentVariable.JobPlanLocation().Name)
+	}
+
+	if err := os.MkdirAll(folder, os.ModeDir|os.ModePerm); err != nil {
+		return fail(err)
+	}
+	probe, err := ioutil.TempFile(folder, "azcopy-write-check-*.tmp")
+	if err != nil {
+		return fail(err)
+	}
+	_ = probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(azsAppPathFolder, logPathFolder string, jobPlanFolder string, maxFileAndSocketHandles int) {
@@ -158,13 +229,19 @@ func init() {
 	rootCmd.SetUsageTemplate(strings.Replace((&cobra.Command{}).UsageTemplate(), "Global Flags", "Flags Applying to All Commands", -1))
 
 	rootCmd.PersistentFlags().Float64Var(&cmdLineCapMegaBitsPerSecond, "cap-mbps", 0, "Caps the transfer rate, in megabits per second. Moment-by-moment throughput might vary slightly from the cap. If this option is set to zero, or it is omitted, the throughput isn't capped.")
+	rootCmd.PersistentFlags().Float64Var(&cmdLineCapUploadMegaBitsPerSecond, "cap-upload-mbps", 0, "Caps the transfer rate of uploads (from this machine to the service), in megabits per second. It applies in addition to cap-mbps, and doesn't slow down downloads. If this option is set to zero, or it is omitted, uploads are only capped by cap-mbps.")
+	rootCmd.PersistentFlags().Float64Var(&cmdLineCapDownloadMegaBitsPerSecond, "cap-download-mbps", 0, "Caps the transfer rate of downloads (from the service to this machine), in megabits per second. It applies in addition to cap-mbps, and doesn't slow down uploads. If this option is set to zero, or it is omitted, downloads are only capped by cap-mbps.")
 	rootCmd.PersistentFlags().StringVar(&outputFormatRaw, "output-type", "text", "Format of the command's output. The choices include: text, json. The default value is 'text'.")
+	rootCmd.PersistentFlags().DurationVar(&cmdLineJobPlanTTL, "job-plan-ttl", defaultJobPlanTTL, "How long the plan files of a job started by this command are kept once the job has finished, e.g. '72h'. After that, AzCopy deletes them automatically, and the job can no longer be shown or resumed. By default (zero), they are kept until they are removed with 'azcopy jobs clean' or 'azcopy jobs rm'.")
+	rootCmd.PersistentFlags().StringVar(&cmdLineJobPlanLocation, "job-plan-location", "", "Folder where the job plan files (used for progress tracking and resuming) are kept. Overrides the "+common.EEnvironmentVariable.JobPlanLocation().Name+" environment variable. Later commands that act on the job, such as 'azcopy jobs resume', must be given the same location.")
+	rootCmd.PersistentFlags().StringVar(&cmdLineMetricsAddress, "metrics-address", "", "Address, such as 'localhost:9090', on which to serve metrics of the running job (bytes and files transferred, bytes over the wire and concurrency) in the Prometheus text format, at the path /metrics. Throughput is the rate of azcopy_bytes_over_wire_total. The endpoint is off if this is omitted.")
+	rootCmd.PersistentFlags().BoolVar(&cmdLineDisableJobPlanCleanup, "disable-job-plan-cleanup", false, "Prevents this command from deleting the plan files of finished jobs whose job-plan-ttl has passed.")
 
 	rootCmd.PersistentFlags().StringVar(&cmdLineExtraSuffixesAAD, trustedSuffixesNameAAD, "", "Specifies additional domain suffixes where Azure Active Directory login tokens may be sent.  The default is '"+
 		trustedSuffixesAAD+"'. Any listed here are added to the default. For security, you should only put Microsoft Azure domains here. Separate multiple entries with semi-colons.")
 
 	// Note: this is due to Windows not supporting signals properly
-	rootCmd.PersistentFlags().BoolVar(&cancelFromStdin, "cancel-from-stdin", false, "Used by partner teams to send in `cancel` through stdin to stop a job.")
+	rootCmd.PersistentFlags().BoolVar(&cancelFromStdin, "cancel-from-stdin", false, "Used by partner teams to send in `cancel` through stdin to stop a job, or `cap-mbps <value>` to change the bandwidth cap of a running job.")
 
 	// special E2E testing flags
 	rootCmd.PersistentFlags().BoolVar(&azcopyAwaitContinue, "await-continue", false, "Used when debugging, to tell AzCopy to await `continue` on stdin before starting any work. Assists with debugging AzCopy via attach-to-process")
@@ -178,6 +255,17 @@ func init() {
 	rootCmd.PersistentFlags().MarkHidden("await-open")
 }
 
+// setBandwidthCap changes the cap on the throughput of the running job(s), see the cap-mbps flag
+func setBandwidthCap(mbps float64) {
+	var resp common.SetBandwidthCapResponse
+	Rpc(common.ERpcCmd.SetBandwidthCap(), &common.SetBandwidthCapRequest{CapMbps: mbps}, &resp)
+	if resp.ErrorMsg != "" {
+		glcm.Info("Failed to change the bandwidth cap: " + resp.ErrorMsg)
+		return
+	}
+	glcm.Info(fmt.Sprintf("Bandwidth cap changed to %v Mbps", mbps))
+}
+
 // always spins up a new goroutine, because sometimes the aka.ms URL can't be reached (e.g. a constrained environment where
 // aka.ms is not resolvable to a reachable IP address). In such cases, this routine will run for ever, and the caller should
 // just give up on it.
@@ -0,0 +1,72 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// validateSASNotExpired fails if the given SAS token, of the location named by role, has already expired,
+// since every transfer of the job would fail
+func validateSASNotExpired(sas string, role string, now time.Time) error {
+	if expiry, ok := common.SASExpiryTime(sas); ok && !now.Before(expiry) {
+		return fmt.Errorf("the SAS token of the %s expired at %s. Please use a new SAS token", role, expiry.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// sasExpiryWatcher looks out for a job that is set to outlast the earliest of its SAS tokens, whose remaining transfers would then fail
+type sasExpiryWatcher struct {
+	expiry time.Time
+	warned bool
+}
+
+// newSASExpiryWatcher returns a watcher for the given SAS tokens, or nil if none of them expire
+func newSASExpiryWatcher(sasTokens ...string) *sasExpiryWatcher {
+	expiry, ok := common.EarliestSASExpiryTime(sasTokens...)
+	if !ok {
+		return nil
+	}
+	return &sasExpiryWatcher{expiry: expiry}
+}
+
+// check returns a warning the first time that, at the average rate of the job so far, the rest of the job would not be done before
+// the SAS token expires. Until the job has been completely ordered, its total size is not known, so there is no telling.
+func (w *sasExpiryWatcher) check(summary common.ListJobSummaryResponse, elapsed time.Duration, now time.Time) string {
+	if w == nil || w.warned || !summary.CompleteJobOrdered || summary.BytesCompleted >= summary.TotalBytesPlanned || elapsed <= 0 {
+		return ""
+	}
+	bytesPerSecond := float64(summary.TotalBytesTransferred) / elapsed.Seconds()
+	if bytesPerSecond <= 0 {
+		return ""
+	}
+	remaining := time.Duration(float64(summary.TotalBytesPlanned-summary.BytesCompleted) / bytesPerSecond * float64(time.Second))
+	if now.Add(remaining).Before(w.expiry) {
+		return ""
+	}
+	w.warned = true
+	return fmt.Sprintf("The SAS token expires at %s, but at its current rate the job needs about %v more to finish. "+
+		"Any transfers that are not done by then will not be started, and the job can be resumed with a new SAS token.",
+		w.expiry.UTC().Format(time.RFC3339), remaining.Round(time.Minute))
+}
@@ -0,0 +1,149 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+// shareQuotaTracker warns, during the enumeration of a job to Azure Files, once the files it sends add up to more than the free space
+// of the destination share (its quota, less what is already stored in it). It only warns, and the job carries on as usual, since
+// files that overwrite others free up the space of what they replace, and only the destination knows which of them do.
+// It is not safe for concurrent use, which is fine since the processor is called serially.
+type shareQuotaTracker struct {
+	shareName  string
+	quotaBytes int64
+	usedBytes  int64
+	totalBytes int64
+	warn       func(message string)
+	warned     bool
+}
+
+func newShareQuotaTracker(shareName string, quotaGiB int32, usedBytes int64, warn func(message string)) *shareQuotaTracker {
+	return &shareQuotaTracker{shareName: shareName, quotaBytes: int64(quotaGiB) * 1024 * 1024 * 1024, usedBytes: usedBytes, warn: warn}
+}
+
+// add counts a file of the given size, and warns the first time that the files counted so far may not fit in the share.
+// A nil tracker counts nothing, for when the quota is unknown.
+func (t *shareQuotaTracker) add(size int64) {
+	if t == nil {
+		return
+	}
+	t.totalBytes += size
+	if t.totalBytes > t.quotaBytes-t.usedBytes && !t.warned {
+		t.warned = true
+		t.warn(fmt.Sprintf("The files to be transferred add up to more than the %d bytes free in the destination share '%s' "+
+			"(%d GiB quota, of which %d bytes are used). They will still fit if enough of them replace files already in the share, "+
+			"but otherwise the transfers that don't fit will fail once the share is full. Increase the quota of the share to be sure of it",
+			t.quotaBytes-t.usedBytes, t.shareName, t.quotaBytes/(1024*1024*1024), t.usedBytes))
+	}
+}
+
+// remove stops counting a file of the given size, which is no longer to be transferred
+func (t *shareQuotaTracker) remove(size int64) {
+	if t == nil {
+		return
+	}
+	t.totalBytes -= size
+}
+
+// newDstShareQuotaTracker returns a tracker for the quota of the destination share, or nil if the quota can't be read
+// (e.g. because the SAS is only for a directory in the share). In that case the job goes ahead without the check.
+func (cca *cookedCopyCmdArgs) newDstShareQuotaTracker(ctx context.Context, shareName string) *shareQuotaTracker {
+	dstCredInfo, _, err := getCredentialInfoForLocation(ctx, cca.fromTo.To(), cca.destination.Value, cca.destination.SAS, false)
+	if err != nil {
+		return nil
+	}
+	dstPipeline, err := initPipeline(ctx, cca.fromTo.To(), dstCredInfo)
+	if err != nil {
+		return nil
+	}
+	accountRoot, err := GetAccountRoot(cca.destination, cca.fromTo.To())
+	if err != nil {
+		return nil
+	}
+	dstURL, err := url.Parse(accountRoot)
+	if err != nil {
+		return nil
+	}
+
+	shareURL := azfile.NewServiceURL(*dstURL, dstPipeline).NewShareURL(shareName)
+	props, err := shareURL.GetProperties(ctx)
+	var usedBytes int64
+	if err == nil {
+		usedBytes, err = getShareUsageBytes(ctx, shareURL.URL(), dstPipeline)
+	}
+	if err != nil {
+		if ste.JobsAdmin != nil {
+			ste.JobsAdmin.LogToJobLog(fmt.Sprintf("could not read the quota and usage of the destination share, so cannot check in advance that the files will fit in it: %s", err), pipeline.LogWarning)
+		}
+		return nil
+	}
+	return newShareQuotaTracker(shareName, props.Quota(), usedBytes, func(message string) {
+		glcm.Info(message)
+		if ste.JobsAdmin != nil {
+			ste.JobsAdmin.LogToJobLog(message, pipeline.LogWarning)
+		}
+	})
+}
+
+// shareStats is the body of a Get Share Stats response
+type shareStats struct {
+	ShareUsageBytes int64 `xml:"ShareUsageBytes"`
+}
+
+// getShareUsageBytes returns how much is stored in the share, according to its statistics.
+// It doesn't use ShareURL.GetStatistics, which reads the usage into an int32, and so fails for shares holding 2 GiB or more.
+func getShareUsageBytes(ctx context.Context, shareURL url.URL, p pipeline.Pipeline) (int64, error) {
+	q := shareURL.Query()
+	q.Set("restype", "share")
+	q.Set("comp", "stats")
+	shareURL.RawQuery = q.Encode()
+	req, err := pipeline.NewRequest(http.MethodGet, shareURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("x-ms-version", azfile.ServiceVersion)
+
+	resp, err := p.Do(ctx, nil, req)
+	if err != nil {
+		return 0, err
+	}
+	r := resp.Response()
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("could not get the statistics of the share: %s (%s)", r.Status, r.Header.Get("x-ms-error-code"))
+	}
+	var stats shareStats
+	if err := xml.NewDecoder(r.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("could not read the statistics of the share: %w", err)
+	}
+	return stats.ShareUsageBytes, nil
+}
@@ -44,6 +44,7 @@ type rawSyncCmdArgs struct {
 	// options from flags
 	blockSizeMB           float64
 	logVerbosity          string
+	logFormat             string
 	include               string
 	exclude               string
 	excludePath           string
@@ -52,13 +53,25 @@ type rawSyncCmdArgs struct {
 	legacyInclude         string // for warning messages only
 	legacyExclude         string // for warning messages only
 
-	preserveSMBPermissions bool
-	preserveOwner          bool
-	preserveSMBInfo        bool
-	followSymlinks         bool
-	backupMode             bool
-	putMd5                 bool
-	md5ValidationOption    string
+	preserveSMBPermissions  bool
+	preserveOwner           bool
+	preserveSMBInfo         bool
+	preservePOSIXProperties bool
+	followSymlinks          bool
+	backupMode              bool
+	putMd5                  bool
+	md5ValidationOption     string
+	checksumAlgorithm       string
+	skipIfHashMatches       bool
+	parallelTransfers       uint16
+	maxDuration             time.Duration
+	maxRetries              int32
+	retryChangedFiles       bool
+	transfersPerPart        uint32
+	transferOrder           string
+	maxTotalBytes           uint64
+	capMbpsSchedule         string
+	sasRefreshCommand       string
 	// this flag indicates the user agreement with respect to deleting the extra files at the destination
 	// which do not exists at source. With this flag turned on/off, users will not be asked for permission.
 	// otherwise the user is prompted to make a decision
@@ -67,6 +80,10 @@ type rawSyncCmdArgs struct {
 	s2sPreserveAccessTier bool
 
 	forceIfReadOnly bool
+
+	dryrun     bool
+	verifyOnly bool
+	verifyMD5  bool
 }
 
 func (raw *rawSyncCmdArgs) parsePatterns(pattern string) (cookedPatterns []string) {
@@ -123,6 +140,18 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 		return cooked, fmt.Errorf("source '%s' / destination '%s' combination '%s' not supported for sync command ", raw.src, raw.dst, cooked.fromTo)
 	}
 
+	if err = validateSASNotExpired(cooked.source.SAS, "source", time.Now()); err != nil {
+		return cooked, err
+	}
+	if err = validateSASNotExpired(cooked.destination.SAS, "destination", time.Now()); err != nil {
+		return cooked, err
+	}
+	// a job whose tokens are refreshed need not finish before they expire
+	cooked.sasRefreshCommand = raw.sasRefreshCommand
+	if cooked.sasRefreshCommand == "" {
+		cooked.sasExpiry = newSASExpiryWatcher(cooked.source.SAS, cooked.destination.SAS)
+	}
+
 	// Do this check separately so we don't end up with a bunch of code duplication when new src/dstn are added
 	if cooked.fromTo.From() == common.ELocation.Local() {
 		cooked.source = common.ResourceString{Value: common.ToExtendedPath(cleanLocalPath(raw.src))}
@@ -174,6 +203,12 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	if err != nil {
 		return cooked, err
 	}
+	cooked.dryrunMode = raw.dryrun
+	cooked.verifyOnly = raw.verifyOnly
+	cooked.verifyMD5 = raw.verifyMD5
+	if err = validateVerifyOnly(cooked.verifyOnly, cooked.verifyMD5, cooked.dryrunMode); err != nil {
+		return cooked, err
+	}
 
 	// warn on legacy filters
 	if raw.legacyInclude != "" || raw.legacyExclude != "" {
@@ -193,6 +228,10 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	if err != nil {
 		return cooked, err
 	}
+	err = cooked.logFormat.Parse(raw.logFormat)
+	if err != nil {
+		return cooked, err
+	}
 
 	if err = validatePreserveSMBPropertyOption(raw.preserveSMBPermissions, cooked.fromTo, nil, "preserve-smb-permissions"); err != nil {
 		return cooked, err
@@ -208,6 +247,37 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 		return cooked, err
 	}
 
+	cooked.preservePOSIXProperties = raw.preservePOSIXProperties
+	if err = validatePreservePOSIXProperties(cooked.preservePOSIXProperties, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	cooked.parallelTransfers = raw.parallelTransfers
+	if raw.maxDuration < 0 {
+		return cooked, fmt.Errorf("invalid max-duration %v, it must not be negative", raw.maxDuration)
+	}
+	cooked.maxDuration = raw.maxDuration
+	if raw.maxRetries < -1 {
+		return cooked, fmt.Errorf("invalid max-retries %v, it must be 0 or more, or -1 for the engine default", raw.maxRetries)
+	}
+	cooked.maxRetries = raw.maxRetries
+	if err = validateTransfersPerPart(raw.transfersPerPart); err != nil {
+		return cooked, err
+	}
+	cooked.transfersPerPart = raw.transfersPerPart
+	if err = cooked.transferOrder.Parse(raw.transferOrder); err != nil {
+		return cooked, err
+	}
+	cooked.maxTotalBytes = raw.maxTotalBytes
+	cooked.retryChangedFiles = raw.retryChangedFiles
+	// sync always validates the source of service-to-service copies
+	if err = validateRetryChangedFiles(cooked.retryChangedFiles, cooked.fromTo, true); err != nil {
+		return cooked, err
+	}
+	if cooked.bandwidthSchedule, err = common.ParseBandwidthSchedule(raw.capMbpsSchedule); err != nil {
+		return cooked, fmt.Errorf("invalid cap-mbps-schedule: %w", err)
+	}
+
 	cooked.putMd5 = raw.putMd5
 	if err = validatePutMd5(cooked.putMd5, cooked.fromTo); err != nil {
 		return cooked, err
@@ -221,6 +291,16 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 		return cooked, err
 	}
 
+	err = cooked.checksumAlgorithm.Parse(raw.checksumAlgorithm)
+	if err != nil {
+		return cooked, err
+	}
+	if err = validateChecksumAlgorithm(cooked.checksumAlgorithm, cooked.fromTo); err != nil {
+		return cooked, err
+	}
+
+	cooked.skipIfHashMatches = raw.skipIfHashMatches
+
 	if cooked.fromTo.IsS2S() {
 		cooked.preserveAccessTier = raw.s2sPreserveAccessTier
 	}
@@ -228,6 +308,16 @@ func (raw *rawSyncCmdArgs) cook() (cookedSyncCmdArgs, error) {
 	return cooked, nil
 }
 
+func validateVerifyOnly(verifyOnly, verifyMD5, dryrun bool) error {
+	if verifyOnly && dryrun {
+		return fmt.Errorf("verify-only and dry-run cannot be used together, since neither transfers anything")
+	}
+	if verifyMD5 && !verifyOnly {
+		return fmt.Errorf("verify-md5 can only be used with verify-only")
+	}
+	return nil
+}
+
 type cookedSyncCmdArgs struct {
 	// NOTE: for the 64 bit atomic functions to work on a 32 bit system, we have to guarantee the right 64-bit alignment
 	// so the 64 bit integers are placed first in the struct to avoid future breaks
@@ -245,11 +335,15 @@ type cookedSyncCmdArgs struct {
 
 	// deletion count keeps track of how many extra files from the destination were removed
 	atomicDeletionCount uint32
+	// and this, how many of them could not be
+	atomicDeletionFailureCount uint32
 
 	source         common.ResourceString
 	destination    common.ResourceString
 	fromTo         common.FromTo
 	credentialInfo common.CredentialInfo
+	// warns if the job looks set to outlast its SAS tokens. Nil if they do not expire.
+	sasExpiry *sasExpiryWatcher
 
 	// filters
 	recursive             bool
@@ -261,14 +355,27 @@ type cookedSyncCmdArgs struct {
 	excludeFileAttributes []string
 
 	// options
-	preserveSMBPermissions common.PreservePermissionsOption
-	preserveSMBInfo        bool
-	putMd5                 bool
-	md5ValidationOption    common.HashValidationOption
-	blockSize              int64
-	logVerbosity           common.LogLevel
-	forceIfReadOnly        bool
-	backupMode             bool
+	preserveSMBPermissions  common.PreservePermissionsOption
+	preserveSMBInfo         bool
+	preservePOSIXProperties bool
+	putMd5                  bool
+	md5ValidationOption     common.HashValidationOption
+	checksumAlgorithm       common.HashAlgorithm
+	skipIfHashMatches       bool
+	blockSize               int64
+	logVerbosity            common.LogLevel
+	logFormat               common.LogFormat
+	forceIfReadOnly         bool
+	parallelTransfers       uint16
+	maxDuration             time.Duration
+	maxRetries              int32
+	retryChangedFiles       bool
+	transfersPerPart        uint32
+	transferOrder           common.TransferOrder
+	maxTotalBytes           uint64
+	bandwidthSchedule       common.BandwidthSchedule
+	sasRefreshCommand       string
+	backupMode              bool
 
 	// commandString hold the user given command which is logged to the Job log file
 	commandString string
@@ -297,16 +404,39 @@ type cookedSyncCmdArgs struct {
 	deleteDestination common.DeleteDestination
 
 	preserveAccessTier bool
+
+	// report what would be added, updated and deleted, rather than doing it
+	dryrunMode bool
+	// check that each source file matches its destination (by size, and by MD5 if verifyMD5 is set), rather than syncing them
+	verifyOnly bool
+	verifyMD5  bool
 }
 
-func (cca *cookedSyncCmdArgs) incrementDeletionCount() {
+// recordDeletion counts the deletion of an extra file from the destination, and records it in the job log,
+// in the same way that transfers are, so that the log shows everything the sync did to the destination
+func (cca *cookedSyncCmdArgs) recordDeletion(object storedObject, err error) {
+	target := common.GenerateFullPath(strings.Split(cca.destination.Value, "?")[0], object.relativePath)
+	if err != nil {
+		atomic.AddUint32(&cca.atomicDeletionFailureCount, 1)
+		if ste.JobsAdmin != nil {
+			ste.JobsAdmin.LogToJobLog(fmt.Sprintf("DELETE FAILED: %s. Error: %s", target, err), pipeline.LogError)
+		}
+		return
+	}
 	atomic.AddUint32(&cca.atomicDeletionCount, 1)
+	if ste.JobsAdmin != nil {
+		ste.JobsAdmin.LogToJobLog("DELETE SUCCESSFUL: "+target, pipeline.LogInfo)
+	}
 }
 
 func (cca *cookedSyncCmdArgs) getDeletionCount() uint32 {
 	return atomic.LoadUint32(&cca.atomicDeletionCount)
 }
 
+func (cca *cookedSyncCmdArgs) getDeletionFailureCount() uint32 {
+	return atomic.LoadUint32(&cca.atomicDeletionFailureCount)
+}
+
 // setFirstPartOrdered sets the value of atomicFirstPartOrdered to 1
 func (cca *cookedSyncCmdArgs) setFirstPartOrdered() {
 	atomic.StoreUint32(&cca.atomicFirstPartOrdered, 1)
@@ -407,8 +537,9 @@ func (cca *cookedSyncCmdArgs) reportScanningProgress(lcm common.LifecycleMgr, th
 
 func (cca *cookedSyncCmdArgs) getJsonOfSyncJobSummary(summary common.ListJobSummaryResponse) string {
 	wrapped := common.ListSyncJobSummaryResponse{ListJobSummaryResponse: summary}
-	wrapped.DeleteTotalTransfers = cca.getDeletionCount()
+	wrapped.DeleteTotalTransfers = cca.getDeletionCount() + cca.getDeletionFailureCount()
 	wrapped.DeleteTransfersCompleted = cca.getDeletionCount()
+	wrapped.DeleteTransfersFailed = cca.getDeletionFailureCount()
 	jsonOutput, err := json.Marshal(wrapped)
 	common.PanicIfErr(err)
 	return string(jsonOutput)
@@ -446,7 +577,7 @@ func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) (tot
 
 	if jobDone {
 		exitCode := common.EExitCode.Success()
-		if summary.TransfersFailed > 0 {
+		if summary.TransfersFailed > 0 || cca.getDeletionFailureCount() > 0 {
 			exitCode = common.EExitCode.Error()
 		}
 
@@ -468,6 +599,7 @@ Total Number Of Copy Transfers: %v
 Number of Copy Transfers Completed: %v
 Number of Copy Transfers Failed: %v
 Number of Deletions at Destination: %v
+Number of Deletions Failed at Destination: %v
 Total Number of Bytes Transferred: %v
 Total Number of Bytes Enumerated: %v
 Final Job Status: %v%s%s
@@ -481,10 +613,11 @@ Final Job Status: %v%s%s
 				summary.TotalTransfers,
 				summary.TransfersCompleted,
 				summary.TransfersFailed,
-				cca.atomicDeletionCount,
+				cca.getDeletionCount(),
+				cca.getDeletionFailureCount(),
 				summary.TotalBytesTransferred,
 				summary.TotalBytesEnumerated,
-				summary.JobStatus,
+				formatJobStatus(summary.JobStatus, summary.CancelReason),
 				screenStats,
 				formatPerfAdvice(summary.PerformanceAdvice))
 
@@ -497,6 +630,10 @@ Final Job Status: %v%s%s
 		}, exitCode)
 	}
 
+	if warning := cca.sasExpiry.check(summary, duration, time.Now()); warning != "" {
+		lcm.Info("WARNING: " + warning)
+	}
+
 	lcm.Progress(func(format common.OutputFormat) string {
 		if format == common.EOutputFormat.Json() {
 			return cca.getJsonOfSyncJobSummary(summary)
@@ -562,7 +699,10 @@ func (cca *cookedSyncCmdArgs) process() (err error) {
 	}
 
 	// trigger the progress reporting
-	cca.waitUntilJobCompletion(false)
+	// (there is no job to report on in a dry run, which reports each object as it is compared instead)
+	if !cca.dryrunMode && !cca.verifyOnly {
+		cca.waitUntilJobCompletion(false)
+	}
 
 	// trigger the enumeration
 	err = enumerator.enumerate()
@@ -593,6 +733,7 @@ func init() {
 			glcm.EnableInputWatcher()
 			if cancelFromStdin {
 				glcm.EnableCancelFromStdIn()
+				glcm.EnableBandwidthCapFromStdIn(setBandwidthCap)
 			}
 
 			cooked, err := raw.cook()
@@ -614,8 +755,9 @@ func init() {
 
 	// TODO: enable for copy with IfSourceNewer
 	// smb info/permissions can be persisted in the scenario of File -> File
-	syncCmd.PersistentFlags().BoolVar(&raw.preserveSMBPermissions, "preserve-smb-permissions", false, "False by default. Preserves SMB ACLs between aware resources (Azure Files). This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern).")
-	syncCmd.PersistentFlags().BoolVar(&raw.preserveSMBInfo, "preserve-smb-info", false, "False by default. Preserves SMB property info (last write time, creation time, attribute bits) between SMB-aware resources (Azure Files). This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern). The info transferred for folders is the same as that for files, except for Last Write Time which is not preserved for folders. ")
+	syncCmd.PersistentFlags().BoolVar(&raw.preserveSMBPermissions, "preserve-smb-permissions", false, "False by default. Preserves SMB ACLs between aware resources (Azure Files), or between Windows and Blob storage by way of blob metadata. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern).")
+	syncCmd.PersistentFlags().BoolVar(&raw.preserveSMBInfo, "preserve-smb-info", false, "False by default. Preserves SMB property info (last write time, creation time, attribute bits) between SMB-aware resources (Azure Files), or between Windows and Blob storage by way of blob metadata. This flag applies to both files and folders, unless a file-only filter is specified (e.g. include-pattern). The info transferred for folders is the same as that for files, except for Last Write Time which is not preserved for folders. ")
+	syncCmd.PersistentFlags().BoolVar(&raw.preservePOSIXProperties, "preserve-posix-properties", false, "False by default. Preserves POSIX permission bits, owner and group between a Linux/Unix file system and Blob storage, by way of blob metadata.")
 
 	// TODO: enable when we support local <-> File
 	//syncCmd.PersistentFlags().BoolVar(&raw.forceIfReadOnly, "force-if-read-only", false, "When overwriting an existing file on Windows or Azure Files, force the overwrite to work even if the existing file has its read-only attribute set")
@@ -623,17 +765,53 @@ func init() {
 	//syncCmd.PersistentFlags().BoolVar(&raw.backupMode, common.BackupModeFlagName, false, "Activates Windows' SeBackupPrivilege for uploads, or SeRestorePrivilege for downloads, to allow AzCopy to see read all files, regardless of their file system permissions, and to restore all permissions. Requires that the account running AzCopy already has these permissions (e.g. has Administrator rights or is a member of the 'Backup Operators' group). All this flag does is activate privileges that the account already has")
 
 	syncCmd.PersistentFlags().Float64Var(&raw.blockSizeMB, "block-size-mb", 0, "Use this block size (specified in MiB) when uploading to Azure Storage or downloading from Azure Storage. Default is automatically calculated based on file size. Decimal fractions are allowed (For example: 0.25).")
-	syncCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "", "Include only files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName")
-	syncCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName")
+	syncCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "", "Include only files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName. "+
+		"A pattern that contains a '/' matches the relative path instead, e.g. reports/*.pdf")
+	syncCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "", "Exclude files where the name matches the pattern list. For example: *.jpg;*.pdf;exactName. "+
+		"A file that matches both an include and an exclude pattern is excluded")
 	syncCmd.PersistentFlags().StringVar(&raw.excludePath, "exclude-path", "", "Exclude these paths when comparing the source against the destination. "+
 		"This option does not support wildcard characters (*). Checks relative path prefix(For example: myFolder;myFolder/subDirName/file.pdf).")
 	syncCmd.PersistentFlags().StringVar(&raw.includeFileAttributes, "include-attributes", "", "(Windows only) Include only files whose attributes match the attribute list. For example: A;S;R")
 	syncCmd.PersistentFlags().StringVar(&raw.excludeFileAttributes, "exclude-attributes", "", "(Windows only) Exclude files whose attributes match the attribute list. For example: A;S;R")
 	syncCmd.PersistentFlags().StringVar(&raw.logVerbosity, "log-level", "INFO", "Define the log verbosity for the log file, available levels: INFO(all requests and responses), WARNING(slow responses), ERROR(only failed requests), and NONE(no output logs). (default INFO).")
+	syncCmd.PersistentFlags().StringVar(&raw.logFormat, "log-format", common.ELogFormat.Text().String(), "Define how the entries of the log file are written, available formats: Text(readable by people) and Json(one JSON object per line, for log aggregators to ingest).")
 	syncCmd.PersistentFlags().StringVar(&raw.deleteDestination, "delete-destination", "false", "Defines whether to delete extra files from the destination that are not present at the source. Could be set to true, false, or prompt. "+
 		"If set to prompt, the user will be asked a question before scheduling files and blobs for deletion. (default 'false').")
+	syncCmd.PersistentFlags().BoolVar(&raw.dryrun, "dry-run", false, "Prints what the sync would do to each file, without transferring or deleting anything: WillAdd, WillUpdate, WillDelete or Unchanged. "+
+		"The source and destination are compared exactly as in a real sync. With --delete-destination=prompt, the files reported as WillDelete are those you would be asked about. "+
+		"The summary includes an estimate of the requests that transferring the files to add and update would make, and of the bytes it would read out of the source storage (its egress).")
+	syncCmd.PersistentFlags().BoolVar(&raw.verifyOnly, "verify-only", false, "Checks that the destination matches the source, without transferring or deleting anything. "+
+		"Each source file is paired with its destination file as in a real sync, and is reported as Mismatched if their sizes differ, or Missing if the destination doesn't have it. "+
+		"Files that only the destination has are ignored. Exits with an error if any file is Mismatched or Missing.")
+	syncCmd.PersistentFlags().BoolVar(&raw.verifyMD5, "verify-md5", false, "With --verify-only, also compare the MD5 of each pair of files. "+
+		"The MD5 of local files is computed, and other files must have one stored with them, such as the Content-MD5 of a blob.")
+	syncCmd.PersistentFlags().Uint16Var(&raw.parallelTransfers, "parallel-transfers", 0, "Limit how many of this job's files are transferred at once. "+
+		"The limit is saved with the job, so it also applies when the job is resumed. By default, the engine's own concurrency applies.")
+	syncCmd.PersistentFlags().DurationVar(&raw.maxDuration, "max-duration", 0, "Stop the job once it has run for this long (e.g. '8h'). Transfers in progress are allowed to finish, but no more are started, "+
+		"and the job ends as Cancelled. Resuming the job gives it the same duration again. By default, there is no limit.")
+	syncCmd.PersistentFlags().Int32Var(&raw.maxRetries, "max-retries", -1, "Number of times each failed transfer may be retried when the job is resumed, before it is left as failed. "+
+		"0 means failed transfers are never retried. The number is saved with the job, so it also applies when the job is resumed from another AzCopy session. "+
+		"By default (or when -1), the engine's own limit of "+fmt.Sprint(ste.TransferMaxRetries)+" applies.")
+	syncCmd.PersistentFlags().BoolVar(&raw.retryChangedFiles, "retry-changed-files", false, "Start a file again straight away if it changes while it is being uploaded, up to --max-retries times, "+
+		"instead of failing it with 'source changed during transfer' and leaving it for the job to be resumed.")
+	syncCmd.PersistentFlags().Uint32Var(&raw.transfersPerPart, "transfers-per-part", 0, transfersPerPartFlagDescription)
+	syncCmd.PersistentFlags().StringVar(&raw.transferOrder, "transfer-order", common.ETransferOrder.Plan().String(), transferOrderFlagDescription)
+	syncCmd.PersistentFlags().Uint64Var(&raw.maxTotalBytes, "max-total-bytes", 0, "Stop the job before it transfers more than this many bytes in all, e.g. to stay within the quota of a file share. "+
+		"No transfer is started that would take the job past the limit; instead the job is cancelled once the transfers in progress have finished, "+
+		"and the transfers that were left out are recorded with the status ExceededMaxTotalBytes. Data that is sent again, e.g. by a retry, counts again. "+
+		"The limit is saved with the job, and covers all its runs. By default (or when 0), there is no limit.")
+	syncCmd.PersistentFlags().StringVar(&raw.capMbpsSchedule, "cap-mbps-schedule", "", "Vary the bandwidth cap, in megabits per second, by the local time of day, e.g. '09:00-17:00=100,22:00-06:00=0'. "+
+		"Each window includes its start and excludes its end, a window that ends before it starts runs past midnight, and where windows overlap the first one listed applies. "+
+		"Outside the windows, --cap-mbps applies. 0 means no cap. The schedule is saved with the job, so it also applies when the job is resumed.")
+	syncCmd.PersistentFlags().StringVar(&raw.sasRefreshCommand, "sas-refresh-command", "", "Command line that prints a new SAS token, for jobs that may outlast their SAS tokens. "+
+		"It is run in a shell ten minutes before a token expires, with "+ste.SASRoleEnvVar+" set to 'source' or 'destination' to say which token is wanted, "+
+		"and could e.g. call an endpoint with curl. Transfers in progress switch to the new token. By default, the job stops when a token expires.")
 	syncCmd.PersistentFlags().BoolVar(&raw.putMd5, "put-md5", false, "Create an MD5 hash of each file, and save the hash as the Content-MD5 property of the destination blob or file. (By default the hash is NOT created.) Only available when uploading.")
-	syncCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. This option is only available when downloading. Available values include: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. (default 'FailIfDifferent').")
+	syncCmd.PersistentFlags().StringVar(&raw.md5ValidationOption, "check-md5", common.DefaultHashValidationOption.String(), "Specifies how strictly MD5 hashes should be validated when downloading. This option is only available when downloading. Available values include: NoCheck, LogOnly, FailIfDifferent, FailIfDifferentOrMissing. NoCheck also skips hashing the downloaded data, for workloads where that costs too much. (default 'FailIfDifferent').")
+	syncCmd.PersistentFlags().StringVar(&raw.checksumAlgorithm, "checksum-algorithm", common.EHashAlgorithm.MD5().String(), "Specifies the hash algorithm used by put-md5 and check-md5. Available values include: MD5, SHA256. SHA256 hashes are kept in the '"+common.SHA256MetadataKey+"' metadata of the blob, and are only available when syncing to, or from, Blob storage.")
+	syncCmd.PersistentFlags().BoolVar(&raw.skipIfHashMatches, "skip-if-hash-matches", false, "False by default. When syncing to Blob storage, before sending a file whose timestamp has changed, compare its hash with the one stored "+
+		"on the destination blob (as given by checksum-algorithm), and skip the file if they match. Local files whose hash doesn't match are then read twice, once to compute their hash and once to send them, "+
+		"so only use this when the stored hashes are trustworthy and most changed timestamps are expected to have no changed content behind them.")
 	syncCmd.PersistentFlags().BoolVar(&raw.s2sPreserveAccessTier, "s2s-preserve-access-tier", true, "Preserve access tier during service to service copy. "+
 		"Please refer to [Azure Blob storage: hot, cool, and archive access tiers](https://docs.microsoft.com/azure/storage/blobs/storage-blob-storage-tiers) to ensure destination storage account supports setting access tier. "+
 		"In the cases that setting access tier is not supported, please use s2sPreserveAccessTier=false to bypass copying access tier. (default true). ")
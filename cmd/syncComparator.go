@@ -20,6 +20,8 @@
 
 package cmd
 
+import "github.com/Azure/azure-storage-azcopy/common"
+
 // with the help of an objectIndexer containing the source objects
 // find out the destination objects that should be transferred
 // in other words, this should be used when destination is being enumerated secondly
@@ -32,6 +34,12 @@ type syncDestinationComparator struct {
 
 	// storing the source objects
 	sourceIndex *objectIndexer
+
+	// if set, told what the comparison decided for each object present at both ends (see syncDryRunReporter)
+	reportAction func(object storedObject, action common.SyncAction)
+
+	// if set, decides whether the destination object is out of date, instead of isMoreRecentThan (see syncVerifier)
+	isStale func(source, destination storedObject) bool
 }
 
 func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objectProcessor) *syncDestinationComparator {
@@ -50,11 +58,14 @@ func (f *syncDestinationComparator) processIfNecessary(destinationObject storedO
 	if present {
 		defer delete(f.sourceIndex.indexMap, destinationObject.relativePath)
 
-		if sourceObjectInMap.isMoreRecentThan(destinationObject) {
+		if isDestinationStale(f.isStale, sourceObjectInMap, destinationObject) {
+			f.report(sourceObjectInMap, common.ESyncAction.WillUpdate())
 			err := f.copyTransferScheduler(sourceObjectInMap)
 			if err != nil {
 				return err
 			}
+		} else {
+			f.report(sourceObjectInMap, common.ESyncAction.Unchanged())
 		}
 	} else {
 		// purposefully ignore the error from destinationCleaner
@@ -65,6 +76,12 @@ func (f *syncDestinationComparator) processIfNecessary(destinationObject storedO
 	return nil
 }
 
+func (f *syncDestinationComparator) report(object storedObject, action common.SyncAction) {
+	if f.reportAction != nil {
+		f.reportAction(object, action)
+	}
+}
+
 // with the help of an objectIndexer containing the destination objects
 // filter out the source objects that should be transferred
 // in other words, this should be used when source is being enumerated secondly
@@ -74,6 +91,12 @@ type syncSourceComparator struct {
 
 	// storing the destination objects
 	destinationIndex *objectIndexer
+
+	// if set, told what the comparison decided for each source object (see syncDryRunReporter)
+	reportAction func(object storedObject, action common.SyncAction)
+
+	// if set, decides whether the destination object is out of date, instead of isMoreRecentThan (see syncVerifier)
+	isStale func(source, destination storedObject) bool
 }
 
 func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor) *syncSourceComparator {
@@ -92,15 +115,74 @@ func (f *syncSourceComparator) processIfNecessary(sourceObject storedObject) err
 		defer delete(f.destinationIndex.indexMap, sourceObject.relativePath)
 
 		// if destination is stale, schedule source for transfer
-		if sourceObject.isMoreRecentThan(destinationObjectInMap) {
+		if isDestinationStale(f.isStale, sourceObject, destinationObjectInMap) {
+			f.report(sourceObject, common.ESyncAction.WillUpdate())
 			return f.copyTransferScheduler(sourceObject)
 
 		} else {
 			// skip if source is more recent
+			f.report(sourceObject, common.ESyncAction.Unchanged())
 			return nil
 		}
 	}
 
 	// if source does not exist at the destination, then schedule it for transfer
+	f.report(sourceObject, common.ESyncAction.WillAdd())
 	return f.copyTransferScheduler(sourceObject)
 }
+
+func (f *syncSourceComparator) report(object storedObject, action common.SyncAction) {
+	if f.reportAction != nil {
+		f.reportAction(object, action)
+	}
+}
+
+// isDestinationStale decides, with isStale if it is set, whether the destination object should be replaced by the source one.
+// By default, it is replaced when the source is more recent.
+func isDestinationStale(isStale func(source, destination storedObject) bool, source, destination storedObject) bool {
+	if isStale != nil {
+		return isStale(source, destination)
+	}
+	return source.isMoreRecentThan(destination)
+}
+
+// syncObserver stands in for the transfer scheduler and the destination cleaner of a sync that only looks at the source and destination,
+// i.e. a dry run (syncDryRunReporter) or a verification (syncVerifier). The comparators pair up the objects exactly as in a real sync,
+// and tell it what they find instead of acting on it.
+type syncObserver interface {
+	// report is told what the comparison decided for each object
+	report(object storedObject, action common.SyncAction)
+	// isStale decides whether the destination object is out of date
+	isStale(source, destination storedObject) bool
+	// reportMissing is given the source objects that the destination doesn't have, when they are left over once the destination is compared
+	reportMissing(object storedObject) error
+	// reportExtra is given the objects that only the destination has
+	reportExtra(object storedObject) error
+	// reportAndExit summarizes what was found, and exits
+	reportAndExit()
+}
+
+// newSyncObservingComparator returns the comparator that a sync from fromTo uses, set up to tell the observer what it finds,
+// and compareLeftovers, which reports the objects left in the index once the comparison is done
+func newSyncObservingComparator(fromTo common.FromTo, indexer *objectIndexer, filters []objectFilter, observer syncObserver) (comparator objectProcessor, compareLeftovers func() error) {
+	// nothing is transferred
+	skipTransfer := func(storedObject) error { return nil }
+
+	if fromTo == common.EFromTo.LocalBlob() {
+		// the source was indexed. The leftovers are source files that the destination doesn't have
+		dstComparator := newSyncDestinationComparator(indexer, skipTransfer, observer.reportExtra)
+		dstComparator.reportAction = observer.report
+		dstComparator.isStale = observer.isStale
+		return dstComparator.processIfNecessary, func() error {
+			return indexer.traverse(observer.reportMissing, filters)
+		}
+	}
+
+	// the destination was indexed. The leftovers are destination files that the source doesn't have
+	srcComparator := newSyncSourceComparator(indexer, skipTransfer)
+	srcComparator.reportAction = observer.report
+	srcComparator.isStale = observer.isStale
+	return srcComparator.processIfNecessary, func() error {
+		return indexer.traverse(observer.reportExtra, nil)
+	}
+}
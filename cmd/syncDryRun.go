@@ -0,0 +1,133 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// syncDryRunReporter is the syncObserver of a sync dry run.
+// The comparators decide what happens to each object exactly as in a real sync, and this reports those decisions
+// instead of acting on them.
+type syncDryRunReporter struct {
+	fromTo            common.FromTo
+	blockSize         int64
+	fpo               common.FolderPropertyOption
+	deleteDestination common.DeleteDestination
+
+	mu       *sync.Mutex
+	counts   map[common.SyncAction]uint32
+	estimate dryRunCostEstimate // of transferring the objects to add and update
+}
+
+func newSyncDryRunReporter(fromTo common.FromTo, blockSize int64, fpo common.FolderPropertyOption, deleteDestination common.DeleteDestination) *syncDryRunReporter {
+	return &syncDryRunReporter{fromTo: fromTo, blockSize: blockSize, fpo: fpo, deleteDestination: deleteDestination,
+		mu: &sync.Mutex{}, counts: map[common.SyncAction]uint32{}}
+}
+
+// report prints what will happen to the object, as its own message, so that it can be consumed as it is enumerated
+func (r *syncDryRunReporter) report(object storedObject, action common.SyncAction) {
+	if !object.isCompatibleWithFpo(r.fpo) {
+		return // the real sync would ignore it too
+	}
+	r.mu.Lock()
+	r.counts[action]++
+	if action == common.ESyncAction.WillAdd() || action == common.ESyncAction.WillUpdate() {
+		// a sync leaves the blob type to be detected, as copy does by default
+		r.estimate.add(r.fromTo, common.EBlobType.Detect(), r.blockSize, common.CopyTransfer{EntityType: object.entityType, SourceSize: object.size})
+	}
+	r.mu.Unlock()
+
+	entry := common.SyncDryRunEntryJsonTemplate{
+		SchemaVersion: common.JsonOutputSchemaVersion,
+		Action:        action,
+		Path:          object.relativePath,
+		SourceSize:    object.size,
+		ModifiedTime:  object.lastModifiedTime,
+	}
+	if object.entityType == common.EEntityType.Folder() {
+		entry.Path += common.AZCOPY_PATH_SEPARATOR_STRING
+	}
+	if azcopyOutputFormat == common.EOutputFormat.Json() {
+		glcm.Progress(func(common.OutputFormat) string {
+			return common.GetJsonStringFromTemplate(entry)
+		})
+		return
+	}
+	glcm.Info(fmt.Sprintf("DRYRUN: %s %s (%d bytes)", entry.Action, entry.Path, entry.SourceSize))
+}
+
+// isStale compares by time, as a real sync does
+func (r *syncDryRunReporter) isStale(source, destination storedObject) bool {
+	return source.isMoreRecentThan(destination)
+}
+
+// reportMissing takes the place of the transfer scheduler for the source objects that are left over once the destination is compared,
+// i.e. those that the destination doesn't have
+func (r *syncDryRunReporter) reportMissing(object storedObject) error {
+	r.report(object, common.ESyncAction.WillAdd())
+	return nil
+}
+
+// reportExtra takes the place of the destination cleaner, for objects that only the destination has.
+// They are left alone unless the user has allowed (or, with prompt, may allow) their deletion.
+func (r *syncDryRunReporter) reportExtra(object storedObject) error {
+	if r.deleteDestination == common.EDeleteDestination.False() {
+		r.report(object, common.ESyncAction.Unchanged())
+	} else {
+		r.report(object, common.ESyncAction.WillDelete())
+	}
+	return nil
+}
+
+func (r *syncDryRunReporter) summary() common.SyncDryRunSummaryJsonTemplate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return common.SyncDryRunSummaryJsonTemplate{
+		SchemaVersion: common.JsonOutputSchemaVersion,
+		WillAdd:       r.counts[common.ESyncAction.WillAdd()],
+		WillUpdate:    r.counts[common.ESyncAction.WillUpdate()],
+		WillDelete:    r.counts[common.ESyncAction.WillDelete()],
+		Unchanged:     r.counts[common.ESyncAction.Unchanged()],
+	}
+}
+
+// reportAndExit summarizes the dry run and exits, since nothing is to be transferred or deleted
+func (r *syncDryRunReporter) reportAndExit() {
+	summary := r.summary()
+	r.mu.Lock()
+	estimate := r.estimate
+	r.mu.Unlock()
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			return common.GetJsonStringFromTemplate(struct {
+				common.SyncDryRunSummaryJsonTemplate
+				dryRunCostEstimate
+			}{summary, estimate})
+		}
+		return fmt.Sprintf("DRYRUN: %v to add, %v to update, %v to delete and %v unchanged. Nothing was transferred or deleted. "+
+			"Transferring the files to add and update would take about %v requests, and read %v bytes out of the source storage (its egress).",
+			summary.WillAdd, summary.WillUpdate, summary.WillDelete, summary.Unchanged, estimate.EstimatedRequests, estimate.EstimatedEgressBytes)
+	}, common.EExitCode.Success())
+}
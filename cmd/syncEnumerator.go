@@ -62,7 +62,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		if entityType == common.EEntityType.File() {
 			atomic.AddUint64(&cca.atomicSourceFilesScanned, 1)
 		}
-	}, nil)
+	}, nil, blobTraverserOptions{})
 
 	if err != nil {
 		return nil, err
@@ -82,7 +82,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		if entityType == common.EEntityType.File() {
 			atomic.AddUint64(&cca.atomicDestinationFilesScanned, 1)
 		}
-	}, nil)
+	}, nil, blobTraverserOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -122,10 +122,41 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		ste.JobsAdmin.LogToJobLog(folderMessage, pipeline.LogInfo)
 	}
 
-	transferScheduler := newSyncTransferProcessor(cca, NumOfFilesPerDispatchJobPart, fpo)
-
 	// set up the comparator so that the source/destination can be compared
 	indexer := newObjectIndexer()
+
+	// a dry run compares the source and destination just as a real sync does, but reports the outcome instead of acting on it,
+	// and verification pairs them up just as a real sync does, but checks that each pair matches instead
+	var observer syncObserver
+	if cca.verifyOnly {
+		var sourceLocalRoot, destinationLocalRoot string
+		if cca.fromTo.From() == common.ELocation.Local() {
+			sourceLocalRoot = cca.source.ValueLocal()
+		}
+		if cca.fromTo.To() == common.ELocation.Local() {
+			destinationLocalRoot = cca.destination.ValueLocal()
+		}
+		observer = newSyncVerifier(cca.verifyMD5, sourceLocalRoot, destinationLocalRoot)
+	} else if cca.dryrunMode {
+		observer = newSyncDryRunReporter(cca.fromTo, cca.blockSize, fpo, cca.deleteDestination)
+	}
+
+	if observer != nil {
+		comparator, compareLeftovers := newSyncObservingComparator(cca.fromTo, indexer, filters, observer)
+		finalize := func() error {
+			if err := compareLeftovers(); err != nil {
+				return err
+			}
+			observer.reportAndExit()
+			return nil
+		}
+		if cca.fromTo == common.EFromTo.LocalBlob() {
+			return newSyncEnumerator(sourceTraverser, destinationTraverser, indexer, filters, comparator, finalize), nil
+		}
+		return newSyncEnumerator(destinationTraverser, sourceTraverser, indexer, filters, comparator, finalize), nil
+	}
+
+	transferScheduler := newSyncTransferProcessor(cca, transfersPerPartOrDefault(cca.transfersPerPart), fpo)
 	var comparator objectProcessor
 	var finalize func() error
 
@@ -208,7 +239,13 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 }
 
 func quitIfInSync(transferJobInitiated, anyDestinationFileDeleted bool, cca *cookedSyncCmdArgs) {
-	if !transferJobInitiated && !anyDestinationFileDeleted {
+	if failures := cca.getDeletionFailureCount(); !transferJobInitiated && failures > 0 {
+		// nothing to transfer, but the destination still has files that should have been deleted
+		cca.reportScanningProgress(glcm, 0)
+		glcm.Exit(func(format common.OutputFormat) string {
+			return fmt.Sprintf("%d extra files could not be deleted from the destination, so it is not in sync with the source. See the log file for details.", failures)
+		}, common.EExitCode.Error())
+	} else if !transferJobInitiated && !anyDestinationFileDeleted {
 		cca.reportScanningProgress(glcm, 0)
 		glcm.Exit(func(format common.OutputFormat) string {
 			return "The source and destination are already in sync."
@@ -51,16 +51,29 @@ func newSyncTransferProcessor(cca *cookedSyncCmdArgs, numOfTransfersPerPart int,
 			PreserveLastModifiedTime: true, // must be true for sync so that future syncs have this information available
 			PutMd5:                   cca.putMd5,
 			MD5ValidationOption:      cca.md5ValidationOption,
+			ChecksumAlgorithm:        cca.checksumAlgorithm,
 			BlockSizeInBytes:         cca.blockSize},
 		ForceWrite:                     common.EOverwriteOption.True(), // once we decide to transfer for a sync operation, we overwrite the destination regardless
 		ForceIfReadOnly:                cca.forceIfReadOnly,
+		TTLAfterCompletion:             cmdLineJobPlanTTL,
+		Concurrency:                    cca.parallelTransfers,
+		MaxDuration:                    cca.maxDuration,
+		MaxRetries:                     cca.maxRetries,
+		RetryChangedFiles:              cca.retryChangedFiles,
+		TransferOrder:                  cca.transferOrder,
+		MaxTotalBytes:                  cca.maxTotalBytes,
+		BandwidthSchedule:              cca.bandwidthSchedule,
+		SASRefreshCommand:              cca.sasRefreshCommand,
 		LogLevel:                       cca.logVerbosity,
+		LogFormat:                      cca.logFormat,
 		PreserveSMBPermissions:         cca.preserveSMBPermissions,
 		PreserveSMBInfo:                cca.preserveSMBInfo,
+		PreservePOSIXProperties:        cca.preservePOSIXProperties,
 		S2SSourceChangeValidation:      true,
 		DestLengthValidation:           true,
 		S2SGetPropertiesInBackend:      true,
 		S2SInvalidMetadataHandleOption: common.EInvalidMetadataHandleOption.RenameIfInvalid(),
+		SkipIfHashMatches:              cca.skipIfHashMatches,
 	}
 
 	reportFirstPart := func(jobStarted bool) { cca.setFirstPartOrdered() } // for compatibility with the way sync has always worked, we don't check jobStarted here
@@ -91,8 +104,8 @@ type interactiveDeleteProcessor struct {
 	// examples: a directory path, or url to container
 	objectLocationToDisplay string
 
-	// count the deletions that happened
-	incrementDeletionCount func()
+	// record each deletion, whether it succeeded or not
+	recordDeletion func(object storedObject, err error)
 }
 
 func (d *interactiveDeleteProcessor) removeImmediately(object storedObject) (err error) {
@@ -109,8 +122,8 @@ func (d *interactiveDeleteProcessor) removeImmediately(object storedObject) (err
 		glcm.Info(fmt.Sprintf("error %s deleting the object %s", err.Error(), object.relativePath))
 	}
 
-	if d.incrementDeletionCount != nil {
-		d.incrementDeletionCount()
+	if d.recordDeletion != nil {
+		d.recordDeletion(object, err)
 	}
 	return
 }
@@ -150,13 +163,13 @@ func (d *interactiveDeleteProcessor) promptForConfirmation(object storedObject)
 }
 
 func newInteractiveDeleteProcessor(deleter objectProcessor, deleteDestination common.DeleteDestination,
-	objectTypeToDisplay string, objectLocationToDisplay common.ResourceString, incrementDeletionCounter func()) *interactiveDeleteProcessor {
+	objectTypeToDisplay string, objectLocationToDisplay common.ResourceString, recordDeletion func(object storedObject, err error)) *interactiveDeleteProcessor {
 
 	return &interactiveDeleteProcessor{
 		deleter:                 deleter,
 		objectTypeToDisplay:     objectTypeToDisplay,
 		objectLocationToDisplay: objectLocationToDisplay.Value,
-		incrementDeletionCount:  incrementDeletionCounter,
+		recordDeletion:          recordDeletion,
 		shouldPromptUser:        deleteDestination == common.EDeleteDestination.Prompt(),
 		shouldDelete:            deleteDestination == common.EDeleteDestination.True(), // if shouldPromptUser is true, this will start as false, but we will determine its value later
 	}
@@ -164,7 +177,7 @@ func newInteractiveDeleteProcessor(deleter objectProcessor, deleteDestination co
 
 func newSyncLocalDeleteProcessor(cca *cookedSyncCmdArgs) *interactiveDeleteProcessor {
 	localDeleter := localFileDeleter{rootPath: cca.destination.ValueLocal()}
-	return newInteractiveDeleteProcessor(localDeleter.deleteFile, cca.deleteDestination, "local file", cca.destination, cca.incrementDeletionCount)
+	return newInteractiveDeleteProcessor(localDeleter.deleteFile, cca.deleteDestination, "local file", cca.destination, cca.recordDeletion)
 }
 
 type localFileDeleter struct {
@@ -213,7 +226,7 @@ func newSyncDeleteProcessor(cca *cookedSyncCmdArgs) (*interactiveDeleteProcessor
 	}
 
 	return newInteractiveDeleteProcessor(newRemoteResourceDeleter(rawURL, p, ctx, cca.fromTo.To()).delete,
-		cca.deleteDestination, cca.fromTo.To().String(), cca.destination, cca.incrementDeletionCount), nil
+		cca.deleteDestination, cca.fromTo.To().String(), cca.destination, cca.recordDeletion), nil
 }
 
 type remoteResourceDeleter struct {
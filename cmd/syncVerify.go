@@ -0,0 +1,181 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// syncVerifier is the syncObserver of a sync with --verify-only.
+// The comparators pair up the source and destination objects exactly as in a real sync, but this decides whether each pair matches
+// by size (and, if asked, MD5) instead of by time. Pairs that differ, and source files that the destination doesn't have,
+// are reported as failures. Nothing is transferred or deleted.
+type syncVerifier struct {
+	compareMD5 bool
+	// where local files are, so that their MD5 can be computed. Empty unless that end is local
+	sourceLocalRoot      string
+	destinationLocalRoot string
+
+	mu                           *sync.Mutex
+	verified, mismatched, missed uint32
+}
+
+func newSyncVerifier(compareMD5 bool, sourceLocalRoot, destinationLocalRoot string) *syncVerifier {
+	return &syncVerifier{compareMD5: compareMD5, sourceLocalRoot: sourceLocalRoot, destinationLocalRoot: destinationLocalRoot, mu: &sync.Mutex{}}
+}
+
+// isStale takes the place of the comparators' test of time. Only files are compared, since folders have no content to check.
+func (v *syncVerifier) isStale(source, destination storedObject) bool {
+	if source.entityType != common.EEntityType.File() {
+		return false
+	}
+	if source.size != destination.size {
+		v.fail(source, destination.size, "Mismatched", fmt.Sprintf("source is %d bytes, destination is %d bytes", source.size, destination.size))
+		return true
+	}
+	if !v.compareMD5 {
+		return false
+	}
+	sourceMD5, err := v.md5Of(source, v.sourceLocalRoot)
+	if err != nil {
+		v.fail(source, destination.size, "Mismatched", "cannot get the MD5 of the source: "+err.Error())
+		return true
+	}
+	destinationMD5, err := v.md5Of(destination, v.destinationLocalRoot)
+	if err != nil {
+		v.fail(source, destination.size, "Mismatched", "cannot get the MD5 of the destination: "+err.Error())
+		return true
+	}
+	if !bytes.Equal(sourceMD5, destinationMD5) {
+		v.fail(source, destination.size, "Mismatched", "the MD5 of the source differs from that of the destination")
+		return true
+	}
+	return false
+}
+
+// md5Of computes the MD5 of a local file, since local files have none stored, and otherwise returns the one stored with the object
+func (v *syncVerifier) md5Of(object storedObject, localRoot string) ([]byte, error) {
+	if localRoot == "" {
+		if len(object.md5) == 0 {
+			return nil, fmt.Errorf("%s has no stored MD5", object.relativePath)
+		}
+		return object.md5, nil
+	}
+	f, err := os.Open(common.GenerateFullPath(localRoot, object.relativePath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hasher := md5.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// report counts the source files that the comparators found to match. Those that didn't were reported as they were compared,
+// except for those missing at the destination, which are reported here.
+func (v *syncVerifier) report(object storedObject, action common.SyncAction) {
+	if object.entityType != common.EEntityType.File() {
+		return
+	}
+	switch action {
+	case common.ESyncAction.Unchanged():
+		v.mu.Lock()
+		v.verified++
+		v.mu.Unlock()
+	case common.ESyncAction.WillAdd():
+		v.fail(object, 0, "Missing", "the destination doesn't have it")
+	}
+}
+
+// fail reports a source file that doesn't match the destination, as its own message, so that it can be consumed as it is found
+func (v *syncVerifier) fail(source storedObject, destinationSize int64, problem string, reason string) {
+	v.mu.Lock()
+	if problem == "Missing" {
+		v.missed++
+	} else {
+		v.mismatched++
+	}
+	v.mu.Unlock()
+
+	entry := common.SyncVerifyFailureJsonTemplate{
+		SchemaVersion:   common.JsonOutputSchemaVersion,
+		Problem:         problem,
+		Path:            source.relativePath,
+		Reason:          reason,
+		SourceSize:      source.size,
+		DestinationSize: destinationSize,
+	}
+	if azcopyOutputFormat == common.EOutputFormat.Json() {
+		glcm.Progress(func(common.OutputFormat) string {
+			return common.GetJsonStringFromTemplate(entry)
+		})
+		return
+	}
+	glcm.Info(fmt.Sprintf("VERIFY: %s %s (%s)", entry.Problem, entry.Path, entry.Reason))
+}
+
+// reportMissing takes the place of the transfer scheduler for the source objects that are left over once the destination is compared,
+// i.e. those that the destination doesn't have
+func (v *syncVerifier) reportMissing(object storedObject) error {
+	v.report(object, common.ESyncAction.WillAdd())
+	return nil
+}
+
+// reportExtra takes the place of the destination cleaner. Objects that only the destination has don't make it differ from the source.
+func (v *syncVerifier) reportExtra(object storedObject) error {
+	return nil
+}
+
+func (v *syncVerifier) summary() common.SyncVerifySummaryJsonTemplate {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return common.SyncVerifySummaryJsonTemplate{
+		SchemaVersion: common.JsonOutputSchemaVersion,
+		Verified:      v.verified,
+		Mismatched:    v.mismatched,
+		Missing:       v.missed,
+	}
+}
+
+// reportAndExit summarizes the verification and exits, with an error if any file didn't match
+func (v *syncVerifier) reportAndExit() {
+	summary := v.summary()
+	exitCode := common.EExitCode.Success()
+	if summary.Mismatched > 0 || summary.Missing > 0 {
+		exitCode = common.EExitCode.Error()
+	}
+	glcm.Exit(func(format common.OutputFormat) string {
+		if format == common.EOutputFormat.Json() {
+			return common.GetJsonStringFromTemplate(summary)
+		}
+		return fmt.Sprintf("VERIFY: %v verified, %v mismatched and %v missing. Nothing was transferred or deleted.",
+			summary.Verified, summary.Mismatched, summary.Missing)
+	}, exitCode)
+}
@@ -22,7 +22,10 @@ package cmd
 
 import (
 	"fmt"
+	"math"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -83,7 +86,7 @@ func (f *excludeFilter) doesPass(storedObject storedObject) bool {
 		matched = strings.HasPrefix(storedObject.relativePath, pattern)
 	} else {
 		var err error
-		matched, err = path.Match(f.pattern, storedObject.name)
+		matched, err = matchNamePattern(f.pattern, storedObject)
 
 		// if the pattern failed to match with an error, then we assume the pattern is invalid
 		// and let it pass
@@ -99,6 +102,18 @@ func (f *excludeFilter) doesPass(storedObject storedObject) bool {
 	return true
 }
 
+// matchNamePattern matches an include or exclude pattern, in which * matches any run of characters and ? matches any one character,
+// other than '/'. Matching is case-sensitive. A pattern that contains a '/' is matched against the whole relative path of the object
+// (so "logs/*.txt" matches the .txt files directly in the logs directory); any other pattern is matched against the object's name alone,
+// wherever the object is in the tree.
+func matchNamePattern(pattern string, object storedObject) (bool, error) {
+	if strings.Contains(pattern, common.AZCOPY_PATH_SEPARATOR_STRING) {
+		relativePath := strings.ReplaceAll(object.relativePath, common.DeterminePathSeparator(object.relativePath), common.AZCOPY_PATH_SEPARATOR_STRING)
+		return path.Match(pattern, relativePath)
+	}
+	return path.Match(pattern, object.name)
+}
+
 func buildExcludeFilters(patterns []string, targetPath bool) []objectFilter {
 	filters := make([]objectFilter, 0)
 	for _, pattern := range patterns {
@@ -137,12 +152,10 @@ func (f *includeFilter) doesPass(storedObject storedObject) bool {
 	}
 
 	for _, pattern := range f.patterns {
-		checkItem := storedObject.name
-
 		matched := false
 
 		var err error
-		matched, err = path.Match(pattern, checkItem) // note: getEnumerationPreFilter below encodes assumptions about the valid wildcards used here
+		matched, err = matchNamePattern(pattern, storedObject) // note: getEnumerationPreFilter below encodes assumptions about the valid wildcards used here
 
 		// if the pattern failed to match with an error, then we assume the pattern is invalid
 		// and ignore it
@@ -171,6 +184,10 @@ func (f *includeFilter) getEnumerationPreFilter() string {
 			// this pattern doesn't just use a *, so it's too complex for us to optimize with a prefix
 			return ""
 		}
+		if strings.Contains(pat, common.AZCOPY_PATH_SEPARATOR_STRING) {
+			// this pattern matches the relative path, which can't be expressed as a prefix of the names in a directory
+			return ""
+		}
 		return strings.Split(pat, "*")[0]
 	} else {
 		// for simplicity, we won't even try computing a common prefix for all patterns (even though that might help in theory in some cases)
@@ -193,6 +210,67 @@ func buildIncludeFilters(patterns []string) []objectFilter {
 	return []objectFilter{&includeFilter{patterns: validPatterns}}
 }
 
+// design explanation:
+// like the include and exclude patterns, include regexes work in the "OR" manner and exclude regexes in the "AND" manner.
+// Since a regex filter holds all of its expressions, a single filter of each kind is sufficient.
+// The expressions are compiled once, up front, and are matched against the relative path of each object (with '/' as the separator),
+// so that they can select on directories as well as names.
+type regexFilter struct {
+	regexes    []*regexp.Regexp
+	isIncluded bool
+}
+
+func (f *regexFilter) doesSupportThisOS() (msg string, supported bool) {
+	msg = ""
+	supported = true
+	return
+}
+
+func (f *regexFilter) appliesOnlyToFiles() bool {
+	return true // like the name patterns, we treat regexes as relating to FILES only
+}
+
+func (f *regexFilter) doesPass(storedObject storedObject) bool {
+	if len(f.regexes) == 0 {
+		return true
+	}
+
+	relativePath := storedObject.relativePath
+	if separator := common.DeterminePathSeparator(relativePath); separator != common.AZCOPY_PATH_SEPARATOR_STRING {
+		relativePath = strings.ReplaceAll(relativePath, separator, common.AZCOPY_PATH_SEPARATOR_STRING)
+	}
+
+	for _, regex := range f.regexes {
+		if regex.MatchString(relativePath) {
+			return f.isIncluded
+		}
+	}
+
+	return !f.isIncluded
+}
+
+// buildRegexFilters compiles the given regular expressions, so that a bad expression is reported before any enumeration happens
+func buildRegexFilters(expressions []string, isIncluded bool) ([]objectFilter, error) {
+	regexes := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expression := range expressions {
+		if expression == "" {
+			continue
+		}
+
+		regex, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %w", expression, err)
+		}
+		regexes = append(regexes, regex)
+	}
+
+	if len(regexes) == 0 {
+		return []objectFilter{}, nil
+	}
+
+	return []objectFilter{&regexFilter{regexes: regexes, isIncluded: isIncluded}}, nil
+}
+
 type filterSet []objectFilter
 
 // GetEnumerationPreFilter returns a prefix that is common to all the include filters, or "" if no such prefix can
@@ -263,6 +341,10 @@ func (_ includeAfterDateFilter) ParseISO8601(s string, chooseEarliest bool) (tim
 	return parseISO8601(s, chooseEarliest)
 }
 
+func (_ includeAfterDateFilter) ParseISO8601OrDuration(s string, chooseEarliest bool, now time.Time) (time.Time, error) {
+	return parseISO8601OrDuration(s, chooseEarliest, now)
+}
+
 func (_ includeAfterDateFilter) FormatAsUTC(t time.Time) string {
 	return formatAsUTC(t)
 }
@@ -300,10 +382,86 @@ func (_ includeBeforeDateFilter) ParseISO8601(s string, chooseEarliest bool) (ti
 	return parseISO8601(s, chooseEarliest)
 }
 
+func (_ includeBeforeDateFilter) ParseISO8601OrDuration(s string, chooseEarliest bool, now time.Time) (time.Time, error) {
+	return parseISO8601OrDuration(s, chooseEarliest, now)
+}
+
 func (_ includeBeforeDateFilter) FormatAsUTC(t time.Time) string {
 	return formatAsUTC(t)
 }
 
+// minSizeFilter includes files whose size is >= the specified threshold
+// Filtered out files never become transfers, so they are not counted as skipped in the job summary
+type minSizeFilter struct {
+	threshold int64
+}
+
+func (f *minSizeFilter) doesSupportThisOS() (msg string, supported bool) {
+	msg = ""
+	supported = true
+	return
+}
+
+func (f *minSizeFilter) appliesOnlyToFiles() bool {
+	return true // folders don't have a meaningful size
+}
+
+func (f *minSizeFilter) doesPass(storedObject storedObject) bool {
+	return storedObject.size >= f.threshold
+}
+
+// maxSizeFilter includes files whose size is <= the specified threshold
+type maxSizeFilter struct {
+	threshold int64
+}
+
+func (f *maxSizeFilter) doesSupportThisOS() (msg string, supported bool) {
+	msg = ""
+	supported = true
+	return
+}
+
+func (f *maxSizeFilter) appliesOnlyToFiles() bool {
+	return true // folders don't have a meaningful size
+}
+
+func (f *maxSizeFilter) doesPass(storedObject storedObject) bool {
+	return storedObject.size <= f.threshold
+}
+
+var sizeFilterValueRegex = regexp.MustCompile(`^(\d+)\s*(?:([kmgt])(?:i?b)?|b)?$`)
+
+// parseSizeFilterValue parses the human-readable sizes accepted by the size filters: a whole number of bytes, optionally followed by
+// one of the units K, M, G or T (with or without a trailing B or iB, in any case). Like the rest of AzCopy, the units are powers of 1024,
+// so 10MB and 10MiB are both 10 * 1024 * 1024 bytes.
+func parseSizeFilterValue(s string, name string) (int64, error) {
+	invalidSizeError := fmt.Errorf("%s must be a whole number of bytes, optionally followed by K, M, G or T. E.g. 512, 1KB or 10MiB", name)
+
+	matches := sizeFilterValueRegex.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if matches == nil {
+		return 0, invalidSizeError
+	}
+
+	multiplier := int64(1)
+	switch matches[2] {
+	case "k":
+		multiplier = 1024
+	case "m":
+		multiplier = 1024 * 1024
+	case "g":
+		multiplier = 1024 * 1024 * 1024
+	case "t":
+		multiplier = 1024 * 1024 * 1024 * 1024
+	}
+
+	n, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || n > math.MaxInt64/multiplier {
+		return 0, invalidSizeError
+	}
+
+	return n * multiplier, nil
+}
+
 // parseISO8601 parses ISO 8601 dates. This routine is needed because GoLang's time.Parse* routines require all expected
 // elements to be present.  I.e. you can't specify just a date, and have the time default to 00:00. But ISO 8601 requires
 // that and, for usability, that's what we want.  (So that users can omit the whole time, or at least the seconds portion of it, if they wish)
@@ -355,6 +513,25 @@ func parseISO8601(s string, chooseEarliest bool) (time.Time, error) {
 	return time.Time{}, err
 }
 
+// parseISO8601OrDuration accepts either an ISO 8601 date/time, as parseISO8601 does, or a duration such as "24h" or "90m",
+// which is taken to mean that long before now. Durations allow scheduled jobs (e.g. nightly differential backups) to use the same
+// command line every time.
+func parseISO8601OrDuration(s string, chooseEarliest bool, now time.Time) (time.Time, error) {
+	// no ISO 8601 date/time is also a valid Go duration, so there's no ambiguity between the two formats
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("could not use duration '%s'. The duration must not be negative", s)
+		}
+		return now.Add(-d), nil
+	}
+
+	t, err := parseISO8601(s, chooseEarliest)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w. Alternatively, specify a duration before the current time, such as '24h'", err)
+	}
+	return t, nil
+}
+
 // formatAsUTC is inverse of parseISO8601 (and always uses the most detailed format)
 func formatAsUTC(t time.Time) string {
 	return t.UTC().Format(time.RFC3339)
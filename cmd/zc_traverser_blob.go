@@ -32,8 +32,21 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
 )
 
+// blobTraverserOptions say what, beyond the blobs themselves, a blob traverser lists or fetches
+type blobTraverserOptions struct {
+	// whether to also list each blob's snapshots, as objects of their own
+	includeSnapshots bool
+
+	// whether to fetch each blob's index tags, so that they can be carried over to the destination
+	s2sPreserveSourceTags bool
+
+	// whether to fetch each blob's immutability policy and legal hold, so that they can be carried over to the destination
+	s2sPreserveImmutability bool
+}
+
 // allow us to iterate through a path pointing to the blob endpoint
 type blobTraverser struct {
 	rawURL    *url.URL
@@ -48,6 +61,8 @@ type blobTraverser struct {
 	// whether to include blobs that have metadata 'hdi_isfolder = true'
 	includeDirectoryStubs bool
 
+	blobTraverserOptions
+
 	// a generic function to notify that a new stored object has been enumerated
 	incrementEnumerationCounter enumerationCounterFunc
 }
@@ -105,8 +120,8 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		// Don't error out unless it's a CPK error just yet
 		// If it's a CPK error, we know it's a single blob and that we can't get the properties on it anyway.
 		if stgErr.ServiceCode() == common.CPK_ERROR_SERVICE_CODE {
-			return errors.New("this blob uses customer provided encryption keys (CPK). At the moment, AzCopy does not support CPK-encrypted blobs. " +
-				"If you wish to make use of this blob, we recommend using one of the Azure Storage SDKs")
+			return errors.New("this blob uses customer provided encryption keys (CPK). To access it, use --cpk-by-value " +
+				"and give the key in the " + common.EEnvironmentVariable.CPKEncryptionKey().Name + " environment variable")
 		}
 	}
 
@@ -134,6 +149,20 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 			blobUrlParts.ContainerName,
 		)
 
+		if isBlob && t.s2sPreserveSourceTags {
+			blobURL := azblob.NewBlobURL(blobUrlParts.URL(), t.p)
+			tags, err := blobURL.GetTags(t.ctx, nil, nil, nil, nil, nil)
+			if err != nil {
+				return fmt.Errorf("cannot get the index tags of the source blob. Failed with error %s", err.Error())
+			}
+			storedObject.blobTags = blobTagsFromTagSet(tags.BlobTagSet)
+		}
+		if isBlob && t.s2sPreserveImmutability {
+			if storedObject.blobImmutability, err = t.getImmutability(azblob.NewBlobURL(blobUrlParts.URL(), t.p)); err != nil {
+				return err
+			}
+		}
+
 		if t.incrementEnumerationCounter != nil {
 			t.incrementEnumerationCounter(common.EEntityType.File())
 		}
@@ -141,6 +170,11 @@ func (t *blobTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		err := processIfPassedFilters(filters, storedObject, processor)
 		_, err = getProcessingError(err)
 
+		if isBlob && err == nil && t.includeSnapshots {
+			containerURL := azblob.NewContainerURL(copyHandlerUtil{}.getContainerUrl(blobUrlParts), t.p)
+			return t.listSnapshotsOfBlob(containerURL, blobUrlParts.ContainerName, blobUrlParts.BlobName, preprocessor, processor, filters)
+		}
+
 		// short-circuit if we don't have anything else to scan
 		if isBlob || err != nil {
 			return err
@@ -180,7 +214,7 @@ func (t *blobTraverser) parallelList(containerURL azblob.ContainerURL, container
 		currentDirPath := dir.(string)
 		for marker := (azblob.Marker{}); marker.NotDone(); {
 			lResp, err := containerURL.ListBlobsHierarchySegment(t.ctx, marker, "/", azblob.ListBlobsSegmentOptions{Prefix: currentDirPath,
-				Details: azblob.BlobListingDetails{Metadata: true}})
+				Details: azblob.BlobListingDetails{Metadata: true, Tags: t.s2sPreserveSourceTags}})
 			if err != nil {
 				return fmt.Errorf("cannot list files due to reason %s", err)
 			}
@@ -200,6 +234,11 @@ func (t *blobTraverser) parallelList(containerURL azblob.ContainerURL, container
 				}
 
 				storedObject := t.createStoredObjectForBlob(preprocessor, blobInfo, strings.TrimPrefix(blobInfo.Name, searchPrefix), containerName)
+				if t.s2sPreserveImmutability {
+					if storedObject.blobImmutability, err = t.getImmutability(containerURL.NewBlobURL(blobInfo.Name)); err != nil {
+						return err
+					}
+				}
 				enqueueOutput(storedObject, nil)
 			}
 
@@ -237,7 +276,7 @@ func (t *blobTraverser) parallelList(containerURL azblob.ContainerURL, container
 
 func (t *blobTraverser) createStoredObjectForBlob(preprocessor objectMorpher, blobInfo azblob.BlobItemInternal, relativePath string, containerName string) storedObject {
 	adapter := blobPropertiesAdapter{blobInfo.Properties}
-	return newStoredObject(
+	object := newStoredObject(
 		preprocessor,
 		getObjectNameOnly(blobInfo.Name),
 		relativePath,
@@ -249,6 +288,32 @@ func (t *blobTraverser) createStoredObjectForBlob(preprocessor objectMorpher, bl
 		common.FromAzBlobMetadataToCommonMetadata(blobInfo.Metadata),
 		containerName,
 	)
+	object.blobSnapshotID = blobInfo.Snapshot // empty for the base blob
+	if blobInfo.BlobTags != nil {
+		object.blobTags = blobTagsFromTagSet(blobInfo.BlobTags.BlobTagSet)
+	}
+	return object
+}
+
+// getImmutability gets the immutability policy and legal hold of a blob. Listings at the service version of the blob SDK don't return them.
+func (t *blobTraverser) getImmutability(blobURL azblob.BlobURL) (common.BlobImmutability, error) {
+	immutability, err := ste.GetBlobImmutability(t.ctx, blobURL.URL(), t.p)
+	if err != nil {
+		return common.BlobImmutability{}, fmt.Errorf("cannot get the immutability policy and legal hold of the source blob. Failed with error %s", err.Error())
+	}
+	return immutability, nil
+}
+
+func blobTagsFromTagSet(tagSet []azblob.BlobTag) common.BlobTags {
+	if len(tagSet) == 0 {
+		return nil
+	}
+
+	blobTags := common.BlobTags{}
+	for _, tag := range tagSet {
+		blobTags[tag.Key] = tag.Value
+	}
+	return blobTags
 }
 
 func (t *blobTraverser) doesBlobRepresentAFolder(metadata azblob.Metadata) bool {
@@ -265,7 +330,7 @@ func (t *blobTraverser) serialList(containerURL azblob.ContainerURL, containerNa
 		// look for all blobs that start with the prefix
 		// TODO optimize for the case where recursive is off
 		listBlob, err := containerURL.ListBlobsFlatSegment(t.ctx, marker,
-			azblob.ListBlobsSegmentOptions{Prefix: searchPrefix + extraSearchPrefix, Details: azblob.BlobListingDetails{Metadata: true}})
+			azblob.ListBlobsSegmentOptions{Prefix: searchPrefix + extraSearchPrefix, Details: azblob.BlobListingDetails{Metadata: true, Snapshots: t.includeSnapshots, Tags: t.s2sPreserveSourceTags}})
 		if err != nil {
 			return fmt.Errorf("cannot list blobs. Failed with error %s", err.Error())
 		}
@@ -284,6 +349,52 @@ func (t *blobTraverser) serialList(containerURL azblob.ContainerURL, containerNa
 			}
 
 			storedObject := t.createStoredObjectForBlob(preprocessor, blobInfo, relativePath, containerName)
+			if t.s2sPreserveImmutability {
+				if storedObject.blobImmutability, err = t.getImmutability(containerURL.NewBlobURL(blobInfo.Name).WithSnapshot(blobInfo.Snapshot)); err != nil {
+					return err
+				}
+			}
+			if t.incrementEnumerationCounter != nil {
+				t.incrementEnumerationCounter(common.EEntityType.File())
+			}
+
+			processErr := processIfPassedFilters(filters, storedObject, processor)
+			_, processErr = getProcessingError(processErr)
+			if processErr != nil {
+				return processErr
+			}
+		}
+
+		marker = listBlob.NextMarker
+	}
+
+	return nil
+}
+
+// listSnapshotsOfBlob processes the snapshots of the single blob that the traverser points to.
+// Like the blob itself, they have no relative path.
+func (t *blobTraverser) listSnapshotsOfBlob(containerURL azblob.ContainerURL, containerName string, blobName string,
+	preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) error {
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		listBlob, err := containerURL.ListBlobsFlatSegment(t.ctx, marker,
+			azblob.ListBlobsSegmentOptions{Prefix: blobName, Details: azblob.BlobListingDetails{Metadata: true, Snapshots: true, Tags: t.s2sPreserveSourceTags}})
+		if err != nil {
+			return fmt.Errorf("cannot list snapshots of blob. Failed with error %s", err.Error())
+		}
+
+		for _, blobInfo := range listBlob.Segment.BlobItems {
+			// other blobs may start with the same name, and the base blob has already been processed
+			if blobInfo.Name != blobName || blobInfo.Snapshot == "" {
+				continue
+			}
+
+			storedObject := t.createStoredObjectForBlob(preprocessor, blobInfo, "", containerName)
+			if t.s2sPreserveImmutability {
+				if storedObject.blobImmutability, err = t.getImmutability(containerURL.NewBlobURL(blobInfo.Name).WithSnapshot(blobInfo.Snapshot)); err != nil {
+					return err
+				}
+			}
 			if t.incrementEnumerationCounter != nil {
 				t.incrementEnumerationCounter(common.EEntityType.File())
 			}
@@ -302,9 +413,14 @@ func (t *blobTraverser) serialList(containerURL azblob.ContainerURL, containerNa
 }
 
 func newBlobTraverser(rawURL *url.URL, p pipeline.Pipeline, ctx context.Context, recursive, includeDirectoryStubs bool,
-	incrementEnumerationCounter enumerationCounterFunc) (t *blobTraverser) {
+	incrementEnumerationCounter enumerationCounterFunc, options blobTraverserOptions) (t *blobTraverser) {
 	t = &blobTraverser{rawURL: rawURL, p: p, ctx: ctx, recursive: recursive, includeDirectoryStubs: includeDirectoryStubs,
-		incrementEnumerationCounter: incrementEnumerationCounter, parallelListing: true}
+		incrementEnumerationCounter: incrementEnumerationCounter, parallelListing: true, blobTraverserOptions: options}
+
+	if options.includeSnapshots {
+		// snapshots are only listed by the flat listing API
+		t.parallelListing = false
+	}
 
 	if strings.ToLower(glcm.GetEnvironmentVariable(common.EEnvironmentVariable.DisableHierarchicalScanning())) == "true" {
 		// TODO log to frontend log that parallel listing was disabled, once the frontend log PR is merged
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/ste"
+)
+
+type blobTraverserTestSuite struct{}
+
+var _ = chk.Suite(&blobTraverserTestSuite{})
+
+// newImmutableBlobServer serves a container holding dir/a, which has an immutability policy and a legal hold, and dir/b, which has neither
+func newImmutableBlobServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("comp") == "list":
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults ContainerName="container"><Blobs>` +
+				`<Blob><Name>dir/a</Name><Properties><Last-Modified>Wed, 02 Jan 2030 15:04:05 GMT</Last-Modified><Content-Length>1</Content-Length><BlobType>BlockBlob</BlobType></Properties></Blob>` +
+				`<Blob><Name>dir/b</Name><Properties><Last-Modified>Wed, 02 Jan 2030 15:04:05 GMT</Last-Modified><Content-Length>1</Content-Length><BlobType>BlockBlob</BlobType></Properties></Blob>` +
+				`</Blobs><NextMarker/></EnumerationResults>`))
+		case strings.HasSuffix(r.URL.Path, "/dir/a"):
+			w.Header().Set("Last-Modified", "Wed, 02 Jan 2030 15:04:05 GMT")
+			w.Header().Set("x-ms-blob-type", "BlockBlob")
+			if r.Header.Get("x-ms-version") == "2020-10-02" {
+				w.Header().Set("x-ms-immutability-policy-until-date", "Thu, 02 Jan 2031 15:04:05 GMT")
+				w.Header().Set("x-ms-immutability-policy-mode", "locked")
+				w.Header().Set("x-ms-legal-hold", "true")
+			}
+			w.WriteHeader(http.StatusOK)
+		case strings.HasSuffix(r.URL.Path, "/dir/b"):
+			w.Header().Set("Last-Modified", "Wed, 02 Jan 2030 15:04:05 GMT")
+			w.Header().Set("x-ms-blob-type", "BlockBlob")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func (s *blobTraverserTestSuite) TestImmutabilityIsEnumerated(c *chk.C) {
+	server := newImmutableBlobServer()
+	defer server.Close()
+	p := pipeline.NewPipeline([]pipeline.Factory{ste.NewVersionPolicyFactory(), pipeline.MethodFactoryMarker()}, pipeline.Options{})
+	want := common.BlobImmutability{
+		PolicyExpiresOn: time.Date(2031, 1, 2, 15, 4, 5, 0, time.UTC),
+		PolicyMode:      common.EImmutabilityPolicyMode.Locked(),
+		LegalHold:       true,
+	}
+
+	for _, parallelListing := range []bool{false, true} {
+		containerURL, _ := url.Parse(server.URL + "/account/container/dir/")
+		traverser := newBlobTraverser(containerURL, p, context.Background(), true, false, nil, blobTraverserOptions{s2sPreserveImmutability: true})
+		traverser.parallelListing = parallelListing
+		found := map[string]common.BlobImmutability{}
+		err := traverser.traverse(noPreProccessor, func(object storedObject) error {
+			found[object.relativePath] = object.blobImmutability
+			return nil
+		}, nil)
+		c.Assert(err, chk.IsNil)
+		c.Assert(found, chk.HasLen, 2)
+		c.Assert(found["a"].PolicyExpiresOn.Equal(want.PolicyExpiresOn), chk.Equals, true)
+		c.Assert(found["a"].PolicyMode, chk.Equals, want.PolicyMode)
+		c.Assert(found["a"].LegalHold, chk.Equals, true)
+		c.Assert(found["b"], chk.DeepEquals, common.BlobImmutability{})
+	}
+
+	// a single blob
+	blobURL, _ := url.Parse(server.URL + "/account/container/dir/a")
+	var found []common.BlobImmutability
+	err := newBlobTraverser(blobURL, p, context.Background(), false, false, nil, blobTraverserOptions{s2sPreserveImmutability: true}).traverse(noPreProccessor, func(object storedObject) error {
+		found = append(found, object.blobImmutability)
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(found, chk.HasLen, 1)
+	c.Assert(found[0].PolicyExpiresOn.Equal(want.PolicyExpiresOn), chk.Equals, true)
+	c.Assert(found[0].LegalHold, chk.Equals, true)
+
+	// without the flag, they aren't fetched
+	found = nil
+	err = newBlobTraverser(blobURL, p, context.Background(), false, false, nil, blobTraverserOptions{}).traverse(noPreProccessor, func(object storedObject) error {
+		found = append(found, object.blobImmutability)
+		return nil
+	}, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(found, chk.DeepEquals, []common.BlobImmutability{{}})
+}
@@ -21,9 +21,14 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 )
@@ -47,8 +52,9 @@ func (l *listTraverser) isDirectory(bool) bool {
 // Behavior demonstrated: https://play.golang.org/p/OYdvLmNWgwO
 func (l *listTraverser) traverse(preprocessor objectMorpher, processor objectProcessor, filters []objectFilter) (err error) {
 	// read a channel until it closes to get a list of objects
-	childPath, ok := <-l.listReader
-	for ; ok; childPath, ok = <-l.listReader {
+	entry, ok := <-l.listReader
+	for ; ok; entry, ok = <-l.listReader {
+		childPath, childDstPath := splitListOfFilesEntry(entry)
 
 		// fetch an appropriate traverser, and go through the child path, which could be
 		//   1. a single entity
@@ -73,7 +79,11 @@ func (l *listTraverser) traverse(preprocessor objectMorpher, processor objectPro
 		// case 2: child2 is a directory, and it has items under it such as child2/grandchild1
 		//         the relative path returned by the child traverser would be "grandchild1"
 		//         it should be "child2/grandchild1" instead
+		// the same goes for the destination, when the list names it
 		childPreProcessor := func(object *storedObject) {
+			if childDstPath != "" {
+				object.dstRelativePath = common.GenerateFullPath(childDstPath, object.relativePath)
+			}
 			object.relativePath = common.GenerateFullPath(childPath, object.relativePath)
 		}
 		preProcessorForThisChild := preprocessor.FollowedBy(childPreProcessor)
@@ -88,7 +98,7 @@ func (l *listTraverser) traverse(preprocessor objectMorpher, processor objectPro
 }
 
 func newListTraverser(parent common.ResourceString, parentType common.Location, credential *common.CredentialInfo, ctx *context.Context,
-	recursive, followSymlinks, getProperties bool, listChan chan string, includeDirectoryStubs bool, incrementEnumerationCounter enumerationCounterFunc) resourceTraverser {
+	recursive, followSymlinks, getProperties bool, listChan chan string, includeDirectoryStubs bool, incrementEnumerationCounter enumerationCounterFunc, s2sPreserveImmutability bool) resourceTraverser {
 	var traverserGenerator childTraverserGenerator
 
 	traverserGenerator = func(relativeChildPath string) (resourceTraverser, error) {
@@ -104,7 +114,7 @@ func newListTraverser(parent common.ResourceString, parentType common.Location,
 		}
 
 		// Construct a traverser that goes through the child
-		traverser, err := initResourceTraverser(source, parentType, ctx, credential, &followSymlinks, nil, recursive, getProperties, includeDirectoryStubs, incrementEnumerationCounter, nil)
+		traverser, err := initResourceTraverser(source, parentType, ctx, credential, &followSymlinks, nil, recursive, getProperties, includeDirectoryStubs, incrementEnumerationCounter, nil, blobTraverserOptions{s2sPreserveImmutability: s2sPreserveImmutability})
 		if err != nil {
 			return nil, err
 		}
@@ -117,3 +127,122 @@ func newListTraverser(parent common.ResourceString, parentType common.Location,
 		childTraverserGenerator: traverserGenerator,
 	}
 }
+
+// listOfFilesEntrySeparator separates the source path of an entry that a list traverser reads from the destination path, if it has one.
+// No path can hold a NUL, so unlike a tab, it can't be part of a source path.
+const listOfFilesEntrySeparator = "\x00"
+
+// listOfFilesReader reads a list of files, one path relative to the source per line, and the list of destinations that goes with it, if there is one.
+// Line n of the list of destinations holds a path relative to the destination, which the source on line n of the list of files is copied to
+// instead of to its own relative path. An empty line leaves that source at its own relative path.
+type listOfFilesReader struct {
+	files        *bufio.Scanner
+	destinations *bufio.Scanner // nil if there's no list of destinations
+	lineNum      int
+}
+
+func newListOfFilesReader(files io.Reader, destinations io.Reader) *listOfFilesReader {
+	r := &listOfFilesReader{files: bufio.NewScanner(files)}
+	if destinations != nil {
+		r.destinations = bufio.NewScanner(destinations)
+	}
+	return r
+}
+
+// next returns the line number and source path of the next line of the list of files, and the destination path that goes with it,
+// which is empty unless the list of destinations names one. ok is false once the list of files ends.
+// The error describes what is wrong with the line, or with the lists as a whole (e.g. if they don't have the same number of lines).
+func (r *listOfFilesReader) next() (lineNum int, src string, dst string, ok bool, err error) {
+	if !r.files.Scan() {
+		if err := r.files.Err(); err != nil {
+			return r.lineNum, "", "", false, fmt.Errorf("cannot read the list of files: %w", err)
+		}
+		if r.destinations != nil && r.destinations.Scan() {
+			return r.lineNum + 1, "", "", false, errors.New("the list of destinations has more lines than the list of files")
+		}
+		return r.lineNum, "", "", false, nil
+	}
+	r.lineNum++
+	src = r.files.Text()
+	if r.destinations != nil {
+		if !r.destinations.Scan() {
+			if err := r.destinations.Err(); err != nil {
+				return r.lineNum, src, "", true, fmt.Errorf("cannot read the list of destinations: %w", err)
+			}
+			return r.lineNum, src, "", true, errors.New("the list of destinations has fewer lines than the list of files")
+		}
+		dst = r.destinations.Text()
+	}
+
+	// The UTF-8 byte order marker, if there is one, is on the same line as the first line of actual data, so just use TrimPrefix.
+	if r.lineNum == 1 {
+		src = strings.TrimPrefix(src, utf8BOM)
+		dst = strings.TrimPrefix(dst, utf8BOM)
+	}
+	return r.lineNum, src, dst, true, checkListOfFilesDestination(src, dst)
+}
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// checkListOfFilesDestination checks the destination path that the list of destinations gives a source path
+func checkListOfFilesDestination(src, dst string) error {
+	if dst == "" {
+		return nil
+	}
+	if src == "" {
+		return errors.New("the list of destinations names a destination for an empty line of the list of files")
+	}
+	for _, segment := range strings.FieldsFunc(dst, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return fmt.Errorf("the destination path %s must not go above the destination, with '..'", dst)
+		}
+	}
+	return nil
+}
+
+// checkListOfFilesAndRewind reads the whole of a list of files, and of the list of destinations if there is one, so that a malformed line
+// fails the command before anything is enumerated, rather than once part of the job is already running.
+// It then rewinds them, ready to be enumerated.
+func checkListOfFilesAndRewind(files *os.File, destinations *os.File) error {
+	var destinationsReader io.Reader
+	if destinations != nil {
+		destinationsReader = destinations
+	}
+	reader := newListOfFilesReader(files, destinationsReader)
+	for {
+		lineNum, _, _, ok, err := reader.next()
+		if err != nil {
+			return fmt.Errorf("line %d of the list of files is malformed: %w", lineNum, err)
+		}
+		if !ok {
+			break
+		}
+	}
+
+	if _, err := files.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if destinations != nil {
+		if _, err := destinations.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listOfFilesEntry returns the entry that a list traverser reads for a source path and its destination path, which is empty if it has none
+func listOfFilesEntry(src, dst string) string {
+	if dst == "" {
+		return src
+	}
+	return src + listOfFilesEntrySeparator + dst
+}
+
+// splitListOfFilesEntry returns the source and destination paths of an entry returned by listOfFilesEntry.
+// The destination is empty if the entry doesn't name one.
+func splitListOfFilesEntry(entry string) (src string, dst string) {
+	if i := strings.Index(entry, listOfFilesEntrySeparator); i >= 0 {
+		return entry[:i], entry[i+len(listOfFilesEntrySeparator):]
+	}
+	return entry, ""
+}
@@ -72,6 +72,7 @@ func getDefaultRawCopyInput(src, dst string) rawCopyCmdArgs {
 		dst:                            dst,
 		recursive:                      true,
 		logVerbosity:                   defaultLogVerbosityForCopy,
+		logFormat:                      common.ELogFormat.Text().String(),
 		output:                         defaultOutputFormatForCopy,
 		blobType:                       defaultBlobTypeForCopy,
 		blockBlobTier:                  defaultBlockBlobTierForCopy,
@@ -84,6 +85,10 @@ func getDefaultRawCopyInput(src, dst string) rawCopyCmdArgs {
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
 		preserveOwner:                  common.PreserveOwnerDefault,
+		preserveLastModifiedTime:       common.PreserveLastModifiedTimeDefault,
+		destinationCollisionOption:     common.DefaultDestinationCollisionOption.String(),
+		prefixMismatchOption:           common.DefaultPrefixMismatchOption.String(),
+		transferOrder:                  common.ETransferOrder.Plan().String(),
 	}
 }
 
@@ -78,6 +78,79 @@ func (s *genericFilterSuite) TestExcludeFilter(c *chk.C) {
 	}
 }
 
+func (s *genericFilterSuite) TestPatternFiltersOnRelativePath(c *chk.C) {
+	// set up the filters
+	raw := rawSyncCmdArgs{}
+	filters := buildIncludeFilters(raw.parsePatterns("*.pdf;reports/*/summary.docx;data?.csv"))
+	filters = append(filters, buildExcludeFilters(raw.parsePatterns("draft*;reports/2019/*"), false)...)
+
+	// test the positive cases
+	objectsToPass := []storedObject{
+		{name: "bla.pdf", relativePath: "bla.pdf"},
+		{name: "bla.pdf", relativePath: "some/nested/dir/bla.pdf"},        // patterns without a '/' match the name at any depth
+		{name: "summary.docx", relativePath: "reports/2020/summary.docx"}, // patterns with a '/' match the relative path
+		{name: "data1.csv", relativePath: "nested/data1.csv"},             // ? matches a single character
+	}
+	for _, object := range objectsToPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, object, dummyProcessor.process)
+		c.Assert(err, chk.IsNil, chk.Commentf(object.relativePath))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 1)
+	}
+
+	// test the negative cases
+	objectsToNotPass := []storedObject{
+		{name: "bla.PDF", relativePath: "bla.PDF"},                               // patterns are case-sensitive
+		{name: "summary.docx", relativePath: "summary.docx"},                     // not under reports/<dir>
+		{name: "summary.docx", relativePath: "reports/2020/nested/summary.docx"}, // * does not match a '/'
+		{name: "data12.csv", relativePath: "data12.csv"},                         // ? matches exactly one character
+		{name: "draft.pdf", relativePath: "nested/draft.pdf"},                    // exclude wins over include
+		{name: "summary.docx", relativePath: "reports/2019/summary.docx"},        // exclude on relative path wins over include
+	}
+	for _, object := range objectsToNotPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, object, dummyProcessor.process)
+		c.Assert(err, chk.Equals, ignoredError, chk.Commentf(object.relativePath))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 0)
+	}
+
+	// patterns on the relative path can't be turned into a listing prefix
+	c.Assert(buildIncludeFilters(raw.parsePatterns("reports*/summary.docx"))[0].(*includeFilter).getEnumerationPreFilter(), chk.Equals, "")
+}
+
+func (s *genericFilterSuite) TestRegexFilters(c *chk.C) {
+	// set up the filters
+	raw := rawCopyCmdArgs{}
+	includeFilters, err := buildRegexFilters(raw.parsePatterns(`^reports/20[0-9]{2}/.*\.pdf$;\.csv$`), true)
+	c.Assert(err, chk.IsNil)
+	excludeFilters, err := buildRegexFilters(raw.parsePatterns(`(^|/)draft`), false)
+	c.Assert(err, chk.IsNil)
+	filters := append(includeFilters, excludeFilters...)
+
+	// test the positive cases
+	pathsToPass := []string{"reports/2019/q1.pdf", "reports/2020/nested/q2.pdf", "data.csv", "nested/data.csv"}
+	for _, relativePath := range pathsToPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, storedObject{relativePath: relativePath}, dummyProcessor.process)
+		c.Assert(err, chk.IsNil, chk.Commentf(relativePath))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 1)
+	}
+
+	// test the negative cases
+	pathsToNotPass := []string{"reports/19/q1.pdf", "old/reports/2019/q1.pdf", "data.csv.bak", "reports/2019/draft.pdf", "draft/data.csv"}
+	for _, relativePath := range pathsToNotPass {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, storedObject{relativePath: relativePath}, dummyProcessor.process)
+		c.Assert(err, chk.Equals, ignoredError, chk.Commentf(relativePath))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 0)
+	}
+
+	// invalid expressions are rejected up front
+	_, err = buildRegexFilters([]string{"valid", "(unclosed"}, true)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "(unclosed"), chk.Equals, true)
+}
+
 func (s *genericFilterSuite) TestDateParsingForIncludeAfter(c *chk.C) {
 	examples := []struct {
 		input                 string // ISO 8601
@@ -130,6 +203,105 @@ func (s *genericFilterSuite) TestDateParsingForIncludeAfter(c *chk.C) {
 	}
 }
 
+func (s *genericFilterSuite) TestDateParsingForIncludeAfter_AcceptsDurations(c *chk.C) {
+	now := time.Date(2020, 8, 19, 15, 4, 0, 0, time.UTC)
+
+	t, err := includeAfterDateFilter{}.ParseISO8601OrDuration("24h", true, now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(t.Equal(now.Add(-24*time.Hour)), chk.Equals, true)
+
+	t, err = includeAfterDateFilter{}.ParseISO8601OrDuration("1h30m", true, now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(t.Equal(now.Add(-90*time.Minute)), chk.Equals, true)
+
+	// dates are still accepted, irrespective of the current time
+	t, err = includeAfterDateFilter{}.ParseISO8601OrDuration("2019-01-31T18:30:15Z", true, now)
+	c.Assert(err, chk.IsNil)
+	c.Assert(t.Equal(time.Date(2019, 1, 31, 18, 30, 15, 0, time.UTC)), chk.Equals, true)
+
+	// negative durations and garbage are rejected
+	_, err = includeAfterDateFilter{}.ParseISO8601OrDuration("-24h", true, now)
+	c.Assert(err, chk.NotNil)
+	_, err = includeAfterDateFilter{}.ParseISO8601OrDuration("24", true, now)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "duration"), chk.Equals, true)
+}
+
+func (s *genericFilterSuite) TestDateFiltersAtBoundaries(c *chk.C) {
+	threshold := time.Date(2020, 8, 19, 15, 4, 0, 0, time.UTC)
+	// the same instant, expressed in another timezone, must be treated as equal
+	sameInstantElsewhere := threshold.In(time.FixedZone("UTC+11:30", 11*60*60+30*60))
+
+	after := &includeAfterDateFilter{threshold: threshold}
+	before := &includeBeforeDateFilter{threshold: threshold}
+
+	examples := []struct {
+		lmt          time.Time
+		passesAfter  bool
+		passesBefore bool
+	}{
+		{threshold, true, true},
+		{sameInstantElsewhere, true, true},
+		{threshold.Add(-time.Nanosecond), false, true},
+		{threshold.Add(time.Nanosecond), true, false},
+		{threshold.Add(-time.Second), false, true},
+		{threshold.Add(time.Second), true, false},
+	}
+
+	for _, x := range examples {
+		object := storedObject{lastModifiedTime: x.lmt}
+		c.Check(after.doesPass(object), chk.Equals, x.passesAfter, chk.Commentf(x.lmt.String()))
+		c.Check(before.doesPass(object), chk.Equals, x.passesBefore, chk.Commentf(x.lmt.String()))
+	}
+}
+
+func (s *genericFilterSuite) TestParseSizeFilterValue(c *chk.C) {
+	examples := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"1k", 1024},
+		{"1KB", 1024},
+		{"10MB", 10 * 1024 * 1024},
+		{"10 MiB", 10 * 1024 * 1024},
+		{"2G", 2 * 1024 * 1024 * 1024},
+		{"1TB", 1024 * 1024 * 1024 * 1024},
+	}
+	for _, x := range examples {
+		size, err := parseSizeFilterValue(x.input, "min-size")
+		c.Assert(err, chk.IsNil, chk.Commentf(x.input))
+		c.Assert(size, chk.Equals, x.expected, chk.Commentf(x.input))
+	}
+
+	for _, input := range []string{"", "-1", "1.5MB", "MB", "1ib", "10XB", "99999999999T"} {
+		_, err := parseSizeFilterValue(input, "min-size")
+		c.Assert(err, chk.NotNil, chk.Commentf(input))
+		c.Assert(strings.Contains(err.Error(), "min-size"), chk.Equals, true)
+	}
+}
+
+func (s *genericFilterSuite) TestSizeFiltersAtBoundaries(c *chk.C) {
+	filters := []objectFilter{&minSizeFilter{threshold: 1024}, &maxSizeFilter{threshold: 10 * 1024 * 1024}}
+
+	// the bounds themselves are included
+	for _, size := range []int64{1024, 1025, 10*1024*1024 - 1, 10 * 1024 * 1024} {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, storedObject{size: size}, dummyProcessor.process)
+		c.Assert(err, chk.IsNil, chk.Commentf("%d", size))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 1)
+	}
+
+	for _, size := range []int64{0, 1023, 10*1024*1024 + 1} {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, storedObject{size: size}, dummyProcessor.process)
+		c.Assert(err, chk.Equals, ignoredError, chk.Commentf("%d", size))
+		c.Assert(len(dummyProcessor.record), chk.Equals, 0)
+	}
+}
+
 // When daylight savings ends, in the fall, there's one ambiguous hour (in US timezones, for example, the repeated hour is 1 to 2 am
 // on the first Sunday in November).  For the purposes of include-after, we should use the FIRST of the two possible times.
 // (If we use the last, we might miss file changes that happened in the hour before it. This could result in regular running
@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -421,7 +422,7 @@ func (s *genericTraverserSuite) TestTraverserWithSingleObject(c *chk.C) {
 		ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 		p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
 		rawBlobURLWithSAS := scenarioHelper{}.getRawBlobURLWithSAS(c, containerName, blobList[0])
-		blobTraverser := newBlobTraverser(&rawBlobURLWithSAS, p, ctx, false, false, func(common.EntityType) {})
+		blobTraverser := newBlobTraverser(&rawBlobURLWithSAS, p, ctx, false, false, func(common.EntityType) {}, blobTraverserOptions{})
 
 		// invoke the blob traversal with a dummy processor
 		blobDummyProcessor := dummyProcessor{}
@@ -554,7 +555,7 @@ func (s *genericTraverserSuite) TestTraverserContainerAndLocalDirectory(c *chk.C
 		ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 		p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
 		rawContainerURLWithSAS := scenarioHelper{}.getRawContainerURLWithSAS(c, containerName)
-		blobTraverser := newBlobTraverser(&rawContainerURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {})
+		blobTraverser := newBlobTraverser(&rawContainerURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {}, blobTraverserOptions{})
 
 		// invoke the local traversal with a dummy processor
 		blobDummyProcessor := dummyProcessor{}
@@ -694,7 +695,7 @@ func (s *genericTraverserSuite) TestTraverserWithVirtualAndLocalDirectory(c *chk
 		ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 		p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
 		rawVirDirURLWithSAS := scenarioHelper{}.getRawBlobURLWithSAS(c, containerName, virDirName)
-		blobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {})
+		blobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {}, blobTraverserOptions{})
 
 		// invoke the local traversal with a dummy processor
 		blobDummyProcessor := dummyProcessor{}
@@ -791,10 +792,10 @@ func (s *genericTraverserSuite) TestSerialAndParallelBlobTraverser(c *chk.C) {
 		ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 		p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
 		rawVirDirURLWithSAS := scenarioHelper{}.getRawBlobURLWithSAS(c, containerName, virDirName)
-		parallelBlobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {})
+		parallelBlobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {}, blobTraverserOptions{})
 
 		// construct a serial blob traverser
-		serialBlobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {})
+		serialBlobTraverser := newBlobTraverser(&rawVirDirURLWithSAS, p, ctx, isRecursiveOn, false, func(common.EntityType) {}, blobTraverserOptions{})
 		serialBlobTraverser.parallelListing = false
 
 		// invoke the parallel traversal with a dummy processor
@@ -824,3 +825,101 @@ func (s *genericTraverserSuite) TestSerialAndParallelBlobTraverser(c *chk.C) {
 		}
 	}
 }
+
+func (s *genericTraverserSuite) TestListOfFilesReader(c *chk.C) {
+	type line struct{ src, dst string }
+	read := func(files string, destinations io.Reader) (lines []line, err error) {
+		reader := newListOfFilesReader(strings.NewReader(files), destinations)
+		for {
+			_, src, dst, ok, err := reader.next()
+			if err != nil || !ok {
+				return lines, err
+			}
+			lines = append(lines, line{src, dst})
+		}
+	}
+
+	// a tab is part of a source name, and the byte order marker isn't
+	lines, err := read("\xEF\xBB\xBFa.txt\n\ndir/sub\nname\twith a tab.txt\nb.txt", strings.NewReader("\xEF\xBB\xBF\n\nelsewhere\nrenamed.txt\n\n"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(lines, chk.DeepEquals, []line{{"a.txt", ""}, {"", ""}, {"dir/sub", "elsewhere"}, {"name\twith a tab.txt", "renamed.txt"}, {"b.txt", ""}})
+	_, err = read("a.txt\nb.txt", strings.NewReader("x\ny\n"))
+	c.Assert(err, chk.IsNil)
+
+	// without a list of destinations, every source stays at its own relative path
+	lines, err = read("a.txt\nb\tc.txt\n", nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(lines, chk.DeepEquals, []line{{"a.txt", ""}, {"b\tc.txt", ""}})
+
+	for _, lists := range [][2]string{
+		{"a.txt\n\nc.txt", "\nb.txt\n"},       // a destination for an empty line
+		{"a.txt", "../outside.txt"},           // above the destination
+		{"a.txt", "dir\\..\\..\\outside.txt"}, // above it on Windows
+		{"a.txt\nb.txt\n", "x\n"},             // too few destinations
+		{"a.txt", "x\ny"},                     // too many
+	} {
+		_, err := read(lists[0], strings.NewReader(lists[1]))
+		c.Assert(err, chk.NotNil, chk.Commentf("%q, %q", lists[0], lists[1]))
+	}
+
+	src, dst := splitListOfFilesEntry(listOfFilesEntry("name\twith a tab.txt", "other/renamed.txt"))
+	c.Assert(src, chk.Equals, "name\twith a tab.txt")
+	c.Assert(dst, chk.Equals, "other/renamed.txt")
+	src, dst = splitListOfFilesEntry(listOfFilesEntry("dir/file.txt", ""))
+	c.Assert(src, chk.Equals, "dir/file.txt")
+	c.Assert(dst, chk.Equals, "")
+}
+
+func (s *genericTraverserSuite) TestCheckListOfFilesAndRewind(c *chk.C) {
+	open := func(lines ...string) *os.File {
+		f, err := os.Open(scenarioHelper{}.generateListOfFiles(c, lines))
+		c.Assert(err, chk.IsNil)
+		return f
+	}
+
+	// the whole list is read, to find a malformed line at its end
+	files, destinations := open("a.txt", "b.txt", "c.txt"), open("", "", "../c.txt")
+	defer files.Close()
+	defer destinations.Close()
+	c.Assert(checkListOfFilesAndRewind(files, destinations), chk.ErrorMatches, "line 3 of the list of files is malformed: .*")
+
+	// a well-formed list can be read again from its start
+	files, destinations = open("a.txt", "b.txt"), open("", "renamed.txt")
+	defer files.Close()
+	defer destinations.Close()
+	c.Assert(checkListOfFilesAndRewind(files, destinations), chk.IsNil)
+	_, src, dst, ok, err := newListOfFilesReader(files, destinations).next()
+	c.Assert(err, chk.IsNil)
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(src, chk.Equals, "a.txt")
+	c.Assert(dst, chk.Equals, "")
+}
+
+func (s *genericTraverserSuite) TestListTraverserWithDestinations(c *chk.C) {
+	srcDirName := scenarioHelper{}.generateLocalDirectory(c)
+	defer os.RemoveAll(srcDirName)
+	scenarioHelper{}.generateLocalFilesFromList(c, srcDirName, []string{"a.txt", "b.txt", "dir/c.txt", "dir/sub/d.txt", "unlisted.txt"})
+
+	listChan := make(chan string, 3)
+	listChan <- "a.txt"
+	listChan <- listOfFilesEntry("b.txt", "renamed/b.txt")
+	listChan <- listOfFilesEntry("dir", "elsewhere")
+	close(listChan)
+	traverser := newListTraverser(common.ResourceString{Value: srcDirName}, common.ELocation.Local(), nil, nil, true, false, false, listChan, false, func(common.EntityType) {}, false)
+
+	indexer := newObjectIndexer()
+	c.Assert(traverser.traverse(noPreProccessor, indexer.store, nil), chk.IsNil)
+
+	destinations := make(map[string]string)
+	for relativePath, object := range indexer.indexMap {
+		if object.entityType == common.EEntityType.File() {
+			destinations[relativePath] = object.dstRelativePath
+		}
+	}
+	c.Assert(destinations, chk.DeepEquals, map[string]string{
+		"a.txt":         "", // as usual, at the same relative path
+		"b.txt":         "renamed/b.txt",
+		"dir/c.txt":     "elsewhere/c.txt",
+		"dir/sub/d.txt": "elsewhere/sub/d.txt",
+	})
+}
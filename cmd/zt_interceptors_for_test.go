@@ -124,6 +124,9 @@ func (*mockedLifecycleManager) GetEnvironmentVariable(env common.EnvironmentVari
 func (*mockedLifecycleManager) SetOutputFormat(common.OutputFormat) {}
 func (*mockedLifecycleManager) EnableInputWatcher()                 {}
 func (*mockedLifecycleManager) EnableCancelFromStdIn()              {}
+func (*mockedLifecycleManager) EnableBandwidthCapFromStdIn(_ func(float64)) {
+	// not implemented in mocked version
+}
 func (*mockedLifecycleManager) AddUserAgentPrefix(userAgent string) string {
 	return userAgent
 }
@@ -0,0 +1,56 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	chk "gopkg.in/check.v1"
+)
+
+type jobPlanLocationSuite struct{}
+
+var _ = chk.Suite(&jobPlanLocationSuite{})
+
+func (s *jobPlanLocationSuite) TestPrepareJobPlanFolder(c *chk.C) {
+	// a folder that doesn't exist yet is created, along with its parents
+	folder := filepath.Join(c.MkDir(), "custom", "plans")
+	c.Assert(prepareJobPlanFolder(folder), chk.IsNil)
+	info, err := os.Stat(folder)
+	c.Assert(err, chk.IsNil)
+	c.Assert(info.IsDir(), chk.Equals, true)
+
+	// and the write check leaves nothing behind
+	entries, err := ioutil.ReadDir(folder)
+	c.Assert(err, chk.IsNil)
+	c.Assert(entries, chk.HasLen, 0)
+
+	// a location that can't be a folder is reported, mentioning how to choose another
+	notAFolder := filepath.Join(folder, "file")
+	c.Assert(ioutil.WriteFile(notAFolder, nil, 0644), chk.IsNil)
+	err = prepareJobPlanFolder(notAFolder)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), notAFolder), chk.Equals, true)
+	c.Assert(strings.Contains(err.Error(), "--job-plan-location"), chk.Equals, true)
+}
@@ -58,6 +58,16 @@ func (s *pathUtilsSuite) TestStripQueryFromSaslessUrl(c *chk.C) {
 	}
 }
 
+func (s *pathUtilsSuite) TestVersionIDFromQuery(c *chk.C) {
+	blob, err := SplitResourceString("https://account.blob.core.windows.net/container/blob?versionId=2020-10-22T07:48:06.1234567Z", common.ELocation.Blob())
+	c.Assert(err, chk.IsNil)
+	c.Assert(versionIDFromQuery(blob.ExtraQuery), chk.Equals, "2020-10-22T07:48:06.1234567Z")
+
+	c.Assert(versionIDFromQuery("snapshot=abc&VERSIONID=v1"), chk.Equals, "v1")
+	c.Assert(versionIDFromQuery("snapshot=abc"), chk.Equals, "")
+	c.Assert(versionIDFromQuery(""), chk.Equals, "")
+}
+
 func (s *pathUtilsSuite) TestToReversedString(c *chk.C) {
 	t := &benchmarkTraverser{}
 	c.Assert("1", chk.Equals, t.toReversedString(1))
@@ -0,0 +1,76 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type sasExpirySuite struct{}
+
+var _ = chk.Suite(&sasExpirySuite{})
+
+func (s *sasExpirySuite) TestValidateSASNotExpired(c *chk.C) {
+	now := time.Date(2020, 10, 22, 12, 0, 0, 0, time.UTC)
+
+	err := validateSASNotExpired("?sv=2019-12-12&se=2020-10-22T11:59:00Z&sig=x", "source", now)
+	c.Assert(err, chk.NotNil)
+	c.Assert(err.Error(), chk.Equals, "the SAS token of the source expired at 2020-10-22T11:59:00Z. Please use a new SAS token")
+
+	// a date without a time is accepted too
+	c.Assert(validateSASNotExpired("se=2020-10-21&sig=x", "destination", now), chk.NotNil)
+
+	c.Assert(validateSASNotExpired("se=2020-10-22T12:01:00Z&sig=x", "source", now), chk.IsNil)
+	c.Assert(validateSASNotExpired("", "source", now), chk.IsNil)
+	c.Assert(validateSASNotExpired("sv=2019-12-12&sig=x", "source", now), chk.IsNil) // no expiry to check
+}
+
+func (s *sasExpirySuite) TestSASExpiryWarning(c *chk.C) {
+	now := time.Date(2020, 10, 22, 12, 0, 0, 0, time.UTC)
+	summary := common.ListJobSummaryResponse{
+		CompleteJobOrdered:    true,
+		TotalBytesPlanned:     10000,
+		BytesCompleted:        1000,
+		TotalBytesTransferred: 1000,
+	}
+
+	// 1000 bytes in 100s leaves 900s to go, which would finish before expiry
+	w := newSASExpiryWatcher("se=2020-10-22T12:20:00Z", "se=2020-10-22T13:00:00Z")
+	c.Assert(w.check(summary, 100*time.Second, now), chk.Equals, "")
+
+	// but not if the earlier token expires in 10 minutes. We only warn once.
+	w = newSASExpiryWatcher("se=2020-10-22T13:00:00Z", "se=2020-10-22T12:10:00Z")
+	c.Assert(w.check(summary, 100*time.Second, now), chk.Not(chk.Equals), "")
+	c.Assert(w.check(summary, 100*time.Second, now), chk.Equals, "")
+
+	// until the whole job is ordered, its size is not known
+	w = newSASExpiryWatcher("se=2020-10-22T12:10:00Z")
+	summary.CompleteJobOrdered = false
+	c.Assert(w.check(summary, 100*time.Second, now), chk.Equals, "")
+
+	// tokens that do not expire need no watching
+	noWatcher := newSASExpiryWatcher("sig=x", "")
+	c.Assert(noWatcher, chk.IsNil)
+	c.Assert(noWatcher.check(summary, 100*time.Second, now), chk.Equals, "")
+}
@@ -750,6 +750,9 @@ func getDefaultSyncRawInput(src, dst string) rawSyncCmdArgs {
 		dst:                 dst,
 		recursive:           true,
 		logVerbosity:        defaultLogVerbosityForSync,
+		logFormat:           common.ELogFormat.Text().String(),
+		transferOrder:       common.ETransferOrder.Plan().String(),
+		maxRetries:          -1,
 		deleteDestination:   deleteDestination.String(),
 		md5ValidationOption: common.DefaultHashValidationOption.String(),
 	}
@@ -760,6 +763,7 @@ func getDefaultCopyRawInput(src string, dst string) rawCopyCmdArgs {
 		src:                            src,
 		dst:                            dst,
 		logVerbosity:                   defaultLogVerbosityForSync,
+		logFormat:                      common.ELogFormat.Text().String(),
 		blobType:                       common.EBlobType.Detect().String(),
 		blockBlobTier:                  common.EBlockBlobTier.None().String(),
 		pageBlobTier:                   common.EPageBlobTier.None().String(),
@@ -767,6 +771,11 @@ func getDefaultCopyRawInput(src string, dst string) rawCopyCmdArgs {
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
 		preserveOwner:                  common.PreserveOwnerDefault,
+		preserveLastModifiedTime:       common.PreserveLastModifiedTimeDefault,
+		destinationCollisionOption:     common.DefaultDestinationCollisionOption.String(),
+		prefixMismatchOption:           common.DefaultPrefixMismatchOption.String(),
+		transferOrder:                  common.ETransferOrder.Plan().String(),
+		maxRetries:                     -1,
 	}
 }
 
@@ -784,6 +793,7 @@ func getDefaultRemoveRawInput(src string) rawCopyCmdArgs {
 		src:                            src,
 		fromTo:                         fromTo.String(),
 		logVerbosity:                   defaultLogVerbosityForSync,
+		logFormat:                      common.ELogFormat.Text().String(),
 		blobType:                       common.EBlobType.Detect().String(),
 		blockBlobTier:                  common.EBlockBlobTier.None().String(),
 		pageBlobTier:                   common.EPageBlobTier.None().String(),
@@ -791,6 +801,11 @@ func getDefaultRemoveRawInput(src string) rawCopyCmdArgs {
 		s2sInvalidMetadataHandleOption: defaultS2SInvalideMetadataHandleOption.String(),
 		forceWrite:                     common.EOverwriteOption.True().String(),
 		preserveOwner:                  common.PreserveOwnerDefault,
+		preserveLastModifiedTime:       common.PreserveLastModifiedTimeDefault,
+		destinationCollisionOption:     common.DefaultDestinationCollisionOption.String(),
+		prefixMismatchOption:           common.DefaultPrefixMismatchOption.String(),
+		transferOrder:                  common.ETransferOrder.Plan().String(),
+		maxRetries:                     -1,
 		includeDirectoryStubs:          true,
 	}
 }
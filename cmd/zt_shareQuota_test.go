@@ -0,0 +1,96 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/Azure/azure-storage-file-go/azfile"
+	chk "gopkg.in/check.v1"
+)
+
+type shareQuotaSuite struct{}
+
+var _ = chk.Suite(&shareQuotaSuite{})
+
+func (s *shareQuotaSuite) TestWarnsOnceFilesMayNotFitInQuota(c *chk.C) {
+	const gib = 1024 * 1024 * 1024
+	var warnings []string
+	t := newShareQuotaTracker("myshare", 3, gib, func(message string) { warnings = append(warnings, message) })
+
+	t.add(gib)
+	t.add(gib) // exactly filling what is free is fine
+	c.Assert(warnings, chk.HasLen, 0)
+	t.add(1)
+	c.Assert(warnings, chk.DeepEquals, []string{"The files to be transferred add up to more than the 2147483648 bytes free in the destination share 'myshare' " +
+		"(3 GiB quota, of which 1073741824 bytes are used). They will still fit if enough of them replace files already in the share, " +
+		"but otherwise the transfers that don't fit will fail once the share is full. Increase the quota of the share to be sure of it"})
+
+	// the job goes on, and isn't warned about again
+	t.add(gib)
+	c.Assert(warnings, chk.HasLen, 1)
+
+	// what is no longer to be transferred makes room again
+	t = newShareQuotaTracker("myshare", 3, gib, func(message string) { warnings = append(warnings, message) })
+	t.add(2 * gib)
+	t.remove(gib)
+	t.add(gib)
+	c.Assert(warnings, chk.HasLen, 1)
+}
+
+func (s *shareQuotaSuite) TestShareUsageIsRead(c *chk.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, chk.Equals, http.MethodGet)
+		c.Check(r.URL.Path, chk.Equals, "/myshare")
+		c.Check(r.URL.Query().Get("restype"), chk.Equals, "share")
+		c.Check(r.URL.Query().Get("comp"), chk.Equals, "stats")
+		c.Check(r.URL.Query().Get("sig"), chk.Equals, "secret")
+		w.WriteHeader(http.StatusOK)
+		// more than fits in an int32
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><ShareStats><ShareUsageBytes>5368709120</ShareUsageBytes></ShareStats>`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/myshare?sig=secret")
+	usedBytes, err := getShareUsageBytes(context.Background(), *u, azfile.NewPipeline(azfile.NewAnonymousCredential(), azfile.PipelineOptions{}))
+	c.Assert(err, chk.IsNil)
+	c.Assert(usedBytes, chk.Equals, int64(5*1024*1024*1024))
+}
+
+func (s *shareQuotaSuite) TestShareUsageError(c *chk.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "AuthorizationFailure")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/myshare")
+	_, err := getShareUsageBytes(context.Background(), *u, azfile.NewPipeline(azfile.NewAnonymousCredential(), azfile.PipelineOptions{}))
+	c.Assert(err, chk.ErrorMatches, "could not get the statistics of the share: 403 Forbidden \\(AuthorizationFailure\\)")
+}
+
+func (s *shareQuotaSuite) TestUnknownQuotaIsNotChecked(c *chk.C) {
+	var t *shareQuotaTracker
+	t.add(100 * 1024 * 1024 * 1024 * 1024) // i.e. doesn't warn, or panic
+}
@@ -21,8 +21,15 @@
 package cmd
 
 import (
-	chk "gopkg.in/check.v1"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
 	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
 )
 
 type syncComparatorSuite struct{}
@@ -137,3 +144,171 @@ func (s *syncComparatorSuite) TestSyncDestinationComparator(c *chk.C) {
 	c.Assert(dummyCopyScheduler.record[0].md5, chk.DeepEquals, srcMD5)
 	c.Assert(len(dummyCleaner.record), chk.Equals, 0)
 }
+
+// dryRunOutput compares the given objects just as the sync enumerator does in a dry run, and returns what the dry run printed:
+// a line per object, in order of path, and the summary it exits with
+func dryRunOutput(c *chk.C, upload bool, deleteDestination common.DeleteDestination, source, destination []storedObject) (lines []string, summary string) {
+	mockedLcm := &mockedLifecycleManager{infoLog: make(chan string, 20), exitLog: make(chan string, 1)}
+	originalLcm := glcm
+	glcm = mockedLcm
+	defer func() { glcm = originalLcm }()
+
+	indexer := newObjectIndexer()
+	indexed, compared := destination, source
+	fromTo := common.EFromTo.BlobLocal()
+	if upload {
+		indexed, compared = source, destination
+		fromTo = common.EFromTo.LocalBlob()
+	}
+	for _, object := range indexed {
+		c.Assert(indexer.store(object), chk.IsNil)
+	}
+	reporter := newSyncDryRunReporter(fromTo, 0, common.EFolderPropertiesOption.NoFolders(), deleteDestination)
+	comparator, compareLeftovers := newSyncObservingComparator(fromTo, indexer, nil, reporter)
+	for _, object := range compared {
+		c.Assert(comparator(object), chk.IsNil)
+	}
+	c.Assert(compareLeftovers(), chk.IsNil)
+	reporter.reportAndExit()
+
+	close(mockedLcm.infoLog)
+	for line := range mockedLcm.infoLog {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines, <-mockedLcm.exitLog
+}
+
+func (s *syncComparatorSuite) TestSyncDryRunClassification(c *chk.C) {
+	now := time.Now()
+	file := func(name string, size int64, modified time.Time) storedObject {
+		return storedObject{name: name, relativePath: name, size: size, lastModifiedTime: modified, entityType: common.EEntityType.File()}
+	}
+	source := []storedObject{
+		file("new", 1, now),
+		file("changed", 2, now),
+		file("same", 3, now.Add(-time.Hour)),
+	}
+	destination := []storedObject{
+		file("changed", 20, now.Add(-time.Hour)),
+		file("same", 30, now),
+		file("extra", 40, now),
+	}
+
+	// uploads and downloads compare in opposite directions, but must come to the same conclusions
+	for _, upload := range []bool{true, false} {
+		lines, summary := dryRunOutput(c, upload, common.EDeleteDestination.True(), source, destination)
+		c.Assert(lines, chk.DeepEquals, []string{
+			"DRYRUN: Unchanged same (3 bytes)",
+			"DRYRUN: WillAdd new (1 bytes)",
+			"DRYRUN: WillDelete extra (40 bytes)",
+			"DRYRUN: WillUpdate changed (2 bytes)",
+		}, chk.Commentf("upload: %v", upload))
+		// each file to add or update is sent in a single request, and a download reads them out of the source storage
+		egress := 3
+		if upload {
+			egress = 0
+		}
+		c.Assert(summary, chk.Equals, "DRYRUN: 1 to add, 1 to update, 1 to delete and 1 unchanged. Nothing was transferred or deleted. "+
+			fmt.Sprintf("Transferring the files to add and update would take about 2 requests, and read %d bytes out of the source storage (its egress).", egress))
+	}
+
+	// without permission to delete, extra files are left alone
+	lines, summary := dryRunOutput(c, false, common.EDeleteDestination.False(), source, destination)
+	c.Assert(lines, chk.DeepEquals, []string{
+		"DRYRUN: Unchanged extra (40 bytes)",
+		"DRYRUN: Unchanged same (3 bytes)",
+		"DRYRUN: WillAdd new (1 bytes)",
+		"DRYRUN: WillUpdate changed (2 bytes)",
+	})
+	c.Assert(summary, chk.Equals, "DRYRUN: 1 to add, 1 to update, 0 to delete and 2 unchanged. Nothing was transferred or deleted. "+
+		"Transferring the files to add and update would take about 2 requests, and read 3 bytes out of the source storage (its egress).")
+}
+
+func (s *syncComparatorSuite) TestSyncDryRunIgnoresFoldersLikeSync(c *chk.C) {
+	reporter := newSyncDryRunReporter(common.EFromTo.LocalBlob(), 0, common.EFolderPropertiesOption.NoFolders(), common.EDeleteDestination.True())
+	reporter.report(storedObject{relativePath: "dir", entityType: common.EEntityType.Folder()}, common.ESyncAction.WillAdd())
+	reporter.report(storedObject{relativePath: "dir/file", entityType: common.EEntityType.File()}, common.ESyncAction.WillAdd())
+	c.Assert(reporter.summary().WillAdd, chk.Equals, uint32(1))
+}
+
+// verifySummary compares the destination with the source just as the sync enumerator does with --verify-only
+func verifySummary(c *chk.C, upload bool, verifier *syncVerifier, source, destination []storedObject) common.SyncVerifySummaryJsonTemplate {
+	indexer := newObjectIndexer()
+	indexed, compared := destination, source
+	if upload {
+		indexed, compared = source, destination
+	}
+	for _, object := range indexed {
+		c.Assert(indexer.store(object), chk.IsNil)
+	}
+	fromTo := common.EFromTo.BlobLocal()
+	if upload {
+		fromTo = common.EFromTo.LocalBlob()
+	}
+	comparator, compareLeftovers := newSyncObservingComparator(fromTo, indexer, nil, verifier)
+	for _, object := range compared {
+		c.Assert(comparator(object), chk.IsNil)
+	}
+	c.Assert(compareLeftovers(), chk.IsNil)
+	return verifier.summary()
+}
+
+func (s *syncComparatorSuite) TestSyncVerify(c *chk.C) {
+	now := time.Now()
+	file := func(name string, size int64, modified time.Time) storedObject {
+		return storedObject{name: name, relativePath: name, size: size, lastModifiedTime: modified, entityType: common.EEntityType.File()}
+	}
+	source := []storedObject{
+		file("same", 10, now),
+		file("resized", 10, now.Add(-time.Hour)),
+		file("missing", 10, now),
+		{name: "dir", relativePath: "dir", entityType: common.EEntityType.Folder()},
+	}
+	destination := []storedObject{
+		file("same", 10, now.Add(-time.Hour)), // only the time differs, which doesn't matter
+		file("resized", 20, now),
+		file("extra", 10, now),
+		{name: "dir", relativePath: "dir", entityType: common.EEntityType.Folder()},
+	}
+
+	// uploads and downloads compare in opposite directions, but must come to the same conclusions
+	for _, upload := range []bool{true, false} {
+		summary := verifySummary(c, upload, newSyncVerifier(false, "", ""), source, destination)
+		c.Assert(summary.Verified, chk.Equals, uint32(1), chk.Commentf("upload: %v", upload))
+		c.Assert(summary.Mismatched, chk.Equals, uint32(1), chk.Commentf("upload: %v", upload))
+		c.Assert(summary.Missing, chk.Equals, uint32(1), chk.Commentf("upload: %v", upload))
+	}
+
+	// when everything matches, there are no failures
+	summary := verifySummary(c, false, newSyncVerifier(false, "", ""), source[:1], destination[:1])
+	c.Assert(summary, chk.Equals, common.SyncVerifySummaryJsonTemplate{SchemaVersion: common.JsonOutputSchemaVersion, Verified: 1})
+}
+
+func (s *syncComparatorSuite) TestSyncVerifyMD5(c *chk.C) {
+	localRoot := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(localRoot, "a"), []byte("hello"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(localRoot, "b"), []byte("world"), 0644), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(localRoot, "c"), []byte("again"), 0644), chk.IsNil)
+	md5Of := func(s string) []byte {
+		sum := md5.Sum([]byte(s))
+		return sum[:]
+	}
+	file := func(name string, md5 []byte) storedObject {
+		return storedObject{name: name, relativePath: name, size: 5, entityType: common.EEntityType.File(), md5: md5}
+	}
+	source := []storedObject{file("a", nil), file("b", nil), file("c", nil)}
+	destination := []storedObject{
+		file("a", md5Of("hello")),
+		file("b", md5Of("WORLD")), // same size, different content
+		file("c", nil),            // nothing to compare with
+	}
+
+	summary := verifySummary(c, true, newSyncVerifier(true, localRoot, ""), source, destination)
+	c.Assert(summary.Verified, chk.Equals, uint32(1))
+	c.Assert(summary.Mismatched, chk.Equals, uint32(2))
+
+	// without MD5, only the sizes are compared
+	summary = verifySummary(c, true, newSyncVerifier(false, localRoot, ""), source, destination)
+	c.Assert(summary.Verified, chk.Equals, uint32(3))
+}
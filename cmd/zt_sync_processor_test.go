@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 
@@ -63,6 +64,39 @@ func (s *syncProcessorSuite) TestLocalDeleter(c *chk.C) {
 	c.Assert(err, chk.NotNil)
 }
 
+func (s *syncProcessorSuite) TestDeletionsAreCountedByOutcome(c *chk.C) {
+	cca := &cookedSyncCmdArgs{
+		destination:       newLocalRes(c.MkDir()),
+		deleteDestination: common.EDeleteDestination.True(),
+	}
+	deleter := newInteractiveDeleteProcessor(func(object storedObject) error {
+		if object.relativePath == "locked.txt" {
+			return errors.New("access denied")
+		}
+		return nil
+	}, cca.deleteDestination, "local file", cca.destination, cca.recordDeletion)
+
+	c.Assert(deleter.removeImmediately(storedObject{relativePath: "extra.txt"}), chk.IsNil)
+	c.Assert(deleter.removeImmediately(storedObject{relativePath: "locked.txt"}), chk.NotNil)
+
+	c.Assert(cca.getDeletionCount(), chk.Equals, uint32(1))
+	c.Assert(cca.getDeletionFailureCount(), chk.Equals, uint32(1))
+}
+
+func (s *syncProcessorSuite) TestDeletionsNeedConsent(c *chk.C) {
+	cca := &cookedSyncCmdArgs{
+		destination:       newLocalRes(c.MkDir()),
+		deleteDestination: common.EDeleteDestination.False(),
+	}
+	deleter := newInteractiveDeleteProcessor(func(object storedObject) error {
+		c.Fatal("nothing should be deleted")
+		return nil
+	}, cca.deleteDestination, "local file", cca.destination, cca.recordDeletion)
+
+	c.Assert(deleter.removeImmediately(storedObject{relativePath: "extra.txt"}), chk.IsNil)
+	c.Assert(cca.getDeletionCount(), chk.Equals, uint32(0))
+}
+
 func (s *syncProcessorSuite) TestBlobDeleter(c *chk.C) {
 	bsu := getBSU()
 	blobName := "extraBlob.pdf"
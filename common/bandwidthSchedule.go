@@ -0,0 +1,141 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBandwidthScheduleWindows is the number of windows that a bandwidth schedule may have. It is fixed, since the plan file keeps them in its header.
+const MaxBandwidthScheduleWindows = 16
+
+// BandwidthWindow is a time of each day, in local time, during which the bandwidth cap is CapMbps
+type BandwidthWindow struct {
+	StartMinute uint16  // minutes after midnight at which the window starts, inclusive
+	EndMinute   uint16  // minutes after midnight at which the window ends, exclusive. If it isn't after StartMinute, the window runs past midnight
+	CapMbps     float64 // in megabits per second; zero means no cap
+}
+
+func (w BandwidthWindow) contains(minute uint16) bool {
+	if w.StartMinute < w.EndMinute {
+		return minute >= w.StartMinute && minute < w.EndMinute
+	}
+	return minute >= w.StartMinute || minute < w.EndMinute
+}
+
+// BandwidthSchedule varies the bandwidth cap by the time of day. Where windows overlap, the one listed first applies.
+type BandwidthSchedule []BandwidthWindow
+
+// ParseBandwidthSchedule parses a comma-separated list of windows, each of the form HH:MM-HH:MM=Mbps, e.g. "09:00-17:00=100,17:00-09:00=0".
+// The end of a window may be 24:00, and the end of one that runs past midnight is on the next day.
+func ParseBandwidthSchedule(s string) (BandwidthSchedule, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var schedule BandwidthSchedule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		times, mbps := splitPair(item, "=")
+		start, end := splitPair(times, "-")
+		var w BandwidthWindow
+		var err error
+		if w.StartMinute, err = parseMinuteOfDay(start, false); err != nil {
+			return nil, fmt.Errorf("invalid bandwidth schedule window '%s': %w", item, err)
+		}
+		if w.EndMinute, err = parseMinuteOfDay(end, true); err != nil {
+			return nil, fmt.Errorf("invalid bandwidth schedule window '%s': %w", item, err)
+		}
+		if w.StartMinute == w.EndMinute || (w.StartMinute == 0 && w.EndMinute == 24*60) {
+			// a whole day is better given as the job's cap; and an empty window could mean either
+			return nil, fmt.Errorf("invalid bandwidth schedule window '%s': it must start and end at different times of day", item)
+		}
+		if w.CapMbps, err = strconv.ParseFloat(mbps, 64); err != nil || w.CapMbps < 0 {
+			return nil, fmt.Errorf("invalid bandwidth schedule window '%s': the cap must be a number of Mbps, not negative", item)
+		}
+		schedule = append(schedule, w)
+	}
+	if len(schedule) > MaxBandwidthScheduleWindows {
+		return nil, fmt.Errorf("a bandwidth schedule can have at most %d windows", MaxBandwidthScheduleWindows)
+	}
+	return schedule, nil
+}
+
+func splitPair(s, separator string) (string, string) {
+	parts := strings.SplitN(s, separator, 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// parseMinuteOfDay parses a time of day of the form HH:MM. 24:00 is only allowed at the end of a window.
+func parseMinuteOfDay(s string, isEnd bool) (uint16, error) {
+	hours, minutes := splitPair(s, ":")
+	h, err := strconv.ParseUint(hours, 10, 8)
+	if err != nil || len(minutes) != 2 {
+		return 0, fmt.Errorf("'%s' is not a time of the form HH:MM", s)
+	}
+	m, err := strconv.ParseUint(minutes, 10, 8)
+	if err != nil || m > 59 || h > 24 || (h == 24 && (m != 0 || !isEnd)) {
+		return 0, fmt.Errorf("'%s' is not a time of the form HH:MM", s)
+	}
+	return uint16(h*60 + m), nil
+}
+
+// CapAt returns the cap of the window that applies at the given time. inWindow is false if no window does.
+func (s BandwidthSchedule) CapAt(t time.Time) (mbps float64, inWindow bool) {
+	minute := uint16(t.Hour()*60 + t.Minute())
+	for _, w := range s {
+		if w.contains(minute) {
+			return w.CapMbps, true
+		}
+	}
+	return 0, false
+}
+
+// NextChange returns the first time after t at which a window starts or ends, i.e. after which CapAt may return something else.
+// It is the zero time if the schedule has no windows.
+func (s BandwidthSchedule) NextChange(t time.Time) time.Time {
+	var next time.Time
+	for _, w := range s {
+		for _, minute := range []uint16{w.StartMinute, w.EndMinute} {
+			boundary := time.Date(t.Year(), t.Month(), t.Day(), int(minute/60), int(minute%60), 0, 0, t.Location())
+			if !boundary.After(t) {
+				boundary = time.Date(t.Year(), t.Month(), t.Day()+1, int(minute/60), int(minute%60), 0, 0, t.Location())
+			}
+			if next.IsZero() || boundary.Before(next) {
+				next = boundary
+			}
+		}
+	}
+	return next
+}
+
+func (s BandwidthSchedule) String() string {
+	windows := make([]string, len(s))
+	for i, w := range s {
+		windows[i] = fmt.Sprintf("%02d:%02d-%02d:%02d=%v", w.StartMinute/60, w.StartMinute%60, w.EndMinute/60, w.EndMinute%60, w.CapMbps)
+	}
+	return strings.Join(windows, ",")
+}
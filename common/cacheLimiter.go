@@ -39,6 +39,8 @@ type CacheLimiter interface {
 	WaitUntilAdd(ctx context.Context, count int64, useRelaxedLimit Predicate) error
 	Remove(count int64)
 	Limit() int64
+	StrictLimit() int64
+	Used() int64
 }
 
 type cacheLimiter struct {
@@ -58,7 +60,7 @@ func (c *cacheLimiter) TryAdd(count int64, useRelaxedLimit bool) (added bool) {
 	// for high-priority things (i.e. things we deem to be allowable under a relaxed (non-strict) limit)
 	strict := !useRelaxedLimit
 	if strict {
-		lim = int64(float32(lim) * 0.75)
+		lim = c.StrictLimit()
 		// Rationale for the level of the strict limit: as at Jan 2018, we are using 0.75 of the total as the strict
 		// limit, leaving the other 0.25 of the total accessible under the "relaxed" limit.
 		// That last 25% gets use for two things: in downloads it is used for things where we KNOW there's
@@ -109,3 +111,14 @@ func (c *cacheLimiter) Remove(count int64) {
 func (c *cacheLimiter) Limit() int64 {
 	return c.limit
 }
+
+// Used is how much has been added, and not yet removed
+func (c *cacheLimiter) Used() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// StrictLimit is the part of the limit that is available to things that are not allowed the relaxed limit.
+// Anything bigger than this may never be added, so must not be waited for.
+func (c *cacheLimiter) StrictLimit() int64 {
+	return int64(float32(c.limit) * 0.75)
+}
@@ -22,7 +22,6 @@ package common
 
 import (
 	"context"
-	"crypto/md5"
 	"errors"
 	"hash"
 	"io"
@@ -93,6 +92,22 @@ type chunkedFileWriter struct {
 	md5ValidationOption HashValidationOption
 
 	sourceMd5Exists bool
+
+	// which hash is computed (MD5, unless SHA-256 was chosen)
+	hashAlgorithm HashAlgorithm
+
+	// what an earlier run already saved. The file must be positioned at its end
+	prefix ResumedFilePrefix
+
+	// called, in order, after each chunk has been saved. May be nil
+	chunkSaved func(id ChunkID)
+}
+
+// ResumedFilePrefix is the start of a file that an earlier run already saved, and after which a ChunkedFileWriter carries on writing
+type ResumedFilePrefix struct {
+	Length int64
+	// Open opens the saved data, so that it can be hashed. It is only called if the hash of the file is needed.
+	Open func() (io.ReadCloser, error)
 }
 
 type fileChunk struct {
@@ -100,7 +115,9 @@ type fileChunk struct {
 	data []byte
 }
 
-func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheLimiter CacheLimiter, chunkLogger ChunkStatusLogger, file io.WriteCloser, numChunks uint32, maxBodyRetries int, md5ValidationOption HashValidationOption, sourceMd5Exists bool) ChunkedFileWriter {
+// NewChunkedFileWriter returns a ChunkedFileWriter for the numChunks chunks that follow the given prefix of the file (which is empty,
+// unless an earlier run has already saved the start of the file). chunkSaved, if not nil, is called as each chunk is saved.
+func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheLimiter CacheLimiter, chunkLogger ChunkStatusLogger, file io.WriteCloser, numChunks uint32, maxBodyRetries int, md5ValidationOption HashValidationOption, sourceMd5Exists bool, hashAlgorithm HashAlgorithm, prefix ResumedFilePrefix, chunkSaved func(id ChunkID)) ChunkedFileWriter {
 	// Set max size for buffered channel. The upper limit here is believed to be generous, given worker routine drains it constantly.
 	// Use num chunks in file if lower than the upper limit, to prevent allocating RAM for lots of large channel buffers when dealing with
 	// very large numbers of very small files.
@@ -117,6 +134,9 @@ func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheL
 		maxRetryPerDownloadBody: maxBodyRetries,
 		md5ValidationOption:     md5ValidationOption,
 		sourceMd5Exists:         sourceMd5Exists,
+		hashAlgorithm:           hashAlgorithm,
+		prefix:                  prefix,
+		chunkSaved:              chunkSaved,
 	}
 	go w.workerRoutine(ctx)
 	return w
@@ -213,12 +233,19 @@ func (w *chunkedFileWriter) MaxRetryPerDownloadBody() int {
 // resorting to the likes of SetFileValidData (https://docs.microsoft.com/en-us/windows/desktop/api/fileapi/nf-fileapi-setfilevaliddata)
 // and (b) we can compute MD5 hashes - which can only be computed when moving through the data sequentially
 func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
-	nextOffsetToSave := int64(0)
+	nextOffsetToSave := w.prefix.Length
 	unsavedChunksByFileOffset := make(map[int64]fileChunk)
-	md5Hasher := md5.New()
+	md5Hasher := w.hashAlgorithm.NewHasher()
 	if w.md5ValidationOption == EHashValidationOption.NoCheck() || !w.sourceMd5Exists {
 		// save CPU time by not even computing a hash, if we don't want to check it, or have nothing to check it against
 		md5Hasher = &nullHasher{}
+	} else if w.prefix.Length > 0 {
+		// the hash is of the whole file, so it must start with what was saved before
+		if err := w.hashPrefix(md5Hasher); err != nil {
+			w.failureError <- err
+			close(w.failureError)
+			return
+		}
 	}
 
 	for {
@@ -255,6 +282,17 @@ func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
 	}
 }
 
+// hashPrefix reads the part of the file that an earlier run saved into the hasher
+func (w *chunkedFileWriter) hashPrefix(md5Hasher hash.Hash) error {
+	saved, err := w.prefix.Open()
+	if err != nil {
+		return err
+	}
+	defer saved.Close()
+	_, err = io.CopyN(md5Hasher, saved, w.prefix.Length)
+	return err
+}
+
 // Hashes and saves available chunks that are sequential from nextOffsetToSave. Stops and returns as soon as it hits
 // a gap (i.e. the position of a chunk that hasn't arrived yet)
 func (w *chunkedFileWriter) sequentiallyProcessAvailableChunks(unsavedChunksByFileOffset map[int64]fileChunk, nextOffsetToSave *int64, md5Hasher hash.Hash, ctx context.Context) error {
@@ -278,6 +316,9 @@ func (w *chunkedFileWriter) sequentiallyProcessAvailableChunks(unsavedChunksByFi
 		if err != nil {
 			return err
 		}
+		if w.chunkSaved != nil {
+			w.chunkSaved(nextChunkInSequence.id)
+		}
 	}
 }
 
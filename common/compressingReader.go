@@ -0,0 +1,63 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+type compressingReader struct {
+	pipeReader *io.PipeReader
+}
+
+// NewGzipCompressingReader returns a ReadCloser from which the data of the source can be read, compressed with gzip.
+// A worker compresses the source as the result is read, so the compressed data is never all held in memory, and its
+// size isn't known until it has all been read. Close stops the worker, and must always be called, even after reading to EOF.
+func NewGzipCompressingReader(source io.Reader) io.ReadCloser {
+	preader, pwriter := io.Pipe()
+	go compressingReaderWorker(source, pwriter)
+	return &compressingReader{pipeReader: preader}
+}
+
+func compressingReaderWorker(source io.Reader, pwriter *io.PipeWriter) {
+	enc := gzip.NewWriter(pwriter)
+
+	b := compressionCopyBufferPool.RentSlice(compressionCopyBufferSize)
+	_, err := io.CopyBuffer(enc, source, b)
+	compressionCopyBufferPool.ReturnSlice(b)
+
+	if err == nil {
+		err = enc.Close() // writes the gzip footer
+	}
+	// the reader gets EOF if err is nil, and err otherwise.
+	// (If the reader was closed first, the writes above failed, and there's no one left to tell.)
+	_ = pwriter.CloseWithError(err)
+}
+
+func (c *compressingReader) Read(p []byte) (n int, err error) {
+	return c.pipeReader.Read(p)
+}
+
+func (c *compressingReader) Close() error {
+	// makes any further writes by the worker fail, so it stops
+	return c.pipeReader.Close()
+}
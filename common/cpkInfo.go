@@ -0,0 +1,68 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// CpkEncryptionAlgorithm is the only algorithm the service supports for customer-provided keys
+const CpkEncryptionAlgorithm = "AES256"
+
+// CpkInfo holds a customer-provided key (CPK), with which the service encrypts blob data at rest.
+// The key itself is never persisted; only its SHA-256 is stored in the job plan files,
+// so that the job can check, when it is resumed, that it has been given the same key again.
+type CpkInfo struct {
+	EncryptionKey       string // the base64 encoded key
+	EncryptionKeySha256 string // the base64 encoded SHA-256 of the key
+}
+
+// NewCpkInfo validates that base64Key is a base64 encoded 256-bit key, and hashes it
+func NewCpkInfo(base64Key string) (CpkInfo, error) {
+	key, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return CpkInfo{}, errors.New("the customer-provided key must be base64 encoded")
+	}
+	if len(key) != 32 {
+		return CpkInfo{}, fmt.Errorf("the customer-provided key must be 256 bits long, but it is %d bits long", len(key)*8)
+	}
+
+	hash := sha256.Sum256(key)
+	return CpkInfo{EncryptionKey: base64Key, EncryptionKeySha256: base64.StdEncoding.EncodeToString(hash[:])}, nil
+}
+
+// GetCpkInfoFromEnvironment reads the customer-provided key from the CPK_ENCRYPTION_KEY environment variable
+func GetCpkInfoFromEnvironment() (CpkInfo, error) {
+	envVar := EEnvironmentVariable.CPKEncryptionKey()
+	base64Key := GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	if base64Key == "" {
+		return CpkInfo{}, fmt.Errorf("the customer-provided key must be given in the %s environment variable", envVar.Name)
+	}
+
+	cpkInfo, err := NewCpkInfo(base64Key)
+	if err != nil {
+		return CpkInfo{}, fmt.Errorf("%s: %w", envVar.Name, err)
+	}
+	return cpkInfo, nil
+}
@@ -21,20 +21,25 @@
 package common
 
 import (
+	"compress/flate"
 	"compress/gzip"
 	"compress/zlib"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 )
 
 type decompressingWriter struct {
-	pipeWriter  *io.PipeWriter
-	workerError chan error
+	pipeWriter   *io.PipeWriter
+	workerError  chan error
+	workerExited bool
+	workerResult error
 }
 
-const decompressingWriterCopyBufferSize = 256 * 1024 // 1/4 the size that we usually write to disk with (elsewhere in codebase). 1/4 to try to keep mem usage a bit lower, without going so small as to compromize perf
-var decompressingWriterBufferPool = NewMultiSizeSlicePool(decompressingWriterCopyBufferSize)
+// the buffers that data is copied through, as it is compressed (by compressingReader) or decompressed (by decompressingWriter)
+const compressionCopyBufferSize = 256 * 1024 // 1/4 the size that we usually write to disk with (elsewhere in codebase). 1/4 to try to keep mem usage a bit lower, without going so small as to compromize perf
+var compressionCopyBufferPool = NewMultiSizeSlicePool(compressionCopyBufferSize)
 
 // NewDecompressingWriter returns a WriteCloser which decompresses the data
 // that is written to it, before passing the decompressed data on to a final destination.
@@ -56,7 +61,7 @@ func NewDecompressingWriter(destination io.WriteCloser, ct CompressionType) io.W
 	return d
 }
 
-func (d decompressingWriter) decompressorFactory(tp CompressionType, preader *io.PipeReader) (io.ReadCloser, error) {
+func (d *decompressingWriter) decompressorFactory(tp CompressionType, preader *io.PipeReader) (io.ReadCloser, error) {
 	switch tp {
 	case ECompressionType.ZLib():
 		return zlib.NewReader(preader)
@@ -67,7 +72,7 @@ func (d decompressingWriter) decompressorFactory(tp CompressionType, preader *io
 	}
 }
 
-func (d decompressingWriter) worker(tp CompressionType, preader *io.PipeReader, destination io.WriteCloser, workerError chan error) {
+func (d *decompressingWriter) worker(tp CompressionType, preader *io.PipeReader, destination io.WriteCloser, workerError chan error) {
 
 	var err error
 	var dec io.ReadCloser
@@ -83,40 +88,67 @@ func (d decompressingWriter) worker(tp CompressionType, preader *io.PipeReader,
 	// (Factory reads from pipe to read the zip/gzip file header)
 	dec, err = d.decompressorFactory(tp, preader)
 	if err != nil {
+		err = invalidCompressedDataError(tp, err)
 		return
 	}
 
 	// Now read from the pipe, decompressing as we go, until
 	// reach EOF on the pipe (or encounter an error)
-	b := decompressingWriterBufferPool.RentSlice(decompressingWriterCopyBufferSize)
+	b := compressionCopyBufferPool.RentSlice(compressionCopyBufferSize)
 	_, err = io.CopyBuffer(destination, dec, b) // returns err==nil if hits EOF, as per docs
-	decompressingWriterBufferPool.ReturnSlice(b)
+	compressionCopyBufferPool.ReturnSlice(b)
+	if err != nil {
+		err = invalidCompressedDataError(tp, err)
+	}
 
 	return
 }
 
+// invalidCompressedDataError explains errors that mean the data isn't in the format its content encoding claims,
+// since the bare errors from the decompressors (e.g. "gzip: invalid header") don't say where the problem lies.
+// Other errors, such as failures to write to the destination, or data that ends early because we were closed early, are returned as they are
+func invalidCompressedDataError(tp CompressionType, err error) error {
+	var corrupt flate.CorruptInputError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, zlib.ErrHeader) || errors.Is(err, zlib.ErrChecksum) || errors.As(err, &corrupt) {
+		return fmt.Errorf("the source's content encoding says it is %s compressed, but its data is not valid %s: %w", tp, tp, err)
+	}
+	return err
+}
+
 // Write, conceptually, takes a slice of compressed data, decompresses it, and writes it into the final destination.
 // In actuality, all it really does is writes the compressed data to the pipe, and leaves
 // it up to the worker to do the rest
-func (d decompressingWriter) Write(p []byte) (n int, err error) {
+func (d *decompressingWriter) Write(p []byte) (n int, err error) {
 	n, writeErr := d.pipeWriter.Write(p)
 
 	// check for worker error, and report it in preference to the writeError,
 	// since the worker error is likely to be more meaningful
-	select {
-	case workerErr := <-d.workerError:
-		if workerErr == nil {
+	if d.checkWorkerExited() {
+		if d.workerResult == nil {
 			return n, errors.New("decompression worker exited early") // we don't expect this
 		}
-		return n, errors.New("error in decompression worker when writing: " + workerErr.Error())
-	default:
-		// no worker error
+		return n, errors.New("error in decompression worker when writing: " + d.workerResult.Error())
 	}
 
 	return n, writeErr
 }
 
-func (d decompressingWriter) Close() error {
+// checkWorkerExited returns whether the worker has finished, without waiting for it.
+// The worker only reports its result once, so we keep it for any later calls to Write or Close
+func (d *decompressingWriter) checkWorkerExited() bool {
+	if !d.workerExited {
+		select {
+		case d.workerResult = <-d.workerError:
+			d.workerExited = true
+		default:
+			// no worker error
+		}
+	}
+	return d.workerExited
+}
+
+func (d *decompressingWriter) Close() error {
 	// close pipe, so reader will get EOF
 	closeError := d.pipeWriter.Close()
 	if closeError != nil {
@@ -124,13 +156,16 @@ func (d decompressingWriter) Close() error {
 	}
 
 	// check for worker completion and error state
-	select {
-	case workerErr := <-d.workerError:
-		if workerErr == nil {
-			return nil
+	if !d.checkWorkerExited() {
+		select {
+		case d.workerResult = <-d.workerError:
+			d.workerExited = true
+		case <-time.After(time.Minute * 15): // should never take THIS long to flush final data to destination, but better to wait too long than too short and stop it before its closed
+			return errors.New("timed out closing decompression worker")
 		}
-		return errors.New("error in decompression worker when closing: " + workerErr.Error())
-	case <-time.After(time.Minute * 15): // should never take THIS long to flush final data to destination, but better to wait too long than too short and stop it before its closed
-		return errors.New("timed out closing decompression worker")
 	}
+	if d.workerResult == nil {
+		return nil
+	}
+	return errors.New("error in decompression worker when closing: " + d.workerResult.Error())
 }
@@ -37,13 +37,17 @@ type EnvironmentVariable struct {
 // 2. They are authentication secrets, which we do not accept on the command line
 var VisibleEnvironmentVariables = []EnvironmentVariable{
 	EEnvironmentVariable.LogLocation(),
+	EEnvironmentVariable.LogMaxSizeMB(),
 	EEnvironmentVariable.JobPlanLocation(),
 	EEnvironmentVariable.ConcurrencyValue(),
+	EEnvironmentVariable.RetryStatusCodes(),
 	EEnvironmentVariable.TransferInitiationPoolSize(),
 	EEnvironmentVariable.EnumerationPoolSize(),
 	EEnvironmentVariable.DisableHierarchicalScanning(),
 	EEnvironmentVariable.ParallelStatFiles(),
 	EEnvironmentVariable.BufferGB(),
+	EEnvironmentVariable.PlanFlushInterval(),
+	EEnvironmentVariable.PlanFlushTransfers(),
 	EEnvironmentVariable.ShowPerfStates(),
 	EEnvironmentVariable.PacePageBlobs(),
 	EEnvironmentVariable.AutoTuneToCpu(),
@@ -54,6 +58,7 @@ var VisibleEnvironmentVariables = []EnvironmentVariable{
 	EEnvironmentVariable.AWSSecretAccessKey(),
 	EEnvironmentVariable.ClientSecret(),
 	EEnvironmentVariable.CertificatePassword(),
+	EEnvironmentVariable.CPKEncryptionKey(),
 	EEnvironmentVariable.AutoLoginType(),
 	EEnvironmentVariable.TenantID(),
 	EEnvironmentVariable.AADEndpoint(),
@@ -117,6 +122,14 @@ func (EnvironmentVariable) CertificatePath() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) CPKEncryptionKey() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "CPK_ENCRYPTION_KEY",
+		Description: "The base64 encoded 256-bit customer-provided key with which blobs are encrypted when --cpk-by-value is used. Only the SHA-256 of this key is stored in the job plan files.",
+		Hidden:      true,
+	}
+}
+
 func (EnvironmentVariable) CertificatePassword() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_SPA_CERT_PASSWORD",
@@ -216,17 +229,31 @@ func (EnvironmentVariable) LogLocation() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) LogMaxSizeMB() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_LOG_MAX_SIZE_MB",
+		Description: "Max size, in MB, of a job's log file. When it is reached, the file is renamed to <job ID>.1.log (and earlier ones to .2.log and so on, keeping the newest 5), and a new file is started. By default there is no limit.",
+	}
+}
+
+func (EnvironmentVariable) RetryStatusCodes() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_RETRY_STATUS_CODES",
+		Description: "Comma-separated list of the HTTP status codes of failed requests that are retried, e.g. '500,503'. Requests that fail with any other status code fail straight away. The default is 408,429,500,502,503,504.",
+	}
+}
+
 func (EnvironmentVariable) JobPlanLocation() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_JOB_PLAN_LOCATION",
-		Description: "Overrides where the job plan files (used for progress tracking and resuming) are stored, to avoid filling up a disk.",
+		Description: "Overrides where the job plan files (used for progress tracking and resuming) are stored, to avoid filling up a disk. The --job-plan-location flag takes precedence over it.",
 	}
 }
 
 func (EnvironmentVariable) BufferGB() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_BUFFER_GB",
-		Description: "Max number of GB that AzCopy should use for buffering data between network and disk. May include decimal point, e.g. 0.5. The default is based on machine size.",
+		Description: "Max number of GB that AzCopy should use for buffering data between network and disk, including buffers kept for reuse. May include decimal point, e.g. 0.5. The default is based on machine size. Three quarters of it must be enough for one block of the chosen block size.",
 	}
 }
 
@@ -249,6 +276,29 @@ func (EnvironmentVariable) ProfileMemory() EnvironmentVariable {
 	return EnvironmentVariable{Name: "AZCOPY_PROFILE_MEM"}
 }
 
+func (EnvironmentVariable) TransferStallTimeout() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_TRANSFER_STALL_TIMEOUT",
+		Description: "Number of seconds an upload or download may go without moving any data, while it has requests in flight, before it is reported as stalled and those requests are retried. Default is 300. Set to 0 to disable stall detection.",
+	}
+}
+
+func (EnvironmentVariable) PlanFlushInterval() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_PLAN_FLUSH_INTERVAL",
+		Description: "Number of seconds between the flushes of a running job's plan files to disk, so that if the machine goes down, the job can be resumed from about where it was. " +
+			"More frequent flushes lose less progress, but cost more disk I/O. Default is 30. Set to 0 to only flush them after a number of transfers (see AZCOPY_PLAN_FLUSH_TRANSFERS), and when the job stops.",
+	}
+}
+
+func (EnvironmentVariable) PlanFlushTransfers() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_PLAN_FLUSH_TRANSFERS",
+		Description: "Number of transfers of a running job that are done between the flushes of its plan files to disk, in addition to those made every AZCOPY_PLAN_FLUSH_INTERVAL seconds. " +
+			"Default is 1000. Set to 0 to only flush them on the interval.",
+	}
+}
+
 func (EnvironmentVariable) PacePageBlobs() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:        "AZCOPY_PACE_PAGE_BLOBS",
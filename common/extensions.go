@@ -6,8 +6,10 @@ import (
 	"net/url"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-blob-go/azblob"
 
 	"github.com/Azure/azure-storage-file-go/azfile"
 )
@@ -86,6 +88,35 @@ func RedactSecretQueryParam(rawQuery, queryKeyNeedRedact string) (bool, string)
 	return sigFound, values.Encode()
 }
 
+// SASExpiryTime returns the expiry time (the se parameter) of the given SAS token, which may start with '?'.
+// ok is false if the token has no expiry time that can be parsed, e.g. because it is empty.
+func SASExpiryTime(sas string) (expiry time.Time, ok bool) {
+	values, err := url.ParseQuery(strings.TrimPrefix(sas, "?"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	se := values.Get("se")
+	if se == "" {
+		return time.Time{}, false
+	}
+	for _, format := range azblob.SASTimeFormats {
+		if expiry, err = time.Parse(format, se); err == nil {
+			return expiry, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// EarliestSASExpiryTime returns the earliest expiry time of the given SAS tokens. ok is false if none of them has one.
+func EarliestSASExpiryTime(sasTokens ...string) (earliest time.Time, ok bool) {
+	for _, sas := range sasTokens {
+		if expiry, hasExpiry := SASExpiryTime(sas); hasExpiry && (!ok || expiry.Before(earliest)) {
+			earliest, ok = expiry, true
+		}
+	}
+	return earliest, ok
+}
+
 /////////////////////////////////////////////////////////////////////////////////////////////////
 type FileURLPartsExtension struct {
 	azfile.FileURLParts
@@ -22,8 +22,12 @@ package common
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/json"
+	"hash"
 	"math"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strings"
@@ -54,8 +58,8 @@ const (
 	//  we decided that the best option was to leave it as is, and only relax it if user feedback so requires.
 	DEFAULT_FILE_PERM = 0644
 
-	// Since we haven't updated the Go SDKs to handle CPK just yet, we need to detect CPK related errors
-	// and inform the user that we don't support CPK yet.
+	// The service returns this code when a CPK-encrypted blob is accessed without its key,
+	// so we detect it to tell the user how to supply the key.
 	CPK_ERROR_SERVICE_CODE = "BlobUsesCustomerSpecifiedEncryption"
 )
 
@@ -147,6 +151,42 @@ func (d DeleteSnapshotsOption) ToDeleteSnapshotsOptionType() azblob.DeleteSnapsh
 	return azblob.DeleteSnapshotsOptionType(strings.ToLower(d.String()))
 }
 
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var EPublicAccessLevel = PublicAccessLevel(0)
+
+// PublicAccessLevel says which of a container's contents can be read without authorization
+type PublicAccessLevel uint8
+
+func (PublicAccessLevel) None() PublicAccessLevel      { return PublicAccessLevel(0) }
+func (PublicAccessLevel) Blob() PublicAccessLevel      { return PublicAccessLevel(1) }
+func (PublicAccessLevel) Container() PublicAccessLevel { return PublicAccessLevel(2) }
+
+func (p PublicAccessLevel) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+func (p *PublicAccessLevel) Parse(s string) error {
+	// allow empty to mean "None"
+	if s == "" {
+		*p = EPublicAccessLevel.None()
+		return nil
+	}
+
+	val, err := enum.ParseInt(reflect.TypeOf(p), s, true, true)
+	if err == nil {
+		*p = val.(PublicAccessLevel)
+	}
+	return err
+}
+
+func (p PublicAccessLevel) ToPublicAccessType() azblob.PublicAccessType {
+	if p == EPublicAccessLevel.None() {
+		return azblob.PublicAccessNone
+	}
+
+	return azblob.PublicAccessType(strings.ToLower(p.String()))
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 type DeleteDestination uint32
@@ -171,6 +211,26 @@ func (dd DeleteDestination) String() string {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+// SyncAction is what a sync does to an object, as reported by a sync dry run
+type SyncAction uint8
+
+var ESyncAction = SyncAction(0)
+
+func (SyncAction) Unchanged() SyncAction  { return SyncAction(0) }
+func (SyncAction) WillAdd() SyncAction    { return SyncAction(1) }
+func (SyncAction) WillUpdate() SyncAction { return SyncAction(2) }
+func (SyncAction) WillDelete() SyncAction { return SyncAction(3) }
+
+func (sa SyncAction) String() string {
+	return enum.StringInt(sa, reflect.TypeOf(sa))
+}
+
+func (sa SyncAction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sa.String())
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
 // represents one possible response
 var EResponseOption = ResponseOption{ResponseType: "", UserFriendlyResponseType: "", ResponseString: ""}
 
@@ -215,6 +275,11 @@ func (OverwriteOption) True() OverwriteOption          { return OverwriteOption(
 func (OverwriteOption) False() OverwriteOption         { return OverwriteOption(1) }
 func (OverwriteOption) Prompt() OverwriteOption        { return OverwriteOption(2) }
 func (OverwriteOption) IfSourceNewer() OverwriteOption { return OverwriteOption(3) }
+func (OverwriteOption) Append() OverwriteOption        { return OverwriteOption(4) }
+
+// IfNotExists leaves existing destinations alone, like False, but has the service refuse them when they are written,
+// rather than looking each one up beforehand
+func (OverwriteOption) IfNotExists() OverwriteOption { return OverwriteOption(5) }
 
 func (o *OverwriteOption) Parse(s string) error {
 	val, err := enum.Parse(reflect.TypeOf(o), s, true)
@@ -315,6 +380,114 @@ func (ll LogLevel) ToPipelineLogLevel() pipeline.LogLevel {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+// LogFormat is how the entries of a job's log file are written
+type LogFormat uint8
+
+var ELogFormat = LogFormat(0)
+
+// Text is the human-readable format, with one or more lines per entry
+func (LogFormat) Text() LogFormat { return LogFormat(0) }
+
+// Json writes each entry as a JSON object on a line of its own (JSON lines), for log aggregators to ingest
+func (LogFormat) Json() LogFormat { return LogFormat(1) }
+
+func (lf *LogFormat) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(lf), s, true)
+	if err == nil {
+		*lf = val.(LogFormat)
+	}
+	return err
+}
+
+func (lf LogFormat) String() string {
+	return enum.StringInt(lf, reflect.TypeOf(lf))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// TransferOrder is the order in which the transfers of each job part are handed to the scheduler.
+// It is not stored in the job's plan, so it only lasts for the run of the job that was given it.
+type TransferOrder uint8
+
+var ETransferOrder = TransferOrder(0)
+
+// Plan schedules the transfers in the order of the plan, in which each part's transfers were shuffled when the part was dispatched
+func (TransferOrder) Plan() TransferOrder { return TransferOrder(0) }
+
+// LargestFirst schedules the largest sources first, so that the longest transfers aren't left until the end of the job
+func (TransferOrder) LargestFirst() TransferOrder { return TransferOrder(1) }
+
+// SmallestFirst schedules the smallest sources first, so that as many files as possible are done early on
+func (TransferOrder) SmallestFirst() TransferOrder { return TransferOrder(2) }
+
+func (to *TransferOrder) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(to), s, true)
+	if err == nil {
+		*to = val.(TransferOrder)
+	}
+	return err
+}
+
+func (to TransferOrder) String() string {
+	return enum.StringInt(to, reflect.TypeOf(to))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ImmutabilityPolicyMode is the mode of a blob's immutability policy. Its String values are those that the service uses.
+type ImmutabilityPolicyMode uint8
+
+var EImmutabilityPolicyMode = ImmutabilityPolicyMode(0)
+
+// Unlocked policies can still be shortened or removed, so they can be tried out before they are locked
+func (ImmutabilityPolicyMode) Unlocked() ImmutabilityPolicyMode { return ImmutabilityPolicyMode(0) }
+
+// Locked policies can only be extended. Until they expire, the blob cannot be changed or deleted by anyone
+func (ImmutabilityPolicyMode) Locked() ImmutabilityPolicyMode { return ImmutabilityPolicyMode(1) }
+
+func (m *ImmutabilityPolicyMode) Parse(s string) error {
+	val, err := enum.Parse(reflect.TypeOf(m), s, true)
+	if err == nil {
+		*m = val.(ImmutabilityPolicyMode)
+	}
+	return err
+}
+
+func (m ImmutabilityPolicyMode) String() string {
+	return enum.StringInt(m, reflect.TypeOf(m))
+}
+
+// BlobImmutability is the immutability policy and legal hold of a blob. A zero PolicyExpiresOn means that there is no policy.
+type BlobImmutability struct {
+	PolicyExpiresOn time.Time
+	PolicyMode      ImmutabilityPolicyMode
+	LegalHold       bool
+}
+
+func (b BlobImmutability) HasPolicy() bool {
+	return !b.PolicyExpiresOn.IsZero()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// LogEvent says what a log entry is about. It is recorded in logs in the JSON format
+type LogEvent uint8
+
+var ELogEvent = LogEvent(0)
+
+func (LogEvent) Message() LogEvent        { return LogEvent(0) } // anything not covered below
+func (LogEvent) Request() LogEvent        { return LogEvent(1) } // a request to the service, and its response, on its first try
+func (LogEvent) Retry() LogEvent          { return LogEvent(2) } // a later try of a request
+func (LogEvent) TransferStart() LogEvent  { return LogEvent(3) }
+func (LogEvent) TransferInfo() LogEvent   { return LogEvent(4) } // something that happened during a transfer
+func (LogEvent) TransferFailed() LogEvent { return LogEvent(5) }
+
+func (le LogEvent) String() string {
+	return enum.StringInt(le, reflect.TypeOf(le))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
 var EJobPriority = JobPriority(0)
 
 // JobPriority defines the transfer priorities supported by the Storage Transfer Engine's channels
@@ -396,12 +569,69 @@ func (JobStatus) CompletedWithErrors() JobStatus           { return JobStatus(5)
 func (JobStatus) CompletedWithSkipped() JobStatus          { return JobStatus(6) }
 func (JobStatus) CompletedWithErrorsAndSkipped() JobStatus { return JobStatus(7) }
 func (JobStatus) Failed() JobStatus                        { return JobStatus(8) }
+
+// Unknown is reported for jobs whose plan files can't be read, e.g. because they are corrupt or were only partly written
+func (JobStatus) Unknown() JobStatus { return JobStatus(9) }
 func (js JobStatus) String() string {
 	return enum.StringInt(js, reflect.TypeOf(js))
 }
 
 ////////////////////////////////////////////////////////////////
 
+var EJobCancelReason = JobCancelReason(0)
+
+// JobCancelReason records why a job was cancelled, so that a cancellation the user asked for can be told apart from one the engine decided on
+type JobCancelReason uint32 // Must be 32-bit for atomic operations
+
+// None is the reason of a job that hasn't been cancelled
+func (JobCancelReason) None() JobCancelReason { return JobCancelReason(0) }
+
+// Requested is the reason of a job that was cancelled by a cancel order, e.g. from the user
+func (JobCancelReason) Requested() JobCancelReason { return JobCancelReason(1) }
+
+// MaxDurationExceeded is the reason of a job that was stopped because its run lasted longer than the job's maximum duration
+func (JobCancelReason) MaxDurationExceeded() JobCancelReason { return JobCancelReason(2) }
+
+// SASExpired is the reason of a job that was stopped because the SAS token of its source or destination expired
+func (JobCancelReason) SASExpired() JobCancelReason { return JobCancelReason(3) }
+
+// MaxTotalBytesReached is the reason of a job that was stopped because its next transfer would have taken it past the job's MaxTotalBytes
+func (JobCancelReason) MaxTotalBytesReached() JobCancelReason { return JobCancelReason(4) }
+
+func (r JobCancelReason) String() string {
+	return enum.StringInt(r, reflect.TypeOf(r))
+}
+
+func (r *JobCancelReason) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(r), s, true, true)
+	if err == nil {
+		*r = val.(JobCancelReason)
+	}
+	return err
+}
+
+func (r JobCancelReason) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *JobCancelReason) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return r.Parse(s)
+}
+
+func (r *JobCancelReason) AtomicLoad() JobCancelReason {
+	return JobCancelReason(atomic.LoadUint32((*uint32)(r)))
+}
+
+func (r *JobCancelReason) AtomicStore(newReason JobCancelReason) {
+	atomic.StoreUint32((*uint32)(r), uint32(newReason))
+}
+
+////////////////////////////////////////////////////////////////
+
 var ELocation = Location(0)
 
 // Location indicates the type of Location
@@ -625,12 +855,21 @@ func (TransferStatus) Started() TransferStatus { return TransferStatus(1) }
 // Transfer successfully completed
 func (TransferStatus) Success() TransferStatus { return TransferStatus(2) }
 
+// Transfer was in flight when its job was paused. It did not fail, so it is not counted as a failure,
+// and it is restarted from its first chunk when the job is resumed.
+func (TransferStatus) Paused() TransferStatus { return TransferStatus(3) }
+
+// Transfer is in progress, but has stopped moving data for longer than the stall timeout.
+// Its requests in flight are cancelled so that they are retried, and it goes back to Started once it makes progress again.
+func (TransferStatus) Stalled() TransferStatus { return TransferStatus(4) }
+
 // Transfer failed due to some error.
 func (TransferStatus) Failed() TransferStatus { return TransferStatus(-1) }
 
 // Transfer failed due to failure while Setting blob tier.
 func (TransferStatus) BlobTierFailure() TransferStatus { return TransferStatus(-2) }
 
+// Transfer was intentionally not done, because the destination already existed and the overwrite policy said not to replace it.
 func (TransferStatus) SkippedEntityAlreadyExists() TransferStatus { return TransferStatus(-3) }
 
 func (TransferStatus) SkippedBlobHasSnapshots() TransferStatus { return TransferStatus(-4) }
@@ -639,8 +878,33 @@ func (TransferStatus) TierAvailabilityCheckFailure() TransferStatus { return Tra
 
 func (TransferStatus) Cancelled() TransferStatus { return TransferStatus(-6) }
 
+// Transfer completed, but the MD5 hash of its data did not match the hash stored in the service
+func (TransferStatus) Corrupted() TransferStatus { return TransferStatus(-7) }
+
+// Transfer was refused by the service (412 Precondition Failed), because the destination's ETag didn't satisfy the transfer's
+// If-Match or If-None-Match condition. In other words, the destination was changed (or created) by someone else.
+func (TransferStatus) PreconditionFailed() TransferStatus { return TransferStatus(-8) }
+
+// Transfer was not started, because it would have taken the data transferred by its job past the job's MaxTotalBytes.
+// Like a cancelled transfer, it is started again when the job is resumed.
+func (TransferStatus) ExceededMaxTotalBytes() TransferStatus { return TransferStatus(-9) }
+
 func (ts TransferStatus) ShouldTransfer() bool {
-	return ts == ETransferStatus.NotStarted() || ts == ETransferStatus.Started()
+	return ts == ETransferStatus.NotStarted() || ts == ETransferStatus.Started() || ts == ETransferStatus.Paused() ||
+		ts == ETransferStatus.Stalled()
+}
+
+// DidFail returns true if the transfer ended in one of the failure statuses (rather than being skipped or cancelled)
+func (ts TransferStatus) DidFail() bool {
+	return ts == ETransferStatus.Failed() || ts == ETransferStatus.BlobTierFailure() ||
+		ts == ETransferStatus.TierAvailabilityCheckFailure() || ts == ETransferStatus.Corrupted() ||
+		ts == ETransferStatus.PreconditionFailed()
+}
+
+// WasSkipped returns true if the engine intentionally did nothing for the transfer. Skipped transfers are not failures,
+// and they are not re-evaluated when the job is resumed.
+func (ts TransferStatus) WasSkipped() bool {
+	return ts == ETransferStatus.SkippedEntityAlreadyExists() || ts == ETransferStatus.SkippedBlobHasSnapshots()
 }
 
 // Transfer is any of the three possible state (InProgress, Completer or Failed)
@@ -837,6 +1101,58 @@ func (hvo *HashValidationOption) UnmarshalJSON(b []byte) error {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+var EHashAlgorithm = HashAlgorithm(0)
+
+// HashAlgorithm is the algorithm used to hash the data of each file, to put the hash on upload and to check it on download
+type HashAlgorithm uint8
+
+// MD5 hashes are kept in the Content-MD5 property that the services have for them
+func (HashAlgorithm) MD5() HashAlgorithm { return HashAlgorithm(0) }
+
+// SHA256 hashes have no property of their own, so they are kept in the blob's metadata, under SHA256MetadataKey (as hex)
+func (HashAlgorithm) SHA256() HashAlgorithm { return HashAlgorithm(1) }
+
+// SHA256MetadataKey is the metadata key under which the SHA-256 hash of a blob's data is kept
+const SHA256MetadataKey = "azcopy_sha256"
+
+func (ha HashAlgorithm) String() string {
+	return enum.StringInt(ha, reflect.TypeOf(ha))
+}
+
+func (ha *HashAlgorithm) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(ha), s, true, true)
+	if err == nil {
+		*ha = val.(HashAlgorithm)
+	}
+	return err
+}
+
+// NewHasher returns a hash.Hash that computes hashes of this algorithm
+func (ha HashAlgorithm) NewHasher() hash.Hash {
+	switch ha {
+	case EHashAlgorithm.MD5():
+		return md5.New()
+	case EHashAlgorithm.SHA256():
+		return sha256.New()
+	default:
+		panic(fmt.Sprintf("unexpected hash algorithm %v", ha))
+	}
+}
+
+// Size returns the number of bytes in the hashes of this algorithm
+func (ha HashAlgorithm) Size() int {
+	switch ha {
+	case EHashAlgorithm.MD5():
+		return md5.Size
+	case EHashAlgorithm.SHA256():
+		return sha256.Size
+	default:
+		panic(fmt.Sprintf("unexpected hash algorithm %v", ha))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
 var EInvalidMetadataHandleOption = InvalidMetadataHandleOption(0)
 
 var DefaultInvalidMetadataHandleOption = EInvalidMetadataHandleOption.ExcludeIfInvalid()
@@ -882,6 +1198,101 @@ func (i *InvalidMetadataHandleOption) UnmarshalJSON(b []byte) error {
 	return i.Parse(s)
 }
 
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var EDestinationCollisionOption = DestinationCollisionOption(0)
+
+var DefaultDestinationCollisionOption = EDestinationCollisionOption.FailOnCollision()
+
+// DestinationCollisionOption decides what happens when flattening or renaming gives two files the same destination
+type DestinationCollisionOption uint8
+
+// FailOnCollision indicates that the job fails when a second file with the same destination is found.
+func (DestinationCollisionOption) FailOnCollision() DestinationCollisionOption {
+	return DestinationCollisionOption(0)
+}
+
+// AppendSuffix indicates that every file after the first with the same destination gets a numeric suffix, e.g. name-1.txt.
+func (DestinationCollisionOption) AppendSuffix() DestinationCollisionOption {
+	return DestinationCollisionOption(1)
+}
+
+// Overwrite indicates that the last file found with a destination is the one copied there.
+func (DestinationCollisionOption) Overwrite() DestinationCollisionOption {
+	return DestinationCollisionOption(2)
+}
+
+func (f DestinationCollisionOption) String() string {
+	return enum.StringInt(f, reflect.TypeOf(f))
+}
+
+func (f *DestinationCollisionOption) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(f), s, true, true)
+	if err == nil {
+		*f = val.(DestinationCollisionOption)
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var EPrefixMismatchOption = PrefixMismatchOption(0)
+
+var DefaultPrefixMismatchOption = EPrefixMismatchOption.Fail()
+
+// PrefixMismatchOption decides what happens to a source file whose relative path doesn't start with the prefix that is to be stripped from it
+type PrefixMismatchOption uint8
+
+// Fail indicates that the job fails when such a file is found.
+func (PrefixMismatchOption) Fail() PrefixMismatchOption {
+	return PrefixMismatchOption(0)
+}
+
+// Skip indicates that such files are not transferred.
+func (PrefixMismatchOption) Skip() PrefixMismatchOption {
+	return PrefixMismatchOption(1)
+}
+
+func (p PrefixMismatchOption) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+func (p *PrefixMismatchOption) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(p), s, true, true)
+	if err == nil {
+		*p = val.(PrefixMismatchOption)
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var ES2SCopyMethod = S2SCopyMethod(0)
+
+var DefaultS2SCopyMethod = ES2SCopyMethod.PutFromURL()
+
+// S2SCopyMethod decides how the service is asked to copy a blob from another blob
+type S2SCopyMethod uint8
+
+// PutFromURL copies the data chunk by chunk, with Put Block/Page/Append Block From URL calls that return once each chunk is copied.
+func (S2SCopyMethod) PutFromURL() S2SCopyMethod {
+	return S2SCopyMethod(0)
+}
+
+// AsyncCopy starts one asynchronous Copy Blob operation per blob, and polls the destination until the service reports that it has finished.
+func (S2SCopyMethod) AsyncCopy() S2SCopyMethod {
+	return S2SCopyMethod(1)
+}
+
+func (m S2SCopyMethod) String() string {
+	return enum.StringInt(m, reflect.TypeOf(m))
+}
+
+func (m *S2SCopyMethod) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(m), s, true, true)
+	if err == nil {
+		*m = val.(S2SCopyMethod)
+	}
+	return err
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 const (
 	DefaultBlockBlobBlockSize      = 8 * 1024 * 1024
@@ -889,6 +1300,7 @@ const (
 	MaxAppendBlobBlockSize         = 4 * 1024 * 1024
 	DefaultPageBlobChunkSize       = 4 * 1024 * 1024
 	DefaultAzureFileChunkSize      = 4 * 1024 * 1024
+	MaxAzureFileSize               = 4 * 1024 * 1024 * 1024 * 1024
 	MaxNumberOfBlocksPerBlob       = 50000
 	BlockSizeThreshold             = 256 * 1024 * 1024
 	MinParallelChunkCountThreshold = 4 /* minimum number of chunks in parallel for AzCopy to be performant. */
@@ -916,8 +1328,17 @@ type CopyTransfer struct {
 	BlobType      azblob.BlobType
 	BlobTier      azblob.AccessTierType
 	BlobVersionID string
+	// BlobSnapshotID is the snapshot of the source blob to read, or empty to read the base blob
+	BlobSnapshotID string
 	// Blob index tags categorize data in your storage account utilizing key-value tag attributes
 	BlobTags BlobTags
+	// BlobImmutability is the immutability policy and legal hold of the source blob, when they are to be preserved
+	BlobImmutability BlobImmutability
+
+	// DestIfMatch and DestIfNoneMatch make writing the destination blob conditional on its ETag (empty if there is no such condition).
+	// "*" matches any ETag, so DestIfNoneMatch "*" only writes a blob that doesn't exist yet.
+	DestIfMatch     string
+	DestIfNoneMatch string
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -925,6 +1346,10 @@ type CopyTransfer struct {
 // Metadata used in AzCopy.
 type Metadata map[string]string
 
+// FolderMarkerMetadataKey is the metadata by which ADLS Gen2 and HDFS mark the zero-byte blobs that stand for directories,
+// when the value is "true"
+const FolderMarkerMetadataKey = "hdi_isfolder"
+
 // ToAzBlobMetadata converts metadata to azblob's metadata.
 func (m Metadata) ToAzBlobMetadata() azblob.Metadata {
 	return azblob.Metadata(m)
@@ -1019,7 +1444,7 @@ func (m Metadata) ExcludeInvalidKey() (retainedMetadata Metadata, excludedMetada
 	return
 }
 
-// BlobTags is a map of key-value pair
+// BlobTags is a map of key-value pair. The keys and values are held as they are, not URL escaped.
 type BlobTags map[string]string
 
 // ToAzBlobTagsMap converts BlobTagsMap to azblob's BlobTagsMap
@@ -1032,24 +1457,47 @@ func FromAzBlobTagsMapToCommonBlobTags(azbt azblob.BlobTagsMap) BlobTags {
 	return BlobTags(azbt)
 }
 
+// ToString serializes the tags in the form key1=value1&key2=value2, with the keys and values URL escaped
+// (so that they may themselves contain '=' or '&'). ParseBlobTags reverses it.
 func (bt BlobTags) ToString() string {
 	lst := make([]string, 0)
 	for k, v := range bt {
-		lst = append(lst, k+"="+v)
+		lst = append(lst, url.QueryEscape(k)+"="+url.QueryEscape(v))
 	}
 	return strings.Join(lst, "&")
 }
 
-func ToCommonBlobTagsMap(blobTagsString string) BlobTags {
+// ParseBlobTags parses tags in the form made by BlobTags.ToString, which is also the form in which the user gives them
+func ParseBlobTags(blobTagsString string) (BlobTags, error) {
 	if blobTagsString == "" {
-		return nil
+		return nil, nil
 	}
 
 	blobTagsMap := BlobTags{}
 	for _, keyAndValue := range strings.Split(blobTagsString, "&") { // key/value pairs are separated by '&'
 		kv := strings.Split(keyAndValue, "=") // key/value are separated by '='
-		blobTagsMap[kv[0]] = kv[1]
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("blob tag %q is not of the form key=value (use %%3D for an '=' within a key or value, and %%26 for an '&')", keyAndValue)
+		}
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("blob tag key %q is not properly escaped: %w", kv[0], err)
+		}
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("blob tag value %q is not properly escaped: %w", kv[1], err)
+		}
+		if _, exists := blobTagsMap[key]; exists {
+			return nil, fmt.Errorf("blob tag key %q is given more than once", key)
+		}
+		blobTagsMap[key] = value
 	}
+	return blobTagsMap, nil
+}
+
+// ToCommonBlobTagsMap parses tags that were serialized by BlobTags.ToString, which are known to be well formed
+func ToCommonBlobTagsMap(blobTagsString string) BlobTags {
+	blobTagsMap, _ := ParseBlobTags(blobTagsString)
 	return blobTagsMap
 }
 
@@ -173,3 +173,34 @@ func (s *feSteModelsTestSuite) TestMetadataResolveInvalidKeyNegative(c *chk.C) {
 	_, err = mNegative3.ResolveInvalidKey()
 	c.Assert(err, chk.NotNil)
 }
+
+func (s *feSteModelsTestSuite) TestBlobTagsRoundTrip(c *chk.C) {
+	tags := common.BlobTags{"project": "azcopy", "a=b": "c&d", "path": "dir/file name.txt"}
+
+	parsed, err := common.ParseBlobTags(tags.ToString())
+	c.Assert(err, chk.IsNil)
+	validateMapEqual(c, parsed, tags)
+
+	// the form in which the user gives the tags is parsed in the same way
+	parsed, err = common.ParseBlobTags("k1=v1&a%3Db=c%26d")
+	c.Assert(err, chk.IsNil)
+	validateMapEqual(c, parsed, map[string]string{"k1": "v1", "a=b": "c&d"})
+
+	parsed, err = common.ParseBlobTags("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(parsed, chk.IsNil)
+
+	// '+' and '%' are kept as they are, rather than read as an escaped space or an escape of their own
+	tags = common.BlobTags{"a+b": "50%", "c%2Bd": "e+%20f"}
+	parsed, err = common.ParseBlobTags(tags.ToString())
+	c.Assert(err, chk.IsNil)
+	validateMapEqual(c, parsed, tags)
+	validateMapEqual(c, common.ToCommonBlobTagsMap(tags.ToString()), tags)
+}
+
+func (s *feSteModelsTestSuite) TestParseBlobTagsNegative(c *chk.C) {
+	for _, malformed := range []string{"novalue", "k1=v1&novalue", "a=b=c", "k1=v1&k1=v2", "k1=%zz"} {
+		_, err := common.ParseBlobTags(malformed)
+		c.Assert(err, chk.NotNil, chk.Commentf("tags %q", malformed))
+	}
+}
@@ -75,6 +75,8 @@ func (f *simpleFolderTracker) ShouldSetProperties(folder string, overwrite Overw
 		return true
 	case EOverwriteOption.Prompt(),
 		EOverwriteOption.IfSourceNewer(), // TODO discuss if this case should be treated differently than false
+		EOverwriteOption.Append(),
+		EOverwriteOption.IfNotExists(),
 		EOverwriteOption.False():
 
 		f.mu.Lock()
@@ -7,8 +7,10 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -20,6 +22,7 @@ var lcm = func() (lcmgr *lifecycleMgr) {
 		msgQueue:             make(chan outputMessage, 1000),
 		progressCache:        "",
 		cancelChannel:        make(chan os.Signal, 1),
+		signalChannel:        make(chan os.Signal, 1),
 		e2eContinueChannel:   make(chan struct{}),
 		e2eAllowOpenChannel:  make(chan struct{}),
 		outputFormat:         EOutputFormat.Text(), // output text by default
@@ -58,6 +61,7 @@ type LifecycleMgr interface {
 	SetOutputFormat(OutputFormat)                                // change the output format of the entire application
 	EnableInputWatcher()                                         // depending on the command, we may allow user to give input through Stdin
 	EnableCancelFromStdIn()                                      // allow user to send in `cancel` to stop the job
+	EnableBandwidthCapFromStdIn(setCap func(mbps float64))       // allow user to send in `cap-mbps <value>` to change the bandwidth cap of the job
 	AddUserAgentPrefix(string) string                            // append the global user agent prefix, if applicable
 	E2EAwaitContinue()                                           // used by E2E tests
 	E2EAwaitAllowOpenFiles()                                     // used by E2E tests
@@ -73,6 +77,7 @@ type lifecycleMgr struct {
 	msgQueue              chan outputMessage
 	progressCache         string // useful for keeping job progress on the last line
 	cancelChannel         chan os.Signal
+	signalChannel         chan os.Signal // notified when the process is asked to stop, e.g. by Ctrl-C
 	e2eContinueChannel    chan struct{}
 	e2eAllowOpenChannel   chan struct{}
 	waitEverCalled        int32
@@ -81,6 +86,7 @@ type lifecycleMgr struct {
 	inputQueue            chan userInput // msgs from the user
 	allowWatchInput       bool           // accept user inputs and place then in the inputQueue
 	allowCancelFromStdIn  bool           // allow user to send in 'cancel' from the stdin to stop the current job
+	setBandwidthCap       func(float64)  // if set, the user can send in 'cap-mbps <value>' from the stdin to change the bandwidth cap
 	e2eAllowAwaitContinue bool           // allow the user to send 'continue' from stdin to start the current job
 	e2eAllowAwaitOpen     bool           // allow the user to send 'open' from stdin to allow the opening of the first file
 }
@@ -112,6 +118,13 @@ func (lcm *lifecycleMgr) watchInputs() {
 
 		if lcm.allowCancelFromStdIn && strings.EqualFold(msg, "cancel") {
 			lcm.cancelChannel <- os.Interrupt
+		} else if fields := strings.Fields(msg); lcm.setBandwidthCap != nil && len(fields) == 2 && strings.EqualFold(fields[0], "cap-mbps") {
+			mbps, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || mbps < 0 {
+				lcm.Info(fmt.Sprintf("Ignoring invalid bandwidth cap %q. Use a non-negative number of megabits per second, or 0 for no cap.", fields[1]))
+				continue
+			}
+			lcm.setBandwidthCap(mbps)
 		} else if lcm.e2eAllowAwaitContinue && strings.EqualFold(msg, "continue") {
 			close(lcm.e2eContinueChannel)
 		} else if lcm.e2eAllowAwaitOpen && strings.EqualFold(msg, "open") {
@@ -146,6 +159,10 @@ func (lcm *lifecycleMgr) EnableCancelFromStdIn() {
 	lcm.allowCancelFromStdIn = true
 }
 
+func (lcm *lifecycleMgr) EnableBandwidthCapFromStdIn(setCap func(mbps float64)) {
+	lcm.setBandwidthCap = setCap
+}
+
 func (lcm *lifecycleMgr) ClearEnvironmentVariable(variable EnvironmentVariable) {
 	_ = os.Setenv(variable.Name, "")
 }
@@ -315,6 +332,9 @@ func (lcm *lifecycleMgr) processOutputMessage() {
 	// and pass them onto the right handler based on the output format
 	for {
 		msgToPrint := <-lcm.msgQueue
+		if msgToPrint.shouldExitProcess() {
+			flushJobLogs() // the app is about to exit, so the job logs can't wait for their next periodic flush
+		}
 
 		switch lcm.outputFormat {
 		case EOutputFormat.Json():
@@ -439,6 +459,13 @@ type WorkController interface {
 	ReportProgressOrExit(mgr LifecycleMgr) (totalKnownCount uint32) // print the progress status, optionally exit the application if work is done
 }
 
+// PausableWorkController is implemented by controllers of work that can be resumed later. When the process is asked to stop,
+// such work is paused rather than cancelled
+type PausableWorkController interface {
+	WorkController
+	Pause(mgr LifecycleMgr) // handle to pause the work, letting what is in flight finish
+}
+
 // AllowReinitiateProgressReporting must be called before running an cleanup job, to allow the initiation of that job's
 // progress reporting to begin
 func (lcm *lifecycleMgr) AllowReinitiateProgressReporting() {
@@ -457,8 +484,8 @@ func (lcm *lifecycleMgr) InitiateProgressReporting(jc WorkController) {
 		const progressFrequencyThreshold = 1000000
 		var oldCount, newCount uint32
 
-		// cancelChannel will be notified when os receives os.Interrupt and os.Kill signals
-		signal.Notify(lcm.cancelChannel, os.Interrupt, os.Kill)
+		// signalChannel will be notified when the os asks the process to stop
+		signal.Notify(lcm.signalChannel, os.Interrupt, syscall.SIGTERM)
 
 		cancelCalled := false
 
@@ -468,11 +495,23 @@ func (lcm *lifecycleMgr) InitiateProgressReporting(jc WorkController) {
 			jc.Cancel(lcm)
 		}
 
+		doStop := func() {
+			if lcm.onStopSignal(jc, cancelCalled) {
+				lcm.Exit(func(format OutputFormat) string {
+					return "Stopped without waiting for the transfers in flight. The job can still be resumed, but those transfers will start again."
+				}, EExitCode.Error())
+			}
+			cancelCalled = true
+		}
+
 		for {
 			select {
 			case <-lcm.cancelChannel:
 				doCancel()
 				continue // to exit on next pass through loop
+			case <-lcm.signalChannel:
+				doStop()
+				continue
 			default:
 				newCount = jc.ReportProgressOrExit(lcm)
 			}
@@ -491,6 +530,8 @@ func (lcm *lifecycleMgr) InitiateProgressReporting(jc WorkController) {
 			select {
 			case <-lcm.cancelChannel:
 				doCancel()
+			case <-lcm.signalChannel:
+				doStop()
 			case <-time.After(wait):
 			}
 
@@ -499,6 +540,23 @@ func (lcm *lifecycleMgr) InitiateProgressReporting(jc WorkController) {
 	}()
 }
 
+// onStopSignal handles the process being asked to stop. The first time, the work is paused if it can be resumed later, or
+// else cancelled; either way, what is in flight is left to finish, so that its progress is kept. If the work is already
+// being stopped, it returns true, to say that the process should exit straight away.
+func (lcm *lifecycleMgr) onStopSignal(jc WorkController, alreadyStopping bool) (exitNow bool) {
+	if alreadyStopping {
+		return true
+	}
+	if pausable, ok := jc.(PausableWorkController); ok {
+		lcm.Info("Stop requested. Pausing the job, so that it can be resumed, once its transfers in flight finish. Stop again to exit without waiting...")
+		pausable.Pause(lcm)
+		return false
+	}
+	lcm.Info("Cancellation requested. Beginning clean shutdown. Stop again to exit without waiting...")
+	jc.Cancel(lcm)
+	return false
+}
+
 func (lcm *lifecycleMgr) GetEnvironmentVariable(env EnvironmentVariable) string {
 	value := os.Getenv(env.Name)
 	if value == "" {
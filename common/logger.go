@@ -21,13 +21,17 @@
 package common
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -47,6 +51,7 @@ type ILoggerCloser interface {
 type ILoggerResetable interface {
 	OpenLog()
 	MinimumLogLevel() pipeline.LogLevel
+	LogEvent(level pipeline.LogLevel, event LogEvent, transferPath string, msg string)
 	ILoggerCloser
 }
 
@@ -107,14 +112,16 @@ type jobLogger struct {
 	// any message with severity higher than this will be ignored.
 	jobID             JobID
 	minimumLevelToLog pipeline.LogLevel // The maximum customer-desired log level for this job
-	file              *os.File          // The job's log file
+	format            LogFormat         // How the job's log entries are written
+	file              *jobLogFile       // The job's log file
+	maxFileSize       int64             // The size at which the job's log file is rotated. Zero means no limit
 	logFileFolder     string            // The log file's parent folder, needed for opening the file at the right place
 	logger            *log.Logger       // The Job's logger
 	appLogger         ILogger
 	sanitizer         pipeline.LogSanitizer
 }
 
-func NewJobLogger(jobID JobID, minimumLevelToLog LogLevel, appLogger ILogger, logFileFolder string) ILoggerResetable {
+func NewJobLogger(jobID JobID, minimumLevelToLog LogLevel, format LogFormat, appLogger ILogger, logFileFolder string) ILoggerResetable {
 	if appLogger == nil {
 		panic("You must pass a appLogger when creating a JobLogger")
 	}
@@ -123,22 +130,46 @@ func NewJobLogger(jobID JobID, minimumLevelToLog LogLevel, appLogger ILogger, lo
 		jobID:             jobID,
 		appLogger:         appLogger, // Panics are recorded in the job log AND in the app log
 		minimumLevelToLog: minimumLevelToLog.ToPipelineLogLevel(),
+		format:            format,
 		logFileFolder:     logFileFolder,
+		maxFileSize:       getJobLogMaxFileSize(),
 		sanitizer:         NewAzCopyLogSanitizer(),
 	}
 }
 
+// getJobLogMaxFileSize returns the size at which job log files are rotated, or zero if they may grow without limit
+func getJobLogMaxFileSize() int64 {
+	envVar := EEnvironmentVariable.LogMaxSizeMB()
+	overrideString := GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	if overrideString == "" {
+		return 0
+	}
+	megabytes, err := strconv.ParseUint(overrideString, 10, 32)
+	if err != nil {
+		GetLifecycleMgr().Error(fmt.Sprintf("Cannot parse environment variable %s, due to error %s", envVar.Name, err))
+		return 0
+	}
+	return int64(megabytes) * 1024 * 1024
+}
+
 func (jl *jobLogger) OpenLog() {
 	if jl.minimumLevelToLog == pipeline.LogNone {
 		return
 	}
 
-	file, err := os.OpenFile(path.Join(jl.logFileFolder, jl.jobID.String()+".log"),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND, DEFAULT_FILE_PERM)
+	file, err := openJobLogFile(jl.logFileFolder, jl.jobID.String(), jl.maxFileSize)
 	PanicIfErr(err)
 
 	jl.file = file
 
+	if jl.format == ELogFormat.Json() {
+		// each entry carries its own (UTC) timestamp, and the details that the text format puts at the top of the file go in the first entry
+		jl.logger = log.New(jl.file, "", 0)
+		jl.writeEntry(pipeline.LogInfo, ELogEvent.Message(), "",
+			fmt.Sprintf("AzcopyVersion %s, OS-Environment %s, OS-Architecture %s", AzcopyVersion, runtime.GOOS, runtime.GOARCH))
+		return
+	}
+
 	flags := log.LstdFlags | log.LUTC
 	utcMessage := fmt.Sprintf("Log times are in UTC. Local time is " + time.Now().Format("2 Jan 2006 15:04:05"))
 
@@ -167,34 +198,228 @@ func (jl *jobLogger) CloseLog() {
 		return
 	}
 
-	jl.logger.Println("Closing Log")
+	jl.writeEntry(pipeline.LogInfo, ELogEvent.Message(), "", "Closing Log")
 	err := jl.file.Close()
 	PanicIfErr(err)
 }
 
 func (jl jobLogger) Log(loglevel pipeline.LogLevel, msg string) {
-	// If the logger for Job is not initialized i.e file is not open
-	// or logger instance is not initialized, then initialize it
+	jl.LogEvent(loglevel, ELogEvent.Message(), "", msg)
+}
 
+// LogEvent logs msg, saying what it is about, and which transfer (if any) it concerns.
+// Only the JSON format records the event and transfer path as fields of their own.
+// In the text format, this is the same as Log
+func (jl jobLogger) LogEvent(loglevel pipeline.LogLevel, event LogEvent, transferPath string, msg string) {
+	if jl.ShouldLog(loglevel) {
+		jl.writeEntry(loglevel, event, transferPath, msg)
+	}
+}
+
+// jsonLogEntry is a line of a log in the JSON format
+type jsonLogEntry struct {
+	Timestamp    string `json:"timestamp"`
+	Level        string `json:"level"`
+	JobID        string `json:"jobId"`
+	EventType    string `json:"eventType"`
+	TransferPath string `json:"transferPath,omitempty"`
+	Message      string `json:"message"`
+}
+
+// writeEntry writes to the log whatever the level
+func (jl jobLogger) writeEntry(loglevel pipeline.LogLevel, event LogEvent, transferPath string, msg string) {
 	// ensure all secrets are redacted
 	msg = jl.sanitizer.SanitizeLogMessage(msg)
 
-	// Go, and therefore the sdk, defaults to \n for line endings, so if the platform has a different line ending,
-	// we should replace them to ensure readability on the given platform.
-	if lineEnding != "\n" {
-		msg = strings.Replace(msg, "\n", lineEnding, -1)
-	}
-	if jl.ShouldLog(loglevel) {
+	if jl.format == ELogFormat.Json() {
+		// JSON escapes any line endings in the message, so that the entry stays on one line
+		entry, err := json.Marshal(jsonLogEntry{
+			Timestamp:    time.Now().UTC().Format(time.RFC3339Nano),
+			Level:        LogLevel(loglevel).String(),
+			JobID:        jl.jobID.String(),
+			EventType:    event.String(),
+			TransferPath: transferPath,
+			Message:      strings.TrimRight(msg, "\n"),
+		})
+		if err == nil {
+			jl.logger.Println(string(entry))
+		}
+	} else {
+		// Go, and therefore the sdk, defaults to \n for line endings, so if the platform has a different line ending,
+		// we should replace them to ensure readability on the given platform.
+		if lineEnding != "\n" {
+			msg = strings.Replace(msg, "\n", lineEnding, -1)
+		}
 		jl.logger.Println(msg)
 	}
+
+	// the app may be about to go down, so an entry like this can't wait in the buffer for the next periodic flush
+	if loglevel == pipeline.LogFatal || loglevel == pipeline.LogPanic {
+		_ = jl.file.Flush()
+	}
 }
 
 func (jl jobLogger) Panic(err error) {
-	jl.logger.Println(err)  // We do NOT panic here as the app would terminate; we just log it
-	jl.appLogger.Panic(err) // We panic here that it logs and the app terminates
+	jl.writeEntry(pipeline.LogPanic, ELogEvent.Message(), "", err.Error()) // We do NOT panic here as the app would terminate; we just log it (and flush it)
+	jl.appLogger.Panic(err)                                                // We panic here that it logs and the app terminates
 	// We should never reach this line of code!
 }
 
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// maxRotatedLogFiles is how many earlier files of a job's log are kept, once it has been rotated
+const maxRotatedLogFiles = 5
+
+// jobLogFileFlushInterval is the longest that a log entry is held in memory before it is written to the file
+const jobLogFileFlushInterval = time.Second
+
+const jobLogFileBufferSize = 64 * 1024
+
+// jobLogFile is where a job's log is written.
+//
+// So that a busy job isn't slowed down by a write to disk for every line, what is logged is buffered. The buffer is
+// written to the file every jobLogFileFlushInterval, when the log is closed, and before the app exits.
+//
+// Once the file reaches its maximum size, it is renamed to <jobID>.1.log
+// (with any earlier ones moving up to <jobID>.2.log and so on) and a new <jobID>.log is started.
+// That way the log of a job with millions of files can't fill up the disk. Only the newest maxRotatedLogFiles of the
+// earlier files are kept. Since the names still contain the job ID and end in .log, "jobs rm" and "jobs clean" find them.
+// Rotation happens between Writes, and log.Logger writes each entry in one Write, so no entry is split across files.
+type jobLogFile struct {
+	folder  string
+	name    string // the file name, without the .log extension
+	maxSize int64  // zero means no limit
+	done    chan struct{}
+
+	mu     sync.Mutex // protects what follows, since the periodic flush runs alongside the writes
+	file   *os.File
+	buffer *bufio.Writer
+	size   int64 // including what is still in the buffer
+}
+
+// openJobLogFiles holds the files that must be flushed before the app exits
+var openJobLogFiles = struct {
+	sync.Mutex
+	files map[*jobLogFile]struct{}
+}{files: make(map[*jobLogFile]struct{})}
+
+func openJobLogFile(folder string, name string, maxSize int64) (*jobLogFile, error) {
+	f := &jobLogFile{folder: folder, name: name, maxSize: maxSize, done: make(chan struct{})}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.buffer = bufio.NewWriterSize(f.file, jobLogFileBufferSize)
+
+	openJobLogFiles.Lock()
+	openJobLogFiles.files[f] = struct{}{}
+	openJobLogFiles.Unlock()
+
+	go f.flushPeriodically()
+	return f, nil
+}
+
+// path returns the path of the current file when generation is zero, else the path of an earlier one
+func (f *jobLogFile) path(generation int) string {
+	if generation == 0 {
+		return path.Join(f.folder, f.name+".log")
+	}
+	return path.Join(f.folder, fmt.Sprintf("%s.%d.log", f.name, generation))
+}
+
+func (f *jobLogFile) open() error {
+	// append, since a resumed job carries on with the log it had before
+	file, err := os.OpenFile(f.path(0), os.O_RDWR|os.O_CREATE|os.O_APPEND, DEFAULT_FILE_PERM)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *jobLogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// a file with nothing in it is never rotated, so even an entry larger than the limit gets logged
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.buffer.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate must be called with mu held
+func (f *jobLogFile) rotate() error {
+	if err := f.buffer.Flush(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(f.path(maxRotatedLogFiles))
+	for generation := maxRotatedLogFiles - 1; generation >= 0; generation-- {
+		_ = os.Rename(f.path(generation), f.path(generation+1)) // not all the earlier files will exist yet
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.buffer.Reset(f.file)
+	return nil
+}
+
+func (f *jobLogFile) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buffer.Flush()
+}
+
+func (f *jobLogFile) flushPeriodically() {
+	ticker := time.NewTicker(jobLogFileFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			_ = f.Flush() // the next Write will report the error, if it persists
+		}
+	}
+}
+
+func (f *jobLogFile) Close() error {
+	openJobLogFiles.Lock()
+	delete(openJobLogFiles.files, f)
+	openJobLogFiles.Unlock()
+	close(f.done)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	flushErr := f.buffer.Flush()
+	closeErr := f.file.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// flushJobLogs writes out what is buffered for all the open job logs. It is called before the app exits.
+func flushJobLogs() {
+	openJobLogFiles.Lock()
+	defer openJobLogFiles.Unlock()
+	for f := range openJobLogFiles.files {
+		_ = f.Flush()
+	}
+}
+
 const TryEquals string = "Try=" // TODO: refactor so that this can be used by the retry policies too?  So that when you search the logs for Try= you are guaranteed to find both types of retry (i.e. request send retries, and body read retries)
 
 func NewReadLogFunc(logger ILogger, fullUrl *url.URL) func(int, error, int64, int64, bool) {
@@ -26,6 +26,7 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"unsafe"
 )
 
 const lineEnding = "\n"
@@ -71,6 +72,20 @@ func (m *MMF) Unmap() {
 	m.lock.Unlock()
 }
 
+// Flush writes the modified pages of the mapping to the file, and waits until they are on disk
+func (m *MMF) Flush() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if !m.isMapped || len(m.slice) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m.slice[0])), uintptr(len(m.slice)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 func (m *MMF) UseMMF() bool {
 	m.lock.RLock()
 	if !m.isMapped {
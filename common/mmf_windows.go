@@ -99,6 +99,16 @@ func (m *MMF) Unmap() {
 	m.lock.Unlock()
 }
 
+// Flush writes the modified pages of the mapping to the file
+func (m *MMF) Flush() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if !m.isMapped || len(m.slice) == 0 {
+		return nil
+	}
+	return syscall.FlushViewOfFile(uintptr(unsafe.Pointer(&m.slice[0])), uintptr(m.length))
+}
+
 func (m *MMF) UseMMF() bool {
 	m.lock.RLock()
 	if !m.isMapped {
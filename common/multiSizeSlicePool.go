@@ -22,6 +22,7 @@ package common
 
 import (
 	"math/bits"
+	"sync/atomic"
 )
 
 // A pool of byte slices
@@ -62,12 +63,13 @@ func (p *simpleSlicePool) Get() []byte {
 	}
 }
 
-func (p *simpleSlicePool) Put(b []byte) {
+func (p *simpleSlicePool) Put(b []byte) (kept bool) {
 	select {
 	case p.c <- b:
-		return
+		return true
 	default:
 		// just throw b away and let it get GC'd if p.c is full
+		return false
 	}
 }
 
@@ -77,6 +79,13 @@ func (p *simpleSlicePool) Put(b []byte) {
 // (E.g. if only had one pool, holding really big slices, it would be wasteful when
 // we only need to put put small amounts of data into them).
 type multiSizeSlicePool struct {
+	// total capacity of the slices this pool holds. Slices that are rented out aren't counted, since those that are never returned
+	// can't be told apart from those that are still in use
+	atomicPooledBytes int64
+
+	// if not nil, what is in use, beside which the pooled slices must fit within its limit (see NewLimitedMultiSizeSlicePool)
+	inUse CacheLimiter
+
 	// It is safe for multiple readers to read this, once we have populated it
 	// See https://groups.google.com/forum/#!topic/golang-nuts/nL8z96SXcDs
 	poolsBySize []*simpleSlicePool
@@ -84,13 +93,23 @@ type multiSizeSlicePool struct {
 
 // Create new slice pool capable of pooling slices up to maxSliceLength in size
 func NewMultiSizeSlicePool(maxSliceLength int64) ByteSlicePooler {
+	return NewLimitedMultiSizeSlicePool(maxSliceLength, nil)
+}
+
+// NewLimitedMultiSizeSlicePool creates a slice pool that only keeps as many slices as fit within the limit of inUse,
+// beside what has been added to inUse. That way, the data in use (which the caller tallies in inUse, as chunks do in the
+// job's CacheLimiter) and the slices kept for reuse add up to no more than the limit.
+// Pooled slices are thrown away to make room for new ones, whatever their size.
+// The pool never refuses to rent a slice, and doesn't count the slices it has rented out, since those that are never
+// returned can't be told apart from those that are still in use. A nil inUse means no limit.
+func NewLimitedMultiSizeSlicePool(maxSliceLength int64, inUse CacheLimiter) ByteSlicePooler {
 	maxSlotIndex, _ := getSlotInfo(maxSliceLength)
 	poolsBySize := make([]*simpleSlicePool, maxSlotIndex+1)
 	for i := 0; i <= maxSlotIndex; i++ {
 		maxCount := getMaxSliceCountInPool(i)
 		poolsBySize[i] = newSimpleSlicePool(maxCount)
 	}
-	return &multiSizeSlicePool{poolsBySize: poolsBySize}
+	return &multiSizeSlicePool{poolsBySize: poolsBySize, inUse: inUse}
 }
 
 var indexOf32KSlot, _ = getSlotInfo(32 * 1024)
@@ -157,6 +176,8 @@ func (mp *multiSizeSlicePool) RentSlice(desiredSize int64) []byte {
 
 	// try to get a pooled slice
 	if typedSlice := pool.Get(); typedSlice != nil {
+		atomic.AddInt64(&mp.atomicPooledBytes, -int64(cap(typedSlice)))
+
 		// clear out the entire slice up to the capacity
 		// a zero-ing-out loop written in the right form in Go, will be automatically turned into a call to memclr,
 		// which is an optimized Go runtime routine written in assembler
@@ -171,7 +192,9 @@ func (mp *multiSizeSlicePool) RentSlice(desiredSize int64) []byte {
 		return typedSlice
 	}
 
-	// make a new slice if nothing pooled
+	// make a new slice if nothing pooled, first throwing away pooled slices if that's what it takes for them to fit beside what
+	// is in use (which usually includes the data that the new slice is for)
+	mp.makeRoomFor(0)
 	return make([]byte, desiredSize, maxCapInSlot)
 }
 
@@ -182,8 +205,42 @@ func (mp *multiSizeSlicePool) ReturnSlice(slice []byte) {
 	// get the pool that most closely corresponds to the desired size
 	pool := mp.poolsBySize[slotIndex]
 
-	// put the slice back into the pool
-	pool.Put(slice)
+	// put the slice back into the pool, unless there's no room for it within our limit, even once other pooled slices have
+	// been thrown away (e.g. because so much is in use)
+	mp.makeRoomFor(int64(cap(slice)))
+	if mp.inUse != nil && atomic.LoadInt64(&mp.atomicPooledBytes)+int64(cap(slice)) > mp.room() {
+		return // just throw it away, and let it get GC'd
+	}
+	if pool.Put(slice) {
+		atomic.AddInt64(&mp.atomicPooledBytes, int64(cap(slice)))
+	}
+}
+
+// room is how much of our limit is not in use, and so may be taken by pooled slices
+func (mp *multiSizeSlicePool) room() int64 {
+	return mp.inUse.Limit() - mp.inUse.Used()
+}
+
+// makeRoomFor throws away pooled slices, biggest first, until a slice of the given capacity could be pooled within our limit
+// (or there are no more pooled slices to throw away)
+func (mp *multiSizeSlicePool) makeRoomFor(capacity int64) {
+	if mp.inUse == nil {
+		return
+	}
+	for index := len(mp.poolsBySize) - 1; index >= 0; index-- {
+		for atomic.LoadInt64(&mp.atomicPooledBytes)+capacity > mp.room() {
+			slice := mp.poolsBySize[index].Get()
+			if slice == nil {
+				break // nothing left at this size
+			}
+			mp.discard(slice)
+		}
+	}
+}
+
+// discard lets a slice that was taken out of the pool be garbage-collected, and stops counting it
+func (mp *multiSizeSlicePool) discard(slice []byte) {
+	atomic.AddInt64(&mp.atomicPooledBytes, -int64(cap(slice)))
 }
 
 // Prune inactive stuff in all the big slots if due (don't worry about the little ones, they don't eat much RAM)
@@ -202,7 +259,9 @@ func (mp *multiSizeSlicePool) Prune() {
 			// With repeated calls of Prune, this will gradually drain idle pools.
 			// But, since Prune is not called very often,
 			// it won't have much adverse impact on active pools.
-			_ = mp.poolsBySize[index].Get()
+			if slice := mp.poolsBySize[index].Get(); slice != nil {
+				mp.discard(slice)
+			}
 		}
 	}
 }
@@ -86,6 +86,109 @@ func newJsonOutputTemplate(messageType outputMessageType, messageContent string,
 		MessageContent: messageContent, PromptDetails: promptDetails}
 }
 
+// JsonOutputSchemaVersion is the version of the templates below that describe jobs and their transfers,
+// and is included in their output so that parsers can adapt.
+// It must be incremented whenever one of their fields is renamed, removed or changes meaning. Adding a field doesn't need it.
+const JsonOutputSchemaVersion = 1
+
+// StatusCodeJsonTemplate holds a status both as its numeric code and as its name
+type StatusCodeJsonTemplate struct {
+	Code int64
+	Name string
+}
+
+func NewJobStatusCodeJsonTemplate(j JobStatus) StatusCodeJsonTemplate {
+	return StatusCodeJsonTemplate{Code: int64(j), Name: j.String()}
+}
+
+func NewTransferStatusCodeJsonTemplate(ts TransferStatus) StatusCodeJsonTemplate {
+	return StatusCodeJsonTemplate{Code: int64(ts), Name: ts.String()}
+}
+
+// the fields of the embedded structs are kept as they are, so that parsers written before the schema was versioned still work
+type ListJobsJsonTemplate struct {
+	SchemaVersion int
+	ErrorMessage  string
+	JobIDDetails  []JobDetailsJsonTemplate
+}
+
+type JobDetailsJsonTemplate struct {
+	JobIDDetails
+	JobStatusCode  StatusCodeJsonTemplate
+	ThroughputMBps float64 // average over all runs of the job, zero if no run has ended yet
+}
+
+type ListJobTransfersJsonTemplate struct {
+	SchemaVersion int
+	ErrorMsg      string
+	JobID         JobID
+	Details       []TransferDetailJsonTemplate
+}
+
+type TransferDetailJsonTemplate struct {
+	TransferDetail
+	TransferStatusCode StatusCodeJsonTemplate
+}
+
+type JobSummaryJsonTemplate struct {
+	SchemaVersion int
+	ListJobSummaryResponse
+	JobStatusCode  StatusCodeJsonTemplate
+	ThroughputMBps float64 // average over all runs of the job, zero if no run has ended yet
+}
+
+type JobProgressUpdateJsonTemplate struct {
+	SchemaVersion int
+	JobProgressUpdate
+	JobStatusCode    StatusCodeJsonTemplate
+	ChangedTransfers []TransferDetailJsonTemplate
+}
+
+type ListOnlyTransferJsonTemplate struct {
+	SchemaVersion int
+	Path          string // relative to the source root; folders end in '/'
+	SourceSize    int64
+	ModifiedTime  time.Time
+}
+
+type ListOnlySummaryJsonTemplate struct {
+	SchemaVersion int
+	FileCount     uint32
+	TotalBytes    uint64 `json:",string"`
+}
+
+type SyncDryRunEntryJsonTemplate struct {
+	SchemaVersion int
+	Action        SyncAction
+	Path          string // relative to the source (or, for deletions, the destination) root
+	SourceSize    int64
+	ModifiedTime  time.Time
+}
+
+type SyncDryRunSummaryJsonTemplate struct {
+	SchemaVersion int
+	WillAdd       uint32
+	WillUpdate    uint32
+	WillDelete    uint32
+	Unchanged     uint32
+}
+
+type SyncVerifyFailureJsonTemplate struct {
+	SchemaVersion   int
+	Problem         string // Mismatched or Missing
+	Path            string // relative to the source root
+	Reason          string
+	SourceSize      int64
+	DestinationSize int64 // zero if the destination is missing
+}
+
+type SyncVerifySummaryJsonTemplate struct {
+	SchemaVersion int
+	Verified      uint32
+	Mismatched    uint32
+	Missing       uint32
+}
+
 type InitMsgJsonTemplate struct {
 	LogFileLocation string
 	JobID           string
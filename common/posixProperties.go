@@ -0,0 +1,116 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// The metadata keys under which the POSIX properties of an uploaded file are kept, so that a download can restore them
+const (
+	POSIXModeMeta  = "posix_mode"  // the permission bits, along with the setuid, setgid and sticky bits, in octal
+	POSIXOwnerMeta = "posix_owner" // the user ID of the owner, in decimal
+	POSIXGroupMeta = "posix_group" // the group ID, in decimal
+)
+
+// POSIXProperties are the permissions and ownership of a file on a Unix-like system
+type POSIXProperties struct {
+	Mode os.FileMode // only the permission bits, along with os.ModeSetuid, os.ModeSetgid and os.ModeSticky
+	UID  uint32
+	GID  uint32
+}
+
+// AddToMetadata returns a copy of the metadata (which may be nil) with the properties added
+func (p POSIXProperties) AddToMetadata(metadata Metadata) Metadata {
+	result := make(Metadata, len(metadata)+3)
+	for k, v := range metadata {
+		result[k] = v
+	}
+	result[POSIXModeMeta] = p.OctalMode()
+	result[POSIXOwnerMeta] = strconv.FormatUint(uint64(p.UID), 10)
+	result[POSIXGroupMeta] = strconv.FormatUint(uint64(p.GID), 10)
+	return result
+}
+
+// OctalMode returns the permission bits, along with the setuid, setgid and sticky bits, in the octal form used by chmod, e.g. "0644"
+func (p POSIXProperties) OctalMode() string {
+	return fmt.Sprintf("%04o", unixModeBits(p.Mode))
+}
+
+// POSIXPropertiesFromMetadata returns the properties that AddToMetadata put in the metadata. ok is false if there are none,
+// e.g. because the file was not uploaded with them.
+func POSIXPropertiesFromMetadata(metadata Metadata) (p POSIXProperties, ok bool, err error) {
+	mode, hasMode := metadata[POSIXModeMeta]
+	if !hasMode {
+		return POSIXProperties{}, false, nil
+	}
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || bits > 07777 {
+		return POSIXProperties{}, false, fmt.Errorf("invalid %s metadata '%s'", POSIXModeMeta, mode)
+	}
+	p.Mode = fileModeFromUnixBits(uint32(bits))
+	if p.UID, err = parsePOSIXID(metadata, POSIXOwnerMeta); err != nil {
+		return POSIXProperties{}, false, err
+	}
+	if p.GID, err = parsePOSIXID(metadata, POSIXGroupMeta); err != nil {
+		return POSIXProperties{}, false, err
+	}
+	return p, true, nil
+}
+
+func parsePOSIXID(metadata Metadata, key string) (uint32, error) {
+	id, err := strconv.ParseUint(metadata[key], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s metadata '%s'", key, metadata[key])
+	}
+	return uint32(id), nil
+}
+
+// os.FileMode has its own bits for setuid, setgid and sticky, which differ from those of Unix
+func unixModeBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+func fileModeFromUnixBits(bits uint32) os.FileMode {
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,52 @@
+// +build !windows
+
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"os"
+	"syscall"
+)
+
+// GetPOSIXProperties returns the POSIX properties of the file that info describes. ok is false if the OS has none.
+func GetPOSIXProperties(info os.FileInfo) (p POSIXProperties, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return POSIXProperties{}, false
+	}
+	mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	return POSIXProperties{Mode: mode, UID: stat.Uid, GID: stat.Gid}, true
+}
+
+// Apply gives the file at path these properties. The ownership is set first, since changing it can clear the setuid and setgid bits.
+// Only a privileged user may give a file to another user, so if that is not allowed, the permissions are still set,
+// and ownerSet is false rather than there being an error.
+func (p POSIXProperties) Apply(path string) (ownerSet bool, err error) {
+	ownerSet = true
+	if err = os.Chown(path, int(p.UID), int(p.GID)); err != nil {
+		if !os.IsPermission(err) {
+			return false, err
+		}
+		ownerSet = false
+	}
+	return ownerSet, os.Chmod(path, p.Mode)
+}
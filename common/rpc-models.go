@@ -23,9 +23,11 @@ func (RpcCmd) ListJobSummary() RpcCmd     { return RpcCmd("ListJobSummary") }
 func (RpcCmd) ListSyncJobSummary() RpcCmd { return RpcCmd("ListSyncJobSummary") }
 func (RpcCmd) ListJobTransfers() RpcCmd   { return RpcCmd("ListJobTransfers") }
 func (RpcCmd) CancelJob() RpcCmd          { return RpcCmd("Cancel") }
+func (RpcCmd) CancelAllJobs() RpcCmd      { return RpcCmd("CancelAllJobs") }
 func (RpcCmd) PauseJob() RpcCmd           { return RpcCmd("PauseJob") }
 func (RpcCmd) ResumeJob() RpcCmd          { return RpcCmd("ResumeJob") }
 func (RpcCmd) GetJobFromTo() RpcCmd       { return RpcCmd("GetJobFromTo") }
+func (RpcCmd) SetBandwidthCap() RpcCmd    { return RpcCmd("SetBandwidthCap") }
 
 func (c RpcCmd) String() string {
 	return enum.String(c, reflect.TypeOf(c))
@@ -127,16 +129,57 @@ type CopyJobPartOrderRequest struct {
 
 	Transfers      []CopyTransfer
 	LogLevel       LogLevel
+	LogFormat      LogFormat
 	BlobAttributes BlobTransferAttributes
 	CommandString  string // commandString hold the user given command which is logged to the Job log file
 	CredentialInfo CredentialInfo
 
 	PreserveSMBPermissions         PreservePermissionsOption
 	PreserveSMBInfo                bool
+	PreservePOSIXProperties        bool // if true, uploads save the permissions and ownership of local files in blob metadata, and downloads restore them
+	PreserveACLs                   bool // if true, copies between accounts with a hierarchical namespace keep the owner, group and ACL of each file
+	PreserveImmutability           bool // if true, copies between blob accounts give each blob the immutability policy and legal hold of its source
 	S2SGetPropertiesInBackend      bool
 	S2SSourceChangeValidation      bool
+	S2SRehydrateArchivedSource     bool // if true, archived source blobs are rehydrated (to the Hot tier) and waited for, rather than failing
+	S2SCopyMethod                  S2SCopyMethod
+	SkipIfHashMatches              bool // if true, a file is not sent to a blob that already holds a hash (of the job's ChecksumAlgorithm) matching the file's own
 	DestLengthValidation           bool
 	S2SInvalidMetadataHandleOption InvalidMetadataHandleOption
+	DryRun                         bool // if true, the job part plan is written out but its transfers are never scheduled
+	// DestinationCollisionOption is how the enumeration resolved the collisions between files that were given the same destination.
+	// The transfers already have their resolved destinations; it is kept so that the plan records how they were named.
+	DestinationCollisionOption DestinationCollisionOption
+	// SourceNewerTolerance supplements ForceWrite when it is IfSourceNewer: the source must be newer than the destination by more than this, to allow for clock skew
+	SourceNewerTolerance time.Duration
+	// ContentTypeOverrides maps lower-case file extensions (with the leading dot) to the content type to use for them on upload.
+	// It takes precedence over the built-in detection, and is stored in the plan file, so that a resumed job uses it too.
+	ContentTypeOverrides map[string]string
+	// TTLAfterCompletion is how long the job's plan files are kept once the job has finished, before they are cleaned up. Zero keeps them forever.
+	TTLAfterCompletion time.Duration
+	// Concurrency is the maximum number of the job's transfers to have in progress at once. Zero means use the engine default
+	Concurrency uint16
+	// MaxDuration is how long each run of the job may last. Once it has been exceeded, no more transfers are started, and the job
+	// is cancelled when those in progress have finished. Zero means no limit
+	MaxDuration time.Duration
+	// MaxRetries is how many times each failed transfer may be retried, over all resumes of the job. -1 means use the engine default
+	MaxRetries int32
+	// BandwidthSchedule varies the bandwidth cap by the time of day while the job runs, including when it is resumed. Empty means it doesn't
+	BandwidthSchedule BandwidthSchedule
+	// RetryChangedFiles is whether a transfer whose source changed while it was being sent is started again straight away,
+	// rather than being left as failed
+	RetryChangedFiles bool
+	// MaxTotalBytes is the most data that the job may transfer, over all its runs. The job is stopped rather than start a transfer
+	// that would take it past the limit. Zero means no limit
+	MaxTotalBytes uint64
+	// CpkKeySha256 is the base64 encoded SHA-256 of the customer-provided key with which blob data is encrypted, or empty if there is none.
+	// The key itself is never sent to the engine's plan; it is read from the environment when the transfers run.
+	CpkKeySha256 string
+	// SASRefreshCommand is a command line that prints a new SAS token, which the job runs when its SAS token is about to expire.
+	// Empty means the SAS tokens are not refreshed. Like the SAS tokens themselves, it is not persisted in the plan file.
+	SASRefreshCommand string
+	// TransferOrder is the order in which the transfers of each part are scheduled. It is not persisted in the plan file
+	TransferOrder TransferOrder
 }
 
 // CredentialInfo contains essential credential info which need be transited between modules,
@@ -191,6 +234,14 @@ type BlobTransferAttributes struct {
 	BlockSizeInBytes         int64                 // when uploading/downloading/copying, specify the size of each chunk
 	DeleteSnapshotsOption    DeleteSnapshotsOption // when deleting, specify what to do with the snapshots
 	BlobTagsString           string
+	ChecksumAlgorithm        HashAlgorithm // the hash that PutMd5 puts, and that MD5ValidationOption checks
+	GzipUpload               bool          // when uploading block blobs, compress them with gzip as they are sent
+	GzipMinSize              int64         // only files of at least this many bytes are compressed
+	GzipExtensions           string        // if not empty, only files with one of these extensions (e.g. ".log;.json") are compressed
+
+	// if ImmutabilityPolicyExpiresOn is not zero, every blob that is written is given an immutability policy that lasts until then, in ImmutabilityPolicyMode
+	ImmutabilityPolicyExpiresOn time.Time
+	ImmutabilityPolicyMode      ImmutabilityPolicyMode
 }
 
 type JobIDDetails struct {
@@ -198,6 +249,10 @@ type JobIDDetails struct {
 	CommandString string
 	StartTime     int64
 	JobStatus     JobStatus
+	NumTransfers  uint32
+	// over all runs of the job
+	BytesTransferred uint64 `json:",string"`
+	ElapsedSeconds   float64
 }
 
 // ListJobsResponse represent the Job with JobId and
@@ -221,6 +276,8 @@ type ListJobSummaryResponse struct {
 	// CompleteJobOrdered determines whether the Job has been completely ordered or not
 	CompleteJobOrdered bool
 	JobStatus          JobStatus
+	// why the job was cancelled, if it was
+	CancelReason JobCancelReason
 
 	TotalTransfers uint32 `json:",string"` // = FileTransfers + FolderPropertyTransfers. It also = TransfersCompleted + TransfersFailed + TransfersSkipped
 	// FileTransfers and FolderPropertyTransfers just break the total down into the two types.
@@ -233,6 +290,11 @@ type ListJobSummaryResponse struct {
 	TransfersCompleted uint32 `json:",string"`
 	TransfersFailed    uint32 `json:",string"`
 	TransfersSkipped   uint32 `json:",string"`
+	// transfers in progress that have stopped moving data (see TransferStatus.Stalled). They are also still counted as in progress
+	TransfersStalled uint32 `json:",string"`
+
+	// number of times failed transfers were retried, summed over all transfers and all runs of the job
+	TransferRetries uint32 `json:",string"`
 
 	// includes bytes sent in retries (i.e. has double counting, if there are retries) and in failed transfers
 	BytesOverWire uint64 `json:",string"`
@@ -247,6 +309,27 @@ type ListJobSummaryResponse struct {
 
 	PercentComplete float32 `json:",string"`
 
+	// sum of the sizes of the job's files, as they were enumerated when the job was planned
+	TotalBytesPlanned uint64 `json:",string"`
+	// bytes of the job's files that are done: all of each file that succeeded or was skipped, and the completed chunks of the files
+	// in progress. Unlike TotalBytesTransferred, this is kept in the plan files, so it includes the files in progress even when
+	// read from another process
+	BytesCompleted uint64 `json:",string"`
+	// BytesCompleted as a percentage of TotalBytesPlanned
+	BytesPercentComplete float32 `json:",string"`
+
+	// bytes transferred by completed chunks (including those of transfers that later failed), summed over all runs of the job
+	CumulativeBytesTransferred uint64 `json:",string"`
+	// time spent running the job, summed over all of its runs that have ended
+	CumulativeElapsedSeconds float64 `json:",string"`
+
+	// average duration of the transfers that have completed, from their first start to their (latest) completion
+	AverageTransferMilliseconds int64 `json:",string"`
+	// the transfers that took longest to complete, slowest first
+	SlowestTransfers []TransferDetail
+	// the spread of the throughputs of the file transfers that have succeeded
+	TransferThroughput TransferThroughputPercentiles
+
 	// Stats measured from the network pipeline
 	// Values are all-time values, for the duration of the job.
 	// Will be zero if read outside the process running the job (e.g. with 'jobs show' command)
@@ -269,6 +352,7 @@ type ListSyncJobSummaryResponse struct {
 	ListJobSummaryResponse
 	DeleteTotalTransfers     uint32 `json:",string"`
 	DeleteTransfersCompleted uint32 `json:",string"`
+	DeleteTransfersFailed    uint32 `json:",string"`
 }
 
 type ListJobTransfersRequest struct {
@@ -283,6 +367,26 @@ type ResumeJobRequest struct {
 	IncludeTransfer map[string]int
 	ExcludeTransfer map[string]int
 	CredentialInfo  CredentialInfo
+	// FailedOnly restricts the resumption of a finished job to the transfers that failed. Completed and skipped transfers are left untouched either way
+	FailedOnly bool
+	// Concurrency overrides the job's stored transfer concurrency. Zero keeps the value stored in the plan
+	Concurrency uint16
+	// MaxTotalBytes overrides the job's stored MaxTotalBytes, e.g. to let a job that reached it go on. Zero keeps the value stored in the plan
+	MaxTotalBytes uint64
+	// SASRefreshCommand is as for CopyJobPartOrderRequest
+	SASRefreshCommand string
+	// TransferOrder is as for CopyJobPartOrderRequest. Since it is not persisted, the job is resumed in plan order unless it is given again
+	TransferOrder TransferOrder
+}
+
+// TransferThroughputPercentiles describes the spread of the throughputs, in MB/s, of individual transfers. The percentiles are
+// estimated from a histogram, so they are within a few percent of the real values.
+type TransferThroughputPercentiles struct {
+	// how many transfers the percentiles are over. Empty files, and transfers whose times are not known, are left out
+	TimedTransfers uint32  `json:",string"`
+	P50MBps        float64 `json:",string"`
+	P90MBps        float64 `json:",string"`
+	P99MBps        float64 `json:",string"`
 }
 
 // represents the Details and details of a single transfer
@@ -290,8 +394,38 @@ type TransferDetail struct {
 	Src                string
 	Dst                string
 	IsFolderProperties bool
+	SourceSize         int64 `json:",string"`
+	// when the source was last modified, as it was enumerated (or as it was found, if it changed during the transfer). Zero if not known
+	SourceModifiedTime time.Time
 	TransferStatus     TransferStatus
 	ErrorCode          int32 `json:",string"`
+	// the last failure reason of the transfer, possibly truncated. Empty if it never failed, or failed in a version of AzCopy that didn't record reasons
+	ErrorMessage string
+	// the version ID of the blob that the transfer created, if the destination is a blob in an account with versioning enabled
+	DestVersionID string
+
+	// from the first start of the transfer to its (latest) completion. Zero if not known, e.g. if the transfer hasn't completed
+	DurationMilliseconds int64 `json:",string"`
+}
+
+// JobProgressUpdate is what a job's plan files say about its progress, and what has changed since the previous update
+type JobProgressUpdate struct {
+	Timestamp          time.Time
+	JobID              JobID
+	JobStatus          JobStatus
+	TotalTransfers     uint32
+	TransfersCompleted uint32
+	TransfersFailed    uint32
+	TransfersSkipped   uint32
+	BytesTransferred   uint64 `json:",string"`
+	// since the previous update
+	BytesTransferredDelta uint64 `json:",string"`
+	// as in ListJobSummaryResponse
+	TotalBytesPlanned    uint64  `json:",string"`
+	BytesCompleted       uint64  `json:",string"`
+	BytesPercentComplete float32 `json:",string"`
+	// the transfers whose status has changed since the previous update; always empty in the first update
+	ChangedTransfers []TransferDetail
 }
 
 type CancelPauseResumeResponse struct {
@@ -299,6 +433,13 @@ type CancelPauseResumeResponse struct {
 	CancelledPauseResumed bool
 }
 
+// CancelAllJobsResponse lists the jobs that a request to cancel all jobs cancelled.
+// ErrorMsg explains why any others that were in progress could not be cancelled.
+type CancelAllJobsResponse struct {
+	CancelledJobIDs []JobID
+	ErrorMsg        string
+}
+
 // represents the list of Details and details of number of transfers
 type ListJobTransfersResponse struct {
 	ErrorMsg string
@@ -317,4 +458,16 @@ type GetJobFromToResponse struct {
 	FromTo      FromTo
 	Source      string
 	Destination string
+	// CredentialType is how the job authenticated when it was started
+	CredentialType CredentialType
+}
+
+// SetBandwidthCapRequest indicates request to change the cap on the aggregate throughput of all running jobs.
+type SetBandwidthCapRequest struct {
+	CapMbps float64 // in megabits per second; zero removes the cap
+}
+
+// SetBandwidthCapResponse indicates response to change the bandwidth cap.
+type SetBandwidthCapResponse struct {
+	ErrorMsg string
 }
@@ -31,6 +31,8 @@ const IncludeAfterFlagName = "include-after"
 const BackupModeFlagName = "backup" // original name, backup mode, matches the name used for the same thing in Robocopy
 const PreserveOwnerFlagName = "preserve-owner"
 const PreserveOwnerDefault = true
+const PreserveLastModifiedTimeFlagName = "preserve-last-modified-time"
+const PreserveLastModifiedTimeDefault = true
 
 // The regex doesn't require a / on the ending, it just requires something similar to the following
 // C:
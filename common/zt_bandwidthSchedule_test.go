@@ -0,0 +1,95 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common_test
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type bandwidthScheduleTestSuite struct{}
+
+var _ = chk.Suite(&bandwidthScheduleTestSuite{})
+
+func atTime(hour, minute int) time.Time {
+	return time.Date(2021, 3, 14, hour, minute, 0, 0, time.UTC)
+}
+
+func (s *bandwidthScheduleTestSuite) TestParseBandwidthSchedule(c *chk.C) {
+	schedule, err := common.ParseBandwidthSchedule("09:00-17:30=100, 22:00-06:00=0,17:30-24:00=2.5")
+	c.Assert(err, chk.IsNil)
+	c.Assert(schedule, chk.DeepEquals, common.BandwidthSchedule{
+		{StartMinute: 9 * 60, EndMinute: 17*60 + 30, CapMbps: 100},
+		{StartMinute: 22 * 60, EndMinute: 6 * 60, CapMbps: 0},
+		{StartMinute: 17*60 + 30, EndMinute: 24 * 60, CapMbps: 2.5},
+	})
+	c.Assert(schedule.String(), chk.Equals, "09:00-17:30=100,22:00-06:00=0,17:30-24:00=2.5")
+
+	schedule, err = common.ParseBandwidthSchedule("")
+	c.Assert(err, chk.IsNil)
+	c.Assert(schedule, chk.HasLen, 0)
+
+	for _, invalid := range []string{"09:00-17:00", "9-17=100", "09:00-17:00=-1", "24:00-06:00=10", "09:60-17:00=10",
+		"09:00-09:00=10", "00:00-24:00=10", "09:00-17:00=10,"} {
+		_, err = common.ParseBandwidthSchedule(invalid)
+		c.Assert(err, chk.NotNil, chk.Commentf("%s", invalid))
+	}
+}
+
+func (s *bandwidthScheduleTestSuite) TestBandwidthScheduleCapAt(c *chk.C) {
+	// the first window overlaps the second, and so wins from 09:00 to 12:00
+	schedule, err := common.ParseBandwidthSchedule("09:00-12:00=50,08:00-17:00=100,22:00-06:00=0")
+	c.Assert(err, chk.IsNil)
+
+	for _, test := range []struct {
+		at       time.Time
+		mbps     float64
+		inWindow bool
+	}{
+		{atTime(7, 59), 0, false},
+		{atTime(8, 0), 100, true}, // the start is included
+		{atTime(9, 0), 50, true},
+		{atTime(11, 59), 50, true},
+		{atTime(12, 0), 100, true}, // the end is not
+		{atTime(17, 0), 0, false},
+		{atTime(23, 0), 0, true},
+		{atTime(0, 0), 0, true},
+		{atTime(6, 0), 0, false},
+	} {
+		mbps, inWindow := schedule.CapAt(test.at)
+		c.Assert(mbps, chk.Equals, test.mbps, chk.Commentf("%v", test.at))
+		c.Assert(inWindow, chk.Equals, test.inWindow, chk.Commentf("%v", test.at))
+	}
+}
+
+func (s *bandwidthScheduleTestSuite) TestBandwidthScheduleNextChange(c *chk.C) {
+	schedule, err := common.ParseBandwidthSchedule("09:00-17:00=100,22:00-06:00=0")
+	c.Assert(err, chk.IsNil)
+
+	c.Assert(schedule.NextChange(atTime(8, 0)), chk.Equals, atTime(9, 0))
+	c.Assert(schedule.NextChange(atTime(9, 0)), chk.Equals, atTime(17, 0)) // a boundary at exactly now has passed
+	c.Assert(schedule.NextChange(atTime(21, 0)), chk.Equals, atTime(22, 0))
+	c.Assert(schedule.NextChange(atTime(23, 0)), chk.Equals, atTime(6, 0).AddDate(0, 0, 1))
+	c.Assert(schedule.NextChange(atTime(3, 0)), chk.Equals, atTime(6, 0))
+	c.Assert(common.BandwidthSchedule(nil).NextChange(atTime(3, 0)).IsZero(), chk.Equals, true)
+}
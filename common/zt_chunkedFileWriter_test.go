@@ -0,0 +1,112 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+
+	chk "gopkg.in/check.v1"
+)
+
+type chunkedFileWriterSuite struct{}
+
+var _ = chk.Suite(&chunkedFileWriterSuite{})
+
+type nullChunkStatusLogger struct{}
+
+func (nullChunkStatusLogger) LogChunkStatus(id ChunkID, reason WaitReason) {}
+func (nullChunkStatusLogger) IsWaitingOnFinalBodyReads() bool              { return false }
+
+func (s *chunkedFileWriterSuite) TestResumedWriteHashesWholeFile(c *chk.C) {
+	const chunkSize = 4
+	data := []byte("savedsavedtail of the file")
+	prefixLength := int64(8)
+	prefix := ResumedFilePrefix{
+		Length: prefixLength,
+		Open:   func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(data)), nil },
+	}
+
+	var saved []int64
+	file := &closeableBuffer{Buffer: &bytes.Buffer{}}
+	numChunks := uint32((int64(len(data)) - prefixLength + chunkSize - 1) / chunkSize)
+	w := NewChunkedFileWriter(context.Background(), NewMultiSizeSlicePool(1024), NewCacheLimiter(1024), nullChunkStatusLogger{}, file, numChunks,
+		1, EHashValidationOption.FailIfDifferent(), true, EHashAlgorithm.MD5(), prefix, func(id ChunkID) { saved = append(saved, id.OffsetInFile()) })
+
+	// enqueue the chunks after the prefix out of order; they must still be saved in order
+	var offsets []int64
+	for offset := prefixLength; offset < int64(len(data)); offset += chunkSize {
+		offsets = append([]int64{offset}, offsets...)
+	}
+	for _, offset := range offsets {
+		length := int64(chunkSize)
+		if offset+length > int64(len(data)) {
+			length = int64(len(data)) - offset
+		}
+		id := NewChunkID("file", offset, length)
+		c.Assert(w.WaitToScheduleChunk(context.Background(), id, length), chk.IsNil)
+		c.Assert(w.EnqueueChunk(context.Background(), id, length, bytes.NewReader(data[offset:offset+length]), false), chk.IsNil)
+	}
+
+	hash, err := w.Flush(context.Background())
+	c.Assert(err, chk.IsNil)
+	expected := md5.Sum(data)
+	c.Assert(hash, chk.DeepEquals, expected[:])
+	c.Assert(file.String(), chk.Equals, string(data[prefixLength:]))
+	c.Assert(saved, chk.DeepEquals, []int64{8, 12, 16, 20, 24})
+}
+
+func (s *chunkedFileWriterSuite) TestShortReadIsNotSaved(c *chk.C) {
+	file := &closeableBuffer{Buffer: &bytes.Buffer{}}
+	w := NewChunkedFileWriter(context.Background(), NewMultiSizeSlicePool(1024), NewCacheLimiter(1024), nullChunkStatusLogger{}, file, 1,
+		1, EHashValidationOption.NoCheck(), false, EHashAlgorithm.MD5(), ResumedFilePrefix{}, nil)
+
+	// the body of the response ends early, without any error from the connection
+	id := NewChunkID("file", 0, 10)
+	c.Assert(w.WaitToScheduleChunk(context.Background(), id, 10), chk.IsNil)
+	err := w.EnqueueChunk(context.Background(), id, 10, bytes.NewReader([]byte("0123")), false)
+	c.Assert(err, chk.Equals, io.ErrUnexpectedEOF)
+	c.Assert(file.Len(), chk.Equals, 0)
+}
+
+func (s *chunkedFileWriterSuite) TestDecompressedWriteHashesCompressedData(c *chk.C) {
+	// the hash stored with a gzip-encoded blob is the hash of its compressed bytes, so that is what must be hashed when we decompress
+	original := bytes.Repeat([]byte("compressible data "), 1000)
+	compressed, err := ioutil.ReadAll(NewGzipCompressingReader(bytes.NewReader(original)))
+	c.Assert(err, chk.IsNil)
+
+	file := &closeableBuffer{Buffer: &bytes.Buffer{}}
+	w := NewChunkedFileWriter(context.Background(), NewMultiSizeSlicePool(1024*1024), NewCacheLimiter(1024*1024), nullChunkStatusLogger{},
+		NewDecompressingWriter(file, ECompressionType.GZip()), 1, 1, EHashValidationOption.FailIfDifferent(), true, EHashAlgorithm.MD5(), ResumedFilePrefix{}, nil)
+
+	length := int64(len(compressed))
+	id := NewChunkID("file", 0, length)
+	c.Assert(w.WaitToScheduleChunk(context.Background(), id, length), chk.IsNil)
+	c.Assert(w.EnqueueChunk(context.Background(), id, length, bytes.NewReader(compressed), false), chk.IsNil)
+
+	hash, err := w.Flush(context.Background())
+	c.Assert(err, chk.IsNil)
+	expected := md5.Sum(compressed)
+	c.Assert(hash, chk.DeepEquals, expected[:])
+}
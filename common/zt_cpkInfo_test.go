@@ -0,0 +1,73 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common_test
+
+import (
+	"os"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type cpkInfoTestSuite struct{}
+
+var _ = chk.Suite(&cpkInfoTestSuite{})
+
+const (
+	testCpkKey       = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=" // the bytes 0 to 31
+	testCpkKeySha256 = "Yw3NKWbEM2aRElRIu7JbT/QSpJxzLbLIq8G4WBvXEN0="
+)
+
+func (s *cpkInfoTestSuite) TestNewCpkInfo(c *chk.C) {
+	cpkInfo, err := common.NewCpkInfo(testCpkKey)
+	c.Assert(err, chk.IsNil)
+	c.Assert(cpkInfo.EncryptionKey, chk.Equals, testCpkKey)
+	c.Assert(cpkInfo.EncryptionKeySha256, chk.Equals, testCpkKeySha256)
+
+	// not base64
+	_, err = common.NewCpkInfo("not a key!")
+	c.Assert(err, chk.NotNil)
+	// 128 bits
+	_, err = common.NewCpkInfo("AAECAwQFBgcICQoLDA0ODw==")
+	c.Assert(err, chk.NotNil)
+	c.Assert(err.Error(), chk.Matches, ".*128 bits.*")
+	// empty
+	_, err = common.NewCpkInfo("")
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *cpkInfoTestSuite) TestGetCpkInfoFromEnvironment(c *chk.C) {
+	envVar := common.EEnvironmentVariable.CPKEncryptionKey().Name
+	defer os.Unsetenv(envVar)
+
+	os.Unsetenv(envVar)
+	_, err := common.GetCpkInfoFromEnvironment()
+	c.Assert(err, chk.NotNil)
+
+	os.Setenv(envVar, "AAECAwQFBgcICQoLDA0ODw==")
+	_, err = common.GetCpkInfoFromEnvironment()
+	c.Assert(err, chk.NotNil)
+
+	os.Setenv(envVar, testCpkKey)
+	cpkInfo, err := common.GetCpkInfoFromEnvironment()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cpkInfo.EncryptionKeySha256, chk.Equals, testCpkKeySha256)
+}
@@ -26,6 +26,7 @@ import (
 	"compress/zlib"
 	chk "gopkg.in/check.v1"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"sync/atomic"
 )
@@ -118,6 +119,78 @@ func (d *decompressingWriterSuite) TestDecompressingWriter_EarlyClose(c *chk.C)
 	}
 }
 
+func (d *decompressingWriterSuite) TestDecompressingWriter_InvalidData(c *chk.C) {
+	// given:
+	// data that is not gzip at all, and gzip data that has been corrupted after its header
+	_, compressedData := d.getTestData(c, ECompressionType.GZip(), 64*1024)
+	corrupted := append([]byte{}, compressedData...)
+	for i := 20; i < len(corrupted)-8; i++ {
+		corrupted[i] ^= 0xff
+	}
+	cases := [][]byte{d.genCompressibleTestData(64 * 1024), corrupted}
+
+	for _, data := range cases {
+		// when:
+		destFile := &closeableBuffer{Buffer: &bytes.Buffer{}}
+		decWriter := NewDecompressingWriter(destFile, ECompressionType.GZip())
+		_, writeErr := io.Copy(decWriter, bytes.NewReader(data))
+		closeErr := decWriter.Close()
+
+		// then:
+		// the error says that the data is not valid gzip
+		err := writeErr
+		if err == nil {
+			err = closeErr
+		}
+		c.Assert(err, chk.NotNil)
+		c.Assert(err, chk.ErrorMatches, ".*content encoding says it is GZip compressed, but its data is not valid GZip.*")
+		c.Assert(destFile.closeWasCalled(), chk.Equals, true)
+	}
+}
+
+func (d *decompressingWriterSuite) TestGzipCompressingReader_RoundTrip(c *chk.C) {
+	for _, size := range []int{0, 1234, 3 * 1024 * 1024} {
+		// given:
+		originalData := d.genCompressibleTestData(size)
+
+		// when:
+		// we compress it with a compressing reader, and decompress the result with a decompressing writer
+		compReader := NewGzipCompressingReader(bytes.NewReader(originalData))
+		compressedData, err := ioutil.ReadAll(compReader)
+		c.Assert(err, chk.IsNil)
+		c.Assert(compReader.Close(), chk.IsNil)
+		destFile := &closeableBuffer{Buffer: &bytes.Buffer{}}
+		decWriter := NewDecompressingWriter(destFile, ECompressionType.GZip())
+		_, err = io.Copy(decWriter, bytes.NewReader(compressedData))
+		c.Assert(err, chk.IsNil)
+		c.Assert(decWriter.Close(), chk.IsNil)
+
+		// then:
+		// we get back what we started with
+		c.Assert(bytes.Equal(destFile.Bytes(), originalData), chk.Equals, true)
+		if size > 1024 {
+			c.Assert(len(compressedData) < size, chk.Equals, true)
+		}
+	}
+}
+
+func (d *decompressingWriterSuite) TestGzipCompressingReader_EarlyClose(c *chk.C) {
+	// given:
+	// a compressing reader from which only a little has been read
+	compReader := NewGzipCompressingReader(bytes.NewReader(d.genCompressibleTestData(10 * 1024 * 1024)))
+	_, err := io.ReadFull(compReader, make([]byte, 100))
+	c.Assert(err, chk.IsNil)
+
+	// when:
+	err = compReader.Close()
+
+	// then:
+	// nothing more can be read
+	c.Assert(err, chk.IsNil)
+	_, err = compReader.Read(make([]byte, 100))
+	c.Assert(err, chk.Equals, io.ErrClosedPipe)
+}
+
 func (d *decompressingWriterSuite) getTestData(c *chk.C, tp CompressionType, originalSize int) (original []byte, compressed []byte) {
 	// we have original uncompressed data
 	originalData := d.genCompressibleTestData(originalSize)
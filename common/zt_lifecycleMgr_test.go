@@ -0,0 +1,73 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	chk "gopkg.in/check.v1"
+)
+
+type lifecycleMgrSuite struct{}
+
+var _ = chk.Suite(&lifecycleMgrSuite{})
+
+// fakeWorkController records what it was asked to do
+type fakeWorkController struct {
+	cancels int
+}
+
+func (f *fakeWorkController) Cancel(mgr LifecycleMgr)                              { f.cancels++ }
+func (f *fakeWorkController) ReportProgressOrExit(mgr LifecycleMgr) (total uint32) { return 0 }
+
+type fakePausableWorkController struct {
+	fakeWorkController
+	pauses int
+}
+
+func (f *fakePausableWorkController) Pause(mgr LifecycleMgr) { f.pauses++ }
+
+func newLifecycleMgrForTest() *lifecycleMgr {
+	return &lifecycleMgr{msgQueue: make(chan outputMessage, 10), logSanitizer: NewAzCopyLogSanitizer()}
+}
+
+func (s *lifecycleMgrSuite) TestStopSignalPausesResumableWork(c *chk.C) {
+	lcm := newLifecycleMgrForTest()
+	jc := &fakePausableWorkController{}
+
+	// the first signal pauses the work, rather than cancelling it, and lets the process carry on until what is in flight is done
+	c.Assert(lcm.onStopSignal(jc, false), chk.Equals, false)
+	c.Assert(jc.pauses, chk.Equals, 1)
+	c.Assert(jc.cancels, chk.Equals, 0)
+
+	// a second one means exit straight away, without touching the work again
+	c.Assert(lcm.onStopSignal(jc, true), chk.Equals, true)
+	c.Assert(jc.pauses, chk.Equals, 1)
+	c.Assert(jc.cancels, chk.Equals, 0)
+}
+
+func (s *lifecycleMgrSuite) TestStopSignalCancelsOtherWork(c *chk.C) {
+	lcm := newLifecycleMgrForTest()
+	jc := &fakeWorkController{}
+
+	c.Assert(lcm.onStopSignal(jc, false), chk.Equals, false)
+	c.Assert(jc.cancels, chk.Equals, 1)
+	c.Assert(lcm.onStopSignal(jc, true), chk.Equals, true)
+	c.Assert(jc.cancels, chk.Equals, 1)
+}
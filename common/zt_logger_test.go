@@ -0,0 +1,155 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type jobLoggerSuite struct{}
+
+var _ = chk.Suite(&jobLoggerSuite{})
+
+func (s *jobLoggerSuite) newTestJobLogger(c *chk.C, level LogLevel, format LogFormat, maxFileSize int64) (*jobLogger, string) {
+	folder, err := ioutil.TempDir("", "azcopy-job-logger")
+	c.Assert(err, chk.IsNil)
+	jl := NewJobLogger(NewJobID(), level, format, NewAppLogger(pipeline.LogNone, folder), folder).(*jobLogger)
+	jl.maxFileSize = maxFileSize
+	jl.OpenLog()
+	return jl, folder
+}
+
+func (s *jobLoggerSuite) TestOnlyMessagesAtOrAboveLevelAreLogged(c *chk.C) {
+	jl, folder := s.newTestJobLogger(c, ELogLevel.Warning(), ELogFormat.Text(), 0)
+	defer os.RemoveAll(folder)
+
+	jl.Log(pipeline.LogError, "an error message")
+	jl.Log(pipeline.LogWarning, "a warning message")
+	jl.Log(pipeline.LogInfo, "an info message")
+	jl.Log(pipeline.LogDebug, "a debug message")
+	jl.CloseLog()
+
+	content, err := ioutil.ReadFile(filepath.Join(folder, jl.jobID.String()+".log"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(content), "an error message"), chk.Equals, true)
+	c.Assert(strings.Contains(string(content), "a warning message"), chk.Equals, true)
+	c.Assert(strings.Contains(string(content), "an info message"), chk.Equals, false)
+	c.Assert(strings.Contains(string(content), "a debug message"), chk.Equals, false)
+}
+
+func (s *jobLoggerSuite) TestNoFileWhenLevelIsNone(c *chk.C) {
+	jl, folder := s.newTestJobLogger(c, ELogLevel.None(), ELogFormat.Text(), 0)
+	defer os.RemoveAll(folder)
+
+	jl.Log(pipeline.LogError, "an error message")
+	jl.CloseLog()
+
+	_, err := os.Stat(filepath.Join(folder, jl.jobID.String()+".log"))
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *jobLoggerSuite) TestLogIsRotatedAtMaxSize(c *chk.C) {
+	const maxFileSize = 1024
+	jl, folder := s.newTestJobLogger(c, ELogLevel.Info(), ELogFormat.Text(), maxFileSize)
+	defer os.RemoveAll(folder)
+
+	// enough to fill many more files than are kept
+	message := strings.Repeat("x", 100)
+	for i := 0; i < 200; i++ {
+		jl.Log(pipeline.LogInfo, message)
+	}
+	jl.Log(pipeline.LogInfo, "the last message")
+	jl.CloseLog()
+
+	names, err := filepath.Glob(filepath.Join(folder, jl.jobID.String()+"*.log"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(names, chk.HasLen, maxRotatedLogFiles+1)
+	for _, name := range names {
+		info, err := os.Stat(name)
+		c.Assert(err, chk.IsNil)
+		c.Assert(info.Size() <= maxFileSize, chk.Equals, true)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(folder, jl.jobID.String()+".log"))
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(content), "the last message"), chk.Equals, true)
+}
+
+func (s *jobLoggerSuite) TestJsonEntriesAreWellFormed(c *chk.C) {
+	jl, folder := s.newTestJobLogger(c, ELogLevel.Warning(), ELogFormat.Json(), 0)
+	defer os.RemoveAll(folder)
+
+	jl.LogEvent(pipeline.LogError, ELogEvent.TransferFailed(), "https://account.blob.core.windows.net/container/file.txt", "UPLOADFAILED: it failed\n   Dst: somewhere\n")
+	jl.Log(pipeline.LogWarning, "a warning message")
+	jl.Log(pipeline.LogInfo, "an info message")
+	jl.CloseLog()
+
+	file, err := os.Open(filepath.Join(folder, jl.jobID.String()+".log"))
+	c.Assert(err, chk.IsNil)
+	defer file.Close()
+	var entries []jsonLogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry jsonLogEntry
+		c.Assert(json.Unmarshal(scanner.Bytes(), &entry), chk.IsNil)
+		c.Assert(entry.JobID, chk.Equals, jl.jobID.String())
+		entries = append(entries, entry)
+	}
+
+	// besides the entries at the start and end of the log, only those at or above the level are there, each on a line of its own
+	c.Assert(entries, chk.HasLen, 4)
+	c.Assert(entries[1].Level, chk.Equals, "ERR")
+	c.Assert(entries[1].EventType, chk.Equals, "TransferFailed")
+	c.Assert(entries[1].TransferPath, chk.Equals, "https://account.blob.core.windows.net/container/file.txt")
+	c.Assert(entries[1].Message, chk.Equals, "UPLOADFAILED: it failed\n   Dst: somewhere")
+	c.Assert(entries[2].Level, chk.Equals, "WARN")
+	c.Assert(entries[2].EventType, chk.Equals, "Message")
+	c.Assert(entries[2].Message, chk.Equals, "a warning message")
+	c.Assert(entries[3].Message, chk.Equals, "Closing Log")
+}
+
+func (s *jobLoggerSuite) TestFatalAndPanicEntriesAreWrittenStraightAway(c *chk.C) {
+	jl, folder := s.newTestJobLogger(c, ELogLevel.Info(), ELogFormat.Text(), 0)
+	defer os.RemoveAll(folder)
+	defer jl.CloseLog()
+	logPath := filepath.Join(folder, jl.jobID.String()+".log")
+
+	// other entries wait in the buffer, but not those logged when the app may be about to go down, which take what was before them along
+	jl.Log(pipeline.LogError, "an error message")
+	jl.Log(pipeline.LogFatal, "a fatal message")
+	content, err := ioutil.ReadFile(logPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(content), "an error message"), chk.Equals, true)
+	c.Assert(strings.Contains(string(content), "a fatal message"), chk.Equals, true)
+
+	jl.Panic(errors.New("a panic message"))
+	content, err = ioutil.ReadFile(logPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(strings.Contains(string(content), "a panic message"), chk.Equals, true)
+}
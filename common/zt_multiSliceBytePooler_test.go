@@ -22,6 +22,9 @@ package common
 
 import (
 	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	chk "gopkg.in/check.v1"
 )
@@ -65,3 +68,90 @@ func (s *multiSliceBytePoolerSuite) TestMultiSliceSlotInfo(c *chk.C) {
 	}
 
 }
+
+func (s *multiSliceBytePoolerSuite) TestLimitedPoolStaysUnderLimit(c *chk.C) {
+	const limit = 16 * 1024 * 1024
+	cacheLimiter := NewCacheLimiter(limit)
+	pool := NewLimitedMultiSizeSlicePool(8*1024*1024, cacheLimiter).(*multiSizeSlicePool)
+
+	// many transfers, with different chunk sizes, all buffering chunks at once
+	var peak int64
+	notePeak := func() {
+		for {
+			allocated, oldPeak := atomic.LoadInt64(&pool.atomicPooledBytes)+cacheLimiter.Used(), atomic.LoadInt64(&peak)
+			if allocated <= oldPeak || atomic.CompareAndSwapInt64(&peak, oldPeak, allocated) {
+				return
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	for transfer := 0; transfer < 50; transfer++ {
+		chunkSize := int64(1024*1024) << uint(transfer%4)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := 0; chunk < 10; chunk++ {
+				for !cacheLimiter.TryAdd(chunkSize, false) {
+					time.Sleep(time.Millisecond)
+				}
+				slice := pool.RentSlice(chunkSize)
+				notePeak()
+				time.Sleep(time.Millisecond)
+				cacheLimiter.Remove(chunkSize)
+				pool.ReturnSlice(slice)
+				notePeak()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.Assert(peak > 0, chk.Equals, true)
+	c.Assert(peak <= limit, chk.Equals, true, chk.Commentf("peak allocation was %d", peak))
+	c.Assert(atomic.LoadInt64(&pool.atomicPooledBytes) > 0, chk.Equals, true)
+}
+
+func (s *multiSliceBytePoolerSuite) TestLimitedPoolDiscardsIdleSlicesToMakeRoom(c *chk.C) {
+	const limit = 4 * 1024
+	cacheLimiter := NewCacheLimiter(limit)
+	pool := NewLimitedMultiSizeSlicePool(limit, cacheLimiter).(*multiSizeSlicePool)
+
+	// fill the pool with idle small slices
+	var small [][]byte
+	for i := 0; i < 4; i++ {
+		small = append(small, pool.RentSlice(1024))
+	}
+	for _, slice := range small {
+		pool.ReturnSlice(slice)
+	}
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(limit))
+
+	// a bigger slice, once it is in use, takes the place of some of them
+	c.Assert(cacheLimiter.TryAdd(2048, true), chk.Equals, true)
+	big := pool.RentSlice(2048)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(2048))
+	cacheLimiter.Remove(2048)
+	pool.ReturnSlice(big)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(limit))
+
+	// and while the whole limit is in use, returned slices aren't kept
+	c.Assert(cacheLimiter.TryAdd(limit, true), chk.Equals, true)
+	pool.ReturnSlice(pool.RentSlice(4096))
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(0))
+}
+
+func (s *multiSliceBytePoolerSuite) TestUnreturnedSlicesDontStopPooling(c *chk.C) {
+	const limit = 4 * 1024
+	pool := NewLimitedMultiSizeSlicePool(limit, NewCacheLimiter(limit)).(*multiSizeSlicePool)
+
+	// slices that are never returned, far more than the limit of them
+	for i := 0; i < 100; i++ {
+		_ = pool.RentSlice(1024)
+	}
+
+	// don't count against what may be pooled
+	slice := pool.RentSlice(1024)
+	pool.ReturnSlice(slice)
+	c.Assert(pool.atomicPooledBytes, chk.Equals, int64(1024))
+	reused := pool.RentSlice(1024)
+	c.Assert(&reused[0], chk.Equals, &slice[0])
+}
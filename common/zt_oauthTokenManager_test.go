@@ -0,0 +1,88 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type oauthTokenManagerTestSuite struct{}
+
+var _ = chk.Suite(&oauthTokenManagerTestSuite{})
+
+// newMockTokenEndpoint returns an Azure AD token endpoint that issues a new access token, valid for an hour, to the given
+// service principal on each request. It counts the requests.
+func newMockTokenEndpoint(c *chk.C, tenantID, applicationID, secret string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(requests, 1)
+		c.Check(r.URL.Path, chk.Equals, "/"+tenantID+"/oauth2/token")
+		c.Check(r.ParseForm(), chk.IsNil)
+		c.Check(r.PostForm.Get("grant_type"), chk.Equals, "client_credentials")
+		c.Check(r.PostForm.Get("resource"), chk.Equals, Resource)
+		if r.PostForm.Get("client_id") != applicationID || r.PostForm.Get("client_secret") != secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		expiresOn := time.Now().Add(time.Hour).Unix()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": "3600", "expires_on": "%d", "not_before": "%d", "resource": "%s"}`,
+			n, expiresOn, time.Now().Unix(), Resource)
+	}))
+}
+
+func (s *oauthTokenManagerTestSuite) TestSecretLoginAndRefresh(c *chk.C) {
+	var requests int32
+	server := newMockTokenEndpoint(c, "tenant", "app", "secret", &requests)
+	defer server.Close()
+
+	uotm := NewUserOAuthTokenManagerInstance(CredCacheOptions{DPAPIFilePath: c.MkDir(), KeyName: "test", ServiceName: "test", AccountName: "test"})
+	tokenInfo, err := uotm.SecretLogin("tenant", server.URL, "secret", "app", false)
+	c.Assert(err, chk.IsNil)
+	c.Assert(tokenInfo.AccessToken, chk.Equals, "token-1")
+	c.Assert(tokenInfo.ServicePrincipalName, chk.Equals, true)
+	c.Assert(tokenInfo.Expires().After(time.Now().Add(50*time.Minute)), chk.Equals, true)
+
+	// refreshing goes back to the endpoint with the same service principal
+	newToken, err := tokenInfo.Refresh(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(newToken.AccessToken, chk.Equals, "token-2")
+	c.Assert(atomic.LoadInt32(&requests), chk.Equals, int32(2))
+}
+
+func (s *oauthTokenManagerTestSuite) TestSecretLoginRejected(c *chk.C) {
+	var requests int32
+	server := newMockTokenEndpoint(c, "tenant", "app", "secret", &requests)
+	defer server.Close()
+
+	uotm := NewUserOAuthTokenManagerInstance(CredCacheOptions{DPAPIFilePath: c.MkDir(), KeyName: "test", ServiceName: "test", AccountName: "test"})
+	_, err := uotm.SecretLogin("tenant", server.URL, "wrong secret", "app", false)
+	c.Assert(err, chk.NotNil)
+	c.Assert(strings.Contains(err.Error(), "invalid_client"), chk.Equals, true)
+}
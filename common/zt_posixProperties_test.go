@@ -0,0 +1,110 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	chk "gopkg.in/check.v1"
+)
+
+type posixPropertiesSuite struct{}
+
+var _ = chk.Suite(&posixPropertiesSuite{})
+
+func (s *posixPropertiesSuite) TestMetadataRoundTrip(c *chk.C) {
+	p := POSIXProperties{Mode: 0750 | os.ModeSetgid | os.ModeSticky, UID: 1000, GID: 4294967294}
+	original := Metadata{"foo": "bar"}
+
+	m := p.AddToMetadata(original)
+	c.Assert(m[POSIXModeMeta], chk.Equals, "3750")
+	c.Assert(m[POSIXOwnerMeta], chk.Equals, "1000")
+	c.Assert(m[POSIXGroupMeta], chk.Equals, "4294967294")
+	c.Assert(m["foo"], chk.Equals, "bar")
+	c.Assert(original, chk.HasLen, 1) // the caller's map is left alone
+
+	restored, ok, err := POSIXPropertiesFromMetadata(m)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(restored, chk.Equals, p)
+}
+
+func (s *posixPropertiesSuite) TestMetadataWithoutProperties(c *chk.C) {
+	_, ok, err := POSIXPropertiesFromMetadata(Metadata{"foo": "bar"})
+	c.Assert(err, chk.IsNil)
+	c.Assert(ok, chk.Equals, false)
+}
+
+func (s *posixPropertiesSuite) TestInvalidMetadata(c *chk.C) {
+	valid := Metadata{POSIXModeMeta: "0644", POSIXOwnerMeta: "0", POSIXGroupMeta: "0"}
+	for key, bad := range map[string]string{
+		POSIXModeMeta:  "0789",
+		POSIXOwnerMeta: "-1",
+		POSIXGroupMeta: "",
+	} {
+		m := Metadata{}
+		for k, v := range valid {
+			m[k] = v
+		}
+		m[key] = bad
+		_, ok, err := POSIXPropertiesFromMetadata(m)
+		c.Assert(err, chk.NotNil, chk.Commentf("%s=%s", key, bad))
+		c.Assert(ok, chk.Equals, false)
+	}
+
+	_, _, err := POSIXPropertiesFromMetadata(Metadata{POSIXModeMeta: "17777", POSIXOwnerMeta: "0", POSIXGroupMeta: "0"})
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *posixPropertiesSuite) TestGetAndApply(c *chk.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("POSIX properties are not supported on Windows")
+	}
+	dir, err := ioutil.TempDir("", "posixprops")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	dest := filepath.Join(dir, "dest")
+	c.Assert(ioutil.WriteFile(source, []byte("a"), 0600), chk.IsNil)
+	c.Assert(ioutil.WriteFile(dest, []byte("a"), 0600), chk.IsNil)
+	c.Assert(os.Chmod(source, 0754), chk.IsNil) // Chmod, so that the umask doesn't interfere
+
+	info, err := os.Stat(source)
+	c.Assert(err, chk.IsNil)
+	p, ok := GetPOSIXProperties(info)
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(p.Mode, chk.Equals, os.FileMode(0754))
+	c.Assert(int(p.UID), chk.Equals, os.Getuid())
+
+	restored, _, err := POSIXPropertiesFromMetadata(p.AddToMetadata(nil))
+	c.Assert(err, chk.IsNil)
+	ownerSet, err := restored.Apply(dest)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ownerSet, chk.Equals, true) // we already own the file, so giving it to ourselves is always allowed
+
+	info, err = os.Stat(dest)
+	c.Assert(err, chk.IsNil)
+	c.Assert(info.Mode().Perm(), chk.Equals, os.FileMode(0754))
+}
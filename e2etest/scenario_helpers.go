@@ -125,6 +125,9 @@ func (s scenarioHelper) generateLocalFilesFromList(c asserter, dirPath string, f
 			//}
 			//file.verificationProperties.contentHeaders.contentMD5 = contentMD5[:]
 			c.AssertNoErr(err)
+			if lwt := file.creationProperties.lastWriteTime; lwt != nil {
+				c.AssertNoErr(os.Chtimes(filepath.Join(dirPath, file.name), *lwt, *lwt))
+			}
 			//TODO: nakulkar-msft you'll need to set up things like attributes, and other relevant things from
 			//   file.creationProperties here. (Use all the properties of file.creationProperties that are supported
 			//   by local files. E.g. not contentHeaders or metadata).
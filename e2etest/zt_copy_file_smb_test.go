@@ -1,8 +1,11 @@
 package e2etest
 
 import (
-	"github.com/Azure/azure-storage-azcopy/common"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
 )
 
 func TestSMB_FromShareSnapshot(t *testing.T) {
@@ -31,3 +34,31 @@ func TestSMB_FromShareSnapshot(t *testing.T) {
 			},
 		})
 }
+
+func TestSMB_UploadDirectoryTreeToShare(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("SMB properties can only be preserved in uploads from Windows")
+	}
+	lastWriteTime := time.Date(2019, 3, 1, 10, 20, 30, 0, time.UTC) // different from the time when the files are created, so it must have been preserved
+	RunScenarios(
+		t,
+		eOperation.Copy(),
+		eTestFromTo.Other(common.EFromTo.LocalFile()),
+		eValidate.Auto(),
+		params{
+			recursive:       true,
+			preserveSMBInfo: true,
+		},
+		nil,
+		testFiles{
+			defaultSize: "1K",
+			shouldTransfer: []interface{}{
+				folder(""),
+				f("filea", with{lastWriteTime: lastWriteTime}),
+				folder("fold1"),
+				f("fold1/fileb", with{lastWriteTime: lastWriteTime}),
+				folder("fold1/fold2"),
+				f("fold1/fold2/filec", with{lastWriteTime: lastWriteTime}),
+			},
+		})
+}
@@ -60,9 +60,7 @@ func main() {
 	if azcopyJobPlanFolder == "" {
 		azcopyJobPlanFolder = path.Join(azcopyAppPathFolder, "plans")
 	}
-	if err := os.Mkdir(azcopyJobPlanFolder, os.ModeDir|os.ModePerm); err != nil && !os.IsExist(err) {
-		common.PanicIfErr(err)
-	}
+	// (the folder is created and checked once the command line has been parsed, since --job-plan-location can override it)
 
 	// If insufficient arguments, show usage & terminate
 	if len(os.Args) == 1 {
@@ -30,6 +30,18 @@ type hasResponse interface {
 	Response() *http.Response
 }
 
+// RequestURL gets the URL of the failed request.
+// Returns "" if there isn't one
+func (errex ErrorEx) RequestURL() string {
+	if respErr, ok := errex.error.(hasResponse); ok {
+		r := respErr.Response()
+		if r != nil && r.Request != nil && r.Request.URL != nil {
+			return r.Request.URL.String()
+		}
+	}
+	return ""
+}
+
 // MSRequestID gets the request ID guid associated with the failed request.
 // Returns "" if there isn't one (either no request, or there is a request but it doesn't have the header)
 func (errex ErrorEx) MSRequestID() string {
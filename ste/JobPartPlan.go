@@ -1,11 +1,19 @@
 package ste
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
 	"unsafe"
 
 	"sync/atomic"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/common"
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -14,15 +22,30 @@ import (
 // dataSchemaVersion defines the data schema version of JobPart order files supported by
 // current version of azcopy
 // To be Incremented every time when we release azcopy with changed dataSchema
-const DataSchemaVersion common.Version = 16
+const DataSchemaVersion common.Version = 58
 
 const (
 	CustomHeaderMaxBytes = 256
-	MetadataMaxBytes     = 1000 // If > 65536, then jobPartPlanBlobData's MetadataLength field's type must change
 	BlobTagsMaxByte      = 4000
 	BlobTierMaxBytes     = 10
 )
 
+// chunkBitmapInlineWords is the number of 64-bit words of chunk completion state kept inside each JobPartPlanTransfer.
+// Transfers with more chunks than fit there get an overflow region in the plan file (see JobPartPlanTransfer.ChunkBitmapOffset)
+const chunkBitmapInlineWords = 4
+
+// ErrorMessageMaxBytes is the space reserved in the plan file for each transfer's last failure reason.
+// Longer messages are truncated, ending with an ellipsis.
+const ErrorMessageMaxBytes = 256
+
+// DestVersionIDMaxBytes is the space reserved in the plan file for the version ID of each blob that a transfer writes.
+// Version IDs are timestamps, so they are much shorter than this.
+const DestVersionIDMaxBytes = 64
+
+// errorMessageLock serializes writes of failure reasons, which may otherwise race when several chunks of a transfer fail at once.
+// Failures are rare enough that one lock for all transfers is sufficient.
+var errorMessageLock sync.Mutex
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 type JobPartPlanMMF common.MMF
@@ -34,6 +57,9 @@ func (mmf *JobPartPlanMMF) Plan() *JobPartPlanHeader {
 }
 func (mmf *JobPartPlanMMF) Unmap() { (*common.MMF)(mmf).Unmap() }
 
+// Flush makes sure that what the plan says is on disk, and not just in memory
+func (mmf *JobPartPlanMMF) Flush() error { return (*common.MMF)(mmf).Flush() }
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // JobPartPlanHeader represents the header of Job Part's memory-mapped file
@@ -54,27 +80,83 @@ type JobPartPlanHeader struct {
 	IsFinalPart            bool                        // True if this is the Job's last part; else false
 	ForceWrite             common.OverwriteOption      // True if the existing blobs needs to be overwritten.
 	ForceIfReadOnly        bool                        // Supplements ForceWrite with an additional setting for Azure Files. If true, the read-only attribute will be cleared before we overwrite
+	SourceNewerTolerance   time.Duration               // Supplements ForceWrite when it is IfSourceNewer. The source must be newer than the destination by more than this
 	AutoDecompress         bool                        // if true, source data with encodings that represent compression are automatically decompressed when downloading
 	Priority               common.JobPriority          // The Job Part's priority
-	TTLAfterCompletion     uint32                      // Time to live after completion is used to persists the file on disk of specified time after the completion of JobPartOrder
+	TTLAfterCompletion     uint32                      // Time to live after completion is used to persists the file on disk of specified time after the completion of JobPartOrder, in seconds (0 keeps it forever)
 	FromTo                 common.FromTo               // The location of the transfer's source & destination
 	Fpo                    common.FolderPropertyOption // option specifying how folders will be handled
 	CommandStringLength    uint32
 	NumTransfers           uint32              // The number of transfers in the Job part
 	LogLevel               common.LogLevel     // This Job Part's minimal log level
+	LogFormat              common.LogFormat    // How the entries of the job's log are written
 	DstBlobData            JobPartPlanDstBlob  // Additional data for blob destinations
 	DstLocalData           JobPartPlanDstLocal // Additional data for local destinations
 
 	PreserveSMBPermissions common.PreservePermissionsOption
 	PreserveSMBInfo        bool
+	// PreservePOSIXProperties represents whether uploads save the permissions and ownership of local files in blob metadata,
+	// and downloads restore them (see common.POSIXProperties).
+	PreservePOSIXProperties bool
+	// PreserveACLs represents whether copies between accounts with a hierarchical namespace give each destination
+	// the owner, group and POSIX access control list of its source
+	PreserveACLs bool
+	// PreserveImmutability represents whether copies between blob accounts give each destination blob
+	// the immutability policy and legal hold of its source
+	PreserveImmutability bool
 	// S2SGetPropertiesInBackend represents whether to enable get S3 objects' or Azure files' properties during s2s copy in backend.
 	S2SGetPropertiesInBackend bool
 	// S2SSourceChangeValidation represents whether user wants to check if source has changed after enumerating.
 	S2SSourceChangeValidation bool
+	// S2SRehydrateArchivedSource represents whether archived source blobs should be rehydrated and waited for, rather than failing their transfers.
+	S2SRehydrateArchivedSource bool
+	// S2SCopyMethod represents how the service is asked to copy blobs from blobs.
+	S2SCopyMethod common.S2SCopyMethod
+	// SkipIfHashMatches represents whether files whose hash matches the one stored on the destination blob are skipped, rather than sent again.
+	SkipIfHashMatches bool
 	// DestLengthValidation represents whether the user wants to check if the destination has a different content-length
 	DestLengthValidation bool
 	// S2SInvalidMetadataHandleOption represents how user wants to handle invalid metadata.
 	S2SInvalidMetadataHandleOption common.InvalidMetadataHandleOption
+	// DryRun represents whether the job was only planned; its transfers must never be scheduled.
+	DryRun bool
+	// DestinationCollisionOption represents how the files that flattening or renaming gave the same destination were named.
+	// The destinations of the transfers are already resolved; a resumed job keeps them, rather than resolving them again.
+	DestinationCollisionOption common.DestinationCollisionOption
+	// ChecksumAlgorithm represents the algorithm of the hashes that are put on upload, and checked on download.
+	// It also determines the size of each transfer's digest (see JobPartPlanTransfer.DigestOffset).
+	ChecksumAlgorithm common.HashAlgorithm
+	// Concurrency represents the maximum number of the job's transfers that may be in progress at once.
+	// Zero means no per-job limit; the engine's own parallelism applies. Only part 0's value is used.
+	Concurrency uint16
+	// MaxDuration represents how long each run of the job may last, before it stops starting transfers and is cancelled.
+	// Zero means no limit. Only part 0's value is used.
+	MaxDuration time.Duration
+	// MaxRetries represents how many times each failed transfer may be retried, over all resumes of the job, before it is left as failed.
+	// -1 means the engine default (TransferMaxRetries), so that zero can mean that failed transfers are never retried.
+	MaxRetries int32
+	// RetryChangedFiles represents whether a transfer whose source changed while it was being sent is started again straight away
+	// (up to MaxRetries times), rather than being left as failed until the job is resumed.
+	RetryChangedFiles bool
+	// MaxTotalBytes represents the most data that the job may transfer, over all its runs. No transfer is started that would take
+	// the job past it; instead the job is stopped. Zero means no limit. Only part 0's value is used.
+	MaxTotalBytes uint64
+	// BandwidthSchedule represents the windows (the first BandwidthScheduleLength of them) that vary the bandwidth cap by the time of day
+	// while the job runs. Outside them, the engine's own cap applies. Only part 0's value is used.
+	BandwidthSchedule       [common.MaxBandwidthScheduleWindows]common.BandwidthWindow
+	BandwidthScheduleLength uint8
+	// TotalBytes represents the sum of the sizes of the part's files, as they were enumerated. Byte-based progress is measured against it.
+	TotalBytes uint64
+	// CpkKeySha256 represents the base64 encoded SHA-256 of the customer-provided key with which blob data is encrypted (all zeros if there is none).
+	// The key itself is never stored; see CpkInfo.
+	CpkKeySha256 [cpkKeySha256Length]byte
+	// CredentialType represents how the job authenticates to Azure Storage. Tokens and keys are never stored, but knowing the type
+	// lets a resumed job authenticate the same way.
+	CredentialType common.CredentialType
+	// SourceSASRequired and DestinationSASRequired represent whether the source and the destination were each authenticated with
+	// their own SAS token. Like other credentials, the tokens are never stored, so each must be given again when the job is resumed.
+	SourceSASRequired      bool
+	DestinationSASRequired bool
 
 	// Any fields below this comment are NOT constants; they may change over as the job part is processed.
 	// Care must be taken to read/write to these fields in a thread-safe way!
@@ -86,6 +168,22 @@ type JobPartPlanHeader struct {
 
 	// For delete operation specify what to do with snapshots
 	DeleteSnapshotsOption common.DeleteSnapshotsOption
+
+	// atomicBytesTransferred represents the number of bytes that the attempts of this part's transfers had transferred when they ended.
+	// It accumulates across all runs of the job (i.e. it is not reset when the job is resumed).
+	// The attempts that haven't ended yet count in their transfers' atomicAttemptBytes instead, and BytesTransferred adds the two.
+	atomicBytesTransferred uint64
+
+	// atomicElapsedNanoseconds represents the time spent running the job, accumulated across all runs of the job.
+	// It is only maintained in part 0, since it applies to the job as a whole, and it is only updated when a run ends.
+	atomicElapsedNanoseconds int64
+
+	// atomicJobCompletionTime represents the time at which the job last finished (completed, failed or was cancelled),
+	// stored as nanoseconds, or 0 if it hasn't. Like the job status, it is only maintained in part 0.
+	atomicJobCompletionTime int64
+
+	// atomicCancelReason represents why the job was cancelled, if it was. Like the job status, it is only maintained in part 0.
+	atomicCancelReason common.JobCancelReason
 }
 
 // Status returns the job status stored in JobPartPlanHeader in thread-safe manner
@@ -93,11 +191,244 @@ func (jpph *JobPartPlanHeader) JobStatus() common.JobStatus {
 	return jpph.atomicJobStatus.AtomicLoad()
 }
 
+// cpkKeySha256Length is the length of a base64 encoded SHA-256
+const cpkKeySha256Length = 44
+
+// CpkInfo returns the customer-provided key with which the job part's blob data is encrypted, or nil if it has none.
+// The key is read from the environment, and it is an error if it is missing or isn't the key the job was created with.
+func (jpph *JobPartPlanHeader) CpkInfo() (*common.CpkInfo, error) {
+	keySha256 := string(bytes.TrimRight(jpph.CpkKeySha256[:], "\x00"))
+	if keySha256 == "" {
+		return nil, nil
+	}
+
+	cpkInfo, err := common.GetCpkInfoFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	if cpkInfo.EncryptionKeySha256 != keySha256 {
+		return nil, errors.New("the customer-provided key is not the one with which the job was created")
+	}
+	return &cpkInfo, nil
+}
+
 // SetJobStatus sets the job status in JobPartPlanHeader in thread-safe manner
 func (jpph *JobPartPlanHeader) SetJobStatus(newJobStatus common.JobStatus) {
 	jpph.atomicJobStatus.AtomicStore(newJobStatus)
 }
 
+// MaxTransferRetries returns how many times each of the part's failed transfers may be retried
+func (jpph *JobPartPlanHeader) MaxTransferRetries() uint32 {
+	if jpph.MaxRetries < 0 {
+		return TransferMaxRetries
+	}
+	return uint32(jpph.MaxRetries)
+}
+
+// RecordSourceChange records the size and last modified time that the source of the given transfer has now, after it changed
+// since it was enumerated. A retry of the transfer then sends the source as it is now, and checks that against it.
+func (jpph *JobPartPlanHeader) RecordSourceChange(transferIndex uint32, lastModifiedTime time.Time, size int64) {
+	jppt := jpph.Transfer(transferIndex)
+	// the part's total follows its files' sizes (adding a negative difference wraps around, which subtracts it)
+	atomic.AddUint64(&jpph.TotalBytes, uint64(size-jppt.SourceSize))
+	jppt.SourceSize = size
+	jppt.ModifiedTime = lastModifiedTime.UnixNano()
+}
+
+// BandwidthScheduleWindows returns the job's bandwidth schedule, or nil if it has none. Only meaningful in part 0.
+func (jpph *JobPartPlanHeader) BandwidthScheduleWindows() common.BandwidthSchedule {
+	if jpph.BandwidthScheduleLength == 0 {
+		return nil
+	}
+	return append(common.BandwidthSchedule(nil), jpph.BandwidthSchedule[:jpph.BandwidthScheduleLength]...)
+}
+
+// CancelReason returns why the job was cancelled, or None if it wasn't. Only meaningful in part 0.
+func (jpph *JobPartPlanHeader) CancelReason() common.JobCancelReason {
+	return jpph.atomicCancelReason.AtomicLoad()
+}
+
+// SetCancelReason records why the job is being cancelled, in thread-safe manner
+func (jpph *JobPartPlanHeader) SetCancelReason(reason common.JobCancelReason) {
+	jpph.atomicCancelReason.AtomicStore(reason)
+}
+
+// BytesTransferred returns the number of bytes of this job part that have been transferred, over all runs of the job
+func (jpph *JobPartPlanHeader) BytesTransferred() uint64 {
+	transferred := atomic.LoadUint64(&jpph.atomicBytesTransferred)
+	for t := uint32(0); t < jpph.NumTransfers; t++ {
+		transferred += jpph.Transfer(t).AttemptBytes()
+	}
+	return transferred
+}
+
+// AddBytesTransferred counts n more bytes as transferred, in thread-safe manner
+func (jpph *JobPartPlanHeader) AddBytesTransferred(n uint64) {
+	atomic.AddUint64(&jpph.atomicBytesTransferred, n)
+}
+
+// BytesCompleted returns how much of the part's TotalBytes is done: the whole size of the files that succeeded or were skipped,
+// plus what the attempts of the others have transferred so far. Unlike BytesTransferred, data that is sent again doesn't count twice.
+func (jpph *JobPartPlanHeader) BytesCompleted() uint64 {
+	completed := uint64(0)
+	for t := uint32(0); t < jpph.NumTransfers; t++ {
+		jppt := jpph.Transfer(t)
+		if jppt.EntityType != common.EEntityType.File() {
+			continue
+		}
+		if ts := jppt.TransferStatus(); ts == common.ETransferStatus.Success() || ts.WasSkipped() {
+			completed += uint64(jppt.SourceSize)
+		} else {
+			completed += jppt.AttemptBytes()
+		}
+	}
+	return completed
+}
+
+// EndTransferAttempt counts what the latest attempt of the transfer at transferIndex transferred as transferred by the part,
+// and starts the transfer's own count afresh, for its next attempt
+func (jpph *JobPartPlanHeader) EndTransferAttempt(transferIndex uint32) {
+	jpph.AddBytesTransferred(atomic.SwapUint64(&jpph.Transfer(transferIndex).atomicAttemptBytes, 0))
+}
+
+// DiscardTransferAttempt starts the count of the transfer at transferIndex afresh, for an attempt that is starting, without counting
+// what an earlier attempt that never ended (because it was paused, or the process stopped) transferred. What the destination kept
+// of that attempt is counted again as the new attempt skips it, and the rest is counted as it is sent again, so nothing counts twice.
+func (jpph *JobPartPlanHeader) DiscardTransferAttempt(transferIndex uint32) {
+	atomic.StoreUint64(&jpph.Transfer(transferIndex).atomicAttemptBytes, 0)
+}
+
+// ElapsedTime returns the time spent running the job, over all its completed runs. Only meaningful in part 0.
+func (jpph *JobPartPlanHeader) ElapsedTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&jpph.atomicElapsedNanoseconds))
+}
+
+// AddElapsedTime adds the duration of a run of the job, in thread-safe manner
+func (jpph *JobPartPlanHeader) AddElapsedTime(d time.Duration) {
+	atomic.AddInt64(&jpph.atomicElapsedNanoseconds, int64(d))
+}
+
+// JobCompletionTime returns the time at which the job last finished, or the zero time if it hasn't. Only meaningful in part 0.
+func (jpph *JobPartPlanHeader) JobCompletionTime() time.Time {
+	return nanosToTime(uint64(atomic.LoadInt64(&jpph.atomicJobCompletionTime)))
+}
+
+// SetJobCompletionTime records t as the time at which the job finished, in thread-safe manner.
+// The zero time records that the job hasn't finished, e.g. because it has been resumed.
+func (jpph *JobPartPlanHeader) SetJobCompletionTime(t time.Time) {
+	nanos := int64(0)
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	atomic.StoreInt64(&jpph.atomicJobCompletionTime, nanos)
+}
+
+// TransferDigest returns the digest of the transfer at the given index: the hash that AzCopy computed over its data (all zeros if none was computed).
+// The returned slice refers to the plan file itself. It is only written by the transfer's epilogue, once all the data has been hashed,
+// so it is not accessed atomically.
+func (jpph *JobPartPlanHeader) TransferDigest(transferIndex uint32) []byte {
+	jppt := jpph.Transfer(transferIndex)
+	if jppt.DigestLength == 0 {
+		return nil
+	}
+	digest := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&digest))
+	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jppt.DigestOffset) // Address of Job Part Plan + this transfer's digest offset
+	sh.Len = int(jppt.DigestLength)
+	sh.Cap = sh.Len
+	return digest
+}
+
+// errorMessageBytes returns the region of the plan file that is reserved for the failure reason of the transfer at transferIndex
+func (jpph *JobPartPlanHeader) errorMessageBytes(transferIndex uint32) []byte {
+	jppt := jpph.Transfer(transferIndex)
+	if jppt.ErrorMessageOffset == 0 {
+		return nil
+	}
+	region := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&region))
+	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jppt.ErrorMessageOffset) // Address of Job Part Plan + this transfer's error message offset
+	sh.Len = ErrorMessageMaxBytes
+	sh.Cap = sh.Len
+	return region
+}
+
+// ErrorMessage returns the last failure reason recorded for the transfer at transferIndex, or "" if there is none
+func (jpph *JobPartPlanHeader) ErrorMessage(transferIndex uint32) string {
+	errorMessageLock.Lock()
+	defer errorMessageLock.Unlock()
+	length := atomic.LoadUint32(&jpph.Transfer(transferIndex).atomicErrorMessageLength)
+	return string(jpph.errorMessageBytes(transferIndex)[:length])
+}
+
+// SetErrorMessage records msg as the last failure reason of the transfer at transferIndex, replacing any earlier one.
+// An empty msg clears the reason.
+func (jpph *JobPartPlanHeader) SetErrorMessage(transferIndex uint32, msg string) {
+	region := jpph.errorMessageBytes(transferIndex)
+	if region == nil {
+		return
+	}
+	msg = truncateErrorMessage(msg, ErrorMessageMaxBytes)
+
+	errorMessageLock.Lock()
+	defer errorMessageLock.Unlock()
+	copy(region, msg)
+	atomic.StoreUint32(&jpph.Transfer(transferIndex).atomicErrorMessageLength, uint32(len(msg)))
+}
+
+// destVersionIDBytes returns the region of the plan file that is reserved for the destination version ID of the transfer at transferIndex
+func (jpph *JobPartPlanHeader) destVersionIDBytes(transferIndex uint32) []byte {
+	jppt := jpph.Transfer(transferIndex)
+	if jppt.DestVersionIDOffset == 0 {
+		return nil
+	}
+	region := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&region))
+	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jppt.DestVersionIDOffset) // Address of Job Part Plan + this transfer's version ID offset
+	sh.Len = DestVersionIDMaxBytes
+	sh.Cap = sh.Len
+	return region
+}
+
+// DestVersionID returns the version ID of the blob that the transfer at transferIndex created, or "" if it is not known
+// (e.g. because versioning is not enabled on the destination account)
+func (jpph *JobPartPlanHeader) DestVersionID(transferIndex uint32) string {
+	region := jpph.destVersionIDBytes(transferIndex)
+	length := atomic.LoadUint32(&jpph.Transfer(transferIndex).atomicDestVersionIDLength)
+	if region == nil || length > DestVersionIDMaxBytes {
+		return ""
+	}
+	return string(region[:length])
+}
+
+// SetDestVersionID records the version ID of the blob that the transfer at transferIndex created. An empty versionID clears it.
+// Since a version ID is useless if it is cut short, one that doesn't fit in the reserved space is not recorded at all.
+// It is written once, when the transfer completes, and the length is stored last, so that readers never see a partly written ID.
+func (jpph *JobPartPlanHeader) SetDestVersionID(transferIndex uint32, versionID string) {
+	region := jpph.destVersionIDBytes(transferIndex)
+	if region == nil || len(versionID) > len(region) {
+		return
+	}
+	jppt := jpph.Transfer(transferIndex)
+	atomic.StoreUint32(&jppt.atomicDestVersionIDLength, 0)
+	copy(region, versionID)
+	atomic.StoreUint32(&jppt.atomicDestVersionIDLength, uint32(len(versionID)))
+}
+
+// truncateErrorMessage shortens msg to at most maxBytes bytes, ending it with an ellipsis if anything was cut.
+// It never cuts a multi-byte character in half.
+func truncateErrorMessage(msg string, maxBytes int) string {
+	const ellipsis = "..."
+	if len(msg) <= maxBytes {
+		return msg
+	}
+	end := maxBytes - len(ellipsis)
+	for end > 0 && !utf8.RuneStart(msg[end]) {
+		end--
+	}
+	return msg[:end] + ellipsis
+}
+
 // Transfer api gives memory map JobPartPlanTransfer header for given index
 func (jpph *JobPartPlanHeader) Transfer(transferIndex uint32) *JobPartPlanTransfer {
 	// get memory map JobPartPlan Header Pointer
@@ -105,9 +436,10 @@ func (jpph *JobPartPlanHeader) Transfer(transferIndex uint32) *JobPartPlanTransf
 		panic(errors.New("requesting a transfer index greater than what is available"))
 	}
 
-	// (Job Part Plan's file address) + (header size) --> beginning of transfers in file
+	// (Job Part Plan's file address) + (header size) + (command string, metadata and content type override lengths) --> beginning of transfers in file
 	// Add (transfer size) * (transfer index)
-	return (*JobPartPlanTransfer)(unsafe.Pointer((uintptr(unsafe.Pointer(jpph)) + unsafe.Sizeof(*jpph) + uintptr(jpph.CommandStringLength)) + (unsafe.Sizeof(JobPartPlanTransfer{}) * uintptr(transferIndex))))
+	return (*JobPartPlanTransfer)(unsafe.Pointer((uintptr(unsafe.Pointer(jpph)) + unsafe.Sizeof(*jpph) + uintptr(jpph.CommandStringLength) + uintptr(jpph.DstBlobData.MetadataLength) +
+		uintptr(jpph.DstBlobData.ContentTypeOverridesLength)) + (unsafe.Sizeof(JobPartPlanTransfer{}) * uintptr(transferIndex))))
 }
 
 // CommandString returns the command string given by user when job was created
@@ -150,6 +482,34 @@ func (jpph *JobPartPlanHeader) TransferSrcDstStrings(transferIndex uint32) (sour
 		isFolder
 }
 
+// Metadata returns the metadata string, given by the user, to apply to destination blobs
+func (jpph *JobPartPlanHeader) Metadata() string {
+	metadataSlice := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&metadataSlice))
+	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jpph.DstBlobData.MetadataOffset) // Address of Job Part Plan + metadata offset
+	sh.Len = int(jpph.DstBlobData.MetadataLength)
+	sh.Cap = sh.Len
+	return string(metadataSlice)
+}
+
+// ContentTypeOverrides returns the content types, given by the user, to use for files with the given (lower case) extensions on upload
+func (jpph *JobPartPlanHeader) ContentTypeOverrides() map[string]string {
+	if jpph.DstBlobData.ContentTypeOverridesLength == 0 {
+		return nil
+	}
+	overridesSlice := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&overridesSlice))
+	sh.Data = uintptr(unsafe.Pointer(jpph)) + uintptr(jpph.DstBlobData.ContentTypeOverridesOffset) // Address of Job Part Plan + overrides offset
+	sh.Len = int(jpph.DstBlobData.ContentTypeOverridesLength)
+	sh.Cap = sh.Len
+
+	var overrides map[string]string
+	if err := json.Unmarshal(overridesSlice, &overrides); err != nil {
+		panic(fmt.Errorf("the content type overrides in the job plan file could not be read: %v", err))
+	}
+	return overrides
+}
+
 func (jpph *JobPartPlanHeader) getString(offset int64, length int16) string {
 	tempSlice := []byte{}
 	sh := (*reflect.SliceHeader)(unsafe.Pointer(&tempSlice))
@@ -163,7 +523,7 @@ func (jpph *JobPartPlanHeader) getString(offset int64, length int16) string {
 // TransferSrcPropertiesAndMetadata returns the SrcHTTPHeaders, properties and metadata for a transfer at given transferIndex in JobPartOrder
 // TODO: Refactor return type to an object
 func (jpph *JobPartPlanHeader) TransferSrcPropertiesAndMetadata(transferIndex uint32) (h common.ResourceHTTPHeaders, metadata common.Metadata, blobType azblob.BlobType, blobTier azblob.AccessTierType,
-	s2sGetPropertiesInBackend bool, DestLengthValidation bool, s2sSourceChangeValidation bool, s2sInvalidMetadataHandleOption common.InvalidMetadataHandleOption, entityType common.EntityType, blobVersionID string, blobTags common.BlobTags) {
+	s2sGetPropertiesInBackend bool, DestLengthValidation bool, s2sSourceChangeValidation bool, s2sInvalidMetadataHandleOption common.InvalidMetadataHandleOption, entityType common.EntityType, blobVersionID string, blobTags common.BlobTags, blobSnapshotID string) {
 	var err error
 	t := jpph.Transfer(transferIndex)
 
@@ -225,9 +585,113 @@ func (jpph *JobPartPlanHeader) TransferSrcPropertiesAndMetadata(transferIndex ui
 		blobTags = common.ToCommonBlobTagsMap(blobTagsString)
 		offset += int64(t.SrcBlobTagsLength)
 	}
+	if t.SrcBlobSnapshotIDLength != 0 {
+		blobSnapshotID = jpph.getString(offset, t.SrcBlobSnapshotIDLength)
+		offset += int64(t.SrcBlobSnapshotIDLength)
+	}
+	return
+}
+
+// TransferDstAccessConditions returns the ETags that writing the destination of the transfer at transferIndex is conditional on
+// (empty if there is no such condition)
+func (jpph *JobPartPlanHeader) TransferDstAccessConditions(transferIndex uint32) (ifMatch string, ifNoneMatch string) {
+	t := jpph.Transfer(transferIndex)
+
+	offset := t.SrcOffset + int64(t.SrcLength) + int64(t.DstLength) + int64(t.SrcContentTypeLength) +
+		int64(t.SrcContentEncodingLength) + int64(t.SrcContentLanguageLength) + int64(t.SrcContentDispositionLength) +
+		int64(t.SrcCacheControlLength) + int64(t.SrcContentMD5Length) + int64(t.SrcMetadataLength) +
+		int64(t.SrcBlobTypeLength) + int64(t.SrcBlobTierLength) + int64(t.SrcBlobVersionIDLength) + int64(t.SrcBlobTagsLength) + int64(t.SrcBlobSnapshotIDLength)
+
+	if t.DstIfMatchLength != 0 {
+		ifMatch = jpph.getString(offset, t.DstIfMatchLength)
+		offset += int64(t.DstIfMatchLength)
+	}
+	if t.DstIfNoneMatchLength != 0 {
+		ifNoneMatch = jpph.getString(offset, t.DstIfNoneMatchLength)
+	}
 	return
 }
 
+// chunkBitmapWord returns the word of the transfer's chunk bitmap that holds the bit for the given chunk, along with that bit's mask.
+// It returns nil if the plan file has no room to track the given chunk.
+func (jpph *JobPartPlanHeader) chunkBitmapWord(transferIndex uint32, chunkIndex int32) (*uint64, uint64) {
+	jppt := jpph.Transfer(transferIndex)
+	if chunkIndex < 0 {
+		return nil, 0
+	}
+	wordIndex := uint32(chunkIndex) / 64
+	mask := uint64(1) << (uint32(chunkIndex) % 64)
+	if wordIndex < chunkBitmapInlineWords {
+		return &jppt.atomicChunkBitmap[wordIndex], mask
+	}
+
+	wordIndex -= chunkBitmapInlineWords
+	if wordIndex >= jppt.ChunkBitmapOverflowWords {
+		return nil, 0
+	}
+	// Address of Job Part Plan + this transfer's overflow bitmap offset + offset of the word within it
+	return (*uint64)(unsafe.Pointer(uintptr(unsafe.Pointer(jpph)) + uintptr(jppt.ChunkBitmapOffset) + uintptr(wordIndex)*unsafe.Sizeof(uint64(0)))), mask
+}
+
+// IsChunkDone returns whether the given chunk of the transfer at transferIndex has been recorded as staged
+func (jpph *JobPartPlanHeader) IsChunkDone(transferIndex uint32, chunkIndex int32) bool {
+	word, mask := jpph.chunkBitmapWord(transferIndex, chunkIndex)
+	return word != nil && atomic.LoadUint64(word)&mask != 0
+}
+
+// SetChunkDone records that the given chunk of the transfer at transferIndex has been staged.
+// Chunks that the plan file has no room for are silently not recorded, so they will simply be sent again on resume.
+func (jpph *JobPartPlanHeader) SetChunkDone(transferIndex uint32, chunkIndex int32) {
+	word, mask := jpph.chunkBitmapWord(transferIndex, chunkIndex)
+	if word == nil {
+		return
+	}
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return
+		}
+	}
+}
+
+// ChunkBlockSize returns the block size with which the transfer's chunk bitmap was recorded
+func (jpph *JobPartPlanHeader) ChunkBlockSize(transferIndex uint32) int64 {
+	return atomic.LoadInt64(&jpph.Transfer(transferIndex).atomicChunkBlockSize)
+}
+
+// ResetChunkBitmap discards all chunks recorded for the transfer at transferIndex,
+// and associates the (now empty) bitmap with the given block size
+func (jpph *JobPartPlanHeader) ResetChunkBitmap(transferIndex uint32, blockSize int64) {
+	jppt := jpph.Transfer(transferIndex)
+	for w := range jppt.atomicChunkBitmap {
+		atomic.StoreUint64(&jppt.atomicChunkBitmap[w], 0)
+	}
+	for w := uint32(0); w < jppt.ChunkBitmapOverflowWords; w++ {
+		word, _ := jpph.chunkBitmapWord(transferIndex, int32((chunkBitmapInlineWords+w)*64))
+		atomic.StoreUint64(word, 0)
+	}
+	atomic.StoreInt64(&jppt.atomicChunkBlockSize, blockSize)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// JobPartPlanSummary is a read-only snapshot of the main JobPartPlanHeader fields, for use outside the ste package
+type JobPartPlanSummary struct {
+	Version      common.Version
+	StartTime    int64
+	PartNum      common.PartNumber
+	IsFinalPart  bool
+	NumTransfers uint32
+	Priority     common.JobPriority
+	JobStatus    common.JobStatus
+	// how long the job's plan files are kept once it has finished, and when that was (both only meaningful in part 0)
+	TTLAfterCompletion time.Duration
+	CompletionTime     time.Time
+	// how many bytes this part has transferred, and how long the job has run, over all its runs (the latter only meaningful in part 0)
+	BytesTransferred uint64
+	ElapsedTime      time.Duration
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // JobPartPlanDstBlob holds additional settings required when the destination is a blob
@@ -275,14 +739,50 @@ type JobPartPlanDstBlob struct {
 	// Controls uploading of MD5 hashes
 	PutMd5 bool
 
-	MetadataLength uint16
-	Metadata       [MetadataMaxBytes]byte
+	// Specifies where the metadata to apply to the blob is stored in the JobPartOrder file, and how long it is.
+	// It is stored after the command string (rather than inline here) since blob metadata may be up to 8KB.
+	MetadataOffset int64
+	MetadataLength uint32
+
+	// Specifies where the content types to use for given file extensions (see ContentTypeOverrides) are stored in the JobPartOrder file,
+	// and how long they are. Since there may be any number of them, they are stored, as JSON, straight after the metadata.
+	ContentTypeOverridesOffset int64
+	ContentTypeOverridesLength uint32
 
 	BlobTagsLength uint16
 	BlobTags       [BlobTagsMaxByte]byte
 
 	// Specifies the maximum size of block which determines the number of chunks and chunk size of a transfer
 	BlockSize int64
+
+	// Controls compressing uploads with gzip as they are sent, so that the block blobs are stored compressed, with a content encoding of gzip.
+	// Only files of at least GzipMinSize bytes are compressed, and, if any extensions are given, only the files with one of them.
+	GzipUpload           bool
+	GzipMinSize          int64
+	GzipExtensionsLength uint16
+	GzipExtensions       [CustomHeaderMaxBytes]byte // lower case, each with its leading dot, separated by semicolons
+
+	// Specifies the immutability policy to give every blob once it has been written, if ImmutabilityPolicyExpiresOn (stored as nanoseconds) is not 0.
+	// It takes the place of any policy that is preserved from the source.
+	ImmutabilityPolicyExpiresOn int64
+	ImmutabilityPolicyMode      common.ImmutabilityPolicyMode
+}
+
+// shouldGzip says whether a file of the given size and path is to be compressed with gzip as it is uploaded
+func (d *JobPartPlanDstBlob) shouldGzip(size int64, path string) bool {
+	if !d.GzipUpload || size < d.GzipMinSize {
+		return false
+	}
+	if d.GzipExtensionsLength == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range strings.Split(string(d.GzipExtensions[:d.GzipExtensionsLength]), ";") {
+		if ext == e {
+			return true
+		}
+	}
+	return false
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -319,7 +819,8 @@ type JobPartPlanTransfer struct {
 	ModifiedTime int64
 	// SourceSize represents the actual size of the source on disk
 	SourceSize int64
-	// CompletionTime represents the time at which transfer was completed
+	// CompletionTime represents the time at which transfer was completed, stored as nanoseconds (0 if it has not completed).
+	// CompletionTime should not be directly accessed anywhere except by GetCompletionTime and SetCompletionTime
 	CompletionTime uint64
 
 	// For S2S copy, per Transfer source's properties
@@ -335,6 +836,35 @@ type JobPartPlanTransfer struct {
 	SrcBlobTierLength           int16
 	SrcBlobVersionIDLength      int16
 	SrcBlobTagsLength           int16
+	SrcBlobSnapshotIDLength     int16
+
+	// DstIfMatchLength and DstIfNoneMatchLength represent the lengths of the ETags that writing the destination is conditional on.
+	// The ETags follow the source's properties.
+	DstIfMatchLength     int16
+	DstIfNoneMatchLength int16
+
+	// SrcImmutabilityPolicyExpiresOn (stored as nanoseconds, 0 if there is no policy) and SrcImmutabilityPolicyMode are the immutability policy
+	// of the source blob, and SrcLegalHold its legal hold. They are only recorded when the job preserves them
+	SrcImmutabilityPolicyExpiresOn int64
+	SrcImmutabilityPolicyMode      common.ImmutabilityPolicyMode
+	SrcLegalHold                   bool
+
+	// ChunkBitmapOffset represents the start offset of this transfer's overflow chunk bitmap in the JobPartOrder file
+	// ChunkBitmapOverflowWords represents the number of 64-bit words in that overflow region (0 means there is none)
+	ChunkBitmapOffset        int64
+	ChunkBitmapOverflowWords uint32
+
+	// DigestOffset represents the start offset of this transfer's digest in the JobPartOrder file: the hash that AzCopy computes over its data.
+	// DigestLength represents the size of the digest, as given by the job part's ChecksumAlgorithm (0 for folders, which have no data)
+	DigestOffset int64
+	DigestLength uint8
+
+	// ErrorMessageOffset represents the start offset, in the JobPartOrder file, of the ErrorMessageMaxBytes reserved for this transfer's last failure reason
+	ErrorMessageOffset int64
+
+	// DestVersionIDOffset represents the start offset, in the JobPartOrder file, of the DestVersionIDMaxBytes reserved for the version ID
+	// of the blob that the transfer wrote. It is 0 if no space is reserved, because the destination isn't a blob
+	DestVersionIDOffset int64
 
 	// Any fields below this comment are NOT constants; they may change over as the transfer is processed.
 	// Care must be taken to read/write to these fields in a thread-safe way!
@@ -347,6 +877,50 @@ type JobPartPlanTransfer struct {
 	// atomicErrorCode has a default value (0) which means either there was no error or transfer failed because some non storageError.
 	// atomicErrorCode should not be directly accessed anywhere except by transferStatus and setTransferStatus
 	atomicErrorCode int32
+
+	// atomicChunkBlockSize represents the block size that was in use when chunks were recorded in the chunk bitmap.
+	// If the block size of a later run differs, the recorded chunks no longer line up and must be discarded.
+	atomicChunkBlockSize int64
+
+	// atomicChunkBitmap holds one bit per chunk, set once that chunk has been staged at the destination.
+	// Chunks beyond the inline words are tracked in the overflow region. Access it only through the chunk bitmap helpers.
+	atomicChunkBitmap [chunkBitmapInlineWords]uint64
+
+	// atomicStartTime represents the time at which the transfer was first dispatched, stored as nanoseconds.
+	// It is 0 if the transfer never started (which includes all transfers in plan files from older versions).
+	// Once set, it is kept across resumes, so that it always reflects the first run of the transfer.
+	atomicStartTime uint64
+
+	// atomicAttemptBytes represents how much of the transfer's data has reached the destination in its current attempt, as chunks complete.
+	// It is kept when the job is paused, so that the part's completed bytes still include it. When the attempt ends, it is moved into
+	// the part's atomicBytesTransferred. When the transfer starts again without its attempt having ended (e.g. on resume after a pause),
+	// it is discarded instead, since the new attempt counts what the destination kept again as it skips it.
+	// It should not be directly accessed anywhere except by AttemptBytes, AddAttemptBytes, EndTransferAttempt and DiscardTransferAttempt
+	atomicAttemptBytes uint64
+
+	// atomicAppendStart represents the length, plus one, that the destination append blob had before the transfer first appended to it,
+	// and atomicAppendStartBlocks the number of blocks it had then. atomicAppendStart is 0 until they are recorded.
+	// They should not be directly accessed anywhere except by AppendStart and SetAppendStart
+	atomicAppendStart       int64
+	atomicAppendStartBlocks uint32
+
+	// atomicDigestSourceModifiedTime (stored as nanoseconds) and atomicDigestSourceSize represent the last modified time and the size
+	// that the source had when the digest at DigestOffset was computed, since the digest is only good for the source as it was then.
+	// They should not be directly accessed anywhere except by DigestSource and SetDigestSource
+	atomicDigestSourceModifiedTime int64
+	atomicDigestSourceSize         int64
+
+	// atomicRetryCount represents the number of times this transfer has been retried after failing.
+	// It is 32-bit (rather than 16-bit, which would be plenty) because it must be accessed atomically.
+	atomicRetryCount uint32
+
+	// atomicErrorMessageLength represents the length of the failure reason stored at ErrorMessageOffset (0 if there is none).
+	// It should not be directly accessed anywhere except by ErrorMessage and SetErrorMessage
+	atomicErrorMessageLength uint32
+
+	// atomicDestVersionIDLength represents the length of the version ID stored at DestVersionIDOffset (0 if there is none).
+	// It should not be directly accessed anywhere except by DestVersionID and SetDestVersionID
+	atomicDestVersionIDLength uint32
 }
 
 // TransferStatus returns the transfer's status
@@ -371,6 +945,103 @@ func (jppt *JobPartPlanTransfer) SetTransferStatus(status common.TransferStatus,
 	}
 }
 
+// swapTransferStatus changes the status of the transfer to "to" only if it is currently "from", and returns whether it did
+func (jppt *JobPartPlanTransfer) swapTransferStatus(from, to common.TransferStatus) bool {
+	return atomic.CompareAndSwapInt32((*int32)(&jppt.atomicTransferStatus), int32(from), int32(to))
+}
+
+// StartTime returns the time at which the transfer was first dispatched, or the zero time if it never started
+func (jppt *JobPartPlanTransfer) StartTime() time.Time {
+	return nanosToTime(atomic.LoadUint64(&jppt.atomicStartTime))
+}
+
+// AttemptBytes returns how much of the transfer's data has reached the destination in its current attempt
+func (jppt *JobPartPlanTransfer) AttemptBytes() uint64 {
+	return atomic.LoadUint64(&jppt.atomicAttemptBytes)
+}
+
+// AddAttemptBytes counts n more bytes of the transfer's data as having reached the destination in its current attempt
+func (jppt *JobPartPlanTransfer) AddAttemptBytes(n uint64) {
+	atomic.AddUint64(&jppt.atomicAttemptBytes, n)
+}
+
+// SetStartTimeIfNotStarted records t as the start time of the transfer, unless it already has one (from an earlier run)
+func (jppt *JobPartPlanTransfer) SetStartTimeIfNotStarted(t time.Time) {
+	atomic.CompareAndSwapUint64(&jppt.atomicStartTime, 0, uint64(t.UnixNano()))
+}
+
+// GetCompletionTime returns the time at which the transfer last completed, or the zero time if it never completed
+func (jppt *JobPartPlanTransfer) GetCompletionTime() time.Time {
+	return nanosToTime(atomic.LoadUint64(&jppt.CompletionTime))
+}
+
+// SetCompletionTime records t as the time at which the transfer completed
+func (jppt *JobPartPlanTransfer) SetCompletionTime(t time.Time) {
+	atomic.StoreUint64(&jppt.CompletionTime, uint64(t.UnixNano()))
+}
+
+// Duration returns how long the transfer took, from its first start to its (latest) completion.
+// It returns false if that is not known, e.g. because the transfer has not completed yet.
+func (jppt *JobPartPlanTransfer) Duration() (time.Duration, bool) {
+	start, completion := atomic.LoadUint64(&jppt.atomicStartTime), atomic.LoadUint64(&jppt.CompletionTime)
+	if start == 0 || completion < start {
+		return 0, false
+	}
+	return time.Duration(completion - start), true
+}
+
+func nanosToTime(nanos uint64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+// RetryCount returns the number of times the transfer has been retried after failing
+func (jppt *JobPartPlanTransfer) RetryCount() uint32 {
+	return atomic.LoadUint32(&jppt.atomicRetryCount)
+}
+
+// TryStartRetry counts a new retry of the (failed) transfer, and returns true, unless
+// the transfer has already been retried maxRetries times. In that case it returns false,
+// and the transfer should be left as failed.
+func (jppt *JobPartPlanTransfer) TryStartRetry(maxRetries uint32) bool {
+	return common.AtomicMorphUint32(&jppt.atomicRetryCount,
+		func(startVal uint32) (val uint32, morphResult interface{}) {
+			if startVal >= maxRetries {
+				return startVal, false
+			}
+			return startVal + 1, true
+		}).(bool)
+}
+
+// AppendStart returns the length and the number of blocks that the destination append blob had before the transfer first appended to it,
+// if SetAppendStart has recorded them
+func (jppt *JobPartPlanTransfer) AppendStart() (length int64, blocks uint32, ok bool) {
+	start := atomic.LoadInt64(&jppt.atomicAppendStart)
+	if start == 0 {
+		return 0, 0, false
+	}
+	return start - 1, atomic.LoadUint32(&jppt.atomicAppendStartBlocks), true
+}
+
+// SetAppendStart records the length and the number of blocks that the destination append blob had before the transfer appended to it
+func (jppt *JobPartPlanTransfer) SetAppendStart(length int64, blocks uint32) {
+	atomic.StoreUint32(&jppt.atomicAppendStartBlocks, blocks)
+	atomic.StoreInt64(&jppt.atomicAppendStart, length+1) // last, since it is what says they are recorded
+}
+
+// DigestSource returns the last modified time and the size that the source had when its digest was recorded
+func (jppt *JobPartPlanTransfer) DigestSource() (lastModifiedTime time.Time, size int64) {
+	return time.Unix(0, atomic.LoadInt64(&jppt.atomicDigestSourceModifiedTime)), atomic.LoadInt64(&jppt.atomicDigestSourceSize)
+}
+
+// SetDigestSource records the last modified time and the size of the source that the digest being recorded was computed from
+func (jppt *JobPartPlanTransfer) SetDigestSource(lastModifiedTime time.Time, size int64) {
+	atomic.StoreInt64(&jppt.atomicDigestSourceModifiedTime, lastModifiedTime.UnixNano())
+	atomic.StoreInt64(&jppt.atomicDigestSourceSize, size)
+}
+
 // ErrorCode returns the transfer's errorCode.
 func (jppt *JobPartPlanTransfer) ErrorCode() int32 {
 	return atomic.LoadInt32(&jppt.atomicErrorCode)
@@ -0,0 +1,234 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// JobPlanExportSchemaVersion is the version of the layout of JobPlanExport.
+// Unlike DataSchemaVersion, it only changes when fields are removed from the export, or change their meaning.
+const JobPlanExportSchemaVersion = 1
+
+// JobPlanExport is a portable, human-readable copy of all the plan files of a job, e.g. to attach to a support ticket.
+// Anything that may hold a credential is either left out (the extra query parameters of the roots, the metadata)
+// or has the signatures of its URLs redacted (the command string, the paths, the failure reasons).
+type JobPlanExport struct {
+	SchemaVersion int
+	JobID         common.JobID
+	ExportTime    time.Time
+	Parts         []JobPartPlanExport
+	// TransfersByStatus counts the transfers of all parts, by the name of their status
+	TransfersByStatus map[string]uint32
+}
+
+// JobPartPlanExport is the header of one plan file, and all its transfers
+type JobPartPlanExport struct {
+	PartNum           common.PartNumber
+	IsFinalPart       bool
+	DataSchemaVersion common.Version
+	StartTime         time.Time
+	JobStatus         common.JobStatus // only meaningful in part 0, as are CancelReason, ElapsedSeconds and CompletionTime
+	CancelReason      common.JobCancelReason
+	CommandString     string
+	FromTo            string
+	SourceRoot        string
+	DestinationRoot   string
+	Overwrite         string
+	CollisionPolicy   string // how the files that flattening or renaming gave the same destination were named
+	BlobType          string
+	LogLevel          string
+	LogFormat         string
+	NumTransfers      uint32
+	TotalBytes        uint64
+	BytesCompleted    uint64
+	BytesTransferred  uint64
+	ElapsedSeconds    float64
+	CompletionTime    time.Time
+	Transfers         []JobPartPlanTransferExport
+}
+
+// JobPartPlanTransferExport is one transfer of a plan file. Times are zero if the transfer hasn't reached them.
+type JobPartPlanTransferExport struct {
+	Index                uint32
+	Source               string
+	Destination          string
+	EntityType           string
+	SourceSize           int64
+	AttemptBytes         uint64 // transferred in the transfer's current attempt
+	SourceModifiedTime   time.Time
+	TransferStatus       common.TransferStatus
+	ErrorCode            int32
+	ErrorMessage         string
+	RetryCount           uint32
+	StartTime            time.Time
+	CompletionTime       time.Time
+	DurationMilliseconds int64
+	DestVersionID        string
+}
+
+// ExportJobPlan writes the given job's plan files to w, as the indented JSON of a JobPlanExport.
+// Like WalkJobTransfers, it maps the plan files read-only, one at a time, so it works for jobs that are finished, failed,
+// or still running in another azcopy process, and never changes them. Only one part is held in memory at once.
+func (ja *jobsAdmin) ExportJobPlan(jobID common.JobID, w io.Writer) error {
+	files, err := ja.jobPlanFiles(jobID)
+	if err != nil {
+		return err
+	}
+
+	// the parts are written as they are read, so the document is put together by hand around them
+	id, _ := json.Marshal(jobID)
+	exportTime, _ := json.Marshal(time.Now().UTC())
+	if _, err = fmt.Fprintf(w, "{\n  \"SchemaVersion\": %d,\n  \"JobID\": %s,\n  \"ExportTime\": %s,\n  \"Parts\": [", JobPlanExportSchemaVersion, id, exportTime); err != nil {
+		return err
+	}
+	byStatus := make(map[string]uint32)
+	for i, file := range files {
+		part, err := exportJobPartPlanFile(JobPartPlanFileName(file.Name()), file.Size())
+		if err != nil {
+			return err
+		}
+		for _, t := range part.Transfers {
+			byStatus[t.TransferStatus.String()]++
+		}
+		b, err := marshalForExport(part, "    ")
+		if err != nil {
+			return err
+		}
+		separator := ","
+		if i == 0 {
+			separator = ""
+		}
+		if _, err = fmt.Fprintf(w, "%s\n    %s", separator, b); err != nil {
+			return err
+		}
+	}
+	counts, err := marshalForExport(byStatus, "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\n  ],\n  \"TransfersByStatus\": %s\n}\n", counts)
+	return err
+}
+
+// exportJobPartPlanFile reads the given read-only mapped plan file into a JobPartPlanExport.
+// The transfers' statuses are read with the atomic accessors, since the engine of another azcopy process may be writing them.
+func exportJobPartPlanFile(jpfn JobPartPlanFileName, fileSize int64) (JobPartPlanExport, error) {
+	mmf, err := jpfn.MapReadOnly()
+	if err != nil {
+		return JobPartPlanExport{}, err
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	if err = checkJobPartPlanHeader(jpfn, plan, fileSize); err != nil {
+		return JobPartPlanExport{}, err
+	}
+
+	part := JobPartPlanExport{
+		PartNum:           plan.PartNum,
+		IsFinalPart:       plan.IsFinalPart,
+		DataSchemaVersion: plan.Version,
+		StartTime:         time.Unix(0, plan.StartTime).UTC(),
+		JobStatus:         plan.JobStatus(),
+		CancelReason:      plan.CancelReason(),
+		CommandString:     redactURLSignatures(plan.CommandString()),
+		FromTo:            plan.FromTo.String(),
+		SourceRoot:        redactURLSignatures(string(plan.SourceRoot[:plan.SourceRootLength])),
+		DestinationRoot:   redactURLSignatures(string(plan.DestinationRoot[:plan.DestinationRootLength])),
+		Overwrite:         plan.ForceWrite.String(),
+		CollisionPolicy:   plan.DestinationCollisionOption.String(),
+		BlobType:          plan.DstBlobData.BlobType.String(),
+		LogLevel:          plan.LogLevel.String(),
+		LogFormat:         plan.LogFormat.String(),
+		NumTransfers:      plan.NumTransfers,
+		TotalBytes:        plan.TotalBytes,
+		BytesCompleted:    plan.BytesCompleted(),
+		BytesTransferred:  plan.BytesTransferred(),
+		ElapsedSeconds:    plan.ElapsedTime().Seconds(),
+		Transfers:         make([]JobPartPlanTransferExport, 0, plan.NumTransfers),
+	}
+	if completion := plan.JobCompletionTime(); !completion.IsZero() {
+		part.CompletionTime = completion.UTC()
+	}
+
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		// readTransferDetail checks that the transfer's strings are really in the file
+		detail, err := readTransferDetail(jpfn, plan, fileSize, t)
+		if err != nil {
+			return JobPartPlanExport{}, err
+		}
+		jppt := plan.Transfer(t)
+		transfer := JobPartPlanTransferExport{
+			Index:                t,
+			Source:               redactURLSignatures(detail.Src),
+			Destination:          redactURLSignatures(detail.Dst),
+			EntityType:           jppt.EntityType.String(),
+			SourceSize:           jppt.SourceSize,
+			AttemptBytes:         jppt.AttemptBytes(),
+			TransferStatus:       detail.TransferStatus,
+			ErrorCode:            detail.ErrorCode,
+			ErrorMessage:         redactURLSignatures(detail.ErrorMessage),
+			RetryCount:           jppt.RetryCount(),
+			DurationMilliseconds: detail.DurationMilliseconds,
+			DestVersionID:        detail.DestVersionID,
+		}
+		if jppt.ModifiedTime != 0 {
+			transfer.SourceModifiedTime = time.Unix(0, jppt.ModifiedTime).UTC()
+		}
+		if start := jppt.StartTime(); !start.IsZero() {
+			transfer.StartTime = start.UTC()
+		}
+		if completion := jppt.GetCompletionTime(); !completion.IsZero() {
+			transfer.CompletionTime = completion.UTC()
+		}
+		part.Transfers = append(part.Transfers, transfer)
+	}
+	return part, nil
+}
+
+// marshalForExport is like json.MarshalIndent, but doesn't escape the '&' of query strings, which would make URLs harder to read
+func marshalForExport(v interface{}, prefix string) ([]byte, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	e.SetIndent(prefix, "  ")
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+var urlInText = regexp.MustCompile(`https?://[^\s"']+`)
+
+// redactURLSignatures redacts the signatures in the query strings of any URLs in the given text, as is done for logging
+func redactURLSignatures(text string) string {
+	return urlInText.ReplaceAllStringFunc(text, func(u string) string {
+		return common.URLStringExtension(u).RedactSecretQueryParamForLogging()
+	})
+}
@@ -2,6 +2,7 @@ package ste
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -23,6 +25,13 @@ func (jppfn *JobPartPlanFileName) GetJobPartPlanPath() string {
 
 const jobPartPlanFileNameFormat = "%v--%05d.steV%d"
 
+// jobPartPlanTempFileSuffix is added to the name of a plan file while it is being written
+const jobPartPlanTempFileSuffix = ".tmp"
+
+// jobPartPlanTempFileMaxAge is how long a plan file can go unchanged under its temporary name while it is still being written.
+// Create writes the whole file at once, so one that is older than this was left by an azcopy process that was stopped.
+const jobPartPlanTempFileMaxAge = 10 * time.Minute
+
 // TODO: This needs testing
 func (jpfn JobPartPlanFileName) Parse() (jobID common.JobID, partNumber common.PartNumber, err error) {
 	var dataSchemaVersion common.Version
@@ -35,14 +44,20 @@ func (jpfn JobPartPlanFileName) Parse() (jobID common.JobID, partNumber common.P
 	//}
 	//TODO: confirm the alternative approach. fmt.Sscanf not working for reading back string into struct JobId.
 	jpfnSplit := strings.Split(string(jpfn), "--")
+	if len(jpfnSplit) != 2 {
+		err = fmt.Errorf("JobPartFileName %s is not of the form <JobId>--<PartNumber>.steV<Version>", string(jpfn))
+		return
+	}
 	jobId, err := common.ParseJobID(jpfnSplit[0])
 	if err != nil {
 		err = fmt.Errorf("failed to parse the JobId from JobPartFileName %s. Failed with error %s", string(jpfn), err.Error())
+		return
 	}
 	jobID = jobId
 	n, err := fmt.Sscanf(jpfnSplit[1], "%05d.steV%d", &partNumber, &dataSchemaVersion)
 	if err != nil || n != 2 {
-		panic(err)
+		err = fmt.Errorf("failed to parse the part number from JobPartFileName %s", string(jpfn))
+		return
 	}
 	if dataSchemaVersion != DataSchemaVersion {
 		err = fmt.Errorf("job part Plan file's data schema version ('%d') doesn't match whatthis app requires ('%d')", dataSchemaVersion, DataSchemaVersion)
@@ -50,6 +65,219 @@ func (jpfn JobPartPlanFileName) Parse() (jobID common.JobID, partNumber common.P
 	return
 }
 
+// MapReadOnly memory-maps the job part plan file without write access, for callers that only inspect the plan.
+// Unlike Map, it returns an error rather than panicking, since the plan file may not exist.
+func (jpfn JobPartPlanFileName) MapReadOnly() (*JobPartPlanMMF, error) {
+	file, err := os.Open(jpfn.GetJobPartPlanPath())
+	if err != nil {
+		return nil, err
+	}
+	// Ensure the file gets closed (although we can continue to use the MMF)
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	mmf, err := common.NewMMF(file, false, 0, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	return (*JobPartPlanMMF)(mmf), nil
+}
+
+// readJobPartPlanFile summarizes a plan file that may be corrupt or only partly written.
+// The file is checked to be as long as its header says it should be, before anything beyond the header is read from it.
+func readJobPartPlanFile(jpfn JobPartPlanFileName, fileSize int64) (summary JobPartPlanSummary, commandString string, err error) {
+	headerSize := int64(unsafe.Sizeof(JobPartPlanHeader{}))
+	if fileSize < headerSize {
+		return summary, "", fmt.Errorf("job part plan file %s is too short to hold its header", string(jpfn))
+	}
+
+	mmf, err := jpfn.MapReadOnly()
+	if err != nil {
+		return summary, "", err
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	if err = checkJobPartPlanHeader(jpfn, plan, fileSize); err != nil {
+		return summary, "", err
+	}
+
+	summary = JobPartPlanSummary{
+		Version:      plan.Version,
+		StartTime:    plan.StartTime,
+		PartNum:      plan.PartNum,
+		IsFinalPart:  plan.IsFinalPart,
+		NumTransfers: plan.NumTransfers,
+		Priority:     plan.Priority,
+		JobStatus:    plan.JobStatus(),
+
+		TTLAfterCompletion: time.Duration(plan.TTLAfterCompletion) * time.Second,
+		CompletionTime:     plan.JobCompletionTime(),
+
+		BytesTransferred: plan.BytesTransferred(),
+		ElapsedTime:      plan.ElapsedTime(),
+	}
+	return summary, plan.CommandString(), nil
+}
+
+// checkJobPartPlanHeader checks that the header of a read-only mapped plan file is of the current version,
+// and that the file is long enough to hold the transfers which the header describes
+func checkJobPartPlanHeader(jpfn JobPartPlanFileName, plan *JobPartPlanHeader, fileSize int64) error {
+	if plan.Version != DataSchemaVersion {
+		return fmt.Errorf("job part plan file %s has data schema version %d rather than %d", string(jpfn), plan.Version, DataSchemaVersion)
+	}
+	expectedSize := int64(unsafe.Sizeof(JobPartPlanHeader{})) + int64(plan.CommandStringLength) + int64(plan.DstBlobData.MetadataLength) +
+		int64(plan.DstBlobData.ContentTypeOverridesLength) + int64(plan.NumTransfers)*int64(unsafe.Sizeof(JobPartPlanTransfer{}))
+	if fileSize < expectedSize {
+		return fmt.Errorf("job part plan file %s is %d bytes but its header describes at least %d", string(jpfn), fileSize, expectedSize)
+	}
+	return nil
+}
+
+// checkJobPartPlanFile checks that a plan file was written in full: that its header is in place, and that the file
+// holds everything that the header and the transfers describe
+func checkJobPartPlanFile(jpfn JobPartPlanFileName, fileSize int64) error {
+	if fileSize < int64(unsafe.Sizeof(JobPartPlanHeader{})) {
+		return fmt.Errorf("job part plan file %s is too short to hold its header", string(jpfn))
+	}
+
+	mmf, err := jpfn.MapReadOnly()
+	if err != nil {
+		return err
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	if err = checkJobPartPlanHeader(jpfn, plan, fileSize); err != nil {
+		return err
+	}
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		if _, err = readTransferDetail(jpfn, plan, fileSize, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferStatusMatches returns whether a transfer with the given status should be included when listing transfers of status ofStatus.
+// When listing failures, transfers that failed in any way (e.g. with BlobTierFailure) are included.
+// Skipped transfers are not failures, so they are not included.
+func transferStatusMatches(status common.TransferStatus, ofStatus common.TransferStatus) bool {
+	return ofStatus == common.ETransferStatus.All() ||
+		status == ofStatus ||
+		(ofStatus == common.ETransferStatus.Failed() && status.DidFail())
+}
+
+// walkJobPartPlanTransfers calls visit for each transfer in the given plan file whose status matches ofStatus (see transferStatusMatches).
+// The file is mapped read-only, and is unmapped again before returning, so nothing read from it is retained.
+func walkJobPartPlanTransfers(jpfn JobPartPlanFileName, fileSize int64, ofStatus common.TransferStatus, visit func(common.TransferDetail) error) error {
+	mmf, err := jpfn.MapReadOnly()
+	if err != nil {
+		return err
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	if err = checkJobPartPlanHeader(jpfn, plan, fileSize); err != nil {
+		return err
+	}
+
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		if !transferStatusMatches(plan.Transfer(t).TransferStatus(), ofStatus) {
+			continue
+		}
+		detail, err := readTransferDetail(jpfn, plan, fileSize, t)
+		if err != nil {
+			return err
+		}
+		if err = visit(detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTransferDetail describes the given transfer of a read-only mapped plan file
+func readTransferDetail(jpfn JobPartPlanFileName, plan *JobPartPlanHeader, fileSize int64, t uint32) (common.TransferDetail, error) {
+	jppt := plan.Transfer(t)
+	// the strings, the failure reason and the version ID live beyond the transfers, so make sure they are really in the file before reading them
+	if jppt.SrcOffset+int64(jppt.SrcLength)+int64(jppt.DstLength) > fileSize ||
+		jppt.ErrorMessageOffset+ErrorMessageMaxBytes > fileSize ||
+		atomic.LoadUint32(&jppt.atomicErrorMessageLength) > ErrorMessageMaxBytes ||
+		(jppt.DestVersionIDOffset != 0 && jppt.DestVersionIDOffset+DestVersionIDMaxBytes > fileSize) {
+		return common.TransferDetail{}, fmt.Errorf("job part plan file %s is corrupt at transfer %d", string(jpfn), t)
+	}
+
+	src, dst, isFolder := plan.TransferSrcDstStrings(t)
+	duration, _ := jppt.Duration()
+	var modifiedTime time.Time
+	if jppt.ModifiedTime != 0 {
+		modifiedTime = time.Unix(0, jppt.ModifiedTime).UTC()
+	}
+	return common.TransferDetail{
+		Src:                  src,
+		Dst:                  dst,
+		IsFolderProperties:   isFolder,
+		SourceSize:           jppt.SourceSize,
+		SourceModifiedTime:   modifiedTime,
+		TransferStatus:       jppt.TransferStatus(),
+		ErrorCode:            jppt.ErrorCode(),
+		ErrorMessage:         plan.ErrorMessage(t),
+		DestVersionID:        plan.DestVersionID(t),
+		DurationMilliseconds: duration.Milliseconds(),
+	}, nil
+}
+
+// jobPartProgress is what one plan file says about the progress of its part of a job, at the moment it was read
+type jobPartProgress struct {
+	jobStatus        common.JobStatus // only meaningful in part 0
+	bytesTransferred uint64
+	totalBytes       uint64
+	bytesCompleted   uint64
+	statuses         []common.TransferStatus
+}
+
+// readJobPartProgress reads the progress of the part of a job in the given plan file. It calls changed for each transfer whose status
+// differs from its status in previous (which may be shorter than the part, or nil, in which case the missing transfers count as NotStarted).
+// Only the atomic accessors are used, since the engine of another azcopy process may be writing the file as it is read.
+func readJobPartProgress(jpfn JobPartPlanFileName, fileSize int64, previous []common.TransferStatus, changed func(common.TransferDetail)) (jobPartProgress, error) {
+	mmf, err := jpfn.MapReadOnly()
+	if err != nil {
+		return jobPartProgress{}, err
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	if err = checkJobPartPlanHeader(jpfn, plan, fileSize); err != nil {
+		return jobPartProgress{}, err
+	}
+
+	// the job status is read before the transfers, so that a finished job is never reported with the counts from before it finished
+	progress := jobPartProgress{jobStatus: plan.JobStatus(), statuses: make([]common.TransferStatus, plan.NumTransfers)}
+	for t := uint32(0); t < plan.NumTransfers; t++ {
+		progress.statuses[t] = plan.Transfer(t).TransferStatus()
+		previousStatus := common.ETransferStatus.NotStarted()
+		if t < uint32(len(previous)) {
+			previousStatus = previous[t]
+		}
+		if changed != nil && progress.statuses[t] != previousStatus {
+			detail, err := readTransferDetail(jpfn, plan, fileSize, t)
+			if err != nil {
+				return jobPartProgress{}, err
+			}
+			detail.TransferStatus = progress.statuses[t] // it may have moved on again since
+			changed(detail)
+		}
+	}
+	progress.bytesTransferred = plan.BytesTransferred()
+	progress.totalBytes = plan.TotalBytes
+	progress.bytesCompleted = plan.BytesCompleted()
+	return progress, nil
+}
+
 func (jpfn JobPartPlanFileName) Delete() error {
 	return os.Remove(string(jpfn))
 }
@@ -98,9 +326,6 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	if len(order.BlobAttributes.CacheControl) > len(JobPartPlanDstBlob{}.CacheControl) {
 		panic(fmt.Errorf("cache control string is too large: %q", order.BlobAttributes.CacheControl))
 	}
-	if len(order.BlobAttributes.Metadata) > len(JobPartPlanDstBlob{}.Metadata) {
-		panic(fmt.Errorf("metadata string is too large: %q", order.BlobAttributes.Metadata))
-	}
 	if len(order.BlobAttributes.BlobTagsString) > len(JobPartPlanDstBlob{}.BlobTags) {
 		panic(fmt.Errorf("blob tags string is too large: %q", order.BlobAttributes.BlobTagsString))
 	}
@@ -138,7 +363,11 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 
 	// create the Job Part Plan file
 	//planPathname := planDir + "/" + string(jpfn)
-	file, err := os.Create(jpfn.GetJobPartPlanPath())
+	// the file is written under a temporary name, and only given its real one once it is complete, so that a plan file is
+	// never half-written, even if azcopy is stopped while writing it. The header is written last, so that a temporary file
+	// whose header is in place is known to be complete (see RecoverJobPlan)
+	tempPath := jpfn.GetJobPartPlanPath() + jobPartPlanTempFileSuffix
+	file, err := os.Create(tempPath)
 	if err != nil {
 		panic(fmt.Errorf("couldn't create job part plan file %q: %v", jpfn, err))
 	}
@@ -164,6 +393,18 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	//	}*/
 	//}
 	// Initialize the Job Part's Plan header
+	// the size of the part's files is known now, so that progress can be measured in bytes, rather than just in transfers
+	var contentTypeOverrides []byte
+	if len(order.ContentTypeOverrides) > 0 {
+		contentTypeOverrides, err = json.Marshal(order.ContentTypeOverrides)
+		common.PanicIfErr(err)
+	}
+	totalBytes := uint64(0)
+	for _, transfer := range order.Transfers {
+		if transfer.EntityType == common.EEntityType.File() {
+			totalBytes += uint64(transfer.SourceSize)
+		}
+	}
 	jpph := JobPartPlanHeader{
 		Version:                DataSchemaVersion,
 		StartTime:              time.Now().UnixNano(),
@@ -176,14 +417,16 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		IsFinalPart:            order.IsFinalPart,
 		ForceWrite:             order.ForceWrite,
 		ForceIfReadOnly:        order.ForceIfReadOnly,
+		SourceNewerTolerance:   order.SourceNewerTolerance,
 		AutoDecompress:         order.AutoDecompress,
 		Priority:               order.Priority,
-		TTLAfterCompletion:     uint32(time.Time{}.Nanosecond()),
+		TTLAfterCompletion:     uint32(order.TTLAfterCompletion / time.Second),
 		FromTo:                 order.FromTo,
 		Fpo:                    order.Fpo,
 		CommandStringLength:    uint32(len(order.CommandString)),
 		NumTransfers:           uint32(len(order.Transfers)),
 		LogLevel:               order.LogLevel,
+		LogFormat:              order.LogFormat,
 		DstBlobData: JobPartPlanDstBlob{
 			BlobType:                 order.BlobAttributes.BlobType,
 			NoGuessMimeType:          order.BlobAttributes.NoGuessMimeType,
@@ -195,21 +438,47 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			PutMd5:                   order.BlobAttributes.PutMd5, // here because it relates to uploads (blob destination)
 			BlockBlobTier:            order.BlobAttributes.BlockBlobTier,
 			PageBlobTier:             order.BlobAttributes.PageBlobTier,
-			MetadataLength:           uint16(len(order.BlobAttributes.Metadata)),
-			BlockSize:                blockSize,
-			BlobTagsLength:           uint16(len(order.BlobAttributes.BlobTagsString)),
+			MetadataOffset:           int64(unsafe.Sizeof(JobPartPlanHeader{})) + int64(len(order.CommandString)),
+			MetadataLength:           uint32(len(order.BlobAttributes.Metadata)),
+			ContentTypeOverridesOffset: int64(unsafe.Sizeof(JobPartPlanHeader{})) + int64(len(order.CommandString)) +
+				int64(len(order.BlobAttributes.Metadata)),
+			ContentTypeOverridesLength: uint32(len(contentTypeOverrides)),
+			BlockSize:                  blockSize,
+			BlobTagsLength:             uint16(len(order.BlobAttributes.BlobTagsString)),
+			GzipUpload:                 order.BlobAttributes.GzipUpload,
+			GzipMinSize:                order.BlobAttributes.GzipMinSize,
+			GzipExtensionsLength:       uint16(len(order.BlobAttributes.GzipExtensions)),
+			ImmutabilityPolicyMode:     order.BlobAttributes.ImmutabilityPolicyMode,
 		},
 		DstLocalData: JobPartPlanDstLocal{
 			PreserveLastModifiedTime: order.BlobAttributes.PreserveLastModifiedTime,
 			MD5VerificationOption:    order.BlobAttributes.MD5ValidationOption, // here because it relates to downloads (file destination)
 		},
-		PreserveSMBPermissions: order.PreserveSMBPermissions,
-		PreserveSMBInfo:        order.PreserveSMBInfo,
+		PreserveSMBPermissions:  order.PreserveSMBPermissions,
+		PreserveSMBInfo:         order.PreserveSMBInfo,
+		PreservePOSIXProperties: order.PreservePOSIXProperties,
+		PreserveACLs:            order.PreserveACLs,
+		PreserveImmutability:    order.PreserveImmutability,
 		// For S2S copy, per JobPartPlan info
 		S2SGetPropertiesInBackend:      order.S2SGetPropertiesInBackend,
 		S2SSourceChangeValidation:      order.S2SSourceChangeValidation,
+		S2SRehydrateArchivedSource:     order.S2SRehydrateArchivedSource,
+		S2SCopyMethod:                  order.S2SCopyMethod,
+		SkipIfHashMatches:              order.SkipIfHashMatches,
 		S2SInvalidMetadataHandleOption: order.S2SInvalidMetadataHandleOption,
 		DestLengthValidation:           order.DestLengthValidation,
+		DryRun:                         order.DryRun,
+		DestinationCollisionOption:     order.DestinationCollisionOption,
+		ChecksumAlgorithm:              order.BlobAttributes.ChecksumAlgorithm,
+		Concurrency:                    order.Concurrency,
+		MaxDuration:                    order.MaxDuration,
+		MaxRetries:                     order.MaxRetries,
+		RetryChangedFiles:              order.RetryChangedFiles,
+		MaxTotalBytes:                  order.MaxTotalBytes,
+		CredentialType:                 order.CredentialInfo.CredentialType,
+		SourceSASRequired:              order.SourceRoot.SAS != "",
+		DestinationSASRequired:         order.DestinationRoot.SAS != "",
+		TotalBytes:                     totalBytes,
 		atomicJobStatus:                common.EJobStatus.InProgress(), // We default to InProgress
 		DeleteSnapshotsOption:          order.BlobAttributes.DeleteSnapshotsOption,
 	}
@@ -220,15 +489,21 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	copy(jpph.SourceExtraQuery[:], order.SourceRoot.ExtraQuery)
 	copy(jpph.DestinationRoot[:], order.DestinationRoot.Value)
 	copy(jpph.DestExtraQuery[:], order.DestinationRoot.ExtraQuery)
+	jpph.BandwidthScheduleLength = uint8(copy(jpph.BandwidthSchedule[:], order.BandwidthSchedule))
 	copy(jpph.DstBlobData.ContentType[:], order.BlobAttributes.ContentType)
 	copy(jpph.DstBlobData.ContentEncoding[:], order.BlobAttributes.ContentEncoding)
 	copy(jpph.DstBlobData.ContentLanguage[:], order.BlobAttributes.ContentLanguage)
 	copy(jpph.DstBlobData.ContentDisposition[:], order.BlobAttributes.ContentDisposition)
 	copy(jpph.DstBlobData.CacheControl[:], order.BlobAttributes.CacheControl)
-	copy(jpph.DstBlobData.Metadata[:], order.BlobAttributes.Metadata)
 	copy(jpph.DstBlobData.BlobTags[:], order.BlobAttributes.BlobTagsString)
+	copy(jpph.DstBlobData.GzipExtensions[:], order.BlobAttributes.GzipExtensions)
+	copy(jpph.CpkKeySha256[:], order.CpkKeySha256)
+	if !order.BlobAttributes.ImmutabilityPolicyExpiresOn.IsZero() {
+		jpph.DstBlobData.ImmutabilityPolicyExpiresOn = order.BlobAttributes.ImmutabilityPolicyExpiresOn.UnixNano()
+	}
 
-	eof += writeValue(file, &jpph)
+	// leave room for the header, which is only written once everything it describes is in the file
+	eof += writeValue(file, &JobPartPlanHeader{})
 
 	// write the command string in the JobPart Plan file
 	bytesWritten, err := file.WriteString(order.CommandString)
@@ -237,12 +512,51 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	}
 	eof += int64(bytesWritten)
 
+	// write the metadata to apply to destination blobs; it comes straight after the command string
+	if eof != jpph.DstBlobData.MetadataOffset {
+		panic(errors.New("job plan file's EOF and the metadata offset didn't line up"))
+	}
+	bytesWritten, err = file.WriteString(order.BlobAttributes.Metadata)
+	if err != nil {
+		panic(err)
+	}
+	eof += int64(bytesWritten)
+
+	// and the content type overrides straight after that
+	if eof != jpph.DstBlobData.ContentTypeOverridesOffset {
+		panic(errors.New("job plan file's EOF and the content type overrides offset didn't line up"))
+	}
+	bytesWritten, err = file.Write(contentTypeOverrides)
+	if err != nil {
+		panic(err)
+	}
+	eof += int64(bytesWritten)
+
 	// srcDstStringsOffset points to after the header & all the transfers; this is where the src/dst strings go for each transfer
 	srcDstStringsOffset := make([]int64, jpph.NumTransfers)
 
 	// Initialize the offset for the 1st transfer's src/dst strings
 	currentSrcStringOffset := eof + int64(unsafe.Sizeof(JobPartPlanTransfer{}))*int64(jpph.NumTransfers)
 
+	// The overflow chunk bitmaps (for transfers with too many chunks to track inline) come right after the transfers,
+	// each followed by its transfer's digest, the space for its failure reason and (for blob destinations) the space for the version ID
+	// of the blob it writes, so the src/dst strings start after them.
+	// Digests are 16 or 32 bytes long, and ErrorMessageMaxBytes and DestVersionIDMaxBytes are multiples of 8, so the bitmaps that follow them stay aligned for atomic access.
+	chunkBitmapOffset := currentSrcStringOffset
+	chunkBitmapOverflowWords := make([]uint32, jpph.NumTransfers)
+	digestLengths := make([]uint8, jpph.NumTransfers)
+	destVersionIDLengths := make([]int64, jpph.NumTransfers)
+	for t := range order.Transfers {
+		chunkBitmapOverflowWords[t] = getChunkBitmapOverflowWords(order.FromTo, order.Transfers[t], blockSize)
+		if order.Transfers[t].EntityType == common.EEntityType.File() {
+			digestLengths[t] = uint8(jpph.ChecksumAlgorithm.Size())
+			if order.FromTo.To() == common.ELocation.Blob() {
+				destVersionIDLengths[t] = DestVersionIDMaxBytes
+			}
+		}
+		currentSrcStringOffset += int64(chunkBitmapOverflowWords[t])*int64(unsafe.Sizeof(uint64(0))) + int64(digestLengths[t]) + ErrorMessageMaxBytes + destVersionIDLengths[t]
+	}
+
 	// Write each transfer to the Job Part Plan file (except for the src/dst strings; comes come later)
 	for t := range order.Transfers {
 		if len(order.Transfers[t].Source) > math.MaxInt16 || len(order.Transfers[t].Destination) > math.MaxInt16 {
@@ -293,11 +607,30 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			SrcBlobTierLength:           int16(len(order.Transfers[t].BlobTier)),
 			SrcBlobVersionIDLength:      int16(len(order.Transfers[t].BlobVersionID)),
 			SrcBlobTagsLength:           int16(srcBlobTagsLength),
+			SrcBlobSnapshotIDLength:     int16(len(order.Transfers[t].BlobSnapshotID)),
+			DstIfMatchLength:            int16(len(order.Transfers[t].DestIfMatch)),
+			DstIfNoneMatchLength:        int16(len(order.Transfers[t].DestIfNoneMatch)),
+			ChunkBitmapOffset:           chunkBitmapOffset,
+			ChunkBitmapOverflowWords:    chunkBitmapOverflowWords[t],
+			DigestOffset:                chunkBitmapOffset + int64(chunkBitmapOverflowWords[t])*int64(unsafe.Sizeof(uint64(0))),
+			DigestLength:                digestLengths[t],
+			ErrorMessageOffset:          chunkBitmapOffset + int64(chunkBitmapOverflowWords[t])*int64(unsafe.Sizeof(uint64(0))) + int64(digestLengths[t]),
 
 			atomicTransferStatus: common.ETransferStatus.Started(), // Default
 			//ChunkNum:                getNumChunks(uint64(order.Transfers[t].SourceSize), uint64(data.BlockSize)),
 		}
+		if immutability := order.Transfers[t].BlobImmutability; order.PreserveImmutability {
+			if immutability.HasPolicy() {
+				jppt.SrcImmutabilityPolicyExpiresOn = immutability.PolicyExpiresOn.UnixNano()
+				jppt.SrcImmutabilityPolicyMode = immutability.PolicyMode
+			}
+			jppt.SrcLegalHold = immutability.LegalHold
+		}
+		if destVersionIDLengths[t] != 0 {
+			jppt.DestVersionIDOffset = jppt.ErrorMessageOffset + ErrorMessageMaxBytes
+		}
 		eof += writeValue(file, &jppt) // Write the transfer entry
+		chunkBitmapOffset = jppt.ErrorMessageOffset + ErrorMessageMaxBytes + destVersionIDLengths[t]
 
 		// The NEXT transfer's src/dst string come after THIS transfer's src/dst strings
 		srcDstStringsOffset[t] = currentSrcStringOffset
@@ -305,10 +638,18 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		currentSrcStringOffset += int64(jppt.SrcLength + jppt.DstLength + jppt.SrcContentTypeLength +
 			jppt.SrcContentEncodingLength + jppt.SrcContentLanguageLength + jppt.SrcContentDispositionLength +
 			jppt.SrcCacheControlLength + jppt.SrcContentMD5Length + jppt.SrcMetadataLength +
-			jppt.SrcBlobTypeLength + jppt.SrcBlobTierLength + jppt.SrcBlobVersionIDLength + jppt.SrcBlobTagsLength)
+			jppt.SrcBlobTypeLength + jppt.SrcBlobTierLength + jppt.SrcBlobVersionIDLength + jppt.SrcBlobTagsLength + jppt.SrcBlobSnapshotIDLength +
+			jppt.DstIfMatchLength + jppt.DstIfNoneMatchLength)
 	}
 
-	// All the transfers were written; now write each transfer's src/dst strings
+	// All the transfers were written; now write the (initially empty) overflow chunk bitmaps, digests, failure reasons and version IDs
+	if chunkBitmapOffset > eof {
+		bytesWritten, err := file.Write(make([]byte, chunkBitmapOffset-eof))
+		common.PanicIfErr(err)
+		eof += int64(bytesWritten)
+	}
+
+	// now write each transfer's src/dst strings
 	for t := range order.Transfers {
 		// Sanity check: Verify that we are were we think we are and that no bug has occurred
 		if eof != srcDstStringsOffset[t] {
@@ -385,6 +726,50 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 			common.PanicIfErr(err)
 			eof += int64(bytesWritten)
 		}
+		if len(order.Transfers[t].BlobSnapshotID) != 0 {
+			bytesWritten, err = file.WriteString(order.Transfers[t].BlobSnapshotID)
+			common.PanicIfErr(err)
+			eof += int64(bytesWritten)
+		}
+		if len(order.Transfers[t].DestIfMatch) != 0 {
+			bytesWritten, err = file.WriteString(order.Transfers[t].DestIfMatch)
+			common.PanicIfErr(err)
+			eof += int64(bytesWritten)
+		}
+		if len(order.Transfers[t].DestIfNoneMatch) != 0 {
+			bytesWritten, err = file.WriteString(order.Transfers[t].DestIfNoneMatch)
+			common.PanicIfErr(err)
+			eof += int64(bytesWritten)
+		}
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	common.PanicIfErr(err)
+	writeValue(file, &jpph)
+
+	// make sure the whole file is on disk before it is renamed, since the rename may otherwise reach the disk first
+	common.PanicIfErr(file.Sync())
+	common.PanicIfErr(file.Close()) // it must be closed before it can be renamed on Windows
+	if err := os.Rename(tempPath, jpfn.GetJobPartPlanPath()); err != nil {
+		panic(fmt.Errorf("couldn't create job part plan file %q: %v", jpfn, err))
+	}
+}
+
+// getChunkBitmapOverflowWords returns how many 64-bit words, beyond those kept inline in JobPartPlanTransfer,
+// are needed to record the completion of every chunk of the given transfer.
+// Only blob and ADLS Gen2 destinations, and downloads, make use of the chunk bitmap, so other transfers get no overflow region.
+func getChunkBitmapOverflowWords(fromTo common.FromTo, transfer common.CopyTransfer, blockSize int64) uint32 {
+	recordsChunks := fromTo.To() == common.ELocation.Blob() || fromTo.To() == common.ELocation.BlobFS() || fromTo.IsDownload()
+	if !recordsChunks || transfer.EntityType != common.EEntityType.File() {
+		return 0
+	}
+	numChunks := getNumChunks(transfer.SourceSize, computeBlockSize(blockSize, transfer.SourceSize))
+	if numChunks > common.MaxNumberOfBlocksPerBlob {
+		return 0 // such a transfer will fail anyway, since it has too many blocks for a block blob
+	}
+	numWords := (numChunks + 63) / 64
+	if numWords <= chunkBitmapInlineWords {
+		return 0
 	}
-	// the file is closed to due to defer above
+	return numWords - chunkBitmapInlineWords
 }
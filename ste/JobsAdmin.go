@@ -23,6 +23,7 @@ package ste
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -71,7 +72,7 @@ var JobsAdmin interface {
 
 	// JobMgr returns the specified JobID's JobMgr
 	JobMgr(jobID common.JobID) (IJobMgr, bool)
-	JobMgrEnsureExists(jobID common.JobID, level common.LogLevel, commandString string) IJobMgr
+	JobMgrEnsureExists(jobID common.JobID, level common.LogLevel, logFormat common.LogFormat, commandString string) IJobMgr
 
 	// AddJobPartMgr associates the specified JobPartMgr with the Jobs Administrator
 	//AddJobPartMgr(appContext context.Context, planFile JobPartPlanFileName) IJobPartMgr
@@ -80,8 +81,30 @@ var JobsAdmin interface {
 
 	ResurrectJob(jobId common.JobID, sourceSAS string, destinationSAS string) bool
 
+	// RecoverJobPlan finishes, or discards, the plan files of the given job that azcopy was stopped in the middle of creating
+	RecoverJobPlan(jobID common.JobID) JobPlanRecovery
+
 	ResurrectJobParts()
 
+	// ListJobPlans summarizes every job that has plan files in the plan folder, newest first
+	ListJobPlans() []common.JobIDDetails
+
+	// WalkJobTransfers calls visit, one at a time, for each transfer of the given job whose status matches ofStatus
+	WalkJobTransfers(jobID common.JobID, ofStatus common.TransferStatus, visit func(common.TransferDetail) error) error
+
+	// ExportJobPlan writes a portable, redacted copy of the plan files of the given job to w, as JSON
+	ExportJobPlan(jobID common.JobID, w io.Writer) error
+
+	// FollowJobProgress polls the plan files of the given job, calling emit with what has changed, until the job is done
+	FollowJobProgress(ctx context.Context, jobID common.JobID, interval time.Duration, emit func(common.JobProgressUpdate)) error
+
+	// DeleteExpiredJobPlans deletes the plan files of finished jobs whose time to live has passed
+	DeleteExpiredJobPlans(now time.Time) []common.JobID
+	StartJobPlanReaper(interval time.Duration)
+
+	// StartMetricsServer serves Prometheus-format metrics of the running jobs on the given address
+	StartMetricsServer(address string) error
+
 	QueueJobParts(jpm IJobPartMgr)
 
 	// AppPathFolder returns the Azcopy application path folder.
@@ -91,11 +114,6 @@ var JobsAdmin interface {
 	// returns the current value of bytesOverWire.
 	BytesOverWire() int64
 
-	AddSuccessfulBytesInActiveFiles(n int64)
-
-	// returns number of bytes successfully transferred in transfers that are currently in progress
-	SuccessfulBytesInActiveFiles() uint64
-
 	MessagesForJobLog() <-chan struct {
 		string
 		pipeline.LogLevel
@@ -108,6 +126,26 @@ var JobsAdmin interface {
 	CurrentMainPoolSize() int
 
 	RequestTuneSlowly()
+
+	// SetBandwidthCap changes the cap on the aggregate throughput of all jobs. Zero means no cap.
+	SetBandwidthCap(megaBitsPerSec float64)
+
+	// BandwidthCap returns the current cap on the aggregate throughput of all jobs, or zero if there is no cap.
+	BandwidthCap() float64
+
+	// SetDirectionalBandwidthCap changes the cap on the throughput of all uploads, or of all downloads, which applies
+	// on top of the aggregate cap. Zero means no cap.
+	SetDirectionalBandwidthCap(direction common.TransferDirection, megaBitsPerSec float64)
+
+	// DirectionalBandwidthCap returns the current cap on the throughput of all uploads, or of all downloads, or zero if there is no cap.
+	DirectionalBandwidthCap(direction common.TransferDirection) float64
+
+	// StartBandwidthSchedule makes the bandwidth cap follow the given schedule while the given job runs, replacing any earlier schedule.
+	// Outside the schedule's windows, the cap is the one that applied before, or the one given to SetBandwidthCap.
+	StartBandwidthSchedule(jobID common.JobID, schedule common.BandwidthSchedule)
+
+	// StopBandwidthSchedule stops the schedule started for the given job, if there is one, and restores the cap that applies outside its windows
+	StopBandwidthSchedule(jobID common.JobID)
 }
 
 func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targetRateInMegaBitsPerSec float64, azcopyJobPlanFolder string, azcopyLogPathFolder string, providePerfAdvice bool) {
@@ -143,18 +181,19 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 
 	maxRamBytesToUse := getMaxRamForChunks()
 
-	// default to a pacer that doesn't actually control the rate
-	// (it just records total throughput, since for historical reasons we do that in the pacer)
-	var pacer pacerAdmin = newNullAutoPacer()
-	if targetRateInMegaBitsPerSec > 0 {
-		// use the "networking mega" (based on powers of 10, not powers of 2, since that's what mega means in networking context)
-		targetRateInBytesPerSec := int64(targetRateInMegaBitsPerSec * 1000 * 1000 / 8)
-		unusedExpectedCoarseRequestByteCount := int64(0)
-		pacer = newTokenBucketPacer(targetRateInBytesPerSec, unusedExpectedCoarseRequestByteCount)
-		// Note: as at July 2019, we don't currently have a shutdown method/event on JobsAdmin where this pacer
-		// could be shut down. But, it's global anyway, so we just leave it running until application exit.
-	}
-
+	// Always use a real pacer, even if there's no cap (yet), so that the cap can be changed while jobs are running.
+	// (Before the cap could be changed, a null pacer was used when there was no cap.)
+	// With a zero rate it doesn't actually control anything: requests go straight through, at the cost of an atomic add or two,
+	// and it just records total throughput, since for historical reasons we do that in the pacer
+	unusedExpectedCoarseRequestByteCount := int64(0)
+	pacer := newTokenBucketPacer(megaBitsToBytesPerSecond(targetRateInMegaBitsPerSec), unusedExpectedCoarseRequestByteCount)
+	// Uploads and downloads are also paced by a pacer of their own direction, so that each can be capped separately
+	uploadPacer := newTokenBucketPacer(0, unusedExpectedCoarseRequestByteCount)
+	downloadPacer := newTokenBucketPacer(0, unusedExpectedCoarseRequestByteCount)
+	// Note: as at July 2019, we don't currently have a shutdown method/event on JobsAdmin where this pacer
+	// could be shut down. But, it's global anyway, so we just leave it running until application exit.
+
+	cacheLimiter := common.NewCacheLimiter(maxRamBytesToUse)
 	ja := &jobsAdmin{
 		concurrency:             concurrency,
 		logger:                  common.NewAppLogger(pipeline.LogInfo, azcopyLogPathFolder),
@@ -162,12 +201,13 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 		logDir:                  azcopyLogPathFolder,
 		planDir:                 azcopyJobPlanFolder,
 		pacer:                   pacer,
-		slicePool:               common.NewMultiSizeSlicePool(common.MaxBlockBlobBlockSize),
-		cacheLimiter:            common.NewCacheLimiter(maxRamBytesToUse),
+		uploadPacer:             uploadPacer,
+		downloadPacer:           downloadPacer,
+		slicePool:               common.NewLimitedMultiSizeSlicePool(common.MaxBlockBlobBlockSize, cacheLimiter),
+		cacheLimiter:            cacheLimiter,
 		fileCountLimiter:        common.NewCacheLimiter(int64(concurrency.MaxOpenDownloadFiles)),
 		cpuMonitor:              cpuMon,
 		appCtx:                  appCtx,
-		commandLineMbpsCap:      targetRateInMegaBitsPerSec,
 		provideBenchmarkResults: providePerfAdvice,
 		coordinatorChannels: CoordinatorChannels{
 			partsChannel:     partsCh,
@@ -222,9 +262,9 @@ func initJobsAdmin(appCtx context.Context, concurrency ConcurrencySettings, targ
 
 // Decide on a max amount of RAM we are willing to use. This functions as a cap, and prevents excessive usage.
 // There's no measure of physical RAM in the STD library, so we guesstimate conservatively, based on  CPU count (logical, not physical CPUs)
-// Note that, as at Feb 2019, the multiSizeSlicePooler uses additional RAM, over this level, since it includes the cache of
-// currently-unused, re-usable slices, that is not tracked by cacheLimiter.
-// Also, block sizes that are not powers of two result in extra usage over and above this limit. (E.g. 100 MB blocks each
+// The cacheLimiter keeps the chunks that are in flight at once within this level, and the slice pool throws away
+// currently-unused, re-usable slices rather than take the total above it.
+// However, block sizes that are not powers of two result in extra usage over and above this limit. (E.g. 100 MB blocks each
 // count 100 MB towards this limit, but actually consume 128 MB)
 func getMaxRamForChunks() int64 {
 
@@ -450,31 +490,15 @@ func (ja *jobsAdmin) chunkProcessor(workerID int) {
 // separate from the chunkProcessor, this dedicated worker that reads in and executes transfer initiation jobs
 // (which in turn schedule chunks that get picked up by chunkProcessor)
 func (ja *jobsAdmin) transferProcessor(workerID int) {
-	startTransfer := func(jptm IJobPartTransferMgr) {
-		if jptm.WasCanceled() {
-			if jptm.ShouldLog(pipeline.LogInfo) {
-				jptm.Log(pipeline.LogInfo, fmt.Sprintf(" is not picked up worked %d because transfer was cancelled", workerID))
-			}
-			jptm.SetStatus(common.ETransferStatus.Cancelled())
-			jptm.ReportTransferDone()
-		} else {
-			// TODO fix preceding space
-			if jptm.ShouldLog(pipeline.LogInfo) {
-				jptm.Log(pipeline.LogInfo, fmt.Sprintf("has worker %d which is processing TRANSFER", workerID))
-			}
-			jptm.StartJobXfer()
-		}
-	}
-
 	for {
 		// No scaleback check here, because this routine runs only in a small number of goroutines, so no need to kill them off
 		select {
 		case jptm := <-ja.xferChannels.normalTransferCh:
-			startTransfer(jptm)
+			startTransfer(jptm, workerID)
 		default:
 			select {
 			case jptm := <-ja.xferChannels.lowTransferCh:
-				startTransfer(jptm)
+				startTransfer(jptm, workerID)
 			default:
 				time.Sleep(10 * time.Millisecond) // Sleep before looping around
 			}
@@ -482,18 +506,49 @@ func (ja *jobsAdmin) transferProcessor(workerID int) {
 	}
 }
 
+// startTransfer starts a transfer on the given transfer worker, unless it can't or mustn't start yet
+func startTransfer(jptm IJobPartTransferMgr, workerID int) {
+	if jptm.WasCanceled() || jptm.IsJobCancelling() || jptm.IsJobPaused() {
+		if jptm.ShouldLog(pipeline.LogInfo) {
+			jptm.Log(pipeline.LogInfo, fmt.Sprintf(" is not picked up by worker %d because transfer was cancelled or its job paused", workerID))
+		}
+		status := common.ETransferStatus.Cancelled()
+		if !jptm.WasCanceled() && jptm.IsJobCancelling() && jptm.IsJobStoppedByMaxTotalBytes() {
+			// record it as left out by the limit, like the transfer that reached it, so that they can be listed
+			status = common.ETransferStatus.ExceededMaxTotalBytes()
+		}
+		jptm.SetStatus(status)
+		jptm.ReportTransferDone()
+	} else if !jptm.TryTakeTransferSlot() {
+		// the job already has as many transfers in progress as its own concurrency limit allows. Try again later,
+		// rather than wait here, since that would hold up the other jobs' transfers too
+		jptm.RescheduleTransferAfter(transferSlotRetryInterval)
+	} else if !jptm.ReserveBytes() {
+		if jptm.ShouldLog(pipeline.LogInfo) {
+			jptm.Log(pipeline.LogInfo, fmt.Sprintf(" is not picked up by worker %d because it would take its job past its maximum total bytes", workerID))
+		}
+		jptm.SetStatus(common.ETransferStatus.ExceededMaxTotalBytes())
+		jptm.ReportTransferDone()
+	} else {
+		// TODO fix preceding space
+		if jptm.ShouldLog(pipeline.LogInfo) {
+			jptm.Log(pipeline.LogInfo, fmt.Sprintf("has worker %d which is processing TRANSFER", workerID))
+		}
+		jptm.StartJobXfer()
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // There will be only 1 instance of the jobsAdmin type.
 // The coordinator uses this to manage all the running jobs and their job parts.
 type jobsAdmin struct {
-	atomicSuccessfulBytesInActiveFiles int64
-	atomicBytesTransferredWhileTuning  int64
-	atomicTuningEndSeconds             int64
-	atomicCurrentMainPoolSize          int32 // align 64 bit integers for 32 bit arch
-	concurrency                        ConcurrencySettings
-	logger                             common.ILoggerCloser
-	jobIDToJobMgr                      jobIDToJobMgr // Thread-safe map from each JobID to its JobInfo
+	atomicBytesTransferredWhileTuning int64
+	atomicTuningEndSeconds            int64
+	atomicCurrentMainPoolSize         int32 // align 64 bit integers for 32 bit arch
+	concurrency                       ConcurrencySettings
+	logger                            common.ILoggerCloser
+	jobIDToJobMgr                     jobIDToJobMgr // Thread-safe map from each JobID to its JobInfo
 	// Other global state can be stored in more fields here...
 	logDir                      string // Where log files are stored
 	planDir                     string // Initialize to directory where Job Part Plans are stored
@@ -501,7 +556,9 @@ type jobsAdmin struct {
 	xferChannels                XferChannels
 	poolSizingChannels          poolSizingChannels
 	appCtx                      context.Context
-	pacer                       pacerAdmin
+	pacer                       *tokenBucketPacer // caps the aggregate throughput, and counts all traffic
+	uploadPacer                 *tokenBucketPacer // caps the throughput of uploads only
+	downloadPacer               *tokenBucketPacer // caps the throughput of downloads only
 	slicePool                   common.ByteSlicePooler
 	cacheLimiter                common.CacheLimiter
 	fileCountLimiter            common.CacheLimiter
@@ -510,9 +567,10 @@ type jobsAdmin struct {
 		pipeline.LogLevel
 	}
 	concurrencyTuner        ConcurrencyTuner
-	commandLineMbpsCap      float64
 	provideBenchmarkResults bool
 	cpuMonitor              common.CPUMonitor
+	bandwidthScheduleMu     sync.Mutex
+	bandwidthScheduler      *bandwidthScheduler // nil unless a running job has a bandwidth schedule
 }
 
 type CoordinatorChannels struct {
@@ -569,12 +627,12 @@ func (ja *jobsAdmin) AppPathFolder() string {
 // JobMgrEnsureExists returns the specified JobID's IJobMgr if it exists or creates it if it doesn't already exit
 // If it does exist, then the appCtx argument is ignored.
 func (ja *jobsAdmin) JobMgrEnsureExists(jobID common.JobID,
-	level common.LogLevel, commandString string) IJobMgr {
+	level common.LogLevel, logFormat common.LogFormat, commandString string) IJobMgr {
 
 	return ja.jobIDToJobMgr.EnsureExists(jobID,
 		func() IJobMgr {
 			// Return existing or new IJobMgr to caller
-			return newJobMgr(ja.concurrency, ja.logger, jobID, ja.appCtx, ja.cpuMonitor, level, commandString, ja.logDir)
+			return newJobMgr(ja.concurrency, ja.logger, jobID, ja.appCtx, ja.cpuMonitor, level, logFormat, commandString, ja.logDir)
 		})
 }
 
@@ -606,32 +664,9 @@ func (ja *jobsAdmin) BytesOverWire() int64 {
 	return ja.pacer.GetTotalTraffic()
 }
 
-func (ja *jobsAdmin) AddSuccessfulBytesInActiveFiles(n int64) {
-	atomic.AddInt64(&ja.atomicSuccessfulBytesInActiveFiles, n)
-}
-
-func (ja *jobsAdmin) SuccessfulBytesInActiveFiles() uint64 {
-	n := atomic.LoadInt64(&ja.atomicSuccessfulBytesInActiveFiles)
-	if n < 0 {
-		n = 0 // should never happen, but would result in nasty over/underflow if it did
-	}
-	return uint64(n)
-}
-
 func (ja *jobsAdmin) ResurrectJob(jobId common.JobID, sourceSAS string, destinationSAS string) bool {
 	// Search the existing plan files for the PartPlans for the given jobId
-	// only the files which have JobId has prefix and DataSchemaVersion as Suffix
-	// are include in the result
-	files := func(prefix, ext string) []os.FileInfo {
-		var files []os.FileInfo
-		filepath.Walk(ja.planDir, func(path string, fileInfo os.FileInfo, _ error) error {
-			if !fileInfo.IsDir() && strings.HasPrefix(fileInfo.Name(), prefix) && strings.HasSuffix(fileInfo.Name(), ext) {
-				files = append(files, fileInfo)
-			}
-			return nil
-		})
-		return files
-	}(jobId.String(), fmt.Sprintf(".steV%d", DataSchemaVersion))
+	files := ja.planFilesInFolder(jobId.String())
 	// If no files with JobId exists then return false
 	if len(files) == 0 {
 		return false
@@ -645,7 +680,7 @@ func (ja *jobsAdmin) ResurrectJob(jobId common.JobID, sourceSAS string, destinat
 			continue
 		}
 		mmf := planFile.Map()
-		jm := ja.JobMgrEnsureExists(jobID, mmf.Plan().LogLevel, "")
+		jm := ja.JobMgrEnsureExists(jobID, mmf.Plan().LogLevel, mmf.Plan().LogFormat, "")
 		jm.AddJobPart(partNum, planFile, mmf, sourceSAS, destinationSAS, false)
 	}
 	return true
@@ -654,16 +689,7 @@ func (ja *jobsAdmin) ResurrectJob(jobId common.JobID, sourceSAS string, destinat
 // reconstructTheExistingJobParts reconstructs the in memory JobPartPlanInfo for existing memory map JobFile
 func (ja *jobsAdmin) ResurrectJobParts() {
 	// Get all the Job part plan files in the plan directory
-	files := func(ext string) []os.FileInfo {
-		var files []os.FileInfo
-		filepath.Walk(ja.planDir, func(path string, fileInfo os.FileInfo, _ error) error {
-			if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), ext) {
-				files = append(files, fileInfo)
-			}
-			return nil
-		})
-		return files
-	}(fmt.Sprintf(".steV%d", DataSchemaVersion))
+	files := ja.planFilesInFolder("")
 
 	// TODO : sort the file.
 	for f := 0; f < len(files); f++ {
@@ -674,11 +700,345 @@ func (ja *jobsAdmin) ResurrectJobParts() {
 		}
 		mmf := planFile.Map()
 		//todo : call the compute transfer function here for each job.
-		jm := ja.JobMgrEnsureExists(jobID, mmf.Plan().LogLevel, "")
+		jm := ja.JobMgrEnsureExists(jobID, mmf.Plan().LogLevel, mmf.Plan().LogFormat, "")
 		jm.AddJobPart(partNum, planFile, mmf, EMPTY_SAS_STRING, EMPTY_SAS_STRING, false)
 	}
 }
 
+// jobPlans is what scanJobPlans found out about one job
+type jobPlans struct {
+	details    common.JobIDDetails
+	part0      *JobPartPlanSummary
+	unreadable bool
+	planFiles  []JobPartPlanFileName
+}
+
+// scanJobPlans reads the headers of all the plan files in the plan folder, grouped by job, without resurrecting the jobs.
+// The files are mapped read-only, so jobs that are running in another azcopy process are included too.
+func (ja *jobsAdmin) scanJobPlans() map[common.JobID]*jobPlans {
+	jobs := make(map[common.JobID]*jobPlans)
+
+	for _, fileInfo := range ja.planFilesInFolder("") {
+		planFile := JobPartPlanFileName(fileInfo.Name())
+		jobID, partNum, _ := planFile.Parse()
+
+		summary, command, err := readJobPartPlanFile(planFile, fileInfo.Size())
+		if os.IsNotExist(err) {
+			continue // deleted since it was listed, e.g. by another azcopy process that shares the plan folder
+		}
+
+		job, ok := jobs[jobID]
+		if !ok {
+			// the file's age stands in for the job's start time, in case part 0 can't be read
+			job = &jobPlans{details: common.JobIDDetails{JobId: jobID, StartTime: fileInfo.ModTime().UnixNano()}}
+			jobs[jobID] = job
+		}
+		job.planFiles = append(job.planFiles, planFile)
+
+		if err != nil {
+			job.unreadable = true
+			continue
+		}
+		job.details.NumTransfers += summary.NumTransfers
+		job.details.BytesTransferred += summary.BytesTransferred
+		if partNum == 0 {
+			// the status of the whole job is kept in part 0
+			job.part0 = &summary
+			job.details.JobStatus = summary.JobStatus
+			job.details.StartTime = summary.StartTime
+			job.details.CommandString = command
+			job.details.ElapsedSeconds = summary.ElapsedTime.Seconds()
+		}
+	}
+
+	for _, job := range jobs {
+		if job.unreadable || job.part0 == nil {
+			job.details.JobStatus = common.EJobStatus.Unknown()
+			job.details.NumTransfers = 0 // a partial count would be misleading
+			job.details.BytesTransferred = 0
+		}
+	}
+	return jobs
+}
+
+// ListJobPlans reads the job details straight from the plan files, newest first.
+// A job with any plan file that can't be read is still listed, with an Unknown status.
+func (ja *jobsAdmin) ListJobPlans() []common.JobIDDetails {
+	jobs := ja.scanJobPlans()
+	result := make([]common.JobIDDetails, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.details)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartTime > result[j].StartTime })
+	return result
+}
+
+// WalkJobTransfers streams the transfers of the given job to visit, in order of part number.
+// The plan files are mapped read-only, one at a time, so the job needn't be resurrected (it may even be running in another azcopy process),
+// and memory use doesn't grow with the number of transfers in the job.
+// Walking stops at the first error, including any returned by visit.
+func (ja *jobsAdmin) WalkJobTransfers(jobID common.JobID, ofStatus common.TransferStatus, visit func(common.TransferDetail) error) error {
+	files, err := ja.jobPlanFiles(jobID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := walkJobPartPlanTransfers(JobPartPlanFileName(file.Name()), file.Size(), ofStatus, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planFilesInFolder lists the plan files of the current schema version whose names start with the given prefix (e.g. a job ID).
+// Only the top level of the plan folder is listed, since that's where plan files are mapped from. The folder may be shared by several
+// azcopy processes, so anything other than our own plan files is ignored (e.g. the temporary files of plans still being written), and so
+// are files that have gone by the time they are examined.
+func (ja *jobsAdmin) planFilesInFolder(prefix string) []os.FileInfo {
+	return ja.planFilesWithSuffix(prefix, "")
+}
+
+// planFilesWithSuffix is planFilesInFolder for the plan files whose names have the given suffix after their usual name,
+// e.g. jobPartPlanTempFileSuffix for those that are still being written
+func (ja *jobsAdmin) planFilesWithSuffix(prefix string, suffix string) []os.FileInfo {
+	folder, err := os.Open(ja.planDir)
+	if err != nil {
+		return nil
+	}
+	names, _ := folder.Readdirnames(-1)
+	_ = folder.Close()
+
+	var files []os.FileInfo
+	ext := fmt.Sprintf(".steV%d", DataSchemaVersion) + suffix
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, _, err := JobPartPlanFileName(strings.TrimSuffix(name, suffix)).Parse(); err != nil {
+			continue
+		}
+		fileInfo, err := os.Lstat(filepath.Join(ja.planDir, name))
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, fileInfo)
+	}
+	return files
+}
+
+// JobPlanRecovery is what RecoverJobPlan did with the plan files of a job that azcopy was stopped in the middle of creating
+type JobPlanRecovery struct {
+	// Recovered are the parts whose plan files had been written in full, so were given their real names
+	Recovered []common.PartNumber
+	// Discarded are the parts whose plan files were incomplete, so were deleted
+	Discarded []common.PartNumber
+	// InUse are the parts whose plan files changed too recently to be sure they aren't still being written (e.g. by another azcopy
+	// process that is ordering the job), so were left alone
+	InUse []common.PartNumber
+}
+
+// Corrupt returns whether any of the job's plan files were discarded. The job was never ordered completely then, so it can't be resumed.
+func (r JobPlanRecovery) Corrupt() bool {
+	return len(r.Discarded) > 0
+}
+
+// RecoverJobPlan deals with the plan files of the given job that are still under their temporary names, because azcopy was stopped
+// after it started writing them, but before it renamed them. The header of a plan file is written last, so one whose header is in place
+// is complete, and is given its real name; the others are deleted, since what they were to hold is unknown.
+// The plan folder may be shared by several azcopy processes, so a file that changed within jobPartPlanTempFileMaxAge may still be
+// being written, and is left alone (see InUse).
+func (ja *jobsAdmin) RecoverJobPlan(jobID common.JobID) JobPlanRecovery {
+	return ja.recoverJobPlan(jobID, time.Now())
+}
+
+func (ja *jobsAdmin) recoverJobPlan(jobID common.JobID, now time.Time) JobPlanRecovery {
+	var recovery JobPlanRecovery
+	tempFiles := ja.planFilesWithSuffix(jobID.String(), jobPartPlanTempFileSuffix)
+	sort.Slice(tempFiles, func(i, j int) bool { return tempFiles[i].Name() < tempFiles[j].Name() }) // part numbers are zero-padded
+
+	for _, tempFile := range tempFiles {
+		tempPlanFile := JobPartPlanFileName(tempFile.Name())
+		planFile := JobPartPlanFileName(strings.TrimSuffix(tempFile.Name(), jobPartPlanTempFileSuffix))
+		_, partNum, _ := planFile.Parse()
+
+		if now.Sub(tempFile.ModTime()) < jobPartPlanTempFileMaxAge {
+			recovery.InUse = append(recovery.InUse, partNum)
+			continue
+		}
+		if _, err := os.Lstat(planFile.GetJobPartPlanPath()); err == nil {
+			// the plan file was written since, so this is just left over
+			_ = os.Remove(tempPlanFile.GetJobPartPlanPath())
+			continue
+		}
+
+		err := checkJobPartPlanFile(tempPlanFile, tempFile.Size())
+		if err == nil {
+			if err = os.Rename(tempPlanFile.GetJobPartPlanPath(), planFile.GetJobPartPlanPath()); err == nil {
+				recovery.Recovered = append(recovery.Recovered, partNum)
+				continue
+			}
+		}
+		ja.LogToJobLog(fmt.Sprintf("discarding the plan file of part %d of job %s, since it was not written in full: %v", partNum, jobID, err), pipeline.LogWarning)
+		if err = os.Remove(tempPlanFile.GetJobPartPlanPath()); err != nil && !os.IsNotExist(err) {
+			ja.LogToJobLog(fmt.Sprintf("failed to delete the incomplete plan file %s: %v", string(tempPlanFile), err), pipeline.LogWarning)
+		}
+		recovery.Discarded = append(recovery.Discarded, partNum)
+	}
+	return recovery
+}
+
+// jobPlanFiles returns the plan files of the given job, in order of part number
+func (ja *jobsAdmin) jobPlanFiles(jobID common.JobID) ([]os.FileInfo, error) {
+	files := ja.planFilesInFolder(jobID.String())
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no job with JobId %v exists", jobID)
+	}
+	sort.Sort(sortPlanFiles{Files: files})
+	return files, nil
+}
+
+// FollowJobProgress reads the progress of the given job from its plan files every interval, and calls emit whenever it has changed
+// (and always on the first read), until the job is done or ctx is cancelled.
+// Like WalkJobTransfers, it maps the plan files read-only, so the job may be running in another azcopy process.
+// Parts that can't be read yet, e.g. because they are still being written, are picked up by a later read; only part 0 must be readable.
+func (ja *jobsAdmin) FollowJobProgress(ctx context.Context, jobID common.JobID, interval time.Duration, emit func(common.JobProgressUpdate)) error {
+	statuses := make(map[common.PartNumber][]common.TransferStatus)
+	var last *common.JobProgressUpdate
+	for {
+		files, err := ja.jobPlanFiles(jobID)
+		if err != nil {
+			return err
+		}
+
+		update := common.JobProgressUpdate{Timestamp: time.Now().UTC(), JobID: jobID, ChangedTransfers: []common.TransferDetail{}}
+		var changed func(common.TransferDetail)
+		if last != nil {
+			changed = func(t common.TransferDetail) { update.ChangedTransfers = append(update.ChangedTransfers, t) }
+		}
+		for _, file := range files {
+			planFile := JobPartPlanFileName(file.Name())
+			_, partNum, _ := planFile.Parse()
+			progress, err := readJobPartProgress(planFile, file.Size(), statuses[partNum], changed)
+			if err != nil {
+				if partNum == 0 {
+					return err
+				}
+				continue
+			}
+			if partNum == 0 {
+				update.JobStatus = progress.jobStatus
+			}
+			statuses[partNum] = progress.statuses
+			update.BytesTransferred += progress.bytesTransferred
+			update.TotalBytesPlanned += progress.totalBytes
+			update.BytesCompleted += progress.bytesCompleted
+			for _, ts := range progress.statuses {
+				update.TotalTransfers++
+				switch {
+				case ts == common.ETransferStatus.Success():
+					update.TransfersCompleted++
+				case ts.DidFail():
+					update.TransfersFailed++
+				case ts.WasSkipped():
+					update.TransfersSkipped++
+				}
+			}
+		}
+
+		if last != nil && update.BytesTransferred > last.BytesTransferred {
+			update.BytesTransferredDelta = update.BytesTransferred - last.BytesTransferred
+		}
+		update.BytesPercentComplete = bytesPercentComplete(update.BytesCompleted, update.TotalBytesPlanned)
+		isDone := update.JobStatus.IsJobDone()
+		if last == nil || isDone || len(update.ChangedTransfers) > 0 || update.BytesTransferredDelta > 0 ||
+			update.BytesCompleted != last.BytesCompleted || update.JobStatus != last.JobStatus || update.TotalTransfers != last.TotalTransfers {
+			emit(update)
+		}
+		if isDone {
+			return nil
+		}
+		last = &update
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeleteExpiredJobPlans deletes the plan files of every job that finished longer ago than its time to live, and returns those jobs.
+// Jobs that haven't finished are left alone, and so are jobs that this process has loaded, or whose plan files can't all be read.
+// Plan files that were left under their temporary names by an azcopy process that was stopped are recovered or deleted first
+// (see RecoverJobPlan), so they don't pile up in the plan folder.
+func (ja *jobsAdmin) DeleteExpiredJobPlans(now time.Time) []common.JobID {
+	ja.sweepJobPlanTempFiles(now)
+
+	var deleted []common.JobID
+	for jobID, job := range ja.scanJobPlans() {
+		if !job.details.JobStatus.IsJobDone() {
+			continue // including jobs that are still in progress, and those we know nothing about
+		}
+		if job.part0.TTLAfterCompletion == 0 || job.part0.CompletionTime.IsZero() ||
+			now.Before(job.part0.CompletionTime.Add(job.part0.TTLAfterCompletion)) {
+			continue
+		}
+		if _, loaded := ja.JobMgr(jobID); loaded {
+			continue // e.g. it's being resumed
+		}
+
+		for _, planFile := range job.planFiles {
+			if err := os.Remove(planFile.GetJobPartPlanPath()); err != nil && !os.IsNotExist(err) {
+				ja.LogToJobLog(fmt.Sprintf("failed to delete expired plan file %s: %v", string(planFile), err), pipeline.LogWarning)
+			}
+		}
+		deleted = append(deleted, jobID)
+	}
+	return deleted
+}
+
+// sweepJobPlanTempFiles runs RecoverJobPlan for every job that has a plan file that has been under its temporary name for too long
+// to still be being written
+func (ja *jobsAdmin) sweepJobPlanTempFiles(now time.Time) {
+	stale := make(map[common.JobID]bool)
+	for _, tempFile := range ja.planFilesWithSuffix("", jobPartPlanTempFileSuffix) {
+		if now.Sub(tempFile.ModTime()) < jobPartPlanTempFileMaxAge {
+			continue
+		}
+		jobID, _, _ := JobPartPlanFileName(strings.TrimSuffix(tempFile.Name(), jobPartPlanTempFileSuffix)).Parse()
+		stale[jobID] = true
+	}
+	for jobID := range stale {
+		recovery := ja.recoverJobPlan(jobID, now)
+		for _, partNum := range recovery.Recovered {
+			ja.LogToJobLog(fmt.Sprintf("recovered the plan file of part %d of job %s, which azcopy was stopped before finishing", partNum, jobID), pipeline.LogWarning)
+		}
+	}
+}
+
+// StartJobPlanReaper deletes expired job plan files (see DeleteExpiredJobPlans) now, and then every interval for as long as the app runs
+func (ja *jobsAdmin) StartJobPlanReaper(interval time.Duration) {
+	reap := func() {
+		for _, jobID := range ja.DeleteExpiredJobPlans(time.Now()) {
+			ja.LogToJobLog(fmt.Sprintf("deleted the plan files of job %s, since its time to live has passed", jobID), pipeline.LogInfo)
+		}
+	}
+	reap()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ja.appCtx.Done():
+				return
+			case <-ticker.C:
+				reap()
+			}
+		}
+	}()
+}
+
 // TODO: I think something is wrong here: I think delete and cleanup should be merged together.
 // DeleteJobInfo api deletes an entry of given JobId the JobsInfo
 // TODO: add the clean up logic for all Jobparts.
@@ -723,6 +1083,105 @@ func (ja *jobsAdmin) Log(level pipeline.LogLevel, msg string) { ja.logger.Log(le
 func (ja *jobsAdmin) Panic(err error)                         { ja.logger.Panic(err) }
 func (ja *jobsAdmin) CloseLog()                               { ja.logger.CloseLog() }
 
+func (ja *jobsAdmin) SetBandwidthCap(megaBitsPerSec float64) {
+	ja.bandwidthScheduleMu.Lock()
+	defer ja.bandwidthScheduleMu.Unlock()
+	if ja.bandwidthScheduler != nil {
+		ja.LogToJobLog(fmt.Sprintf("Bandwidth cap outside the windows of the bandwidth schedule changed to %v Mbps (0 means no cap)", megaBitsPerSec), pipeline.LogInfo)
+		ja.bandwidthScheduler.setBaseCap(megaBitsPerSec)
+		return
+	}
+	ja.pacer.setTargetBytesPerSecond(megaBitsToBytesPerSecond(megaBitsPerSec))
+	ja.LogToJobLog(fmt.Sprintf("Bandwidth cap changed to %v Mbps (0 means no cap)", megaBitsPerSec), pipeline.LogInfo)
+}
+
+func (ja *jobsAdmin) BandwidthCap() float64 {
+	return float64(ja.pacer.targetBytesPerSecond()) * 8 / (1000 * 1000)
+}
+
+func (ja *jobsAdmin) SetDirectionalBandwidthCap(direction common.TransferDirection, megaBitsPerSec float64) {
+	ja.directionPacer(direction).setTargetBytesPerSecond(megaBitsToBytesPerSecond(megaBitsPerSec))
+	ja.LogToJobLog(fmt.Sprintf("Bandwidth cap for %s changed to %v Mbps (0 means no cap)", strings.ToLower(direction.String()), megaBitsPerSec), pipeline.LogInfo)
+}
+
+func (ja *jobsAdmin) DirectionalBandwidthCap(direction common.TransferDirection) float64 {
+	return float64(ja.directionPacer(direction).targetBytesPerSecond()) * 8 / (1000 * 1000)
+}
+
+func (ja *jobsAdmin) directionPacer(direction common.TransferDirection) *tokenBucketPacer {
+	switch direction {
+	case common.ETransferDirection.Upload():
+		return ja.uploadPacer
+	case common.ETransferDirection.Download():
+		return ja.downloadPacer
+	default:
+		panic(fmt.Sprintf("there is no separate bandwidth cap for direction %v", direction))
+	}
+}
+
+// pacerFor returns the pacer for the chunks of a job part with the given fromTo. Uploads and downloads are paced by
+// the cap of their own direction as well as the aggregate cap. Service to service copies don't pass through this
+// machine in either direction, so only the aggregate cap applies to them.
+func (ja *jobsAdmin) pacerFor(fromTo common.FromTo) pacer {
+	var direction *tokenBucketPacer
+	switch {
+	case fromTo.IsUpload():
+		direction = ja.uploadPacer
+	case fromTo.IsDownload():
+		direction = ja.downloadPacer
+	}
+	if direction == nil {
+		return ja.pacer
+	}
+	return newDirectionalPacer(direction, ja.pacer)
+}
+
+func (ja *jobsAdmin) StartBandwidthSchedule(jobID common.JobID, schedule common.BandwidthSchedule) {
+	ja.startBandwidthSchedule(jobID, schedule, wallClock{})
+}
+
+func (ja *jobsAdmin) startBandwidthSchedule(jobID common.JobID, schedule common.BandwidthSchedule, clock schedulerClock) {
+	ja.bandwidthScheduleMu.Lock()
+	defer ja.bandwidthScheduleMu.Unlock()
+	baseCap := ja.BandwidthCap()
+	if ja.bandwidthScheduler != nil {
+		// the cap in force now may be one of the old schedule's
+		baseCap = ja.bandwidthScheduler.getBaseCap()
+		ja.bandwidthScheduler.stop()
+	}
+	ja.LogToJobLog(fmt.Sprintf("Bandwidth schedule %s started for JobID=%v", schedule, jobID), pipeline.LogInfo)
+	ja.bandwidthScheduler = newBandwidthScheduler(jobID, schedule, baseCap, clock, func(mbps float64, inWindow bool) {
+		ja.pacer.setTargetBytesPerSecond(megaBitsToBytesPerSecond(mbps))
+		if inWindow {
+			ja.LogToJobLog(fmt.Sprintf("Bandwidth schedule changed the cap to %v Mbps (0 means no cap)", mbps), pipeline.LogInfo)
+		} else {
+			ja.LogToJobLog(fmt.Sprintf("Bandwidth schedule is outside its windows, so the cap is %v Mbps (0 means no cap)", mbps), pipeline.LogInfo)
+		}
+	})
+	ja.bandwidthScheduler.start()
+}
+
+func (ja *jobsAdmin) StopBandwidthSchedule(jobID common.JobID) {
+	ja.bandwidthScheduleMu.Lock()
+	defer ja.bandwidthScheduleMu.Unlock()
+	if ja.bandwidthScheduler == nil || ja.bandwidthScheduler.jobID != jobID {
+		return
+	}
+	ja.bandwidthScheduler.stop()
+	baseCap := ja.bandwidthScheduler.getBaseCap()
+	ja.bandwidthScheduler = nil
+	ja.pacer.setTargetBytesPerSecond(megaBitsToBytesPerSecond(baseCap))
+	ja.LogToJobLog(fmt.Sprintf("Bandwidth schedule stopped, so the cap is %v Mbps (0 means no cap)", baseCap), pipeline.LogInfo)
+}
+
+// megaBitsToBytesPerSecond uses the "networking mega" (based on powers of 10, not powers of 2, since that's what mega means in networking context)
+func megaBitsToBytesPerSecond(megaBitsPerSec float64) int64 {
+	if megaBitsPerSec <= 0 {
+		return 0
+	}
+	return int64(megaBitsPerSec * 1000 * 1000 / 8)
+}
+
 func (ja *jobsAdmin) CurrentMainPoolSize() int {
 	return int(atomic.LoadInt32(&ja.atomicCurrentMainPoolSize))
 }
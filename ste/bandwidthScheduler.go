@@ -0,0 +1,140 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// maxBandwidthScheduleWait is the longest that a bandwidthScheduler waits before checking the time again. It bounds how late a
+// change of cap can be if the wall clock jumps, e.g. after the machine has slept or the clocks have gone forward.
+const maxBandwidthScheduleWait = 5 * time.Minute
+
+// schedulerClock tells the time to a bandwidthScheduler, so that tests can control it
+type schedulerClock interface {
+	Now() time.Time
+	// At returns a channel that receives once it is time t or later
+	At(t time.Time) <-chan time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) At(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
+
+// bandwidthScheduler sets the bandwidth cap as the windows of a schedule start and end, until it is stopped.
+// Outside the windows, the cap is the base cap, i.e. the one that would apply if there were no schedule.
+type bandwidthScheduler struct {
+	jobID    common.JobID // the job whose run the schedule lasts for
+	schedule common.BandwidthSchedule
+	clock    schedulerClock
+	setCap   func(mbps float64, inWindow bool)
+	done     chan struct{}
+
+	mu         sync.Mutex
+	baseCap    float64
+	stopped    bool
+	applied    bool
+	appliedCap float64
+}
+
+func newBandwidthScheduler(jobID common.JobID, schedule common.BandwidthSchedule, baseCap float64, clock schedulerClock, setCap func(mbps float64, inWindow bool)) *bandwidthScheduler {
+	return &bandwidthScheduler{
+		jobID:    jobID,
+		schedule: schedule,
+		clock:    clock,
+		setCap:   setCap,
+		done:     make(chan struct{}),
+		baseCap:  baseCap,
+	}
+}
+
+// start applies the cap for the current time, then keeps applying it as it changes until stop is called
+func (s *bandwidthScheduler) start() {
+	go s.run(s.apply())
+}
+
+// stop ends the schedule. Once it returns, the scheduler won't set the cap again.
+func (s *bandwidthScheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+}
+
+// run waits for each change after the time that the cap was last checked at, so that none is missed however the goroutine is scheduled
+func (s *bandwidthScheduler) run(checkedAt time.Time) {
+	for {
+		wakeAt := checkedAt.Add(maxBandwidthScheduleWait)
+		if next := s.schedule.NextChange(checkedAt); next.Before(wakeAt) {
+			wakeAt = next
+		}
+		select {
+		case <-s.done:
+			return
+		case <-s.clock.At(wakeAt):
+			checkedAt = s.apply()
+		}
+	}
+}
+
+// apply sets the cap for the current time, if it differs from the one last set, and returns the time that it checked
+func (s *bandwidthScheduler) apply() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	if s.stopped {
+		return now
+	}
+	mbps, inWindow := s.schedule.CapAt(now)
+	if !inWindow {
+		mbps = s.baseCap
+	}
+	if !s.applied || mbps != s.appliedCap {
+		s.applied, s.appliedCap = true, mbps
+		s.setCap(mbps, inWindow)
+	}
+	return now
+}
+
+// setBaseCap changes the cap that applies outside the windows, applying it at once if the current time is outside them
+func (s *bandwidthScheduler) setBaseCap(mbps float64) {
+	s.mu.Lock()
+	s.baseCap = mbps
+	s.mu.Unlock()
+	s.apply()
+}
+
+func (s *bandwidthScheduler) getBaseCap() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.baseCap
+}
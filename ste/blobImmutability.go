@@ -0,0 +1,195 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// immutabilityServiceVersion is the first service version with immutability policies and legal holds on individual blobs.
+// The blob SDK we use is older than that, so the requests for them are made here, directly on the pipeline.
+const immutabilityServiceVersion = "2020-10-02"
+
+const (
+	immutabilityPolicyUntilDateHeader = "x-ms-immutability-policy-until-date"
+	immutabilityPolicyModeHeader      = "x-ms-immutability-policy-mode"
+	legalHoldHeader                   = "x-ms-legal-hold"
+)
+
+// immutabilityUnsupportedErrorCodes are the error codes with which the service refuses immutability policies and legal holds
+// on blobs of accounts and containers that don't allow them: services that predate them don't know the request,
+// and containers without version-level immutability reject it
+var immutabilityUnsupportedErrorCodes = map[string]bool{
+	"InvalidQueryParameterValue": true,
+	"UnsupportedQueryParameter":  true,
+	"VersionLevelWormNotEnabled": true,
+}
+
+// immutabilityError is returned when the service refuses a request about immutability
+type immutabilityError struct {
+	statusCode int
+	errorCode  string
+}
+
+func (e *immutabilityError) Error() string {
+	return fmt.Sprintf("the service refused the request with status %d (%s)", e.statusCode, e.errorCode)
+}
+
+// isImmutabilityUnsupported says whether an error means that the destination account or container doesn't allow immutability policies
+// or legal holds on its blobs
+func isImmutabilityUnsupported(err error) bool {
+	e, ok := err.(*immutabilityError)
+	return ok && immutabilityUnsupportedErrorCodes[e.errorCode]
+}
+
+// immutabilityFromHeaders reads the immutability policy and legal hold from the headers of the response to a Get Blob Properties request
+func immutabilityFromHeaders(h http.Header) (b common.BlobImmutability, err error) {
+	if v := h.Get(immutabilityPolicyUntilDateHeader); v != "" {
+		if b.PolicyExpiresOn, err = time.Parse(time.RFC1123, v); err != nil {
+			return common.BlobImmutability{}, fmt.Errorf("could not read the expiry of the immutability policy: %w", err)
+		}
+		if err = b.PolicyMode.Parse(h.Get(immutabilityPolicyModeHeader)); err != nil {
+			return common.BlobImmutability{}, fmt.Errorf("could not read the mode of the immutability policy: %w", err)
+		}
+	}
+	if v := h.Get(legalHoldHeader); v != "" {
+		if b.LegalHold, err = strconv.ParseBool(v); err != nil {
+			return common.BlobImmutability{}, fmt.Errorf("could not read the legal hold: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// newImmutabilityRequest creates a request for the blob, with the comp query parameter (if any) that selects the operation
+func newImmutabilityRequest(method string, blobURL url.URL, comp string) (pipeline.Request, error) {
+	if comp != "" {
+		if blobURL.RawQuery != "" {
+			blobURL.RawQuery += "&"
+		}
+		blobURL.RawQuery += "comp=" + comp
+	}
+	return pipeline.NewRequest(method, blobURL, nil)
+}
+
+// sendImmutabilityRequest sends the request at the service version that supports immutability, and returns the headers of the response
+func sendImmutabilityRequest(ctx context.Context, p pipeline.Pipeline, req pipeline.Request) (http.Header, error) {
+	resp, err := p.Do(context.WithValue(ctx, ServiceAPIVersionOverride, immutabilityServiceVersion), nil, req)
+	if err != nil {
+		return nil, err
+	}
+	r := resp.Response()
+	_, _ = io.Copy(ioutil.Discard, r.Body)
+	_ = r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, &immutabilityError{statusCode: r.StatusCode, errorCode: r.Header.Get("x-ms-error-code")}
+	}
+	return r.Header, nil
+}
+
+// GetBlobImmutability gets the immutability policy and legal hold of the blob
+func GetBlobImmutability(ctx context.Context, blobURL url.URL, p pipeline.Pipeline) (common.BlobImmutability, error) {
+	req, err := newImmutabilityRequest(http.MethodHead, blobURL, "")
+	if err != nil {
+		return common.BlobImmutability{}, err
+	}
+	h, err := sendImmutabilityRequest(ctx, p, req)
+	if err != nil {
+		return common.BlobImmutability{}, err
+	}
+	return immutabilityFromHeaders(h)
+}
+
+// setBlobImmutabilityPolicy gives the blob an immutability policy. The service only takes the expiry to the second.
+func setBlobImmutabilityPolicy(ctx context.Context, blobURL url.URL, p pipeline.Pipeline, expiresOn time.Time, mode common.ImmutabilityPolicyMode) error {
+	req, err := newImmutabilityRequest(http.MethodPut, blobURL, "immutabilityPolicies")
+	if err != nil {
+		return err
+	}
+	req.Header.Set(immutabilityPolicyUntilDateHeader, expiresOn.UTC().Format(http.TimeFormat))
+	req.Header.Set(immutabilityPolicyModeHeader, mode.String())
+	_, err = sendImmutabilityRequest(ctx, p, req)
+	return err
+}
+
+// setBlobLegalHold puts the blob under legal hold, or releases it
+func setBlobLegalHold(ctx context.Context, blobURL url.URL, p pipeline.Pipeline, hold bool) error {
+	req, err := newImmutabilityRequest(http.MethodPut, blobURL, "legalhold")
+	if err != nil {
+		return err
+	}
+	req.Header.Set(legalHoldHeader, strconv.FormatBool(hold))
+	_, err = sendImmutabilityRequest(ctx, p, req)
+	return err
+}
+
+// applyImmutability gives the destination blob the immutability policy and legal hold that it should have: those that the plan
+// recorded for the source, if they are preserved, unless the job gives all blobs a policy of its own. It is done last, once the blob
+// is known to be complete, since after that the blob may no longer be changed or deleted.
+// If the destination doesn't support immutability, a warning is logged and the transfer still succeeds.
+func applyImmutability(jptm IJobPartTransferMgr, p pipeline.Pipeline) {
+	info := jptm.Info()
+	var want common.BlobImmutability
+	if info.PreserveImmutability {
+		want = info.SrcImmutability
+	}
+	if !info.ImmutabilityPolicyExpiresOn.IsZero() {
+		want.PolicyExpiresOn = info.ImmutabilityPolicyExpiresOn
+		want.PolicyMode = info.ImmutabilityPolicyMode
+	}
+	if !want.HasPolicy() && !want.LegalHold {
+		return
+	}
+
+	dst, err := url.Parse(info.Destination)
+	if err != nil {
+		jptm.FailActiveSend("Parsing the destination URL", err)
+		return
+	}
+	if want.HasPolicy() {
+		err = setBlobImmutabilityPolicy(jptm.Context(), *dst, p, want.PolicyExpiresOn, want.PolicyMode)
+	}
+	if err == nil && want.LegalHold {
+		err = setBlobLegalHold(jptm.Context(), *dst, p, true)
+	}
+
+	if isImmutabilityUnsupported(err) {
+		jptm.GetImmutabilityWarning().Do(func() {
+			common.GetLifecycleMgr().Info("The destination does not support immutability policies or legal holds on its blobs, so they are not being set. " +
+				"Version-level immutability must be enabled on the destination container.")
+		})
+		if jptm.ShouldLog(pipeline.LogWarning) {
+			jptm.Log(pipeline.LogWarning, "Did not set the immutability policy or legal hold of the destination, which does not support them: "+err.Error())
+		}
+	} else if err != nil {
+		jptm.FailActiveSend("Setting the destination immutability policy", err)
+	}
+}
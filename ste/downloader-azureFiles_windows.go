@@ -21,6 +21,12 @@ import (
 
 // works for both folders and files
 func (*azureFilesDownloader) PutSMBProperties(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo) error {
+	return putLocalSMBProperties(sip, txInfo)
+}
+
+// putLocalSMBProperties gives the local file or folder at txInfo.Destination the SMB properties of its source.
+// It is shared by every downloader that implements smbPropertyAwareDownloader.
+func putLocalSMBProperties(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo) error {
 	propHolder, err := sip.GetSMBProperties()
 	if err != nil {
 		return fmt.Errorf("failed get SMB properties: %w", err)
@@ -90,6 +96,13 @@ var globalSetAclMu = &sync.Mutex{}
 
 // works for both folders and files
 func (a *azureFilesDownloader) PutSDDL(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo) error {
+	return putLocalSDDL(sip, txInfo, a.jptm.GetDestinationRoot(), a.parentIsShareRoot(txInfo.Source))
+}
+
+// putLocalSDDL gives the local file or folder at txInfo.Destination the SDDL of its source.
+// parentIsSourceRoot says whether the source's parent is the root of its share (or container), which has no permissions of its own.
+// It is shared by every downloader that implements smbPropertyAwareDownloader.
+func putLocalSDDL(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo, destRoot string, parentIsSourceRoot bool) error {
 	// Let's start by getting our SDDL and parsing it.
 	sddlString, err := sip.GetSDDL()
 	// TODO: be better at handling these errors.
@@ -118,7 +131,6 @@ func (a *azureFilesDownloader) PutSDDL(sip ISMBPropertyBearingSourceInfoProvider
 
 	// remove everything down to the if statement to return to xcopy functionality
 	// Obtain the destination root and figure out if we're at the top level of the transfer.
-	destRoot := a.jptm.GetDestinationRoot()
 	relPath, err := filepath.Rel(destRoot, txInfo.Destination)
 
 	if err != nil {
@@ -140,7 +152,7 @@ func (a *azureFilesDownloader) PutSDDL(sip ISMBPropertyBearingSourceInfoProvider
 	isProtectedAtSource := (ctl & windows.SE_DACL_PROTECTED) != 0
 	isAtTransferRoot := len(splitPath) == 1
 
-	if isProtectedAtSource || isAtTransferRoot || a.parentIsShareRoot(txInfo.Source) {
+	if isProtectedAtSource || isAtTransferRoot || parentIsSourceRoot {
 		securityInfoFlags |= windows.PROTECTED_DACL_SECURITY_INFORMATION
 	}
 
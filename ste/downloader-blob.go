@@ -30,6 +30,8 @@ import (
 )
 
 type blobDownloader struct {
+	jptm IJobPartTransferMgr
+
 	// filePacer is necessary because page blobs have per-blob throughput limits. The limits depend on
 	// what type of page blob it is (e.g. premium) and can be significantly lower than the blob account limit.
 	// Using a automatic pacer here lets us find the right rate for this particular page blob, at which
@@ -48,6 +50,8 @@ func newBlobDownloader() downloader {
 }
 
 func (bd *blobDownloader) Prologue(jptm IJobPartTransferMgr, srcPipeline pipeline.Pipeline) {
+	bd.jptm = jptm
+
 	if jptm.Info().SrcBlobType == azblob.BlobPageBlob {
 		// page blobs need a file-specific pacer
 		// See comments in uploader-pageBlob for the reasons, since the same reasons apply are are explained there
@@ -64,6 +68,12 @@ func (bd *blobDownloader) Epilogue() {
 	_ = bd.filePacer.Close()
 }
 
+// SetFolderProperties is a no-op. The only blob folders are the marker blobs of directories (see common.FolderMarkerMetadataKey),
+// and the directory that stands for one has nothing more to restore.
+func (bd *blobDownloader) SetFolderProperties(jptm IJobPartTransferMgr) error {
+	return nil
+}
+
 // Returns a chunk-func for blob downloads
 func (bd *blobDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, srcPipeline pipeline.Pipeline, destWriter common.ChunkedFileWriter, id common.ChunkID, length int64, pacer pacer) chunkFunc {
 	return createDownloadChunkFunc(jptm, id, func() {
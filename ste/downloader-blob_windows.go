@@ -0,0 +1,32 @@
+// +build windows
+
+package ste
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// This file implements the windows-triggered smbPropertyAwareDownloader interface, for blobs that were
+// uploaded with their SMB properties in their metadata. See smbPropertiesMetadata.go.
+
+func (bd *blobDownloader) PutSMBProperties(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo) error {
+	return putLocalSMBProperties(sip, txInfo)
+}
+
+func (bd *blobDownloader) PutSDDL(sip ISMBPropertyBearingSourceInfoProvider, txInfo TransferInfo) error {
+	return putLocalSDDL(sip, txInfo, bd.jptm.GetDestinationRoot(), bd.parentIsContainerRoot(txInfo.Source))
+}
+
+// parentIsContainerRoot is the Blob equivalent of azureFilesDownloader.parentIsShareRoot. Containers have no permissions,
+// so a blob directly in one must have its own permissions protected, just like the top-level files in a share.
+func (bd *blobDownloader) parentIsContainerRoot(source string) bool {
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	blobName := strings.Trim(azblob.NewBlobURLParts(*u).BlobName, "/")
+	return blobName != "" && !strings.Contains(blobName, "/")
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// destinationHashMatchesSource reports whether the destination blob already holds the data of the source, judged by comparing the
+// hash (of the job's ChecksumAlgorithm) stored on the blob with that of the source. Local sources are hashed here, unless an earlier run of the job
+// already recorded their hash in the plan file, and they haven't changed since. The hash is recorded in the plan so that resuming the job
+// does not have to read the file again.
+// Remote sources are judged by the hash they have stored against their data, if any.
+func destinationHashMatchesSource(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pipeline, sip ISourceInfoProvider) (bool, error) {
+	algorithm := jptm.ChecksumAlgorithm()
+
+	destURL, err := url.Parse(info.Destination)
+	if err != nil {
+		return false, err
+	}
+	props, err := azblob.NewBlobURL(*destURL, p).GetProperties(jptm.Context(), azblob.BlobAccessConditions{})
+	if err != nil {
+		if stgErr, ok := err.(azblob.StorageError); ok && stgErr.Response().StatusCode == http.StatusNotFound {
+			return false, nil // nothing to compare with
+		}
+		return false, err
+	}
+
+	// blobs of a different size can't hold the same data, so don't waste time hashing the source
+	if props.ContentLength() != info.SourceSize {
+		return false, nil
+	}
+	destHash := storedHash(props.ContentMD5(), common.FromAzBlobMetadataToCommonMetadata(props.NewMetadata()), algorithm)
+	if len(destHash) == 0 {
+		return false, nil
+	}
+
+	var srcHash []byte
+	if sip.IsLocal() {
+		lastModifiedTime, size, err := freshSourceState(jptm, sip)
+		if err != nil {
+			return false, err
+		}
+		if size != info.SourceSize {
+			return false, nil // it has changed since it was enumerated, so will be sent (and the change noticed) as usual
+		}
+		srcHash = jptm.ContentDigestFor(lastModifiedTime, size)
+		if srcHash == nil {
+			srcHash, err = hashLocalSource(sip.(ILocalSourceInfoProvider), size, algorithm)
+			if err != nil {
+				return false, err
+			}
+			jptm.SetContentDigest(srcHash, lastModifiedTime, size)
+		}
+	} else {
+		srcProps, err := sip.Properties()
+		if err != nil {
+			return false, err
+		}
+		srcHash = storedHash(srcProps.SrcHTTPHeaders.ContentMD5, srcProps.SrcMetadata, algorithm)
+	}
+
+	return len(srcHash) > 0 && bytes.Equal(srcHash, destHash), nil
+}
+
+// hashLocalSource reads the whole of the source file, and returns its hash
+func hashLocalSource(sip ILocalSourceInfoProvider, size int64, algorithm common.HashAlgorithm) ([]byte, error) {
+	file, err := sip.OpenSourceFile()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := algorithm.NewHasher()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, size)); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
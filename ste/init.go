@@ -24,9 +24,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -49,6 +51,14 @@ func ToFixed(num float64, precision int) float64 {
 	return float64(round(num*output)) / output
 }
 
+// bytesPercentComplete returns completed as a percentage of total. A job with nothing to transfer is 100% complete.
+func bytesPercentComplete(completed, total uint64) float32 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float32(completed) / float32(total)
+}
+
 // MainSTE initializes the Storage Transfer Engine
 func MainSTE(concurrency ConcurrencySettings, targetRateInMegaBitsPerSec float64, azcopyJobPlanFolder, azcopyLogPathFolder string, providePerfAdvice bool) error {
 	// Initialize the JobsAdmin, resurrect Job plan files
@@ -138,10 +148,13 @@ func MainSTE(concurrency ConcurrencySettings, targetRateInMegaBitsPerSec float64
 
 // ExecuteNewCopyJobPartOrder api executes a new job part order
 func ExecuteNewCopyJobPartOrder(order common.CopyJobPartOrderRequest) common.CopyJobPartOrderResponse {
+	if err := checkChunksFitInBuffer(order, JobsAdmin.(*jobsAdmin).cacheLimiter); err != nil {
+		return common.CopyJobPartOrderResponse{JobStarted: false, ErrorMsg: common.CopyJobPartOrderErrorType(err.Error())}
+	}
 	// Get the file name for this Job Part's Plan
 	jppfn := JobsAdmin.NewJobPartPlanFileName(order.JobID, order.PartNum)
-	jppfn.Create(order)                                                                   // Convert the order to a plan file
-	jpm := JobsAdmin.JobMgrEnsureExists(order.JobID, order.LogLevel, order.CommandString) // Get a this job part's job manager (create it if it doesn't exist)
+	jppfn.Create(order)                                                                                    // Convert the order to a plan file
+	jpm := JobsAdmin.JobMgrEnsureExists(order.JobID, order.LogLevel, order.LogFormat, order.CommandString) // Get a this job part's job manager (create it if it doesn't exist)
 
 	if len(order.Transfers) == 0 && order.IsFinalPart {
 		/*
@@ -154,18 +167,63 @@ func ExecuteNewCopyJobPartOrder(order common.CopyJobPartOrderRequest) common.Cop
 	// Get credential info from RPC request order, and set in InMemoryTransitJobState.
 	jpm.setInMemoryTransitJobState(
 		InMemoryTransitJobState{
-			credentialInfo: order.CredentialInfo,
+			credentialInfo:   order.CredentialInfo,
+			sasTokenProvider: newSASTokenProvider(order.SASRefreshCommand),
+			transferOrder:    order.TransferOrder,
 		})
 	// Supply no plan MMF because we don't have one, and AddJobPart will create one on its own.
-	jpm.AddJobPart(order.PartNum, jppfn, nil, order.SourceRoot.SAS, order.DestinationRoot.SAS, true) // Add this part to the Job and schedule its transfers
+	// Dry-run parts are only planned, so they never reach the scheduler
+	jpm.AddJobPart(order.PartNum, jppfn, nil, order.SourceRoot.SAS, order.DestinationRoot.SAS, !order.DryRun) // Add this part to the Job and schedule its transfers
+	if order.DryRun && order.IsFinalPart {
+		completeDryRunJob(jpm)
+	}
 	return common.CopyJobPartOrderResponse{JobStarted: true}
 }
 
+// completeDryRunJob finishes a dry-run job once its last part has been planned, since none of its transfers will ever run.
+// Otherwise it would stay in progress forever: it would never expire, and would be picked up by whatever looks for running jobs.
+func completeDryRunJob(jm IJobMgr) {
+	if jpm, found := jm.JobPartMgr(0); found {
+		plan := jpm.Plan()
+		plan.SetJobStatus(common.EJobStatus.Completed())
+		plan.SetJobCompletionTime(time.Now())
+	}
+}
+
+// checkChunksFitInBuffer makes sure that every chunk of the order's uploads and downloads can be buffered in RAM.
+// Otherwise, a transfer would wait forever for room for its chunk.
+// Service-to-service copies don't pass their data through us, so their chunks don't need to fit.
+func checkChunksFitInBuffer(order common.CopyJobPartOrderRequest, cacheLimiter common.CacheLimiter) error {
+	if !order.FromTo.IsUpload() && !order.FromTo.IsDownload() {
+		return nil
+	}
+	var largestSource int64
+	for _, t := range order.Transfers {
+		if t.SourceSize > largestSource {
+			largestSource = t.SourceSize
+		}
+	}
+	// the block size grows with the size of the source, if the user didn't choose it
+	blockSize := computeBlockSize(order.BlobAttributes.BlockSizeInBytes, largestSource)
+	if order.FromTo.To() == common.ELocation.File() && blockSize > common.DefaultAzureFileChunkSize {
+		blockSize = common.DefaultAzureFileChunkSize // see newAzureFileSenderBase
+	}
+	if blockSize > cacheLimiter.StrictLimit() {
+		return fmt.Errorf("the block size of %d MiB is too large for the %.2f GiB that AzCopy may use to buffer data. Use a smaller block size, or raise the limit with the environment variable %s",
+			blockSize/(1024*1024), float64(cacheLimiter.Limit())/(1024*1024*1024), common.EEnvironmentVariable.BufferGB().Name)
+	}
+	return nil
+}
+
 // cancelpauseJobOrder api cancel/pause a job with given JobId
 /* A Job cannot be cancelled/paused in following cases
 	* If the Job has not been ordered completely it cannot be cancelled or paused
     * If all the transfers in the Job are either failed or completed, then Job cannot be cancelled or paused
-    * If a job is already paused, it cannot be paused again
+    * If a job is being cancelled, it cannot be paused
+   Pausing a job stops its transfers being dispatched, and stops those in flight too, after which they are recorded as paused.
+   What they have already saved is kept (e.g. staged blocks and the chunks of a partly downloaded file), so that resume carries
+   on from there. Since the status is kept in the plan file, the job stays paused until it is resumed (see ResumeJobOrder),
+   even if azcopy is restarted.
 */
 func CancelPauseJobOrder(jobID common.JobID, desiredJobStatus common.JobStatus) common.CancelPauseResumeResponse {
 	verb := common.IffString(desiredJobStatus == common.EJobStatus.Paused(), "pause", "cancel")
@@ -207,8 +265,19 @@ func CancelPauseJobOrder(jobID common.JobID, desiredJobStatus common.JobStatus)
 			ErrorMsg:              fmt.Sprintf("cannot cancel the job %s since it is already cancelled", jobID),
 		}
 	case common.EJobStatus.Cancelling():
+		if desiredJobStatus == common.EJobStatus.Paused() {
+			jr = common.CancelPauseResumeResponse{
+				CancelledPauseResumed: false,
+				ErrorMsg:              fmt.Sprintf("cannot pause the job %s since it is being cancelled", jobID),
+			}
+			break
+		}
 		// If the status of Job is cancelling, it means that it has already been requested for cancellation
-		// No need to cancel further
+		// No need to cancel further, except that a job which is stopping because it overran its maximum duration
+		// has left its in-flight transfers to finish. Stop them now, since cancellation has been asked for.
+		if desiredJobStatus == common.EJobStatus.Cancelling() {
+			jm.Cancel()
+		}
 		jr = common.CancelPauseResumeResponse{
 			CancelledPauseResumed: true,
 			ErrorMsg:              fmt.Sprintf("cannot cancel the job %s since it has already been requested for cancellation", jobID),
@@ -221,6 +290,9 @@ func CancelPauseJobOrder(jobID common.JobID, desiredJobStatus common.JobStatus)
 		// Job immediately stop.
 		fallthrough
 	case common.EJobStatus.Paused(): // Logically, It's OK to pause an already-paused job
+		if desiredJobStatus == common.EJobStatus.Cancelling() {
+			jpp0.SetCancelReason(common.EJobCancelReason.Requested())
+		}
 		jpp0.SetJobStatus(desiredJobStatus)
 		msg := fmt.Sprintf("JobID=%v %s", jobID,
 			common.IffString(desiredJobStatus == common.EJobStatus.Paused(), "paused", "canceled"))
@@ -237,6 +309,34 @@ func CancelPauseJobOrder(jobID common.JobID, desiredJobStatus common.JobStatus)
 	return jr
 }
 
+// CancelAllJobs api cancels every job that its plan files say is in progress, and returns which ones it cancelled.
+// That includes jobs being run by other azcopy processes: the status is shared through the plan file, and the engine running
+// a job starts no more of its transfers once it sees that the job is cancelling. Jobs run by this process also have their
+// in-flight chunks stopped. Each engine marks its job Cancelled once it has drained.
+// Jobs that are not in progress are left alone, so it is safe to call again, or when no jobs are running.
+func CancelAllJobs() common.CancelAllJobsResponse {
+	return cancelInProgressJobs(JobsAdmin.ListJobPlans(), func(jobID common.JobID) common.CancelPauseResumeResponse {
+		return CancelPauseJobOrder(jobID, common.EJobStatus.Cancelling())
+	})
+}
+
+func cancelInProgressJobs(jobs []common.JobIDDetails, cancel func(common.JobID) common.CancelPauseResumeResponse) common.CancelAllJobsResponse {
+	response := common.CancelAllJobsResponse{CancelledJobIDs: []common.JobID{}}
+	var failures []string
+	for _, job := range jobs {
+		if job.JobStatus != common.EJobStatus.InProgress() {
+			continue
+		}
+		if r := cancel(job.JobId); r.CancelledPauseResumed {
+			response.CancelledJobIDs = append(response.CancelledJobIDs, job.JobId)
+		} else {
+			failures = append(failures, fmt.Sprintf("job %s: %s", job.JobId, r.ErrorMsg))
+		}
+	}
+	response.ErrorMsg = strings.Join(failures, "; ")
+	return response
+}
+
 func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeResponse {
 	// Strip '?' if present as first character of the source sas / destination sas
 	if len(req.SourceSAS) > 0 && req.SourceSAS[0] == '?' {
@@ -245,6 +345,26 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 	if len(req.DestinationSAS) > 0 && req.DestinationSAS[0] == '?' {
 		req.DestinationSAS = req.DestinationSAS[1:]
 	}
+	// If azcopy was stopped while it was creating a plan file of the job, the file is either finished or
+	// discarded first. A job that lost a plan file that way was never ordered completely, so it cannot be resumed.
+	recovery := JobsAdmin.RecoverJobPlan(req.JobID)
+	for _, partNum := range recovery.Recovered {
+		JobsAdmin.LogToJobLog(fmt.Sprintf("recovered the plan file of part %d of job %s, which azcopy was stopped before finishing", partNum, req.JobID), pipeline.LogWarning)
+	}
+	if len(recovery.InUse) > 0 {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg: fmt.Sprintf("cannot resume job with JobId %s . The plan file of part %d is still being written, perhaps by another azcopy process. "+
+				"If no other azcopy process is ordering the job, try again in %v", req.JobID, recovery.InUse[0], jobPartPlanTempFileMaxAge),
+		}
+	}
+	if recovery.Corrupt() {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg: fmt.Sprintf("cannot resume job with JobId %s . Its plan is corrupt, since azcopy was stopped while writing the plan file of part %d, "+
+				"which could not be recovered", req.JobID, recovery.Discarded[0]),
+		}
+	}
 	// Always search the plan files in Azcopy folder,
 	// and resurrect the Job with provided credentials, to ensure SAS and etc get updated.
 	if !JobsAdmin.ResurrectJob(req.JobID, req.SourceSAS, req.DestinationSAS) {
@@ -270,6 +390,22 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 		}
 		return completeJobOrdered
 	}
+	// A dry-run job was never meant to move any data, so it cannot be resumed either
+	if jpm, found := jm.JobPartMgr(0); found && jpm.Plan().DryRun {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg:              fmt.Sprintf("cannot resume job with JobId %s . It was created as a dry run", req.JobID),
+		}
+	}
+	// A job that encrypts with a customer-provided key must be given the same key again
+	if jpm, found := jm.JobPartMgr(0); found {
+		if _, err := jpm.Plan().CpkInfo(); err != nil {
+			return common.CancelPauseResumeResponse{
+				CancelledPauseResumed: false,
+				ErrorMsg:              fmt.Sprintf("cannot resume job with JobId %s . %s", req.JobID, err),
+			}
+		}
+	}
 	// If the job has not been ordered completely, then job cannot be resumed
 	if !completeJobOrdered(jm) {
 		return common.CancelPauseResumeResponse{
@@ -286,42 +422,28 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 			ErrorMsg:              fmt.Sprintf("JobID=%v, Part#=0 not found", req.JobID),
 		}
 	}
-	// If the credential type is is Anonymous, to resume the Job destinationSAS / sourceSAS needs to be provided
-	// Depending on the FromType, sourceSAS or destinationSAS is checked.
-	if req.CredentialInfo.CredentialType == common.ECredentialType.Anonymous() {
-		var errorMsg = ""
-		switch jpm.Plan().FromTo {
-		case common.EFromTo.LocalBlob(),
-			common.EFromTo.LocalFile(),
-			common.EFromTo.S3Blob():
-			if len(req.DestinationSAS) == 0 {
-				errorMsg = "The destination-sas switch must be provided to resume the job"
-			}
-		case common.EFromTo.BlobLocal(),
-			common.EFromTo.FileLocal(),
-			common.EFromTo.BlobTrash(),
-			common.EFromTo.FileTrash():
-			if len(req.SourceSAS) == 0 {
-				errorMsg = "The source-sas switch must be provided to resume the job"
-			}
-		case common.EFromTo.BlobBlob(),
-			common.EFromTo.FileBlob():
-			if len(req.SourceSAS) == 0 ||
-				len(req.DestinationSAS) == 0 {
-				errorMsg = "Both the source-sas and destination-sas switches must be provided to resume the job"
-			}
-		}
-		if len(errorMsg) != 0 {
-			return common.CancelPauseResumeResponse{
-				CancelledPauseResumed: false,
-				ErrorMsg:              fmt.Sprintf("cannot resume job with JobId %s. %s", req.JobID, errorMsg),
-			}
+	// The source and the destination each need the SAS token they were started with, if they had one, whatever the other side uses
+	// (e.g. an S3 source has its own keys, and a destination may use Azure AD while its source has a SAS token)
+	if errorMsg := missingSASSwitches(jpm.Plan(), req.SourceSAS, req.DestinationSAS); errorMsg != "" {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg:              fmt.Sprintf("cannot resume job with JobId %s. %s", req.JobID, errorMsg),
 		}
 	}
 
 	// After creating the Job mgr, set the include / exclude list of transfer.
 	jm.SetIncludeExclude(req.IncludeTransfer, req.ExcludeTransfer)
 	jpp0 := jpm.Plan()
+
+	// Only in a finished job is every transfer known to have succeeded, been skipped, or failed.
+	// Otherwise, transfers that never ran would be left out, and the job could never complete.
+	if req.FailedOnly && !isJobCompleted(jpp0.JobStatus()) {
+		return common.CancelPauseResumeResponse{
+			CancelledPauseResumed: false,
+			ErrorMsg:              fmt.Sprintf("cannot resume only the failed transfers of job with JobId %s, since it has not finished (its status is %s)", req.JobID, jpp0.JobStatus()),
+		}
+	}
+
 	switch jpp0.JobStatus() {
 	// Cannot resume a Job which is in Cancelling state
 	// Cancelling is an intermediary state. The reason we accept and process it here, rather than returning an error,
@@ -344,30 +466,36 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 		// Get credential info from RPC request, and set in InMemoryTransitJobState.
 		jm.setInMemoryTransitJobState(
 			InMemoryTransitJobState{
-				credentialInfo: req.CredentialInfo,
+				credentialInfo:   req.CredentialInfo,
+				sasTokenProvider: newSASTokenProvider(req.SASRefreshCommand),
+				transferOrder:    req.TransferOrder,
 			})
 
 		jpp0.SetJobStatus(common.EJobStatus.InProgress())
+		jpp0.SetCancelReason(common.EJobCancelReason.None())
+		jpp0.SetJobCompletionTime(time.Time{}) // it mustn't be cleaned up while it runs again
 
 		if jm.ShouldLog(pipeline.LogInfo) {
 			jm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v resumed", req.JobID))
 		}
 
 		// Iterate through all transfer of the Job Parts and reset the transfer status
-		jm.(*jobMgr).jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
-			jpp := jpm.Plan()
-			// Iterate through this job part's transfers
-			for t := uint32(0); t < jpp.NumTransfers; t++ {
-				// transferHeader represents the memory map transfer header of transfer at index position for given job and part number
-				jppt := jpp.Transfer(t)
-				// If the transfer status is less than -1, it means the transfer failed because of some reason.
-				// Transfer Status needs to reset.
-				if jppt.TransferStatus() <= common.ETransferStatus.Failed() {
-					jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
-					jppt.SetErrorCode(0, true)
-				}
-			}
+		numRetried := 0
+		jm.(*jobMgr).jobPartMgrs.Iterate(true, func(_ common.PartNumber, jpm IJobPartMgr) {
+			numRetried += jpm.(*jobPartMgr).resetTransfersToResume(req.FailedOnly)
 		})
+		if req.FailedOnly && jm.ShouldLog(pipeline.LogInfo) {
+			jm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v resumed for its failed transfers only; %d will be retried", req.JobID, numRetried))
+		}
+
+		// the concurrency stored in the plan was applied when the job was resurrected; the resume command may override it
+		if req.Concurrency != 0 {
+			jm.SetTransferConcurrency(req.Concurrency)
+		}
+		// likewise for its data limit
+		if req.MaxTotalBytes != 0 {
+			jm.SetMaxTotalBytes(req.MaxTotalBytes)
+		}
 
 		jm.ResumeTransfers(steCtx) // Reschedule all job part's transfers
 		//}()
@@ -379,6 +507,34 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 	return jr
 }
 
+// missingSASSwitches says which of the SAS tokens that the job was started with have not been given again to resume it.
+// It returns an empty string if none are missing.
+func missingSASSwitches(plan *JobPartPlanHeader, sourceSAS string, destinationSAS string) string {
+	missingSource := plan.SourceSASRequired && sourceSAS == ""
+	missingDestination := plan.DestinationSASRequired && destinationSAS == ""
+	switch {
+	case missingSource && missingDestination:
+		return "Both the source-sas and destination-sas switches must be provided to resume the job"
+	case missingSource:
+		return "The source-sas switch must be provided to resume the job"
+	case missingDestination:
+		return "The destination-sas switch must be provided to resume the job"
+	}
+	return ""
+}
+
+// isJobCompleted returns whether the job ran to its end, as opposed to being cancelled or paused, or still running
+func isJobCompleted(status common.JobStatus) bool {
+	switch status {
+	case common.EJobStatus.Completed(),
+		common.EJobStatus.CompletedWithErrors(),
+		common.EJobStatus.CompletedWithSkipped(),
+		common.EJobStatus.CompletedWithErrorsAndSkipped():
+		return true
+	}
+	return false
+}
+
 // GetJobSummary api returns the job progress summary of an active job
 /*
 * Return following Properties in Job Progress Summary
@@ -425,18 +581,37 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 		panic(fmt.Errorf("error getting the 0th part of Job %s", jobID))
 	}
 	part0PlanStatus := part0.Plan().JobStatus()
+	js.CumulativeElapsedSeconds = part0.Plan().ElapsedTime().Seconds()
+
+	// track the transfer durations, for diagnostics
+	var totalDuration time.Duration
+	var numTimedTransfers int64
+	slowest := slowestTransfers{}
+	throughputs := throughputHistogram{}
 
 	// Now iterate and count things up
 	jm.(*jobMgr).jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
 		jpp := jpm.Plan()
 		js.CompleteJobOrdered = js.CompleteJobOrdered || jpp.IsFinalPart
 		js.TotalTransfers += jpp.NumTransfers
+		js.CumulativeBytesTransferred += jpp.BytesTransferred()
+		js.TotalBytesPlanned += jpp.TotalBytes
+		js.BytesCompleted += jpp.BytesCompleted()
 
 		// Iterate through this job part's transfers
 		for t := uint32(0); t < jpp.NumTransfers; t++ {
 			// transferHeader represents the memory map transfer header of transfer at index position for given job and part number
 			jppt := jpp.Transfer(t)
 			js.TotalBytesEnumerated += uint64(jppt.SourceSize)
+			js.TransferRetries += jppt.RetryCount()
+			if d, ok := jppt.Duration(); ok {
+				totalDuration += d
+				numTimedTransfers++
+				slowest.offer(jpp, t, d)
+				if jppt.EntityType == common.EEntityType.File() && jppt.TransferStatus() == common.ETransferStatus.Success() {
+					throughputs.add(jppt.SourceSize, d)
+				}
+			}
 
 			if jppt.EntityType == common.EEntityType.File() {
 				js.FileTransfers++
@@ -447,7 +622,15 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 			// check for all completed transfer to calculate the progress percentage at the end
 			switch jppt.TransferStatus() {
 			case common.ETransferStatus.NotStarted(),
-				common.ETransferStatus.Started():
+				common.ETransferStatus.Paused():
+				js.TotalBytesExpected += uint64(jppt.SourceSize)
+			case common.ETransferStatus.Started():
+				// count what the files in flight have done so far, to get a more accurate running total
+				js.TotalBytesTransferred += jppt.AttemptBytes()
+				js.TotalBytesExpected += uint64(jppt.SourceSize)
+			case common.ETransferStatus.Stalled():
+				js.TransfersStalled++
+				js.TotalBytesTransferred += jppt.AttemptBytes()
 				js.TotalBytesExpected += uint64(jppt.SourceSize)
 			case common.ETransferStatus.Success():
 				js.TransfersCompleted++
@@ -455,7 +638,9 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 				js.TotalBytesExpected += uint64(jppt.SourceSize)
 			case common.ETransferStatus.Failed(),
 				common.ETransferStatus.TierAvailabilityCheckFailure(),
-				common.ETransferStatus.BlobTierFailure():
+				common.ETransferStatus.BlobTierFailure(),
+				common.ETransferStatus.Corrupted(),
+				common.ETransferStatus.PreconditionFailed():
 				js.TransfersFailed++
 				// getting the source and destination for failed transfer at position - index
 				src, dst, isFolder := jpp.TransferSrcDstStrings(t)
@@ -466,9 +651,11 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 						Dst:                dst,
 						IsFolderProperties: isFolder,
 						TransferStatus:     common.ETransferStatus.Failed(),
-						ErrorCode:          jppt.ErrorCode()}) // TODO: Optimize
+						ErrorCode:          jppt.ErrorCode(),
+						ErrorMessage:       jpp.ErrorMessage(t)}) // TODO: Optimize
 			case common.ETransferStatus.SkippedEntityAlreadyExists(),
-				common.ETransferStatus.SkippedBlobHasSnapshots():
+				common.ETransferStatus.SkippedBlobHasSnapshots(),
+				common.ETransferStatus.ExceededMaxTotalBytes():
 				js.TransfersSkipped++
 				// getting the source and destination for skipped transfer at position - index
 				src, dst, isFolder := jpp.TransferSrcDstStrings(t)
@@ -483,14 +670,19 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 		}
 	})
 
-	// Add on byte count from files in flight, to get a more accurate running total
-	js.TotalBytesTransferred += JobsAdmin.SuccessfulBytesInActiveFiles()
+	if numTimedTransfers > 0 {
+		js.AverageTransferMilliseconds = (totalDuration / time.Duration(numTimedTransfers)).Milliseconds()
+	}
+	js.SlowestTransfers = slowest.details()
+	js.TransferThroughput = throughputs.percentiles()
+
 	if js.TotalBytesExpected == 0 {
 		// if no bytes expected, and we should avoid dividing by 0 (which results in NaN)
 		js.PercentComplete = 100
 	} else {
 		js.PercentComplete = 100 * float32(js.TotalBytesTransferred) / float32(js.TotalBytesExpected)
 	}
+	js.BytesPercentComplete = bytesPercentComplete(js.BytesCompleted, js.TotalBytesPlanned)
 
 	// This is added to let FE to continue fetching the Job Progress Summary
 	// in case of resume. In case of resume, the Job is already completely
@@ -519,9 +711,16 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 	// is the case.
 	if part0PlanStatus == common.EJobStatus.Cancelled() {
 		js.JobStatus = part0PlanStatus
+		js.CancelReason = part0.Plan().CancelReason()
 		js.PerformanceAdvice = jm.TryGetPerformanceAdvice(js.TotalBytesExpected, js.TotalTransfers-js.TransfersSkipped, part0.Plan().FromTo)
 		return js
 	}
+	// A paused job is only reported as such once its transfers in flight have finished and its plan files are up to date,
+	// so that whoever is waiting on it can then stop, and leave the job to be resumed
+	if part0PlanStatus == common.EJobStatus.Paused() && jm.(*jobMgr).runEnded() {
+		js.JobStatus = part0PlanStatus
+		return js
+	}
 	// Job is completed if Job order is complete AND ALL transfers are completed/failed
 	// FIX: active or inactive state, then job order is said to be completed if final part of job has been ordered.
 	if (js.CompleteJobOrdered) && (part0PlanStatus.IsJobDone()) {
@@ -535,58 +734,67 @@ func GetJobSummary(jobID common.JobID) common.ListJobSummaryResponse {
 	return js
 }
 
-// ListJobTransfers api returns the list of transfer with specific status for given jobId in http response
-func ListJobTransfers(r common.ListJobTransfersRequest) common.ListJobTransfersResponse {
-	// getJobPartInfoReferenceFromMap gives the JobPartPlanInfo Pointer for given JobId and partNumber
-	jm, found := JobsAdmin.JobMgr(r.JobID)
-	if !found {
-		// Job with JobId does not exists
-		// Search the plan files in Azcopy folder
-		// and resurrect the Job
-		if !JobsAdmin.ResurrectJob(r.JobID, EMPTY_SAS_STRING, EMPTY_SAS_STRING) {
-			return common.ListJobTransfersResponse{
-				ErrorMsg: fmt.Sprintf("no job with JobId %v exists", r.JobID),
-			}
-		}
-		// If the job manager was not found, then Job was resurrected
-		// Get the Job manager again for given JobId
-		jm, _ = JobsAdmin.JobMgr(r.JobID)
+// maxSlowestTransfersToReport is the number of transfers listed in the SlowestTransfers of the job summary
+const maxSlowestTransfersToReport = 5
+
+// slowestTransfers keeps track of the transfers that took longest, slowest first.
+// It only keeps references into the plans, so that the strings are only read for the few transfers that are reported.
+type slowestTransfers []timedTransfer
+
+type timedTransfer struct {
+	plan     *JobPartPlanHeader
+	index    uint32
+	duration time.Duration
+}
+
+func (s *slowestTransfers) offer(plan *JobPartPlanHeader, index uint32, duration time.Duration) {
+	list := *s
+	if len(list) == maxSlowestTransfersToReport && duration <= list[len(list)-1].duration {
+		return // not slow enough to make the list
+	}
+	if len(list) < maxSlowestTransfersToReport {
+		list = append(list, timedTransfer{})
+	}
+	// insert it in order, dropping the fastest one if the list was already full
+	i := len(list) - 1
+	for ; i > 0 && list[i-1].duration < duration; i-- {
+		list[i] = list[i-1]
 	}
+	list[i] = timedTransfer{plan: plan, index: index, duration: duration}
+	*s = list
+}
 
+func (s slowestTransfers) details() []common.TransferDetail {
+	result := make([]common.TransferDetail, 0, len(s))
+	for _, st := range s {
+		src, dst, isFolder := st.plan.TransferSrcDstStrings(st.index)
+		result = append(result, common.TransferDetail{
+			Src:                  src,
+			Dst:                  dst,
+			IsFolderProperties:   isFolder,
+			TransferStatus:       st.plan.Transfer(st.index).TransferStatus(),
+			ErrorCode:            st.plan.Transfer(st.index).ErrorCode(),
+			ErrorMessage:         st.plan.ErrorMessage(st.index),
+			DestVersionID:        st.plan.DestVersionID(st.index),
+			DurationMilliseconds: st.duration.Milliseconds(),
+		})
+	}
+	return result
+}
+
+// ListJobTransfers api returns the list of transfer with specific status for given jobId in http response.
+// The transfers are read straight from the plan files, so the job is not resurrected.
+func ListJobTransfers(r common.ListJobTransfersRequest) common.ListJobTransfersResponse {
 	ljt := common.ListJobTransfersResponse{
 		JobID:   r.JobID,
 		Details: []common.TransferDetail{},
 	}
-	for partNum := PartNumber(0); true; partNum++ {
-		jpm, found := jm.JobPartMgr(partNum)
-		if !found {
-			break
-		}
-		// jPartPlan represents the memory map JobPartPlanHeader for given jobid and part number
-		jpp := jpm.Plan()
-		//numTransfer := jPartPlan.NumTransfers
-		// transferStatusList represents the list containing number of transfer for given jobID and part number
-		for t := uint32(0); t < jpp.NumTransfers; t++ {
-			// getting transfer header of transfer at index index for given jobId and part number
-			transferEntry := jpp.Transfer(t)
-			// If the expected status is not to list all transfer and
-			// if the transfer status is not equal to the given status
-			// skip the transfer.
-			// If the given status is failed and the current transfer status is <= -1,
-			// it means transfer failed and could have failed because of some other reason.
-			// In this case we don't skip the transfer.
-			// For Example: In case with-status is Failed, transfers with status "BlobAlreadyExistsFailure"
-			// will also be included.
-			if r.OfStatus != common.ETransferStatus.All() &&
-				((transferEntry.TransferStatus() != r.OfStatus) &&
-					!(r.OfStatus == common.ETransferStatus.Failed() && transferEntry.TransferStatus() <= common.ETransferStatus.Failed())) {
-				continue
-			}
-			// getting source and destination of a transfer at index index for given jobId and part number.
-			src, dst, isFolder := jpp.TransferSrcDstStrings(t)
-			ljt.Details = append(ljt.Details,
-				common.TransferDetail{Src: src, Dst: dst, IsFolderProperties: isFolder, TransferStatus: transferEntry.TransferStatus(), ErrorCode: transferEntry.ErrorCode()})
-		}
+	err := JobsAdmin.WalkJobTransfers(r.JobID, r.OfStatus, func(t common.TransferDetail) error {
+		ljt.Details = append(ljt.Details, t)
+		return nil
+	})
+	if err != nil {
+		return common.ListJobTransfersResponse{ErrorMsg: err.Error()}
 	}
 	return ljt
 }
@@ -605,40 +813,66 @@ func GetJobLCMWrapper(jobID common.JobID) common.LifecycleMgr {
 	}
 }
 
-// ListJobs returns the jobId of all the jobs existing in the current instance of azcopy
+// ListJobs returns the details of all the jobs in the plan folder with the given status (or all of them), newest first.
+// Jobs whose plan files can't be read are reported with the Unknown status.
 func ListJobs(givenStatus common.JobStatus) common.ListJobsResponse {
-	// Resurrect all the Jobs from the existing JobPart Plan files
-	JobsAdmin.ResurrectJobParts()
-	// building the ListJobsResponse for sending response back to front-end
-	jobIds := JobsAdmin.JobIDs()
-	if len(jobIds) == 0 {
+	jobs := JobsAdmin.ListJobPlans()
+	if len(jobs) == 0 {
 		return common.ListJobsResponse{ErrorMessage: "no jobs exists in Azcopy history"}
 	}
+	// building the ListJobsResponse for sending response back to front-end
 	listJobResponse := common.ListJobsResponse{JobIDDetails: []common.JobIDDetails{}}
-	for _, jobId := range jobIds {
-		jm, found := JobsAdmin.JobMgr(jobId)
-		if !found {
-			continue
-		}
-		jpm, found := jm.JobPartMgr(0)
-		if !found {
-			continue
+	for _, job := range jobs {
+		if givenStatus == common.EJobStatus.All() || givenStatus == job.JobStatus {
+			listJobResponse.JobIDDetails = append(listJobResponse.JobIDDetails, job)
 		}
-		if givenStatus == common.EJobStatus.All() || givenStatus == jpm.Plan().JobStatus() {
-			listJobResponse.JobIDDetails = append(listJobResponse.JobIDDetails,
-				common.JobIDDetails{JobId: jobId, CommandString: jpm.Plan().CommandString(),
-					StartTime: jpm.Plan().StartTime, JobStatus: jpm.Plan().JobStatus()})
-		}
-
-		// Close the job part managers and the log.
-		jm.(*jobMgr).jobPartMgrs.Iterate(false, func(k common.PartNumber, v IJobPartMgr) {
-			v.Close()
-		})
-		jm.CloseLog()
 	}
 	return listJobResponse
 }
 
+// FollowJobProgress api streams the progress of the given job, as read from its plan files every interval, until the job is done.
+// Like GetJobPartPlanSummary, it is safe to call for a job that another azcopy process is running.
+func FollowJobProgress(ctx context.Context, jobID common.JobID, interval time.Duration, emit func(common.JobProgressUpdate)) error {
+	return JobsAdmin.FollowJobProgress(ctx, jobID, interval, emit)
+}
+
+// ExportJobPlan api writes the header and transfers of all the plan files of the given job to w, as the JSON of a JobPlanExport.
+// Like FollowJobProgress, it is safe to call for a job that another azcopy process is running.
+func ExportJobPlan(jobID common.JobID, w io.Writer) error {
+	return JobsAdmin.ExportJobPlan(jobID, w)
+}
+
+// GetJobPartPlanSummary api returns a summary of the plan file of the given job part.
+// The plan file is mapped read-only, so this is safe to call for a job that another azcopy process is running.
+func GetJobPartPlanSummary(jobID common.JobID, partNum common.PartNumber) (JobPartPlanSummary, error) {
+	mmf, err := JobsAdmin.NewJobPartPlanFileName(jobID, partNum).MapReadOnly()
+	if err != nil {
+		return JobPartPlanSummary{}, fmt.Errorf("cannot open the plan file of JobID=%v, Part#=%d: %w", jobID, partNum, err)
+	}
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	return JobPartPlanSummary{
+		Version:      plan.Version,
+		StartTime:    plan.StartTime,
+		PartNum:      plan.PartNum,
+		IsFinalPart:  plan.IsFinalPart,
+		NumTransfers: plan.NumTransfers,
+		Priority:     plan.Priority,
+		JobStatus:    plan.JobStatus(),
+	}, nil
+}
+
+// SetBandwidthCap api changes the cap on the aggregate throughput of all jobs. It takes effect immediately,
+// including for jobs that are already running, since all chunks are paced by the same global pacer.
+func SetBandwidthCap(r common.SetBandwidthCapRequest) common.SetBandwidthCapResponse {
+	if r.CapMbps < 0 {
+		return common.SetBandwidthCapResponse{ErrorMsg: fmt.Sprintf("invalid bandwidth cap %v Mbps, it must not be negative", r.CapMbps)}
+	}
+	JobsAdmin.SetBandwidthCap(r.CapMbps)
+	return common.SetBandwidthCapResponse{}
+}
+
 // GetJobFromTo api returns the job FromTo info.
 func GetJobFromTo(r common.GetJobFromToRequest) common.GetJobFromToResponse {
 	jm, found := JobsAdmin.JobMgr(r.JobID)
@@ -670,9 +904,10 @@ func GetJobFromTo(r common.GetJobFromToRequest) common.GetJobFromToResponse {
 	}
 
 	return common.GetJobFromToResponse{
-		ErrorMsg:    "",
-		FromTo:      jp0.Plan().FromTo,
-		Source:      source,
-		Destination: destination,
+		ErrorMsg:       "",
+		FromTo:         jp0.Plan().FromTo,
+		Source:         source,
+		Destination:    destination,
+		CredentialType: jp0.Plan().CredentialType,
 	}
 }
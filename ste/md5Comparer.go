@@ -22,7 +22,10 @@ package ste
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
+	"strings"
+
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-azcopy/common"
 )
@@ -36,6 +39,8 @@ type md5Comparer struct {
 	actualAsSaved    []byte
 	validationOption common.HashValidationOption
 	logger           transferSpecificLogger
+	// despite the name of this type, the hashes may be SHA-256 ones. This only affects the messages.
+	algorithm common.HashAlgorithm
 }
 
 // TODO: let's add an aka.ms link to the message,  that gives more info
@@ -51,6 +56,21 @@ var errExpectedMd5Missing = errors.New(noMD5Stored + " This application is curre
 
 var errActualMd5NotComputed = errors.New("no MDB was computed within this application. This indicates a logic error in this application")
 
+var errSha256Mismatch = errors.New("the SHA-256 hash of the data, as we received it, did not match the expected value, as found in the " +
+	common.SHA256MetadataKey + " metadata of the blob. This means that either there is a data integrity error OR another tool has failed to keep the stored hash up to date.")
+
+const noSHA256Stored = "no SHA-256 hash was stored in the " + common.SHA256MetadataKey + " metadata of this blob. So the downloaded data cannot be SHA-256-validated."
+
+var errExpectedSha256Missing = errors.New(noSHA256Stored + " This application is currently configured to treat missing hashes as errors")
+
+// expectedHashMissingError is the error for a source that has no hash of the given algorithm, when one is required
+func expectedHashMissingError(algorithm common.HashAlgorithm) error {
+	if algorithm == common.EHashAlgorithm.SHA256() {
+		return errExpectedSha256Missing
+	}
+	return errExpectedMd5Missing
+}
+
 // Check compares the two MD5s, and returns any error if applicable
 // Any informational logging will be done within Check, so all the caller needs to do
 // is respond to non-nil errors
@@ -84,7 +104,7 @@ func (c *md5Comparer) Check() error {
 		switch c.validationOption {
 		case common.EHashValidationOption.FailIfDifferentOrMissing(),
 			common.EHashValidationOption.FailIfDifferent():
-			return errMd5Mismatch
+			return c.mismatchError()
 		case common.EHashValidationOption.LogOnly():
 			c.logAsDifferent()
 			return nil
@@ -96,10 +116,62 @@ func (c *md5Comparer) Check() error {
 	return nil
 }
 
+func (c *md5Comparer) mismatchError() error {
+	if c.algorithm == common.EHashAlgorithm.SHA256() {
+		return errSha256Mismatch
+	}
+	return errMd5Mismatch
+}
+
 func (c *md5Comparer) logAsMissing() {
+	if c.algorithm == common.EHashAlgorithm.SHA256() {
+		c.logger.LogAtLevelForCurrentTransfer(pipeline.LogWarning, noSHA256Stored)
+		return
+	}
 	c.logger.LogAtLevelForCurrentTransfer(pipeline.LogWarning, noMD5Stored)
 }
 
 func (c *md5Comparer) logAsDifferent() {
-	c.logger.LogAtLevelForCurrentTransfer(pipeline.LogWarning, errMd5Mismatch.Error())
+	c.logger.LogAtLevelForCurrentTransfer(pipeline.LogWarning, c.mismatchError().Error())
+}
+
+// CheckStreamedMD5 checks the MD5 of data that was downloaded outside of a job (i.e. to stdout) against the one stored at the source,
+// just as Check does for the downloads of a job. Since there is no job log, warnings are passed to warn.
+func CheckStreamedMD5(expected, actual []byte, option common.HashValidationOption, warn func(string)) error {
+	if len(expected) == 0 && option == common.EHashValidationOption.FailIfDifferentOrMissing() {
+		return errExpectedMd5Missing
+	}
+	c := md5Comparer{expected: expected, actualAsSaved: actual, validationOption: option, logger: warningFunc(warn), algorithm: common.EHashAlgorithm.MD5()}
+	return c.Check()
+}
+
+// warningFunc is a transferSpecificLogger that passes each message to a function
+type warningFunc func(string)
+
+func (w warningFunc) LogAtLevelForCurrentTransfer(_ pipeline.LogLevel, msg string) {
+	w(msg)
+}
+
+// expectedHash returns the hash that the source has stored against the data of the file, for the given algorithm, or nil if there is none
+func expectedHash(info TransferInfo, algorithm common.HashAlgorithm) []byte {
+	// the MD5 (or metadata) that came back from Service when we enumerated the source
+	return storedHash(info.SrcHTTPHeaders.ContentMD5, info.SrcMetadata, algorithm)
+}
+
+// storedHash returns the hash, of the given algorithm, that a blob or file keeps in its Content-MD5 or its metadata, or nil if there is none
+func storedHash(contentMD5 []byte, metadata common.Metadata, algorithm common.HashAlgorithm) []byte {
+	if algorithm != common.EHashAlgorithm.SHA256() {
+		return contentMD5
+	}
+	for k, v := range metadata {
+		// metadata keys are case-insensitive
+		if strings.EqualFold(k, common.SHA256MetadataKey) {
+			if hash, err := hex.DecodeString(v); err == nil && len(hash) == algorithm.Size() {
+				return hash
+			}
+			// the hash is unusable, which we treat just as if it was missing
+			return nil
+		}
+	}
+	return nil
 }
@@ -0,0 +1,157 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// metricsPath is where the metrics endpoint serves the Prometheus text exposition format
+const metricsPath = "/metrics"
+
+// metricsReadHeaderTimeout bounds how long a client may take to send its request headers, so that slow or idle
+// connections can't pile up on the endpoint
+const metricsReadHeaderTimeout = 10 * time.Second
+
+// jobMetrics are the per-job values exposed by the metrics endpoint, summed over the job's parts
+type jobMetrics struct {
+	jobID              common.JobID
+	bytesTransferred   uint64
+	transfersCompleted uint32
+	transfersFailed    uint32
+	transfersSkipped   uint32
+}
+
+// metricsHandler serves the metrics of the running jobs. Its values are read from the same atomic counters that feed
+// the progress reports, so scraping it costs no more than a progress update does.
+// Scraping changes nothing, so any number of scrapers can share the endpoint. There is no throughput gauge: throughput
+// is worked out by the scraper, e.g. as rate(azcopy_bytes_over_wire_total[1m]).
+type metricsHandler struct {
+	ja *jobsAdmin
+}
+
+func newMetricsHandler(ja *jobsAdmin) *metricsHandler {
+	return &metricsHandler{ja: ja}
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != metricsPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(h.render())
+}
+
+func (h *metricsHandler) render() []byte {
+	jobs := h.collectJobMetrics()
+	wireBytes := h.ja.BytesOverWire()
+
+	b := &bytes.Buffer{}
+	writeJobMetric := func(name, help, metricType string, value func(m jobMetrics) uint64) {
+		writeMetricHeader(b, name, help, metricType)
+		for _, m := range jobs {
+			fmt.Fprintf(b, "%s{job_id=\"%s\"} %d\n", name, m.jobID, value(m))
+		}
+	}
+
+	writeJobMetric("azcopy_bytes_transferred_total", "Bytes of file data transferred by the job, as chunks complete.", "counter",
+		func(m jobMetrics) uint64 { return m.bytesTransferred })
+	writeJobMetric("azcopy_transfers_completed_total", "Transfers of the job that completed successfully.", "counter",
+		func(m jobMetrics) uint64 { return uint64(m.transfersCompleted) })
+	writeJobMetric("azcopy_transfers_failed_total", "Transfers of the job that failed.", "counter",
+		func(m jobMetrics) uint64 { return uint64(m.transfersFailed) })
+	writeJobMetric("azcopy_transfers_skipped_total", "Transfers of the job that were skipped.", "counter",
+		func(m jobMetrics) uint64 { return uint64(m.transfersSkipped) })
+
+	writeMetricHeader(b, "azcopy_bytes_over_wire_total", "Bytes sent or received over the network by all jobs, including retries. Its rate is the network throughput.", "counter")
+	fmt.Fprintf(b, "azcopy_bytes_over_wire_total %d\n", wireBytes)
+
+	writeMetricHeader(b, "azcopy_concurrency", "Number of goroutines currently processing chunks.", "gauge")
+	fmt.Fprintf(b, "azcopy_concurrency %d\n", h.ja.CurrentMainPoolSize())
+
+	return b.Bytes()
+}
+
+func writeMetricHeader(b *bytes.Buffer, name, help, metricType string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// collectJobMetrics sums the counters of each job's parts, and returns the jobs in a stable order
+func (h *metricsHandler) collectJobMetrics() []jobMetrics {
+	jobs := make([]jobMetrics, 0)
+	h.ja.jobIDToJobMgr.Iterate(false, func(jobID common.JobID, jm IJobMgr) {
+		m := jobMetrics{jobID: jobID}
+		if jmImpl, ok := jm.(*jobMgr); ok {
+			jmImpl.jobPartMgrs.Iterate(true, func(_ common.PartNumber, jpm IJobPartMgr) {
+				m.bytesTransferred += jpm.Plan().BytesTransferred()
+				if jpmImpl, ok := jpm.(*jobPartMgr); ok {
+					m.transfersCompleted += atomic.LoadUint32(&jpmImpl.atomicTransfersCompleted)
+					m.transfersFailed += atomic.LoadUint32(&jpmImpl.atomicTransfersFailed)
+					m.transfersSkipped += atomic.LoadUint32(&jpmImpl.atomicTransfersSkipped)
+				}
+			})
+		}
+		jobs = append(jobs, m)
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].jobID.String() < jobs[j].jobID.String() })
+	return jobs
+}
+
+// StartMetricsServer serves the metrics of the running jobs at http://<address>/metrics, in the Prometheus text format,
+// for as long as the app runs. The address is bound before returning, so that a bad or busy address is reported to the user.
+func (ja *jobsAdmin) StartMetricsServer(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("cannot start the metrics endpoint on %s: %w", address, err)
+	}
+
+	server := &http.Server{Handler: newMetricsHandler(ja), ReadHeaderTimeout: metricsReadHeaderTimeout}
+	go func() {
+		<-ja.appCtx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			ja.LogToJobLog(fmt.Sprintf("the metrics endpoint on %s stopped: %v", address, err), pipeline.LogWarning)
+		}
+	}()
+
+	ja.LogToJobLog(fmt.Sprintf("serving metrics at http://%s%s", listener.Addr(), metricsPath), pipeline.LogInfo)
+	return nil
+}
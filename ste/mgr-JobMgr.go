@@ -45,7 +45,9 @@ type PartNumber = common.PartNumber
 // i.e. different jobs could have different OAuth tokens requested from FE, and these jobs can run at same time in STE.
 // This can be optimized if FE would no more be another module vs STE module.
 type InMemoryTransitJobState struct {
-	credentialInfo common.CredentialInfo
+	credentialInfo   common.CredentialInfo
+	sasTokenProvider SASTokenProvider // nil if the job's SAS tokens are not to be refreshed
+	transferOrder    common.TransferOrder
 }
 
 type IJobMgr interface {
@@ -76,30 +78,46 @@ type IJobMgr interface {
 	//Close()
 	getInMemoryTransitJobState() InMemoryTransitJobState      // get in memory transit job state saved in this job.
 	setInMemoryTransitJobState(state InMemoryTransitJobState) // set in memory transit job state saved in this job.
+	getSASTokens() *jobSASTokens                              // get the current SAS tokens of this job.
 	ChunkStatusLogger() common.ChunkStatusLogger
 	HttpClient() *http.Client
 	PipelineNetworkStats() *pipelineNetworkStats
 	getOverwritePrompter() *overwritePrompter
+	getImmutabilityWarning() *sync.Once
+	SetTransferConcurrency(n uint16)
+	transferSlots() chan struct{}
+	SetMaxTotalBytes(n uint64)
+	noteTransferDone()
+	reserveBytes(n uint64) bool
+	isStoppedByMaxTotalBytes() bool
+	LogEvent(level pipeline.LogLevel, event common.LogEvent, transferPath string, msg string)
 	common.ILoggerCloser
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-func newJobMgr(concurrency ConcurrencySettings, appLogger common.ILogger, jobID common.JobID, appCtx context.Context, cpuMon common.CPUMonitor, level common.LogLevel, commandString string, logFileFolder string) IJobMgr {
+func newJobMgr(concurrency ConcurrencySettings, appLogger common.ILogger, jobID common.JobID, appCtx context.Context, cpuMon common.CPUMonitor, level common.LogLevel, logFormat common.LogFormat, commandString string, logFileFolder string) IJobMgr {
 	// atomicAllTransfersScheduled is set to 1 since this api is also called when new job part is ordered.
 	enableChunkLogOutput := level.ToPipelineLogLevel() == pipeline.LogDebug
 	jobPartProgressCh := make(chan jobPartProgressInfo)
 	jm := jobMgr{jobID: jobID, jobPartMgrs: newJobPartToJobPartMgr(), include: map[string]int{}, exclude: map[string]int{},
 		httpClient:                    NewAzcopyHTTPClient(concurrency.MaxIdleConnections),
-		logger:                        common.NewJobLogger(jobID, level, appLogger, logFileFolder),
+		logger:                        common.NewJobLogger(jobID, level, logFormat, appLogger, logFileFolder),
 		chunkStatusLogger:             common.NewChunkStatusLogger(jobID, cpuMon, logFileFolder, enableChunkLogOutput),
 		concurrency:                   concurrency,
 		overwritePrompter:             newOverwritePrompter(),
+		immutabilityWarning:           &sync.Once{},
 		pipelineNetworkStats:          newPipelineNetworkStats(JobsAdmin.(*jobsAdmin).concurrencyTuner), // let the stats coordinate with the concurrency tuner
 		exclusiveDestinationMapHolder: &atomic.Value{},
+		transferSlotsHolder:           &atomic.Value{},
 		initMu:                        &sync.Mutex{},
+		maxDurationMu:                 &sync.Mutex{},
+		sasExpiryMu:                   &sync.Mutex{},
+		sasTokens:                     newJobSASTokens(),
 		jobPartProgress:               jobPartProgressCh,
 		/*Other fields remain zero-value until this job is scheduled */}
+	flushInterval, flushTransfers := getPlanFlushSettings()
+	jm.planFlusher = newPlanFlusher(jm.flushPlanFiles, flushInterval, flushTransfers)
 	jm.reset(appCtx, commandString)
 	jm.logJobsAdminMessages()
 	go jm.reportJobPartDoneHandler()
@@ -110,6 +128,10 @@ func (jm *jobMgr) getOverwritePrompter() *overwritePrompter {
 	return jm.overwritePrompter
 }
 
+func (jm *jobMgr) getImmutabilityWarning() *sync.Once {
+	return jm.immutabilityWarning
+}
+
 func (jm *jobMgr) reset(appCtx context.Context, commandString string) IJobMgr {
 	jm.logger.OpenLog()
 	// log the user given command to the job log file.
@@ -122,7 +144,9 @@ func (jm *jobMgr) reset(appCtx context.Context, commandString string) IJobMgr {
 	jm.ctx, jm.cancel = context.WithCancel(appCtx)
 	atomic.StoreUint64(&jm.atomicNumberOfBytesCovered, 0)
 	atomic.StoreUint64(&jm.atomicTotalBytesToXfer, 0)
+	atomic.StoreInt64(&jm.atomicRunStartTime, time.Now().UnixNano())
 	jm.partsDone = 0
+	atomic.StoreInt32(&jm.atomicRunEnded, 0)
 	return jm
 }
 
@@ -177,6 +201,12 @@ type jobMgr struct {
 	// refer to: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	atomicNumberOfBytesCovered uint64
 	atomicTotalBytesToXfer     uint64
+	// atomicRunStartTime is when the current run of the job started, as nanoseconds. Its duration is added to the plan when it ends.
+	atomicRunStartTime int64
+	// atomicMaxTotalBytes is the most data that the job may transfer, over all its runs, or 0 if there is no limit (see reserveBytes)
+	atomicMaxTotalBytes uint64
+	// atomicBytesReserved is how much data the job transferred in its earlier runs, plus the rest of the data of each transfer started in this one
+	atomicBytesReserved uint64
 	// atomicCurrentConcurrentConnections defines the number of active goroutines performing the transfer / executing the chunk func
 	// TODO: added for debugging purpose. remove later
 	atomicCurrentConcurrentConnections int64
@@ -184,6 +214,8 @@ type jobMgr struct {
 	atomicAllTransfersScheduled     int32
 	atomicFinalPartOrderedIndicator int32
 	atomicTransferDirection         common.TransferDirection
+	// atomicRunEnded is 1 once the current run of the job is over, with its transfers in flight finished and its plan files flushed
+	atomicRunEnded int32
 
 	concurrency          ConcurrencySettings
 	logger               common.ILoggerResetable
@@ -195,6 +227,10 @@ type jobMgr struct {
 
 	exclusiveDestinationMapHolder *atomic.Value
 
+	// holds the chan struct{} whose capacity limits how many of this job's transfers may be in progress at once.
+	// A nil channel means there is no per-job limit.
+	transferSlotsHolder *atomic.Value
+
 	// Share the same HTTP Client across all job parts, so that the we maximize re-use of
 	// its internal connection pool
 	httpClient *http.Client
@@ -213,12 +249,30 @@ type jobMgr struct {
 	// only a single instance of the prompter is needed for all transfers
 	overwritePrompter *overwritePrompter
 
+	// makes sure that the user is told only once per job that the destination doesn't support immutability
+	immutabilityWarning *sync.Once
+
 	// must have a single instance of this, for the whole job
 	folderCreationTracker common.FolderCreationTracker
 
 	initMu    *sync.Mutex
 	initState *jobMgrInitState
 
+	// maxDurationTimer stops the current run of the job once it has lasted longer than the job's MaxDuration (nil if there is no limit)
+	maxDurationMu    *sync.Mutex
+	maxDurationTimer *time.Timer
+
+	// sasExpiryTimer refreshes the SAS tokens of the job before they expire, if it has a SASTokenProvider. Otherwise it stops
+	// the current run of the job when the first of them expires. It is nil if none of them expire.
+	sasExpiryMu    *sync.Mutex
+	sasExpiryTimer *time.Timer
+	sasExpiryRun   uint64 // counts the starts and stops of the timer, so that an outdated timer can tell it has nothing to do
+	// sasTokens are the current SAS tokens of the job, which differ from those of its parts once they have been refreshed
+	sasTokens *jobSASTokens
+
+	// planFlusher flushes the job's plan files to disk while it runs, so that a crash loses little of its progress
+	planFlusher *planFlusher
+
 	jobPartProgress chan jobPartProgressInfo
 }
 
@@ -329,7 +383,7 @@ func (jm *jobMgr) TryGetPerformanceAdvice(bytesInJob uint64, filesInJob uint32,
 
 	dir := jm.atomicTransferDirection.AtomicLoad()
 	isToAzureFiles := fromTo.To() == common.ELocation.File()
-	a := NewPerformanceAdvisor(jm.pipelineNetworkStats, ja.commandLineMbpsCap, int64(megabitsPerSec), finalReason, finalConcurrency, dir, averageBytesPerFile, isToAzureFiles)
+	a := NewPerformanceAdvisor(jm.pipelineNetworkStats, ja.BandwidthCap(), int64(megabitsPerSec), finalReason, finalConcurrency, dir, averageBytesPerFile, isToAzureFiles)
 	return a.GetAdvice()
 }
 
@@ -337,7 +391,7 @@ func (jm *jobMgr) TryGetPerformanceAdvice(bytesInJob uint64, filesInJob uint32,
 func (jm *jobMgr) AddJobPart(partNum PartNumber, planFile JobPartPlanFileName, existingPlanMMF *JobPartPlanMMF, sourceSAS string,
 	destinationSAS string, scheduleTransfers bool) IJobPartMgr {
 	jpm := &jobPartMgr{jobMgr: jm, filename: planFile, sourceSAS: sourceSAS,
-		destinationSAS: destinationSAS, pacer: JobsAdmin.(*jobsAdmin).pacer,
+		destinationSAS:   destinationSAS,
 		slicePool:        JobsAdmin.(*jobsAdmin).slicePool,
 		cacheLimiter:     JobsAdmin.(*jobsAdmin).cacheLimiter,
 		fileCountLimiter: JobsAdmin.(*jobsAdmin).fileCountLimiter}
@@ -347,11 +401,24 @@ func (jm *jobMgr) AddJobPart(partNum PartNumber, planFile JobPartPlanFileName, e
 	} else {
 		jpm.planMMF = existingPlanMMF
 	}
+	jpm.pacer = JobsAdmin.(*jobsAdmin).pacerFor(jpm.Plan().FromTo)
 
 	jm.jobPartMgrs.Set(partNum, jpm)
 	jm.setFinalPartOrdered(partNum, jpm.planMMF.Plan().IsFinalPart)
 	jm.setDirection(jpm.Plan().FromTo)
 	jpm.exclusiveDestinationMap = jm.getExclusiveDestinationMap(partNum, jpm.Plan().FromTo)
+	if partNum == 0 {
+		// the concurrency and the data limit stored in part 0 apply to the whole job
+		jm.SetTransferConcurrency(jpm.Plan().Concurrency)
+		jm.SetMaxTotalBytes(jpm.Plan().MaxTotalBytes)
+		if scheduleTransfers {
+			// a resurrected job only starts running (and so only starts its clock) when it is resumed
+			jm.startMaxDurationTimer(jpm.Plan().MaxDuration)
+			jm.startSASExpiryTimer(sourceSAS, destinationSAS)
+			jm.startBandwidthSchedule(jpm.Plan())
+			jm.planFlusher.start()
+		}
+	}
 
 	jm.initMu.Lock()
 	defer jm.initMu.Unlock()
@@ -424,6 +491,201 @@ func (jm *jobMgr) getExclusiveDestinationMap(partNum PartNumber, fromTo common.F
 	return jm.exclusiveDestinationMapHolder.Load().(*common.ExclusiveStringMap)
 }
 
+// SetTransferConcurrency limits how many of the job's transfers may be in progress at once. Zero removes the limit.
+// Transfers already holding a slot keep it; the new limit applies to transfers that start from now on.
+func (jm *jobMgr) SetTransferConcurrency(n uint16) {
+	var slots chan struct{}
+	if n > 0 {
+		slots = make(chan struct{}, n)
+	}
+	jm.transferSlotsHolder.Store(slots)
+}
+
+func (jm *jobMgr) transferSlots() chan struct{} {
+	slots, _ := jm.transferSlotsHolder.Load().(chan struct{})
+	return slots
+}
+
+// SetMaxTotalBytes limits how much data the job may transfer, over all its runs. 0 means there is no limit
+func (jm *jobMgr) SetMaxTotalBytes(n uint64) {
+	atomic.StoreUint64(&jm.atomicMaxTotalBytes, n)
+}
+
+// resetBytesReserved starts the reservations of the current run of the job (see reserveBytes) from what the job has already transferred
+func (jm *jobMgr) resetBytesReserved() {
+	transferred := uint64(0)
+	jm.jobPartMgrs.Iterate(true, func(_ common.PartNumber, jpm IJobPartMgr) {
+		transferred += jpm.Plan().BytesTransferred()
+	})
+	atomic.StoreUint64(&jm.atomicBytesReserved, transferred)
+}
+
+// reserveBytes counts n bytes against the job's MaxTotalBytes, for a transfer that is about to start, and returns whether they fit.
+// The first time they don't, the job is stopped (see stopStartingTransfers). After that, nothing more is reserved in this run,
+// even for a transfer that would fit, so that the job stops at the first transfer that would take it past the limit.
+// What a transfer reserves isn't given back if it fails, so the job never goes past the limit, even when data is sent again.
+func (jm *jobMgr) reserveBytes(n uint64) bool {
+	maxTotalBytes := atomic.LoadUint64(&jm.atomicMaxTotalBytes)
+	if maxTotalBytes == 0 {
+		return true
+	}
+	if jm.isStoppedByMaxTotalBytes() {
+		return false
+	}
+	for {
+		reserved := atomic.LoadUint64(&jm.atomicBytesReserved)
+		if reserved+n > maxTotalBytes {
+			jm.stopStartingTransfers(common.EJobCancelReason.MaxTotalBytesReached(), fmt.Sprintf("JobID=%v would go past its maximum of %d bytes "+
+				"if it started its next transfer, of %d bytes, since %d bytes have been transferred or are being transferred. "+
+				"No more transfers will be started, and the job will be cancelled when those in progress have finished", jm.jobID, maxTotalBytes, n, reserved))
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&jm.atomicBytesReserved, reserved, reserved+n) {
+			return true
+		}
+	}
+}
+
+// isStoppedByMaxTotalBytes reports whether the current run of the job has been stopped by reserveBytes
+func (jm *jobMgr) isStoppedByMaxTotalBytes() bool {
+	jpm0, ok := jm.jobPartMgrs.Get(0)
+	return ok && jpm0.Plan().CancelReason() == common.EJobCancelReason.MaxTotalBytesReached()
+}
+
+// startMaxDurationTimer arranges for the current run of the job to be stopped once it has lasted longer than maxDuration.
+// Zero means the run is not limited. Any timer from an earlier run is discarded, so each run gets the full duration.
+func (jm *jobMgr) startMaxDurationTimer(maxDuration time.Duration) {
+	jm.maxDurationMu.Lock()
+	defer jm.maxDurationMu.Unlock()
+	if jm.maxDurationTimer != nil {
+		jm.maxDurationTimer.Stop()
+		jm.maxDurationTimer = nil
+	}
+	if maxDuration <= 0 {
+		return
+	}
+	runTime := time.Since(time.Unix(0, atomic.LoadInt64(&jm.atomicRunStartTime)))
+	jm.maxDurationTimer = time.AfterFunc(maxDuration-runTime, func() { jm.stopForMaxDuration(maxDuration) })
+}
+
+// startBandwidthSchedule makes the bandwidth cap follow the job's bandwidth schedule, if it has one, for the current run of the job
+func (jm *jobMgr) startBandwidthSchedule(part0Plan *JobPartPlanHeader) {
+	if schedule := part0Plan.BandwidthScheduleWindows(); len(schedule) > 0 {
+		JobsAdmin.StartBandwidthSchedule(jm.jobID, schedule)
+	}
+}
+
+// stopForMaxDuration stops a running job that has lasted longer than its maximum duration
+func (jm *jobMgr) stopForMaxDuration(maxDuration time.Duration) {
+	jm.stopStartingTransfers(common.EJobCancelReason.MaxDurationExceeded(), fmt.Sprintf("JobID=%v has run for longer than its maximum duration of %v. "+
+		"No more transfers will be started, and the job will be cancelled when those in progress have finished", jm.jobID, maxDuration))
+}
+
+// startSASExpiryTimer arranges for the SAS tokens of the current run of the job to be refreshed before they expire, if the job
+// has a SASTokenProvider. Otherwise, the run is stopped when the earliest of them expires, rather than letting every transfer
+// that is started after that fail. Any timer from an earlier run is discarded, since the job may have been resumed with new tokens.
+func (jm *jobMgr) startSASExpiryTimer(sourceSAS string, destinationSAS string) {
+	jm.sasExpiryMu.Lock()
+	defer jm.sasExpiryMu.Unlock()
+	jm.sasTokens.set(sourceSAS, destinationSAS)
+	jm.sasExpiryRun++
+	jm.scheduleSASExpiry(jm.sasExpiryRun, jm.getInMemoryTransitJobState().sasTokenProvider, 0)
+}
+
+// stopSASExpiryTimer discards the timer set by startSASExpiryTimer, once the run of the job is over
+func (jm *jobMgr) stopSASExpiryTimer() {
+	jm.sasExpiryMu.Lock()
+	defer jm.sasExpiryMu.Unlock()
+	jm.sasExpiryRun++
+	if jm.sasExpiryTimer != nil {
+		jm.sasExpiryTimer.Stop()
+		jm.sasExpiryTimer = nil
+	}
+}
+
+// scheduleSASExpiry sets the timer for the earliest expiry of the current SAS tokens of the job, waiting at least minDelay
+// before any refresh. It is called with sasExpiryMu held.
+func (jm *jobMgr) scheduleSASExpiry(run uint64, provider SASTokenProvider, minDelay time.Duration) {
+	if jm.sasExpiryTimer != nil {
+		jm.sasExpiryTimer.Stop()
+		jm.sasExpiryTimer = nil
+	}
+	source, destination := jm.sasTokens.current()
+	expiry, ok := common.EarliestSASExpiryTime(source, destination)
+	if !ok {
+		return
+	}
+	untilExpiry := time.Until(expiry)
+	if provider != nil {
+		untilRefresh := untilExpiry - sasRefreshLeadTime
+		if untilRefresh < minDelay {
+			untilRefresh = minDelay
+		}
+		if untilRefresh < untilExpiry {
+			jm.sasExpiryTimer = time.AfterFunc(untilRefresh, func() { jm.refreshSAS(run, provider, expiry) })
+			return
+		}
+	}
+	jm.sasExpiryTimer = time.AfterFunc(untilExpiry, func() { jm.stopForSASExpiry(run, expiry) })
+}
+
+// refreshSAS gets new SAS tokens from the provider, for those that are about to expire. If it cannot, it tries again a little later,
+// until the tokens have expired. The transfers of the job pick up the new tokens through sasRefreshingPipeline.
+func (jm *jobMgr) refreshSAS(run uint64, provider SASTokenProvider, expiry time.Time) {
+	jm.sasExpiryMu.Lock()
+	isCurrentRun := run == jm.sasExpiryRun
+	jm.sasExpiryMu.Unlock()
+	if !isCurrentRun {
+		return
+	}
+
+	// the lock is not held while the provider works, since that can take a while
+	err := refreshSASTokens(jm.ctx, provider, jm.sasTokens, time.Now().Add(sasRefreshLeadTime))
+
+	jm.sasExpiryMu.Lock()
+	defer jm.sasExpiryMu.Unlock()
+	if run != jm.sasExpiryRun {
+		return
+	}
+	if err == nil {
+		jm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v refreshed its SAS token", jm.jobID))
+	} else {
+		jm.Log(pipeline.LogWarning, fmt.Sprintf("JobID=%v %v", jm.jobID, err))
+	}
+	// even after a successful refresh, wait a while before the next one, in case the new token is also about to expire
+	jm.scheduleSASExpiry(run, provider, sasRefreshRetryInterval)
+}
+
+// stopForSASExpiry stops a running job whose SAS token has expired
+func (jm *jobMgr) stopForSASExpiry(run uint64, expiry time.Time) {
+	jm.sasExpiryMu.Lock()
+	isCurrentRun := run == jm.sasExpiryRun
+	jm.sasExpiryMu.Unlock()
+	if !isCurrentRun {
+		return
+	}
+	jm.stopStartingTransfers(common.EJobCancelReason.SASExpired(), fmt.Sprintf("JobID=%v cannot go on, since its SAS token expired at %v. "+
+		"No more transfers will be started, and the job will be cancelled when those in progress have finished. "+
+		"It can be resumed with a new SAS token", jm.jobID, expiry.UTC().Format(time.RFC3339)))
+}
+
+// stopStartingTransfers moves a running job into the Cancelling state, recording why, and logs the given message.
+// Unlike a cancel order, it does not cancel the job's context: transfers in progress are left to finish,
+// but no more are started (see IJobPartTransferMgr.IsJobCancelling). The job becomes Cancelled once all its parts are done.
+func (jm *jobMgr) stopStartingTransfers(reason common.JobCancelReason, message string) {
+	jpm0, ok := jm.jobPartMgrs.Get(0)
+	if !ok {
+		return
+	}
+	plan0 := jpm0.Plan()
+	if plan0.JobStatus() != common.EJobStatus.InProgress() {
+		return // it has already finished, or been paused or cancelled
+	}
+	plan0.SetCancelReason(reason)
+	plan0.SetJobStatus(common.EJobStatus.Cancelling())
+	jm.Log(pipeline.LogWarning, message)
+}
+
 func (jm *jobMgr) HttpClient() *http.Client {
 	return jm.httpClient
 }
@@ -447,6 +709,13 @@ func (jm *jobMgr) IncludeExclude() (map[string]int, map[string]int) {
 // ScheduleTransfers schedules this job part's transfers. It is called when a new job part is ordered & is also called to resume a paused Job
 func (jm *jobMgr) ResumeTransfers(appCtx context.Context) {
 	jm.reset(appCtx, "")
+	jm.resetBytesReserved()
+	if jpm0, ok := jm.jobPartMgrs.Get(0); ok {
+		jm.startMaxDurationTimer(jpm0.Plan().MaxDuration) // the clock restarts with each run
+		jm.startSASExpiryTimer(jpm0.SAS())
+		jm.startBandwidthSchedule(jpm0.Plan()) // the schedule is in the plan, so it survives pausing and resuming
+		jm.planFlusher.start()
+	}
 	// Since while creating the JobMgr, atomicAllTransfersScheduled is set to true
 	// reset it to false while resuming it
 	//jm.ResetAllTransfersScheduled()
@@ -498,8 +767,8 @@ func (jm *jobMgr) reportJobPartDoneHandler() {
 		// JobPart 0 status is not changed (unless we are cancelling)
 		haveFinalPart = atomic.LoadInt32(&jm.atomicFinalPartOrderedIndicator) == 1
 		allKnownPartsDone := partsDone == jm.jobPartMgrs.Count()
-		isCancelling := jobStatus == common.EJobStatus.Cancelling()
-		shouldComplete := allKnownPartsDone && (haveFinalPart || isCancelling)
+		isStopping := jobStatus == common.EJobStatus.Cancelling() || jobStatus == common.EJobStatus.Paused()
+		shouldComplete := allKnownPartsDone && (haveFinalPart || isStopping)
 		if shouldComplete {
 			break
 		} //Else log and wait for next part to complete
@@ -511,6 +780,12 @@ func (jm *jobMgr) reportJobPartDoneHandler() {
 
 	jobPart0Mgr, _ := jm.jobPartMgrs.Get(0)
 	part0Plan := jobPart0Mgr.Plan() // status of part 0 is status of job as whole.
+	jm.startMaxDurationTimer(0)     // this run is over, so it can no longer overrun
+	jm.stopSASExpiryTimer()
+	jm.planFlusher.end() // the plan files are flushed below, once the run's final status is in them
+	if part0Plan.BandwidthScheduleLength > 0 {
+		JobsAdmin.StopBandwidthSchedule(jm.jobID)
+	}
 
 	partDescription := "all parts of entire Job"
 	if !haveFinalPart {
@@ -526,13 +801,50 @@ func (jm *jobMgr) reportJobPartDoneHandler() {
 		if shouldLog {
 			jm.Log(pipeline.LogInfo, fmt.Sprintf("%s %v successfully cancelled", partDescription, jm.jobID))
 		}
+	case common.EJobStatus.Paused():
+		// the job stays paused, even across restarts of azcopy, until it is resumed
+		if shouldLog {
+			jm.Log(pipeline.LogInfo, fmt.Sprintf("%s %v paused", partDescription, jm.jobID))
+		}
 	case common.EJobStatus.InProgress():
 		part0Plan.SetJobStatus((common.EJobStatus).EnhanceJobStatusInfo(jobProgressInfo.transfersSkipped > 0,
 			jobProgressInfo.transfersFailed > 0,
 			jobProgressInfo.transfersCompleted > 0))
 	}
+	if jobStatus := part0Plan.JobStatus(); jobStatus.IsJobDone() {
+		// from now on, the plan files' time to live counts down
+		part0Plan.SetJobCompletionTime(time.Now())
+	}
+
+	// this run is over (whether the job completed, or was cancelled or paused), so add its duration to the job's total
+	part0Plan.AddElapsedTime(time.Since(time.Unix(0, atomic.LoadInt64(&jm.atomicRunStartTime))))
 
 	jm.chunkStatusLogger.FlushLog() // TODO: remove once we sort out what will be calling CloseLog (currently nothing)
+
+	// the job can be resumed from its plan files, even if the machine goes down, once they are flushed
+	jm.flushPlanFiles()
+	atomic.StoreInt32(&jm.atomicRunEnded, 1)
+}
+
+// noteTransferDone tells the job that one more of its transfers is done, so that its plan files are flushed every so many of them
+func (jm *jobMgr) noteTransferDone() {
+	jm.planFlusher.noteTransferDone()
+}
+
+// flushPlanFiles writes whatever the job's plan files say in memory to disk
+func (jm *jobMgr) flushPlanFiles() {
+	jm.jobPartMgrs.Iterate(true, func(partNum common.PartNumber, jpm IJobPartMgr) {
+		if jpmImpl, ok := jpm.(*jobPartMgr); ok {
+			if err := jpmImpl.planMMF.Flush(); err != nil {
+				jm.Log(pipeline.LogWarning, fmt.Sprintf("failed to flush the plan file of part %d of job %v: %v", partNum, jm.jobID, err))
+			}
+		}
+	})
+}
+
+// runEnded returns whether the current run of the job is over, with its plan files up to date
+func (jm *jobMgr) runEnded() bool {
+	return atomic.LoadInt32(&jm.atomicRunEnded) == 1
 }
 
 func (jm *jobMgr) getInMemoryTransitJobState() InMemoryTransitJobState {
@@ -545,10 +857,17 @@ func (jm *jobMgr) setInMemoryTransitJobState(state InMemoryTransitJobState) {
 	jm.inMemoryTransitJobState = state
 }
 
+func (jm *jobMgr) getSASTokens() *jobSASTokens {
+	return jm.sasTokens
+}
+
 func (jm *jobMgr) Context() context.Context                { return jm.ctx }
 func (jm *jobMgr) Cancel()                                 { jm.cancel() }
 func (jm *jobMgr) ShouldLog(level pipeline.LogLevel) bool  { return jm.logger.ShouldLog(level) }
 func (jm *jobMgr) Log(level pipeline.LogLevel, msg string) { jm.logger.Log(level, msg) }
+func (jm *jobMgr) LogEvent(level pipeline.LogLevel, event common.LogEvent, transferPath string, msg string) {
+	jm.logger.LogEvent(level, event, transferPath, msg)
+}
 func (jm *jobMgr) PipelineLogInfo() pipeline.LogOptions {
 	return pipeline.LogOptions{
 		Log:       jm.Log,
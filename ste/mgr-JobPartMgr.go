@@ -3,13 +3,15 @@ package ste
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"mime"
 	"net"
 	"net/http"
-	"net/url"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -30,6 +32,7 @@ type IJobPartMgr interface {
 	ReportTransferDone(status common.TransferStatus) uint32
 	GetOverwriteOption() common.OverwriteOption
 	GetForceIfReadOnly() bool
+	GetSourceNewerTolerance() time.Duration
 	AutoDecompress() bool
 	ScheduleChunks(chunkFunc chunkFunc)
 	RescheduleTransfer(jptm IJobPartTransferMgr)
@@ -52,8 +55,16 @@ type IJobPartMgr interface {
 	SourceProviderPipeline() pipeline.Pipeline
 	getOverwritePrompter() *overwritePrompter
 	getFolderCreationTracker() common.FolderCreationTracker
+	getImmutabilityWarning() *sync.Once
+	transferSlots() chan struct{}
 	SecurityInfoPersistenceManager() *securityInfoPersistenceManager
 	FolderDeletionManager() common.FolderDeletionManager
+	isJobPaused() bool
+	isJobCancelling() bool
+	isJobStoppedByMaxTotalBytes() bool
+	reserveBytes(n uint64) bool
+	retryTransfer(transferIndex uint32) bool
+	LogEvent(level pipeline.LogLevel, event common.LogEvent, transferPath string, msg string)
 }
 
 type serviceAPIVersionOverride struct{}
@@ -81,6 +92,49 @@ func NewVersionPolicyFactory() pipeline.Factory {
 	})
 }
 
+type cpkInfoOverride struct{}
+
+// CpkInfoOverride is the context key of the customer-provided key (a common.CpkInfo) with which blob data is encrypted.
+// When a request's context has it, the request carries the key, provided the operation supports customer-provided keys.
+var CpkInfoOverride = cpkInfoOverride{}
+
+// NewCpkPolicyFactory creates a factory that adds the headers of the customer-provided key in the request's context, if any.
+// It must come before the credential in the pipeline, since the headers are signed.
+func NewCpkPolicyFactory() pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			if value := ctx.Value(CpkInfoOverride); value != nil && isCpkOperation(request) {
+				cpkInfo := value.(common.CpkInfo)
+				request.Header.Set("x-ms-encryption-key", cpkInfo.EncryptionKey)
+				request.Header.Set("x-ms-encryption-key-sha256", cpkInfo.EncryptionKeySha256)
+				request.Header.Set("x-ms-encryption-algorithm", common.CpkEncryptionAlgorithm)
+			}
+			return next.Do(ctx, request)
+		}
+	})
+}
+
+// isCpkOperation returns whether the request is for one of the blob operations that accept a customer-provided key.
+// Container operations, and blob operations such as Set Blob Tier or Delete Blob, do not.
+func isCpkOperation(request pipeline.Request) bool {
+	query := request.URL.Query()
+	if query.Get("restype") != "" {
+		return false
+	}
+
+	comp := query.Get("comp")
+	switch request.Method {
+	case http.MethodGet, http.MethodHead: // Get Blob, Get Blob Properties and Get Blob Metadata
+		return comp == "" || comp == "metadata"
+	case http.MethodPut: // Put Blob, Put Block, Put Block List, Put Page, Append Block, Set Blob Metadata and Snapshot Blob
+		switch comp {
+		case "", "block", "blocklist", "page", "appendblock", "metadata", "snapshot":
+			return true
+		}
+	}
+	return false
+}
+
 // NewAzcopyHTTPClient creates a new HTTP client.
 // We must minimize use of this, and instead maximize re-use of the returned client object.
 // Why? Because that makes our connection pooling more efficient, and prevents us exhausting the
@@ -158,6 +212,7 @@ func NewBlobPipeline(c azblob.Credential, o azblob.PipelineOptions, r XferRetryO
 	f := []pipeline.Factory{
 		azblob.NewTelemetryPolicyFactory(o.Telemetry),
 		azblob.NewUniqueRequestIDPolicyFactory(),
+		NewCpkPolicyFactory(),               // add the customer-provided key, if any, before the request is signed
 		NewBlobXferRetryPolicyFactory(r),    // actually retry the operation
 		newRetryNotificationPolicyFactory(), // record that a retry status was returned
 		c,
@@ -258,6 +313,9 @@ type jobPartMgr struct {
 
 	blobTypeOverride common.BlobType // User specified blob type
 
+	// User specified extension to content type mappings, consulted before the built-in ones
+	contentTypeOverrides map[string]string
+
 	preserveLastModifiedTime bool
 
 	newJobXfer newJobXfer // Method used to start the transfer
@@ -286,12 +344,50 @@ type jobPartMgr struct {
 	atomicTransfersCompleted uint32
 	atomicTransfersFailed    uint32
 	atomicTransfersSkipped   uint32
+
+	// the transfers that the resume of the job has reset after they failed, so that they are backed off before being started again.
+	// Unlike their retry counts, this isn't persisted.
+	retryingTransfers sync.Map
+
+	// the context that the part's transfers were scheduled with, from which those that are retried during the run get theirs
+	jobCtx context.Context
 }
 
 func (jpm *jobPartMgr) getOverwritePrompter() *overwritePrompter {
 	return jpm.jobMgr.getOverwritePrompter()
 }
 
+func (jpm *jobPartMgr) getImmutabilityWarning() *sync.Once {
+	return jpm.jobMgr.getImmutabilityWarning()
+}
+
+func (jpm *jobPartMgr) transferSlots() chan struct{} {
+	return jpm.jobMgr.transferSlots()
+}
+
+// isJobPaused reports whether the job that owns this part has been paused.
+// The status of part 0 is the status of the job as a whole.
+func (jpm *jobPartMgr) isJobPaused() bool {
+	jpm0, ok := jpm.jobMgr.JobPartMgr(0)
+	return ok && jpm0.Plan().JobStatus() == common.EJobStatus.Paused()
+}
+
+// isJobCancelling reports whether the job that owns this part is being cancelled.
+func (jpm *jobPartMgr) isJobCancelling() bool {
+	jpm0, ok := jpm.jobMgr.JobPartMgr(0)
+	return ok && jpm0.Plan().JobStatus() == common.EJobStatus.Cancelling()
+}
+
+// isJobStoppedByMaxTotalBytes reports whether the job that owns this part was stopped because of its MaxTotalBytes
+func (jpm *jobPartMgr) isJobStoppedByMaxTotalBytes() bool {
+	return jpm.jobMgr.isStoppedByMaxTotalBytes()
+}
+
+// reserveBytes counts n bytes against the MaxTotalBytes of the job that owns this part, and returns whether they fit
+func (jpm *jobPartMgr) reserveBytes(n uint64) bool {
+	return jpm.jobMgr.reserveBytes(n)
+}
+
 func (jpm *jobPartMgr) getFolderCreationTracker() common.FolderCreationTracker {
 	if jpm.jobMgrInitState == nil || jpm.jobMgrInitState.folderCreationTracker == nil {
 		panic("folderCreationTracker should have been initialized already")
@@ -302,18 +398,53 @@ func (jpm *jobPartMgr) getFolderCreationTracker() common.FolderCreationTracker {
 
 func (jpm *jobPartMgr) Plan() *JobPartPlanHeader { return jpm.planMMF.Plan() }
 
+// transferSchedulingOrder returns the indexes of the plan's transfers, in the order in which they are to be scheduled.
+// Transfers whose sources are the same size keep their plan order. The plan itself is never reordered.
+func transferSchedulingOrder(plan *JobPartPlanHeader, order common.TransferOrder) []uint32 {
+	transfers := make([]uint32, plan.NumTransfers)
+	for t := range transfers {
+		transfers[t] = uint32(t)
+	}
+	switch order {
+	case common.ETransferOrder.LargestFirst():
+		sort.SliceStable(transfers, func(i, j int) bool {
+			return plan.Transfer(transfers[i]).SourceSize > plan.Transfer(transfers[j]).SourceSize
+		})
+	case common.ETransferOrder.SmallestFirst():
+		sort.SliceStable(transfers, func(i, j int) bool {
+			return plan.Transfer(transfers[i]).SourceSize < plan.Transfer(transfers[j]).SourceSize
+		})
+	}
+	return transfers
+}
+
 // ScheduleTransfers schedules this job part's transfers. It is called when a new job part is ordered & is also called to resume a paused Job
 func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	jpm.atomicTransfersDone = 0 // Reset the # of transfers done back to 0
 	// partplan file is opened and mapped when job part is added
 	//jpm.planMMF = jpm.filename.Map() // Open the job part plan file & memory-map it in
 	plan := jpm.planMMF.Plan()
+	if plan.DryRun {
+		// Dry-run parts only record the plan; nothing must be transferred
+		jpm.Log(pipeline.LogError, "refusing to schedule transfers of a dry-run job part")
+		return
+	}
 	if plan.PartNum == 0 && plan.NumTransfers == 0 {
 		/* This will wind down the transfer and report summary */
 		plan.SetJobStatus(common.EJobStatus.Completed())
+		plan.SetJobCompletionTime(time.Now())
 		return
 	}
 
+	// blob data encrypted with a customer-provided key can only be written or read with that key
+	cpkInfo, err := plan.CpkInfo()
+	if err != nil {
+		// resuming checks the key up front, so this is not expected; the transfers will fail on the service's CPK errors
+		jpm.Log(pipeline.LogError, fmt.Sprintf("cannot use the customer-provided key: %s", err))
+	} else if cpkInfo != nil {
+		jobCtx = context.WithValue(jobCtx, CpkInfoOverride, *cpkInfo)
+	}
+
 	// get the list of include / exclude transfers
 	includeTransfer, excludeTransfer := jpm.jobMgr.IncludeExclude()
 	if len(includeTransfer) > 0 || len(excludeTransfer) > 0 {
@@ -336,7 +467,7 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	jpm.pageBlobTier = dstData.PageBlobTier
 
 	// For this job part, split the metadata string apart and create an common.Metadata out of it
-	metadataString := string(dstData.Metadata[:dstData.MetadataLength])
+	metadataString := plan.Metadata()
 	jpm.metadata = common.Metadata{}
 	if len(metadataString) > 0 {
 		for _, keyAndValue := range strings.Split(metadataString, ";") { // key/value pairs are separated by ';'
@@ -344,16 +475,9 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 			jpm.metadata[kv[0]] = kv[1]
 		}
 	}
+	jpm.contentTypeOverrides = plan.ContentTypeOverrides()
 	blobTagsStr := string(dstData.BlobTags[:dstData.BlobTagsLength])
-	jpm.blobTags = common.BlobTags{}
-	if len(blobTagsStr) > 0 {
-		for _, keyAndValue := range strings.Split(blobTagsStr, "&") { // key/value pairs are separated by '&'
-			kv := strings.Split(keyAndValue, "=") // key/value are separated by '='
-			key, _ := url.QueryUnescape(kv[0])
-			value, _ := url.QueryUnescape(kv[1])
-			jpm.blobTags[key] = value
-		}
-	}
+	jpm.blobTags = common.ToCommonBlobTagsMap(blobTagsStr)
 
 	jpm.preserveLastModifiedTime = plan.DstLocalData.PreserveLastModifiedTime
 
@@ -363,38 +487,51 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	jpm.priority = plan.Priority
 
 	jpm.createPipelines(jobCtx) // pipeline is created per job part manager
+	jpm.jobCtx = jobCtx
 
 	// *** Schedule this job part's transfers ***
-	for t := uint32(0); t < plan.NumTransfers; t++ {
+	for _, t := range transferSchedulingOrder(plan, jpm.jobMgr.getInMemoryTransitJobState().transferOrder) {
 		jppt := plan.Transfer(t)
 		ts := jppt.TransferStatus()
-		if ts == common.ETransferStatus.Success() {
-			jpm.ReportTransferDone(ts) // Don't schedule an already-completed/failed transfer
+		if ts == common.ETransferStatus.Success() || ts.WasSkipped() {
+			jpm.ReportTransferDone(ts) // Don't schedule an already-completed/skipped transfer
 			continue
 		}
 
-		// If the transfer was failed, then while rescheduling the transfer marking it Started.
+		// If the transfer was failed or paused, then while rescheduling the transfer marking it Started.
+		// A failed transfer's staged chunks were cleaned up, so it must restart from chunk 0.
+		// A paused transfer keeps its chunk bitmap, so only the chunks that were not yet staged are sent again.
+		_, retrying := jpm.retryingTransfers.Load(t)
+		jpm.retryingTransfers.Delete(t)
 		if ts == common.ETransferStatus.Failed() {
+			if !jppt.TryStartRetry(plan.MaxTransferRetries()) {
+				// this transfer has failed too many times already; give up on it rather than retrying forever
+				jpm.ReportTransferDone(ts)
+				continue
+			}
+			jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+			plan.ResetChunkBitmap(t, 0)
+			retrying = true
+		} else if ts == common.ETransferStatus.Paused() || ts == common.ETransferStatus.Stalled() {
 			jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
 		}
 
-		// Each transfer gets its own context (so any chunk can cancel the whole transfer) based off the job's context
-		transferCtx, transferCancel := context.WithCancel(jobCtx)
-		// Initialize a job part transfer manager
-		jptm := &jobPartTransferMgr{
-			jobPartMgr:          jpm,
-			jobPartPlanTransfer: jppt,
-			transferIndex:       t,
-			ctx:                 transferCtx,
-			cancel:              transferCancel,
-			//TODO: insert the factory func interface in jptm.
-			// numChunks will be set by the transfer's prologue method
-		}
+		jptm := jpm.newTransferMgr(jobCtx, t)
 		if jpm.ShouldLog(pipeline.LogInfo) {
 			jpm.Log(pipeline.LogInfo, fmt.Sprintf("scheduling JobID=%v, Part#=%d, Transfer#=%d, priority=%v", plan.JobID, plan.PartNum, t, plan.Priority))
 		}
 
-		JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm)
+		if retrying {
+			// Don't let all the transfers that failed together, e.g. because the service was throttling us, start again at once
+			delay := transferRetryBackoff(jppt.RetryCount())
+			if jpm.ShouldLog(pipeline.LogInfo) {
+				jpm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v, Part#=%d, Transfer#=%d will be retried (retry %d) after %v",
+					plan.JobID, plan.PartNum, t, jppt.RetryCount(), delay))
+			}
+			time.AfterFunc(delay, func() { JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm) })
+		} else {
+			JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm)
+		}
 
 		// This sets the atomic variable atomicAllTransfersScheduled to 1
 		// atomicAllTransfersScheduled variables is used in case of resume job
@@ -410,6 +547,123 @@ func (jpm *jobPartMgr) ScheduleTransfers(jobCtx context.Context) {
 	}
 }
 
+// newTransferMgr creates the manager of one run of the given transfer
+func (jpm *jobPartMgr) newTransferMgr(jobCtx context.Context, t uint32) *jobPartTransferMgr {
+	plan := jpm.planMMF.Plan()
+	// Each transfer gets its own context (so any chunk can cancel the whole transfer) based off the job's context
+	transferCtx, transferCancel := context.WithCancel(jobCtx)
+	// Only uploads and downloads move their data through us, so only they can tell a stall from a slow service-side copy
+	if (plan.FromTo.IsUpload() || plan.FromTo.IsDownload()) && getTransferStallTimeout() > 0 {
+		transferCtx = withTransferProgress(transferCtx, newTransferProgress())
+	}
+	// Initialize a job part transfer manager
+	jptm := &jobPartTransferMgr{
+		jobPartMgr:          jpm,
+		jobPartPlanTransfer: plan.Transfer(t),
+		transferIndex:       t,
+		ctx:                 transferCtx,
+		cancel:              transferCancel,
+		//TODO: insert the factory func interface in jptm.
+		// numChunks will be set by the transfer's prologue method
+	}
+	if plan.LogFormat == common.ELogFormat.Json() {
+		// so that the requests the transfer makes are logged as its events
+		jptm.ctx = withRequestEventLogger(transferCtx, jptm)
+	}
+	return jptm
+}
+
+// retryTransfer starts the given (failed) transfer again from its first chunk, after a back-off, without waiting for the job to be
+// resumed. It returns false, and leaves the transfer as it is, if the transfer has already been retried as many times as it may be.
+func (jpm *jobPartMgr) retryTransfer(t uint32) bool {
+	plan := jpm.planMMF.Plan()
+	jppt := plan.Transfer(t)
+	if !jppt.TryStartRetry(plan.MaxTransferRetries()) {
+		return false
+	}
+	jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+	plan.ResetChunkBitmap(t, 0)
+
+	jptm := jpm.newTransferMgr(jpm.jobCtx, t)
+	delay := transferRetryBackoff(jppt.RetryCount())
+	if jpm.ShouldLog(pipeline.LogInfo) {
+		jpm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v, Part#=%d, Transfer#=%d will be retried (retry %d) after %v",
+			plan.JobID, plan.PartNum, t, jppt.RetryCount(), delay))
+	}
+	time.AfterFunc(delay, func() { JobsAdmin.(*jobsAdmin).ScheduleTransfer(jpm.priority, jptm) })
+	return true
+}
+
+const (
+	transferRetryBaseDelay = 2 * time.Second
+	transferRetryMaxDelay  = time.Minute
+)
+
+// transferRetryBackoff returns how long to wait before starting a failed transfer again, given its retry count (including this retry).
+// The delay doubles with each retry, up to a maximum, and has some jitter so that transfers that failed together are spread out.
+func transferRetryBackoff(retryCount uint32) time.Duration {
+	if retryCount == 0 {
+		return 0
+	}
+	delay := transferRetryMaxDelay
+	if retryCount < 32 { // beyond that, the shift would overflow
+		if d := transferRetryBaseDelay << (retryCount - 1); d > 0 && d < transferRetryMaxDelay {
+			delay = d
+		}
+	}
+
+	// Jitter of [0.8, 1.3), as for the retries of individual requests
+	return time.Duration(float32(delay) * (rand.Float32()/2 + 0.8)) // NOTE: We want math/rand; not crypto/rand
+}
+
+// noteTransferRetry records that the resume of the job has reset the given transfer after it failed
+func (jpm *jobPartMgr) noteTransferRetry(transferIndex uint32) {
+	jpm.retryingTransfers.Store(transferIndex, struct{}{})
+}
+
+// resetTransfersToResume resets the transfers of the part that are to run again when the job is resumed, and returns how many it reset.
+// Those are the transfers that failed, and those that were paused in flight; or, if failedOnly, just those that failed.
+// Skipped transfers keep their status either way, so that whatever made us skip them is not evaluated again.
+func (jpm *jobPartMgr) resetTransfersToResume(failedOnly bool) (numReset int) {
+	jpp := jpm.Plan()
+	for t := uint32(0); t < jpp.NumTransfers; t++ {
+		// transferHeader represents the memory map transfer header of transfer at index position for given job and part number
+		jppt := jpp.Transfer(t)
+		// If the transfer status is less than -1, it means the transfer failed because of some reason.
+		// If it is paused, it was stopped in flight when the job was paused.
+		// Transfer Status needs to reset.
+		ts := jppt.TransferStatus()
+		shouldReset := (ts <= common.ETransferStatus.Failed() && !ts.WasSkipped()) || ts == common.ETransferStatus.Paused()
+		if failedOnly {
+			shouldReset = ts.DidFail()
+		}
+		if !shouldReset {
+			continue
+		}
+		// A transfer that keeps failing is left as failed, rather than being retried forever
+		if ts.DidFail() && !jppt.TryStartRetry(jpp.MaxTransferRetries()) {
+			if jpm.ShouldLog(pipeline.LogInfo) {
+				jpm.Log(pipeline.LogInfo, fmt.Sprintf("JobID=%v, Part#=%d, Transfer#=%d not retried, since it has already been retried %d times",
+					jpp.JobID, jpp.PartNum, t, jppt.RetryCount()))
+			}
+			continue
+		}
+		jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+		jppt.SetErrorCode(0, true)
+		jpp.SetErrorMessage(t, "")
+		jpp.SetDestVersionID(t, "")
+		// Staged chunks of a failed transfer were cleaned up, so they must be sent again
+		if ts != common.ETransferStatus.Paused() {
+			jpp.ResetChunkBitmap(t, 0)
+		}
+		if ts.DidFail() {
+			jpm.noteTransferRetry(t)
+		}
+		numReset++
+	}
+	return numReset
+}
+
 func (jpm *jobPartMgr) ScheduleChunks(chunkFunc chunkFunc) {
 	JobsAdmin.ScheduleChunk(jpm.priority, chunkFunc)
 }
@@ -442,11 +696,12 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 	}
 	// TODO: Consider to remove XferRetryPolicy and Options?
 	xferRetryOption := XferRetryOptions{
-		Policy:        0,
-		MaxTries:      UploadMaxTries, // TODO: Consider to unify options.
-		TryTimeout:    UploadTryTimeout,
-		RetryDelay:    UploadRetryDelay,
-		MaxRetryDelay: UploadMaxRetryDelay}
+		Policy:               0,
+		MaxTries:             UploadMaxTries, // TODO: Consider to unify options.
+		TryTimeout:           UploadTryTimeout,
+		RetryDelay:           UploadRetryDelay,
+		MaxRetryDelay:        UploadMaxRetryDelay,
+		RetryableStatusCodes: retryableStatusCodesFromEnvironment()}
 
 	var statsAccForSip *pipelineNetworkStats = nil // we don't accumulate stats on the source info provider
 
@@ -546,6 +801,12 @@ func (jpm *jobPartMgr) createPipelines(ctx context.Context) {
 	default:
 		panic(fmt.Errorf("Unrecognized from-to: %q", fromTo.String()))
 	}
+
+	// If the job's SAS tokens can be refreshed, its requests must use the newest ones
+	if jpm.jobMgr.getInMemoryTransitJobState().sasTokenProvider != nil {
+		jpm.pipeline = newSASRefreshingPipeline(jpm.pipeline, jpm.jobMgr.getSASTokens())
+		jpm.sourceProviderPipeline = newSASRefreshingPipeline(jpm.sourceProviderPipeline, jpm.jobMgr.getSASTokens())
+	}
 }
 
 func (jpm *jobPartMgr) SlicePool() common.ByteSlicePooler {
@@ -572,6 +833,10 @@ func (jpm *jobPartMgr) GetOverwriteOption() common.OverwriteOption {
 	return jpm.Plan().ForceWrite
 }
 
+func (jpm *jobPartMgr) GetSourceNewerTolerance() time.Duration {
+	return jpm.Plan().SourceNewerTolerance
+}
+
 func (jpm *jobPartMgr) GetForceIfReadOnly() bool {
 	return jpm.Plan().ForceIfReadOnly
 }
@@ -614,6 +879,11 @@ var builtinTypes = map[string]string{
 func (jpm *jobPartMgr) inferContentType(fullFilePath string, dataFileToXfer []byte) string {
 	fileExtension := filepath.Ext(fullFilePath)
 
+	// the user's own mappings win over everything else
+	if override, ok := jpm.contentTypeOverrides[strings.ToLower(fileExtension)]; ok {
+		return override
+	}
+
 	// short-circuit for common static website files
 	// mime.TypeByExtension takes the registry into account, which is most often undesirable in practice
 	if override, ok := builtinTypes[strings.ToLower(fileExtension)]; ok {
@@ -625,8 +895,9 @@ func (jpm *jobPartMgr) inferContentType(fullFilePath string, dataFileToXfer []by
 	 * charset if it exists, safer to omit charset instead of defaulting to
 	 * a wrong one.
 	 */
-	if guessedType := mime.TypeByExtension(fileExtension); guessedType != "" {
-		return strings.Split(guessedType, ";")[0]
+	// registry entries can be arbitrarily long, so ignore any that wouldn't fit in a header we could set ourselves
+	if guessedType := strings.Split(mime.TypeByExtension(fileExtension), ";")[0]; guessedType != "" && len(guessedType) <= CustomHeaderMaxBytes {
+		return guessedType
 	}
 
 	return strings.Split(http.DetectContentType(dataFileToXfer), ";")[0]
@@ -676,11 +947,13 @@ func (jpm *jobPartMgr) updateJobPartProgress(status common.TransferStatus) {
 	switch status {
 	case common.ETransferStatus.Success():
 		atomic.AddUint32(&jpm.atomicTransfersCompleted, 1)
-	case common.ETransferStatus.Failed(), common.ETransferStatus.BlobTierFailure():
+	case common.ETransferStatus.Failed(), common.ETransferStatus.BlobTierFailure(), common.ETransferStatus.Corrupted(),
+		common.ETransferStatus.PreconditionFailed():
 		atomic.AddUint32(&jpm.atomicTransfersFailed, 1)
-	case common.ETransferStatus.SkippedEntityAlreadyExists(), common.ETransferStatus.SkippedBlobHasSnapshots():
+	case common.ETransferStatus.SkippedEntityAlreadyExists(), common.ETransferStatus.SkippedBlobHasSnapshots(),
+		common.ETransferStatus.ExceededMaxTotalBytes():
 		atomic.AddUint32(&jpm.atomicTransfersSkipped, 1)
-	case common.ETransferStatus.Cancelled():
+	case common.ETransferStatus.Cancelled(), common.ETransferStatus.Paused():
 	default:
 		jpm.Log(pipeline.LogError, fmt.Sprintf("Unexpected status: %v", status.String()))
 	}
@@ -690,6 +963,7 @@ func (jpm *jobPartMgr) updateJobPartProgress(status common.TransferStatus) {
 func (jpm *jobPartMgr) ReportTransferDone(status common.TransferStatus) (transfersDone uint32) {
 	transfersDone = atomic.AddUint32(&jpm.atomicTransfersDone, 1)
 	jpm.updateJobPartProgress(status)
+	jpm.jobMgr.noteTransferDone()
 
 	//Add a safety count-check
 
@@ -736,6 +1010,9 @@ func (jpm *jobPartMgr) ReleaseAConnection() {
 func (jpm *jobPartMgr) ShouldLog(level pipeline.LogLevel) bool  { return jpm.jobMgr.ShouldLog(level) }
 func (jpm *jobPartMgr) Log(level pipeline.LogLevel, msg string) { jpm.jobMgr.Log(level, msg) }
 func (jpm *jobPartMgr) Panic(err error)                         { jpm.jobMgr.Panic(err) }
+func (jpm *jobPartMgr) LogEvent(level pipeline.LogLevel, event common.LogEvent, transferPath string, msg string) {
+	jpm.jobMgr.LogEvent(level, event, transferPath, msg)
+}
 func (jpm *jobPartMgr) ChunkStatusLogger() common.ChunkStatusLogger {
 	return jpm.jobMgr.ChunkStatusLogger()
 }
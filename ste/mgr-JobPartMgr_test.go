@@ -21,9 +21,17 @@
 package ste
 
 import (
-	chk "gopkg.in/check.v1"
+	"context"
+	"fmt"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
 )
 
 // Hookup to the testing framework
@@ -60,3 +68,279 @@ func (s *jobPartMgrTestSuite) TestInferContentType(c *chk.C) {
 		c.Assert(strings.Contains(contentType, expectedType), chk.Equals, true)
 	}
 }
+
+func (s *jobPartMgrTestSuite) TestInferContentTypeWithOverrides(c *chk.C) {
+	partMgr := jobPartMgr{contentTypeOverrides: map[string]string{
+		".md":   "text/markdown",
+		".html": "text/html; charset=utf-8",
+	}}
+
+	c.Assert(partMgr.inferContentType("/usr/foo/README.md", make([]byte, 5)), chk.Equals, "text/markdown")
+	c.Assert(partMgr.inferContentType("/usr/foo/README.MD", make([]byte, 5)), chk.Equals, "text/markdown")
+	// overrides are used as given, and win over the built-in types
+	c.Assert(partMgr.inferContentType("/usr/foo/index.html", make([]byte, 5)), chk.Equals, "text/html; charset=utf-8")
+	// everything else is detected as before
+	c.Assert(partMgr.inferContentType("/usr/foo/style.css", make([]byte, 5)), chk.Equals, "text/css")
+	c.Assert(partMgr.inferContentType("/usr/foo/no/extension", make([]byte, 5)), chk.Equals, "application/octet-stream")
+}
+
+func (s *jobPartMgrTestSuite) TestContentTypeOverridesAreKeptInThePlan(c *chk.C) {
+	scheduled := make(chan IJobPartTransferMgr, 1)
+	defer useTestJobsAdmin(c, &jobsAdmin{coordinatorChannels: CoordinatorChannels{normalTransferCh: scheduled}})()
+
+	overrides := map[string]string{".md": "text/markdown", ".html": "text/html; charset=utf-8"}
+	jobID := common.NewJobID()
+	order := newTestOrder(jobID, 0, "/README.md")
+	order.CommandString = "copy src dst --content-type-overrides overrides.json"
+	order.BlobAttributes.Metadata = "a=b"
+	order.ContentTypeOverrides = overrides
+	order.Transfers[0].SourceSize = 10
+	planFile := createTestPlanFile(order)
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+	plan := mmf.Plan()
+
+	// they are stored between the metadata and the transfers, which are still where they should be
+	c.Assert(plan.ContentTypeOverrides(), chk.DeepEquals, overrides)
+	c.Assert(plan.Metadata(), chk.Equals, "a=b")
+	src, dst, _ := plan.TransferSrcDstStrings(0)
+	c.Assert(src, chk.Equals, testSourceRoot+"/README.md")
+	c.Assert(dst, chk.Equals, testDestinationRoot+"/README.md")
+	c.Assert(plan.Transfer(0).SourceSize, chk.Equals, int64(10))
+
+	// so a part that is loaded from its plan, as when the job is resumed, uses them
+	jm := &jobMgr{logger: discardingJobLogger{}, include: map[string]int{}, exclude: map[string]int{}}
+	jm.setInMemoryTransitJobState(InMemoryTransitJobState{credentialInfo: common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}})
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: mmf}
+	jpm.ScheduleTransfers(context.Background())
+	c.Assert(jpm.inferContentType(src, make([]byte, 5)), chk.Equals, "text/markdown")
+
+	// while a plan without them has none
+	other := createTestPlanFile(newTestOrder(jobID, 1, "/a")).Map()
+	defer other.Unmap()
+	c.Assert(other.Plan().ContentTypeOverrides(), chk.IsNil)
+}
+
+func (s *jobPartMgrTestSuite) TestResetTransfersToResume(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	statuses := []common.TransferStatus{
+		common.ETransferStatus.Success(),
+		common.ETransferStatus.Failed(),
+		common.ETransferStatus.SkippedEntityAlreadyExists(),
+		common.ETransferStatus.Paused(),
+		common.ETransferStatus.Failed(), // and already retried as often as it may be
+		common.ETransferStatus.NotStarted(),
+	}
+	// lays out a finished part whose transfers ended as above
+	newPart := func(partNum common.PartNumber) *jobPartMgr {
+		names := make([]string, len(statuses))
+		for i := range statuses {
+			names[i] = fmt.Sprintf("/%d", i)
+		}
+		order := newTestOrder(common.NewJobID(), partNum, names...)
+		order.MaxRetries = 1
+		mmf := createTestPlanFile(order).Map()
+		plan := mmf.Plan()
+		for t, status := range statuses {
+			plan.Transfer(uint32(t)).SetTransferStatus(status, true)
+			if status.DidFail() {
+				plan.SetErrorMessage(uint32(t), "failed")
+			}
+		}
+		c.Assert(plan.Transfer(4).TryStartRetry(plan.MaxTransferRetries()), chk.Equals, true)
+		return newTestJobPartMgr(mmf)
+	}
+	statusesAfter := func(jpm *jobPartMgr) []common.TransferStatus {
+		var result []common.TransferStatus
+		for t := range statuses {
+			result = append(result, jpm.Plan().Transfer(uint32(t)).TransferStatus())
+		}
+		return result
+	}
+
+	// --failed-only resets just the transfer that failed and may still be retried, and leaves all the others as they were
+	jpm := newPart(0)
+	defer jpm.planMMF.Unmap()
+	c.Assert(jpm.resetTransfersToResume(true), chk.Equals, 1)
+	c.Assert(statusesAfter(jpm), chk.DeepEquals, []common.TransferStatus{
+		common.ETransferStatus.Success(),
+		common.ETransferStatus.Started(),
+		common.ETransferStatus.SkippedEntityAlreadyExists(),
+		common.ETransferStatus.Paused(),
+		common.ETransferStatus.Failed(),
+		common.ETransferStatus.NotStarted(),
+	})
+	plan := jpm.Plan()
+	c.Assert(plan.Transfer(1).RetryCount(), chk.Equals, uint32(1))
+	c.Assert(plan.ErrorMessage(1), chk.Equals, "")
+	c.Assert(plan.ErrorMessage(4), chk.Equals, "failed")
+	_, retrying := jpm.retryingTransfers.Load(uint32(1))
+	c.Assert(retrying, chk.Equals, true)
+
+	// while an ordinary resume also picks up the transfer that was paused in flight
+	jpm = newPart(1)
+	defer jpm.planMMF.Unmap()
+	c.Assert(jpm.resetTransfersToResume(false), chk.Equals, 2)
+	c.Assert(statusesAfter(jpm), chk.DeepEquals, []common.TransferStatus{
+		common.ETransferStatus.Success(),
+		common.ETransferStatus.Started(),
+		common.ETransferStatus.SkippedEntityAlreadyExists(),
+		common.ETransferStatus.Started(),
+		common.ETransferStatus.Failed(),
+		common.ETransferStatus.NotStarted(),
+	})
+	_, retrying = jpm.retryingTransfers.Load(uint32(3))
+	c.Assert(retrying, chk.Equals, false)
+}
+
+func (s *jobPartMgrTestSuite) TestIsSourceNewer(c *chk.C) {
+	dst := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// equal timestamps are not newer
+	c.Assert(isSourceNewer(dst, dst, 0), chk.Equals, false)
+	// sub-second differences are not kept by the services, so they don't count
+	c.Assert(isSourceNewer(dst.Add(500*time.Millisecond), dst, 0), chk.Equals, false)
+	c.Assert(isSourceNewer(dst, dst.Add(900*time.Millisecond), 0), chk.Equals, false)
+	// a whole second is
+	c.Assert(isSourceNewer(dst.Add(time.Second), dst, 0), chk.Equals, true)
+	c.Assert(isSourceNewer(dst.Add(-time.Second), dst, 0), chk.Equals, false)
+
+	// within the tolerance is not newer
+	c.Assert(isSourceNewer(dst.Add(2*time.Second), dst, 2*time.Second), chk.Equals, false)
+	c.Assert(isSourceNewer(dst.Add(3*time.Second), dst, 2*time.Second), chk.Equals, true)
+}
+
+func (s *jobPartMgrTestSuite) TestTryTakeTransferSlot(c *chk.C) {
+	jm := &jobMgr{transferSlotsHolder: &atomic.Value{}}
+	jpm := &jobPartMgr{jobMgr: jm}
+
+	// no limit: nothing is held
+	first := &jobPartTransferMgr{jobPartMgr: jpm, ctx: context.Background()}
+	c.Assert(first.TryTakeTransferSlot(), chk.Equals, true)
+	c.Assert(first.heldTransferSlot, chk.IsNil)
+
+	jm.SetTransferConcurrency(1)
+	c.Assert(first.TryTakeTransferSlot(), chk.Equals, true)
+	c.Assert(first.heldTransferSlot, chk.NotNil)
+
+	// a rescheduled transfer keeps the slot it already holds
+	c.Assert(first.TryTakeTransferSlot(), chk.Equals, true)
+	c.Assert(len(jm.transferSlots()), chk.Equals, 1)
+
+	// with every slot taken, another transfer doesn't wait for one
+	second := &jobPartTransferMgr{jobPartMgr: jpm, ctx: context.Background()}
+	c.Assert(second.TryTakeTransferSlot(), chk.Equals, false)
+	c.Assert(second.heldTransferSlot, chk.IsNil)
+
+	// until the first gives its slot up
+	first.releaseTransferSlot()
+	c.Assert(second.TryTakeTransferSlot(), chk.Equals, true)
+
+	jm.SetTransferConcurrency(0)
+	c.Assert(jm.transferSlots(), chk.IsNil)
+}
+
+// slotTestJptm is a transfer that notes how a transfer worker handles it, when its job does or doesn't have a free transfer slot
+type slotTestJptm struct {
+	IJobPartTransferMgr
+	hasSlot        bool
+	rescheduledFor time.Duration
+	started        bool
+}
+
+func (t *slotTestJptm) WasCanceled() bool                       { return false }
+func (t *slotTestJptm) IsJobCancelling() bool                   { return false }
+func (t *slotTestJptm) IsJobPaused() bool                       { return false }
+func (t *slotTestJptm) TryTakeTransferSlot() bool               { return t.hasSlot }
+func (t *slotTestJptm) RescheduleTransferAfter(d time.Duration) { t.rescheduledFor = d }
+func (t *slotTestJptm) ReserveBytes() bool                      { return true }
+func (t *slotTestJptm) ShouldLog(pipeline.LogLevel) bool        { return false }
+func (t *slotTestJptm) StartJobXfer()                           { t.started = true }
+
+func (s *jobPartMgrTestSuite) TestTransferWithoutSlotDoesNotHoldWorker(c *chk.C) {
+	// the worker returns at once, having rescheduled the transfer, so that it can go on to other jobs' transfers
+	waiting := &slotTestJptm{}
+	startTransfer(waiting, 0)
+	c.Assert(waiting.started, chk.Equals, false)
+	c.Assert(waiting.rescheduledFor, chk.Equals, transferSlotRetryInterval)
+
+	ready := &slotTestJptm{hasSlot: true}
+	startTransfer(ready, 0)
+	c.Assert(ready.started, chk.Equals, true)
+	c.Assert(ready.rescheduledFor, chk.Equals, time.Duration(0))
+}
+
+func (s *jobPartMgrTestSuite) TestTransferRetryBackoff(c *chk.C) {
+	c.Assert(transferRetryBackoff(0), chk.Equals, time.Duration(0))
+
+	// the jitter is [0.8, 1.3), so each delay must lie in that range around the doubling (and capped) base
+	for retryCount := uint32(1); retryCount <= TransferMaxRetries; retryCount++ {
+		base := transferRetryBaseDelay << (retryCount - 1)
+		if base > transferRetryMaxDelay {
+			base = transferRetryMaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			delay := transferRetryBackoff(retryCount)
+			c.Assert(delay >= time.Duration(float32(base)*0.8), chk.Equals, true, chk.Commentf("retry %d: %v", retryCount, delay))
+			c.Assert(delay < time.Duration(float32(base)*1.3), chk.Equals, true, chk.Commentf("retry %d: %v", retryCount, delay))
+		}
+	}
+
+	// a count that would overflow the doubling is still capped
+	c.Assert(transferRetryBackoff(100) < time.Duration(float32(transferRetryMaxDelay)*1.3), chk.Equals, true)
+}
+
+func (s *jobPartMgrTestSuite) TestTransferSchedulingOrder(c *chk.C) {
+	scheduled := make(chan IJobPartTransferMgr, 5)
+	defer useTestJobsAdmin(c, &jobsAdmin{coordinatorChannels: CoordinatorChannels{normalTransferCh: scheduled}})()
+
+	sizes := []int64{30, 10, 50, 10, 20}
+	names := make([]string, len(sizes))
+	for i := range sizes {
+		names[i] = fmt.Sprintf("/file%d", i)
+	}
+	order := newTestOrder(common.NewJobID(), 0, names...)
+	for i, size := range sizes {
+		order.Transfers[i].SourceSize = size
+	}
+	mmf := createTestPlanFile(order).Map()
+	defer mmf.Unmap()
+	plan := mmf.Plan()
+
+	// transfers of the same size keep their plan order
+	c.Assert(transferSchedulingOrder(plan, common.ETransferOrder.Plan()), chk.DeepEquals, []uint32{0, 1, 2, 3, 4})
+	c.Assert(transferSchedulingOrder(plan, common.ETransferOrder.LargestFirst()), chk.DeepEquals, []uint32{2, 0, 4, 1, 3})
+	c.Assert(transferSchedulingOrder(plan, common.ETransferOrder.SmallestFirst()), chk.DeepEquals, []uint32{1, 3, 4, 0, 2})
+
+	// ScheduleTransfers hands the transfers to the scheduler in that order
+	scheduledSizes := func(order common.TransferOrder) []int64 {
+		jm := &jobMgr{logger: discardingJobLogger{}, include: map[string]int{}, exclude: map[string]int{}}
+		jm.setInMemoryTransitJobState(InMemoryTransitJobState{transferOrder: order, credentialInfo: common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}})
+		jpm := &jobPartMgr{jobMgr: jm, planMMF: mmf}
+		jpm.ScheduleTransfers(context.Background())
+		var result []int64
+		for len(scheduled) > 0 {
+			result = append(result, (<-scheduled).(*jobPartTransferMgr).jobPartPlanTransfer.SourceSize)
+		}
+		return result
+	}
+	c.Assert(scheduledSizes(common.ETransferOrder.Plan()), chk.DeepEquals, sizes)
+	c.Assert(scheduledSizes(common.ETransferOrder.LargestFirst()), chk.DeepEquals, []int64{50, 30, 20, 10, 10})
+	c.Assert(scheduledSizes(common.ETransferOrder.SmallestFirst()), chk.DeepEquals, []int64{10, 10, 20, 30, 50})
+
+	// only the scheduling is reordered; the plan keeps its transfers where they were
+	for t, size := range sizes {
+		c.Assert(plan.Transfer(uint32(t)).SourceSize, chk.Equals, size)
+	}
+}
+
+func (s *jobPartMgrTestSuite) TestParseTransferOrder(c *chk.C) {
+	var order common.TransferOrder
+	c.Assert(order, chk.Equals, common.ETransferOrder.Plan())
+	c.Assert(order.Parse("largestfirst"), chk.IsNil)
+	c.Assert(order, chk.Equals, common.ETransferOrder.LargestFirst())
+	c.Assert(order.Parse("SmallestFirst"), chk.IsNil)
+	c.Assert(order, chk.Equals, common.ETransferOrder.SmallestFirst())
+	c.Assert(order.Parse("Random"), chk.NotNil)
+}
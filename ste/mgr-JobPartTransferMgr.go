@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -24,7 +25,9 @@ type IJobPartTransferMgr interface {
 	LastModifiedTime() time.Time
 	PreserveLastModifiedTime() (time.Time, bool)
 	ShouldPutMd5() bool
+	ShouldGzipUpload() bool
 	MD5ValidationOption() common.HashValidationOption
+	ChecksumAlgorithm() common.HashAlgorithm
 	BlobTypeOverride() common.BlobType
 	BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier)
 	JobHasLowFileCount() bool
@@ -38,20 +41,38 @@ type IJobPartTransferMgr interface {
 	StartJobXfer()
 	GetOverwriteOption() common.OverwriteOption
 	GetForceIfReadOnly() bool
+	IsSourceNewer(destinationLastModifiedTime time.Time) bool
 	ShouldDecompress() bool
 	GetSourceCompressionType() (common.CompressionType, error)
 	ReportChunkDone(id common.ChunkID) (lastChunk bool, chunksDone uint32)
+	ReportResumedBytes(n int64)
 	TransferStatusIgnoringCancellation() common.TransferStatus
 	SetStatus(status common.TransferStatus)
 	SetErrorCode(errorCode int32)
 	SetNumberOfChunks(numChunks uint32)
+	PrepareChunkTracking(blockSize int64)
+	IsChunkStaged(chunkIndex int32) bool
+	SetChunkStaged(chunkIndex int32)
+	ResetChunkTracking()
+	SetContentDigest(digest []byte, sourceLastModifiedTime time.Time, sourceSize int64)
+	ContentDigest() []byte
+	ContentDigestFor(sourceLastModifiedTime time.Time, sourceSize int64) []byte
 	SetActionAfterLastChunk(f func())
 	ReportTransferDone() uint32
+	TryTakeTransferSlot() bool
 	RescheduleTransfer()
+	RescheduleTransferAfter(delay time.Duration)
 	ScheduleChunks(chunkFunc chunkFunc)
 	SetDestinationIsModified()
+	SetDestinationVersionID(versionID string)
+	AppendStart() (length int64, blocks uint32, ok bool)
+	SetAppendStart(length int64, blocks uint32)
 	Cancel()
 	WasCanceled() bool
+	IsJobCancelling() bool
+	IsJobPaused() bool
+	ReserveBytes() bool
+	IsJobStoppedByMaxTotalBytes() bool
 	IsLive() bool
 	IsDeadBeforeStart() bool
 	IsDeadInflight() bool
@@ -69,6 +90,7 @@ type IJobPartTransferMgr interface {
 	// TODO: Cleanup FailActiveUpload/FailActiveUploadWithStatus & FailActiveS2SCopy/FailActiveS2SCopyWithStatus
 	FailActiveSend(where string, err error)
 	FailActiveSendWithStatus(where string, err error, failureStatus common.TransferStatus)
+	FailSourceChanged(where string, lastModifiedTime time.Time, size int64)
 	LogUploadError(source, destination, errorMsg string, status int)
 	LogDownloadError(source, destination, errorMsg string, status int)
 	LogS2SCopyError(source, destination, errorMsg string, status int)
@@ -81,6 +103,7 @@ type IJobPartTransferMgr interface {
 	LogAtLevelForCurrentTransfer(level pipeline.LogLevel, msg string)
 	GetOverwritePrompter() *overwritePrompter
 	GetFolderCreationTracker() common.FolderCreationTracker
+	GetImmutabilityWarning() *sync.Once
 	common.ILogger
 	DeleteSnapshotsOption() common.DeleteSnapshotsOption
 	SecurityInfoPersistenceManager() *securityInfoPersistenceManager
@@ -90,6 +113,7 @@ type IJobPartTransferMgr interface {
 }
 
 type TransferInfo struct {
+	JobID                  common.JobID
 	BlockSize              int64
 	Source                 string
 	SourceSize             int64
@@ -97,14 +121,32 @@ type TransferInfo struct {
 	EntityType             common.EntityType
 	PreserveSMBPermissions common.PreservePermissionsOption
 	PreserveSMBInfo        bool
+	// PreservePOSIXProperties is as for JobPartPlanHeader
+	PreservePOSIXProperties bool
+	// PreserveACLs is as for JobPartPlanHeader
+	PreserveACLs bool
+	// PreserveImmutability is as for JobPartPlanHeader
+	PreserveImmutability bool
+	// ImmutabilityPolicyExpiresOn and ImmutabilityPolicyMode are the immutability policy to give the destination blob, if ImmutabilityPolicyExpiresOn is not zero
+	ImmutabilityPolicyExpiresOn time.Time
+	ImmutabilityPolicyMode      common.ImmutabilityPolicyMode
+	// SrcImmutability is the immutability policy and legal hold of the source, as recorded in the plan when PreserveImmutability is set
+	SrcImmutability common.BlobImmutability
 
 	// Transfer info for S2S copy
 	SrcProperties
 	S2SGetPropertiesInBackend      bool
 	S2SSourceChangeValidation      bool
+	S2SRehydrateArchivedSource     bool
+	S2SCopyMethod                  common.S2SCopyMethod
+	SkipIfHashMatches              bool
 	DestLengthValidation           bool
 	S2SInvalidMetadataHandleOption common.InvalidMetadataHandleOption
 
+	// DestIfMatch and DestIfNoneMatch are the ETags that writing the destination blob is conditional on (see common.CopyTransfer)
+	DestIfMatch     string
+	DestIfNoneMatch string
+
 	// Blob
 	SrcBlobType    azblob.BlobType       // used for both S2S and for downloads to local from blob
 	S2SSrcBlobTier azblob.AccessTierType // AccessTierType (string) is used to accommodate service-side support matrix change.
@@ -143,6 +185,18 @@ func (i TransferInfo) entityTypeLogIndicator() string {
 	}
 }
 
+// hasDestAccessConditions returns true if writing the destination is conditional on its ETag
+func (i TransferInfo) hasDestAccessConditions() bool {
+	return i.DestIfMatch != "" || i.DestIfNoneMatch != ""
+}
+
+// destBlobAccessConditions returns the conditions, on its ETag, under which the destination blob may be written
+func (i TransferInfo) destBlobAccessConditions() azblob.BlobAccessConditions {
+	return azblob.BlobAccessConditions{
+		ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: azblob.ETag(i.DestIfMatch), IfNoneMatch: azblob.ETag(i.DestIfNoneMatch)},
+	}
+}
+
 type SrcProperties struct {
 	SrcHTTPHeaders common.ResourceHTTPHeaders // User for S2S copy, where per transfer's src properties need be set in destination.
 	SrcMetadata    common.Metadata
@@ -155,10 +209,6 @@ type chunkFunc func(int)
 
 // jobPartTransferMgr represents the runtime information for a Job Part's transfer
 type jobPartTransferMgr struct {
-	// how many bytes have been successfully transferred
-	// (hard to infer from atomicChunksDone because that counts both successes and failures)
-	atomicSuccessfulBytes int64
-
 	// NumberOfChunksDone represents the number of chunks of a transfer
 	// which are either completed or failed.
 	// NumberOfChunksDone determines the final cancellation or completion of a transfer
@@ -173,6 +223,9 @@ type jobPartTransferMgr struct {
 	// used to show whether THIS jptm holds the destination lock
 	atomicDestLockHeldIndicator uint32
 
+	// used to make sure that a rescheduled transfer is not watched for stalls twice
+	atomicStallWatchStartedIndicator uint32
+
 	jobPartMgr          IJobPartMgr // Refers to the "owning" Job Part
 	jobPartPlanTransfer *JobPartPlanTransfer
 	transferIndex       uint32
@@ -189,6 +242,15 @@ type jobPartTransferMgr struct {
 
 	actionAfterLastChunk func()
 
+	// the job's transfer slot held by this transfer, if the job limits its concurrency. Released when the transfer is done
+	heldTransferSlot chan struct{}
+
+	// whether the transfer has counted its data against the job's MaxTotalBytes, so that it doesn't again if it is rescheduled
+	reservedBytes bool
+
+	// whether the transfer is to be started again once it is done, because its source changed while it was being sent
+	retryAfterSourceChange bool
+
 	/*
 		@Parteek removed 3/23 morning, as jeff ad equivalent
 		// transfer chunks are put into this channel and execution engine takes chunk out of this channel.
@@ -203,11 +265,22 @@ func (jptm *jobPartTransferMgr) GetFolderCreationTracker() common.FolderCreation
 	return jptm.jobPartMgr.getFolderCreationTracker()
 }
 
+func (jptm *jobPartTransferMgr) GetImmutabilityWarning() *sync.Once {
+	return jptm.jobPartMgr.getImmutabilityWarning()
+}
+
 func (jptm *jobPartTransferMgr) FromTo() common.FromTo {
 	return jptm.jobPartMgr.Plan().FromTo
 }
 
 func (jptm *jobPartTransferMgr) StartJobXfer() {
+	jptm.jobPartPlanTransfer.SetStartTimeIfNotStarted(time.Now()) // if this is a resume, keep the time of the first run
+	// this attempt counts its bytes afresh: the chunks that an earlier run staged are counted again as the sender skips them,
+	// so what an attempt that was paused (or never ended) counted is dropped, rather than counted for the part as well
+	jptm.jobPartMgr.Plan().DiscardTransferAttempt(jptm.transferIndex)
+	if tp := transferProgressFromContext(jptm.ctx); tp != nil && atomic.CompareAndSwapUint32(&jptm.atomicStallWatchStartedIndicator, 0, 1) {
+		go jptm.watchForStall(tp, getTransferStallTimeout())
+	}
 	jptm.jobPartMgr.StartJobXfer(jptm)
 }
 
@@ -215,6 +288,21 @@ func (jptm *jobPartTransferMgr) GetOverwriteOption() common.OverwriteOption {
 	return jptm.jobPartMgr.GetOverwriteOption()
 }
 
+// IsSourceNewer tells whether the source is newer than a destination with the given last modified time,
+// as required by the IfSourceNewer overwrite option
+func (jptm *jobPartTransferMgr) IsSourceNewer(destinationLastModifiedTime time.Time) bool {
+	return isSourceNewer(jptm.LastModifiedTime(), destinationLastModifiedTime, jptm.jobPartMgr.GetSourceNewerTolerance())
+}
+
+// isSourceNewer returns true only if the source was modified strictly after the destination, by more than the tolerance.
+// The times are compared at whole-second precision, since that's all that the services keep (in Last-Modified).
+// Otherwise a local file modified at 12:00:00.5 would always look newer than its copy, which was recorded as 12:00:00.
+func isSourceNewer(sourceLastModifiedTime, destinationLastModifiedTime time.Time, tolerance time.Duration) bool {
+	src := sourceLastModifiedTime.Truncate(time.Second)
+	dst := destinationLastModifiedTime.Truncate(time.Second)
+	return src.Sub(dst) > tolerance
+}
+
 func (jptm *jobPartTransferMgr) GetForceIfReadOnly() bool {
 	return jptm.jobPartMgr.GetForceIfReadOnly()
 }
@@ -232,6 +320,45 @@ func (jptm *jobPartTransferMgr) GetSourceCompressionType() (common.CompressionTy
 	return common.GetCompressionType(encoding)
 }
 
+// computeBlockSize returns the block size to use for a source of the given size.
+// The plan file needs this too (to size the chunk bitmaps), so it must stay a pure function of its arguments.
+func computeBlockSize(blockSize int64, sourceSize int64) int64 {
+	// If the blockSize is 0, then User didn't provide any blockSize
+	// We need to set the blockSize in such way that number of blocks per blob
+	// does not exceeds 50000 (max number of block per blob)
+	if blockSize == 0 {
+		blockSize = common.DefaultBlockBlobBlockSize
+		for ; getNumChunks(sourceSize, blockSize) > common.MaxNumberOfBlocksPerBlob; blockSize = 2 * blockSize {
+			if blockSize > common.BlockSizeThreshold {
+				/*
+				 * For a RAM usage of 0.5G/core, we would have 4G memory on typical 8 core device, meaning at a blockSize of 256M,
+				 * we can have 4 blocks in core, waiting for a disk or n/w operation. Any higher block size would *sort of*
+				 * serialize n/w and disk operations, and is better avoided.
+				 */
+				// round up, so that the last (partial) block still fits within the limit
+				blockSize = (sourceSize + common.MaxNumberOfBlocksPerBlob - 1) / common.MaxNumberOfBlocksPerBlob
+				break
+			}
+		}
+	}
+	blockSize = common.Iffint64(blockSize > common.MaxBlockBlobBlockSize, common.MaxBlockBlobBlockSize, blockSize)
+	return blockSize
+}
+
+// appendQueryParam adds the given (already encoded) key=value pair to the query string of rawURL
+func appendQueryParam(rawURL string, param string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic(err)
+	}
+	if len(u.RawQuery) > 0 {
+		u.RawQuery += "&" + param
+	} else {
+		u.RawQuery = param
+	}
+	return u.String()
+}
+
 func (jptm *jobPartTransferMgr) Info() TransferInfo {
 	if jptm.transferInfo != nil {
 		return *jptm.transferInfo
@@ -241,8 +368,13 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 	src, dst, _ := plan.TransferSrcDstStrings(jptm.transferIndex)
 	dstBlobData := plan.DstBlobData
 
-	srcHTTPHeaders, srcMetadata, srcBlobType, srcBlobTier, s2sGetPropertiesInBackend, DestLengthValidation, s2sSourceChangeValidation, s2sInvalidMetadataHandleOption, entityType, versionID, blobTags :=
+	srcHTTPHeaders, srcMetadata, srcBlobType, srcBlobTier, s2sGetPropertiesInBackend, DestLengthValidation, s2sSourceChangeValidation, s2sInvalidMetadataHandleOption, entityType, versionID, blobTags, snapshotID :=
 		plan.TransferSrcPropertiesAndMetadata(jptm.transferIndex)
+	destIfMatch, destIfNoneMatch := plan.TransferDstAccessConditions(jptm.transferIndex)
+	if destIfMatch == "" && destIfNoneMatch == "" && jptm.GetOverwriteOption() == common.EOverwriteOption.IfNotExists() {
+		// the service refuses to write a destination that already exists, so nobody has to look it up first
+		destIfNoneMatch = string(azblob.ETagAny)
+	}
 	srcSAS, dstSAS := jptm.jobPartMgr.SAS()
 	// If the length of destination SAS is greater than 0
 	// it means the destination is remote url and destination SAS
@@ -281,51 +413,22 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 	}
 
 	if versionID != "" {
-		versionID = "versionId=" + versionID
-		sURL, e := url.Parse(src)
-		if e != nil {
-			panic(e)
-		}
-		if len(sURL.RawQuery) > 0 {
-			sURL.RawQuery += "&" + versionID
-		} else {
-			sURL.RawQuery = versionID
-		}
-		src = sURL.String()
+		src = appendQueryParam(src, "versionId="+versionID)
 	}
-
-	sourceSize := plan.Transfer(jptm.transferIndex).SourceSize
-	var blockSize = dstBlobData.BlockSize
-	// If the blockSize is 0, then User didn't provide any blockSize
-	// We need to set the blockSize in such way that number of blocks per blob
-	// does not exceeds 50000 (max number of block per blob)
-	if blockSize == 0 {
-		blockSize = common.DefaultBlockBlobBlockSize
-		for ; uint32(sourceSize/blockSize) > common.MaxNumberOfBlocksPerBlob; blockSize = 2 * blockSize {
-			if blockSize > common.BlockSizeThreshold {
-				/*
-				 * For a RAM usage of 0.5G/core, we would have 4G memory on typical 8 core device, meaning at a blockSize of 256M,
-				 * we can have 4 blocks in core, waiting for a disk or n/w operation. Any higher block size would *sort of*
-				 * serialize n/w and disk operations, and is better avoided.
-				 */
-				blockSize = sourceSize / common.MaxNumberOfBlocksPerBlob
-				break
-			}
-		}
+	if snapshotID != "" {
+		src = appendQueryParam(src, "snapshot="+url.QueryEscape(snapshotID))
 	}
-	blockSize = common.Iffint64(blockSize > common.MaxBlockBlobBlockSize, common.MaxBlockBlobBlockSize, blockSize)
 
-	var srcBlobTags common.BlobTags
-	if blobTags != nil {
-		srcBlobTags = common.BlobTags{}
-		for k, v := range blobTags {
-			key, _ := url.QueryUnescape(k)
-			value, _ := url.QueryUnescape(v)
-			srcBlobTags[key] = value
-		}
+	sourceSize := plan.Transfer(jptm.transferIndex).SourceSize
+	blockSize := computeBlockSize(dstBlobData.BlockSize, sourceSize)
+	// If an earlier run of this job recorded chunks with an automatically computed block size, keep using that size,
+	// so that the resumed transfer is cut into the same chunks as the earlier run
+	if recordedBlockSize := plan.ChunkBlockSize(jptm.transferIndex); dstBlobData.BlockSize == 0 && recordedBlockSize != 0 {
+		blockSize = recordedBlockSize
 	}
 
 	jptm.transferInfo = &TransferInfo{
+		JobID:                          plan.JobID,
 		BlockSize:                      blockSize,
 		Source:                         src,
 		SourceSize:                     sourceSize,
@@ -333,19 +436,39 @@ func (jptm *jobPartTransferMgr) Info() TransferInfo {
 		EntityType:                     entityType,
 		PreserveSMBPermissions:         plan.PreserveSMBPermissions,
 		PreserveSMBInfo:                plan.PreserveSMBInfo,
+		PreservePOSIXProperties:        plan.PreservePOSIXProperties,
+		PreserveACLs:                   plan.PreserveACLs,
+		PreserveImmutability:           plan.PreserveImmutability,
+		ImmutabilityPolicyMode:         dstBlobData.ImmutabilityPolicyMode,
 		S2SGetPropertiesInBackend:      s2sGetPropertiesInBackend,
 		S2SSourceChangeValidation:      s2sSourceChangeValidation,
+		S2SRehydrateArchivedSource:     plan.S2SRehydrateArchivedSource,
+		S2SCopyMethod:                  plan.S2SCopyMethod,
+		SkipIfHashMatches:              plan.SkipIfHashMatches,
 		S2SInvalidMetadataHandleOption: s2sInvalidMetadataHandleOption,
+		DestIfMatch:                    destIfMatch,
+		DestIfNoneMatch:                destIfNoneMatch,
 		DestLengthValidation:           DestLengthValidation,
 		SrcProperties: SrcProperties{
 			SrcHTTPHeaders: srcHTTPHeaders,
 			SrcMetadata:    srcMetadata,
-			SrcBlobTags:    srcBlobTags,
+			SrcBlobTags:    blobTags,
 		},
 		SrcBlobType:    srcBlobType,
 		S2SSrcBlobTier: srcBlobTier,
 	}
 
+	if dstBlobData.ImmutabilityPolicyExpiresOn != 0 {
+		jptm.transferInfo.ImmutabilityPolicyExpiresOn = time.Unix(0, dstBlobData.ImmutabilityPolicyExpiresOn)
+	}
+	if transfer := plan.Transfer(jptm.transferIndex); plan.PreserveImmutability {
+		jptm.transferInfo.SrcImmutability.LegalHold = transfer.SrcLegalHold
+		if transfer.SrcImmutabilityPolicyExpiresOn != 0 {
+			jptm.transferInfo.SrcImmutability.PolicyExpiresOn = time.Unix(0, transfer.SrcImmutabilityPolicyExpiresOn)
+			jptm.transferInfo.SrcImmutability.PolicyMode = transfer.SrcImmutabilityPolicyMode
+		}
+	}
+
 	return *jptm.transferInfo
 }
 
@@ -437,6 +560,19 @@ func (jptm *jobPartTransferMgr) RescheduleTransfer() {
 	jptm.jobPartMgr.RescheduleTransfer(jptm)
 }
 
+// RescheduleTransferAfter gives up the transfer's slot, and schedules the transfer to be started again once the delay has passed,
+// or as soon as it is cancelled. It is for transfers that must wait a long time for something, so that they don't tie up a worker meanwhile.
+func (jptm *jobPartTransferMgr) RescheduleTransferAfter(delay time.Duration) {
+	jptm.releaseTransferSlot()
+	go func() {
+		select {
+		case <-jptm.ctx.Done():
+		case <-time.After(delay):
+		}
+		jptm.RescheduleTransfer()
+	}()
+}
+
 func (jptm *jobPartTransferMgr) ScheduleChunks(chunkFunc chunkFunc) {
 	jptm.jobPartMgr.ScheduleChunks(chunkFunc)
 }
@@ -452,9 +588,13 @@ func (jptm *jobPartTransferMgr) LastModifiedTime() time.Time {
 
 // PreserveLastModifiedTime checks for the PreserveLastModifiedTime flag in JobPartPlan of a transfer.
 // If PreserveLastModifiedTime is set to true, it returns the lastModifiedTime of the source.
+// A source whose last modified time was never recorded has nothing to preserve, so that returns false too.
 func (jptm *jobPartTransferMgr) PreserveLastModifiedTime() (time.Time, bool) {
 	if preserveLastModifiedTime := jptm.jobPartMgr.(*jobPartMgr).localDstData().PreserveLastModifiedTime; preserveLastModifiedTime {
 		lastModifiedTime := jptm.jobPartPlanTransfer.ModifiedTime
+		if lastModifiedTime == 0 {
+			return time.Time{}, false
+		}
 		return time.Unix(0, lastModifiedTime), true
 	}
 	return time.Time{}, false
@@ -464,6 +604,16 @@ func (jptm *jobPartTransferMgr) ShouldPutMd5() bool {
 	return jptm.jobPartMgr.ShouldPutMd5()
 }
 
+// ShouldGzipUpload says whether this file is to be compressed with gzip as it is uploaded, and stored compressed
+func (jptm *jobPartTransferMgr) ShouldGzipUpload() bool {
+	return jptm.jobPartMgr.Plan().DstBlobData.shouldGzip(jptm.jobPartPlanTransfer.SourceSize, jptm.Info().Source)
+}
+
+// ChecksumAlgorithm returns the algorithm of the hashes that ShouldPutMd5 and MD5ValidationOption refer to
+func (jptm *jobPartTransferMgr) ChecksumAlgorithm() common.HashAlgorithm {
+	return jptm.jobPartMgr.Plan().ChecksumAlgorithm
+}
+
 func (jptm *jobPartTransferMgr) MD5ValidationOption() common.HashValidationOption {
 	return jptm.jobPartMgr.(*jobPartMgr).localDstData().MD5VerificationOption
 }
@@ -508,10 +658,9 @@ func (jptm *jobPartTransferMgr) ReportChunkDone(id common.ChunkID) (lastChunk bo
 	// before another was finish. Which would be bad
 	id.SetCompletionNotificationSent()
 
-	// track progress
+	// track progress. Only the transfer's own count is kept as chunks complete. The part's and the job's counts are summed from it
 	if jptm.IsLive() {
-		atomic.AddInt64(&jptm.atomicSuccessfulBytes, id.Length())
-		JobsAdmin.AddSuccessfulBytesInActiveFiles(id.Length())
+		jptm.jobPartPlanTransfer.AddAttemptBytes(uint64(id.Length()))
 	}
 
 	// Do our actual processing
@@ -519,11 +668,16 @@ func (jptm *jobPartTransferMgr) ReportChunkDone(id common.ChunkID) (lastChunk bo
 	lastChunk = chunksDone == jptm.numChunks
 	if lastChunk {
 		jptm.runActionAfterLastChunk()
-		JobsAdmin.AddSuccessfulBytesInActiveFiles(-atomic.LoadInt64(&jptm.atomicSuccessfulBytes)) // subtract our bytes from the active files bytes, because we are done now
 	}
 	return lastChunk, chunksDone
 }
 
+// ReportResumedBytes counts n bytes, which an earlier run saved at the destination and which this run won't send again,
+// as transferred by this attempt. It is for senders that skip what was saved, rather than reporting each saved chunk as done.
+func (jptm *jobPartTransferMgr) ReportResumedBytes(n int64) {
+	jptm.jobPartPlanTransfer.AddAttemptBytes(uint64(n))
+}
+
 // If an automatic action has been specified for after the last chunk, run it now
 // (Prior to introduction of this routine, individual chunkfuncs had to check the return values
 // of ReportChunkDone and then implement their own versions of the necessary transfer epilogue code.
@@ -545,9 +699,70 @@ func (jptm *jobPartTransferMgr) TransferStatusIgnoringCancellation() common.Tran
 
 // TransferStatus updates the status of given transfer for given jobId and partNumber
 func (jptm *jobPartTransferMgr) SetStatus(status common.TransferStatus) {
+	// a transfer that was stopped because its job was paused did not genuinely fail,
+	// record it as paused so that resume knows to restart it
+	if status == common.ETransferStatus.Cancelled() && jptm.jobPartMgr.isJobPaused() {
+		status = common.ETransferStatus.Paused()
+	}
 	jptm.jobPartPlanTransfer.SetTransferStatus(status, false)
 }
 
+// PrepareChunkTracking must be called before IsChunkStaged or SetChunkStaged.
+// Chunks recorded by an earlier run are kept only if they were recorded with the same block size,
+// since otherwise they no longer cover the same ranges of the file.
+func (jptm *jobPartTransferMgr) PrepareChunkTracking(blockSize int64) {
+	plan := jptm.jobPartMgr.Plan()
+	if plan.ChunkBlockSize(jptm.transferIndex) != blockSize {
+		plan.ResetChunkBitmap(jptm.transferIndex, blockSize)
+	}
+}
+
+// IsChunkStaged returns whether an earlier run already staged the given chunk at the destination
+func (jptm *jobPartTransferMgr) IsChunkStaged(chunkIndex int32) bool {
+	return jptm.jobPartMgr.Plan().IsChunkDone(jptm.transferIndex, chunkIndex)
+}
+
+// SetChunkStaged records, in the plan file, that the given chunk has been staged at the destination
+func (jptm *jobPartTransferMgr) SetChunkStaged(chunkIndex int32) {
+	jptm.jobPartMgr.Plan().SetChunkDone(jptm.transferIndex, chunkIndex)
+}
+
+// ResetChunkTracking discards all chunks recorded as staged, for use when the destination no longer holds them
+func (jptm *jobPartTransferMgr) ResetChunkTracking() {
+	plan := jptm.jobPartMgr.Plan()
+	plan.ResetChunkBitmap(jptm.transferIndex, plan.ChunkBlockSize(jptm.transferIndex))
+}
+
+// SetContentDigest records, in the plan file, the hash that was computed over the transfer's data (see ChecksumAlgorithm),
+// along with the last modified time and the size that the source had when the data was read
+func (jptm *jobPartTransferMgr) SetContentDigest(digest []byte, sourceLastModifiedTime time.Time, sourceSize int64) {
+	copy(jptm.jobPartMgr.Plan().TransferDigest(jptm.transferIndex), digest)
+	jptm.jobPartPlanTransfer.SetDigestSource(sourceLastModifiedTime, sourceSize)
+}
+
+// ContentDigest returns the hash that an earlier call to SetContentDigest recorded in the plan file, or nil if none was recorded.
+// Since the plan file survives resumes, this saves reading the data again to hash it, and lets a resumed upload
+// check that its source hasn't changed since the chunks it staged before were sent (see verifyRecordedDigest).
+func (jptm *jobPartTransferMgr) ContentDigest() []byte {
+	digest := jptm.jobPartMgr.Plan().TransferDigest(jptm.transferIndex)
+	for _, b := range digest {
+		if b != 0 {
+			return append([]byte(nil), digest...)
+		}
+	}
+	return nil
+}
+
+// ContentDigestFor is ContentDigest, for a source that has the given last modified time and size. If the source had another
+// when the digest was recorded, it has changed since, so the digest no longer stands for it, and nil is returned.
+func (jptm *jobPartTransferMgr) ContentDigestFor(sourceLastModifiedTime time.Time, sourceSize int64) []byte {
+	lastModifiedTime, size := jptm.jobPartPlanTransfer.DigestSource()
+	if !lastModifiedTime.Equal(sourceLastModifiedTime) || size != sourceSize {
+		return nil
+	}
+	return jptm.ContentDigest()
+}
+
 // SetErrorCode updates the errorcode of transfer for given jobId and partNumber.
 func (jptm *jobPartTransferMgr) ErrorCode() int32 {
 	return jptm.jobPartPlanTransfer.ErrorCode()
@@ -571,6 +786,37 @@ func (jptm *jobPartTransferMgr) SetErrorCode(errorCode int32) {
 func (jptm *jobPartTransferMgr) Cancel()           { jptm.cancel() }
 func (jptm *jobPartTransferMgr) WasCanceled() bool { return jptm.ctx.Err() != nil }
 
+// IsJobCancelling is true once the job is being cancelled, even if its context has not been (e.g. because it has overrun its
+// maximum duration). Transfers that have not started yet must then not be started.
+func (jptm *jobPartTransferMgr) IsJobCancelling() bool { return jptm.jobPartMgr.isJobCancelling() }
+
+// IsJobPaused is true once the job has been paused. A paused job starts no more transfers, and those in flight are cancelled.
+// Either way, they are recorded as paused, for resume to pick up.
+func (jptm *jobPartTransferMgr) IsJobPaused() bool { return jptm.jobPartMgr.isJobPaused() }
+
+// ReserveBytes counts the data that the transfer has still to send against the job's MaxTotalBytes, and returns whether it fits.
+// If it doesn't, the transfer must not be started, and the job is stopped.
+func (jptm *jobPartTransferMgr) ReserveBytes() bool {
+	if jptm.reservedBytes {
+		return true
+	}
+	// a paused transfer carries on from where it was, and what it had already sent is part of what the job has transferred
+	remaining := uint64(jptm.jobPartPlanTransfer.SourceSize)
+	if sent := jptm.jobPartPlanTransfer.AttemptBytes(); sent < remaining {
+		remaining -= sent
+	} else {
+		remaining = 0
+	}
+	jptm.reservedBytes = jptm.jobPartMgr.reserveBytes(remaining)
+	return jptm.reservedBytes
+}
+
+// IsJobStoppedByMaxTotalBytes is true once the job has been stopped because a transfer would have taken it past its MaxTotalBytes.
+// The job is then cancelling, and the transfers that were not started are recorded as having exceeded the limit.
+func (jptm *jobPartTransferMgr) IsJobStoppedByMaxTotalBytes() bool {
+	return jptm.jobPartMgr.isJobStoppedByMaxTotalBytes()
+}
+
 // SetDestinationIsModified tells the jptm that it should consider the destination to have been modified
 func (jptm *jobPartTransferMgr) SetDestinationIsModified() {
 	old := atomic.SwapUint32(&jptm.atomicDestModifiedIndicator, 1)
@@ -583,6 +829,27 @@ func (jptm *jobPartTransferMgr) SetDestinationIsModified() {
 	}
 }
 
+// SetDestinationVersionID records the version ID of the blob that the transfer created, so that it can be reported in the job's summary
+// An empty versionID, as returned by accounts without versioning, is ignored
+func (jptm *jobPartTransferMgr) SetDestinationVersionID(versionID string) {
+	if versionID == "" {
+		return
+	}
+	jptm.jobPartMgr.Plan().SetDestVersionID(jptm.transferIndex, versionID)
+	jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "destination blob version is "+versionID)
+}
+
+// AppendStart returns the length and block count that the destination append blob had before the transfer first appended to it,
+// as recorded in the plan file by SetAppendStart. Since the plan file survives resumes, a retry can carry on from where
+// an earlier attempt stopped, rather than appending the whole source again.
+func (jptm *jobPartTransferMgr) AppendStart() (length int64, blocks uint32, ok bool) {
+	return jptm.jobPartPlanTransfer.AppendStart()
+}
+
+func (jptm *jobPartTransferMgr) SetAppendStart(length int64, blocks uint32) {
+	jptm.jobPartPlanTransfer.SetAppendStart(length, blocks)
+}
+
 func (jptm *jobPartTransferMgr) hasStartedWork() bool {
 	return atomic.LoadUint32(&jptm.atomicDestModifiedIndicator) == 1
 }
@@ -687,6 +954,17 @@ func (jptm *jobPartTransferMgr) FailActiveSend(where string, err error) {
 	}
 }
 
+// FailSourceChanged fails the transfer because its source has changed since it was enumerated, so what was sent may be a mix of
+// its old and new contents. The source is recorded as it is now, so that a retry sends it as it is now: straight away, if the job
+// retries changed files, or else when the job is resumed.
+func (jptm *jobPartTransferMgr) FailSourceChanged(where string, lastModifiedTime time.Time, size int64) {
+	jptm.FailActiveSend(where, fmt.Errorf("%w: it is now %d bytes, last modified at %v, but was %d bytes, last modified at %v, when it was enumerated",
+		errSourceChangedDuringTransfer, size, lastModifiedTime, jptm.Info().SourceSize, jptm.LastModifiedTime()))
+	plan := jptm.jobPartMgr.Plan()
+	plan.RecordSourceChange(jptm.transferIndex, lastModifiedTime, size)
+	jptm.retryAfterSourceChange = plan.RetryChangedFiles
+}
+
 func (jptm *jobPartTransferMgr) FailActiveSendWithStatus(where string, err error, failureStatus common.TransferStatus) {
 	isUpload, isCopy := jptm.TempJudgeUploadOrCopy()
 
@@ -699,6 +977,14 @@ func (jptm *jobPartTransferMgr) FailActiveSendWithStatus(where string, err error
 	}
 }
 
+// destWriteWasRefused is true if the service refused to write the destination, because it didn't satisfy the transfer's ETag condition.
+// Whatever is at the destination then isn't ours, so it must not be cleaned up.
+func destWriteWasRefused(jptm IJobPartTransferMgr) bool {
+	status := jptm.TransferStatusIgnoringCancellation()
+	return status == common.ETransferStatus.PreconditionFailed() ||
+		(status == common.ETransferStatus.SkippedEntityAlreadyExists() && jptm.Info().hasDestAccessConditions())
+}
+
 // Use this to mark active transfers (i.e. those where chunk funcs have been scheduled) as failed.
 // Unlike just setting the status to failed, this also handles cancellation correctly
 func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descriptionOfWhereErrorOccurred string, err error, failureStatus common.TransferStatus) {
@@ -713,11 +999,27 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 
 		if serviceCode == common.CPK_ERROR_SERVICE_CODE {
 			cpkAccessFailureLogGLCM.Do(func() {
-				common.GetLifecycleMgr().Info("One or more transfers have failed because AzCopy currently does not support blobs encrypted with customer provided keys (CPK). " +
-					"If you wish to access CPK-encrypted blobs, we recommend using one of the Azure Storage SDKs to do so.")
+				common.GetLifecycleMgr().Info("One or more transfers have failed because their blobs are encrypted with customer provided keys (CPK). " +
+					"To access CPK-encrypted blobs, use --cpk-by-value and give the key in the " + common.EEnvironmentVariable.CPKEncryptionKey().Name + " environment variable.")
 			})
 		}
 
+		if serviceCode == string(azblob.ServiceCodeBlobArchived) {
+			msg = fmt.Sprintf("the source blob is in the archive tier, and must be rehydrated before it can be read. %s", msg)
+		}
+		if snapshot := jptm.sourceSnapshot(); snapshot != "" && status == http.StatusNotFound &&
+			(serviceCode == string(azblob.ServiceCodeBlobNotFound) || serviceCode == string(azblob.ServiceCodeCannotVerifyCopySource)) {
+			msg = fmt.Sprintf("the source snapshot %s no longer exists; it may have been deleted after the job started. %s", snapshot, msg)
+		}
+
+		failureStatus, msg = preconditionFailure(jptm.Info(), jptm.GetOverwriteOption(), serviceCode, status, failureStatus, msg)
+		if failureStatus == common.ETransferStatus.SkippedEntityAlreadyExists() {
+			// the service did the existence check, that is otherwise done before the transfer starts
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "File already exists, so will be skipped")
+			jptm.SetStatus(failureStatus)
+			return
+		}
+
 		requestID := ErrorEx{err}.MSRequestID()
 		fullMsg := fmt.Sprintf("%s. When %s. X-Ms-Request-Id: %s\n", msg, descriptionOfWhereErrorOccurred, requestID) // trailing \n to separate it better from any later, unrelated, log lines
 		jptm.logTransferError(typ, jptm.Info().Source, jptm.Info().Destination, fullMsg, status)
@@ -728,7 +1030,8 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 		if status == http.StatusForbidden {
 			// quit right away, since without proper authentication no work can be done
 			// display a clear message
-			common.GetLifecycleMgr().Info(fmt.Sprintf("Authentication failed, it is either not correct, or expired, or does not have the correct permission %s", err.Error()))
+			remoteResource := authorizationFailureResource(jptm.Info(), jptm.FromTo(), err)
+			common.GetLifecycleMgr().Info(authorizationFailureMessage(jptm.jobPartMgr.Plan().CredentialType, serviceCode, remoteResource, err))
 			// and use the normal cancelling mechanism so that we can exit in a clean and controlled way
 			jobId := jptm.jobPartMgr.Plan().JobID
 			CancelPauseJobOrder(jobId, common.EJobStatus.Cancelling())
@@ -748,13 +1051,100 @@ func (jptm *jobPartTransferMgr) failActiveTransfer(typ transferErrorCode, descri
 	// TODO: ... if all expected chunks report as done
 }
 
+// authorizationFailureMessage explains a 403 response to the user. When the job authenticates with Azure AD, and the service says
+// the identity lacks permission, a new token won't help: the identity needs a role on the resource.
+func authorizationFailureMessage(credentialType common.CredentialType, serviceCode string, resourceURL string, err error) string {
+	if credentialType == common.ECredentialType.OAuthToken() && serviceCode == string(azblob.StorageErrorCodeAuthorizationPermissionMismatch) {
+		container, account := "", ""
+		if u, parseErr := url.Parse(resourceURL); parseErr == nil {
+			parts := azblob.NewBlobURLParts(*u)
+			container, account = parts.ContainerName, parts.Host
+		}
+		return fmt.Sprintf("The Azure AD identity that AzCopy logged in with is not authorized to access container '%s' of %s. "+
+			"It needs a data role, such as Storage Blob Data Contributor (or Storage Blob Data Reader, to only read), on the container "+
+			"or its storage account. New role assignments can take a few minutes to apply. %s", container, account, err.Error())
+	}
+	return fmt.Sprintf("Authentication failed, it is either not correct, or expired, or does not have the correct permission %s", err.Error())
+}
+
+// authorizationFailureResource returns the URL of the resource that a 403 response was about, which is that of the request that got it.
+// If the error doesn't say, it's the remote end of the transfer (or, in a service to service copy, the destination).
+func authorizationFailureResource(info TransferInfo, fromTo common.FromTo, err error) string {
+	if requestURL := (ErrorEx{err}).RequestURL(); requestURL != "" {
+		return requestURL
+	}
+	if fromTo.To().IsRemote() {
+		return info.Destination
+	}
+	return info.Source
+}
+
+// sourceSnapshot returns the snapshot that the transfer reads, or "" if its source is not a blob snapshot
+func (jptm *jobPartTransferMgr) sourceSnapshot() string {
+	u, err := url.Parse(jptm.Info().Source)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("snapshot")
+}
+
+// preconditionFailure tells a transfer that failed because the destination's ETag didn't satisfy its condition (412 Precondition Failed)
+// apart from other failures, since it means that someone else changed the destination. Other failures are returned as they are.
+// When the overwrite option is IfNotExists, a destination that already exists is not a failure at all, but the reason to skip the transfer.
+func preconditionFailure(info TransferInfo, overwrite common.OverwriteOption, serviceCode string, status int, failureStatus common.TransferStatus, msg string) (common.TransferStatus, string) {
+	if failureStatus != common.ETransferStatus.Failed() || !info.hasDestAccessConditions() {
+		return failureStatus, msg
+	}
+	// Put Blob answers If-None-Match: * with 409 BlobAlreadyExists, rather than 412
+	alreadyExists := info.DestIfNoneMatch == string(azblob.ETagAny) &&
+		(status == http.StatusPreconditionFailed || (status == http.StatusConflict && serviceCode == string(azblob.ServiceCodeBlobAlreadyExists)))
+	if status != http.StatusPreconditionFailed && !alreadyExists {
+		return failureStatus, msg
+	}
+	if alreadyExists && overwrite == common.EOverwriteOption.IfNotExists() {
+		return common.ETransferStatus.SkippedEntityAlreadyExists(), msg
+	}
+
+	var condition string
+	switch {
+	case info.DestIfNoneMatch == string(azblob.ETagAny):
+		condition = "the destination already exists, but was only to be written if it did not"
+	case info.DestIfNoneMatch != "":
+		condition = fmt.Sprintf("the destination has the ETag %s, with which it was not to be written", info.DestIfNoneMatch)
+	case info.DestIfMatch == string(azblob.ETagAny):
+		condition = "the destination does not exist, but was only to be written if it did"
+	default:
+		condition = fmt.Sprintf("the destination no longer has the expected ETag %s, so it has been changed since", info.DestIfMatch)
+	}
+	return common.ETransferStatus.PreconditionFailed(), fmt.Sprintf("%s. %s", condition, msg)
+}
+
 func (jptm *jobPartTransferMgr) PipelineLogInfo() pipeline.LogOptions {
 	return jptm.jobPartMgr.(*jobPartMgr).jobMgr.(*jobMgr).PipelineLogInfo()
 }
 
 func (jptm *jobPartTransferMgr) Log(level pipeline.LogLevel, msg string) {
+	jptm.logEvent(level, common.ELogEvent.TransferInfo(), msg)
+}
+
+// logEvent logs msg as an event of this transfer
+func (jptm *jobPartTransferMgr) logEvent(level pipeline.LogLevel, event common.LogEvent, msg string) {
 	plan := jptm.jobPartMgr.Plan()
-	jptm.jobPartMgr.Log(level, fmt.Sprintf("%s: [P#%d-T#%d] ", common.LogLevel(level), plan.PartNum, jptm.transferIndex)+msg)
+	jptm.jobPartMgr.LogEvent(level, event, jptm.logTransferPath(level), fmt.Sprintf("%s: [P#%d-T#%d] ", common.LogLevel(level), plan.PartNum, jptm.transferIndex)+msg)
+}
+
+// logRequestEvent logs an entry from the request log policy, about a request that this transfer made
+func (jptm *jobPartTransferMgr) logRequestEvent(level pipeline.LogLevel, event common.LogEvent, msg string) {
+	jptm.jobPartMgr.LogEvent(level, event, jptm.logTransferPath(level), msg)
+}
+
+// logTransferPath returns the path to record with a log entry at the given level.
+// Only the JSON format records it in a field of its own, so there is no need to work it out for the text format
+func (jptm *jobPartTransferMgr) logTransferPath(level pipeline.LogLevel) string {
+	if jptm.jobPartMgr.Plan().LogFormat != common.ELogFormat.Json() || !jptm.ShouldLog(level) {
+		return ""
+	}
+	return common.URLStringExtension(jptm.Info().Source).RedactSecretQueryParamForLogging()
 }
 
 func (jptm *jobPartTransferMgr) ErrorCodeAndString(err error) (int, string) {
@@ -793,7 +1183,10 @@ func (jptm *jobPartTransferMgr) logTransferError(errorCode transferErrorCode, so
 	info := jptm.Info() // TODO we are getting a lot of Info calls and its (presumably) not well-optimized.  Profile that?
 	msg := fmt.Sprintf("%v: %v", errorCode, info.entityTypeLogIndicator()) + common.URLStringExtension(source).RedactSecretQueryParamForLogging() +
 		fmt.Sprintf(" : %03d : %s\n   Dst: ", status, errorMsg) + common.URLStringExtension(destination).RedactSecretQueryParamForLogging()
-	jptm.Log(pipeline.LogError, msg)
+	jptm.logEvent(pipeline.LogError, common.ELogEvent.TransferFailed(), msg)
+
+	// keep the reason in the plan file too, so that it can be shown (e.g. by jobs show) without trawling the log
+	jptm.jobPartMgr.Plan().SetErrorMessage(jptm.transferIndex, strings.TrimSpace(errorMsg))
 }
 
 func (jptm *jobPartTransferMgr) LogUploadError(source, destination, errorMsg string, status int) {
@@ -829,7 +1222,7 @@ func (jptm *jobPartTransferMgr) LogError(resource, context string, err error) {
 }
 
 func (jptm *jobPartTransferMgr) LogTransferStart(source, destination, description string) {
-	jptm.Log(pipeline.LogInfo,
+	jptm.logEvent(pipeline.LogInfo, common.ELogEvent.TransferStart(),
 		fmt.Sprintf("Starting transfer: Source %q Destination %q. %s",
 			common.URLStringExtension(source).RedactSecretQueryParamForLogging(),
 			common.URLStringExtension(destination).RedactSecretQueryParamForLogging(),
@@ -846,7 +1239,8 @@ func (jptm *jobPartTransferMgr) LogTransferInfo(level pipeline.LogLevel, source,
 
 func (jptm *jobPartTransferMgr) Panic(err error) { jptm.jobPartMgr.Panic(err) }
 
-// Call ReportTransferDone to report when a Transfer for this Job Part has completed
+// Call ReportTransferDone to report when a Transfer for this Job Part has completed.
+// It returns how many of the part's transfers are done, or 0 if this one is being started again instead.
 // TODO: I feel like this should take the status & we kill SetStatus
 func (jptm *jobPartTransferMgr) ReportTransferDone() uint32 {
 	// In case of context leak in job part transfer manager.
@@ -863,7 +1257,55 @@ func (jptm *jobPartTransferMgr) ReportTransferDone() uint32 {
 		panic("cannot report the same transfer done twice")
 	}
 
-	return jptm.jobPartMgr.ReportTransferDone(jptm.jobPartPlanTransfer.TransferStatus())
+	// cancelled and paused transfers, and those not started because of the job's MaxTotalBytes, haven't actually completed,
+	// so they don't get a completion time
+	status := jptm.jobPartPlanTransfer.TransferStatus()
+	if !status.ShouldTransfer() && status != common.ETransferStatus.Cancelled() && status != common.ETransferStatus.ExceededMaxTotalBytes() {
+		jptm.jobPartPlanTransfer.SetCompletionTime(time.Now())
+	}
+
+	// the attempt is over, so what it transferred now counts for the part as a whole. How much of the part's completed bytes the transfer is
+	// then follows from its status: all of its size if it succeeded or was skipped, and none of it if it failed or was cancelled.
+	// A paused transfer keeps what it has counted until it starts again, when it counts what the destination kept of it afresh.
+	if status != common.ETransferStatus.Paused() {
+		jptm.jobPartMgr.Plan().EndTransferAttempt(jptm.transferIndex)
+	}
+
+	jptm.releaseTransferSlot()
+
+	// a transfer whose source changed as it was sent may be started again, in which case it isn't done yet
+	if jptm.retryAfterSourceChange && status == common.ETransferStatus.Failed() && jptm.jobPartMgr.retryTransfer(jptm.transferIndex) {
+		return 0
+	}
+
+	return jptm.jobPartMgr.ReportTransferDone(status)
+}
+
+// how long a transfer whose job has no free transfer slot waits before it is tried again
+var transferSlotRetryInterval = 100 * time.Millisecond
+
+// TryTakeTransferSlot takes a slot for the transfer if its job has room for another transfer to be in progress, and returns whether it may start.
+// It doesn't wait for a slot, since the transfer workers are shared by every job. It returns true if the job does not limit its concurrency,
+// or if this transfer already holds a slot (e.g. because it was rescheduled).
+func (jptm *jobPartTransferMgr) TryTakeTransferSlot() bool {
+	slots := jptm.jobPartMgr.transferSlots()
+	if slots == nil || jptm.heldTransferSlot != nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		jptm.heldTransferSlot = slots
+		return true
+	default:
+		return false
+	}
+}
+
+func (jptm *jobPartTransferMgr) releaseTransferSlot() {
+	if jptm.heldTransferSlot != nil {
+		<-jptm.heldTransferSlot
+		jptm.heldTransferSlot = nil
+	}
 }
 
 func (jptm *jobPartTransferMgr) SourceProviderPipeline() pipeline.Pipeline {
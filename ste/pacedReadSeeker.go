@@ -34,22 +34,23 @@ type pacedReadSeeker struct {
 	// long enough that we might need to cancel during it, hence the ctx.
 	ctx context.Context
 
-	body io.Reader // Seeking is required to support retries
-	p    pacer
+	body     io.Reader // Seeking is required to support retries
+	p        pacer
+	progress *transferProgress // nil if the transfer's progress is not tracked
 }
 
 func newPacedRequestBody(ctx context.Context, requestBody io.ReadSeeker, p pacer) io.ReadSeeker {
 	if p == nil {
 		panic("p must not be nil")
 	}
-	return &pacedReadSeeker{ctx: ctx, body: requestBody, p: p}
+	return &pacedReadSeeker{ctx: ctx, body: requestBody, p: p, progress: transferProgressFromContext(ctx)}
 }
 
 func newPacedResponseBody(ctx context.Context, responseBody io.ReadCloser, p pacer) io.ReadCloser {
 	if p == nil {
 		panic("p must not be nil")
 	}
-	return &pacedReadSeeker{ctx: ctx, body: responseBody, p: p}
+	return &pacedReadSeeker{ctx: ctx, body: responseBody, p: p, progress: transferProgressFromContext(ctx)}
 }
 
 func (prs *pacedReadSeeker) Read(p []byte) (int, error) {
@@ -63,6 +64,7 @@ func (prs *pacedReadSeeker) Read(p []byte) (int, error) {
 
 	// process them
 	n, err := prs.body.Read(p)
+	prs.progress.recordBytes(n)
 
 	// "return" any unused tokens to the pacer (e.g. if we hit eof before the end of our buffer p)
 	excess := requestedCount - n
@@ -0,0 +1,57 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+)
+
+// directionalPacer paces the traffic of one direction (upload or download) against both the cap of that direction
+// and the aggregate cap. Traffic in the other direction has its own directionalPacer, so it is never held up by this
+// direction's cap. Both underlying pacers are shared by all jobs, so closing a directionalPacer doesn't close them.
+type directionalPacer struct {
+	direction *tokenBucketPacer
+	aggregate *tokenBucketPacer
+}
+
+func newDirectionalPacer(direction *tokenBucketPacer, aggregate *tokenBucketPacer) pacer {
+	return &directionalPacer{direction: direction, aggregate: aggregate}
+}
+
+func (p *directionalPacer) RequestTrafficAllocation(ctx context.Context, byteCount int64) error {
+	if err := p.direction.RequestTrafficAllocation(ctx, byteCount); err != nil {
+		return err
+	}
+	if err := p.aggregate.RequestTrafficAllocation(ctx, byteCount); err != nil {
+		p.direction.UndoRequest(byteCount) // we won't be sending them after all
+		return err
+	}
+	return nil
+}
+
+func (p *directionalPacer) UndoRequest(byteCount int64) {
+	p.direction.UndoRequest(byteCount)
+	p.aggregate.UndoRequest(byteCount)
+}
+
+func (p *directionalPacer) Close() error {
+	return nil
+}
@@ -62,7 +62,8 @@ const (
 )
 
 // tokenBucketPacer allows us to control the pace of an activity, using a basic token bucket algorithm.
-// The target rate is fixed, but can be modified at any time through SetTargetBytesPerSecond
+// The target rate is fixed, but can be modified at any time through setTargetBytesPerSecond.
+// A target rate of zero means the rate is not capped at all (but traffic is still counted).
 type tokenBucketPacer struct {
 	atomicTokenBucket          int64
 	atomicTargetBytesPerSecond int64
@@ -89,12 +90,16 @@ func newTokenBucketPacer(bytesPerSecond int64, expectedBytesPerCoarseRequest int
 func (p *tokenBucketPacer) RequestTrafficAllocation(ctx context.Context, byteCount int64) error {
 
 	// block until tokens are available
-	for atomic.AddInt64(&p.atomicTokenBucket, -byteCount) < 0 {
+	for atomic.AddInt64(&p.atomicTokenBucket, -byteCount) < p.minimumBalanceAfterRequest(byteCount) {
 
 		// by taking our desired count we've moved below zero, which means our allocation is not available
 		// right now, so put back what we asked for, and then wait
 		atomic.AddInt64(&p.atomicTokenBucket, byteCount)
 
+		if p.targetBytesPerSecond() == 0 {
+			break // not capped (any more), so there's no need to wait, or to take anything from the bucket
+		}
+
 		// vary the wait amount, to reduce risk of any kind of pulsing or synchronization effect, without the perf and
 		// and threadsafety issues of actual random numbers
 		totalWaitsSoFar := atomic.AddInt64(&p.atomicWaitCount, 1)
@@ -114,6 +119,33 @@ func (p *tokenBucketPacer) RequestTrafficAllocation(ctx context.Context, byteCou
 	return nil
 }
 
+// minimumBalanceAfterRequest returns how low the token bucket may go once byteCount has been taken from it.
+// Normally that's zero, i.e. the tokens must already be present. But a request that is bigger than the bucket
+// can ever hold (e.g. a whole chunk, when the cap is very low) would then wait for ever. So such a request
+// is granted as soon as the bucket is full, leaving the bucket in debt. Everyone (including the next big request)
+// then waits until that debt has been paid off, so the average rate still respects the cap.
+func (p *tokenBucketPacer) minimumBalanceAfterRequest(byteCount int64) int64 {
+	target := p.targetBytesPerSecond()
+	if target == 0 {
+		return 0 // not capped, so the bucket is never in debt (and RequestTrafficAllocation won't wait)
+	}
+	maxBucketSize := p.maxBucketSize(target)
+	if byteCount > maxBucketSize {
+		return maxBucketSize - byteCount
+	}
+	return 0
+}
+
+// maxBucketSize returns the max number of tokens that are allowed to build up in the bucket
+func (p *tokenBucketPacer) maxBucketSize(targetBytesPerSecond int64) int64 {
+	// Why don't we want a big backlog? Because it limits our ability to accurately control the speed.
+	maxAllowedUnsentBytes := int64(float32(targetBytesPerSecond) * maxSecondsToOverpopulateBucket)
+	if maxAllowedUnsentBytes < p.expectedBytesPerRequest {
+		maxAllowedUnsentBytes = p.expectedBytesPerRequest // just in case we are very coarse grained at a very slow speed
+	}
+	return maxAllowedUnsentBytes
+}
+
 // UndoRequest allows a caller to return unused tokens
 func (p *tokenBucketPacer) UndoRequest(byteCount int64) {
 	if byteCount > 0 {
@@ -144,11 +176,7 @@ func (p *tokenBucketPacer) pacerBody() {
 		newTokenCount := atomic.AddInt64(&p.atomicTokenBucket, bytesToRelease)
 
 		// If the backlog of unsent bytes is now too great, then trim it back down.
-		// Why don't we want a big backlog? Because it limits our ability to accurately control the speed.
-		maxAllowedUnsentBytes := int64(float32(currentTarget) * maxSecondsToOverpopulateBucket)
-		if maxAllowedUnsentBytes < p.expectedBytesPerRequest {
-			maxAllowedUnsentBytes = p.expectedBytesPerRequest // just in case we are very coarse grained at a very slow speed
-		}
+		maxAllowedUnsentBytes := p.maxBucketSize(currentTarget)
 		if newTokenCount > maxAllowedUnsentBytes {
 			common.AtomicMorphInt64(&p.atomicTokenBucket, func(currentVal int64) (newVal int64, _ interface{}) {
 				newVal = currentVal
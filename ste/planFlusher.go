@@ -0,0 +1,153 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	defaultPlanFlushInterval  = 30 * time.Second
+	defaultPlanFlushTransfers = 1000
+)
+
+var (
+	planFlushInterval     time.Duration
+	planFlushTransfers    uint32
+	planFlushSettingsOnce sync.Once
+)
+
+// getPlanFlushSettings returns how often the plan files of a running job are flushed to disk, and after how many of its transfers
+// are done, whichever comes first. Zero turns the corresponding trigger off.
+func getPlanFlushSettings() (time.Duration, uint32) {
+	planFlushSettingsOnce.Do(func() {
+		planFlushInterval = defaultPlanFlushInterval
+		planFlushTransfers = defaultPlanFlushTransfers
+
+		if seconds, ok := planFlushSetting(common.EEnvironmentVariable.PlanFlushInterval()); ok {
+			planFlushInterval = time.Duration(seconds) * time.Second
+		}
+		if transfers, ok := planFlushSetting(common.EEnvironmentVariable.PlanFlushTransfers()); ok {
+			planFlushTransfers = transfers
+		}
+	})
+	return planFlushInterval, planFlushTransfers
+}
+
+func planFlushSetting(envVar common.EnvironmentVariable) (uint32, bool) {
+	overrideString := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	if overrideString == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(overrideString, 10, 32)
+	if err != nil {
+		common.GetLifecycleMgr().Error(fmt.Sprintf("Cannot parse environment variable %s, due to error %s", envVar.Name, err))
+		return 0, false
+	}
+	return uint32(value), true
+}
+
+// planFlusher flushes the plan files of a job to disk while it runs, every so often and after every so many of its transfers are done.
+// The statuses and byte counts of the transfers are only written to the memory-mapped plan files, which the OS writes to disk
+// in its own time, so without this, a machine that goes down could lose the progress of the whole run. Each flush costs
+// a write of the pages that changed since the last one, so the flushes are spaced out rather than made for every transfer.
+type planFlusher struct {
+	flush          func()
+	interval       time.Duration
+	everyTransfers uint32
+
+	atomicTransfersDone uint32
+	requests            chan struct{} // holds a flush that is due because of the transfers done
+
+	mu      *sync.Mutex
+	stop    chan struct{} // closed to end the flushing of the current run; nil when the job isn't running
+	stopped chan struct{} // closed once the flushing of the current run has ended, and no flush is under way
+}
+
+func newPlanFlusher(flush func(), interval time.Duration, everyTransfers uint32) *planFlusher {
+	return &planFlusher{flush: flush, interval: interval, everyTransfers: everyTransfers, requests: make(chan struct{}, 1), mu: &sync.Mutex{}}
+}
+
+// start begins the flushing of a run of the job, ending that of any earlier run
+func (f *planFlusher) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.endLocked()
+	if f.interval <= 0 && f.everyTransfers == 0 {
+		return
+	}
+	f.stop, f.stopped = make(chan struct{}), make(chan struct{})
+	go f.run(f.stop, f.stopped)
+}
+
+// end stops flushing, since the run of the job is over. The job flushes its plan files itself when it stops.
+// It waits for any flush that is under way, so that the plan files can be unmapped once it returns.
+func (f *planFlusher) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.endLocked()
+}
+
+func (f *planFlusher) endLocked() {
+	if f.stop != nil {
+		close(f.stop)
+		<-f.stopped
+		f.stop, f.stopped = nil, nil
+	}
+}
+
+// noteTransferDone counts a transfer of the job as done, and asks for a flush if enough of them are since the last one.
+// It doesn't wait for the flush, so that the transfers aren't held up by the disk.
+func (f *planFlusher) noteTransferDone() {
+	if f.everyTransfers == 0 || atomic.AddUint32(&f.atomicTransfersDone, 1)%f.everyTransfers != 0 {
+		return
+	}
+	select {
+	case f.requests <- struct{}{}:
+	default: // a flush is already due, and will include this transfer
+	}
+}
+
+func (f *planFlusher) run(stop, stopped chan struct{}) {
+	defer close(stopped)
+	var ticks <-chan time.Time
+	if f.interval > 0 {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticks:
+			f.flush()
+		case <-f.requests:
+			f.flush()
+		}
+	}
+}
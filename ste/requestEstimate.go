@@ -0,0 +1,55 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// EstimateTransferRequests returns about how many requests transferring a file of the given size takes, for a job with the given block size
+// (0 for automatic). Only the requests that move the data are counted: those that read or set properties, and retries, are not.
+// Blobs of the Detect type are assumed to be block blobs.
+func EstimateTransferRequests(fromTo common.FromTo, blobType common.BlobType, sourceSize int64, blockSize int64) uint64 {
+	chunkSize := computeBlockSize(blockSize, sourceSize)
+	switch {
+	case fromTo.To() == common.ELocation.File() && chunkSize > common.DefaultAzureFileChunkSize:
+		chunkSize = common.DefaultAzureFileChunkSize // see newAzureFileSenderBase
+	case fromTo.To() == common.ELocation.Blob() && blobType == common.EBlobType.PageBlob() && chunkSize > common.DefaultPageBlobChunkSize:
+		chunkSize = common.DefaultPageBlobChunkSize // see newPageBlobSenderBase
+	case fromTo.To() == common.ELocation.Blob() && blobType == common.EBlobType.AppendBlob() && chunkSize > common.MaxAppendBlobBlockSize:
+		chunkSize = common.MaxAppendBlobBlockSize // see newAppendBlobSenderBase
+	}
+	numChunks := uint64(getNumChunks(sourceSize, chunkSize))
+
+	isBlockBlob := fromTo.To() == common.ELocation.Blob() && blobType != common.EBlobType.PageBlob() && blobType != common.EBlobType.AppendBlob()
+	switch {
+	case fromTo.IsDownload():
+		return numChunks // a ranged read of each chunk
+	case sourceSize == 0:
+		return 1 // just creating the empty destination
+	case isBlockBlob && fromTo.IsUpload() && numChunks == 1:
+		return 1 // a single Put Blob
+	case isBlockBlob:
+		return numChunks + 1 // a Put Block (from URL, for service to service copies) for each chunk, then Put Block List
+	default:
+		return numChunks + 1 // creating the destination, then writing each chunk to it
+	}
+}
@@ -34,6 +34,11 @@ import (
 func newURLToBlobCopier(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (sender, error) {
 	srcInfoProvider := sip.(IRemoteSourceInfoProvider) // "downcast" to the type we know it really has
 
+	if blobSrcInfoProvider, ok := srcInfoProvider.(IBlobSourceInfoProvider); ok && jptm.Info().S2SCopyMethod == common.ES2SCopyMethod.AsyncCopy() {
+		// the service copies the whole blob itself, keeping the source's blob type
+		return newURLToBlobAsyncCopier(jptm, destination, p, blobSrcInfoProvider)
+	}
+
 	var targetBlobType azblob.BlobType
 
 	blobTypeOverride := jptm.BlobTypeOverride() // BlobTypeOverride is copy info specified by user
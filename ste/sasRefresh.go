@@ -0,0 +1,275 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// sasRefreshLeadTime is how long before a SAS token expires that a job asks for a new one
+const sasRefreshLeadTime = 10 * time.Minute
+
+// sasRefreshRetryInterval is how long a job waits to ask again, when it could not get a new SAS token
+const sasRefreshRetryInterval = time.Minute
+
+// sasRefreshCommandTimeout is how long a SAS refresh command may run
+const sasRefreshCommandTimeout = 2 * time.Minute
+
+// SASRoleEnvVar is the environment variable that tells a SAS refresh command which SAS token is wanted. Its value is
+// "source" or "destination".
+const SASRoleEnvVar = "AZCOPY_SAS_ROLE"
+
+const (
+	sasRoleSource      = "source"
+	sasRoleDestination = "destination"
+)
+
+// SASTokenProvider supplies new SAS tokens to a running job, so that the job can outlast the tokens it was started with
+type SASTokenProvider interface {
+	// NewSAS returns a new SAS token for the source or the destination of the job, as named by role
+	NewSAS(ctx context.Context, role string) (string, error)
+}
+
+// commandSASTokenProvider gets each new SAS token by running a command, which prints the token on its standard output.
+// The command can get the token however it likes, e.g. by calling an endpoint with curl.
+type commandSASTokenProvider struct {
+	command string
+}
+
+// NewCommandSASTokenProvider returns a SASTokenProvider that runs the given command line in a shell. SASRoleEnvVar tells the
+// command which token is wanted.
+func NewCommandSASTokenProvider(command string) SASTokenProvider {
+	return commandSASTokenProvider{command: command}
+}
+
+// newSASTokenProvider returns the provider for the given SAS refresh command, or nil if there is none
+func newSASTokenProvider(sasRefreshCommand string) SASTokenProvider {
+	if sasRefreshCommand == "" {
+		return nil
+	}
+	return NewCommandSASTokenProvider(sasRefreshCommand)
+}
+
+func (p commandSASTokenProvider) NewSAS(ctx context.Context, role string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sasRefreshCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", p.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", p.command)
+	}
+	cmd.Env = append(os.Environ(), SASRoleEnvVar+"="+role)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("the SAS refresh command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	sas := strings.TrimPrefix(strings.TrimSpace(string(out)), "?")
+	if sas == "" {
+		return "", errors.New("the SAS refresh command printed no SAS token")
+	}
+	return sas, nil
+}
+
+// jobSASTokens holds the current SAS tokens of a job, along with those they replaced, so that requests which were prepared
+// with a replaced token can be given the current one
+type jobSASTokens struct {
+	mu          *sync.RWMutex
+	source      string
+	destination string
+	replaced    map[string]string // the role of each replaced token, by its signature
+}
+
+func newJobSASTokens() *jobSASTokens {
+	return &jobSASTokens{mu: &sync.RWMutex{}, replaced: make(map[string]string)}
+}
+
+func (t *jobSASTokens) current() (source string, destination string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.source, t.destination
+}
+
+// set makes the given tokens the current ones
+func (t *jobSASTokens) set(source string, destination string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replace(sasRoleSource, &t.source, source)
+	t.replace(sasRoleDestination, &t.destination, destination)
+}
+
+// replace is called with the lock held
+func (t *jobSASTokens) replace(role string, token *string, newToken string) {
+	if *token == newToken {
+		return
+	}
+	if sig := sasSignature(*token); sig != "" {
+		t.replaced[sig] = role
+	}
+	delete(t.replaced, sasSignature(newToken)) // in case an old token is given again
+	*token = newToken
+}
+
+// updateQuery swaps a replaced SAS token in the given query for the current token of the same role.
+// It returns whether the query was changed.
+func (t *jobSASTokens) updateQuery(query url.Values) bool {
+	sig := query.Get("sig")
+	if sig == "" {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	role, ok := t.replaced[sig]
+	if !ok {
+		return false
+	}
+	current := t.source
+	if role == sasRoleDestination {
+		current = t.destination
+	}
+	newValues, err := url.ParseQuery(current)
+	if err != nil || newValues.Get("sig") == "" {
+		return false
+	}
+
+	// Every SAS token has its own selection of parameters, so drop all the SAS parameters of the old one
+	for key := range query {
+		if isSASQueryParam(key) {
+			delete(query, key)
+		}
+	}
+	for key, values := range newValues {
+		query[key] = values
+	}
+	return true
+}
+
+// updateURL does what updateQuery does, for a URL string. It returns the URL unchanged if it needs no change.
+func (t *jobSASTokens) updateURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	if !t.updateQuery(query) {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// sasQueryParams are the query parameters that make up service and account SAS tokens
+var sasQueryParams = map[string]bool{
+	"sv": true, "ss": true, "srt": true, "sr": true, "sp": true, "st": true, "se": true, "sip": true, "spr": true, "si": true,
+	"sig": true, "sdd": true, "rscc": true, "rscd": true, "rsce": true, "rscl": true, "rsct": true, "skoid": true, "sktid": true,
+	"skt": true, "ske": true, "sks": true, "skv": true, "saoid": true, "suoid": true, "scid": true,
+}
+
+func isSASQueryParam(key string) bool {
+	return sasQueryParams[strings.ToLower(key)]
+}
+
+func sasSignature(sas string) string {
+	values, err := url.ParseQuery(strings.TrimPrefix(sas, "?"))
+	if err != nil {
+		return ""
+	}
+	return values.Get("sig")
+}
+
+// refreshSASTokens gets a new token from the provider for each of the job's current tokens that expires before the given
+// deadline. The source and destination are refreshed independently, since they usually come from different accounts:
+// tokens that were refreshed become the current ones, even if the other could not be refreshed.
+func refreshSASTokens(ctx context.Context, provider SASTokenProvider, tokens *jobSASTokens, deadline time.Time) error {
+	source, destination := tokens.current()
+	source, sourceErr := refreshSASToken(ctx, provider, sasRoleSource, source, deadline)
+	destination, destinationErr := refreshSASToken(ctx, provider, sasRoleDestination, destination, deadline)
+	tokens.set(source, destination)
+	switch {
+	case sourceErr != nil && destinationErr != nil:
+		return fmt.Errorf("%v; %v", sourceErr, destinationErr)
+	case sourceErr != nil:
+		return sourceErr
+	}
+	return destinationErr
+}
+
+// refreshSASToken returns a new token for the role, or the given one if it does not yet need refreshing (or if it could not be
+// refreshed, along with the error).
+func refreshSASToken(ctx context.Context, provider SASTokenProvider, role string, sas string, deadline time.Time) (string, error) {
+	expiry, ok := common.SASExpiryTime(sas)
+	if !ok || expiry.After(deadline) {
+		return sas, nil
+	}
+	newSAS, err := provider.NewSAS(ctx, role)
+	if err != nil {
+		return sas, fmt.Errorf("could not refresh the SAS token of the %s: %v", role, err)
+	}
+	if newExpiry, ok := common.SASExpiryTime(newSAS); ok && !newExpiry.After(expiry) {
+		return sas, fmt.Errorf("could not refresh the SAS token of the %s: the new token expires at %v, which is no later than the old one",
+			role, newExpiry.UTC().Format(time.RFC3339))
+	}
+	return newSAS, nil
+}
+
+// sasRefreshingPipeline gives the requests of a job the current SAS tokens of the job, in place of any that were replaced.
+// Since a transfer prepares its URLs when it starts, a long transfer would otherwise go on using the token it started with.
+// Requests that are already being sent, or retried, keep the token they were sent with.
+type sasRefreshingPipeline struct {
+	inner  pipeline.Pipeline
+	tokens *jobSASTokens
+}
+
+func newSASRefreshingPipeline(inner pipeline.Pipeline, tokens *jobSASTokens) pipeline.Pipeline {
+	if inner == nil {
+		return nil
+	}
+	return sasRefreshingPipeline{inner: inner, tokens: tokens}
+}
+
+func (p sasRefreshingPipeline) Do(ctx context.Context, methodFactory pipeline.Factory, request pipeline.Request) (pipeline.Response, error) {
+	query := request.URL.Query()
+	if p.tokens.updateQuery(query) {
+		request.URL.RawQuery = query.Encode()
+	}
+	// the source of a server-to-server copy is named by a header
+	if copySource := request.Header.Get("x-ms-copy-source"); copySource != "" {
+		request.Header.Set("x-ms-copy-source", p.tokens.updateURL(copySource))
+	}
+	return p.inner.Do(ctx, methodFactory, request)
+}
@@ -22,6 +22,8 @@ package ste
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -47,8 +49,18 @@ type appendBlobSenderBase struct {
 	blobTagsToApply azblob.BlobTagsMap
 
 	soleChunkFuncSemaphore *semaphore.Weighted
+
+	// When the overwrite option is Append and the destination already exists, the source is appended to it,
+	// starting at appendOffset (i.e. the length the destination had before this transfer).
+	// alreadyAppended is how much of the source an earlier attempt of the transfer appended, which isn't sent again
+	appendToExisting bool
+	appendOffset     int64
+	alreadyAppended  int64
 }
 
+// an append blob can hold no more than this many blocks
+const maxAppendBlobBlocks = 50000
+
 type appendBlockFunc = func()
 
 func newAppendBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, srcInfoProvider ISourceInfoProvider) (*appendBlobSenderBase, error) {
@@ -64,7 +76,6 @@ func newAppendBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pip
 		chunkSize)
 
 	srcSize := transferInfo.SourceSize
-	numChunks := getNumChunks(srcSize, chunkSize)
 
 	destURL, err := url.Parse(destination)
 	if err != nil {
@@ -73,6 +84,43 @@ func newAppendBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pip
 
 	destAppendBlobURL := azblob.NewAppendBlobURL(*destURL, p)
 
+	appendToExisting := false
+	appendOffset, alreadyAppended := int64(0), int64(0)
+	blocksAvailable := uint32(maxAppendBlobBlocks)
+	if jptm.GetOverwriteOption() == common.EOverwriteOption.Append() {
+		destProps, err := destAppendBlobURL.GetProperties(jptm.Context(), azblob.BlobAccessConditions{})
+		if typedErr, ok := err.(responseError); ok && typedErr.Response().StatusCode == http.StatusNotFound {
+			// nothing to append to, so the blob is created as usual (and any blob that an earlier attempt created was deleted when it failed)
+			jptm.SetAppendStart(0, 0)
+		} else if err != nil {
+			return nil, err
+		} else if destProps.BlobType() != azblob.BlobAppendBlob {
+			return nil, fmt.Errorf("cannot append to the destination, since it is a %s rather than an append blob", destProps.BlobType())
+		} else {
+			// an earlier attempt of this transfer may have appended some of the source already, so it is appended
+			// from where the blob ended before that attempt, rather than from where it ends now
+			startLength, startBlocks, recorded := jptm.AppendStart()
+			if !recorded {
+				startLength, startBlocks = destProps.ContentLength(), uint32(destProps.BlobCommittedBlockCount())
+				jptm.SetAppendStart(startLength, startBlocks)
+			}
+			appendToExisting = true
+			appendOffset = startLength
+			alreadyAppended = destProps.ContentLength() - startLength
+			blocksAvailable -= startBlocks
+		}
+	}
+
+	chunkSize, numChunks, err := fitAppendBlobChunks(srcSize, chunkSize, blocksAvailable)
+	if err != nil {
+		return nil, err
+	}
+	if alreadyAppended < 0 || alreadyAppended > srcSize || (alreadyAppended%chunkSize != 0 && alreadyAppended != srcSize) {
+		// appends are whole chunks, in order, so something other than this transfer has changed the blob
+		return nil, fmt.Errorf("cannot carry on appending to the destination, since it holds %d bytes, which isn't the %d it held "+
+			"before this transfer started appending to it plus whole chunks of the source", appendOffset+alreadyAppended, appendOffset)
+	}
+
 	props, err := srcInfoProvider.Properties()
 	if err != nil {
 		return nil, err
@@ -87,7 +135,23 @@ func newAppendBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pip
 		headersToApply:         props.SrcHTTPHeaders.ToAzBlobHTTPHeaders(),
 		metadataToApply:        props.SrcMetadata.ToAzBlobMetadata(),
 		blobTagsToApply:        props.SrcBlobTags.ToAzBlobTagsMap(),
-		soleChunkFuncSemaphore: semaphore.NewWeighted(1)}, nil
+		soleChunkFuncSemaphore: semaphore.NewWeighted(1),
+		appendToExisting:       appendToExisting,
+		appendOffset:           appendOffset,
+		alreadyAppended:        alreadyAppended}, nil
+}
+
+// fitAppendBlobChunks returns the chunk size and count to use for a source of srcSize bytes.
+// If the source needs more blocks than the blob has room for, the largest blocks allowed are used, so that it fits if at all possible
+func fitAppendBlobChunks(srcSize int64, chunkSize int64, blocksAvailable uint32) (int64, uint32, error) {
+	if srcSize > 0 && getNumChunks(srcSize, chunkSize) > blocksAvailable {
+		chunkSize = common.MaxAppendBlobBlockSize
+	}
+	numChunks := getNumChunks(srcSize, chunkSize)
+	if srcSize > 0 && numChunks > blocksAvailable {
+		return 0, 0, fmt.Errorf("the source needs %d blocks of %d bytes, but the append blob only has room for %d more blocks", numChunks, chunkSize, blocksAvailable)
+	}
+	return chunkSize, numChunks, nil
 }
 
 func (s *appendBlobSenderBase) SendableEntityType() common.EntityType {
@@ -130,6 +194,9 @@ func (s *appendBlobSenderBase) generateAppendBlockToRemoteFunc(id common.ChunkID
 			// nothing to do, since this is a dummy chunk in a zero-size file, and the prologue will have done all the real work
 			return
 		}
+		if id.OffsetInFile() < s.alreadyAppended {
+			return // an earlier attempt appended it
+		}
 
 		appendBlock()
 	})
@@ -143,15 +210,28 @@ func (s *appendBlobSenderBase) Prologue(ps common.PrologueState) (destinationMod
 	}
 
 	destinationModified = true
+	if s.appendToExisting {
+		// the blob, along with its existing properties, is kept as it is, and the source is appended to it
+		if s.alreadyAppended > 0 {
+			s.jptm.Log(pipeline.LogInfo, fmt.Sprintf("Carrying on appending to the existing blob, at offset %d, since an earlier attempt already appended "+
+				"the first %d bytes of the source", s.appendPosition(s.alreadyAppended), s.alreadyAppended))
+			return
+		}
+		s.jptm.Log(pipeline.LogInfo, fmt.Sprintf("Appending to the existing blob, starting at offset %d", s.appendOffset))
+		return
+	}
+
 	blobTags := s.blobTagsToApply
 	separateSetTagsRequired := separateSetTagsRequired(blobTags)
 	if separateSetTagsRequired || len(blobTags) == 0 {
 		blobTags = nil
 	}
-	if _, err := s.destAppendBlobURL.Create(s.jptm.Context(), s.headersToApply, s.metadataToApply, azblob.BlobAccessConditions{}, blobTags); err != nil {
+	resp, err := s.destAppendBlobURL.Create(s.jptm.Context(), s.headersToApply, s.metadataToApply, s.jptm.Info().destBlobAccessConditions(), blobTags)
+	if err != nil {
 		s.jptm.FailActiveSend("Creating blob", err)
 		return
 	}
+	s.jptm.SetDestinationVersionID(resp.VersionID()) // appending blocks doesn't create new versions, so this is the version that will hold the data
 
 	if separateSetTagsRequired {
 		if _, err := s.destAppendBlobURL.SetTags(s.jptm.Context(), nil, nil, nil, nil, nil, nil, s.blobTagsToApply); err != nil {
@@ -161,6 +241,11 @@ func (s *appendBlobSenderBase) Prologue(ps common.PrologueState) (destinationMod
 	return
 }
 
+// appendPosition returns the position in the destination at which the chunk starting at the given source offset must be appended
+func (s *appendBlobSenderBase) appendPosition(offsetInFile int64) int64 {
+	return s.appendOffset + offsetInFile
+}
+
 func (s *appendBlobSenderBase) Epilogue() {
 	// Empty function because you don't have to commit on an append blob
 }
@@ -174,6 +259,16 @@ func (s *appendBlobSenderBase) Cleanup() {
 		// TODO: particularly, given that this is an APPEND blob, do we really need to delete it?  But if we don't delete it,
 		//   it will still be in an ambiguous situation with regard to how much has been added to it.  Probably best to delete
 		//   to be consistent with other
+		if s.appendToExisting {
+			// the blob held data before this transfer started, which must not be lost
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Not deleting the append blob, since it existed before the transfer. It may hold part of the source")
+			return
+		}
+		if destWriteWasRefused(jptm) {
+			// the blob was never created by us, so it must not be deleted
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Not deleting destination append blob, since the service refused to write it")
+			return
+		}
 		deletionContext, cancelFunc := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancelFunc()
 		_, err := s.destAppendBlobURL.Delete(deletionContext, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
@@ -51,7 +51,7 @@ func (u *appendBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex in
 		body := newPacedRequestBody(u.jptm.Context(), reader, u.pacer)
 		_, err := u.destAppendBlobURL.AppendBlock(u.jptm.Context(), body,
 			azblob.AppendBlobAccessConditions{
-				AppendPositionAccessConditions: azblob.AppendPositionAccessConditions{IfAppendPositionEqual: id.OffsetInFile()},
+				AppendPositionAccessConditions: azblob.AppendPositionAccessConditions{IfAppendPositionEqual: u.appendPosition(id.OffsetInFile())},
 			}, nil)
 		if err != nil {
 			u.jptm.FailActiveUpload("Appending block", err)
@@ -85,5 +85,6 @@ func (u *appendBlobUploader) GetDestinationLength() (int64, error) {
 		return -1, err
 	}
 
-	return prop.ContentLength(), nil
+	// only the part that this transfer appended corresponds to the source
+	return prop.ContentLength() - u.appendOffset, nil
 }
@@ -64,7 +64,7 @@ func (c *urlToAppendBlobCopier) GenerateCopyFunc(id common.ChunkID, blockIndex i
 		}
 		_, err := c.destAppendBlobURL.AppendBlockFromURL(ctxWithLatestServiceVersion, c.srcURL, id.OffsetInFile(), adjustedChunkSize,
 			azblob.AppendBlobAccessConditions{
-				AppendPositionAccessConditions: azblob.AppendPositionAccessConditions{IfAppendPositionEqual: id.OffsetInFile()},
+				AppendPositionAccessConditions: azblob.AppendPositionAccessConditions{IfAppendPositionEqual: c.appendPosition(id.OffsetInFile())},
 			}, azblob.ModifiedAccessConditions{}, nil)
 		if err != nil {
 			c.jptm.FailActiveS2SCopy("Appending block from URL", err)
@@ -82,5 +82,6 @@ func (c *urlToAppendBlobCopier) GetDestinationLength() (int64, error) {
 		return -1, err
 	}
 
-	return properties.ContentLength(), nil
+	// only the part that this transfer appended corresponds to the source
+	return properties.ContentLength() - c.appendOffset, nil
 }
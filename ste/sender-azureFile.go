@@ -80,6 +80,12 @@ func newAzureFileSenderBase(jptm IJobPartTransferMgr, destination string, p pipe
 		}
 	}
 
+	// fail now, rather than after creating the file, if it can't be that big
+	if !info.IsFolderPropertiesTransfer() && info.SourceSize > common.MaxAzureFileSize {
+		return nil, fmt.Errorf("file %s of size %.2fGiB exceeds the maximum size of an Azure File, which is 4TiB",
+			info.Source, float64(info.SourceSize)/(1024*1024*1024))
+	}
+
 	// compute num chunks (irrelevant but harmless for folders)
 	numChunks := getNumChunks(info.SourceSize, chunkSize)
 
@@ -251,7 +257,12 @@ func (u *azureFileSenderBase) addPermissionsToHeaders(info TransferInfo, destUrl
 
 			// and happen to be the same account and share, we can get away with using the same key and save a trip.
 			if srcURLParts.Host == dstURLParts.Host && srcURLParts.ShareName == dstURLParts.ShareName {
-				u.headersToApply.PermissionKey = &fSIP.cachedPermissionKey
+				props, err := fSIP.getCachedProperties()
+				if err != nil {
+					return "Getting permissions", err
+				}
+				key := props.FilePermissionKey()
+				u.headersToApply.PermissionKey = &key
 			}
 		}
 
@@ -265,7 +276,8 @@ func (u *azureFileSenderBase) addPermissionsToHeaders(info TransferInfo, destUrl
 		}
 	}
 
-	if len(*u.headersToApply.PermissionString) > filesServiceMaxSDDLSize {
+	// a large SDDL can't go in a header, so it is put to the share (in the body of a request) and referred to by its key
+	if u.headersToApply.PermissionString != nil && len(*u.headersToApply.PermissionString) > filesServiceMaxSDDLSize {
 		fURLParts := azfile.NewFileURLParts(destUrl)
 		fURLParts.DirectoryOrFilePath = ""
 		shareURL := azfile.NewShareURL(fURLParts.URL(), u.pipeline)
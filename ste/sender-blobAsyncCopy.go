@@ -0,0 +1,316 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	asyncCopyInitialPollInterval = 500 * time.Millisecond
+	asyncCopyMinMaxPollInterval  = 2 * time.Second
+	asyncCopyMaxPollInterval     = time.Minute
+)
+
+// urlToBlobAsyncCopier copies a whole blob with one asynchronous Copy Blob operation, rather than chunk by chunk.
+// It always has exactly one chunk, whose func starts the copy. Its status is then checked in later chunk funcs, until the service says the copy has finished.
+type urlToBlobAsyncCopier struct {
+	jptm            IJobPartTransferMgr
+	destBlobURL     azblob.BlobURL
+	srcURL          url.URL
+	srcSize         int64
+	metadataToApply azblob.Metadata
+	blobTagsToApply azblob.BlobTagsMap
+	destBlobTier    azblob.AccessTierType
+
+	// copyID identifies the copy once it has been started, so that it can be aborted if the transfer is cancelled
+	copyID string
+	// setTagsSeparately is set when the tags can't be given with the copy, so must be set once it has succeeded
+	setTagsSeparately bool
+}
+
+func newURLToBlobAsyncCopier(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, srcInfoProvider IBlobSourceInfoProvider) (s2sCopier, error) {
+	destURL, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	srcURL, err := srcInfoProvider.PreSignedSourceURL()
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := srcInfoProvider.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	// Like the other blob copiers, preserve the source's tier for block blobs, unless the user set one explicitly
+	destBlobTier := azblob.AccessTierNone
+	if srcInfoProvider.BlobType() == azblob.BlobBlockBlob {
+		destBlobTier = srcInfoProvider.BlobTier()
+		if blockBlobTierOverride, _ := jptm.BlobTiers(); blockBlobTierOverride != common.EBlockBlobTier.None() {
+			destBlobTier = blockBlobTierOverride.ToAccessTierType()
+		}
+	}
+
+	return &urlToBlobAsyncCopier{
+		jptm:            jptm,
+		destBlobURL:     azblob.NewBlobURL(*destURL, p),
+		srcURL:          *srcURL,
+		srcSize:         jptm.Info().SourceSize,
+		metadataToApply: props.SrcMetadata.ToAzBlobMetadata(),
+		blobTagsToApply: props.SrcBlobTags.ToAzBlobTagsMap(),
+		destBlobTier:    destBlobTier,
+	}, nil
+}
+
+func (c *urlToBlobAsyncCopier) ChunkSize() int64 {
+	// the whole blob is one chunk
+	return common.Iffint64(c.srcSize > 0, c.srcSize, 1)
+}
+
+func (c *urlToBlobAsyncCopier) NumChunks() uint32 {
+	return 1
+}
+
+func (c *urlToBlobAsyncCopier) RemoteFileExists() (bool, time.Time, error) {
+	return remoteObjectExists(c.destBlobURL.GetProperties(c.jptm.Context(), azblob.BlobAccessConditions{}))
+}
+
+func (c *urlToBlobAsyncCopier) Prologue(ps common.PrologueState) (destinationModified bool) {
+	return false // the copy itself is started by the chunk func
+}
+
+// GenerateCopyFunc returns the func of the one chunk, which starts the copy. The service can take hours over a copy,
+// so rather than wait for it in the chunk worker, each check of the copy's status is scheduled as a chunk func of its own,
+// and the chunk is only reported done by the check that finds the copy has finished.
+func (c *urlToBlobAsyncCopier) GenerateCopyFunc(id common.ChunkID, blockIndex int32, adjustedChunkSize int64, chunkIsWholeFile bool) chunkFunc {
+	return c.createAsyncCopyChunkFunc(id, func() (pending bool) {
+		jptm := c.jptm
+
+		jptm.LogChunkStatus(id, common.EWaitReason.S2SCopyOnWire())
+		if c.destBlobTier != azblob.AccessTierNone && !ValidateTier(jptm, c.destBlobTier, c.destBlobURL, jptm.Context()) {
+			c.destBlobTier = azblob.DefaultAccessTier
+		}
+
+		blobTags := c.blobTagsToApply
+		c.setTagsSeparately = separateSetTagsRequired(blobTags)
+		if c.setTagsSeparately || len(blobTags) == 0 {
+			blobTags = nil
+		}
+
+		copyID, err := c.startCopy(blobTags)
+		if err != nil {
+			jptm.FailActiveSend("Starting async copy", err)
+			return false
+		}
+		c.copyID = copyID
+
+		c.scheduleStatusCheck(id, asyncCopyInitialPollInterval)
+		return true
+	})
+}
+
+// statusCheckFunc returns a chunk func that checks the status of the copy once.
+// If the copy is still pending, the next check is scheduled, backing off between checks (more so for larger blobs, which take longer to copy).
+func (c *urlToBlobAsyncCopier) statusCheckFunc(id common.ChunkID, interval time.Duration) chunkFunc {
+	return c.createAsyncCopyChunkFunc(id, func() (pending bool) {
+		jptm := c.jptm
+
+		done, err := c.checkCopy()
+		if err != nil {
+			if jptm.WasCanceled() {
+				c.abortCopy()
+				return false
+			}
+			jptm.FailActiveSend("Async copy", err)
+			return false
+		}
+		if !done {
+			c.scheduleStatusCheck(id, nextAsyncCopyPollInterval(interval, c.srcSize))
+			return true
+		}
+
+		if c.setTagsSeparately {
+			if _, err := c.destBlobURL.SetTags(jptm.Context(), nil, nil, nil, nil, nil, nil, c.blobTagsToApply); err != nil {
+				jptm.Log(pipeline.LogWarning, err.Error())
+			}
+		}
+		return false
+	})
+}
+
+// scheduleStatusCheck schedules the next check of the copy's status once the interval has passed,
+// or straight away if the transfer is cancelled, so that the copy can be aborted
+func (c *urlToBlobAsyncCopier) scheduleStatusCheck(id common.ChunkID, interval time.Duration) {
+	go func() {
+		select {
+		case <-c.jptm.Context().Done():
+		case <-time.After(interval):
+		}
+		c.jptm.ScheduleChunks(c.statusCheckFunc(id, interval))
+	}()
+}
+
+// createAsyncCopyChunkFunc is like createSendToRemoteChunkFunc, except that the chunk is not reported done when body says the copy is
+// still pending, since a later status check will report it instead
+func (c *urlToBlobAsyncCopier) createAsyncCopyChunkFunc(id common.ChunkID, body func() (pending bool)) chunkFunc {
+	jptm := c.jptm
+	return func(workerId int) {
+		jptm.OccupyAConnection()
+		defer jptm.ReleaseAConnection()
+
+		if jptm.WasCanceled() {
+			if c.copyID != "" {
+				c.abortCopy()
+			}
+			jptm.LogChunkStatus(id, common.EWaitReason.Cancelled())
+			jptm.ReportChunkDone(id)
+			return
+		}
+
+		jptm.SetDestinationIsModified()
+
+		if body() {
+			return
+		}
+		jptm.LogChunkStatus(id, common.EWaitReason.ChunkDone())
+		jptm.ReportChunkDone(id)
+	}
+}
+
+// startCopy starts the copy, and returns its ID.
+// If a copy from the same source is already pending (e.g. because an earlier run of this job started it), that copy is adopted instead.
+func (c *urlToBlobAsyncCopier) startCopy(blobTags azblob.BlobTagsMap) (string, error) {
+	resp, err := c.destBlobURL.StartCopyFromURL(c.jptm.Context(), c.srcURL, c.metadataToApply, azblob.ModifiedAccessConditions{}, c.jptm.Info().destBlobAccessConditions(), c.destBlobTier, blobTags)
+	if err == nil {
+		return resp.CopyID(), nil
+	}
+
+	if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodePendingCopyOperation {
+		props, propsErr := c.destBlobURL.GetProperties(c.jptm.Context(), azblob.BlobAccessConditions{})
+		if propsErr == nil && props.CopyStatus() == azblob.CopyStatusPending {
+			if pendingSource, parseErr := url.Parse(props.CopySource()); parseErr == nil && pendingSource.Host == c.srcURL.Host && pendingSource.Path == c.srcURL.Path {
+				c.jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Resuming wait for a pending copy from the same source, with ID "+props.CopyID())
+				return props.CopyID(), nil
+			}
+		}
+	}
+
+	return "", err
+}
+
+// checkCopy gets the status of the copy from the destination once. It returns whether the copy has finished, and an error if it didn't succeed.
+func (c *urlToBlobAsyncCopier) checkCopy() (done bool, err error) {
+	props, err := c.destBlobURL.GetProperties(c.jptm.Context(), azblob.BlobAccessConditions{})
+	if err != nil {
+		return true, err
+	}
+	if props.CopyID() != c.copyID {
+		return true, fmt.Errorf("the destination is being copied by another operation, with ID %s", props.CopyID())
+	}
+
+	if done, err := asyncCopyOutcome(props.CopyStatus(), props.CopyStatusDescription()); done {
+		if err == nil {
+			c.jptm.SetDestinationVersionID(props.VersionID())
+		}
+		return true, err
+	}
+
+	if c.jptm.ShouldLog(pipeline.LogDebug) {
+		c.jptm.Log(pipeline.LogDebug, fmt.Sprintf("Async copy %s is pending, with progress %s", c.copyID, props.CopyProgress()))
+	}
+	return false, nil
+}
+
+// abortCopy stops the copy when the transfer is cancelled, since otherwise the service would carry on with it
+func (c *urlToBlobAsyncCopier) abortCopy() {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelFn()
+	if _, err := c.destBlobURL.AbortCopyFromURL(ctx, c.copyID, azblob.LeaseAccessConditions{}); err != nil {
+		c.jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Could not abort async copy after cancellation. "+err.Error())
+	}
+}
+
+// asyncCopyOutcome reports whether a copy in the given state has finished and, if so, the error (if any) with which the transfer should fail
+func asyncCopyOutcome(status azblob.CopyStatusType, description string) (done bool, err error) {
+	switch status {
+	case azblob.CopyStatusPending:
+		return false, nil
+	case azblob.CopyStatusSuccess:
+		return true, nil
+	case azblob.CopyStatusAborted:
+		return true, errors.New("the copy was aborted. " + description)
+	case azblob.CopyStatusFailed:
+		return true, errors.New("the copy failed. " + description)
+	default:
+		return true, fmt.Errorf("the destination reported unexpected copy status '%s'", status)
+	}
+}
+
+// nextAsyncCopyPollInterval doubles the interval between polls, up to a limit that grows by a second for each GiB in the blob
+func nextAsyncCopyPollInterval(current time.Duration, blobSize int64) time.Duration {
+	limit := asyncCopyMinMaxPollInterval + time.Duration(blobSize/(1024*1024*1024))*time.Second
+	if limit > asyncCopyMaxPollInterval {
+		limit = asyncCopyMaxPollInterval
+	}
+
+	next := current * 2
+	if next > limit {
+		next = limit
+	}
+	return next
+}
+
+func (c *urlToBlobAsyncCopier) Epilogue() {
+	// nothing to do, since the service has already committed the blob when the copy succeeded
+}
+
+func (c *urlToBlobAsyncCopier) Cleanup() {
+	jptm := c.jptm
+
+	if jptm.IsDeadInflight() {
+		// an unsuccessful copy leaves an empty (or partial) blob behind, so remove it
+		deletionContext, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelFn()
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Deleting destination blob due to failure of async copy")
+		_, _ = c.destBlobURL.Delete(deletionContext, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	}
+}
+
+func (c *urlToBlobAsyncCopier) GetDestinationLength() (int64, error) {
+	properties, err := c.destBlobURL.GetProperties(c.jptm.Context(), azblob.BlobAccessConditions{})
+	if err != nil {
+		return -1, err
+	}
+
+	return properties.ContentLength(), nil
+}
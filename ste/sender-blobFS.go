@@ -24,6 +24,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -41,6 +42,18 @@ type blobFSSenderBase struct {
 	pacer               pacer
 	creationTimeHeaders *azbfs.BlobFSHTTPHeaders
 	flushThreshold      int64
+
+	// the POSIX permissions of the source, in octal, if they are to be preserved (otherwise empty),
+	// and the path properties that then hold the rest of its POSIX properties
+	posixPermissions    string
+	posixPathProperties map[string]string
+
+	// how much of the file has been appended and flushed, so that a paused upload can be resumed after what was flushed
+	// (see blobFSUploader.chunkAppended and resumeFlushedFile)
+	flushMu        *sync.Mutex
+	appended       []bool
+	appendedChunks uint32 // the number of chunks, from the start of the file, that have all been appended
+	flushedChunks  uint32 // the number of those that have been flushed
 }
 
 func newBlobFSSenderBase(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (*blobFSSenderBase, error) {
@@ -63,11 +76,22 @@ func newBlobFSSenderBase(jptm IJobPartTransferMgr, destination string, p pipelin
 	}
 	headers := props.SrcHTTPHeaders.ToBlobFSHTTPHeaders()
 
+	var posixPermissions string
+	var posixPathProperties map[string]string
+	if info.PreservePOSIXProperties {
+		if posixPermissions, posixPathProperties, err = blobFSPOSIXProperties(props.SrcMetadata); err != nil {
+			return nil, err
+		}
+	}
+
 	var h URLHolder
 	if info.IsFolderPropertiesTransfer() {
 		h = azbfs.NewDirectoryURL(*destURL, p)
 	} else {
 		h = azbfs.NewFileURL(*destURL, p)
+
+		// what an earlier run of this job flushed can only be reused if it was cut into the same chunks
+		jptm.PrepareChunkTracking(chunkSize)
 	}
 	return &blobFSSenderBase{
 		jptm:                jptm,
@@ -78,9 +102,25 @@ func newBlobFSSenderBase(jptm IJobPartTransferMgr, destination string, p pipelin
 		pacer:               pacer,
 		creationTimeHeaders: &headers,
 		flushThreshold:      chunkSize * int64(ADLSFlushThreshold),
+		posixPermissions:    posixPermissions,
+		posixPathProperties: posixPathProperties,
+		flushMu:             &sync.Mutex{},
+		appended:            make([]bool, numChunks),
 	}, nil
 }
 
+// blobFSPOSIXProperties turns the POSIX properties that a local source put in its metadata into the native permissions of an
+// ADLS Gen2 path. The ownership can't be preserved in the same way, since ADLS Gen2 owners are AAD identities rather than Unix IDs,
+// so all of the properties are also kept as the path's properties (which are its metadata, when it is read as a blob),
+// from which a download can restore them.
+func blobFSPOSIXProperties(metadata common.Metadata) (permissions string, pathProperties map[string]string, err error) {
+	p, ok, err := common.POSIXPropertiesFromMetadata(metadata)
+	if err != nil || !ok {
+		return "", nil, err
+	}
+	return p.OctalMode(), p.AddToMetadata(nil), nil
+}
+
 func (u *blobFSSenderBase) fileURL() azbfs.FileURL {
 	return u.fileOrDirURL.(azbfs.FileURL)
 }
@@ -154,8 +194,19 @@ func (u *blobFSSenderBase) Prologue(state common.PrologueState) (destinationModi
 		return
 	}
 
+	// carry on after what an earlier run of this job flushed, rather than create the file again and so discard it
+	if u.resumeFlushedFile() {
+		u.jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, fmt.Sprintf("resuming upload after the first %d bytes, which were flushed by an earlier run", u.flushedLength()))
+		return
+	}
+
 	// Create file with the source size
-	_, err = u.fileURL().Create(u.jptm.Context(), *u.creationTimeHeaders) // "create" actually calls "create path", so if we didn't need to track folder creation, we could just let this call create the folder as needed
+	// ("create" actually calls "create path", so if we didn't need to track folder creation, we could just let this call create the folder as needed)
+	if u.posixPermissions != "" {
+		_, err = u.fileURL().CreateWithPermissions(u.jptm.Context(), *u.creationTimeHeaders, u.posixPermissions, u.posixPathProperties)
+	} else {
+		_, err = u.fileURL().Create(u.jptm.Context(), *u.creationTimeHeaders)
+	}
 	if err != nil {
 		u.jptm.FailActiveUpload("Creating file", err)
 		return
@@ -163,9 +214,47 @@ func (u *blobFSSenderBase) Prologue(state common.PrologueState) (destinationModi
 	return
 }
 
+// resumeFlushedFile returns whether an earlier run of this job already created the file and flushed the start of it, which the
+// plan records as the run of staged chunks from the start of the file. In that case, the upload carries on after them.
+// If the file is gone, or no longer has the flushed length, the recorded chunks are discarded so that the file is created afresh.
+func (u *blobFSSenderBase) resumeFlushedFile() bool {
+	flushed := uint32(0)
+	for flushed < u.numChunks && u.jptm.IsChunkStaged(int32(flushed)) {
+		flushed++
+	}
+	if flushed == 0 {
+		return false
+	}
+
+	u.flushedChunks = flushed
+	props, err := u.fileURL().GetProperties(u.jptm.Context())
+	if err != nil || props.ContentLength() != u.flushedLength() {
+		u.flushedChunks = 0
+		u.jptm.ResetChunkTracking()
+		return false
+	}
+	u.appendedChunks = flushed
+	for i := uint32(0); i < flushed; i++ {
+		u.appended[i] = true
+	}
+	return true
+}
+
+// flushedLength is how much of the file has been flushed
+func (u *blobFSSenderBase) flushedLength() int64 {
+	return common.Iffint64(int64(u.flushedChunks)*u.chunkSize < u.jptm.Info().SourceSize, int64(u.flushedChunks)*u.chunkSize, u.jptm.Info().SourceSize)
+}
+
 func (u *blobFSSenderBase) Cleanup() {
 	jptm := u.jptm
 
+	if jptm.IsDeadInflight() && jptm.TransferStatusIgnoringCancellation() == common.ETransferStatus.Paused() {
+		// The job was paused. Keep the file, since the chunk bitmap in the plan file
+		// records what has been flushed, and the rest will be sent when the job is resumed.
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Keeping partially flushed file since the job was paused")
+		return
+	}
+
 	// Cleanup if status is now failed
 	if jptm.IsDeadInflight() {
 		// transfer was either failed or cancelled
@@ -214,6 +303,10 @@ func (u *blobFSSenderBase) doEnsureDirExists(d azbfs.DirectoryURL) error {
 }
 
 func (u *blobFSSenderBase) SetFolderProperties() error {
-	// we don't currently preserve any properties for BlobFS folders
-	return nil
+	// the only properties we preserve for BlobFS folders are their POSIX permissions
+	if u.posixPermissions == "" {
+		return nil
+	}
+	_, err := u.dirURL().SetPermissions(u.jptm.Context(), u.posixPermissions)
+	return err
 }
@@ -21,11 +21,17 @@
 package ste
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-azcopy/common"
-	"math"
 )
 
+// blobFSResumeFlushChunks is the most chunks that are appended before they are flushed, so that a paused upload loses no more than
+// that many chunks. (It's also limited by ADLSFlushThreshold.)
+var blobFSResumeFlushChunks uint32 = 64
+
 type blobFSUploader struct {
 	blobFSSenderBase
 	md5Channel chan []byte
@@ -55,6 +61,12 @@ func (u *blobFSUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int32,
 			return
 		}
 
+		// skip the chunk if an earlier run of this job already flushed it
+		if jptm.IsChunkStaged(blockIndex) {
+			_ = reader.Close()
+			return
+		}
+
 		// upload the byte range represented by this chunk
 		jptm.LogChunkStatus(id, common.EWaitReason.Body())
 		body := newPacedRequestBody(jptm.Context(), reader, u.pacer)
@@ -63,9 +75,45 @@ func (u *blobFSUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int32,
 			jptm.FailActiveUpload("Uploading range", err)
 			return
 		}
+
+		u.chunkAppended(blockIndex)
 	})
 }
 
+// chunkAppended notes that the chunk has been appended. Once enough chunks from the start of the file, beyond those last flushed,
+// have all been appended, they are flushed, so that the service commits them even if the job is paused. They are then recorded
+// in the plan file, for a resumed upload to carry on after them (see resumeFlushedFile).
+// The last chunk is always left for the epilogue, since the flush that includes it closes the file.
+func (u *blobFSUploader) chunkAppended(chunkIndex int32) {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.appended[chunkIndex] = true
+	for u.appendedChunks < u.numChunks && u.appended[u.appendedChunks] {
+		u.appendedChunks++
+	}
+
+	chunksPerFlush := blobFSResumeFlushChunks
+	if ADLSFlushThreshold < chunksPerFlush {
+		chunksPerFlush = ADLSFlushThreshold
+	}
+	if u.appendedChunks-u.flushedChunks < chunksPerFlush || u.appendedChunks == u.numChunks {
+		return
+	}
+
+	jptm := u.jptm
+	position := int64(u.appendedChunks) * u.chunkSize
+	if _, err := u.fileURL().FlushData(jptm.Context(), position, nil, *u.creationTimeHeaders, true, false); err != nil {
+		// the epilogue flushes everything anyway, so this only means that less can be resumed
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, fmt.Sprintf("could not flush the first %d bytes ahead of the rest: %s", position, err))
+		return
+	}
+	for chunk := u.flushedChunks; chunk < u.appendedChunks; chunk++ {
+		jptm.SetChunkStaged(int32(chunk))
+	}
+	u.flushedChunks = u.appendedChunks
+}
+
 func (u *blobFSUploader) Epilogue() {
 	jptm := u.jptm
 
@@ -74,8 +122,9 @@ func (u *blobFSUploader) Epilogue() {
 		ss := jptm.Info().SourceSize
 		md5Hash, ok := <-u.md5Channel
 		if ok {
-			// Flush incrementally to avoid timeouts on a full flush
-			for i := int64(math.Min(float64(ss), float64(u.flushThreshold))); ; i = int64(math.Min(float64(ss), float64(i+u.flushThreshold))) {
+			// Flush incrementally to avoid timeouts on a full flush, starting after what has been flushed already
+			flushed := u.flushedLength()
+			for i := int64(math.Min(float64(ss), float64(flushed+u.flushThreshold))); ; i = int64(math.Min(float64(ss), float64(i+u.flushThreshold))) {
 				// Close only at the end of the file, keep all uncommitted data before then.
 				_, err := u.fileURL().FlushData(jptm.Context(), i, md5Hash, *u.creationTimeHeaders, i != ss, i == ss)
 				if err != nil {
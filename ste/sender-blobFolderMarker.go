@@ -0,0 +1,110 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// blobFolderMarkerSender sends a folder to Blob storage, which has no real folders, as a zero-byte block blob named after it,
+// with the metadata by which ADLS Gen2 and HDFS mark directories (see common.FolderMarkerMetadataKey).
+// Downloads that are asked to can then recreate the folder, even when it is empty.
+type blobFolderMarkerSender struct {
+	jptm            IJobPartTransferMgr
+	destBlobURL     azblob.BlockBlobURL
+	metadataToApply azblob.Metadata
+}
+
+func newBlobFolderMarkerSender(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, sip ISourceInfoProvider) (sender, error) {
+	destURL, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+	props, err := sip.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(azblob.Metadata, len(props.SrcMetadata)+1)
+	for k, v := range props.SrcMetadata {
+		metadata[k] = v
+	}
+	metadata[common.FolderMarkerMetadataKey] = "true"
+	return &blobFolderMarkerSender{jptm: jptm, destBlobURL: azblob.NewBlockBlobURL(*destURL, p), metadataToApply: metadata}, nil
+}
+
+func (s *blobFolderMarkerSender) ChunkSize() int64 {
+	return 0
+}
+
+func (s *blobFolderMarkerSender) NumChunks() uint32 {
+	return 0
+}
+
+func (s *blobFolderMarkerSender) RemoteFileExists() (bool, time.Time, error) {
+	return remoteObjectExists(s.destBlobURL.GetProperties(s.jptm.Context(), azblob.BlobAccessConditions{}))
+}
+
+func (s *blobFolderMarkerSender) Prologue(common.PrologueState) (destinationModified bool) {
+	return false // folders have no prologue; the marker is put by EnsureFolderExists
+}
+
+func (s *blobFolderMarkerSender) Epilogue() {}
+
+func (s *blobFolderMarkerSender) Cleanup() {}
+
+func (s *blobFolderMarkerSender) GetDestinationLength() (int64, error) {
+	return 0, nil
+}
+
+func (s *blobFolderMarkerSender) GenerateUploadFunc(common.ChunkID, int32, common.SingleChunkReader, bool) chunkFunc {
+	panic("a folder has no chunks to upload")
+}
+
+func (s *blobFolderMarkerSender) Md5Channel() chan<- []byte {
+	return nil
+}
+
+// EnsureFolderExists puts the marker blob, unless there is already a blob of its name,
+// which is either the marker of an earlier job or a file that the folder must not replace
+func (s *blobFolderMarkerSender) EnsureFolderExists() error {
+	ifNotExists := azblob.BlobAccessConditions{ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny}}
+	_, err := s.destBlobURL.Upload(s.jptm.Context(), bytes.NewReader(nil), azblob.BlobHTTPHeaders{}, s.metadataToApply, ifNotExists, azblob.DefaultAccessTier, nil)
+	if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobAlreadyExists {
+		return nil // not an error as far as we are concerned. It just already exists
+	}
+	if err == nil {
+		s.jptm.GetFolderCreationTracker().RecordCreation(s.jptm.Info().Destination)
+	}
+	return err
+}
+
+// SetFolderProperties has nothing to do, since the marker's metadata is its only property, and it was put with the marker
+func (s *blobFolderMarkerSender) SetFolderProperties() error {
+	return nil
+}
@@ -43,9 +43,13 @@ type blockBlobSenderBase struct {
 	chunkSize        int64
 	numChunks        uint32
 	pacer            pacer
-	blockIDs         []string
+	blocks           []blockListEntry // in the order they are committed, which is the order of their data in the blob
 	destBlobTier     azblob.AccessTierType
 
+	// blockListSize is the size that the committed blocks must add up to: the source size, unless the data is
+	// transformed on the way (in which case the sender sets it once the transformed size is known)
+	blockListSize int64
+
 	// Headers and other info that we will apply to the destination
 	// object. For S2S, these come from the source service.
 	// When sending local data, they are computed based on
@@ -113,6 +117,9 @@ func newBlockBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipe
 
 	destBlockBlobURL := azblob.NewBlockBlobURL(*destURL, p)
 
+	// chunks staged by an earlier run of this job can only be reused if they were cut the same way
+	jptm.PrepareChunkTracking(chunkSize)
+
 	props, err := srcInfoProvider.Properties()
 	if err != nil {
 		return nil, err
@@ -132,7 +139,8 @@ func newBlockBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipe
 		chunkSize:        chunkSize,
 		numChunks:        numChunks,
 		pacer:            pacer,
-		blockIDs:         make([]string, numChunks),
+		blocks:           make([]blockListEntry, numChunks),
+		blockListSize:    jptm.Info().SourceSize,
 		headersToApply:   props.SrcHTTPHeaders.ToAzBlobHTTPHeaders(),
 		metadataToApply:  props.SrcMetadata.ToAzBlobMetadata(),
 		blobTagsToApply:  props.SrcBlobTags.ToAzBlobTagsMap(),
@@ -167,8 +175,8 @@ func (s *blockBlobSenderBase) Epilogue() {
 	jptm := s.jptm
 
 	s.muBlockIDs.Lock()
-	blockIDs := s.blockIDs
-	s.blockIDs = nil // so we know for sure that only this routine has access after we release the lock (nothing else should need it now, since we're in the epilogue. Nil-ing here is just being defensive)
+	blocks := s.blocks
+	s.blocks = nil // so we know for sure that only this routine has access after we release the lock (nothing else should need it now, since we're in the epilogue. Nil-ing here is just being defensive)
 	s.muBlockIDs.Unlock()
 	shouldPutBlockList := getPutListNeed(&s.atomicPutListIndicator)
 	if shouldPutBlockList == putListNeedUnknown && !jptm.WasCanceled() {
@@ -178,6 +186,12 @@ func (s *blockBlobSenderBase) Epilogue() {
 
 	// commit block list if necessary
 	if jptm.IsLive() && shouldPutBlockList == putListNeeded {
+		// a block list that doesn't add up to the source would silently corrupt the blob, so it's never committed
+		blockIDs, err := verifyBlockList(blocks, s.blockListSize)
+		if err != nil {
+			jptm.FailActiveSend("Verifying block list", err)
+			return
+		}
 		jptm.Log(pipeline.LogDebug, fmt.Sprintf("Conclude Transfer with BlockList %s", blockIDs))
 
 		// commit the blocks.
@@ -191,10 +205,12 @@ func (s *blockBlobSenderBase) Epilogue() {
 			blobTags = nil
 		}
 
-		if _, err := s.destBlockBlobURL.CommitBlockList(jptm.Context(), blockIDs, s.headersToApply, s.metadataToApply, azblob.BlobAccessConditions{}, s.destBlobTier, blobTags); err != nil {
+		resp, err := s.destBlockBlobURL.CommitBlockList(jptm.Context(), blockIDs, s.headersToApply, s.metadataToApply, jptm.Info().destBlobAccessConditions(), s.destBlobTier, blobTags)
+		if err != nil {
 			jptm.FailActiveSend("Committing block list", err)
 			return
 		}
+		jptm.SetDestinationVersionID(resp.VersionID())
 
 		if separateSetTagsRequired {
 			if _, err := s.destBlockBlobURL.SetTags(jptm.Context(), nil, nil, nil, nil, nil, nil, s.blobTagsToApply); err != nil {
@@ -213,7 +229,14 @@ func (s *blockBlobSenderBase) Cleanup() {
 		// Delete the uncommitted blobs
 		deletionContext, cancelFn := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancelFn()
-		if jptm.WasCanceled() {
+		if jptm.TransferStatusIgnoringCancellation() == common.ETransferStatus.Paused() {
+			// The job was paused. Keep the uncommitted blocks, since the chunk bitmap in the plan file
+			// records them as staged, and they will be committed when the job is resumed.
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Keeping uncommitted blocks since the job was paused")
+		} else if destWriteWasRefused(jptm) {
+			// The destination did not satisfy the ETag condition, so whatever is there belongs to someone else
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Not deleting destination blob, since the service refused to write it")
+		} else if jptm.WasCanceled() {
 			// If we cancelled, and the only blocks that exist are uncommitted, then clean them up.
 			// This prevents customer paying for their storage for a week until they get garbage collected, and it
 			// also prevents any issues with "too many uncommitted blocks" if user tries to upload the blob again in future.
@@ -233,16 +256,61 @@ func (s *blockBlobSenderBase) Cleanup() {
 	}
 }
 
-func (s *blockBlobSenderBase) setBlockID(index int32, value string) {
+// blockListEntry is a block of the block list, and the range of the blob's data that it holds
+type blockListEntry struct {
+	id     string
+	offset int64
+	length int64
+}
+
+// setBlockIDForChunk works out the index and ID of the chunk's block from the chunk's offset, and puts it in its place
+// in the block list. So the blocks are always committed in the order of their data, however the chunks are scheduled
+// and in whatever order their staging completes.
+func (s *blockBlobSenderBase) setBlockIDForChunk(id common.ChunkID) (blockIndex int32, encodedBlockID string) {
+	offset := id.OffsetInFile()
+	if offset%s.chunkSize != 0 {
+		panic(fmt.Errorf("chunk at offset %d is not on a block boundary (block size %d)", offset, s.chunkSize))
+	}
+	blockIndex = int32(offset / s.chunkSize)
+	encodedBlockID = s.generateEncodedBlockID(blockIndex)
+
 	s.muBlockIDs.Lock()
 	defer s.muBlockIDs.Unlock()
-	if len(s.blockIDs[index]) > 0 {
+	if len(s.blocks[blockIndex].id) > 0 {
 		panic(errors.New("block id set twice for one block"))
 	}
-	s.blockIDs[index] = value
+	s.blocks[blockIndex] = blockListEntry{id: encodedBlockID, offset: offset, length: id.Length()}
+	return blockIndex, encodedBlockID
+}
+
+// verifyBlockList checks that the blocks hold exactly the expectedSize bytes of the blob, one after the other, with no
+// gaps or overlaps, and returns their IDs in that order
+func verifyBlockList(blocks []blockListEntry, expectedSize int64) ([]string, error) {
+	blockIDs := make([]string, len(blocks))
+	next := int64(0) // where the next block's data must start
+	for i, b := range blocks {
+		switch {
+		case b.id == "":
+			return nil, fmt.Errorf("block %d of %d was never staged", i, len(blocks))
+		case b.offset > next:
+			return nil, fmt.Errorf("there is a gap in the block list: block %d starts at offset %d, but the blocks before it end at %d", i, b.offset, next)
+		case b.offset < next:
+			return nil, fmt.Errorf("there is an overlap in the block list: block %d starts at offset %d, but the blocks before it end at %d", i, b.offset, next)
+		}
+		blockIDs[i] = b.id
+		next += b.length
+	}
+	if next != expectedSize {
+		return nil, fmt.Errorf("the block list holds %d bytes, but the blob should have %d", next, expectedSize)
+	}
+	return blockIDs, nil
 }
 
-func (s *blockBlobSenderBase) generateEncodedBlockID() string {
-	blockID := common.NewUUID().String()
+// generateEncodedBlockID returns the ID of the block at the given index.
+// The ID is derived from the job ID rather than being random, so that when a job is resumed
+// the blocks that were staged by the earlier run can be included in the block list.
+// All IDs have the same length, as the service requires for the blocks of one blob.
+func (s *blockBlobSenderBase) generateEncodedBlockID(index int32) string {
+	blockID := fmt.Sprintf("%s%05d", s.jptm.Info().JobID.String(), index)
 	return base64.StdEncoding.EncodeToString([]byte(blockID))
 }
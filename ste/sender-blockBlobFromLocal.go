@@ -58,20 +58,23 @@ func (u *blockBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int
 		return u.generatePutWholeBlob(id, blockIndex, reader)
 	} else {
 		setPutListNeed(&u.atomicPutListIndicator, putListNeeded)
-		return u.generatePutBlock(id, blockIndex, reader)
+		return u.generatePutBlock(id, reader)
 	}
 }
 
 // generatePutBlock generates a func to upload the block of src data from given startIndex till the given chunkSize.
-func (u *blockBlobUploader) generatePutBlock(id common.ChunkID, blockIndex int32, reader common.SingleChunkReader) chunkFunc {
+func (u *blockBlobUploader) generatePutBlock(id common.ChunkID, reader common.SingleChunkReader) chunkFunc {
 	return createSendToRemoteChunkFunc(u.jptm, id, func() {
-		// step 1: generate block ID
-		encodedBlockID := u.generateEncodedBlockID()
+		// steps 1 and 2: generate the block ID from the chunk's offset, and save it in its place in the list of block IDs
+		blockIndex, encodedBlockID := u.setBlockIDForChunk(id)
 
-		// step 2: save the block ID into the list of block IDs
-		u.setBlockID(blockIndex, encodedBlockID)
+		// step 3: skip the block if an earlier run of this job already staged it
+		if u.jptm.IsChunkStaged(blockIndex) {
+			_ = reader.Close()
+			return
+		}
 
-		// step 3: put block to remote
+		// step 4: put block to remote
 		u.jptm.LogChunkStatus(id, common.EWaitReason.Body())
 		body := newPacedRequestBody(u.jptm.Context(), reader, u.pacer)
 		_, err := u.destBlockBlobURL.StageBlock(u.jptm.Context(), encodedBlockID, body, azblob.LeaseAccessConditions{}, nil)
@@ -79,6 +82,9 @@ func (u *blockBlobUploader) generatePutBlock(id common.ChunkID, blockIndex int32
 			u.jptm.FailActiveUpload("Staging block", err)
 			return
 		}
+
+		// step 5: remember that the block is staged, in case the job is resumed later
+		u.jptm.SetChunkStaged(blockIndex)
 	})
 }
 
@@ -90,6 +96,7 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 
 		// Upload the blob
 		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+		var resp *azblob.BlockBlobUploadResponse
 		var err error
 		if !ValidateTier(jptm, u.destBlobTier, u.destBlockBlobURL.BlobURL, u.jptm.Context()) {
 			u.destBlobTier = azblob.DefaultAccessTier
@@ -102,7 +109,7 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 		}
 
 		if jptm.Info().SourceSize == 0 {
-			_, err = u.destBlockBlobURL.Upload(jptm.Context(), bytes.NewReader(nil), u.headersToApply, u.metadataToApply, azblob.BlobAccessConditions{}, u.destBlobTier, blobTags)
+			resp, err = u.destBlockBlobURL.Upload(jptm.Context(), bytes.NewReader(nil), u.headersToApply, u.metadataToApply, jptm.Info().destBlobAccessConditions(), u.destBlobTier, blobTags)
 		} else {
 			// File with content
 
@@ -112,11 +119,11 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 				jptm.FailActiveUpload("Getting hash", errNoHash)
 				return
 			}
-			u.headersToApply.ContentMD5 = md5Hash
+			applyBlobHash(jptm, md5Hash, &u.headersToApply, &u.metadataToApply)
 
 			// Upload the file
 			body := newPacedRequestBody(jptm.Context(), reader, u.pacer)
-			_, err = u.destBlockBlobURL.Upload(jptm.Context(), body, u.headersToApply, u.metadataToApply, azblob.BlobAccessConditions{}, u.destBlobTier, blobTags)
+			resp, err = u.destBlockBlobURL.Upload(jptm.Context(), body, u.headersToApply, u.metadataToApply, jptm.Info().destBlobAccessConditions(), u.destBlobTier, blobTags)
 		}
 
 		// if the put blob is a failure, update the transfer status to failed
@@ -124,6 +131,7 @@ func (u *blockBlobUploader) generatePutWholeBlob(id common.ChunkID, blockIndex i
 			jptm.FailActiveUpload("Uploading blob", err)
 			return
 		}
+		jptm.SetDestinationVersionID(resp.VersionID())
 
 		if separateSetTagsRequired {
 			if _, err := u.destBlockBlobURL.SetTags(jptm.Context(), nil, nil, nil, nil, nil, nil, u.blobTagsToApply); err != nil {
@@ -142,7 +150,7 @@ func (u *blockBlobUploader) Epilogue() {
 
 		md5Hash, ok := <-u.md5Channel
 		if ok {
-			u.headersToApply.ContentMD5 = md5Hash
+			applyBlobHash(jptm, md5Hash, &u.headersToApply, &u.metadataToApply)
 		} else {
 			jptm.FailActiveSend("Getting hash", errNoHash)
 			return
@@ -70,7 +70,7 @@ func (c *urlToBlockBlobCopier) GenerateCopyFunc(id common.ChunkID, blockIndex in
 	}
 
 	setPutListNeed(&c.atomicPutListIndicator, putListNeeded)
-	return c.generatePutBlockFromURL(id, blockIndex, adjustedChunkSize)
+	return c.generatePutBlockFromURL(id, adjustedChunkSize)
 }
 
 // Version with Sync CopyBlob
@@ -105,10 +105,12 @@ func (c *urlToBlockBlobCopier) generateCreateEmptyBlob(id common.ChunkID) chunkF
 		if separateSetTagsRequired || len(blobTags) == 0 {
 			blobTags = nil
 		}
-		if _, err := c.destBlockBlobURL.Upload(c.jptm.Context(), bytes.NewReader(nil), c.headersToApply, c.metadataToApply, azblob.BlobAccessConditions{}, c.destBlobTier, blobTags); err != nil {
+		resp, err := c.destBlockBlobURL.Upload(c.jptm.Context(), bytes.NewReader(nil), c.headersToApply, c.metadataToApply, c.jptm.Info().destBlobAccessConditions(), c.destBlobTier, blobTags)
+		if err != nil {
 			jptm.FailActiveSend("Creating empty blob", err)
 			return
 		}
+		jptm.SetDestinationVersionID(resp.VersionID())
 
 		if separateSetTagsRequired {
 			if _, err := c.destBlockBlobURL.SetTags(jptm.Context(), nil, nil, nil, nil, nil, nil, c.blobTagsToApply); err != nil {
@@ -137,15 +139,17 @@ func (c *urlToBlockBlobCopier) generateCreateEmptyBlob(id common.ChunkID) chunkF
 // }
 
 // generatePutBlockFromURL generates a func to copy the block of src data from given startIndex till the given chunkSize.
-func (c *urlToBlockBlobCopier) generatePutBlockFromURL(id common.ChunkID, blockIndex int32, adjustedChunkSize int64) chunkFunc {
+func (c *urlToBlockBlobCopier) generatePutBlockFromURL(id common.ChunkID, adjustedChunkSize int64) chunkFunc {
 	return createSendToRemoteChunkFunc(c.jptm, id, func() {
-		// step 1: generate block ID
-		encodedBlockID := c.generateEncodedBlockID()
+		// steps 1 and 2: generate the block ID from the chunk's offset, and save it in its place in the list of block IDs
+		blockIndex, encodedBlockID := c.setBlockIDForChunk(id)
 
-		// step 2: save the block ID into the list of block IDs
-		c.setBlockID(blockIndex, encodedBlockID)
+		// step 3: skip the block if an earlier run of this job already staged it
+		if c.jptm.IsChunkStaged(blockIndex) {
+			return
+		}
 
-		// step 3: put block to remote
+		// step 4: put block to remote
 		c.jptm.LogChunkStatus(id, common.EWaitReason.S2SCopyOnWire())
 
 		// Set the latest service version from sdk as service version in the context, to use StageBlockFromURL API
@@ -160,6 +164,9 @@ func (c *urlToBlockBlobCopier) generatePutBlockFromURL(id common.ChunkID, blockI
 			c.jptm.FailActiveSend("Staging block from URL", err)
 			return
 		}
+
+		// step 5: remember that the block is staged, in case the job is resumed later
+		c.jptm.SetChunkStaged(blockIndex)
 	})
 }
 
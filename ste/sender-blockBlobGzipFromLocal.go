@@ -0,0 +1,199 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// how many of the blocks of a compressed file may be staged at once.
+// (They can't be spread over the chunk workers like other blocks, since they are only cut as the file is compressed.)
+const gzipUploadParallelism = 5
+
+// blockBlobGzipUploader uploads a local file as a block blob, compressing it with gzip on the way, so that it is stored compressed,
+// with a content encoding of gzip. Since the compressed size isn't known up front, the file is sent by a single chunk func,
+// which stages each block as soon as that much compressed data has been produced (much as when uploading from stdin).
+type blockBlobGzipUploader struct {
+	blockBlobSenderBase
+
+	// set by the streaming upload func, and only read after it has finished
+	sentLength int64
+	sentHash   []byte
+}
+
+func newBlockBlobGzipUploader(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (sender, error) {
+	senderBase, err := newBlockBlobSenderBase(jptm, destination, p, pacer, sip, azblob.AccessTierNone)
+	if err != nil {
+		return nil, err
+	}
+	senderBase.blocks = nil // they are appended as the blocks are cut
+
+	return &blockBlobGzipUploader{blockBlobSenderBase: *senderBase}, nil
+}
+
+func (u *blockBlobGzipUploader) SentLength() int64 {
+	return u.sentLength
+}
+
+func (u *blockBlobGzipUploader) GenerateStreamingUploadFunc(id common.ChunkID, sourceFileFactory common.ChunkReaderSourceFactory) chunkFunc {
+	return createSendToRemoteChunkFunc(u.jptm, id, func() {
+		jptm := u.jptm
+		setPutListNeed(&u.atomicPutListIndicator, putListNeeded) // even an empty file compresses to a few bytes, which go in a block
+
+		srcFile, err := sourceFileFactory()
+		if err != nil {
+			jptm.FailActiveUpload("Opening source", err)
+			return
+		}
+		defer srcFile.Close()
+		source := io.NewSectionReader(srcFile, 0, jptm.Info().SourceSize)
+
+		// the content type is inferred from the uncompressed data, since that's what the blob will hold once its encoding is undone
+		const mimeRecognitionLen = 512
+		ps := common.PrologueState{}
+		leadingBytes := make([]byte, mimeRecognitionLen)
+		if n, err := source.ReadAt(leadingBytes, 0); err == nil || err == io.EOF {
+			ps.LeadingBytes = leadingBytes[:n]
+		}
+		if u.Prologue(ps) {
+			jptm.SetDestinationIsModified()
+		}
+
+		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+		compressed := common.NewGzipCompressingReader(source)
+		defer compressed.Close()
+		if where, err := u.stageCompressedBlocks(compressed); err != nil {
+			jptm.FailActiveUpload(where, err)
+		}
+	})
+}
+
+// stageCompressedBlocks cuts the compressed data into blocks, and stages them, a few at a time.
+// If it fails, it returns what it was doing at the time, as well as the error.
+func (u *blockBlobGzipUploader) stageCompressedBlocks(compressed io.Reader) (where string, err error) {
+	ctx := u.jptm.Context()
+	var hasher hash.Hash
+	if u.jptm.ShouldPutMd5() {
+		hasher = u.jptm.ChecksumAlgorithm().NewHasher() // of the compressed data, since that's what the blob holds
+	} else {
+		hasher = common.NewNullHasher()
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, gzipUploadParallelism)
+	stageErrs := make(chan error, 1) // holds the first staging failure
+	firstStageErr := func() error {
+		select {
+		case err := <-stageErrs:
+			return err
+		default:
+			return nil
+		}
+	}
+	defer wg.Wait()
+
+	for blockIndex := int32(0); ; blockIndex++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return "Staging block", ctx.Err()
+		}
+		if err := firstStageErr(); err != nil {
+			return "Staging block", err
+		}
+
+		buffer := u.jptm.SlicePool().RentSlice(u.chunkSize)
+		n, readErr := io.ReadFull(compressed, buffer)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			u.jptm.SlicePool().ReturnSlice(buffer)
+			return "Compressing source", readErr
+		}
+		if n == 0 {
+			u.jptm.SlicePool().ReturnSlice(buffer)
+			break
+		}
+		if blockIndex >= common.MaxNumberOfBlocksPerBlob {
+			u.jptm.SlicePool().ReturnSlice(buffer)
+			return "Staging block", fmt.Errorf("the compressed file needs more than %d blocks of %d bytes. Use a larger block size", common.MaxNumberOfBlocksPerBlob, u.chunkSize)
+		}
+		_, _ = hasher.Write(buffer[:n])
+		encodedBlockID := u.generateEncodedBlockID(blockIndex)
+		u.muBlockIDs.Lock()
+		u.blocks = append(u.blocks, blockListEntry{id: encodedBlockID, offset: u.sentLength, length: int64(n)})
+		u.muBlockIDs.Unlock()
+		u.sentLength += int64(n)
+
+		wg.Add(1)
+		go func(buffer []byte, block []byte, encodedBlockID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer u.jptm.SlicePool().ReturnSlice(buffer)
+
+			body := newPacedRequestBody(ctx, bytes.NewReader(block), u.pacer)
+			if _, err := u.destBlockBlobURL.StageBlock(ctx, encodedBlockID, body, azblob.LeaseAccessConditions{}, nil); err != nil {
+				select {
+				case stageErrs <- err:
+				default:
+				}
+			}
+		}(buffer, buffer[:n], encodedBlockID)
+
+		if readErr != nil {
+			break // that was the last of the compressed data
+		}
+	}
+
+	wg.Wait()
+	if err := firstStageErr(); err != nil {
+		return "Staging block", err
+	}
+	u.sentHash = hasher.Sum(nil)
+	return "", nil
+}
+
+func (u *blockBlobGzipUploader) Epilogue() {
+	if u.jptm.IsLive() {
+		u.blockListSize = u.sentLength // the blob holds the compressed data
+		u.headersToApply.ContentEncoding = "gzip"
+		applyBlobHash(u.jptm, u.sentHash, &u.headersToApply, &u.metadataToApply)
+	}
+
+	u.blockBlobSenderBase.Epilogue()
+}
+
+func (u *blockBlobGzipUploader) GetDestinationLength() (int64, error) {
+	prop, err := u.destBlockBlobURL.GetProperties(u.jptm.Context(), azblob.BlobAccessConditions{})
+
+	if err != nil {
+		return -1, err
+	}
+
+	return prop.ContentLength(), nil
+}
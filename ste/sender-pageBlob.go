@@ -77,6 +77,15 @@ var (
 	md5NotSupportedInManagedDiskError = errors.New("the Content-MD5 hash is not supported for managed disk uploads")
 )
 
+// validatePageBlobSize fails the transfer early if the source can never fit in a page blob,
+// rather than letting it fail when the blob is created
+func validatePageBlobSize(srcSize int64) error {
+	if srcSize%azblob.PageBlobPageBytes != 0 {
+		return fmt.Errorf("the source size of %d bytes is not a multiple of %d bytes, which is required for page blobs", srcSize, azblob.PageBlobPageBytes)
+	}
+	return nil
+}
+
 func newPageBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, srcInfoProvider ISourceInfoProvider, inferredAccessTierType azblob.AccessTierType) (*pageBlobSenderBase, error) {
 	transferInfo := jptm.Info()
 
@@ -90,6 +99,9 @@ func newPageBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipel
 		chunkSize)
 
 	srcSize := transferInfo.SourceSize
+	if err := validatePageBlobSize(srcSize); err != nil {
+		return nil, err
+	}
 	numChunks := getNumChunks(srcSize, chunkSize)
 
 	destURL, err := url.Parse(destination)
@@ -99,6 +111,9 @@ func newPageBlobSenderBase(jptm IJobPartTransferMgr, destination string, p pipel
 
 	destPageBlobURL := azblob.NewPageBlobURL(*destURL, p)
 
+	// page ranges written by an earlier run of this job can only be reused if they were cut the same way
+	jptm.PrepareChunkTracking(chunkSize)
+
 	// This is only necessary if our destination is a managed disk impexp account.
 	// Read the in struct explanation if necessary.
 	var destRangeOptimizer *pageRangeOptimizer
@@ -221,8 +236,12 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 
 		s.jptm.Log(pipeline.LogInfo, "Blob is managed disk import/export blob, so no Create call is required") // the blob always already exists
 		return
-	} else {
-		destinationModified = true
+	}
+
+	destinationModified = true
+	if s.resumeExistingBlob() {
+		s.jptm.Log(pipeline.LogInfo, "Resuming upload into the page blob created by an earlier run of this job")
+		return
 	}
 
 	if s.jptm.ShouldInferContentType() {
@@ -242,17 +261,19 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 		blobTags = nil
 	}
 
-	if _, err := s.destPageBlobURL.Create(s.jptm.Context(),
+	resp, err := s.destPageBlobURL.Create(s.jptm.Context(),
 		s.srcSize,
 		0,
 		s.headersToApply,
 		s.metadataToApply,
-		azblob.BlobAccessConditions{},
+		s.jptm.Info().destBlobAccessConditions(),
 		destBlobTier,
-		blobTags); err != nil {
+		blobTags)
+	if err != nil {
 		s.jptm.FailActiveSend("Creating blob", err)
 		return
 	}
+	s.jptm.SetDestinationVersionID(resp.VersionID()) // writing pages doesn't create new versions, so this is the version that will hold the data
 
 	if separateSetTagsRequired {
 		if _, err := s.destPageBlobURL.SetTags(s.jptm.Context(), nil, nil, nil, nil, nil, nil, s.blobTagsToApply); err != nil {
@@ -263,6 +284,29 @@ func (s *pageBlobSenderBase) Prologue(ps common.PrologueState) (destinationModif
 	return
 }
 
+// resumeExistingBlob returns whether an earlier run of this job already created the destination and wrote some of its pages.
+// Creating the blob again would discard those pages, so in that case the blob is reused as it is.
+// If the blob is gone, or no longer has the right size, the recorded pages are discarded so that the blob is created afresh.
+func (s *pageBlobSenderBase) resumeExistingBlob() bool {
+	anyStaged := false
+	for i := int32(0); i < int32(s.numChunks); i++ {
+		if s.jptm.IsChunkStaged(i) {
+			anyStaged = true
+			break
+		}
+	}
+	if !anyStaged {
+		return false
+	}
+
+	p, err := s.destPageBlobURL.GetProperties(s.jptm.Context(), azblob.BlobAccessConditions{})
+	if err != nil || p.ContentLength() != s.srcSize {
+		s.jptm.ResetChunkTracking()
+		return false
+	}
+	return true
+}
+
 func (s *pageBlobSenderBase) Epilogue() {
 	_ = s.filePacer.Close() // release resources
 }
@@ -274,6 +318,13 @@ func (s *pageBlobSenderBase) Cleanup() {
 	if jptm.IsDeadInflight() {
 		if s.isInManagedDiskImportExportAccount() {
 			// no deletion is possible. User just has to upload it again.
+		} else if jptm.TransferStatusIgnoringCancellation() == common.ETransferStatus.Paused() {
+			// The job was paused. Keep the blob, since the chunk bitmap in the plan file
+			// records the pages already written, and the rest will be written when the job is resumed.
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Keeping partially written page blob since the job was paused")
+		} else if destWriteWasRefused(jptm) {
+			// the blob was never created by us, so it must not be deleted
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "Not deleting destination page blob, since the service refused to write it")
 		} else {
 			deletionContext, cancelFunc := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancelFunc()
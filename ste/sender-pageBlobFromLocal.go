@@ -59,6 +59,11 @@ func (u *pageBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int3
 			return
 		}
 
+		// skip the range if an earlier run of this job already wrote it
+		if jptm.IsChunkStaged(blockIndex) {
+			return
+		}
+
 		if reader.HasPrefetchedEntirelyZeros() {
 			var destContainsData bool
 			// We check if we should actually skip this page,
@@ -77,6 +82,7 @@ func (u *pageBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int3
 				jptm.Log(pipeline.LogDebug,
 					fmt.Sprintf("Not uploading range from %d to %d,  all bytes are zero",
 						id.OffsetInFile(), id.OffsetInFile()+reader.Length()))
+				jptm.SetChunkStaged(blockIndex)
 				return
 			}
 		}
@@ -98,6 +104,9 @@ func (u *pageBlobUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int3
 			jptm.FailActiveUpload("Uploading page", err)
 			return
 		}
+
+		// remember that the range is written, in case the job is resumed later
+		jptm.SetChunkStaged(blockIndex)
 	})
 }
 
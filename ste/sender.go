@@ -21,7 +21,9 @@
 package ste
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -107,6 +109,21 @@ type uploader interface {
 	Md5Channel() chan<- []byte
 }
 
+/////////////////////////////////////////////////////////////////////////////////////////////////
+// Abstraction of an uploader that transforms the data as it sends it (e.g. compressing it), so that what
+// the destination will hold, and so the number of blocks it will take, is only known once the whole file has been read.
+// Such a file is sent by a single chunk func, rather than by one chunk func per block.
+/////////////////////////////////////////////////////////////////////////////////////////////////
+type streamingUploader interface {
+	sender
+
+	// GenerateStreamingUploadFunc returns a func() that will read the whole local file, using the given factory, and send it to the remote location
+	GenerateStreamingUploadFunc(chunkID common.ChunkID, sourceFileFactory common.ChunkReaderSourceFactory) chunkFunc
+
+	// SentLength returns how many bytes the destination should hold, once the func has sent them all
+	SentLength() int64
+}
+
 func newMd5Channel() chan []byte {
 	return make(chan []byte, 1) // must be buffered, so as not to hold up the goroutine running anyToRemote (which needs to start on the NEXT file after finishing its current one)
 }
@@ -117,6 +134,11 @@ func newMd5Channel() chan []byte {
 // Others, such as the block blob uploader piggyback their MD5 setting on other calls, and so won't use this.
 func tryPutMd5Hash(jptm IJobPartTransferMgr, md5Channel <-chan []byte, worker func(hash []byte) error) {
 	md5Hash, ok := <-md5Channel
+	if ok && len(md5Hash) > 0 && jptm.ChecksumAlgorithm() != common.EHashAlgorithm.MD5() {
+		// these destinations have nowhere to keep any other kind of hash
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, fmt.Sprintf("A %v hash can only be kept on block blobs, so none was set on this destination", jptm.ChecksumAlgorithm()))
+		return
+	}
 	if ok {
 		err := worker(md5Hash)
 		if err != nil {
@@ -129,6 +151,22 @@ func tryPutMd5Hash(jptm IJobPartTransferMgr, md5Channel <-chan []byte, worker fu
 
 var errNoHash = errors.New("no hash computed")
 
+// applyBlobHash puts the hash that anyToRemote computed over the file's data where the blob will keep it.
+// MD5 hashes go in the Content-MD5 header, but SHA-256 hashes have no header of their own, so they go in the metadata.
+func applyBlobHash(jptm IJobPartTransferMgr, hash []byte, headers *azblob.BlobHTTPHeaders, metadata *azblob.Metadata) {
+	if jptm.ChecksumAlgorithm() != common.EHashAlgorithm.SHA256() {
+		headers.ContentMD5 = hash
+		return
+	}
+	if len(hash) == 0 {
+		return // none was computed, e.g. because put-md5 is off
+	}
+	if *metadata == nil {
+		*metadata = azblob.Metadata{}
+	}
+	(*metadata)[common.SHA256MetadataKey] = hex.EncodeToString(hash)
+}
+
 /////////////////////////////////////////////////////////////////////////////////////////////////
 
 func getNumChunks(fileSize int64, chunkSize int64) uint32 {
@@ -182,6 +220,10 @@ func createChunkFunc(setDoneStatusOnExit bool, jptm IJobPartTransferMgr, id comm
 
 // newBlobUploader detects blob type and creates a uploader manually
 func newBlobUploader(jptm IJobPartTransferMgr, destination string, p pipeline.Pipeline, pacer pacer, sip ISourceInfoProvider) (sender, error) {
+	if jptm.Info().IsFolderPropertiesTransfer() {
+		return newBlobFolderMarkerSender(jptm, destination, p, sip)
+	}
+
 	override := jptm.BlobTypeOverride()
 	intendedType := override.ToAzBlobType()
 
@@ -194,6 +236,9 @@ func newBlobUploader(jptm IJobPartTransferMgr, destination string, p pipeline.Pi
 
 	switch intendedType {
 	case azblob.BlobBlockBlob:
+		if jptm.ShouldGzipUpload() {
+			return newBlockBlobGzipUploader(jptm, destination, p, pacer, sip)
+		}
 		return newBlockBlobUploader(jptm, destination, p, pacer, sip)
 	case azblob.BlobPageBlob:
 		return newPageBlobUploader(jptm, destination, p, pacer, sip)
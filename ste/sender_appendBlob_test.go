@@ -0,0 +1,138 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type appendBlobSuite struct{}
+
+var _ = chk.Suite(&appendBlobSuite{})
+
+func (s *appendBlobSuite) TestFitAppendBlobChunks(c *chk.C) {
+	const mb = 1024 * 1024
+
+	// fits with the requested chunk size
+	chunkSize, numChunks, err := fitAppendBlobChunks(10*mb, mb, maxAppendBlobBlocks)
+	c.Assert(err, chk.IsNil)
+	c.Assert(chunkSize, chk.Equals, int64(mb))
+	c.Assert(numChunks, chk.Equals, uint32(10))
+
+	// only fits if the chunks are made bigger
+	chunkSize, numChunks, err = fitAppendBlobChunks(10*mb, mb, 5)
+	c.Assert(err, chk.IsNil)
+	c.Assert(chunkSize, chk.Equals, int64(common.MaxAppendBlobBlockSize))
+	c.Assert(numChunks, chk.Equals, uint32(3))
+
+	// doesn't fit at all
+	_, _, err = fitAppendBlobChunks(10*mb, mb, 2)
+	c.Assert(err, chk.NotNil)
+
+	// an empty source needs no room, even though it is sent as one (dummy) chunk
+	_, numChunks, err = fitAppendBlobChunks(0, mb, 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(numChunks, chk.Equals, uint32(1))
+}
+
+// propertiesOnlySourceInfoProvider is a source with no properties to apply to the destination, which is all that creating a sender needs
+type propertiesOnlySourceInfoProvider struct {
+	ISourceInfoProvider
+}
+
+func (propertiesOnlySourceInfoProvider) Properties() (*SrcProperties, error) {
+	return &SrcProperties{}, nil
+}
+
+func (s *appendBlobSuite) TestRetriedAppendCarriesOnFromEarlierAttempt(c *chk.C) {
+	const chunkSize = 1024
+	const sourceSize = 4 * chunkSize
+
+	// the destination append blob, which has length bytes in blocks blocks, or doesn't exist if length is negative
+	length, blocks := int64(8), 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if length < 0 {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("x-ms-blob-type", "AppendBlob")
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		w.Header().Set("x-ms-blob-committed-block-count", strconv.Itoa(blocks))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.ForceWrite = common.EOverwriteOption.Append()
+	jpm := newTestJobPartMgr(newTestPlanMMF(c, jpph))
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, jobPartPlanTransfer: jpm.Plan().Transfer(0),
+		transferInfo: &TransferInfo{JobID: common.NewJobID(), SourceSize: sourceSize, BlockSize: chunkSize}}
+	jptm.ctx, jptm.cancel = context.WithCancel(context.Background())
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	newSender := func() (*appendBlobSenderBase, error) {
+		return newAppendBlobSenderBase(jptm, server.URL+"/container/log.txt", p, newNullAutoPacer(), propertiesOnlySourceInfoProvider{})
+	}
+
+	// the first attempt appends after what the blob already held, and records where that was
+	sender, err := newSender()
+	c.Assert(err, chk.IsNil)
+	c.Assert(sender.appendOffset, chk.Equals, int64(8))
+	c.Assert(sender.alreadyAppended, chk.Equals, int64(0))
+
+	// it fails after appending two chunks, so the retry appends the rest after them, rather than all the source again
+	length, blocks = 8+2*chunkSize, 3
+	sender, err = newSender()
+	c.Assert(err, chk.IsNil)
+	c.Assert(sender.appendOffset, chk.Equals, int64(8))
+	c.Assert(sender.alreadyAppended, chk.Equals, int64(2*chunkSize))
+	c.Assert(sender.appendPosition(2*chunkSize), chk.Equals, length)
+	c.Assert(sender.numChunks, chk.Equals, uint32(4))
+
+	// if something else has appended to the blob since, what it holds no longer lines up with the source
+	length = 8 + 2*chunkSize + 1
+	_, err = newSender()
+	c.Assert(err, chk.ErrorMatches, "cannot carry on appending to the destination, since it holds 2057 bytes, .*")
+	length = 4
+	_, err = newSender()
+	c.Assert(err, chk.NotNil)
+
+	// a blob that the transfer created, and that was deleted when that attempt failed, is created again
+	length = -1
+	sender, err = newSender()
+	c.Assert(err, chk.IsNil)
+	c.Assert(sender.appendToExisting, chk.Equals, false)
+	// but one that wasn't deleted (e.g. because azcopy was stopped) is carried on with
+	length, blocks = chunkSize, 1
+	sender, err = newSender()
+	c.Assert(err, chk.IsNil)
+	c.Assert(sender.appendOffset, chk.Equals, int64(0))
+	c.Assert(sender.alreadyAppended, chk.Equals, int64(chunkSize))
+}
@@ -23,6 +23,8 @@ package ste
 import (
 	"fmt"
 
+	"github.com/Azure/azure-storage-azcopy/common"
+
 	chk "gopkg.in/check.v1"
 )
 
@@ -58,3 +60,77 @@ func (s *blockBlobSuite) TestGetVerifiedChunkParams(c *chk.C) {
 	c.Assert(err.Error(), chk.Equals, expectedErr)
 
 }
+
+func (s *blockBlobSuite) TestComputeBlockSize(c *chk.C) {
+	maxSizeWithDefaultBlocks := int64(common.DefaultBlockBlobBlockSize) * common.MaxNumberOfBlocksPerBlob
+
+	testCases := []struct {
+		blockSize  int64
+		sourceSize int64
+		expected   int64
+	}{
+		// user-provided block sizes are kept, up to the maximum a block blob allows
+		{4 * 1024 * 1024, maxSizeWithDefaultBlocks, 4 * 1024 * 1024},
+		{common.MaxBlockBlobBlockSize + 1, 1, common.MaxBlockBlobBlockSize},
+
+		// automatic block sizes start at the default, and double once the block count limit would be exceeded
+		{0, 0, common.DefaultBlockBlobBlockSize},
+		{0, maxSizeWithDefaultBlocks, common.DefaultBlockBlobBlockSize},
+		{0, maxSizeWithDefaultBlocks + 1, 2 * common.DefaultBlockBlobBlockSize},
+
+		// beyond the threshold, the block size is just big enough to stay within the block count limit
+		{0, common.BlockSizeThreshold*common.MaxNumberOfBlocksPerBlob*2 + 1, common.BlockSizeThreshold*2 + 1},
+	}
+
+	for _, t := range testCases {
+		blockSize := computeBlockSize(t.blockSize, t.sourceSize)
+		c.Assert(blockSize, chk.Equals, t.expected)
+		if t.blockSize == 0 {
+			c.Assert(getNumChunks(t.sourceSize, blockSize) <= common.MaxNumberOfBlocksPerBlob, chk.Equals, true)
+		}
+	}
+}
+
+func (s *blockBlobSuite) TestEstimateTransferRequests(c *chk.C) {
+	const mib = 1024 * 1024
+	maxSizeWithDefaultBlocks := int64(common.DefaultBlockBlobBlockSize) * common.MaxNumberOfBlocksPerBlob
+	blockBlob, pageBlob, appendBlob := common.EBlobType.BlockBlob(), common.EBlobType.PageBlob(), common.EBlobType.AppendBlob()
+
+	testCases := []struct {
+		fromTo     common.FromTo
+		blobType   common.BlobType
+		sourceSize int64
+		blockSize  int64
+		expected   uint64
+	}{
+		// uploads of a single block are a single Put Blob; others put each block, then the block list
+		{common.EFromTo.LocalBlob(), blockBlob, 0, 0, 1},
+		{common.EFromTo.LocalBlob(), blockBlob, 1, 0, 1},
+		{common.EFromTo.LocalBlob(), blockBlob, common.DefaultBlockBlobBlockSize, 0, 1},
+		{common.EFromTo.LocalBlob(), blockBlob, common.DefaultBlockBlobBlockSize + 1, 0, 3},
+		{common.EFromTo.LocalBlob(), common.EBlobType.Detect(), 100 * mib, 0, 14},
+		{common.EFromTo.LocalBlob(), blockBlob, 100 * mib, 4 * mib, 26},
+		{common.EFromTo.LocalBlob(), blockBlob, maxSizeWithDefaultBlocks + 1, 0, 25002}, // the automatic block size doubles
+
+		// service to service copies always put the blocks from the URL, unless there is no data at all
+		{common.EFromTo.BlobBlob(), blockBlob, 0, 0, 1},
+		{common.EFromTo.BlobBlob(), blockBlob, 1, 0, 2},
+		{common.EFromTo.S3Blob(), blockBlob, 100 * mib, 0, 14},
+
+		// downloads read each chunk
+		{common.EFromTo.BlobLocal(), blockBlob, 0, 0, 1},
+		{common.EFromTo.BlobLocal(), blockBlob, 100 * mib, 0, 13},
+		{common.EFromTo.FileLocal(), blockBlob, 100 * mib, 10 * mib, 10},
+
+		// other destinations are created, then written chunk by chunk, with chunks no bigger than they allow
+		{common.EFromTo.LocalBlob(), pageBlob, 100 * mib, 0, 26},
+		{common.EFromTo.LocalBlob(), appendBlob, 100 * mib, 0, 26},
+		{common.EFromTo.LocalFile(), blockBlob, 100 * mib, 0, 26},
+		{common.EFromTo.LocalFile(), blockBlob, 100 * mib, 2 * mib, 51},
+	}
+
+	for _, t := range testCases {
+		c.Assert(EstimateTransferRequests(t.fromTo, t.blobType, t.sourceSize, t.blockSize), chk.Equals, t.expected,
+			chk.Commentf("%v of %v (%d bytes, %d byte blocks)", t.fromTo, t.blobType, t.sourceSize, t.blockSize))
+	}
+}
@@ -56,3 +56,9 @@ func (s *pageBlobFromURLSuite) TestRangeWorthTransferring(c *chk.C) {
 		c.Assert(doesContainData, chk.Equals, expectedResult)
 	}
 }
+
+func (s *pageBlobFromURLSuite) TestValidatePageBlobSize(c *chk.C) {
+	c.Assert(validatePageBlobSize(0), chk.IsNil)
+	c.Assert(validatePageBlobSize(1024*1024+512), chk.IsNil)
+	c.Assert(validatePageBlobSize(1000), chk.NotNil)
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+// Blobs have no SMB properties of their own, so when files are uploaded from Windows to Blob storage with
+// --preserve-smb-permissions or --preserve-smb-info, their properties are kept in the blob's metadata under these keys,
+// from where a download to Windows can restore them. (Azure Files has the properties natively, so doesn't need this.)
+const (
+	smbSDDLMeta          = "smb_sddl"            // the portable SDDL of the owner, group and DACL
+	smbAttributesMeta    = "smb_attributes"      // the file attribute bits, in decimal
+	smbCreationTimeMeta  = "smb_creation_time"   // in RFC3339 format, in UTC
+	smbLastWriteTimeMeta = "smb_last_write_time" // in RFC3339 format, in UTC
+)
+
+// addSMBPropertiesToMetadata returns a copy of the metadata (which may be nil) with the SMB properties
+// of sip's source added, as far as info says they should be preserved
+func addSMBPropertiesToMetadata(sip ISMBPropertyBearingSourceInfoProvider, info TransferInfo, metadata common.Metadata) (common.Metadata, error) {
+	result := make(common.Metadata, len(metadata)+4)
+	for k, v := range metadata {
+		result[k] = v
+	}
+
+	if info.PreserveSMBPermissions.IsTruthy() {
+		sddlString, err := sip.GetSDDL()
+		if err != nil {
+			return nil, fmt.Errorf("getting source SDDL: %w", err)
+		}
+		result[smbSDDLMeta] = sddlString
+	}
+
+	if info.PreserveSMBInfo {
+		props, err := sip.GetSMBProperties()
+		if err != nil {
+			return nil, fmt.Errorf("getting source SMB properties: %w", err)
+		}
+		result[smbAttributesMeta] = strconv.FormatUint(uint64(props.FileAttributes()), 10)
+		result[smbCreationTimeMeta] = props.FileCreationTime().UTC().Format(time.RFC3339Nano)
+		result[smbLastWriteTimeMeta] = props.FileLastWriteTime().UTC().Format(time.RFC3339Nano)
+	}
+
+	return result, nil
+}
+
+// metadataSMBPropertyProvider provides the SMB properties that addSMBPropertiesToMetadata saved in a blob's metadata,
+// so that they can be given to an smbPropertyAwareDownloader in the same way as the properties of an Azure File
+type metadataSMBPropertyProvider struct {
+	ISourceInfoProvider
+	metadata common.Metadata
+}
+
+// GetSDDL returns an empty string if no SDDL was saved
+func (p metadataSMBPropertyProvider) GetSDDL() (string, error) {
+	return p.metadata[smbSDDLMeta], nil
+}
+
+func (p metadataSMBPropertyProvider) GetSMBProperties() (TypedSMBPropertyHolder, error) {
+	attributes, err := strconv.ParseUint(p.metadata[smbAttributesMeta], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s metadata '%s'", smbAttributesMeta, p.metadata[smbAttributesMeta])
+	}
+	props := smbPropertiesFromMetadata{attributes: azfile.FileAttributeFlags(attributes)}
+	if props.creationTime, err = parseSMBTimeMetadata(p.metadata, smbCreationTimeMeta); err != nil {
+		return nil, err
+	}
+	if props.lastWriteTime, err = parseSMBTimeMetadata(p.metadata, smbLastWriteTimeMeta); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (p metadataSMBPropertyProvider) hasSMBProperties() bool {
+	_, ok := p.metadata[smbAttributesMeta]
+	return ok
+}
+
+func parseSMBTimeMetadata(metadata common.Metadata, key string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, metadata[key])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s metadata '%s'", key, metadata[key])
+	}
+	return t, nil
+}
+
+type smbPropertiesFromMetadata struct {
+	attributes    azfile.FileAttributeFlags
+	creationTime  time.Time
+	lastWriteTime time.Time
+}
+
+func (p smbPropertiesFromMetadata) FileCreationTime() time.Time {
+	return p.creationTime
+}
+
+func (p smbPropertiesFromMetadata) FileLastWriteTime() time.Time {
+	return p.lastWriteTime
+}
+
+func (p smbPropertiesFromMetadata) FileAttributes() azfile.FileAttributeFlags {
+	return p.attributes
+}
+
+// restoreSMBPropertiesFromMetadata gives a downloaded file the SMB properties that were saved in the metadata of its
+// source blob, if there are any. As with Azure Files, this only happens on Windows, where dl is an smbPropertyAwareDownloader.
+func restoreSMBPropertiesFromMetadata(jptm IJobPartTransferMgr, dl downloader, info TransferInfo) {
+	spdl, ok := dl.(smbPropertyAwareDownloader)
+	if !ok {
+		return
+	}
+	sip := metadataSMBPropertyProvider{metadata: info.SrcMetadata} // only GetSDDL and GetSMBProperties are needed
+
+	if info.PreserveSMBPermissions.IsTruthy() {
+		err := spdl.PutSDDL(sip, info)
+		if err == errorNoSddlFound {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "No SMB permissions were restored because none were saved with the blob")
+		} else if err != nil {
+			jptm.FailActiveDownload("Setting destination file SDDLs", err)
+			return
+		}
+	}
+
+	if info.PreserveSMBInfo {
+		// must be done AFTER we preserve the permissions (else some of the flags/dates set here may be lost)
+		if !sip.hasSMBProperties() {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogDebug, "No SMB properties were restored because none were saved with the blob")
+			return
+		}
+		if err := spdl.PutSMBProperties(sip, info); err != nil {
+			jptm.FailActiveDownload("Setting destination file SMB properties", err)
+		}
+	}
+}
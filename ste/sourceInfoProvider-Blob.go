@@ -21,11 +21,37 @@
 package ste
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
 	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
 )
 
+// how often to check whether a rehydrating source blob can be read yet. Rehydration takes hours, so there's no point checking often
+var rehydrationPollInterval = 5 * time.Minute
+
+var errArchivedSource = errors.New("the source blob is in the archive tier, and must be rehydrated to the Hot or Cool tier before it can be copied. " +
+	"Rehydrate it first, or use --s2s-rehydrate-archived-source to have AzCopy rehydrate it and wait for it")
+
+// checkArchivedSource returns whether a source blob in the given tier must be rehydrated before it can be read.
+// If it must, but rehydration was not requested, the transfer cannot proceed and an error is returned.
+func checkArchivedSource(srcTier azblob.AccessTierType, rehydrate bool) (mustRehydrate bool, err error) {
+	if srcTier != azblob.AccessTierArchive {
+		return false, nil
+	}
+	if !rehydrate {
+		return false, errArchivedSource
+	}
+	return true, nil
+}
+
 // Source info provider for Azure blob
 type blobSourceInfoProvider struct {
 	defaultRemoteSourceInfoProvider
@@ -40,6 +66,15 @@ func newBlobSourceInfoProvider(jptm IJobPartTransferMgr) (ISourceInfoProvider, e
 	return &blobSourceInfoProvider{defaultRemoteSourceInfoProvider: *base}, nil
 }
 
+func (p *blobSourceInfoProvider) GetAccessControl() (azbfs.BlobFSAccessControl, error) {
+	presignedURL, err := p.PreSignedSourceURL()
+	if err != nil {
+		return azbfs.BlobFSAccessControl{}, err
+	}
+
+	return azbfs.NewFileURL(dfsURL(*presignedURL), p.jptm.SourceProviderPipeline()).GetAccessControl(p.jptm.Context())
+}
+
 func (p *blobSourceInfoProvider) BlobTier() azblob.AccessTierType {
 	return p.transferInfo.S2SSrcBlobTier
 }
@@ -48,6 +83,37 @@ func (p *blobSourceInfoProvider) BlobType() azblob.BlobType {
 	return p.transferInfo.SrcBlobType
 }
 
+// RequestRehydration asks for the (archived) source blob to be rehydrated to the Hot tier, unless it is already being rehydrated,
+// and returns whether it can be read yet. It doesn't wait for the rehydration, which can take many hours.
+func (p *blobSourceInfoProvider) RequestRehydration() (rehydrated bool, err error) {
+	presignedURL, err := p.PreSignedSourceURL()
+	if err != nil {
+		return false, err
+	}
+
+	blobURL := azblob.NewBlobURL(*presignedURL, p.jptm.SourceProviderPipeline())
+	return requestRehydration(p.jptm.Context(), blobURL, p.jptm)
+}
+
+func requestRehydration(ctx context.Context, blobURL azblob.BlobURL, logger common.ILogger) (rehydrated bool, err error) {
+	properties, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		return false, err
+	}
+	if azblob.AccessTierType(properties.AccessTier()) != azblob.AccessTierArchive {
+		return true, nil
+	}
+
+	if properties.ArchiveStatus() == "" {
+		// not yet asked to rehydrate (e.g. by an earlier run of this job)
+		if _, err := blobURL.SetTier(ctx, azblob.AccessTierHot, azblob.LeaseAccessConditions{}); err != nil {
+			return false, fmt.Errorf("could not rehydrate the archived source blob: %w", err)
+		}
+		logger.Log(pipeline.LogInfo, "Source blob is archived. Requested its rehydration to the Hot tier, and waiting for that to finish")
+	}
+	return false, nil
+}
+
 func (p *blobSourceInfoProvider) GetFreshFileLastModifiedTime() (time.Time, error) {
 	presignedURL, err := p.PreSignedSourceURL()
 	if err != nil {
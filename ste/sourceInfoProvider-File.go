@@ -48,10 +48,10 @@ type contentPropsProvider interface {
 
 // Source info provider for Azure blob
 type fileSourceInfoProvider struct {
-	ctx                 context.Context
-	cachedPermissionKey string
-	cacheOnce           *sync.Once
-	cachedProperties    richSMBPropertyHolder // use interface because may be file or directory properties
+	ctx              context.Context
+	cacheOnce        *sync.Once
+	cachedProperties richSMBPropertyHolder // use interface because may be file or directory properties
+	cachedErr        error                 // so that every caller, not just the first, learns that getting the properties failed
 	defaultRemoteSourceInfoProvider
 }
 
@@ -89,13 +89,11 @@ func (p *fileSourceInfoProvider) getFreshProperties() (richSMBPropertyHolder, er
 // cached because we use it for both GetSMBProperties and GetSDDL, and in some cases (e.g. small files,
 // or enough transactions that transaction costs matter) saving IOPS matters
 func (p *fileSourceInfoProvider) getCachedProperties() (richSMBPropertyHolder, error) {
-	var err error
-
 	p.cacheOnce.Do(func() {
-		p.cachedProperties, err = p.getFreshProperties()
+		p.cachedProperties, p.cachedErr = p.getFreshProperties()
 	})
 
-	return p.cachedProperties, err
+	return p.cachedProperties, p.cachedErr
 }
 
 func (p *fileSourceInfoProvider) GetSMBProperties() (TypedSMBPropertyHolder, error) {
@@ -141,9 +139,6 @@ func (p *fileSourceInfoProvider) Properties() (*SrcProperties, error) {
 		if err != nil {
 			return nil, err
 		}
-		// TODO: is it OK that this does not get set if s2sGetPropertiesInBackend is false?  Probably yes, because it's only a cached value, and getPropertiesInBackend is always false of AzFiles anyway at present (early 2020)
-		p.cachedPermissionKey = properties.FilePermissionKey() // We cache this as getting the SDDL is a separate operation.
-
 		switch p.EntityType() {
 		case common.EEntityType.File():
 			fileProps := properties.(contentPropsProvider)
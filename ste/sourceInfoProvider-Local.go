@@ -43,6 +43,26 @@ func (f localFileSourceInfoProvider) Properties() (*SrcProperties, error) {
 
 	headers, metadata, blobTags := f.jptm.ResourceDstData(nil) // we don't have a known MIME type yet, so pass nil for the sniffed content of thefile
 
+	if f.transferInfo.PreservePOSIXProperties {
+		fileInfo, err := common.OSStat(f.transferInfo.Source)
+		if err != nil {
+			return nil, err
+		}
+		if posixProperties, ok := common.GetPOSIXProperties(fileInfo); ok {
+			metadata = posixProperties.AddToMetadata(metadata)
+		}
+	}
+
+	// Blob storage has no SMB properties, so on Windows they are kept in the blob's metadata
+	if f.jptm.FromTo() == common.EFromTo.LocalBlob() && (f.transferInfo.PreserveSMBPermissions.IsTruthy() || f.transferInfo.PreserveSMBInfo) {
+		if sip, ok := interface{}(f).(ISMBPropertyBearingSourceInfoProvider); ok {
+			var err error
+			if metadata, err = addSMBPropertiesToMetadata(sip, f.transferInfo, metadata); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return &SrcProperties{
 		SrcHTTPHeaders: common.ResourceHTTPHeaders{
 			ContentType:        headers.ContentType,
@@ -77,6 +97,14 @@ func (f localFileSourceInfoProvider) GetFreshFileLastModifiedTime() (time.Time,
 	return i.ModTime(), nil
 }
 
+func (f localFileSourceInfoProvider) GetFreshFileSize() (int64, error) {
+	i, err := common.OSStat(f.jptm.Info().Source)
+	if err != nil {
+		return 0, err
+	}
+	return i.Size(), nil
+}
+
 func (f localFileSourceInfoProvider) EntityType() common.EntityType {
 	return f.transferInfo.EntityType
 }
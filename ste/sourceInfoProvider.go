@@ -27,6 +27,7 @@ import (
 
 	"github.com/Azure/azure-storage-file-go/azfile"
 
+	"github.com/Azure/azure-storage-azcopy/azbfs"
 	"github.com/Azure/azure-storage-azcopy/common"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -76,6 +77,10 @@ type IBlobSourceInfoProvider interface {
 
 	// BlobType returns source's blob type.
 	BlobType() azblob.BlobType
+
+	// RequestRehydration starts moving an archived source blob to the Hot tier, if that isn't already under way,
+	// and returns whether it can be read yet.
+	RequestRehydration() (rehydrated bool, err error)
 }
 
 type TypedSMBPropertyHolder interface {
@@ -91,6 +96,22 @@ type ISMBPropertyBearingSourceInfoProvider interface {
 	GetSMBProperties() (TypedSMBPropertyHolder, error)
 }
 
+// IAccessControlBearingSourceInfoProvider is implemented by sources that may be in an account with a hierarchical namespace,
+// where files and directories have POSIX owners and access control lists
+type IAccessControlBearingSourceInfoProvider interface {
+	ISourceInfoProvider
+
+	GetAccessControl() (azbfs.BlobFSAccessControl, error)
+}
+
+// IFreshSizeBearingSourceInfoProvider is implemented by sources that can cheaply tell how big the file is now, so that a change
+// to its size during the transfer is seen even if its last modified time was not updated
+type IFreshSizeBearingSourceInfoProvider interface {
+	ISourceInfoProvider
+
+	GetFreshFileSize() (int64, error)
+}
+
 type ICustomLocalOpener interface {
 	ISourceInfoProvider
 	Open(path string) (*os.File, error)
@@ -0,0 +1,88 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"math"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const (
+	// each bucket of the histogram is 2^(1/8) (about 9%) wider than the one before, so estimates from its middle are within about 4.5%
+	throughputBucketsPerDoubling = 8
+	// the buckets cover throughputs from 1 byte/s up to 2^40 bytes/s, which is far beyond what any one transfer can do
+	throughputHistogramBuckets = 40 * throughputBucketsPerDoubling
+)
+
+// throughputHistogram counts transfers by their throughput, so that the spread of the throughputs can be estimated in constant
+// memory, however many transfers the job has
+type throughputHistogram struct {
+	counts [throughputHistogramBuckets]uint32
+	total  uint32
+}
+
+// add counts a transfer that moved the given bytes in the given time. Transfers of no bytes, or that took no time, have no
+// meaningful throughput, so they are left out
+func (h *throughputHistogram) add(bytes int64, d time.Duration) {
+	if bytes <= 0 || d <= 0 {
+		return
+	}
+	bucket := int(math.Floor(math.Log2(float64(bytes)/d.Seconds()) * throughputBucketsPerDoubling))
+	if bucket < 0 {
+		bucket = 0
+	} else if bucket >= throughputHistogramBuckets {
+		bucket = throughputHistogramBuckets - 1
+	}
+	h.counts[bucket]++
+	h.total++
+}
+
+// percentile estimates the throughput, in bytes per second, that p percent of the transfers were no faster than.
+// It is zero if no transfers have been counted.
+func (h *throughputHistogram) percentile(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint32(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := uint32(0)
+	for bucket, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return math.Exp2((float64(bucket) + 0.5) / throughputBucketsPerDoubling)
+		}
+	}
+	return math.Exp2(float64(throughputHistogramBuckets) / throughputBucketsPerDoubling)
+}
+
+func (h *throughputHistogram) percentiles() common.TransferThroughputPercentiles {
+	const bytesPerMB = 1000 * 1000
+	return common.TransferThroughputPercentiles{
+		TimedTransfers: h.total,
+		P50MBps:        h.percentile(50) / bytesPerMB,
+		P90MBps:        h.percentile(90) / bytesPerMB,
+		P99MBps:        h.percentile(99) / bytesPerMB,
+	}
+}
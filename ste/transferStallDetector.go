@@ -0,0 +1,189 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+const defaultTransferStallTimeout = 5 * time.Minute
+
+var (
+	transferStallTimeout     time.Duration
+	transferStallTimeoutOnce sync.Once
+)
+
+// getTransferStallTimeout returns how long a transfer may go without moving any data before it is considered stalled.
+// Zero means stall detection is disabled.
+func getTransferStallTimeout() time.Duration {
+	transferStallTimeoutOnce.Do(func() {
+		transferStallTimeout = defaultTransferStallTimeout
+
+		envVar := common.EEnvironmentVariable.TransferStallTimeout()
+		overrideString := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
+		if overrideString != "" {
+			seconds, err := strconv.ParseUint(overrideString, 10, 32)
+			if err != nil {
+				common.GetLifecycleMgr().Error(fmt.Sprintf("Cannot parse environment variable %s, due to error %s", envVar.Name, err))
+			} else {
+				transferStallTimeout = time.Duration(seconds) * time.Second
+			}
+		}
+	})
+	return transferStallTimeout
+}
+
+var transferProgressContextKey = contextKey{"transferProgress"}
+
+// transferProgress tracks when a transfer last moved any data, and which of its requests are in flight.
+// A transfer is stalled when it has requests in flight but no bytes have been read or written since the stall timeout began.
+// Because the clock restarts on every byte, a large chunk that is slowly but steadily moving is never considered stalled;
+// only a transfer whose data has stopped flowing altogether is.
+type transferProgress struct {
+	atomicLastProgressNanos int64
+	atomicBytesMoved        int64
+
+	mu         sync.Mutex
+	nextTryID  uint64
+	tryCancels map[uint64]context.CancelFunc
+}
+
+func newTransferProgress() *transferProgress {
+	tp := &transferProgress{tryCancels: make(map[uint64]context.CancelFunc)}
+	tp.restartClock()
+	return tp
+}
+
+// withTransferProgress returns a context that carries tp, so that the requests and bodies made in that context report to it
+func withTransferProgress(ctx context.Context, tp *transferProgress) context.Context {
+	return context.WithValue(ctx, transferProgressContextKey, tp)
+}
+
+// transferProgressFromContext returns the transferProgress carried by ctx, or nil if there is none
+func transferProgressFromContext(ctx context.Context) *transferProgress {
+	tp, _ := ctx.Value(transferProgressContextKey).(*transferProgress)
+	return tp
+}
+
+// recordBytes notes that the transfer has just moved n bytes. It is safe to call on a nil transferProgress.
+func (tp *transferProgress) recordBytes(n int) {
+	if tp == nil || n <= 0 {
+		return
+	}
+	atomic.AddInt64(&tp.atomicBytesMoved, int64(n))
+	tp.restartClock()
+}
+
+func (tp *transferProgress) bytesMoved() int64 {
+	return atomic.LoadInt64(&tp.atomicBytesMoved)
+}
+
+func (tp *transferProgress) restartClock() {
+	atomic.StoreInt64(&tp.atomicLastProgressNanos, time.Now().UnixNano())
+}
+
+// trackTry records that a request try is in flight, and returns the function that must be used instead of cancel
+// to end the try. Starting a try counts as progress, so that time spent queued before it does not count towards a stall.
+func (tp *transferProgress) trackTry(cancel context.CancelFunc) context.CancelFunc {
+	if tp == nil {
+		return cancel
+	}
+	tp.mu.Lock()
+	id := tp.nextTryID
+	tp.nextTryID++
+	tp.tryCancels[id] = cancel
+	tp.mu.Unlock()
+	tp.restartClock()
+
+	return func() {
+		tp.mu.Lock()
+		delete(tp.tryCancels, id)
+		tp.mu.Unlock()
+		cancel()
+	}
+}
+
+// stalledFor returns how long the transfer has gone without progress while it had requests in flight, or zero if it has none in flight
+func (tp *transferProgress) stalledFor(now time.Time) time.Duration {
+	tp.mu.Lock()
+	inFlight := len(tp.tryCancels)
+	tp.mu.Unlock()
+	if inFlight == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&tp.atomicLastProgressNanos)))
+}
+
+// cancelTries cancels every try in flight, so that the retry policy retries them, and returns how many there were.
+// The stall clock restarts, to give the retries a chance to make progress.
+func (tp *transferProgress) cancelTries() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, cancel := range tp.tryCancels {
+		cancel()
+	}
+	tp.restartClock()
+	return len(tp.tryCancels)
+}
+
+// watchForStall runs until the transfer is done, marking it Stalled and retrying its requests in flight whenever it stops moving data,
+// and marking it Started again once data moves again.
+func (jptm *jobPartTransferMgr) watchForStall(tp *transferProgress, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	stalled := false
+	var bytesWhenStalled int64
+	for {
+		select {
+		case <-jptm.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if stalled && tp.bytesMoved() > bytesWhenStalled {
+				if jptm.jobPartPlanTransfer.swapTransferStatus(common.ETransferStatus.Stalled(), common.ETransferStatus.Started()) {
+					jptm.Log(pipeline.LogInfo, "is moving data again, after having stalled")
+				}
+				stalled = false
+			}
+
+			stalledFor := tp.stalledFor(now)
+			if stalledFor < timeout {
+				continue
+			}
+			// only an in-progress transfer becomes stalled; one that has just finished or failed keeps its status
+			if stalled || jptm.jobPartPlanTransfer.swapTransferStatus(common.ETransferStatus.Started(), common.ETransferStatus.Stalled()) {
+				stalled = true
+				bytesWhenStalled = tp.bytesMoved()
+				n := tp.cancelTries()
+				jptm.Log(pipeline.LogWarning, fmt.Sprintf("has moved no data for %v; retrying its %d request(s) in flight", stalledFor.Round(time.Second), n))
+			}
+		}
+	}
+}
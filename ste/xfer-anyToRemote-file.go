@@ -21,8 +21,8 @@
 package ste
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"github.com/Azure/azure-storage-blob-go/azblob"
@@ -32,8 +32,10 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/azbfs"
 	"github.com/Azure/azure-storage-azcopy/common"
 )
 
@@ -213,6 +215,30 @@ func anyToRemote_file(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pi
 		panic("configuration error. Source Info Provider does not have File entity type")
 	}
 
+	// an archived source blob cannot be read until it has been rehydrated
+	if blobSrcInfoProvider, ok := srcInfoProvider.(IBlobSourceInfoProvider); ok {
+		mustRehydrate, err := checkArchivedSource(blobSrcInfoProvider.BlobTier(), info.S2SRehydrateArchivedSource)
+		rehydrated := !mustRehydrate
+		if err == nil && mustRehydrate {
+			rehydrated, err = blobSrcInfoProvider.RequestRehydration()
+		}
+		if err == nil && !rehydrated {
+			// rehydration takes hours, so rather than hold on to this worker, look again later
+			jptm.RescheduleTransferAfter(rehydrationPollInterval)
+			return
+		}
+		if err != nil {
+			if jptm.WasCanceled() {
+				jptm.SetStatus(common.ETransferStatus.Cancelled())
+			} else {
+				jptm.LogSendError(info.Source, info.Destination, err.Error(), 0)
+				jptm.SetStatus(common.ETransferStatus.Failed())
+			}
+			jptm.ReportTransferDone()
+			return
+		}
+	}
+
 	s, err := senderFactory(jptm, info.Destination, p, pacer, srcInfoProvider)
 	if err != nil {
 		jptm.LogSendError(info.Source, info.Destination, err.Error(), 0)
@@ -234,7 +260,8 @@ func anyToRemote_file(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pi
 	// if the force Write flags is set to false or prompt
 	// then check the file exists at the remote location
 	// if it does, react accordingly
-	if jptm.GetOverwriteOption() != common.EOverwriteOption.True() {
+	// (with Append, an existing destination is appended to, rather than being skipped or replaced, and the sender handles that)
+	if shouldCheckDestinationExists(jptm.GetOverwriteOption(), numChunks) {
 		exists, dstLmt, existenceErr := s.RemoteFileExists()
 		if existenceErr != nil {
 			jptm.LogSendError(info.Source, info.Destination, "Could not check destination file existence. "+existenceErr.Error(), 0)
@@ -252,8 +279,8 @@ func anyToRemote_file(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pi
 				parsed.RawQuery = ""
 				shouldOverwrite = jptm.GetOverwritePrompter().ShouldOverwrite(parsed.String(), common.EEntityType.File())
 			} else if jptm.GetOverwriteOption() == common.EOverwriteOption.IfSourceNewer() {
-				// only overwrite if source lmt is newer (after) the destination
-				if jptm.LastModifiedTime().After(dstLmt) {
+				// only overwrite if source lmt is newer (after) the destination, by more than the tolerance
+				if jptm.IsSourceNewer(dstLmt) {
 					shouldOverwrite = true
 				}
 			}
@@ -268,6 +295,20 @@ func anyToRemote_file(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pi
 		}
 	}
 
+	// step 3b: skip the file if the destination already holds the same data (e.g. because a sync saw a new LMT on a file whose content is unchanged)
+	if fromTo := jptm.FromTo(); info.SkipIfHashMatches && fromTo.To() == common.ELocation.Blob() {
+		matches, err := destinationHashMatchesSource(jptm, info, p, srcInfoProvider)
+		if err != nil {
+			// we just can't tell, so send the file as usual
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, "Could not compare the hashes of source and destination, so the file will be sent. "+err.Error())
+		} else if matches {
+			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, fmt.Sprintf("Destination already has the same %v hash as the source, so will be skipped", jptm.ChecksumAlgorithm()))
+			jptm.SetStatus(common.ETransferStatus.SkippedEntityAlreadyExists())
+			jptm.ReportTransferDone()
+			return
+		}
+	}
+
 	// step 4: Open the local Source File (if any)
 	common.GetLifecycleMgr().E2EAwaitAllowOpenFiles()
 	jptm.LogChunkStatus(pseudoId, common.EWaitReason.OpenLocalSource())
@@ -336,12 +377,24 @@ func anyToRemote_file(jptm IJobPartTransferMgr, info TransferInfo, p pipeline.Pi
 	// ******
 
 	// step 5b: tell jptm what to expect, and how to clean up at the end
+	// (a streaming uploader sends the whole file in a single chunk func, since it only finds out how many blocks it takes as it goes)
+	su, isStreaming := s.(streamingUploader)
+	if isStreaming {
+		numChunks = 1
+	}
 	jptm.SetNumberOfChunks(numChunks)
-	jptm.SetActionAfterLastChunk(func() { epilogueWithCleanupSendToRemote(jptm, s, srcInfoProvider) })
+	jptm.SetActionAfterLastChunk(func() { epilogueWithCleanupSendToRemote(jptm, s, srcInfoProvider, p) })
 
 	// stop tracking pseudo id (since real chunk id's will be tracked from here on)
 	jptm.LogChunkStatus(pseudoId, common.EWaitReason.ChunkDone())
 
+	if isStreaming {
+		id := common.NewChunkID(info.Source, 0, srcSize)
+		jptm.LogChunkStatus(id, common.EWaitReason.WorkerGR())
+		jptm.ScheduleChunks(su.GenerateStreamingUploadFunc(id, sourceFileFactory))
+		return
+	}
+
 	// Step 6: Go through the file and schedule chunk messages to send each chunk
 	scheduleSendChunks(jptm, info.Source, srcFile, srcSize, s, sourceFileFactory, srcInfoProvider)
 }
@@ -369,7 +422,7 @@ func scheduleSendChunks(jptm IJobPartTransferMgr, srcPath string, srcFile common
 
 	var md5Hasher hash.Hash
 	if jptm.ShouldPutMd5() {
-		md5Hasher = md5.New()
+		md5Hasher = jptm.ChecksumAlgorithm().NewHasher() // despite the name, this may be a SHA-256 hash
 	} else {
 		md5Hasher = common.NewNullHasher()
 	}
@@ -457,7 +510,33 @@ func scheduleSendChunks(jptm IJobPartTransferMgr, srcPath string, srcFile common
 	}
 
 	if srcInfoProvider.IsLocal() && safeToUseHash {
-		md5Channel <- md5Hasher.Sum(nil)
+		md5Sum := md5Hasher.Sum(nil)
+		if jptm.ShouldPutMd5() {
+			verifyRecordedDigest(jptm, numChunks, md5Sum)
+			jptm.SetContentDigest(md5Sum, jptm.LastModifiedTime(), srcSize)
+		}
+		md5Channel <- md5Sum
+	}
+}
+
+// errSourceChangedSinceEarlierRun is why a resumed transfer fails if its source no longer has the hash that an earlier run recorded
+var errSourceChangedSinceEarlierRun = errors.New("source changed since an earlier run of the job sent part of it")
+
+// verifyRecordedDigest checks the hash of a source that is being sent against the one that an earlier run of the job recorded in the plan,
+// if that run staged some of the source's chunks, since this run doesn't send those again. If the hashes differ, the source changed
+// between the runs, so the chunks staged then don't belong with the ones sent now. They are discarded, and the transfer fails,
+// to be sent again in full when it is retried.
+func verifyRecordedDigest(jptm IJobPartTransferMgr, numChunks uint32, digest []byte) {
+	recorded := jptm.ContentDigest()
+	if recorded == nil || bytes.Equal(recorded, digest) {
+		return
+	}
+	for chunk := int32(0); chunk < int32(numChunks); chunk++ {
+		if jptm.IsChunkStaged(chunk) {
+			jptm.ResetChunkTracking()
+			jptm.FailActiveSend("verifyRecordedDigest", errSourceChangedSinceEarlierRun)
+			return
+		}
 	}
 }
 
@@ -479,33 +558,120 @@ func createPopulatedChunkReader(jptm IJobPartTransferMgr, sourceFileFactory comm
 	return chunkReader
 }
 
+// dfsURL returns the URL of the same file or directory on the Data Lake Storage endpoint of its account,
+// which is where the POSIX access controls of an account with a hierarchical namespace are read and written
+func dfsURL(u url.URL) url.URL {
+	u.Host = strings.Replace(u.Host, ".blob.", ".dfs.", 1)
+	return u
+}
+
+// errNoAccessControlToPreserve is why a transfer fails if it is to preserve the access control list of a source that has none.
+// cmd only allows --preserve-acls for sources that do, so that would be a plan made some other way.
+var errNoAccessControlToPreserve = errors.New("the source has no access control list to preserve")
+
+// preserveAccessControl gives the destination the owner, group and access control list of the source.
+// An ACL has at most 32 access entries and 32 default entries, so one setAccessControl call always holds all of it.
+func preserveAccessControl(jptm IJobPartTransferMgr, sip ISourceInfoProvider, p pipeline.Pipeline) {
+	aclSip, ok := sip.(IAccessControlBearingSourceInfoProvider)
+	if !ok {
+		jptm.FailActiveSend("Getting the source access control list", errNoAccessControlToPreserve)
+		return
+	}
+	ac, err := aclSip.GetAccessControl()
+	if err != nil {
+		jptm.FailActiveSend("Getting the source access control list", err)
+		return
+	}
+	dst, err := url.Parse(jptm.Info().Destination)
+	if err != nil {
+		jptm.FailActiveSend("Parsing the destination URL", err)
+		return
+	}
+	if _, err = azbfs.NewFileURL(dfsURL(*dst), p).SetAccessControl(jptm.Context(), ac); err != nil {
+		jptm.FailActiveSend("Setting the destination access control list", err)
+	}
+}
+
+// shouldCheckDestinationExists says whether the destination must be looked up before the transfer starts, to apply the overwrite option.
+// With IfNotExists, a file that is sent in one chunk is written on the condition that the destination doesn't exist yet, so the
+// service refuses existing destinations without a separate request. Files of more chunks are still looked up first, since otherwise
+// all of their chunks would be sent before the condition was tested when the blob is committed.
+func shouldCheckDestinationExists(overwrite common.OverwriteOption, numChunks uint32) bool {
+	switch overwrite {
+	case common.EOverwriteOption.True(), common.EOverwriteOption.Append():
+		return false
+	case common.EOverwriteOption.IfNotExists():
+		return numChunks > 1
+	default:
+		return true
+	}
+}
+
 func isDummyChunkInEmptyFile(startIndex int64, fileSize int64) bool {
 	return startIndex == 0 && fileSize == 0
 }
 
+// errSourceChangedDuringTransfer is why a transfer fails if its source changed while it was being sent
+var errSourceChangedDuringTransfer = errors.New("source changed during transfer")
+
+// checkSourceUnchanged fails the transfer if its source is not as it was when it was enumerated: if its last modified time, or
+// (where the source can tell) its size, is different. What was sent may then be a mix of the old and new contents.
+func checkSourceUnchanged(jptm IJobPartTransferMgr, sip ISourceInfoProvider) {
+	const where = "epilogueWithCleanupSendToRemote"
+	lmt, size, err := freshSourceState(jptm, sip)
+	if err != nil {
+		jptm.FailActiveSend(where, err)
+		return
+	}
+	if !lmt.Equal(jptm.LastModifiedTime()) || size != jptm.Info().SourceSize {
+		jptm.FailSourceChanged(where, lmt, size)
+	}
+}
+
+// freshSourceState returns the last modified time that the source has now, and its size. That is the size it had when it was
+// enumerated, unless the source can cheaply tell how big it is now (see IFreshSizeBearingSourceInfoProvider).
+func freshSourceState(jptm IJobPartTransferMgr, sip ISourceInfoProvider) (lastModifiedTime time.Time, size int64, err error) {
+	lastModifiedTime, err = sip.GetFreshFileLastModifiedTime()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	size = jptm.Info().SourceSize
+	if sizeBearer, ok := sip.(IFreshSizeBearingSourceInfoProvider); ok {
+		if size, err = sizeBearer.GetFreshFileSize(); err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+	return lastModifiedTime, size, nil
+}
+
+// expectedDestinationLength is how long the destination should be once the sender has finished.
+// That's the length of the source, unless the sender transformed the data on the way (e.g. by compressing it).
+func expectedDestinationLength(s sender, info TransferInfo) int64 {
+	if su, ok := s.(streamingUploader); ok {
+		return su.SentLength()
+	}
+	return info.SourceSize
+}
+
 // Complete epilogue. Handles both success and failure.
-func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s sender, sip ISourceInfoProvider) {
+func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s sender, sip ISourceInfoProvider, p pipeline.Pipeline) {
 	info := jptm.Info()
 	// allow our usual state tracking mechanism to keep count of how many epilogues are running at any given instant, for perf diagnostics
 	pseudoId := common.NewPseudoChunkIDForWholeFile(info.Source)
 	jptm.LogChunkStatus(pseudoId, common.EWaitReason.Epilogue())
 	defer jptm.LogChunkStatus(pseudoId, common.EWaitReason.ChunkDone()) // normal setting to done doesn't apply to these pseudo ids
 
-	if jptm.WasCanceled() {
+	if jptm.WasCanceled() && !jptm.TransferStatusIgnoringCancellation().WasSkipped() {
 		// This is where we detect that transfer has been cancelled. Further statments do not act on
 		// dead jptm. We set the status here.
+		// (A transfer that the service refused, because its destination already existed, was stopped in the same way,
+		// but it was skipped, not cancelled.)
 		jptm.SetStatus(common.ETransferStatus.Cancelled())
 	}
 	if jptm.IsLive() {
 		if _, isS2SCopier := s.(s2sCopier); sip.IsLocal() || (isS2SCopier && info.S2SSourceChangeValidation) {
 			// Check the source to see if it was changed during transfer. If it was, mark the transfer as failed.
-			lmt, err := sip.GetFreshFileLastModifiedTime()
-			if err != nil {
-				jptm.FailActiveSend("epilogueWithCleanupSendToRemote", err)
-			}
-			if !lmt.Equal(jptm.LastModifiedTime()) {
-				jptm.FailActiveSend("epilogueWithCleanupSendToRemote", errors.New("source modified during transfer"))
-			}
+			checkSourceUnchanged(jptm, sip)
 		}
 	}
 
@@ -513,6 +679,11 @@ func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s sender, sip ISo
 	//  or should we redefine epilogue to be success-path only, and only call it in that case?
 	s.Epilogue() // Perform service-specific cleanup before jptm cleanup. Some services may actually require setup to make the file actually appear.
 
+	// the destination must exist before its access control list can be set
+	if jptm.IsLive() && info.PreserveACLs {
+		preserveAccessControl(jptm, sip, p)
+	}
+
 	if jptm.IsLive() && info.DestLengthValidation {
 		_, isS2SCopier := s.(s2sCopier)
 		shouldCheckLength := true
@@ -536,12 +707,17 @@ func epilogueWithCleanupSendToRemote(jptm IJobPartTransferMgr, s sender, sip ISo
 			if err != nil {
 				wrapped := fmt.Errorf("Could not read destination length. %w", err)
 				jptm.FailActiveSend(common.IffString(isS2SCopier, "S2S ", "Upload ")+"Length check: Get destination length", wrapped)
-			} else if destLength != jptm.Info().SourceSize {
+			} else if destLength != expectedDestinationLength(s, info) {
 				jptm.FailActiveSend(common.IffString(isS2SCopier, "S2S ", "Upload ")+"Length check", errors.New("destination length does not match source length"))
 			}
 		}
 	}
 
+	// once the destination is complete, it may be made immutable
+	if jptm.IsLive() && (info.PreserveImmutability || !info.ImmutabilityPolicyExpiresOn.IsZero()) {
+		applyImmutability(jptm, p)
+	}
+
 	if jptm.HoldsDestinationLock() { // TODO consider add test of jptm.IsDeadInflight here, so we can remove that from inside all the cleanup methods
 		s.Cleanup() // Perform jptm cleanup, if THIS jptm has the lock on the destination
 	}
@@ -573,12 +749,13 @@ func commonSenderCompletion(jptm IJobPartTransferMgr, s sender, info TransferInf
 
 		// Final logging
 		if jptm.ShouldLog(pipeline.LogInfo) { // TODO: question: can we remove these ShouldLogs?  Aren't they inside Log?
-			if _, ok := s.(s2sCopier); ok {
+			switch s.(type) {
+			case s2sCopier:
 				jptm.Log(pipeline.LogInfo, fmt.Sprintf("COPYSUCCESSFUL: %s%s", info.entityTypeLogIndicator(), strings.Split(info.Destination, "?")[0]))
-			} else if _, ok := s.(uploader); ok {
+			case uploader, streamingUploader:
 				// Output relative path of file, includes file name.
 				jptm.Log(pipeline.LogInfo, fmt.Sprintf("UPLOADSUCCESSFUL: %s%s", info.entityTypeLogIndicator(), strings.Split(info.Destination, "?")[0]))
-			} else {
+			default:
 				panic("invalid state: epilogueWithCleanupSendToRemote should be used by COPY and UPLOAD")
 			}
 		}
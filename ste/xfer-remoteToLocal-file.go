@@ -21,11 +21,11 @@
 package ste
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-azcopy/common"
@@ -54,6 +54,11 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 	// step 2: get the source, destination info for the transfer.
 	fileSize := int64(info.SourceSize)
 	downloadChunkSize := info.BlockSize
+	numChunks := getNumChunks(fileSize, downloadChunkSize)
+	resumeOffset := int64(0)
+	if fileSize > 0 {
+		resumeOffset = savedDownloadPrefix(jptm, info, fileSize, downloadChunkSize, numChunks)
+	}
 
 	// step 3: Perform initial checks
 	// If the transfer was cancelled, then report transfer as done
@@ -67,7 +72,8 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 	// if the force Write flags is set to false or prompt
 	// then check the file exists at the remote location
 	// if it does, react accordingly
-	if jptm.GetOverwriteOption() != common.EOverwriteOption.True() {
+	// (unless it's the partly downloaded file that an earlier run of this transfer left to be resumed)
+	if jptm.GetOverwriteOption() != common.EOverwriteOption.True() && resumeOffset == 0 {
 		dstProps, err := common.OSStat(info.Destination)
 		if err == nil {
 			// if the error is nil, then file exists locally
@@ -77,8 +83,8 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 			if jptm.GetOverwriteOption() == common.EOverwriteOption.Prompt() {
 				shouldOverwrite = jptm.GetOverwritePrompter().ShouldOverwrite(info.Destination, common.EEntityType.File())
 			} else if jptm.GetOverwriteOption() == common.EOverwriteOption.IfSourceNewer() {
-				// only overwrite if source lmt is newer (after) the destination
-				if jptm.LastModifiedTime().After(dstProps.ModTime()) {
+				// only overwrite if source lmt is newer (after) the destination, by more than the tolerance
+				if jptm.IsSourceNewer(dstProps.ModTime()) {
 					shouldOverwrite = true
 				}
 			}
@@ -96,8 +102,8 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 	if jptm.MD5ValidationOption() == common.EHashValidationOption.FailIfDifferentOrMissing() {
 		// We can make a check early on MD5 existence and fail the transfer if it's not present.
 		// This will save hours in the event a user has say, a several hundred gigabyte file.
-		if len(info.SrcHTTPHeaders.ContentMD5) == 0 {
-			jptm.LogDownloadError(info.Source, info.Destination, errExpectedMd5Missing.Error(), 0)
+		if len(expectedHash(info, jptm.ChecksumAlgorithm())) == 0 {
+			jptm.LogDownloadError(info.Source, info.Destination, expectedHashMissingError(jptm.ChecksumAlgorithm()).Error(), 0)
 			jptm.SetStatus(common.ETransferStatus.Failed())
 			jptm.ReportTransferDone()
 			return
@@ -159,6 +165,14 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 	if strings.EqualFold(info.Destination, common.Dev_Null) {
 		// the user wants to discard the downloaded data
 		dstFile = devNullWriter{}
+	} else if resumeOffset > 0 {
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, fmt.Sprintf("resuming download after the first %d bytes, which were saved by an earlier run", resumeOffset))
+		dstFile, err = openPartialDestinationFile(info.Destination, resumeOffset)
+		if err != nil {
+			failFileCreation(err)
+			return
+		}
+		jptm.ReportResumedBytes(resumeOffset)
 	} else {
 		// Normal scenario, create the destination file as expected
 		// Use pseudo chunk id to allow our usual state tracking mechanism to keep count of how many
@@ -190,17 +204,21 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 			return
 		}*/
 
-	// step 5a: compute num chunks
-	numChunks := uint32(0)
-	if rem := fileSize % downloadChunkSize; rem == 0 {
-		numChunks = uint32(fileSize / downloadChunkSize)
-	} else {
-		numChunks = uint32(fileSize/downloadChunkSize + 1)
-	}
+	// step 5a: compute num chunks, leaving out those that an earlier run saved
+	numChunks -= uint32(resumeOffset / downloadChunkSize)
 
-	// step 5b: create destination writer
+	// step 5b: create destination writer, which records each chunk in the plan file as it saves it, so that the download can
+	// be resumed if the job is paused (except when the data is discarded, or decompressed, since then there's nothing to resume)
 	chunkLogger := jptm.ChunkStatusLogger()
-	sourceMd5Exists := len(info.SrcHTTPHeaders.ContentMD5) > 0
+	sourceMd5Exists := len(expectedHash(info, jptm.ChecksumAlgorithm())) > 0
+	prefix := common.ResumedFilePrefix{
+		Length: resumeOffset,
+		Open:   func() (io.ReadCloser, error) { return common.OSOpenFile(info.Destination, os.O_RDONLY, 0) },
+	}
+	var chunkSaved func(common.ChunkID)
+	if isResumableDownload(jptm, info) {
+		chunkSaved = func(id common.ChunkID) { jptm.SetChunkStaged(int32(id.OffsetInFile() / downloadChunkSize)) }
+	}
 	dstWriter := common.NewChunkedFileWriter(
 		jptm.Context(),
 		jptm.SlicePool(),
@@ -210,7 +228,10 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 		numChunks,
 		MaxRetryPerDownloadBody,
 		jptm.MD5ValidationOption(),
-		sourceMd5Exists)
+		sourceMd5Exists,
+		jptm.ChecksumAlgorithm(),
+		prefix,
+		chunkSaved)
 
 	// step 5c: run prologue in downloader (here it can, for example, create things that will require cleanup in the epilogue)
 	common.GetLifecycleMgr().E2EAwaitAllowOpenFiles()
@@ -230,7 +251,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, p pipeline.Pipeline, pacer pac
 	// eventually reach numChunks, since we have no better short-term alternative.
 
 	chunkCount := uint32(0)
-	for startIndex := int64(0); startIndex < fileSize; startIndex += downloadChunkSize {
+	for startIndex := resumeOffset; startIndex < fileSize; startIndex += downloadChunkSize {
 		adjustedChunkSize := downloadChunkSize
 
 		// compute exact size of the chunk
@@ -293,6 +314,48 @@ func createDestinationFile(jptm IJobPartTransferMgr, destination string, size in
 	return dstFile, nil
 }
 
+// isResumableDownload returns whether the chunks of the download are tracked, so that a paused download can later carry on from
+// the data it saved
+func isResumableDownload(jptm IJobPartTransferMgr, info TransferInfo) bool {
+	return !strings.EqualFold(info.Destination, common.Dev_Null) && !jptm.ShouldDecompress()
+}
+
+// savedDownloadPrefix returns how much of the destination an earlier run of the transfer saved, before its job was paused.
+// Since the chunks of a file are saved in order, that is the run of chunks, from the start of the file, that the plan records as
+// saved. It is zero if the destination is no longer the partly written file (which was created at its full size),
+// or if the download can't be resumed. The last chunk is always downloaded again, so that there is a chunk to complete the transfer.
+func savedDownloadPrefix(jptm IJobPartTransferMgr, info TransferInfo, fileSize int64, chunkSize int64, numChunks uint32) int64 {
+	if !isResumableDownload(jptm, info) {
+		return 0
+	}
+	jptm.PrepareChunkTracking(chunkSize)
+	savedChunks := uint32(0)
+	for savedChunks < numChunks-1 && jptm.IsChunkStaged(int32(savedChunks)) {
+		savedChunks++
+	}
+	if savedChunks == 0 {
+		return 0
+	}
+	if fi, err := common.OSStat(info.Destination); err != nil || fi.Size() != fileSize {
+		jptm.ResetChunkTracking()
+		return 0
+	}
+	return int64(savedChunks) * chunkSize
+}
+
+// openPartialDestinationFile opens a destination that an earlier run partly saved, positioned at the end of the saved data
+func openPartialDestinationFile(destination string, offset int64) (io.WriteCloser, error) {
+	f, err := common.OSOpenFile(destination, os.O_WRONLY, common.DEFAULT_FILE_PERM)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
 // complete epilogue. Handles both success and failure
 func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, activeDstFile io.WriteCloser, cw common.ChunkedFileWriter) {
 	info := jptm.Info()
@@ -325,12 +388,16 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 		// Check MD5 (but only if file was fully flushed and saved - else no point and may not have actualAsSaved hash anyway)
 		if jptm.IsLive() {
 			comparison := md5Comparer{
-				expected:         info.SrcHTTPHeaders.ContentMD5, // the MD5 that came back from Service when we enumerated the source
+				expected:         expectedHash(info, jptm.ChecksumAlgorithm()),
 				actualAsSaved:    md5OfFileAsWritten,
 				validationOption: jptm.MD5ValidationOption(),
-				logger:           jptm}
+				logger:           jptm,
+				algorithm:        jptm.ChecksumAlgorithm()}
+			jptm.SetContentDigest(md5OfFileAsWritten, jptm.LastModifiedTime(), info.SourceSize)
 			err := comparison.Check()
-			if err != nil {
+			if err == errMd5Mismatch || err == errSha256Mismatch {
+				jptm.FailActiveDownloadWithStatus("Checking MD5 hash", err, common.ETransferStatus.Corrupted())
+			} else if err != nil {
 				jptm.FailActiveDownload("Checking MD5 hash", err)
 			}
 		}
@@ -343,36 +410,90 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 
 		// check length if enabled (except for dev null and decompression case, where that's impossible)
 		if jptm.IsLive() && info.DestLengthValidation && info.Destination != common.Dev_Null && !jptm.ShouldDecompress() {
-			fi, err := common.OSStat(info.Destination)
-
-			if err != nil {
+			if err := checkDownloadLength(info.Destination, info.SourceSize); err != nil {
 				jptm.FailActiveDownload("Download length check", err)
-			} else if fi.Size() != info.SourceSize {
-				jptm.FailActiveDownload("Download length check", errors.New("destination length did not match source length"))
 			}
 		}
 	}
 
+	// Restore the permissions and ownership that the file was uploaded with
+	if jptm.IsLive() && info.PreservePOSIXProperties && info.Destination != common.Dev_Null {
+		restorePOSIXProperties(jptm, info)
+	}
+
+	// Restore the SMB permissions and properties that the file was uploaded with, since Blob storage has none of its own
+	if jptm.IsLive() && jptm.FromTo() == common.EFromTo.BlobLocal() && (info.PreserveSMBPermissions.IsTruthy() || info.PreserveSMBInfo) && info.Destination != common.Dev_Null {
+		restoreSMBPropertiesFromMetadata(jptm, dl, info)
+	}
+
 	// Preserve modified time
 	if jptm.IsLive() {
-		// TODO: the old version of this code did NOT consider it an error to be unable to set the modification date/time
-		// TODO: ...So I have preserved that behavior here.
-		// TODO: question: But is that correct?
-		lastModifiedTime, preserveLastModifiedTime := jptm.PreserveLastModifiedTime()
-		if preserveLastModifiedTime && !info.PreserveSMBInfo {
-			err := os.Chtimes(jptm.Info().Destination, lastModifiedTime, lastModifiedTime)
-			if err != nil {
-				jptm.LogError(info.Destination, "Changing Modified Time ", err)
-				// do NOT return, since final status and cleanup logging still to come
-			} else {
-				jptm.Log(pipeline.LogInfo, fmt.Sprintf(" Preserved Modified Time for %s", info.Destination))
-			}
-		}
+		preserveLastModifiedTime(jptm, info)
 	}
 
 	commonDownloaderCompletion(jptm, info, common.EEntityType.File())
 }
 
+// preserveLastModifiedTime gives the downloaded file the last modified time of its source, if the job asks for that.
+// Not every local file system lets us set the modified time, and the data itself is intact, so failing to is only a warning.
+func preserveLastModifiedTime(jptm IJobPartTransferMgr, info TransferInfo) {
+	lastModifiedTime, preserve := jptm.PreserveLastModifiedTime()
+	if !preserve || info.PreserveSMBInfo || info.Destination == common.Dev_Null {
+		return
+	}
+	if err := setLastModifiedTime(info.Destination, lastModifiedTime); err != nil {
+		jptm.Log(pipeline.LogWarning, fmt.Sprintf("Could not preserve the last modified time of %s, so it keeps the time it was written. "+
+			"The local file system may not support setting it. Error: %s", info.Destination, err))
+	} else {
+		jptm.Log(pipeline.LogInfo, fmt.Sprintf(" Preserved Modified Time for %s", info.Destination))
+	}
+}
+
+// setLastModifiedTime gives the file at path the last modified time of its source.
+// The access time is set to the same value, since os.Chtimes has no way to leave it alone.
+func setLastModifiedTime(path string, lastModifiedTime time.Time) error {
+	return os.Chtimes(path, lastModifiedTime, lastModifiedTime)
+}
+
+// restorePOSIXProperties gives the downloaded file the POSIX properties in the metadata of its source, if there are any.
+// Failing to set the owner is not an error, since that takes privilege that the user may not have.
+func restorePOSIXProperties(jptm IJobPartTransferMgr, info TransferInfo) {
+	posixProperties, ok, err := common.POSIXPropertiesFromMetadata(info.SrcMetadata)
+	if err != nil {
+		jptm.FailActiveDownload("Reading POSIX properties", err)
+		return
+	}
+	if !ok {
+		return // it wasn't uploaded with them
+	}
+	ownerSet, err := posixProperties.Apply(info.Destination)
+	if err != nil {
+		jptm.FailActiveDownload("Setting POSIX properties", err)
+		return
+	}
+	if !ownerSet {
+		jptm.LogAtLevelForCurrentTransfer(pipeline.LogWarning, fmt.Sprintf("Could not give the file to its original owner (user %d, group %d), "+
+			"since that takes more privilege. Its permissions were set.", posixProperties.UID, posixProperties.GID))
+		posixOwnerNotSetLogGLCM.Do(func() {
+			common.GetLifecycleMgr().Info("One or more downloaded files could not be given their original owners, since that needs more privilege " +
+				"(e.g. running as root). Their permissions were still restored. See the log for the files concerned.")
+		})
+	}
+}
+
+// checkDownloadLength fails if the downloaded file is not as long as its source. That catches a download that was cut short
+// without any error being reported, more cheaply than an MD5 check would.
+func checkDownloadLength(destination string, sourceSize int64) error {
+	fi, err := common.OSStat(destination)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != sourceSize {
+		return fmt.Errorf("destination length %d did not match source length %d", fi.Size(), sourceSize)
+	}
+	return nil
+}
+
 func commonDownloaderCompletion(jptm IJobPartTransferMgr, info TransferInfo, entityType common.EntityType) {
 	// note that we do not really know whether the context was canceled because of an error, or because the user asked for it
 	// if was an intentional cancel, the status is still "in progress", so we are still counting it as pending
@@ -387,10 +508,16 @@ func commonDownloaderCompletion(jptm IJobPartTransferMgr, info TransferInfo, ent
 		}
 		// for files only, cleanup local file if applicable
 		if entityType == entityType.File() && jptm.IsDeadInflight() && jptm.HoldsDestinationLock() {
-			jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Deleting incomplete destination file")
+			if jptm.TransferStatusIgnoringCancellation() == common.ETransferStatus.Paused() && jptm.IsChunkStaged(0) {
+				// The job was paused. Keep the incomplete file, since the chunk bitmap in the plan file
+				// records the chunks saved, and the rest will be downloaded when the job is resumed.
+				jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Keeping incomplete destination file since the job was paused")
+			} else {
+				jptm.LogAtLevelForCurrentTransfer(pipeline.LogInfo, "Deleting incomplete destination file")
 
-			// the file created locally should be deleted
-			tryDeleteFile(info, jptm)
+				// the file created locally should be deleted
+				tryDeleteFile(info, jptm)
+			}
 		}
 	} else {
 		if !jptm.IsLive() {
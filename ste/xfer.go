@@ -43,6 +43,12 @@ var ADLSFlushThreshold uint32 = 7500 // The # of blocks to flush at a time-- Imp
 // download related
 const MaxRetryPerDownloadBody = 5
 
+// transfer related
+// TransferMaxRetries is the number of times a failed transfer is retried, over all resumes of its job, before AzCopy gives up on it.
+// Each attempt already retries its own requests (see UploadMaxTries and MaxRetryPerDownloadBody), so this only needs to cover
+// failures that outlast those. A job can choose its own number instead (see JobPartPlanHeader.MaxRetries).
+const TransferMaxRetries = 10
+
 // TODO: consider to unify the retry options.
 const DownloadTryTimeout = time.Minute * 15
 const DownloadRetryDelay = time.Second * 1
@@ -55,6 +61,9 @@ const PacerTimeToWaitInMs = 50
 // Sync.Once is used so we only log a CPK error once and prevent gumming up stdout
 var cpkAccessFailureLogGLCM sync.Once
 
+// Likewise, we only tell the user once that downloaded files could not be given their original owners
+var posixOwnerNotSetLogGLCM sync.Once
+
 //////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // These types are define the STE Coordinator
@@ -54,7 +54,7 @@ func NewRequestLogPolicyFactory(o RequestLogOptions) pipeline.Factory {
 				b := &bytes.Buffer{}
 				fmt.Fprintf(b, "==> OUTGOING REQUEST (Try=%d)\n", try)
 				pipeline.WriteRequestWithResponse(b, prepareRequestForLogging(request), nil, nil)
-				po.Log(pipeline.LogInfo, b.String())
+				logRequest(ctx, po, pipeline.LogInfo, try, b.String())
 			}
 
 			// Set the time for this particular retry operation and then Do the operation.
@@ -151,7 +151,7 @@ func NewRequestLogPolicyFactory(o RequestLogOptions) pipeline.Factory {
 					pipeline.ForceLog(logLevel, msg)
 				}
 				if shouldLog {
-					po.Log(logLevel, msg)
+					logRequest(ctx, po, logLevel, try, msg)
 				}
 			}
 			return response, err
@@ -159,6 +159,32 @@ func NewRequestLogPolicyFactory(o RequestLogOptions) pipeline.Factory {
 	})
 }
 
+// requestEventLogger records the entries of the request log policy as events of the transfer that made the request.
+// Transfers only put one in their context when the job's log is in the JSON format, since that is where events are recorded
+type requestEventLogger interface {
+	logRequestEvent(level pipeline.LogLevel, event common.LogEvent, msg string)
+}
+
+var requestEventLoggerContextKey = contextKey{"requestEventLogger"}
+
+func withRequestEventLogger(ctx context.Context, logger requestEventLogger) context.Context {
+	return context.WithValue(ctx, requestEventLoggerContextKey, logger)
+}
+
+// logRequest logs msg, about the given try of a request, as an event of the transfer that made the request if there is one
+func logRequest(ctx context.Context, po *pipeline.PolicyOptions, level pipeline.LogLevel, try int32, msg string) {
+	logger, ok := ctx.Value(requestEventLoggerContextKey).(requestEventLogger)
+	if !ok {
+		po.Log(level, msg)
+		return
+	}
+	event := common.ELogEvent.Request()
+	if try > 1 {
+		event = common.ELogEvent.Retry()
+	}
+	logger.logRequestEvent(level, event, msg)
+}
+
 func isContextCancelledError(err error) bool {
 	if err == nil {
 		return false
@@ -262,10 +288,19 @@ func prepareRequestForServiceLogging(request pipeline.Request) *http.Request {
 			}
 		}
 	}
+
+	// The customer-provided key is a secret in itself. Its SHA-256, which is logged, is enough to identify it.
+	if exist, key := doesHeaderExistCaseInsensitive(req.Header, xMsEncryptionKeyHeader); exist {
+		if req.Request == request.Request {
+			req = request.Copy()
+		}
+		req.Header.Set(key, "REDACTED")
+	}
 	return req.Request
 }
 
 const xMsCopySourceHeader = "x-ms-copy-source"
+const xMsEncryptionKeyHeader = "x-ms-encryption-key"
 
 func doesHeaderExistCaseInsensitive(header http.Header, key string) (bool, string) {
 	for keyInHeader := range header {
@@ -2,12 +2,15 @@ package ste
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
@@ -61,6 +64,66 @@ type XferRetryOptions struct {
 	// NOTE: Before setting this field, make sure you understand the issues around reading stale & potentially-inconsistent
 	// data at this webpage: https://docs.microsoft.com/en-us/azure/storage/common/storage-designing-ha-apps-with-ragrs
 	RetryReadsFromSecondaryHost string // Comment this our for non-Blob SDKs
+
+	// RetryableStatusCodes lists the HTTP status codes of failed requests that are retried. A request that fails with any
+	// other status code is not retried. If this is empty, DefaultRetryableStatusCodes are retried.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryableStatusCodes are the status codes that are retried, if nothing else is configured: timeouts, throttling
+// and server errors, since they are usually temporary. A status such as 404 or 403 won't change if we try again.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// isRetryableStatusCode tells whether a request that failed with the given status code should be retried
+func (o XferRetryOptions) isRetryableStatusCode(statusCode int) bool {
+	for _, c := range o.RetryableStatusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRetryableStatusCodes parses a comma-separated list of HTTP status codes, such as "500,503"
+func ParseRetryableStatusCodes(s string) ([]int, error) {
+	codes := make([]int, 0)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("'%s' is not an HTTP status code", field)
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return nil, errors.New("no status codes were given")
+	}
+	return codes, nil
+}
+
+// retryableStatusCodesFromEnvironment returns the retryable status codes set by the user, or nil if they didn't set any
+func retryableStatusCodesFromEnvironment() []int {
+	envVar := common.EEnvironmentVariable.RetryStatusCodes()
+	value := common.GetLifecycleMgr().GetEnvironmentVariable(envVar)
+	if value == "" {
+		return nil
+	}
+	codes, err := ParseRetryableStatusCodes(value)
+	if err != nil {
+		common.GetLifecycleMgr().Error(fmt.Sprintf("Cannot parse environment variable %s, due to error %s", envVar.Name, err))
+		return nil
+	}
+	return codes
 }
 
 func (o XferRetryOptions) retryReadsFromSecondaryHost() string {
@@ -95,6 +158,9 @@ func (o XferRetryOptions) defaults() XferRetryOptions {
 	if o.MaxTries == 0 {
 		o.MaxTries = 4
 	}
+	if len(o.RetryableStatusCodes) == 0 {
+		o.RetryableStatusCodes = DefaultRetryableStatusCodes
+	}
 	switch o.Policy {
 	case RetryPolicyExponential:
 		IfDefault(&o.TryTimeout, 1*time.Minute)
@@ -138,6 +204,41 @@ func (o XferRetryOptions) calcDelay(try int32) time.Duration { // try is >=1; ne
 	return delay
 }
 
+// calcDelayHonoringRetryAfter is like calcDelay, except that it waits at least as long as the service asked, in the Retry-After header of
+// its last response, so that a throttled service isn't hit by a flurry of retries. Even so, it never waits longer than MaxRetryDelay.
+func (o XferRetryOptions) calcDelayHonoringRetryAfter(try int32, retryAfter time.Duration) time.Duration {
+	delay := o.calcDelay(try)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > o.MaxRetryDelay {
+		delay = o.MaxRetryDelay
+	}
+	return delay
+}
+
+// retryAfterFromResponse returns how long the Retry-After header of the response asks us to wait before trying again.
+// The header holds either a number of seconds or an HTTP date. The result is zero if there is no such header or it can't be parsed.
+func retryAfterFromResponse(response pipeline.Response, now time.Time) time.Duration {
+	if response == nil || response.Response() == nil {
+		return 0
+	}
+	header := response.Response().Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
 // TODO fix the separate retry policies
 // NewBFSXferRetryPolicyFactory creates a RetryPolicyFactory object configured using the specified options.
 func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
@@ -145,7 +246,8 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
 		return func(ctx context.Context, request pipeline.Request) (response pipeline.Response, err error) {
 			// Before each try, we'll select either the primary or secondary URL.
-			primaryTry := int32(0) // This indicates how many tries we've attempted against the primary DC
+			primaryTry := int32(0)         // This indicates how many tries we've attempted against the primary DC
+			retryAfter := time.Duration(0) // How long the service last asked us to wait before trying again, if it said
 
 			// We only consider retrying against a secondary if we have a read request (GET/HEAD) AND this policy has a Secondary URL it can use
 			considerSecondary := (request.Method == http.MethodGet || request.Method == http.MethodHead) && o.retryReadsFromSecondaryHost() != ""
@@ -165,7 +267,7 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				// Select the correct host and delay
 				if tryingPrimary {
 					primaryTry++
-					delay := o.calcDelay(primaryTry)
+					delay := o.calcDelayHonoringRetryAfter(primaryTry, retryAfter)
 					logf("Primary try=%d, Delay=%v\n", primaryTry, delay)
 					time.Sleep(delay) // The 1st try returns 0 delay
 				} else {
@@ -209,6 +311,7 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 
 				// Set the time for this particular retry operation and then Do the operation.
 				tryCtx, tryCancel := context.WithTimeout(ctx, time.Second*time.Duration(timeout))
+				tryCancel = transferProgressFromContext(ctx).trackTry(tryCancel) // lets a stalled transfer cancel this try, so it is retried
 				//requestCopy.body = &deadlineExceededReadCloser{r: requestCopy.Request.body}
 				response, err = next.Do(tryCtx, requestCopy) // Make the request
 				/*err = improveDeadlineExceeded(err)
@@ -241,14 +344,7 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 
 					// TODO make sure Storage error can be cast to different package's error object
 					if stErr, ok := err.(azbfs.StorageError); ok {
-						// retry only in case of temporary storage errors.
-						if stErr.Temporary() {
-							action = "Retry: StorageError with error service code and Temporary()"
-						} else if stErr.Response() != nil && isSuccessStatusCode(stErr.Response()) { // This is a temporarily work around.
-							action = "Retry: StorageError with success status code"
-						} else {
-							action = "NoRetry: StorageError not Temporary() and without retriable status code"
-						}
+						action = o.storageErrorAction(stErr.Response(), stErr.Temporary())
 					} else if _, ok := err.(net.Error); ok {
 						action = "Retry: net.Error and Temporary() or Timeout()"
 					} else if err == io.ErrUnexpectedEOF {
@@ -281,6 +377,7 @@ func NewBFSXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					}
 					break // Don't retry
 				}
+				retryAfter = retryAfterFromResponse(response, time.Now())
 				if response.Response() != nil {
 					// If we're going to retry and we got a previous response, then flush its body to avoid leaking its TCP connection
 					io.Copy(ioutil.Discard, response.Response().Body)
@@ -312,7 +409,8 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
 		return func(ctx context.Context, request pipeline.Request) (response pipeline.Response, err error) {
 			// Before each try, we'll select either the primary or secondary URL.
-			primaryTry := int32(0) // This indicates how many tries we've attempted against the primary DC
+			primaryTry := int32(0)         // This indicates how many tries we've attempted against the primary DC
+			retryAfter := time.Duration(0) // How long the service last asked us to wait before trying again, if it said
 
 			// We only consider retrying against a secondary if we have a read request (GET/HEAD) AND this policy has a Secondary URL it can use
 			considerSecondary := (request.Method == http.MethodGet || request.Method == http.MethodHead) && o.retryReadsFromSecondaryHost() != ""
@@ -336,7 +434,7 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 				// Select the correct host and delay
 				if tryingPrimary {
 					primaryTry++
-					delay := o.calcDelay(primaryTry)
+					delay := o.calcDelayHonoringRetryAfter(primaryTry, retryAfter)
 					logf("Primary try=%d, Delay=%f s\n", primaryTry, delay.Seconds())
 					time.Sleep(delay) // The 1st try returns 0 delay
 				} else {
@@ -380,6 +478,7 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 
 				// Set the time for this particular retry operation and then Do the operation.
 				tryCtx, tryCancel := context.WithTimeout(ctx, time.Second*time.Duration(timeout))
+				tryCancel = transferProgressFromContext(ctx).trackTry(tryCancel) // lets a stalled transfer cancel this try, so it is retried
 				//requestCopy.body = &deadlineExceededReadCloser{r: requestCopy.Request.body}
 				response, err = next.Do(tryCtx, requestCopy) // Make the request
 				/*err = improveDeadlineExceeded(err)
@@ -413,14 +512,7 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					// TODO make sure Storage error can be cast to different package's error object
 					// TODO: Discuss the error handling of Go Blob SDK.
 					if stErr, ok := err.(azblob.StorageError); ok {
-						// retry only in case of temporary storage errors.
-						if stErr.Temporary() {
-							action = "Retry: StorageError with error service code and Temporary()"
-						} else if stErr.Response() != nil && isSuccessStatusCode(stErr.Response()) { // This is a temporarily work around.
-							action = "Retry: StorageError with success status code"
-						} else {
-							action = "NoRetry: StorageError not Temporary() and without retriable status code"
-						}
+						action = o.storageErrorAction(stErr.Response(), stErr.Temporary())
 					} else if _, ok := err.(net.Error); ok {
 						action = "Retry: net.Error"
 					} else if err == io.ErrUnexpectedEOF {
@@ -453,6 +545,7 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 					}
 					break // Don't retry
 				}
+				retryAfter = retryAfterFromResponse(response, time.Now())
 				if response.Response() != nil {
 					// If we're going to retry and we got a previous response, then flush its body to avoid leaking its TCP connection
 					io.Copy(ioutil.Discard, response.Response().Body)
@@ -466,6 +559,23 @@ func NewBlobXferRetryPolicyFactory(o XferRetryOptions) pipeline.Factory {
 	})
 }
 
+// storageErrorAction decides whether to retry a request that failed with a StorageError. If the service responded,
+// its status code decides (see RetryableStatusCodes). Otherwise, the request is only retried if the error is temporary.
+func (o XferRetryOptions) storageErrorAction(resp *http.Response, temporary bool) string {
+	switch {
+	case resp != nil && o.isRetryableStatusCode(resp.StatusCode):
+		return "Retry: StorageError with retryable status code"
+	case resp != nil && isSuccessStatusCode(resp): // This is a temporarily work around.
+		return "Retry: StorageError with success status code"
+	case resp != nil:
+		return "NoRetry: StorageError without retryable status code"
+	case temporary:
+		return "Retry: StorageError with Temporary()"
+	default:
+		return "NoRetry: StorageError not Temporary()"
+	}
+}
+
 var successStatusCodes = []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent, http.StatusPartialContent}
 
 func isSuccessStatusCode(resp *http.Response) bool {
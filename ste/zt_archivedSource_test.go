@@ -0,0 +1,170 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	chk "gopkg.in/check.v1"
+)
+
+type archivedSourceSuite struct{}
+
+var _ = chk.Suite(&archivedSourceSuite{})
+
+func (s *archivedSourceSuite) TestOnlineTiersAreReadDirectly(c *chk.C) {
+	for _, tier := range []azblob.AccessTierType{azblob.AccessTierNone, azblob.AccessTierHot, azblob.AccessTierCool} {
+		for _, rehydrate := range []bool{false, true} {
+			mustRehydrate, err := checkArchivedSource(tier, rehydrate)
+			c.Assert(err, chk.IsNil)
+			c.Assert(mustRehydrate, chk.Equals, false)
+		}
+	}
+}
+
+func (s *archivedSourceSuite) TestArchivedSourceFailsWithoutRehydration(c *chk.C) {
+	mustRehydrate, err := checkArchivedSource(azblob.AccessTierArchive, false)
+	c.Assert(err, chk.Equals, errArchivedSource)
+	c.Assert(mustRehydrate, chk.Equals, false)
+}
+
+func (s *archivedSourceSuite) TestArchivedSourceIsRehydratedWhenRequested(c *chk.C) {
+	mustRehydrate, err := checkArchivedSource(azblob.AccessTierArchive, true)
+	c.Assert(err, chk.IsNil)
+	c.Assert(mustRehydrate, chk.Equals, true)
+}
+
+// archivedBlobServer is a fake blob endpoint, whose blob is in the given tier and rehydration state, and which counts the requests to rehydrate it
+func archivedBlobServer(c *chk.C, tier *string, archiveStatus *string, setTierCalls *int, setTierStatus int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("x-ms-access-tier", *tier)
+			if *archiveStatus != "" {
+				w.Header().Set("x-ms-archive-status", *archiveStatus)
+			}
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPut:
+			c.Check(r.URL.Query().Get("comp"), chk.Equals, "tier")
+			c.Check(r.Header.Get("x-ms-access-tier"), chk.Equals, "Hot")
+			*setTierCalls++
+			if setTierStatus == http.StatusAccepted {
+				*archiveStatus = "rehydrate-pending-to-hot"
+			} else {
+				w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+			}
+			w.WriteHeader(setTierStatus)
+		default:
+			c.Errorf("unexpected %s request", r.Method)
+		}
+	}))
+}
+
+func (s *archivedSourceSuite) TestRehydrationIsRequestedOnceAndPolled(c *chk.C) {
+	tier, archiveStatus, setTierCalls := "Archive", "", 0
+	server := archivedBlobServer(c, &tier, &archiveStatus, &setTierCalls, http.StatusAccepted)
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/container/blob")
+	blobURL := azblob.NewBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
+
+	// the first look asks for the rehydration, but doesn't wait for it
+	rehydrated, err := requestRehydration(context.Background(), blobURL, discardingJobLogger{})
+	c.Assert(err, chk.IsNil)
+	c.Assert(rehydrated, chk.Equals, false)
+	c.Assert(setTierCalls, chk.Equals, 1)
+
+	// while the rehydration is pending, it isn't asked for again
+	rehydrated, err = requestRehydration(context.Background(), blobURL, discardingJobLogger{})
+	c.Assert(err, chk.IsNil)
+	c.Assert(rehydrated, chk.Equals, false)
+	c.Assert(setTierCalls, chk.Equals, 1)
+
+	tier, archiveStatus = "Hot", ""
+	rehydrated, err = requestRehydration(context.Background(), blobURL, discardingJobLogger{})
+	c.Assert(err, chk.IsNil)
+	c.Assert(rehydrated, chk.Equals, true)
+	c.Assert(setTierCalls, chk.Equals, 1)
+}
+
+func (s *archivedSourceSuite) TestFailedRehydrationRequest(c *chk.C) {
+	tier, archiveStatus, setTierCalls := "Archive", "", 0
+	server := archivedBlobServer(c, &tier, &archiveStatus, &setTierCalls, http.StatusForbidden)
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/container/blob")
+	blobURL := azblob.NewBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
+
+	rehydrated, err := requestRehydration(context.Background(), blobURL, discardingJobLogger{})
+	c.Assert(err, chk.ErrorMatches, "(?s)could not rehydrate the archived source blob: .*")
+	c.Assert(rehydrated, chk.Equals, false)
+}
+
+// reschedulingJobPartMgr records the transfers that are rescheduled. Nothing else of the part is used
+type reschedulingJobPartMgr struct {
+	IJobPartMgr
+	rescheduled chan IJobPartTransferMgr
+}
+
+func (jpm *reschedulingJobPartMgr) RescheduleTransfer(jptm IJobPartTransferMgr) {
+	jpm.rescheduled <- jptm
+}
+
+func (s *archivedSourceSuite) TestTransferWaitingForRehydrationGivesUpItsSlot(c *chk.C) {
+	jpm := &reschedulingJobPartMgr{rescheduled: make(chan IJobPartTransferMgr, 1)}
+	slots := make(chan struct{}, 1)
+	slots <- struct{}{}
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, ctx: context.Background(), heldTransferSlot: slots}
+
+	jptm.RescheduleTransferAfter(50 * time.Millisecond)
+	c.Assert(slots, chk.HasLen, 0) // free for another transfer while this one waits
+	c.Assert(jptm.heldTransferSlot, chk.IsNil)
+	select {
+	case <-jpm.rescheduled:
+		c.Fatal("rescheduled before the delay")
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case rescheduled := <-jpm.rescheduled:
+		c.Assert(rescheduled, chk.Equals, IJobPartTransferMgr(jptm))
+	case <-time.After(5 * time.Second):
+		c.Fatal("not rescheduled after the delay")
+	}
+}
+
+func (s *archivedSourceSuite) TestCancelledTransferStopsWaitingForRehydration(c *chk.C) {
+	jpm := &reschedulingJobPartMgr{rescheduled: make(chan IJobPartTransferMgr, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, ctx: ctx}
+
+	jptm.RescheduleTransferAfter(time.Hour)
+	cancel()
+	// rescheduled at once, so that the worker that picks it up can record it as cancelled
+	select {
+	case <-jpm.rescheduled:
+	case <-time.After(5 * time.Second):
+		c.Fatal("not rescheduled when cancelled")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type asyncCopySuite struct{}
+
+var _ = chk.Suite(&asyncCopySuite{})
+
+func (s *asyncCopySuite) TestAsyncCopyOutcome(c *chk.C) {
+	done, err := asyncCopyOutcome(azblob.CopyStatusPending, "")
+	c.Assert(done, chk.Equals, false)
+	c.Assert(err, chk.IsNil)
+
+	done, err = asyncCopyOutcome(azblob.CopyStatusSuccess, "")
+	c.Assert(done, chk.Equals, true)
+	c.Assert(err, chk.IsNil)
+
+	for _, status := range []azblob.CopyStatusType{azblob.CopyStatusFailed, azblob.CopyStatusAborted, azblob.CopyStatusNone} {
+		done, err = asyncCopyOutcome(status, "500 InternalError")
+		c.Assert(done, chk.Equals, true)
+		c.Assert(err, chk.NotNil)
+		if status != azblob.CopyStatusNone {
+			c.Assert(strings.Contains(err.Error(), "500 InternalError"), chk.Equals, true)
+		}
+	}
+}
+
+func (s *asyncCopySuite) TestAsyncCopyPollIntervalBacksOff(c *chk.C) {
+	const gib = 1024 * 1024 * 1024
+
+	// small blobs back off to a couple of seconds
+	interval := asyncCopyInitialPollInterval
+	for i := 0; i < 10; i++ {
+		next := nextAsyncCopyPollInterval(interval, 1024)
+		c.Assert(next >= interval, chk.Equals, true)
+		interval = next
+	}
+	c.Assert(interval, chk.Equals, asyncCopyMinMaxPollInterval)
+
+	// larger blobs are polled less often
+	c.Assert(nextAsyncCopyPollInterval(time.Hour, 10*gib), chk.Equals, asyncCopyMinMaxPollInterval+10*time.Second)
+
+	// but never less often than the overall limit
+	c.Assert(nextAsyncCopyPollInterval(time.Hour, 1024*gib), chk.Equals, asyncCopyMaxPollInterval)
+}
+
+// asyncCopyTestJptm is a transfer whose chunk funcs are scheduled on a channel, and that notes when its chunk is done and how it fails
+type asyncCopyTestJptm struct {
+	IJobPartTransferMgr
+	ctx        context.Context
+	scheduled  chan chunkFunc
+	chunksDone int32
+	failure    error
+	versionID  string
+}
+
+func (t *asyncCopyTestJptm) Info() TransferInfo                                     { return TransferInfo{} }
+func (t *asyncCopyTestJptm) Context() context.Context                               { return t.ctx }
+func (t *asyncCopyTestJptm) WasCanceled() bool                                      { return t.ctx.Err() != nil }
+func (t *asyncCopyTestJptm) OccupyAConnection()                                     {}
+func (t *asyncCopyTestJptm) ReleaseAConnection()                                    {}
+func (t *asyncCopyTestJptm) SetDestinationIsModified()                              {}
+func (t *asyncCopyTestJptm) LogChunkStatus(id common.ChunkID, r common.WaitReason)  {}
+func (t *asyncCopyTestJptm) ShouldLog(level pipeline.LogLevel) bool                 { return false }
+func (t *asyncCopyTestJptm) LogAtLevelForCurrentTransfer(pipeline.LogLevel, string) {}
+func (t *asyncCopyTestJptm) ScheduleChunks(f chunkFunc)                             { t.scheduled <- f }
+func (t *asyncCopyTestJptm) SetDestinationVersionID(versionID string)               { t.versionID = versionID }
+func (t *asyncCopyTestJptm) FailActiveSend(where string, err error)                 { t.failure = err }
+func (t *asyncCopyTestJptm) ReportChunkDone(id common.ChunkID) (bool, uint32) {
+	atomic.AddInt32(&t.chunksDone, 1)
+	return true, 1
+}
+
+// newAsyncCopyTestCopier returns a copier whose destination says the copy is pending for the given number of status checks
+func newAsyncCopyTestCopier(c *chk.C, ctx context.Context, pendingChecks int32) (*urlToBlobAsyncCopier, *asyncCopyTestJptm, *int32, func()) {
+	var checks, aborts int32
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-copy-id", "copy")
+		switch {
+		case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "copy":
+			atomic.AddInt32(&aborts, 1)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut:
+			w.Header().Set("x-ms-copy-status", "pending")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodHead:
+			if atomic.AddInt32(&checks, 1) <= pendingChecks {
+				w.Header().Set("x-ms-copy-status", "pending")
+			} else {
+				w.Header().Set("x-ms-copy-status", "success")
+				w.Header().Set("x-ms-version-id", "version")
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			c.Errorf("unexpected %s request", r.Method)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	jptm := &asyncCopyTestJptm{ctx: ctx, scheduled: make(chan chunkFunc, 1)}
+	destURL, _ := url.Parse(destination.URL + "/account/container/blob")
+	srcURL, _ := url.Parse("https://source.blob.core.windows.net/container/blob")
+	copier := &urlToBlobAsyncCopier{
+		jptm:         jptm,
+		destBlobURL:  azblob.NewBlobURL(*destURL, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})),
+		srcURL:       *srcURL,
+		destBlobTier: azblob.AccessTierNone,
+	}
+	return copier, jptm, &aborts, destination.Close
+}
+
+func (s *asyncCopySuite) TestPendingCopyDoesNotHoldTheWorker(c *chk.C) {
+	copier, jptm, _, closeDestination := newAsyncCopyTestCopier(c, context.Background(), 1)
+	defer closeDestination()
+
+	// the chunk func only starts the copy, and returns without the chunk being done
+	copier.GenerateCopyFunc(common.NewChunkID("blob", 0, 1), 0, 1, true)(0)
+	c.Assert(atomic.LoadInt32(&jptm.chunksDone), chk.Equals, int32(0))
+
+	// each status check runs in a chunk func of its own, and the last one finishes the chunk
+	checks := 0
+	for atomic.LoadInt32(&jptm.chunksDone) == 0 {
+		select {
+		case f := <-jptm.scheduled:
+			f(0)
+			checks++
+		case <-time.After(10 * time.Second):
+			c.Fatal("the status of the copy was not checked")
+		}
+	}
+	c.Assert(checks, chk.Equals, 2)
+	c.Assert(atomic.LoadInt32(&jptm.chunksDone), chk.Equals, int32(1))
+	c.Assert(jptm.failure, chk.IsNil)
+	c.Assert(jptm.versionID, chk.Equals, "version")
+
+	select {
+	case <-jptm.scheduled:
+		c.Fatal("the status was checked again after the copy had finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (s *asyncCopySuite) TestCancelledCopyIsAbortedAtTheNextCheck(c *chk.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	copier, jptm, aborts, closeDestination := newAsyncCopyTestCopier(c, ctx, 1000)
+	defer closeDestination()
+
+	copier.GenerateCopyFunc(common.NewChunkID("blob", 0, 1), 0, 1, true)(0)
+	c.Assert(atomic.LoadInt32(&jptm.chunksDone), chk.Equals, int32(0))
+
+	// cancellation doesn't wait for the interval between checks to pass
+	cancel()
+	select {
+	case f := <-jptm.scheduled:
+		f(0)
+	case <-time.After(time.Second):
+		c.Fatal("the status of the copy was not checked after cancellation")
+	}
+	c.Assert(atomic.LoadInt32(&jptm.chunksDone), chk.Equals, int32(1))
+	c.Assert(atomic.LoadInt32(aborts), chk.Equals, int32(1))
+}
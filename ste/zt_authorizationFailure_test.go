@@ -0,0 +1,80 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type authorizationFailureTestSuite struct{}
+
+var _ = chk.Suite(&authorizationFailureTestSuite{})
+
+func (s *authorizationFailureTestSuite) TestAuthorizationFailureMessage(c *chk.C) {
+	err := errors.New("RESPONSE Status: 403 This request is not authorized to perform this operation using this permission.")
+	blobURL := "https://account.blob.core.windows.net/container/dir/file.txt"
+	mismatch := string(azblob.StorageErrorCodeAuthorizationPermissionMismatch)
+
+	// an Azure AD identity without a role needs one, so say which container it is
+	msg := authorizationFailureMessage(common.ECredentialType.OAuthToken(), mismatch, blobURL, err)
+	c.Assert(strings.Contains(msg, "not authorized to access container 'container' of account.blob.core.windows.net"), chk.Equals, true)
+	c.Assert(strings.Contains(msg, "Storage Blob Data Contributor"), chk.Equals, true)
+	c.Assert(strings.HasSuffix(msg, err.Error()), chk.Equals, true)
+
+	// a SAS token that lacks the permission, or an identity that failed to authenticate, gets the general message
+	general := "Authentication failed, it is either not correct, or expired, or does not have the correct permission " + err.Error()
+	c.Assert(authorizationFailureMessage(common.ECredentialType.Anonymous(), mismatch, blobURL, err), chk.Equals, general)
+	c.Assert(authorizationFailureMessage(common.ECredentialType.OAuthToken(), string(azblob.StorageErrorCodeAuthenticationFailed), blobURL, err), chk.Equals, general)
+}
+
+// authorizationFailureTestError is a failed response to a request for the given URL
+type authorizationFailureTestError struct {
+	requestURL string
+}
+
+func (e authorizationFailureTestError) Error() string { return "RESPONSE Status: 403" }
+
+func (e authorizationFailureTestError) Response() *http.Response {
+	u, _ := url.Parse(e.requestURL)
+	return &http.Response{StatusCode: http.StatusForbidden, Request: &http.Request{URL: u}}
+}
+
+func (s *authorizationFailureTestSuite) TestAuthorizationFailureResource(c *chk.C) {
+	info := TransferInfo{Source: "https://src.blob.core.windows.net/from/file.txt", Destination: "https://dst.blob.core.windows.net/to/file.txt"}
+	s2s := common.EFromTo.BlobBlob()
+
+	// in a service to service copy, the resource is that of the request that was refused, whichever end it was sent to
+	c.Assert(authorizationFailureResource(info, s2s, authorizationFailureTestError{info.Source}), chk.Equals, info.Source)
+	c.Assert(authorizationFailureResource(info, s2s, authorizationFailureTestError{info.Destination}), chk.Equals, info.Destination)
+
+	// and, if the error doesn't say, it's the remote end
+	err := errors.New("no response")
+	c.Assert(authorizationFailureResource(info, s2s, err), chk.Equals, info.Destination)
+	c.Assert(authorizationFailureResource(TransferInfo{Source: info.Source, Destination: "/local/file.txt"}, common.EFromTo.BlobLocal(), err), chk.Equals, info.Source)
+}
@@ -0,0 +1,163 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type bandwidthSchedulerSuite struct{}
+
+var _ = chk.Suite(&bandwidthSchedulerSuite{})
+
+// fakeSchedulerClock only moves when it is told to
+type fakeSchedulerClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (f *fakeSchedulerClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeSchedulerClock) At(t time.Time) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if t.After(f.now) {
+		f.waiters = append(f.waiters, fakeClockWaiter{at: t, ch: ch})
+	} else {
+		ch <- f.now
+	}
+	return ch
+}
+
+func (f *fakeSchedulerClock) advanceTo(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+	waiting := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(t) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- t
+		}
+	}
+	f.waiters = waiting
+}
+
+type capChange struct {
+	mbps     float64
+	inWindow bool
+}
+
+func expectCap(c *chk.C, changes <-chan capChange, expected capChange) {
+	select {
+	case change := <-changes:
+		c.Assert(change, chk.Equals, expected)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the cap was not changed to %v", expected)
+	}
+}
+
+func expectNoCapChange(c *chk.C, changes <-chan capChange) {
+	select {
+	case change := <-changes:
+		c.Fatalf("the cap was unexpectedly changed to %v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *bandwidthSchedulerSuite) TestBandwidthSchedulerFollowsWindows(c *chk.C) {
+	day := func(d, hour, minute int) time.Time { return time.Date(2021, 3, d, hour, minute, 0, 0, time.UTC) }
+	schedule, err := common.ParseBandwidthSchedule("09:00-17:00=100,22:00-06:00=0")
+	c.Assert(err, chk.IsNil)
+	clock := &fakeSchedulerClock{now: day(14, 8, 0)}
+	changes := make(chan capChange, 10)
+	scheduler := newBandwidthScheduler(common.NewJobID(), schedule, 20, clock, func(mbps float64, inWindow bool) {
+		changes <- capChange{mbps, inWindow}
+	})
+
+	scheduler.start()
+	expectCap(c, changes, capChange{20, false}) // outside the windows, the base cap applies
+
+	clock.advanceTo(day(14, 9, 0))
+	expectCap(c, changes, capChange{100, true})
+
+	clock.advanceTo(day(14, 17, 0))
+	expectCap(c, changes, capChange{20, false})
+
+	// a new base cap applies at once outside the windows
+	scheduler.setBaseCap(30)
+	expectCap(c, changes, capChange{30, false})
+
+	// the window that runs past midnight still applies on the next day
+	clock.advanceTo(day(14, 22, 0))
+	expectCap(c, changes, capChange{0, true})
+	clock.advanceTo(day(15, 0, 30))
+	expectNoCapChange(c, changes)
+	clock.advanceTo(day(15, 6, 0))
+	expectCap(c, changes, capChange{30, false})
+
+	// jumping past several boundaries gives the cap for the time jumped to
+	clock.advanceTo(day(15, 23, 0))
+	expectCap(c, changes, capChange{0, true})
+
+	// once stopped, the cap is left alone
+	scheduler.stop()
+	clock.advanceTo(day(16, 9, 0))
+	expectNoCapChange(c, changes)
+}
+
+func (s *bandwidthSchedulerSuite) TestStopBandwidthScheduleRestoresCap(c *chk.C) {
+	ja := &jobsAdmin{pacer: newTokenBucketPacer(megaBitsToBytesPerSecond(20), 0)}
+	schedule, err := common.ParseBandwidthSchedule("00:00-23:59=100")
+	c.Assert(err, chk.IsNil)
+	clock := &fakeSchedulerClock{now: time.Date(2021, 3, 14, 12, 0, 0, 0, time.Local)}
+	jobID, otherJobID := common.NewJobID(), common.NewJobID()
+
+	ja.startBandwidthSchedule(jobID, schedule, clock)
+	c.Assert(ja.BandwidthCap(), chk.Equals, float64(100))
+	// while the schedule is in a window, a new cap only applies outside it
+	ja.SetBandwidthCap(40)
+	c.Assert(ja.BandwidthCap(), chk.Equals, float64(100))
+
+	// only the job that started the schedule stops it
+	ja.StopBandwidthSchedule(otherJobID)
+	c.Assert(ja.BandwidthCap(), chk.Equals, float64(100))
+	ja.StopBandwidthSchedule(jobID)
+	c.Assert(ja.BandwidthCap(), chk.Equals, float64(40))
+	c.Assert(ja.bandwidthScheduler, chk.IsNil)
+}
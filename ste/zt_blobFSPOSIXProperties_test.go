@@ -0,0 +1,100 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type blobFSPOSIXPropertiesSuite struct{}
+
+var _ = chk.Suite(&blobFSPOSIXPropertiesSuite{})
+
+func (s *blobFSPOSIXPropertiesSuite) TestBlobFSPOSIXProperties(c *chk.C) {
+	// a source without POSIX properties gets the service's defaults
+	permissions, pathProperties, err := blobFSPOSIXProperties(common.Metadata{"other": "value"})
+	c.Assert(err, chk.IsNil)
+	c.Assert(permissions, chk.Equals, "")
+	c.Assert(pathProperties, chk.IsNil)
+
+	metadata := common.POSIXProperties{Mode: 0750, UID: 1000, GID: 100}.AddToMetadata(common.Metadata{"other": "value"})
+	permissions, pathProperties, err = blobFSPOSIXProperties(metadata)
+	c.Assert(err, chk.IsNil)
+	c.Assert(permissions, chk.Equals, "0750")
+	// only the POSIX properties are kept with the path
+	c.Assert(pathProperties, chk.DeepEquals, map[string]string{
+		common.POSIXModeMeta:  "0750",
+		common.POSIXOwnerMeta: "1000",
+		common.POSIXGroupMeta: "100",
+	})
+
+	_, _, err = blobFSPOSIXProperties(common.Metadata{common.POSIXModeMeta: "rwx"})
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *blobFSPOSIXPropertiesSuite) TestBlobFSPermissionRequests(c *chk.C) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("X-Http-Method-Override") == "" {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	p := azbfs.NewPipeline(azbfs.NewAnonymousCredential(), azbfs.PipelineOptions{Retry: azbfs.RetryOptions{MaxTries: 1}})
+
+	fileURL, _ := url.Parse(server.URL + "/account/filesystem/dir/file")
+	_, err := azbfs.NewFileURL(*fileURL, p).CreateWithPermissions(context.Background(), azbfs.BlobFSHTTPHeaders{}, "0750",
+		map[string]string{common.POSIXOwnerMeta: "1000", common.POSIXModeMeta: "0750"})
+	c.Assert(err, chk.IsNil)
+	dirURL, _ := url.Parse(server.URL + "/account/filesystem/dir")
+	_, err = azbfs.NewDirectoryURL(*dirURL, p).SetPermissions(context.Background(), "0755")
+	c.Assert(err, chk.IsNil)
+
+	c.Assert(requests, chk.HasLen, 2)
+	create := requests[0]
+	c.Assert(create.Method, chk.Equals, http.MethodPut)
+	c.Assert(strings.HasSuffix(create.URL.Path, "/filesystem/dir/file"), chk.Equals, true)
+	c.Assert(create.URL.Query().Get("resource"), chk.Equals, "file")
+	c.Assert(create.Header.Get("x-ms-permissions"), chk.Equals, "0750")
+	c.Assert(create.Header.Get("x-ms-umask"), chk.Equals, "0000")
+	encode := func(v string) string { return base64.StdEncoding.EncodeToString([]byte(v)) }
+	c.Assert(create.Header.Get("x-ms-properties"), chk.Equals,
+		common.POSIXModeMeta+"="+encode("0750")+","+common.POSIXOwnerMeta+"="+encode("1000"))
+
+	setPermissions := requests[1]
+	c.Assert(setPermissions.Header.Get("X-Http-Method-Override"), chk.Equals, "PATCH")
+	c.Assert(setPermissions.URL.Query().Get("action"), chk.Equals, "setAccessControl")
+	c.Assert(strings.HasSuffix(setPermissions.URL.Path, "/filesystem/dir"), chk.Equals, true)
+	c.Assert(setPermissions.Header.Get("x-ms-permissions"), chk.Equals, "0755")
+}
@@ -0,0 +1,198 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type blobFSResumeSuite struct{}
+
+var _ = chk.Suite(&blobFSResumeSuite{})
+
+// blobFSResumeTestServer is an ADLS Gen2 endpoint that holds one file, and records what is done to it
+type blobFSResumeTestServer struct {
+	mu      sync.Mutex
+	created int
+	appends []int64
+	flushes []int64
+	length  int64 // what has been flushed
+}
+
+func (t *blobFSResumeTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", strconv.FormatInt(t.length, 10))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && query.Get("resource") == "file":
+		t.created++
+		t.length = 0
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("resource") == "directory":
+		w.WriteHeader(http.StatusCreated)
+	case query.Get("action") == "append":
+		position, _ := strconv.ParseInt(query.Get("position"), 10, 64)
+		t.appends = append(t.appends, position)
+		w.WriteHeader(http.StatusAccepted)
+	case query.Get("action") == "flush":
+		position, _ := strconv.ParseInt(query.Get("position"), 10, 64)
+		t.flushes = append(t.flushes, position)
+		t.length = position
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// resumeTestJptm is an upload whose chunks are only noted as done, since there is no job to report them to
+type resumeTestJptm struct {
+	*jobPartTransferMgr
+}
+
+func (t *resumeTestJptm) OccupyAConnection()                                    {}
+func (t *resumeTestJptm) ReleaseAConnection()                                   {}
+func (t *resumeTestJptm) LogChunkStatus(id common.ChunkID, r common.WaitReason) {}
+func (t *resumeTestJptm) ReportChunkDone(id common.ChunkID) (bool, uint32)      { return false, 0 }
+
+// resumeTestSource is a source with no properties to preserve
+type resumeTestSource struct {
+	ISourceInfoProvider
+}
+
+func (resumeTestSource) Properties() (*SrcProperties, error) { return &SrcProperties{}, nil }
+
+// blobFSResumeTestChunk is a chunk that is already in memory
+type blobFSResumeTestChunk struct {
+	common.SingleChunkReader
+	data *bytes.Reader
+}
+
+func (r *blobFSResumeTestChunk) Read(p []byte) (int, error) { return r.data.Read(p) }
+func (r *blobFSResumeTestChunk) Seek(offset int64, whence int) (int64, error) {
+	return r.data.Seek(offset, whence)
+}
+func (r *blobFSResumeTestChunk) Close() error { return nil }
+
+func (s *blobFSResumeSuite) TestPausedUploadResumesAfterWhatWasFlushed(c *chk.C) {
+	const chunkSize, numChunks = 16, 5
+	savedFlushChunks := blobFSResumeFlushChunks
+	blobFSResumeFlushChunks = 2
+	defer func() { blobFSResumeFlushChunks = savedFlushChunks }()
+
+	server := &blobFSResumeTestServer{}
+	destination := httptest.NewServer(server)
+	defer destination.Close()
+
+	jpm, plain := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	jpm.jobMgrInitState = &jobMgrInitState{folderCreationTracker: common.NewFolderCreationTracker(common.EFolderPropertiesOption.NoFolders())}
+	info := *plain.transferInfo
+	info.Destination = destination.URL + "/account/filesystem/dir/file"
+	info.SourceSize = chunkSize*numChunks - 4
+	info.BlockSize = chunkSize
+	p := azbfs.NewPipeline(azbfs.NewAnonymousCredential(), azbfs.PipelineOptions{Retry: azbfs.RetryOptions{MaxTries: 1}})
+
+	// each run sends the chunks that it hasn't been told were flushed, in order, and only the epilogue closes the file
+	upload := func() {
+		t := jpm.newTransferMgr(context.Background(), 0)
+		t.transferInfo = &info
+		jptm := &resumeTestJptm{jobPartTransferMgr: t}
+		snd, err := newBlobFSUploader(jptm, info.Destination, p, newNullAutoPacer(), resumeTestSource{})
+		c.Assert(err, chk.IsNil)
+		u := snd.(*blobFSUploader)
+		c.Assert(u.NumChunks(), chk.Equals, uint32(numChunks))
+		u.Prologue(common.PrologueState{})
+		for chunk := int64(0); chunk < numChunks; chunk++ {
+			length := common.Iffint64(chunk == numChunks-1, info.SourceSize-chunk*chunkSize, chunkSize)
+			id := common.NewChunkID(info.Source, chunk*chunkSize, length)
+			u.GenerateUploadFunc(id, int32(chunk), &blobFSResumeTestChunk{data: bytes.NewReader(make([]byte, length))}, false)(0)
+		}
+		c.Assert(jptm.IsLive(), chk.Equals, true, chk.Commentf("%v", jpm.Plan().ErrorMessage(0)))
+		u.md5Channel <- make([]byte, 16)
+		u.Epilogue()
+	}
+
+	// the first run flushes as it goes, until (as if it were paused) the last flush is lost
+	upload()
+	c.Assert(server.created, chk.Equals, 1)
+	c.Assert(server.appends, chk.DeepEquals, []int64{0, 16, 32, 48, 64})
+	c.Assert(server.flushes, chk.DeepEquals, []int64{32, 64, 76})
+	server.length = 64
+
+	// so the resumed run doesn't create the file again, and only sends what wasn't flushed
+	server.appends, server.flushes = nil, nil
+	upload()
+	c.Assert(server.created, chk.Equals, 1)
+	c.Assert(server.appends, chk.DeepEquals, []int64{64})
+	c.Assert(server.flushes, chk.DeepEquals, []int64{76})
+
+	// but if the file no longer holds what was flushed, it's created and sent again in full
+	server.appends, server.flushes = nil, nil
+	server.length = 10
+	upload()
+	c.Assert(server.created, chk.Equals, 2)
+	c.Assert(server.appends, chk.DeepEquals, []int64{0, 16, 32, 48, 64})
+	c.Assert(server.flushes, chk.DeepEquals, []int64{32, 64, 76})
+}
+
+func (s *blobFSResumeSuite) TestPausedUploadKeepsItsFile(c *chk.C) {
+	var deletes int
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deletes++
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+
+	jpm, t := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	t.transferInfo.Destination = destination.URL + "/account/filesystem/file"
+	t.transferInfo.BlockSize = 16
+	ctx, cancel := context.WithCancel(context.Background())
+	t.ctx = ctx
+	p := azbfs.NewPipeline(azbfs.NewAnonymousCredential(), azbfs.PipelineOptions{Retry: azbfs.RetryOptions{MaxTries: 1}})
+	snd, err := newBlobFSUploader(t, t.transferInfo.Destination, p, newNullAutoPacer(), resumeTestSource{})
+	c.Assert(err, chk.IsNil)
+	t.SetDestinationIsModified()
+	cancel()
+
+	t.SetStatus(common.ETransferStatus.Paused())
+	snd.Cleanup()
+	c.Assert(deletes, chk.Equals, 0)
+
+	t.SetStatus(common.ETransferStatus.Cancelled())
+	snd.Cleanup()
+	c.Assert(deletes, chk.Equals, 1)
+}
@@ -0,0 +1,295 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type blobImmutabilitySuite struct{}
+
+var _ = chk.Suite(&blobImmutabilitySuite{})
+
+// immutabilityTestPipeline sets the service version from the context, as the pipelines of a transfer do
+func immutabilityTestPipeline() pipeline.Pipeline {
+	return pipeline.NewPipeline([]pipeline.Factory{NewVersionPolicyFactory()}, pipeline.Options{})
+}
+
+func (s *blobImmutabilitySuite) TestImmutabilityFromHeaders(c *chk.C) {
+	h := http.Header{}
+	h.Set("x-ms-immutability-policy-until-date", "Wed, 02 Jan 2030 15:04:05 GMT")
+	h.Set("x-ms-immutability-policy-mode", "locked")
+	h.Set("x-ms-legal-hold", "true")
+	b, err := immutabilityFromHeaders(h)
+	c.Assert(err, chk.IsNil)
+	c.Assert(b.PolicyExpiresOn.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)), chk.Equals, true)
+	c.Assert(b.PolicyMode, chk.Equals, common.EImmutabilityPolicyMode.Locked())
+	c.Assert(b.LegalHold, chk.Equals, true)
+
+	// a blob that has neither
+	b, err = immutabilityFromHeaders(http.Header{})
+	c.Assert(err, chk.IsNil)
+	c.Assert(b.HasPolicy(), chk.Equals, false)
+	c.Assert(b.LegalHold, chk.Equals, false)
+
+	h.Set("x-ms-immutability-policy-until-date", "2030-01-02")
+	_, err = immutabilityFromHeaders(h)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *blobImmutabilitySuite) TestImmutabilityRoundTrip(c *chk.C) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, chk.Equals, http.MethodHead)
+		c.Check(r.Header.Get("x-ms-version"), chk.Equals, immutabilityServiceVersion)
+		c.Check(r.URL.Query().Get("sig"), chk.Equals, "secret")
+		w.Header().Set("x-ms-immutability-policy-until-date", "Wed, 02 Jan 2030 15:04:05 GMT")
+		w.Header().Set("x-ms-immutability-policy-mode", "unlocked")
+		w.Header().Set("x-ms-legal-hold", "true")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer source.Close()
+	var sets []*http.Request
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sets = append(sets, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+
+	p := immutabilityTestPipeline()
+	srcURL, _ := url.Parse(source.URL + "/account/container/dir/blob?sig=secret")
+	b, err := GetBlobImmutability(context.Background(), *srcURL, p)
+	c.Assert(err, chk.IsNil)
+	c.Assert(b.PolicyMode, chk.Equals, common.EImmutabilityPolicyMode.Unlocked())
+	c.Assert(b.LegalHold, chk.Equals, true)
+
+	dstURL, _ := url.Parse(destination.URL + "/account/container/dir/blob?sig=secret")
+	c.Assert(setBlobImmutabilityPolicy(context.Background(), *dstURL, p, b.PolicyExpiresOn, b.PolicyMode), chk.IsNil)
+	c.Assert(setBlobLegalHold(context.Background(), *dstURL, p, b.LegalHold), chk.IsNil)
+
+	c.Assert(sets, chk.HasLen, 2)
+	for _, r := range sets {
+		c.Assert(r.Method, chk.Equals, http.MethodPut)
+		c.Assert(r.URL.Path, chk.Equals, "/account/container/dir/blob")
+		c.Assert(r.URL.Query().Get("sig"), chk.Equals, "secret")
+		c.Assert(r.Header.Get("x-ms-version"), chk.Equals, immutabilityServiceVersion)
+	}
+	c.Assert(sets[0].URL.Query().Get("comp"), chk.Equals, "immutabilityPolicies")
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-until-date"), chk.Equals, "Wed, 02 Jan 2030 15:04:05 GMT")
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-mode"), chk.Equals, "Unlocked")
+	c.Assert(sets[1].URL.Query().Get("comp"), chk.Equals, "legalhold")
+	c.Assert(sets[1].Header.Get("x-ms-legal-hold"), chk.Equals, "true")
+}
+
+func (s *blobImmutabilitySuite) TestImmutabilityUnsupported(c *chk.C) {
+	status, errorCode := http.StatusConflict, ""
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", errorCode)
+		w.WriteHeader(status)
+	}))
+	defer destination.Close()
+	dstURL, _ := url.Parse(destination.URL + "/account/container/blob")
+	expiresOn := time.Now().Add(time.Hour)
+
+	// refusals of accounts and containers without immutability are only warned about
+	for _, refusal := range []struct {
+		status    int
+		errorCode string
+	}{
+		{http.StatusConflict, "VersionLevelWormNotEnabled"},
+		{http.StatusBadRequest, "InvalidQueryParameterValue"},
+		{http.StatusBadRequest, "UnsupportedQueryParameter"},
+	} {
+		status, errorCode = refusal.status, refusal.errorCode
+		err := setBlobImmutabilityPolicy(context.Background(), *dstURL, immutabilityTestPipeline(), expiresOn, common.EImmutabilityPolicyMode.Unlocked())
+		c.Assert(err, chk.NotNil)
+		c.Assert(isImmutabilityUnsupported(err), chk.Equals, true, chk.Commentf("error code %s", errorCode))
+		c.Assert(err.Error(), chk.Matches, fmt.Sprintf(".*%d.*%s.*", status, errorCode))
+	}
+
+	// other failures fail the transfer, even with the same status
+	for _, refusal := range []struct {
+		status    int
+		errorCode string
+	}{
+		{http.StatusConflict, "BlobImmutableDueToPolicy"},
+		{http.StatusBadRequest, "InvalidHeaderValue"},
+		{http.StatusForbidden, "AuthorizationPermissionMismatch"},
+	} {
+		status, errorCode = refusal.status, refusal.errorCode
+		err := setBlobLegalHold(context.Background(), *dstURL, immutabilityTestPipeline(), true)
+		c.Assert(err, chk.NotNil)
+		c.Assert(isImmutabilityUnsupported(err), chk.Equals, false, chk.Commentf("error code %s", errorCode))
+	}
+	c.Assert(isImmutabilityUnsupported(nil), chk.Equals, false)
+}
+
+// immutabilityTestJptm is a transfer that is given its info, and that notes how it fails
+type immutabilityTestJptm struct {
+	IJobPartTransferMgr
+	info    TransferInfo
+	warning *sync.Once
+	failure error
+}
+
+func (t *immutabilityTestJptm) Info() TransferInfo                     { return t.info }
+func (t *immutabilityTestJptm) Context() context.Context               { return context.Background() }
+func (t *immutabilityTestJptm) GetImmutabilityWarning() *sync.Once     { return t.warning }
+func (t *immutabilityTestJptm) ShouldLog(level pipeline.LogLevel) bool { return false }
+func (t *immutabilityTestJptm) FailActiveSend(where string, err error) { t.failure = err }
+
+func (s *blobImmutabilitySuite) TestSourceImmutabilityFromPlanIsApplied(c *chk.C) {
+	var sets []*http.Request
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sets = append(sets, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+
+	jptm := &immutabilityTestJptm{warning: &sync.Once{}, info: TransferInfo{
+		Destination:          destination.URL + "/account/container/blob",
+		PreserveImmutability: true,
+		SrcImmutability: common.BlobImmutability{
+			PolicyExpiresOn: time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC),
+			PolicyMode:      common.EImmutabilityPolicyMode.Locked(),
+			LegalHold:       true,
+		},
+	}}
+	applyImmutability(jptm, immutabilityTestPipeline())
+	c.Assert(jptm.failure, chk.IsNil)
+	c.Assert(sets, chk.HasLen, 2)
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-until-date"), chk.Equals, "Wed, 02 Jan 2030 15:04:05 GMT")
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-mode"), chk.Equals, "Locked")
+	c.Assert(sets[1].Header.Get("x-ms-legal-hold"), chk.Equals, "true")
+
+	// the job's own policy takes the place of the source's, but the legal hold is kept
+	sets = nil
+	jptm.info.ImmutabilityPolicyExpiresOn = time.Date(2031, 1, 2, 15, 4, 5, 0, time.UTC)
+	jptm.info.ImmutabilityPolicyMode = common.EImmutabilityPolicyMode.Unlocked()
+	applyImmutability(jptm, immutabilityTestPipeline())
+	c.Assert(jptm.failure, chk.IsNil)
+	c.Assert(sets, chk.HasLen, 2)
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-until-date"), chk.Equals, "Thu, 02 Jan 2031 15:04:05 GMT")
+	c.Assert(sets[0].Header.Get("x-ms-immutability-policy-mode"), chk.Equals, "Unlocked")
+
+	// a source without either needs no requests
+	sets = nil
+	jptm.info = TransferInfo{Destination: jptm.info.Destination, PreserveImmutability: true}
+	applyImmutability(jptm, immutabilityTestPipeline())
+	c.Assert(sets, chk.HasLen, 0)
+}
+
+func (s *blobImmutabilitySuite) TestUnsupportedImmutabilityWarnsOncePerJob(c *chk.C) {
+	errorCode := "VersionLevelWormNotEnabled"
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", errorCode)
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer destination.Close()
+
+	info := TransferInfo{
+		Destination:          destination.URL + "/account/container/blob",
+		PreserveImmutability: true,
+		SrcImmutability:      common.BlobImmutability{LegalHold: true},
+	}
+	warned := func(warning *sync.Once) bool {
+		notYet := false
+		warning.Do(func() { notYet = true })
+		return !notYet
+	}
+
+	// the transfer succeeds, and the job has given its warning
+	firstJob := &immutabilityTestJptm{warning: &sync.Once{}, info: info}
+	applyImmutability(firstJob, immutabilityTestPipeline())
+	c.Assert(firstJob.failure, chk.IsNil)
+	c.Assert(warned(firstJob.warning), chk.Equals, true)
+
+	// another job gives a warning of its own
+	secondJob := &immutabilityTestJptm{warning: &sync.Once{}, info: info}
+	c.Assert(warned(secondJob.warning), chk.Equals, false)
+
+	// other refusals fail the transfer, without the warning
+	errorCode = "BlobImmutableDueToPolicy"
+	thirdJob := &immutabilityTestJptm{warning: &sync.Once{}, info: info}
+	applyImmutability(thirdJob, immutabilityTestPipeline())
+	c.Assert(thirdJob.failure, chk.NotNil)
+	c.Assert(warned(thirdJob.warning), chk.Equals, false)
+}
+
+func (s *blobImmutabilitySuite) TestImmutabilityInPlan(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	expiresOn := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	order := common.CopyJobPartOrderRequest{
+		JobID:           common.NewJobID(),
+		FromTo:          common.EFromTo.BlobBlob(),
+		SourceRoot:      common.ResourceString{Value: "https://src.blob.core.windows.net/container"},
+		DestinationRoot: common.ResourceString{Value: "https://dst.blob.core.windows.net/container"},
+		Transfers: []common.CopyTransfer{
+			{Source: "/a", Destination: "/a", EntityType: common.EEntityType.File(), BlobImmutability: common.BlobImmutability{
+				PolicyExpiresOn: expiresOn.Add(time.Hour), PolicyMode: common.EImmutabilityPolicyMode.Unlocked(), LegalHold: true}},
+			{Source: "/b", Destination: "/b", EntityType: common.EEntityType.File()},
+		},
+		PreserveImmutability: true,
+		BlobAttributes: common.BlobTransferAttributes{
+			ImmutabilityPolicyExpiresOn: expiresOn,
+			ImmutabilityPolicyMode:      common.EImmutabilityPolicyMode.Locked(),
+		},
+	}
+	mmf := createTestPlanFile(order).Map()
+	defer mmf.Unmap()
+	plan := mmf.Plan()
+	c.Assert(plan.PreserveImmutability, chk.Equals, true)
+	c.Assert(time.Unix(0, plan.DstBlobData.ImmutabilityPolicyExpiresOn).Equal(expiresOn), chk.Equals, true)
+	c.Assert(plan.DstBlobData.ImmutabilityPolicyMode, chk.Equals, common.EImmutabilityPolicyMode.Locked())
+	// the source's values are kept with each transfer
+	c.Assert(time.Unix(0, plan.Transfer(0).SrcImmutabilityPolicyExpiresOn).Equal(expiresOn.Add(time.Hour)), chk.Equals, true)
+	c.Assert(plan.Transfer(0).SrcImmutabilityPolicyMode, chk.Equals, common.EImmutabilityPolicyMode.Unlocked())
+	c.Assert(plan.Transfer(0).SrcLegalHold, chk.Equals, true)
+	c.Assert(plan.Transfer(1).SrcImmutabilityPolicyExpiresOn, chk.Equals, int64(0))
+	c.Assert(plan.Transfer(1).SrcLegalHold, chk.Equals, false)
+
+	// without a policy of the job's own, none is stored
+	order.JobID = common.NewJobID()
+	order.BlobAttributes = common.BlobTransferAttributes{}
+	mmf2 := createTestPlanFile(order).Map()
+	defer mmf2.Unmap()
+	c.Assert(mmf2.Plan().DstBlobData.ImmutabilityPolicyExpiresOn, chk.Equals, int64(0))
+
+	// nor are the source's, unless they are preserved
+	order.JobID = common.NewJobID()
+	order.PreserveImmutability = false
+	mmf3 := createTestPlanFile(order).Map()
+	defer mmf3.Unmap()
+	c.Assert(mmf3.Plan().Transfer(0).SrcImmutabilityPolicyExpiresOn, chk.Equals, int64(0))
+	c.Assert(mmf3.Plan().Transfer(0).SrcLegalHold, chk.Equals, false)
+}
@@ -0,0 +1,135 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type blockListSuite struct{}
+
+var _ = chk.Suite(&blockListSuite{})
+
+func newTestBlockBlobSender(c *chk.C, serviceURL string, blockSize int64, sourceSize int64) *blockBlobSenderBase {
+	jpm := newTestJobPartMgr(newTestPlanMMF(c, newTestPlanWithOneTransfer(0)))
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, jobPartPlanTransfer: jpm.Plan().Transfer(0),
+		transferInfo: &TransferInfo{JobID: common.NewJobID(), SourceSize: sourceSize, BlockSize: blockSize}}
+	jptm.ctx, jptm.cancel = context.WithCancel(context.Background())
+
+	u, _ := url.Parse(serviceURL + "/container/file.bin")
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	numChunks := getNumChunks(sourceSize, blockSize)
+	return &blockBlobSenderBase{
+		jptm:             jptm,
+		destBlockBlobURL: azblob.NewBlockBlobURL(*u, p),
+		chunkSize:        blockSize,
+		numChunks:        numChunks,
+		pacer:            newNullAutoPacer(),
+		blocks:           make([]blockListEntry, numChunks),
+		blockListSize:    sourceSize,
+		muBlockIDs:       &sync.Mutex{},
+	}
+}
+
+func (s *blockListSuite) TestBlocksStagedOutOfOrderAreCommittedInSourceOrder(c *chk.C) {
+	const blockSize = 1024
+	original := make([]byte, 10*blockSize+123) // the last block is a short one
+	rand.New(rand.NewSource(1)).Read(original)
+
+	service := &fakeBlockBlobService{blocks: make(map[string][]byte)}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	sender := newTestBlockBlobSender(c, server.URL, blockSize, int64(len(original)))
+	setPutListNeed(&sender.atomicPutListIndicator, putListNeeded)
+
+	// the chunks are staged in a random order, each finishing whenever it finishes
+	chunks := make([]common.ChunkID, 0)
+	for offset := int64(0); offset < int64(len(original)); offset += blockSize {
+		length := int64(len(original)) - offset
+		if length > blockSize {
+			length = blockSize
+		}
+		chunks = append(chunks, common.NewChunkID("file.bin", offset, length))
+	}
+	rand.New(rand.NewSource(2)).Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+	wg := &sync.WaitGroup{}
+	for _, id := range chunks {
+		wg.Add(1)
+		go func(id common.ChunkID) {
+			defer wg.Done()
+			blockIndex, blockID := sender.setBlockIDForChunk(id)
+			c.Check(int64(blockIndex)*blockSize, chk.Equals, id.OffsetInFile())
+			data := original[id.OffsetInFile() : id.OffsetInFile()+id.Length()]
+			_, err := sender.destBlockBlobURL.StageBlock(context.Background(), blockID, bytes.NewReader(data), azblob.LeaseAccessConditions{}, nil)
+			c.Check(err, chk.IsNil)
+		}(id)
+	}
+	wg.Wait()
+	sender.Epilogue()
+
+	c.Assert(sender.jptm.IsLive(), chk.Equals, true)
+	c.Assert(service.blob, chk.DeepEquals, original)
+}
+
+func (s *blockListSuite) TestBlockListMustCoverTheSourceExactly(c *chk.C) {
+	block := func(id string, offset, length int64) blockListEntry {
+		return blockListEntry{id: id, offset: offset, length: length}
+	}
+
+	ids, err := verifyBlockList([]blockListEntry{block("a", 0, 100), block("b", 100, 100), block("c", 200, 50)}, 250)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ids, chk.DeepEquals, []string{"a", "b", "c"})
+
+	_, err = verifyBlockList([]blockListEntry{block("a", 0, 100), {}, block("c", 200, 50)}, 250)
+	c.Assert(err, chk.ErrorMatches, "block 1 of 3 was never staged")
+	_, err = verifyBlockList([]blockListEntry{block("a", 0, 100), block("c", 200, 50)}, 250)
+	c.Assert(err, chk.ErrorMatches, "there is a gap in the block list: .*")
+	_, err = verifyBlockList([]blockListEntry{block("a", 0, 100), block("b", 50, 100)}, 150)
+	c.Assert(err, chk.ErrorMatches, "there is an overlap in the block list: .*")
+	_, err = verifyBlockList([]blockListEntry{block("a", 0, 100), block("b", 100, 100)}, 250)
+	c.Assert(err, chk.ErrorMatches, "the block list holds 200 bytes, but the blob should have 250")
+}
+
+func (s *blockListSuite) TestIncompleteBlockListIsNotCommitted(c *chk.C) {
+	service := &fakeBlockBlobService{blocks: make(map[string][]byte)}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	sender := newTestBlockBlobSender(c, server.URL, 1024, 3*1024)
+	setPutListNeed(&sender.atomicPutListIndicator, putListNeeded)
+
+	// the middle block is missing
+	sender.setBlockIDForChunk(common.NewChunkID("file.bin", 0, 1024))
+	sender.setBlockIDForChunk(common.NewChunkID("file.bin", 2048, 1024))
+	sender.Epilogue()
+
+	c.Assert(sender.jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(service.commitHeaders, chk.IsNil)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type bufferLimitSuite struct{}
+
+var _ = chk.Suite(&bufferLimitSuite{})
+
+func (s *bufferLimitSuite) TestChunksMustFitInBuffer(c *chk.C) {
+	const mib = 1024 * 1024
+	cacheLimiter := common.NewCacheLimiter(64 * mib) // 48 MiB is available to new chunks
+	order := func(fromTo common.FromTo, blockSize int64, sourceSize int64) common.CopyJobPartOrderRequest {
+		return common.CopyJobPartOrderRequest{
+			FromTo:         fromTo,
+			Transfers:      []common.CopyTransfer{{SourceSize: 1024}, {SourceSize: sourceSize}},
+			BlobAttributes: common.BlobTransferAttributes{BlockSizeInBytes: blockSize},
+		}
+	}
+
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.LocalBlob(), 32*mib, 1024), cacheLimiter), chk.IsNil)
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.LocalBlob(), 64*mib, 1024), cacheLimiter), chk.NotNil)
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.BlobLocal(), 64*mib, 1024), cacheLimiter), chk.NotNil)
+
+	// an automatic block size grows with the largest source
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.LocalBlob(), 0, 100*1024*mib), cacheLimiter), chk.IsNil)
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.LocalBlob(), 0, 4*1024*1024*mib), cacheLimiter), chk.NotNil)
+
+	// Azure Files chunks never exceed 4 MiB, and service-to-service copies aren't buffered by us at all
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.LocalFile(), 64*mib, 1024), cacheLimiter), chk.IsNil)
+	c.Assert(checkChunksFitInBuffer(order(common.EFromTo.BlobBlob(), 64*mib, 1024), cacheLimiter), chk.IsNil)
+}
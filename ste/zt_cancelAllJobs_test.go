@@ -0,0 +1,67 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type cancelAllJobsSuite struct{}
+
+var _ = chk.Suite(&cancelAllJobsSuite{})
+
+func (s *cancelAllJobsSuite) TestOnlyInProgressJobsAreCancelled(c *chk.C) {
+	running, failing := common.NewJobID(), common.NewJobID()
+	jobs := []common.JobIDDetails{
+		{JobId: running, JobStatus: common.EJobStatus.InProgress()},
+		{JobId: common.NewJobID(), JobStatus: common.EJobStatus.Completed()},
+		{JobId: common.NewJobID(), JobStatus: common.EJobStatus.Paused()},
+		{JobId: failing, JobStatus: common.EJobStatus.InProgress()},
+	}
+
+	var asked []common.JobID
+	resp := cancelInProgressJobs(jobs, func(jobID common.JobID) common.CancelPauseResumeResponse {
+		asked = append(asked, jobID)
+		if jobID == failing {
+			return common.CancelPauseResumeResponse{ErrorMsg: "cannot cancel the job"}
+		}
+		return common.CancelPauseResumeResponse{CancelledPauseResumed: true}
+	})
+
+	c.Assert(asked, chk.DeepEquals, []common.JobID{running, failing})
+	c.Assert(resp.CancelledJobIDs, chk.DeepEquals, []common.JobID{running})
+	c.Assert(resp.ErrorMsg, chk.Equals, "job "+failing.String()+": cannot cancel the job")
+}
+
+func (s *cancelAllJobsSuite) TestNothingInProgressIsNotAnError(c *chk.C) {
+	jobs := []common.JobIDDetails{{JobId: common.NewJobID(), JobStatus: common.EJobStatus.Cancelled()}}
+
+	resp := cancelInProgressJobs(jobs, func(common.JobID) common.CancelPauseResumeResponse {
+		c.Fatal("no job should be cancelled")
+		return common.CancelPauseResumeResponse{}
+	})
+
+	c.Assert(resp.CancelledJobIDs, chk.NotNil)
+	c.Assert(resp.CancelledJobIDs, chk.HasLen, 0)
+	c.Assert(resp.ErrorMsg, chk.Equals, "")
+}
@@ -0,0 +1,135 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type cpkSuite struct{}
+
+var _ = chk.Suite(&cpkSuite{})
+
+const (
+	testCpkKey       = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=" // the bytes 0 to 31
+	testCpkKeySha256 = "Yw3NKWbEM2aRElRIu7JbT/QSpJxzLbLIq8G4WBvXEN0="
+)
+
+func (s *cpkSuite) TestCpkPolicy(c *chk.C) {
+	var lastRequest pipeline.Request
+	fakeService := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			lastRequest = request
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}), nil
+		}
+	})
+	p := pipeline.NewPipeline([]pipeline.Factory{NewCpkPolicyFactory(), fakeService}, pipeline.Options{})
+	cpkCtx := context.WithValue(context.Background(), CpkInfoOverride, common.CpkInfo{EncryptionKey: testCpkKey, EncryptionKeySha256: testCpkKeySha256})
+
+	send := func(ctx context.Context, method string, rawURL string) http.Header {
+		u, _ := url.Parse(rawURL)
+		request, err := pipeline.NewRequest(method, *u, nil)
+		c.Assert(err, chk.IsNil)
+		_, err = p.Do(ctx, nil, request)
+		c.Assert(err, chk.IsNil)
+		return lastRequest.Header
+	}
+	const container = "https://account.blob.core.windows.net/container"
+	const blob = container + "/blob"
+
+	for _, op := range []struct {
+		method, rawURL string
+		carriesKey     bool
+	}{
+		{http.MethodPut, blob, true},                                        // Put Blob
+		{http.MethodPut, blob + "?comp=block&blockid=AAAA", true},           // Put Block
+		{http.MethodPut, blob + "?comp=blocklist", true},                    // Put Block List
+		{http.MethodGet, blob, true},                                        // Get Blob
+		{http.MethodHead, blob, true},                                       // Get Blob Properties
+		{http.MethodPut, blob + "?comp=tier", false},                        // Set Blob Tier
+		{http.MethodDelete, blob, false},                                    // Delete Blob
+		{http.MethodPut, container + "?restype=container", false},           // Create Container
+		{http.MethodGet, container + "?restype=container&comp=list", false}, // List Blobs
+	} {
+		header := send(cpkCtx, op.method, op.rawURL)
+		comment := chk.Commentf("%s %s", op.method, op.rawURL)
+		if op.carriesKey {
+			c.Assert(header.Get("x-ms-encryption-key"), chk.Equals, testCpkKey, comment)
+			c.Assert(header.Get("x-ms-encryption-key-sha256"), chk.Equals, testCpkKeySha256, comment)
+			c.Assert(header.Get("x-ms-encryption-algorithm"), chk.Equals, "AES256", comment)
+		} else {
+			c.Assert(header.Get("x-ms-encryption-key"), chk.Equals, "", comment)
+		}
+	}
+
+	// without a key in the context, nothing is added
+	c.Assert(send(context.Background(), http.MethodPut, blob).Get("x-ms-encryption-key"), chk.Equals, "")
+}
+
+func (s *cpkSuite) TestCpkKeyRedactedFromLogs(c *chk.C) {
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+	request, err := pipeline.NewRequest(http.MethodPut, *u, nil)
+	c.Assert(err, chk.IsNil)
+	request.Header.Set("x-ms-encryption-key", testCpkKey)
+	request.Header.Set("x-ms-encryption-key-sha256", testCpkKeySha256)
+
+	logged := prepareRequestForServiceLogging(request)
+	c.Assert(logged.Header.Get("x-ms-encryption-key"), chk.Equals, "REDACTED")
+	c.Assert(logged.Header.Get("x-ms-encryption-key-sha256"), chk.Equals, testCpkKeySha256)
+
+	// the request that is sent still has the key
+	c.Assert(request.Header.Get("x-ms-encryption-key"), chk.Equals, testCpkKey)
+}
+
+func (s *cpkSuite) TestPlanCpkInfo(c *chk.C) {
+	envVar := common.EEnvironmentVariable.CPKEncryptionKey().Name
+	defer os.Unsetenv(envVar)
+	os.Setenv(envVar, testCpkKey)
+
+	// a plan without a key needs none
+	plan := &JobPartPlanHeader{}
+	cpkInfo, err := plan.CpkInfo()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cpkInfo, chk.IsNil)
+
+	copy(plan.CpkKeySha256[:], testCpkKeySha256)
+	cpkInfo, err = plan.CpkInfo()
+	c.Assert(err, chk.IsNil)
+	c.Assert(cpkInfo.EncryptionKey, chk.Equals, testCpkKey)
+
+	// a different key, or none, is refused
+	os.Setenv(envVar, "AQECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")
+	_, err = plan.CpkInfo()
+	c.Assert(err, chk.NotNil)
+	os.Unsetenv(envVar)
+	_, err = plan.CpkInfo()
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,189 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	chk "gopkg.in/check.v1"
+)
+
+type destAccessConditionsSuite struct{}
+
+var _ = chk.Suite(&destAccessConditionsSuite{})
+
+func (s *destAccessConditionsSuite) TestDestBlobAccessConditions(c *chk.C) {
+	c.Assert(TransferInfo{}.hasDestAccessConditions(), chk.Equals, false)
+	c.Assert(TransferInfo{}.destBlobAccessConditions(), chk.DeepEquals, azblob.BlobAccessConditions{})
+
+	conditions := TransferInfo{DestIfMatch: "0x8D9"}.destBlobAccessConditions()
+	c.Assert(conditions.ModifiedAccessConditions.IfMatch, chk.Equals, azblob.ETag("0x8D9"))
+	c.Assert(conditions.ModifiedAccessConditions.IfNoneMatch, chk.Equals, azblob.ETagNone)
+
+	conditions = TransferInfo{DestIfNoneMatch: "*"}.destBlobAccessConditions()
+	c.Assert(conditions.ModifiedAccessConditions.IfMatch, chk.Equals, azblob.ETagNone)
+	c.Assert(conditions.ModifiedAccessConditions.IfNoneMatch, chk.Equals, azblob.ETagAny)
+}
+
+func (s *destAccessConditionsSuite) TestPreconditionFailure(c *chk.C) {
+	failed := common.ETransferStatus.Failed()
+	overwriteTrue := common.EOverwriteOption.True()
+	ifMatch := TransferInfo{DestIfMatch: "0x8D9"}
+
+	// other failures, and failures of unconditional transfers, are left as they are
+	status, msg := preconditionFailure(ifMatch, overwriteTrue, "", http.StatusForbidden, failed, "403 forbidden")
+	c.Assert(status, chk.Equals, failed)
+	c.Assert(msg, chk.Equals, "403 forbidden")
+	status, _ = preconditionFailure(TransferInfo{}, overwriteTrue, "", http.StatusPreconditionFailed, failed, "412")
+	c.Assert(status, chk.Equals, failed)
+	status, _ = preconditionFailure(ifMatch, overwriteTrue, "", http.StatusPreconditionFailed, common.ETransferStatus.BlobTierFailure(), "412")
+	c.Assert(status, chk.Equals, common.ETransferStatus.BlobTierFailure())
+
+	// a destination that no longer has the expected ETag
+	status, msg = preconditionFailure(ifMatch, overwriteTrue, "", http.StatusPreconditionFailed, failed, "412 condition not met")
+	c.Assert(status, chk.Equals, common.ETransferStatus.PreconditionFailed())
+	c.Assert(strings.Contains(msg, "expected ETag 0x8D9"), chk.Equals, true)
+	c.Assert(strings.HasSuffix(msg, "412 condition not met"), chk.Equals, true)
+
+	// the wildcard, in both directions
+	status, msg = preconditionFailure(TransferInfo{DestIfNoneMatch: "*"}, overwriteTrue, "", http.StatusPreconditionFailed, failed, "412")
+	c.Assert(status, chk.Equals, common.ETransferStatus.PreconditionFailed())
+	c.Assert(strings.Contains(msg, "already exists"), chk.Equals, true)
+	status, msg = preconditionFailure(TransferInfo{DestIfMatch: "*"}, overwriteTrue, "", http.StatusPreconditionFailed, failed, "412")
+	c.Assert(status, chk.Equals, common.ETransferStatus.PreconditionFailed())
+	c.Assert(strings.Contains(msg, "does not exist"), chk.Equals, true)
+
+	c.Assert(common.ETransferStatus.PreconditionFailed().DidFail(), chk.Equals, true)
+}
+
+func (s *destAccessConditionsSuite) TestIfNotExists(c *chk.C) {
+	ifNotExists := common.EOverwriteOption.IfNotExists()
+	info := TransferInfo{DestIfNoneMatch: "*"}
+
+	// Put Blob refuses an existing blob with 409, Put Block List and Create with 412. Both just mean the transfer is skipped
+	status, _ := preconditionFailure(info, ifNotExists, string(azblob.ServiceCodeBlobAlreadyExists), http.StatusConflict, common.ETransferStatus.Failed(), "409")
+	c.Assert(status, chk.Equals, common.ETransferStatus.SkippedEntityAlreadyExists())
+	status, _ = preconditionFailure(info, ifNotExists, string(azblob.ServiceCodeConditionNotMet), http.StatusPreconditionFailed, common.ETransferStatus.Failed(), "412")
+	c.Assert(status, chk.Equals, common.ETransferStatus.SkippedEntityAlreadyExists())
+
+	// other conflicts are still failures
+	status, _ = preconditionFailure(info, ifNotExists, string(azblob.ServiceCodeLeaseIDMissing), http.StatusConflict, common.ETransferStatus.Failed(), "409")
+	c.Assert(status, chk.Equals, common.ETransferStatus.Failed())
+
+	// an explicit If-None-Match: * answered with 409 is a failed precondition, since overwrite isn't ifNotExists
+	status, _ = preconditionFailure(info, common.EOverwriteOption.True(), string(azblob.ServiceCodeBlobAlreadyExists), http.StatusConflict, common.ETransferStatus.Failed(), "409")
+	c.Assert(status, chk.Equals, common.ETransferStatus.PreconditionFailed())
+
+	// a file sent in one request is not looked up first, so each existing blob costs just the one refused request
+	c.Assert(shouldCheckDestinationExists(ifNotExists, 1), chk.Equals, false)
+	c.Assert(shouldCheckDestinationExists(ifNotExists, 2), chk.Equals, true)
+	c.Assert(shouldCheckDestinationExists(common.EOverwriteOption.False(), 1), chk.Equals, true)
+	c.Assert(shouldCheckDestinationExists(common.EOverwriteOption.True(), 1), chk.Equals, false)
+	c.Assert(shouldCheckDestinationExists(common.EOverwriteOption.Append(), 1), chk.Equals, false)
+}
+
+func (s *destAccessConditionsSuite) TestDstAccessConditionsInPlan(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	order := newTestOrder(common.NewJobID(), 0, "/a", "/b", "/c")
+	order.Transfers[1].BlobTags = common.BlobTags{"k": "v"}
+	order.Transfers[1].DestIfMatch = "0x8D9"
+	order.Transfers[2].DestIfNoneMatch = "*"
+	mmf := createTestPlanFile(order).Map()
+	defer mmf.Unmap()
+	plan := mmf.Plan()
+
+	ifMatch, ifNoneMatch := plan.TransferDstAccessConditions(0)
+	c.Assert(ifMatch, chk.Equals, "")
+	c.Assert(ifNoneMatch, chk.Equals, "")
+	ifMatch, ifNoneMatch = plan.TransferDstAccessConditions(1)
+	c.Assert(ifMatch, chk.Equals, "0x8D9")
+	c.Assert(ifNoneMatch, chk.Equals, "")
+	ifMatch, ifNoneMatch = plan.TransferDstAccessConditions(2)
+	c.Assert(ifMatch, chk.Equals, "")
+	c.Assert(ifNoneMatch, chk.Equals, "*")
+
+	// the strings that come before the conditions are still read correctly
+	src, dst, _ := plan.TransferSrcDstStrings(1)
+	c.Assert(strings.HasSuffix(src, "/b"), chk.Equals, true)
+	c.Assert(strings.HasSuffix(dst, "/b"), chk.Equals, true)
+	_, _, _, _, _, _, _, _, _, _, blobTags, _ := plan.TransferSrcPropertiesAndMetadata(1)
+	c.Assert(blobTags, chk.DeepEquals, common.BlobTags{"k": "v"})
+}
+
+// allowOpenFiles stops uploads from waiting for the E2E tests' signal to open their source files, which is only ever needed once
+var allowOpenFiles sync.Once
+
+func (s *destAccessConditionsSuite) TestIfNotExistsUploadIsRefusedInOneRequest(c *chk.C) {
+	allowOpenFiles.Do(func() { common.GetLifecycleMgr().E2EEnableAwaitAllowOpenFiles(false) })
+
+	// a service that holds every blob already
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		c.Check(r.Method, chk.Equals, http.MethodPut)
+		c.Check(r.Header.Get("If-None-Match"), chk.Equals, "*")
+		w.Header().Set("x-ms-error-code", string(azblob.ServiceCodeBlobAlreadyExists))
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	chunks := make(chan chunkFunc, 1)
+	defer useTestJobsAdmin(c, &jobsAdmin{xferChannels: XferChannels{normalChunckCh: chunks}})()
+
+	// the upload of a file small enough to be sent in one request
+	path := writeSourceFile(c, "data")
+	jobID := common.NewJobID()
+	mmf := createTestPlanFile(common.CopyJobPartOrderRequest{
+		JobID:           jobID,
+		IsFinalPart:     true,
+		FromTo:          common.EFromTo.LocalBlob(),
+		ForceWrite:      common.EOverwriteOption.IfNotExists(),
+		SourceRoot:      common.ResourceString{Value: filepath.Dir(path)},
+		DestinationRoot: common.ResourceString{Value: server.URL + "/container"},
+		Transfers:       []common.CopyTransfer{{Source: "/file.txt", Destination: "/file.txt", EntityType: common.EEntityType.File(), SourceSize: 4}},
+	}).Map()
+	defer mmf.Unmap()
+
+	jm := &jobMgr{logger: discardingJobLogger{}, jobPartProgress: make(chan jobPartProgressInfo, 1),
+		chunkStatusLogger: common.NewChunkStatusLogger(jobID, common.NewNullCpuMonitor(), "", false), planFlusher: newPlanFlusher(func() {}, 0, 0)}
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: mmf, jobCtx: context.Background(), slicePool: common.NewMultiSizeSlicePool(common.MaxBlockBlobBlockSize),
+		cacheLimiter: common.NewCacheLimiter(64 * 1024 * 1024), exclusiveDestinationMap: common.NewExclusiveStringMap(common.EFromTo.LocalBlob(), runtime.GOOS)}
+	jptm := jpm.newTransferMgr(jpm.jobCtx, 0)
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+
+	// the destination isn't looked up first, and the service's refusal to write over it skips the transfer
+	computeJobXfer(common.EFromTo.LocalBlob(), common.EBlobType.Detect())(jptm, p, newNullAutoPacer())
+	(<-chunks)(0)
+	c.Assert(atomic.LoadInt32(&requests), chk.Equals, int32(1))
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.SkippedEntityAlreadyExists())
+	c.Assert((<-jm.jobPartProgress).transfersSkipped, chk.Equals, 1)
+}
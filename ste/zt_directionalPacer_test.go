@@ -0,0 +1,130 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type directionalPacerTestSuite struct{}
+
+var _ = chk.Suite(&directionalPacerTestSuite{})
+
+func newJobsAdminForDirectionalPacerTest() *jobsAdmin {
+	return &jobsAdmin{pacer: newTokenBucketPacer(0, 0), uploadPacer: newTokenBucketPacer(0, 0), downloadPacer: newTokenBucketPacer(0, 0)}
+}
+
+func (ja *jobsAdmin) closePacersForTest() {
+	_ = ja.pacer.Close()
+	_ = ja.uploadPacer.Close()
+	_ = ja.downloadPacer.Close()
+}
+
+func (s *directionalPacerTestSuite) TestMixedWorkloadRespectsEachDirectionsCap(c *chk.C) {
+	const uploadBytesPerSecond = 1000 * 1000 // 8 Mbps
+	const downloadBytesPerSecond = 3 * uploadBytesPerSecond
+	const requestSize = 32 * 1024
+	const numWorkersPerDirection = 4
+	const testDuration = 2 * time.Second
+
+	ja := newJobsAdminForDirectionalPacerTest()
+	defer ja.closePacersForTest()
+	ja.SetDirectionalBandwidthCap(common.ETransferDirection.Upload(), 8)
+	ja.SetDirectionalBandwidthCap(common.ETransferDirection.Download(), 24)
+	c.Assert(ja.DirectionalBandwidthCap(common.ETransferDirection.Upload()), chk.Equals, float64(8))
+	c.Assert(ja.DirectionalBandwidthCap(common.ETransferDirection.Download()), chk.Equals, float64(24))
+	// setting a directional cap must not have been mistaken for an aggregate one
+	c.Assert(ja.BandwidthCap(), chk.Equals, float64(0))
+
+	uploads := ja.pacerFor(common.EFromTo.LocalBlob())
+	downloads := ja.pacerFor(common.EFromTo.BlobLocal())
+
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numWorkersPerDirection; i++ {
+		for _, p := range []pacer{uploads, downloads} {
+			wg.Add(1)
+			go func(p pacer) {
+				defer wg.Done()
+				for p.RequestTrafficAllocation(ctx, requestSize) == nil {
+				}
+			}(p)
+		}
+	}
+	wg.Wait()
+	elapsedSeconds := time.Since(start).Seconds()
+
+	for _, d := range []struct {
+		name           string
+		p              *tokenBucketPacer
+		bytesPerSecond float64
+	}{
+		{"uploads", ja.uploadPacer, uploadBytesPerSecond},
+		{"downloads", ja.downloadPacer, downloadBytesPerSecond},
+	} {
+		// allow for the initial seeding of the bucket, on top of what the rate allows
+		ceiling := int64(d.bytesPerSecond*elapsedSeconds + d.bytesPerSecond/4)
+		total := d.p.GetTotalTraffic()
+		c.Assert(total <= ceiling, chk.Equals, true, chk.Commentf("%s were issued %d bytes, but their ceiling was %d", d.name, total, ceiling))
+		c.Assert(total >= ceiling/2, chk.Equals, true, chk.Commentf("%s were issued only %d bytes, expected close to %d", d.name, total, ceiling))
+	}
+
+	// the aggregate pacer still counts the traffic of both directions
+	c.Assert(ja.BytesOverWire(), chk.Equals, ja.uploadPacer.GetTotalTraffic()+ja.downloadPacer.GetTotalTraffic())
+}
+
+func (s *directionalPacerTestSuite) TestOneDirectionIsNotThrottledByTheOthersCap(c *chk.C) {
+	ja := newJobsAdminForDirectionalPacerTest()
+	defer ja.closePacersForTest()
+	// so slow that no upload will get through
+	ja.uploadPacer.setTargetBytesPerSecond(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Assert(ja.pacerFor(common.EFromTo.BlobLocal()).RequestTrafficAllocation(ctx, 1024*1024*1024), chk.IsNil)
+	c.Assert(ja.pacerFor(common.EFromTo.BlobBlob()).RequestTrafficAllocation(ctx, 1024*1024*1024), chk.IsNil)
+	c.Assert(ja.pacerFor(common.EFromTo.LocalBlob()).RequestTrafficAllocation(ctx, 1024*1024), chk.NotNil)
+
+	// the upload that didn't get through isn't counted
+	c.Assert(ja.uploadPacer.GetTotalTraffic(), chk.Equals, int64(0))
+	c.Assert(ja.BytesOverWire(), chk.Equals, int64(2*1024*1024*1024))
+}
+
+func (s *directionalPacerTestSuite) TestAggregateCapAppliesToBothDirections(c *chk.C) {
+	ja := newJobsAdminForDirectionalPacerTest()
+	defer ja.closePacersForTest()
+	ja.pacer.setTargetBytesPerSecond(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	c.Assert(ja.pacerFor(common.EFromTo.BlobLocal()).RequestTrafficAllocation(ctx, 1024*1024), chk.NotNil)
+
+	// what the download took from its own direction's pacer was given back when the aggregate pacer refused it
+	c.Assert(ja.downloadPacer.GetTotalTraffic(), chk.Equals, int64(0))
+}
@@ -0,0 +1,48 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type dryRunSuite struct{}
+
+var _ = chk.Suite(&dryRunSuite{})
+
+func (s *dryRunSuite) TestDryRunJobIsCompletedOncePlanned(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	plan := jpm.Plan()
+	plan.DryRun = true
+	plan.SetJobStatus(common.EJobStatus.InProgress())
+
+	before := time.Now()
+	completeDryRunJob(jm)
+	c.Assert(plan.JobStatus(), chk.Equals, common.EJobStatus.Completed())
+	// so that the plan expires, like that of any other finished job
+	c.Assert(plan.JobCompletionTime().Before(before), chk.Equals, false)
+	c.Assert(plan.JobCompletionTime().After(time.Now()), chk.Equals, false)
+}
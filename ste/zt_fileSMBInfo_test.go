@@ -0,0 +1,96 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-file-go/azfile"
+
+	chk "gopkg.in/check.v1"
+)
+
+type fileSMBInfoSuite struct{}
+
+var _ = chk.Suite(&fileSMBInfoSuite{})
+
+func (s *fileSMBInfoSuite) TestSMBInfoCopiedBetweenShares(c *chk.C) {
+	const (
+		attributes    = "ReadOnly | Hidden | Archive"
+		creationTime  = "2019-03-04T05:06:07.1234567Z"
+		lastWriteTime = "2020-08-09T10:11:12.7654321Z"
+		permissionKey = "4066528134148476695*1"
+	)
+	var created *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("x-ms-file-attributes", attributes)
+			w.Header().Set("x-ms-file-creation-time", creationTime)
+			w.Header().Set("x-ms-file-last-write-time", lastWriteTime)
+			w.Header().Set("x-ms-file-permission-key", permissionKey)
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPut:
+			created = r
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+	p := azfile.NewPipeline(azfile.NewAnonymousCredential(), azfile.PipelineOptions{Retry: azfile.RetryOptions{MaxTries: 1}})
+	ctx := context.WithValue(context.Background(), ServiceAPIVersionOverride, azfile.ServiceVersion)
+
+	srcURL, _ := url.Parse(server.URL + "/account/share/dir/source.txt")
+	dstURL, _ := url.Parse(server.URL + "/account/share/copied.txt")
+	props, err := azfile.NewFileURL(*srcURL, p).GetProperties(ctx)
+	c.Assert(err, chk.IsNil)
+	sip := &fileSourceInfoProvider{ctx: ctx, cacheOnce: &sync.Once{}}
+	sip.cacheOnce.Do(func() { sip.cachedProperties = props }) // as if the source's properties had already been fetched
+
+	info := TransferInfo{
+		Source:                 srcURL.String(),
+		PreserveSMBInfo:        true,
+		PreserveSMBPermissions: common.EPreservePermissionsOption.ACLsOnly(),
+		EntityType:             common.EEntityType.File(),
+	}
+	sender := &azureFileSenderBase{sip: sip}
+	_, err = sender.addPermissionsToHeaders(info, *dstURL)
+	c.Assert(err, chk.IsNil)
+	_, err = sender.addSMBPropertiesToHeaders(info, *dstURL)
+	c.Assert(err, chk.IsNil)
+
+	// within a share, the source's permission is referred to by its key, rather than copied
+	c.Assert(sender.headersToApply.PermissionString, chk.IsNil)
+	c.Assert(*sender.headersToApply.PermissionKey, chk.Equals, permissionKey)
+
+	_, err = azfile.NewFileURL(*dstURL, p).Create(ctx, 0, sender.headersToApply, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(created, chk.NotNil)
+	c.Assert(azfile.ParseFileAttributeFlagsString(created.Header.Get("x-ms-file-attributes")), chk.Equals, azfile.ParseFileAttributeFlagsString(attributes))
+	c.Assert(created.Header.Get("x-ms-file-creation-time"), chk.Equals, creationTime)
+	c.Assert(created.Header.Get("x-ms-file-last-write-time"), chk.Equals, lastWriteTime)
+	c.Assert(created.Header.Get("x-ms-file-permission-key"), chk.Equals, permissionKey)
+	c.Assert(created.Header.Get("x-ms-file-permission"), chk.Equals, "")
+}
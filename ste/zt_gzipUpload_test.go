@@ -0,0 +1,150 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type gzipUploadSuite struct{}
+
+var _ = chk.Suite(&gzipUploadSuite{})
+
+// fakeBlockBlobService keeps the blocks that are staged to it, and assembles the blob that a block list commits
+type fakeBlockBlobService struct {
+	mu            sync.Mutex
+	blocks        map[string][]byte
+	blob          []byte
+	commitHeaders http.Header
+}
+
+func (f *fakeBlockBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Query().Get("comp") {
+	case "block":
+		f.blocks[r.URL.Query().Get("blockid")] = body
+	case "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blob = []byte{}
+		for _, id := range list.Latest {
+			f.blob = append(f.blob, f.blocks[id]...)
+		}
+		f.commitHeaders = r.Header
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func newTestGzipUploader(c *chk.C, serviceURL string, blockSize int64) *blockBlobGzipUploader {
+	jm := &jobMgr{logger: discardingJobLogger{}}
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: newTestPlanMMF(c, newTestPlanWithOneTransfer(0)), slicePool: common.NewMultiSizeSlicePool(blockSize), putMd5: true}
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, jobPartPlanTransfer: jpm.Plan().Transfer(0), ctx: context.Background(), transferInfo: &TransferInfo{JobID: common.NewJobID()}}
+
+	u, _ := url.Parse(serviceURL + "/container/file.log")
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	return &blockBlobGzipUploader{blockBlobSenderBase: blockBlobSenderBase{
+		jptm:             jptm,
+		destBlockBlobURL: azblob.NewBlockBlobURL(*u, p),
+		chunkSize:        blockSize,
+		pacer:            newNullAutoPacer(),
+		muBlockIDs:       &sync.Mutex{},
+	}}
+}
+
+func (s *gzipUploadSuite) TestCompressedBlobDecompressesToOriginal(c *chk.C) {
+	// some data that compresses well, followed by some that doesn't, so that it takes several blocks
+	random := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(random)
+	large := append(bytes.Repeat([]byte("a line of a log file that compresses well\n"), 2000), random...)
+
+	for _, original := range [][]byte{large, {}} {
+		service := &fakeBlockBlobService{blocks: make(map[string][]byte)}
+		server := httptest.NewServer(service)
+
+		u := newTestGzipUploader(c, server.URL, 1024)
+		setPutListNeed(&u.atomicPutListIndicator, putListNeeded)
+		where, err := u.stageCompressedBlocks(common.NewGzipCompressingReader(bytes.NewReader(original)))
+		c.Assert(err, chk.IsNil, chk.Commentf(where))
+		u.Epilogue()
+		server.Close()
+		c.Assert(u.jptm.IsLive(), chk.Equals, true)
+
+		// the blob holds the compressed data, and says so
+		c.Assert(service.commitHeaders, chk.NotNil)
+		c.Assert(service.commitHeaders.Get("x-ms-blob-content-encoding"), chk.Equals, "gzip")
+		c.Assert(int64(len(service.blob)), chk.Equals, u.SentLength())
+		c.Assert(len(service.blocks), chk.Equals, int((u.SentLength()+1023)/1024))
+		hash := md5.Sum(service.blob)
+		c.Assert(service.commitHeaders.Get("x-ms-blob-content-md5"), chk.Equals, base64.StdEncoding.EncodeToString(hash[:]))
+
+		// and decompresses to the original
+		reader, err := gzip.NewReader(bytes.NewReader(service.blob))
+		c.Assert(err, chk.IsNil)
+		decompressed, err := ioutil.ReadAll(reader)
+		c.Assert(err, chk.IsNil)
+		c.Assert(decompressed, chk.DeepEquals, original)
+	}
+}
+
+func (s *gzipUploadSuite) TestShouldGzip(c *chk.C) {
+	d := JobPartPlanDstBlob{}
+	c.Assert(d.shouldGzip(100, "/data/app.log"), chk.Equals, false)
+
+	d.GzipUpload = true
+	c.Assert(d.shouldGzip(0, "/data/app.log"), chk.Equals, true)
+
+	d.GzipMinSize = 100
+	c.Assert(d.shouldGzip(99, "/data/app.log"), chk.Equals, false)
+	c.Assert(d.shouldGzip(100, "/data/app.log"), chk.Equals, true)
+
+	d.GzipExtensionsLength = uint16(copy(d.GzipExtensions[:], ".log;.json"))
+	c.Assert(d.shouldGzip(100, "/data/APP.LOG"), chk.Equals, true)
+	c.Assert(d.shouldGzip(100, "/data/app.json"), chk.Equals, true)
+	c.Assert(d.shouldGzip(100, "/data/app.jpg"), chk.Equals, false)
+	c.Assert(d.shouldGzip(100, "/data/log"), chk.Equals, false)
+}
@@ -0,0 +1,141 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type hashMatchSuite struct{}
+
+var _ = chk.Suite(&hashMatchSuite{})
+
+// tempFileSourceInfoProvider is just enough of a local source info provider to open a file
+type tempFileSourceInfoProvider struct {
+	ISourceInfoProvider
+	path string
+}
+
+func (p tempFileSourceInfoProvider) OpenSourceFile() (common.CloseableReaderAt, error) {
+	return os.Open(p.path)
+}
+
+func (p tempFileSourceInfoProvider) IsLocal() bool {
+	return true
+}
+
+func (p tempFileSourceInfoProvider) GetFreshFileLastModifiedTime() (time.Time, error) {
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (s *hashMatchSuite) TestHashLocalSource(c *chk.C) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	f, err := ioutil.TempFile("", "hashMatch")
+	c.Assert(err, chk.IsNil)
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	c.Assert(err, chk.IsNil)
+	c.Assert(f.Close(), chk.IsNil)
+
+	sip := tempFileSourceInfoProvider{path: f.Name()}
+
+	hash, err := hashLocalSource(sip, int64(len(data)), common.EHashAlgorithm.MD5())
+	c.Assert(err, chk.IsNil)
+	md5Hash := md5.Sum(data)
+	c.Assert(hash, chk.DeepEquals, md5Hash[:])
+
+	hash, err = hashLocalSource(sip, int64(len(data)), common.EHashAlgorithm.SHA256())
+	c.Assert(err, chk.IsNil)
+	sha256Hash := sha256.Sum256(data)
+	c.Assert(hash, chk.DeepEquals, sha256Hash[:])
+
+	// only the data that was there when the transfer was planned is hashed
+	hash, err = hashLocalSource(sip, 3, common.EHashAlgorithm.MD5())
+	c.Assert(err, chk.IsNil)
+	md5Hash = md5.Sum(data[:3])
+	c.Assert(hash, chk.DeepEquals, md5Hash[:])
+
+	_, err = hashLocalSource(tempFileSourceInfoProvider{path: f.Name() + "-missing"}, 0, common.EHashAlgorithm.MD5())
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *hashMatchSuite) TestRecordedHashIsOnlyUsedForTheSourceItWasTakenFrom(c *chk.C) {
+	data := []byte("twenty bytes of data")
+	path := c.MkDir() + "/file"
+	c.Assert(ioutil.WriteFile(path, data, 0644), chk.IsNil)
+	fi, err := os.Stat(path)
+	c.Assert(err, chk.IsNil)
+	sourceHash := md5.Sum(data)
+
+	// the destination blob holds the same data
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.Header().Set("Content-Length", "20")
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sourceHash[:]))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+
+	jpm, jptm := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	info := jptm.Info()
+	info.Destination = server.URL + "/container/file"
+	sip := tempFileSourceInfoProvider{path: path}
+	otherHash := make([]byte, md5.Size)
+	otherHash[0] = 1
+
+	// a hash that an earlier run recorded for the file as it is now is used, rather than reading the file again
+	jptm.SetContentDigest(otherHash, fi.ModTime(), 20)
+	matches, err := destinationHashMatchesSource(jptm, info, p, sip)
+	c.Assert(err, chk.IsNil)
+	c.Assert(matches, chk.Equals, false)
+
+	// but one recorded before the file was last changed is not
+	for _, changed := range []struct {
+		lastModifiedTime time.Time
+		size             int64
+	}{{fi.ModTime().Add(-time.Hour), 20}, {fi.ModTime(), 19}} {
+		jptm.SetContentDigest(otherHash, changed.lastModifiedTime, changed.size)
+		c.Assert(jptm.ContentDigestFor(fi.ModTime(), 20), chk.IsNil)
+		matches, err = destinationHashMatchesSource(jptm, info, p, sip)
+		c.Assert(err, chk.IsNil)
+		c.Assert(matches, chk.Equals, true)
+		c.Assert(jptm.ContentDigestFor(fi.ModTime(), 20), chk.DeepEquals, sourceHash[:])
+	}
+}
@@ -0,0 +1,906 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type jobPartPlanTestSuite struct{}
+
+var _ = chk.Suite(&jobPartPlanTestSuite{})
+
+func (s *jobPartPlanTestSuite) TestChunkBitmap(c *chk.C) {
+	jpph := newTestPlanWithOneTransfer(2)
+	lastTrackable := int32((chunkBitmapInlineWords+2)*64 - 1)
+
+	for _, chunk := range []int32{0, 63, 64, chunkBitmapInlineWords * 64, lastTrackable} {
+		c.Assert(jpph.IsChunkDone(0, chunk), chk.Equals, false)
+		jpph.SetChunkDone(0, chunk)
+		c.Assert(jpph.IsChunkDone(0, chunk), chk.Equals, true)
+	}
+	c.Assert(jpph.IsChunkDone(0, 1), chk.Equals, false)
+
+	// chunks beyond the overflow region are not tracked
+	jpph.SetChunkDone(0, lastTrackable+1)
+	c.Assert(jpph.IsChunkDone(0, lastTrackable+1), chk.Equals, false)
+
+	jpph.ResetChunkBitmap(0, 1024)
+	c.Assert(jpph.ChunkBlockSize(0), chk.Equals, int64(1024))
+	for _, chunk := range []int32{0, 63, 64, chunkBitmapInlineWords * 64, lastTrackable} {
+		c.Assert(jpph.IsChunkDone(0, chunk), chk.Equals, false)
+	}
+}
+
+func (s *jobPartPlanTestSuite) TestErrorMessage(c *chk.C) {
+	headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+	transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+	jpph, _ := newTestPlanBuffer(headerSize + transferSize + ErrorMessageMaxBytes)
+	jpph.NumTransfers = 1
+	jpph.Transfer(0).ErrorMessageOffset = int64(headerSize + transferSize)
+
+	c.Assert(jpph.ErrorMessage(0), chk.Equals, "")
+	jpph.SetErrorMessage(0, "403 This request is not authorized to perform this operation.")
+	c.Assert(jpph.ErrorMessage(0), chk.Equals, "403 This request is not authorized to perform this operation.")
+
+	// a later, shorter, reason replaces the earlier one entirely
+	jpph.SetErrorMessage(0, "timeout")
+	c.Assert(jpph.ErrorMessage(0), chk.Equals, "timeout")
+
+	long := strings.Repeat("é", ErrorMessageMaxBytes)
+	jpph.SetErrorMessage(0, long)
+	msg := jpph.ErrorMessage(0)
+	c.Assert(len(msg) <= ErrorMessageMaxBytes, chk.Equals, true)
+	c.Assert(strings.HasSuffix(msg, "..."), chk.Equals, true)
+	c.Assert(utf8.ValidString(msg), chk.Equals, true)
+
+	jpph.SetErrorMessage(0, "")
+	c.Assert(jpph.ErrorMessage(0), chk.Equals, "")
+}
+
+func (s *jobPartPlanTestSuite) TestDestVersionID(c *chk.C) {
+	headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+	transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+	jpph, _ := newTestPlanBuffer(headerSize + transferSize + DestVersionIDMaxBytes)
+	jpph.NumTransfers = 1
+
+	// without reserved space (i.e. the destination isn't a blob), nothing is recorded
+	jpph.SetDestVersionID(0, "2020-10-22T07:48:06.1234567Z")
+	c.Assert(jpph.DestVersionID(0), chk.Equals, "")
+
+	jpph.Transfer(0).DestVersionIDOffset = int64(headerSize + transferSize)
+	jpph.SetDestVersionID(0, "2020-10-22T07:48:06.1234567Z")
+	c.Assert(jpph.DestVersionID(0), chk.Equals, "2020-10-22T07:48:06.1234567Z")
+
+	// a version ID that doesn't fit is not recorded, rather than being cut short
+	jpph.SetDestVersionID(0, strings.Repeat("v", DestVersionIDMaxBytes+1))
+	c.Assert(jpph.DestVersionID(0), chk.Equals, "2020-10-22T07:48:06.1234567Z")
+
+	jpph.SetDestVersionID(0, "")
+	c.Assert(jpph.DestVersionID(0), chk.Equals, "")
+}
+
+func (s *jobPartPlanTestSuite) TestGetChunkBitmapOverflowWords(c *chk.C) {
+	blockSize := int64(common.DefaultBlockBlobBlockSize)
+	small := common.CopyTransfer{EntityType: common.EEntityType.File(), SourceSize: blockSize * chunkBitmapInlineWords * 64}
+	large := common.CopyTransfer{EntityType: common.EEntityType.File(), SourceSize: small.SourceSize + 1}
+
+	c.Assert(getChunkBitmapOverflowWords(common.EFromTo.LocalBlob(), small, blockSize), chk.Equals, uint32(0))
+	c.Assert(getChunkBitmapOverflowWords(common.EFromTo.LocalBlob(), large, blockSize), chk.Equals, uint32(1))
+	c.Assert(getChunkBitmapOverflowWords(common.EFromTo.BlobLocal(), large, blockSize), chk.Equals, uint32(1))
+	c.Assert(getChunkBitmapOverflowWords(common.EFromTo.BlobFile(), large, blockSize), chk.Equals, uint32(0))
+}
+
+func (s *jobPartPlanTestSuite) TestTransferTimes(c *chk.C) {
+	jppt := newTestPlanWithOneTransfer(0).Transfer(0)
+
+	// a transfer from an older plan file, or one that never ran, has no times
+	c.Assert(jppt.StartTime().IsZero(), chk.Equals, true)
+	_, ok := jppt.Duration()
+	c.Assert(ok, chk.Equals, false)
+
+	firstRun := time.Now()
+	jppt.SetStartTimeIfNotStarted(firstRun)
+	jppt.SetCompletionTime(firstRun.Add(time.Second))
+
+	// a resumed transfer keeps the start time of its first run
+	jppt.SetStartTimeIfNotStarted(firstRun.Add(time.Hour))
+	jppt.SetCompletionTime(firstRun.Add(time.Hour + time.Second))
+	c.Assert(jppt.StartTime().Equal(firstRun), chk.Equals, true)
+	d, ok := jppt.Duration()
+	c.Assert(ok, chk.Equals, true)
+	c.Assert(d, chk.Equals, time.Hour+time.Second)
+}
+
+func (s *jobPartPlanTestSuite) TestMaxTransferRetries(c *chk.C) {
+	jpph := newTestPlanWithOneTransfer(0)
+	jppt := jpph.Transfer(0)
+
+	// a plan that doesn't choose gets the engine default
+	jpph.MaxRetries = -1
+	c.Assert(jpph.MaxTransferRetries(), chk.Equals, uint32(TransferMaxRetries))
+
+	// one that chooses none never retries
+	jpph.MaxRetries = 0
+	c.Assert(jpph.MaxTransferRetries(), chk.Equals, uint32(0))
+	c.Assert(jppt.TryStartRetry(jpph.MaxTransferRetries()), chk.Equals, false)
+
+	jpph.MaxRetries = 2
+	c.Assert(jpph.MaxTransferRetries(), chk.Equals, uint32(2))
+	c.Assert(jppt.TryStartRetry(jpph.MaxTransferRetries()), chk.Equals, true)
+	c.Assert(jppt.TryStartRetry(jpph.MaxTransferRetries()), chk.Equals, true)
+	c.Assert(jppt.TryStartRetry(jpph.MaxTransferRetries()), chk.Equals, false)
+	c.Assert(jppt.RetryCount(), chk.Equals, uint32(2))
+}
+
+func (s *jobPartPlanTestSuite) TestRecordSourceChange(c *chk.C) {
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.TotalBytes = 1000
+	jppt := jpph.Transfer(0)
+	jppt.SourceSize = 100
+	jppt.ModifiedTime = time.Unix(1, 0).UnixNano()
+
+	// a file that grew adds to the part's total, and later checks compare against what it is now
+	lmt := time.Unix(2, 0)
+	jpph.RecordSourceChange(0, lmt, 150)
+	c.Assert(jppt.SourceSize, chk.Equals, int64(150))
+	c.Assert(jppt.ModifiedTime, chk.Equals, lmt.UnixNano())
+	c.Assert(jpph.TotalBytes, chk.Equals, uint64(1050))
+
+	// and one that shrank takes from it
+	jpph.RecordSourceChange(0, lmt, 20)
+	c.Assert(jppt.SourceSize, chk.Equals, int64(20))
+	c.Assert(jpph.TotalBytes, chk.Equals, uint64(920))
+}
+
+func (s *jobPartPlanTestSuite) TestBytesCompleted(c *chk.C) {
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.TotalBytes = 1000
+	jppt := jpph.Transfer(0)
+	jppt.EntityType = common.EEntityType.File()
+	jppt.SourceSize = 1000
+
+	// chunks count as they are done, and a transfer that fails takes its chunks back out, although they were transferred
+	jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+	jppt.AddAttemptBytes(400)
+	c.Assert(jpph.BytesCompleted(), chk.Equals, uint64(400))
+	c.Assert(jpph.BytesTransferred(), chk.Equals, uint64(400))
+	jppt.SetTransferStatus(common.ETransferStatus.Failed(), true)
+	jpph.EndTransferAttempt(0)
+	c.Assert(jpph.BytesCompleted(), chk.Equals, uint64(0))
+	c.Assert(jpph.BytesTransferred(), chk.Equals, uint64(400))
+
+	// a transfer that is done counts in full, however much of it was sent
+	jppt.SetTransferStatus(common.ETransferStatus.Started(), true)
+	jppt.AddAttemptBytes(300)
+	jppt.SetTransferStatus(common.ETransferStatus.SkippedEntityAlreadyExists(), true)
+	jpph.EndTransferAttempt(0)
+	c.Assert(jpph.BytesCompleted(), chk.Equals, uint64(1000))
+	c.Assert(jpph.BytesTransferred(), chk.Equals, uint64(700))
+
+	c.Assert(bytesPercentComplete(250, 1000), chk.Equals, float32(25))
+	c.Assert(bytesPercentComplete(0, 0), chk.Equals, float32(100))
+}
+
+func (s *jobPartPlanTestSuite) TestTransferBytesSurvivePauseAndResume(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// a part with a single file of 1000 bytes, on disk as the engine would have written it
+	jobID := common.NewJobID()
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.Version = DataSchemaVersion
+	jpph.TotalBytes = 1000
+	jpph.Transfer(0).EntityType = common.EEntityType.File()
+	jpph.Transfer(0).SourceSize = 1000
+	planFile := writeTestPlanFile(c, jobID, 0, testPlanBytes(jpph, testPlanSize(jpph)))
+
+	startRun := func() (*JobPartPlanMMF, *jobPartTransferMgr) {
+		mmf := planFile.Map()
+		jpm := &jobPartMgr{planMMF: mmf}
+		jptm := &jobPartTransferMgr{jobPartMgr: jpm, jobPartPlanTransfer: mmf.Plan().Transfer(0), ctx: context.Background(), numChunks: 10}
+		// as StartJobXfer does, when the transfer starts
+		mmf.Plan().DiscardTransferAttempt(0)
+		return mmf, jptm
+	}
+	reportChunks := func(jptm *jobPartTransferMgr, from, to int64) {
+		for offset := from; offset < to; offset += 100 {
+			jptm.ReportChunkDone(common.NewChunkID("file", offset, 100))
+		}
+	}
+
+	// the first run gets through 300 bytes before the job is paused
+	mmf, jptm := startRun()
+	reportChunks(jptm, 0, 300)
+	c.Assert(mmf.Plan().Transfer(0).AttemptBytes(), chk.Equals, uint64(300))
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(300))
+	mmf.Plan().Transfer(0).SetTransferStatus(common.ETransferStatus.Paused(), false)
+	mmf.Unmap()
+
+	// on resume, the bytes that the transfer had done still count
+	mmf = planFile.Map()
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(300))
+	c.Assert(bytesPercentComplete(mmf.Plan().BytesCompleted(), mmf.Plan().TotalBytes), chk.Equals, float32(30))
+	mmf.Unmap()
+
+	// a transfer that resumes from what it saved carries on from there, rather than counting those bytes twice
+	mmf, jptm = startRun()
+	jptm.ReportResumedBytes(300)
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(300))
+	reportChunks(jptm, 300, 500)
+	c.Assert(mmf.Plan().Transfer(0).AttemptBytes(), chk.Equals, uint64(500))
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(500))
+	c.Assert(mmf.Plan().BytesTransferred(), chk.Equals, uint64(500))
+	mmf.Unmap()
+
+	// whereas one that starts again from the beginning counts from zero
+	mmf, jptm = startRun()
+	defer mmf.Unmap()
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(0))
+	reportChunks(jptm, 0, 200)
+	c.Assert(mmf.Plan().Transfer(0).AttemptBytes(), chk.Equals, uint64(200))
+	c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(200))
+}
+
+func (s *jobPartPlanTestSuite) TestPausingAndResumingTwiceCountsSavedBytesOnce(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// an upload of 1000 bytes, in chunks of 100, and a download of 1000 bytes, which resumes from the start of the file it saved
+	order := newTestOrder(common.NewJobID(), 0, "/upload", "/download")
+	const upload, download = 0, 1
+	order.Transfers[upload].SourceSize = 1000
+	order.Transfers[download].SourceSize = 1000
+	planFile := createTestPlanFile(order)
+
+	// each run starts both transfers (as StartJobXfer does), skips what the earlier runs saved, sends another 200 bytes of each,
+	// and is paused. saved is how much of each transfer the earlier runs saved
+	run := func(saved int64) *JobPartPlanMMF {
+		mmf := planFile.Map()
+		jpm := &jobPartMgr{planMMF: mmf}
+		for _, t := range []uint32{upload, download} {
+			mmf.Plan().DiscardTransferAttempt(t)
+			jptm := &jobPartTransferMgr{jobPartMgr: jpm, jobPartPlanTransfer: mmf.Plan().Transfer(t), ctx: context.Background(), numChunks: 10}
+			offset := int64(0)
+			if t == download {
+				jptm.ReportResumedBytes(saved)
+				offset = saved
+			}
+			// the upload's sender reports the chunks it skips as done, as well as those it sends
+			for ; offset < saved+200; offset += 100 {
+				jptm.ReportChunkDone(common.NewChunkID("file", offset, 100))
+			}
+			mmf.Plan().Transfer(t).SetTransferStatus(common.ETransferStatus.Paused(), false)
+		}
+		return mmf
+	}
+
+	for i, saved := range []int64{0, 200, 400} {
+		mmf := run(saved)
+		// there's no growth from counting what was saved again, however often the job is paused and resumed
+		c.Assert(mmf.Plan().BytesTransferred(), chk.Equals, uint64(2*(saved+200)), chk.Commentf("run %d", i))
+		c.Assert(mmf.Plan().BytesCompleted(), chk.Equals, uint64(2*(saved+200)), chk.Commentf("run %d", i))
+		mmf.Unmap()
+	}
+
+	// so the job's MaxTotalBytes, on its next run, starts from what it really has saved
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr()}
+	jm.jobPartMgrs.Set(0, &jobPartMgr{planMMF: mmf})
+	jm.resetBytesReserved()
+	c.Assert(jm.atomicBytesReserved, chk.Equals, uint64(1200))
+}
+
+func (s *jobPartPlanTestSuite) TestListJobPlans(c *chk.C) {
+	planDir := c.MkDir()
+	defer useTestJobsAdmin(c, &jobsAdmin{planDir: planDir})()
+
+	// a complete job, with two parts
+	completeJob := common.NewJobID()
+	for partNum := common.PartNumber(0); partNum < 2; partNum++ {
+		jpph := newTestPlanWithOneTransfer(0)
+		jpph.Version = DataSchemaVersion
+		jpph.StartTime = time.Now().UnixNano()
+		jpph.SetJobStatus(common.EJobStatus.Completed())
+		jpph.AddBytesTransferred(100)
+		jpph.AddElapsedTime(time.Second)
+		writeTestPlanFile(c, completeJob, partNum, testPlanBytes(jpph, testPlanSize(jpph)))
+	}
+
+	// a job whose only plan file was cut short while being written
+	partialJob := common.NewJobID()
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.Version = DataSchemaVersion
+	partialPlanFile := writeTestPlanFile(c, partialJob, 0, testPlanBytes(jpph, 100))
+	// with no readable start time, the job is as old as its file
+	anHourAgo := time.Now().Add(-time.Hour)
+	c.Assert(os.Chtimes(partialPlanFile.GetJobPartPlanPath(), anHourAgo, anHourAgo), chk.IsNil)
+
+	// files that aren't plan files at all are ignored
+	c.Assert(ioutil.WriteFile(filepath.Join(planDir, fmt.Sprintf("junk.steV%d", DataSchemaVersion)), nil, 0644), chk.IsNil)
+
+	jobs := JobsAdmin.ListJobPlans()
+	c.Assert(jobs, chk.HasLen, 2)
+	// newest first
+	c.Assert(jobs[0].JobId, chk.Equals, completeJob)
+	c.Assert(jobs[0].JobStatus, chk.Equals, common.EJobStatus.Completed())
+	c.Assert(jobs[0].NumTransfers, chk.Equals, uint32(2))
+	c.Assert(jobs[0].BytesTransferred, chk.Equals, uint64(200))
+	c.Assert(jobs[0].ElapsedSeconds, chk.Equals, float64(1)) // only part 0 counts the job's elapsed time
+	c.Assert(jobs[1].JobId, chk.Equals, partialJob)
+	c.Assert(jobs[1].JobStatus, chk.Equals, common.EJobStatus.Unknown())
+	c.Assert(jobs[1].NumTransfers, chk.Equals, uint32(0))
+}
+
+func (s *jobPartPlanTestSuite) TestPlanFilesInSharedFolder(c *chk.C) {
+	planDir := filepath.Join(c.MkDir(), "shared", "plans")
+	defer useTestJobsAdmin(c, &jobsAdmin{planDir: planDir})()
+	ja := JobsAdmin.(*jobsAdmin)
+
+	// a folder that doesn't exist (yet) has no plan files, rather than being an error
+	c.Assert(ja.planFilesInFolder(""), chk.HasLen, 0)
+	c.Assert(ja.ResurrectJob(common.NewJobID(), "", ""), chk.Equals, false)
+	c.Assert(os.MkdirAll(planDir, os.ModePerm), chk.IsNil)
+
+	planFileName := func(jobID common.JobID, partNum common.PartNumber) string {
+		return fmt.Sprintf(jobPartPlanFileNameFormat, jobID.String(), partNum, DataSchemaVersion)
+	}
+	jobID := common.NewJobID()
+	for partNum := common.PartNumber(0); partNum < 2; partNum++ {
+		c.Assert(ioutil.WriteFile(filepath.Join(planDir, planFileName(jobID, partNum)), nil, 0644), chk.IsNil)
+	}
+
+	// what other azcopy processes might leave in the folder is ignored:
+	// a plan that is still being written,
+	otherJobID := common.NewJobID()
+	c.Assert(ioutil.WriteFile(filepath.Join(planDir, planFileName(otherJobID, 0)+jobPartPlanTempFileSuffix), nil, 0644), chk.IsNil)
+	// a plan file that has gone, leaving a dangling link to it,
+	c.Assert(os.Symlink(filepath.Join(planDir, "gone"), filepath.Join(planDir, planFileName(otherJobID, 1))), chk.IsNil)
+	// and anything in a subfolder
+	c.Assert(os.Mkdir(filepath.Join(planDir, "nested"), os.ModePerm), chk.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(planDir, "nested", planFileName(otherJobID, 2)), nil, 0644), chk.IsNil)
+
+	files := ja.planFilesInFolder("")
+	c.Assert(files, chk.HasLen, 2)
+	files, err := ja.jobPlanFiles(jobID)
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 2)
+	c.Assert(files[0].Name(), chk.Equals, planFileName(jobID, 0))
+	c.Assert(files[1].Name(), chk.Equals, planFileName(jobID, 1))
+	_, err = ja.jobPlanFiles(otherJobID)
+	c.Assert(err, chk.NotNil)
+}
+
+func (s *jobPartPlanTestSuite) TestWalkJobTransfers(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// each part holds one transfer, followed by its failure reason and its src/dst strings
+	jobID := common.NewJobID()
+	sourceModifiedTime := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	writePart := func(partNum common.PartNumber, src, dst string, status common.TransferStatus, errorMessage string) {
+		headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+		transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+		size := headerSize + transferSize + ErrorMessageMaxBytes + uintptr(len(src)+len(dst))
+		jpph, contents := newTestPlanBuffer(size)
+		jpph.Version = DataSchemaVersion
+		jpph.NumTransfers = 1
+		jppt := jpph.Transfer(0)
+		jppt.ErrorMessageOffset = int64(headerSize + transferSize)
+		jppt.SrcOffset = jppt.ErrorMessageOffset + ErrorMessageMaxBytes
+		jppt.SrcLength = int16(len(src))
+		jppt.DstLength = int16(len(dst))
+		jppt.SourceSize = 1234
+		jppt.ModifiedTime = sourceModifiedTime.UnixNano()
+		jppt.SetTransferStatus(status, true)
+		jpph.SetErrorMessage(0, errorMessage)
+		copy(contents[jppt.SrcOffset:], src+dst)
+		writeTestPlanFile(c, jobID, partNum, contents)
+	}
+	writePart(1, "src1", "dst1", common.ETransferStatus.Success(), "")
+	writePart(0, "src0", "dst0", common.ETransferStatus.BlobTierFailure(), "403 AuthorizationFailure")
+
+	var details []common.TransferDetail
+	collect := func(t common.TransferDetail) error {
+		details = append(details, t)
+		return nil
+	}
+
+	c.Assert(JobsAdmin.WalkJobTransfers(jobID, common.ETransferStatus.Failed(), collect), chk.IsNil)
+	c.Assert(details, chk.HasLen, 1)
+	c.Assert(strings.HasSuffix(details[0].Src, "src0"), chk.Equals, true)
+	c.Assert(strings.HasSuffix(details[0].Dst, "dst0"), chk.Equals, true)
+	c.Assert(details[0].SourceSize, chk.Equals, int64(1234))
+	c.Assert(details[0].SourceModifiedTime, chk.DeepEquals, sourceModifiedTime)
+	c.Assert(details[0].ErrorMessage, chk.Equals, "403 AuthorizationFailure")
+
+	// all transfers, in order of part number
+	details = nil
+	c.Assert(JobsAdmin.WalkJobTransfers(jobID, common.ETransferStatus.All(), collect), chk.IsNil)
+	c.Assert(details, chk.HasLen, 2)
+	c.Assert(strings.HasSuffix(details[1].Src, "src1"), chk.Equals, true)
+
+	// walking stops at the first error from visit
+	stop := fmt.Errorf("stop")
+	visited := 0
+	err := JobsAdmin.WalkJobTransfers(jobID, common.ETransferStatus.All(), func(common.TransferDetail) error {
+		visited++
+		return stop
+	})
+	c.Assert(err, chk.Equals, stop)
+	c.Assert(visited, chk.Equals, 1)
+
+	c.Assert(JobsAdmin.WalkJobTransfers(common.NewJobID(), common.ETransferStatus.All(), collect), chk.NotNil)
+}
+
+func (s *jobPartPlanTestSuite) TestFollowJobProgress(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// each part holds one transfer, followed by its failure reason and its src/dst strings
+	jobID := common.NewJobID()
+	writePart := func(partNum common.PartNumber, jobStatus common.JobStatus, status common.TransferStatus, bytesTransferred uint64) {
+		src, dst := fmt.Sprintf("src%d", partNum), fmt.Sprintf("dst%d", partNum)
+		headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+		transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+		size := headerSize + transferSize + ErrorMessageMaxBytes + uintptr(len(src)+len(dst))
+		jpph, contents := newTestPlanBuffer(size)
+		jpph.Version = DataSchemaVersion
+		jpph.NumTransfers = 1
+		jpph.SetJobStatus(jobStatus)
+		jpph.AddBytesTransferred(bytesTransferred)
+		jppt := jpph.Transfer(0)
+		jppt.ErrorMessageOffset = int64(headerSize + transferSize)
+		jppt.SrcOffset = jppt.ErrorMessageOffset + ErrorMessageMaxBytes
+		jppt.SrcLength = int16(len(src))
+		jppt.DstLength = int16(len(dst))
+		jppt.SetTransferStatus(status, true)
+		copy(contents[jppt.SrcOffset:], src+dst)
+		writeTestPlanFile(c, jobID, partNum, contents)
+	}
+	writePart(0, common.EJobStatus.InProgress(), common.ETransferStatus.Success(), 100)
+	writePart(1, common.EJobStatus.InProgress(), common.ETransferStatus.Started(), 50)
+
+	// the job moves on each time an update is emitted; emit is called before the next read, so this is deterministic
+	var updates []common.JobProgressUpdate
+	emit := func(u common.JobProgressUpdate) {
+		updates = append(updates, u)
+		switch len(updates) {
+		case 1:
+			writePart(1, common.EJobStatus.InProgress(), common.ETransferStatus.Started(), 60)
+		case 2:
+			writePart(1, common.EJobStatus.InProgress(), common.ETransferStatus.Failed(), 70)
+			writePart(0, common.EJobStatus.CompletedWithErrors(), common.ETransferStatus.Success(), 100)
+		}
+	}
+	c.Assert(JobsAdmin.FollowJobProgress(context.Background(), jobID, time.Millisecond, emit), chk.IsNil)
+	c.Assert(updates, chk.HasLen, 3)
+
+	// the first update is a baseline, with no changed transfers
+	c.Assert(updates[0].JobStatus, chk.Equals, common.EJobStatus.InProgress())
+	c.Assert(updates[0].TotalTransfers, chk.Equals, uint32(2))
+	c.Assert(updates[0].TransfersCompleted, chk.Equals, uint32(1))
+	c.Assert(updates[0].BytesTransferred, chk.Equals, uint64(150))
+	c.Assert(updates[0].ChangedTransfers, chk.HasLen, 0)
+
+	// only bytes moved
+	c.Assert(updates[1].BytesTransferredDelta, chk.Equals, uint64(10))
+	c.Assert(updates[1].ChangedTransfers, chk.HasLen, 0)
+
+	// the last update is of the finished job, and has the transfer that failed
+	c.Assert(updates[2].JobStatus, chk.Equals, common.EJobStatus.CompletedWithErrors())
+	c.Assert(updates[2].TransfersFailed, chk.Equals, uint32(1))
+	c.Assert(updates[2].BytesTransferred, chk.Equals, uint64(170))
+	c.Assert(updates[2].BytesTransferredDelta, chk.Equals, uint64(10))
+	c.Assert(updates[2].ChangedTransfers, chk.HasLen, 1)
+	c.Assert(strings.HasSuffix(updates[2].ChangedTransfers[0].Src, "src1"), chk.Equals, true)
+	c.Assert(updates[2].ChangedTransfers[0].TransferStatus, chk.Equals, common.ETransferStatus.Failed())
+
+	// following stops when asked to
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writePart(0, common.EJobStatus.InProgress(), common.ETransferStatus.Success(), 100)
+	c.Assert(JobsAdmin.FollowJobProgress(ctx, jobID, time.Hour, func(common.JobProgressUpdate) {}), chk.Equals, context.Canceled)
+	c.Assert(JobsAdmin.FollowJobProgress(ctx, common.NewJobID(), time.Hour, func(common.JobProgressUpdate) {}), chk.NotNil)
+}
+
+func (s *jobPartPlanTestSuite) TestDeleteExpiredJobPlans(c *chk.C) {
+	planDir := c.MkDir()
+	defer useTestJobsAdmin(c, &jobsAdmin{planDir: planDir})()
+
+	now := time.Now()
+	writeJob := func(status common.JobStatus, completionTime time.Time, ttl time.Duration) string {
+		jobID := common.NewJobID()
+		jpph := newTestPlanWithOneTransfer(0)
+		jpph.Version = DataSchemaVersion
+		jpph.TTLAfterCompletion = uint32(ttl / time.Second)
+		jpph.SetJobStatus(status)
+		jpph.SetJobCompletionTime(completionTime)
+
+		planFile := writeTestPlanFile(c, jobID, 0, testPlanBytes(jpph, testPlanSize(jpph)))
+		return planFile.GetJobPartPlanPath()
+	}
+
+	expired := writeJob(common.EJobStatus.Completed(), now.Add(-2*time.Hour), time.Hour)
+	expiredCancelled := writeJob(common.EJobStatus.Cancelled(), now.Add(-2*time.Hour), time.Hour)
+	notYetExpired := writeJob(common.EJobStatus.CompletedWithErrors(), now.Add(-30*time.Minute), time.Hour)
+	keptForever := writeJob(common.EJobStatus.Completed(), now.Add(-2*time.Hour), 0)
+	// e.g. resumed, in another process
+	inProgress := writeJob(common.EJobStatus.InProgress(), time.Time{}, time.Hour)
+
+	// plan files left under their temporary names by azcopy processes that were stopped are swept up, unless they may still be being written
+	writeTempFile := func(modTime time.Time) string {
+		path := filepath.Join(planDir, fmt.Sprintf(jobPartPlanFileNameFormat, common.NewJobID().String(), 0, DataSchemaVersion)+jobPartPlanTempFileSuffix)
+		c.Assert(ioutil.WriteFile(path, []byte("incomplete"), 0644), chk.IsNil)
+		c.Assert(os.Chtimes(path, modTime, modTime), chk.IsNil)
+		return path
+	}
+	staleTempFile := writeTempFile(now.Add(-2 * jobPartPlanTempFileMaxAge))
+	freshTempFile := writeTempFile(now)
+
+	c.Assert(JobsAdmin.DeleteExpiredJobPlans(now), chk.HasLen, 2)
+
+	for _, path := range []string{expired, expiredCancelled, staleTempFile} {
+		_, err := os.Stat(path)
+		c.Assert(os.IsNotExist(err), chk.Equals, true)
+	}
+	for _, path := range []string{notYetExpired, keptForever, inProgress, freshTempFile} {
+		_, err := os.Stat(path)
+		c.Assert(err, chk.IsNil)
+	}
+}
+
+func (s *jobPartPlanTestSuite) TestExportJobPlan(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// each part holds its transfers, followed by their failure reasons and their src/dst strings
+	jobID := common.NewJobID()
+	const dstRoot = "https://account.blob.core.windows.net/container"
+	const dstQuery = "sv=2019-12-12&sig=secret"
+	type transfer struct {
+		src, dst     string
+		status       common.TransferStatus
+		retries      uint32
+		errorMessage string
+	}
+	writePart := func(partNum common.PartNumber, jobStatus common.JobStatus, transfers []transfer) string {
+		headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+		transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+		size := headerSize + uintptr(len(transfers))*(transferSize+ErrorMessageMaxBytes)
+		for _, t := range transfers {
+			size += uintptr(len(t.src) + len(t.dst))
+		}
+		jpph, contents := newTestPlanBuffer(size)
+		jpph.Version = DataSchemaVersion
+		jpph.JobID = jobID
+		jpph.PartNum = partNum
+		jpph.IsFinalPart = partNum == 1
+		jpph.FromTo = common.EFromTo.LocalBlob()
+		jpph.SourceRootLength = uint16(copy(jpph.SourceRoot[:], "/data"))
+		jpph.DestinationRootLength = uint16(copy(jpph.DestinationRoot[:], dstRoot))
+		jpph.DestExtraQueryLength = uint16(copy(jpph.DestExtraQuery[:], dstQuery))
+		jpph.NumTransfers = uint32(len(transfers))
+		jpph.SetJobStatus(jobStatus)
+		offset := int64(headerSize) + int64(len(transfers))*int64(transferSize)
+		for i, t := range transfers {
+			jppt := jpph.Transfer(uint32(i))
+			jppt.ErrorMessageOffset = offset
+			jppt.SrcOffset = offset + ErrorMessageMaxBytes
+			jppt.SrcLength = int16(len(t.src))
+			jppt.DstLength = int16(len(t.dst))
+			jppt.SourceSize = int64(100 * (i + 1))
+			jppt.SetTransferStatus(t.status, true)
+			jppt.atomicRetryCount = t.retries
+			jpph.SetErrorMessage(uint32(i), t.errorMessage)
+			copy(contents[jppt.SrcOffset:], t.src+t.dst)
+			offset = jppt.SrcOffset + int64(len(t.src)+len(t.dst))
+		}
+		planFile := writeTestPlanFile(c, jobID, partNum, contents)
+		return planFile.GetJobPartPlanPath()
+	}
+	part0 := writePart(0, common.EJobStatus.InProgress(), []transfer{
+		{"/a", "/a", common.ETransferStatus.Success(), 0, ""},
+		{"/b", "/b", common.ETransferStatus.Failed(), 2, "PUT " + dstRoot + "/b?" + dstQuery + " 403 AuthorizationFailure"},
+	})
+	part1 := writePart(1, common.EJobStatus.InProgress(), []transfer{
+		{"/c", "/c", common.ETransferStatus.Started(), 1, ""},
+	})
+	before, err := ioutil.ReadFile(part0)
+	c.Assert(err, chk.IsNil)
+
+	var out strings.Builder
+	c.Assert(ExportJobPlan(jobID, &out), chk.IsNil)
+	c.Assert(strings.Contains(out.String(), "secret"), chk.Equals, false)
+	c.Assert(strings.Contains(out.String(), "&sv="), chk.Equals, true) // query strings are kept readable
+
+	var export JobPlanExport
+	c.Assert(json.Unmarshal([]byte(out.String()), &export), chk.IsNil)
+	c.Assert(export.SchemaVersion, chk.Equals, JobPlanExportSchemaVersion)
+	c.Assert(export.JobID, chk.Equals, jobID)
+	c.Assert(export.Parts, chk.HasLen, 2)
+	c.Assert(export.TransfersByStatus, chk.DeepEquals, map[string]uint32{"Success": 1, "Failed": 1, "Started": 1})
+
+	p0 := export.Parts[0]
+	c.Assert(p0.PartNum, chk.Equals, common.PartNumber(0))
+	c.Assert(p0.JobStatus, chk.Equals, common.EJobStatus.InProgress())
+	c.Assert(p0.FromTo, chk.Equals, "LocalBlob")
+	c.Assert(p0.NumTransfers, chk.Equals, uint32(2))
+	c.Assert(p0.Transfers, chk.HasLen, 2)
+	c.Assert(p0.Transfers[0].Source, chk.Equals, "/data/a")
+	c.Assert(p0.Transfers[0].SourceSize, chk.Equals, int64(100))
+	c.Assert(p0.Transfers[0].TransferStatus, chk.Equals, common.ETransferStatus.Success())
+	failed := p0.Transfers[1]
+	c.Assert(failed.Index, chk.Equals, uint32(1))
+	c.Assert(failed.TransferStatus, chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(failed.RetryCount, chk.Equals, uint32(2))
+	// the signatures are redacted, wherever they appear
+	c.Assert(strings.HasPrefix(failed.Destination, dstRoot+"/b?"), chk.Equals, true)
+	c.Assert(strings.Contains(failed.Destination, "sig=REDACTED"), chk.Equals, true)
+	c.Assert(strings.Contains(failed.ErrorMessage, "sig=REDACTED"), chk.Equals, true)
+	c.Assert(strings.HasSuffix(failed.ErrorMessage, " 403 AuthorizationFailure"), chk.Equals, true)
+
+	p1 := export.Parts[1]
+	c.Assert(p1.IsFinalPart, chk.Equals, true)
+	c.Assert(p1.Transfers, chk.HasLen, 1)
+	c.Assert(p1.Transfers[0].TransferStatus, chk.Equals, common.ETransferStatus.Started())
+	c.Assert(p1.Transfers[0].RetryCount, chk.Equals, uint32(1))
+	c.Assert(p1.Transfers[0].StartTime.IsZero(), chk.Equals, true)
+
+	// the plan files are left as they were
+	after, err := ioutil.ReadFile(part0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(after, chk.DeepEquals, before)
+
+	// a plan file cut short is reported, rather than exported in part
+	contents, err := ioutil.ReadFile(part1)
+	c.Assert(err, chk.IsNil)
+	c.Assert(ioutil.WriteFile(part1, contents[:len(contents)-10], 0644), chk.IsNil)
+	out.Reset()
+	c.Assert(ExportJobPlan(jobID, &out), chk.NotNil)
+
+	c.Assert(ExportJobPlan(common.NewJobID(), &out), chk.NotNil)
+}
+
+func (s *jobPartPlanTestSuite) TestTornPlanFilesAreRecoveredOrDiscarded(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+	ja := JobsAdmin.(*jobsAdmin)
+
+	createPart := func(jobID common.JobID, partNum common.PartNumber, isFinalPart bool) JobPartPlanFileName {
+		order := newTestOrder(jobID, partNum, "/a")
+		order.IsFinalPart = isFinalPart
+		return createTestPlanFile(order)
+	}
+	// makes the temporary plan file at path too old to still be being written
+	leftLongAgo := func(path string) {
+		stoppedAt := time.Now().Add(-2 * jobPartPlanTempFileMaxAge)
+		c.Assert(os.Chtimes(path, stoppedAt, stoppedAt), chk.IsNil)
+	}
+	// simulates azcopy being stopped after it wrote the plan file of the part, but before it renamed it
+	createTornPart := func(jobID common.JobID, partNum common.PartNumber, isFinalPart bool) string {
+		planFile := createPart(jobID, partNum, isFinalPart)
+		tempPath := planFile.GetJobPartPlanPath() + jobPartPlanTempFileSuffix
+		c.Assert(os.Rename(planFile.GetJobPartPlanPath(), tempPath), chk.IsNil)
+		leftLongAgo(tempPath)
+		return tempPath
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// a plan file that was written in full is given its real name, so the job can be resumed
+	completeJobID := common.NewJobID()
+	createPart(completeJobID, 0, false)
+	tempPath := createTornPart(completeJobID, 1, true)
+	recovery := ja.RecoverJobPlan(completeJobID)
+	c.Assert(recovery.Recovered, chk.DeepEquals, []common.PartNumber{1})
+	c.Assert(recovery.Discarded, chk.HasLen, 0)
+	c.Assert(recovery.Corrupt(), chk.Equals, false)
+	c.Assert(exists(tempPath), chk.Equals, false)
+	files, err := ja.jobPlanFiles(completeJobID)
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 2)
+	mmf, err := JobPartPlanFileName(files[1].Name()).MapReadOnly()
+	c.Assert(err, chk.IsNil)
+	c.Assert(mmf.Plan().IsFinalPart, chk.Equals, true)
+	mmf.Unmap()
+
+	// one that azcopy was stopped in the middle of writing is discarded, and the job is reported as corrupt
+	truncatedJobID := common.NewJobID()
+	createPart(truncatedJobID, 0, false)
+	tempPath = createTornPart(truncatedJobID, 1, true)
+	info, err := os.Stat(tempPath)
+	c.Assert(err, chk.IsNil)
+	c.Assert(os.Truncate(tempPath, info.Size()-1), chk.IsNil)
+	leftLongAgo(tempPath)
+	resp := ResumeJobOrder(common.ResumeJobRequest{JobID: truncatedJobID})
+	c.Assert(resp.CancelledPauseResumed, chk.Equals, false)
+	c.Assert(resp.ErrorMsg, chk.Matches, ".*Its plan is corrupt.* part 1,.*")
+	c.Assert(exists(tempPath), chk.Equals, false)
+	files, err = ja.jobPlanFiles(truncatedJobID)
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 1)
+
+	// and so is one whose header hadn't been written yet, even though everything after it had
+	headerlessJobID := common.NewJobID()
+	tempPath = createTornPart(headerlessJobID, 0, true)
+	file, err := os.OpenFile(tempPath, os.O_WRONLY, 0644)
+	c.Assert(err, chk.IsNil)
+	_, err = file.WriteAt(make([]byte, unsafe.Sizeof(JobPartPlanHeader{})), 0)
+	c.Assert(err, chk.IsNil)
+	c.Assert(file.Close(), chk.IsNil)
+	leftLongAgo(tempPath)
+	recovery = ja.RecoverJobPlan(headerlessJobID)
+	c.Assert(recovery.Recovered, chk.HasLen, 0)
+	c.Assert(recovery.Discarded, chk.DeepEquals, []common.PartNumber{0})
+	c.Assert(recovery.Corrupt(), chk.Equals, true)
+	c.Assert(exists(tempPath), chk.Equals, false)
+	c.Assert(ja.planFilesInFolder(headerlessJobID.String()), chk.HasLen, 0)
+
+	// one that changed just now may still be being written by another azcopy process, so it is left alone, and the job isn't resumed
+	orderingJobID := common.NewJobID()
+	createPart(orderingJobID, 0, false)
+	tempPath = createTornPart(orderingJobID, 1, false)
+	c.Assert(os.Truncate(tempPath, int64(unsafe.Sizeof(JobPartPlanHeader{}))), chk.IsNil) // i.e. it has only been partly written so far
+	recovery = ja.RecoverJobPlan(orderingJobID)
+	c.Assert(recovery.InUse, chk.DeepEquals, []common.PartNumber{1})
+	c.Assert(recovery.Recovered, chk.HasLen, 0)
+	c.Assert(recovery.Corrupt(), chk.Equals, false)
+	resp = ResumeJobOrder(common.ResumeJobRequest{JobID: orderingJobID})
+	c.Assert(resp.CancelledPauseResumed, chk.Equals, false)
+	c.Assert(resp.ErrorMsg, chk.Matches, ".*part 1 is still being written.*")
+	c.Assert(exists(tempPath), chk.Equals, true)
+}
+
+func (s *jobPartPlanTestSuite) TestSourceBlobTagsAreReadAsGiven(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// '+' and '%' survive being escaped into the plan, and unescaped out of it just once
+	tags := common.BlobTags{"a+b": "50%", "c d": "e+%20f"}
+	jobID := common.NewJobID()
+	planFile := createTestPlanFile(common.CopyJobPartOrderRequest{
+		JobID:           jobID,
+		IsFinalPart:     true,
+		FromTo:          common.EFromTo.BlobBlob(),
+		SourceRoot:      common.ResourceString{Value: "https://account.blob.core.windows.net/src"},
+		DestinationRoot: common.ResourceString{Value: "https://account.blob.core.windows.net/dst"},
+		Transfers:       []common.CopyTransfer{{Source: "/file", Destination: "/file", EntityType: common.EEntityType.File(), BlobTags: tags}},
+	})
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+
+	jpm := newTestJobPartMgr(mmf)
+	c.Assert(jpm.newTransferMgr(jpm.jobCtx, 0).Info().SrcBlobTags, chk.DeepEquals, tags)
+}
+
+func (s *jobPartPlanTestSuite) TestMetadataBeyondTheOldLimitIsKept(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	// the header used to hold at most 1000 bytes of metadata; blobs may have up to 8KB
+	metadata := "key=" + strings.Repeat("v", 8000)
+	jobID := common.NewJobID()
+	order := newTestOrder(jobID, 0)
+	order.CommandString = "copy " + testSourceRoot + " " + testDestinationRoot
+	order.Transfers = []common.CopyTransfer{{Source: "/a", Destination: "/b", EntityType: common.EEntityType.File()}}
+	order.BlobAttributes.Metadata = metadata
+	planFile := createTestPlanFile(order)
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+
+	plan := mmf.Plan()
+	c.Assert(plan.Metadata(), chk.Equals, metadata)
+	// and what comes after the metadata is still where it is expected to be
+	c.Assert(plan.CommandString(), chk.Equals, order.CommandString)
+	source, destination, _ := plan.TransferSrcDstStrings(0)
+	c.Assert(source, chk.Equals, testSourceRoot+"/a")
+	c.Assert(destination, chk.Equals, testDestinationRoot+"/b")
+}
+
+func (s *jobPartPlanTestSuite) TestPlanFilesOfOtherSchemaVersionsAreIgnored(c *chk.C) {
+	planDir := c.MkDir()
+	defer useTestJobsAdmin(c, &jobsAdmin{planDir: planDir})()
+	ja := JobsAdmin.(*jobsAdmin)
+
+	// a plan file written by an older azcopy, which laid the file out differently, is neither listed nor resumed
+	oldJobID := common.NewJobID()
+	planFile := createTestPlanFile(newTestOrder(oldJobID, 0, "/a"))
+	oldName := fmt.Sprintf(jobPartPlanFileNameFormat, oldJobID.String(), 0, DataSchemaVersion-1)
+	c.Assert(os.Rename(planFile.GetJobPartPlanPath(), filepath.Join(planDir, oldName)), chk.IsNil)
+	_, _, err := JobPartPlanFileName(oldName).Parse()
+	c.Assert(err, chk.NotNil)
+	c.Assert(ja.planFilesInFolder(""), chk.HasLen, 0)
+	c.Assert(JobsAdmin.ListJobPlans(), chk.HasLen, 0)
+	c.Assert(ja.ResurrectJob(oldJobID, "", ""), chk.Equals, false)
+
+	// nor is its header read as if it were of the current version, whatever the file is called
+	renamedJobID := common.NewJobID()
+	planFile = createTestPlanFile(newTestOrder(renamedJobID, 0, "/a"))
+	mmf := planFile.Map()
+	mmf.Plan().Version = DataSchemaVersion - 1
+	mmf.Unmap()
+	info, err := os.Stat(planFile.GetJobPartPlanPath())
+	c.Assert(err, chk.IsNil)
+	_, _, err = readJobPartPlanFile(planFile, info.Size())
+	c.Assert(err, chk.ErrorMatches, ".*has data schema version .* rather than .*")
+}
+
+func (s *jobPartPlanTestSuite) TestGetJobPartPlanSummary(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	jobID := common.NewJobID()
+	order := newTestOrder(jobID, 1, "/a", "/b")
+	order.Priority = common.EJobPriority.Low()
+	planFile := createTestPlanFile(order)
+	mmf := planFile.Map()
+	mmf.Plan().SetJobStatus(common.EJobStatus.Paused())
+	mmf.Unmap()
+	contents, err := ioutil.ReadFile(planFile.GetJobPartPlanPath())
+	c.Assert(err, chk.IsNil)
+
+	summary, err := GetJobPartPlanSummary(jobID, 1)
+	c.Assert(err, chk.IsNil)
+	c.Assert(summary.Version, chk.Equals, DataSchemaVersion)
+	c.Assert(summary.PartNum, chk.Equals, common.PartNumber(1))
+	c.Assert(summary.IsFinalPart, chk.Equals, true)
+	c.Assert(summary.NumTransfers, chk.Equals, uint32(2))
+	c.Assert(summary.Priority, chk.Equals, common.EJobPriority.Low())
+	c.Assert(summary.JobStatus, chk.Equals, common.EJobStatus.Paused())
+
+	// the plan file is only read, not changed
+	after, err := ioutil.ReadFile(planFile.GetJobPartPlanPath())
+	c.Assert(err, chk.IsNil)
+	c.Assert(after, chk.DeepEquals, contents)
+
+	// a part that has no plan file is an error, rather than a panic
+	_, err = GetJobPartPlanSummary(jobID, 0)
+	c.Assert(err, chk.ErrorMatches, ".*cannot open the plan file of JobID=.*, Part#=0.*")
+}
+
+func (s *jobPartPlanTestSuite) TestMapReadOnly(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	jobID := common.NewJobID()
+	planFile := JobsAdmin.NewJobPartPlanFileName(jobID, 0)
+	_, err := planFile.MapReadOnly()
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+
+	createTestPlanFile(newTestOrder(jobID, 0, "/a"))
+	// a plan that is already mapped for writing, e.g. by the job that is running it, can be mapped read-only alongside,
+	// and is seen as it changes
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+	readOnly, err := planFile.MapReadOnly()
+	c.Assert(err, chk.IsNil)
+	defer readOnly.Unmap()
+	c.Assert(readOnly.Plan().JobID, chk.Equals, jobID)
+	mmf.Plan().SetJobStatus(common.EJobStatus.Completed())
+	c.Assert(readOnly.Plan().JobStatus(), chk.Equals, common.EJobStatus.Completed())
+}
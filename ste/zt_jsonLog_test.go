@@ -0,0 +1,129 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	chk "gopkg.in/check.v1"
+)
+
+type jsonLogSuite struct{}
+
+var _ = chk.Suite(&jsonLogSuite{})
+
+type testJsonLogEntry struct {
+	Timestamp    string `json:"timestamp"`
+	Level        string `json:"level"`
+	JobID        string `json:"jobId"`
+	EventType    string `json:"eventType"`
+	TransferPath string `json:"transferPath"`
+	Message      string `json:"message"`
+}
+
+// newTestRetryingPipeline returns a pipeline whose requests are each tried twice, and always get a 503 back
+func newTestRetryingPipeline(log pipeline.LogOptions) pipeline.Pipeline {
+	tryTwice := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			_, _ = next.Do(ctx, request)
+			return next.Do(ctx, request)
+		}
+	})
+	serverBusy := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			return pipeline.NewHTTPResponse(&http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "503 Server Busy",
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    request.Request,
+			}), nil
+		}
+	})
+	return pipeline.NewPipeline([]pipeline.Factory{tryTwice, NewRequestLogPolicyFactory(RequestLogOptions{})},
+		pipeline.Options{HTTPSender: serverBusy, Log: log})
+}
+
+func (s *jsonLogSuite) TestRetryAndFailureAreLoggedAsJson(c *chk.C) {
+	folder, err := ioutil.TempDir("", "azcopy-json-log")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(folder)
+
+	// given a job whose log is in the JSON format
+	jobID := common.NewJobID()
+	logger := common.NewJobLogger(jobID, common.ELogLevel.Info(), common.ELogFormat.Json(), common.NewAppLogger(pipeline.LogNone, folder), folder)
+	logger.OpenLog()
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.LogFormat = common.ELogFormat.Json()
+	jm := &jobMgr{logger: logger}
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: newTestPlanMMF(c, jpph)}
+	jptm := jpm.newTransferMgr(context.Background(), 0)
+	source := "https://account.blob.core.windows.net/container/file.txt"
+	jptm.transferInfo = &TransferInfo{JobID: jobID, Source: source + "?sv=2020-02-10&sig=secret", Destination: "/data/file.txt"}
+
+	// when a request of the transfer is retried, and then the transfer fails
+	u, err := url.Parse(source)
+	c.Assert(err, chk.IsNil)
+	request, err := pipeline.NewRequest(http.MethodGet, *u, nil)
+	c.Assert(err, chk.IsNil)
+	_, err = newTestRetryingPipeline(jm.PipelineLogInfo()).Do(jptm.Context(), nil, request)
+	c.Assert(err, chk.IsNil)
+	jptm.LogDownloadError(jptm.Info().Source, jptm.Info().Destination, "Server Busy", http.StatusServiceUnavailable)
+	logger.CloseLog()
+
+	// then every line is a JSON object, and the retry and the failure have all the expected fields
+	file, err := os.Open(filepath.Join(folder, jobID.String()+".log"))
+	c.Assert(err, chk.IsNil)
+	defer file.Close()
+	entries := map[string]testJsonLogEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry testJsonLogEntry
+		c.Assert(json.Unmarshal(scanner.Bytes(), &entry), chk.IsNil, chk.Commentf("line %q", scanner.Text()))
+		_, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		c.Assert(err, chk.IsNil)
+		c.Assert(entry.JobID, chk.Equals, jobID.String())
+		entries[entry.EventType] = entry
+	}
+	c.Assert(scanner.Err(), chk.IsNil)
+
+	for _, event := range []common.LogEvent{common.ELogEvent.Request(), common.ELogEvent.Retry(), common.ELogEvent.TransferFailed()} {
+		entry, ok := entries[event.String()]
+		c.Assert(ok, chk.Equals, true, chk.Commentf("no %s event", event))
+		c.Assert(entry.Level, chk.Equals, common.ELogLevel.Error().String())
+		c.Assert(strings.HasPrefix(entry.TransferPath, source+"?"), chk.Equals, true)
+		c.Assert(strings.Contains(entry.TransferPath, "sig=REDACTED"), chk.Equals, true)
+		c.Assert(entry.Message, chk.Not(chk.Equals), "")
+	}
+	c.Assert(strings.Contains(entries[common.ELogEvent.Retry().String()].Message, "Try=2"), chk.Equals, true)
+	c.Assert(strings.Contains(entries[common.ELogEvent.TransferFailed().String()].Message, "DOWNLOADFAILED"), chk.Equals, true)
+}
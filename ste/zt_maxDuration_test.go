@@ -0,0 +1,115 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type maxDurationTestSuite struct{}
+
+var _ = chk.Suite(&maxDurationTestSuite{})
+
+// discardingJobLogger is a job logger that logs nothing, so that job managers can be tested without log files
+type discardingJobLogger struct{}
+
+func (discardingJobLogger) OpenLog()                                {}
+func (discardingJobLogger) MinimumLogLevel() pipeline.LogLevel      { return pipeline.LogNone }
+func (discardingJobLogger) ShouldLog(level pipeline.LogLevel) bool  { return false }
+func (discardingJobLogger) Log(level pipeline.LogLevel, msg string) {}
+func (discardingJobLogger) Panic(err error)                         { panic(err) }
+func (discardingJobLogger) CloseLog()                               {}
+func (discardingJobLogger) LogEvent(level pipeline.LogLevel, event common.LogEvent, transferPath string, msg string) {
+}
+
+// newJobMgrForMaxDurationTest returns a running job, whose part 0 plan is held in memory rather than in a plan file
+func newJobMgrForMaxDurationTest(c *chk.C, runStart time.Time) (*jobMgr, *jobPartMgr) {
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr(), logger: discardingJobLogger{}, maxDurationMu: &sync.Mutex{}}
+	jm.ctx, jm.cancel = context.WithCancel(context.Background())
+	atomic.StoreInt64(&jm.atomicRunStartTime, runStart.UnixNano())
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: newTestPlanMMF(c, &JobPartPlanHeader{})}
+	jm.jobPartMgrs.Set(0, jpm)
+	return jm, jpm
+}
+
+func waitForJobStatus(plan *JobPartPlanHeader, status common.JobStatus) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if plan.JobStatus() == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *maxDurationTestSuite) TestMaxDurationStopsDispatchButNotInflightTransfers(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, ctx: jm.ctx}
+
+	jm.startMaxDurationTimer(time.Millisecond)
+	c.Assert(waitForJobStatus(jpm.Plan(), common.EJobStatus.Cancelling()), chk.Equals, true)
+	c.Assert(jpm.Plan().CancelReason(), chk.Equals, common.EJobCancelReason.MaxDurationExceeded())
+
+	// transfers that haven't started must not be, but those in flight are left to finish
+	c.Assert(jptm.IsJobCancelling(), chk.Equals, true)
+	c.Assert(jptm.WasCanceled(), chk.Equals, false)
+}
+
+func (s *maxDurationTestSuite) TestMaxDurationLeavesFinishedJobAlone(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	jpm.Plan().SetJobStatus(common.EJobStatus.Paused())
+
+	jm.stopForMaxDuration(time.Millisecond)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.Paused())
+	c.Assert(jpm.Plan().CancelReason(), chk.Equals, common.EJobCancelReason.None())
+}
+
+func (s *maxDurationTestSuite) TestMaxDurationClockRestartsWithEachRun(c *chk.C) {
+	const maxDuration = 200 * time.Millisecond
+
+	// the first run started long enough ago to have overrun already
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now().Add(-time.Hour))
+	defer jm.cancel()
+	jm.startMaxDurationTimer(maxDuration)
+	c.Assert(waitForJobStatus(jpm.Plan(), common.EJobStatus.Cancelling()), chk.Equals, true)
+
+	// resuming starts a new run, which gets the full duration again
+	jpm.Plan().SetJobStatus(common.EJobStatus.InProgress())
+	jpm.Plan().SetCancelReason(common.EJobCancelReason.None())
+	atomic.StoreInt64(&jm.atomicRunStartTime, time.Now().UnixNano())
+	jm.startMaxDurationTimer(maxDuration)
+	time.Sleep(maxDuration / 4)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+
+	// and once the run is over, it can't overrun
+	jm.startMaxDurationTimer(0)
+	time.Sleep(maxDuration)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+}
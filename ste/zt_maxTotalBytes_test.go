@@ -0,0 +1,87 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type maxTotalBytesTestSuite struct{}
+
+var _ = chk.Suite(&maxTotalBytesTestSuite{})
+
+func newTransferMgrForMaxTotalBytesTest(jpm *jobPartMgr, sourceSize int64) *jobPartTransferMgr {
+	return &jobPartTransferMgr{jobPartMgr: jpm, ctx: jpm.jobMgr.(*jobMgr).ctx, jobPartPlanTransfer: &JobPartPlanTransfer{SourceSize: sourceSize}}
+}
+
+func (s *maxTotalBytesTestSuite) TestMaxTotalBytesBoundary(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	jm.SetMaxTotalBytes(100)
+
+	// transfers that take the job right up to the limit are started
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 40).ReserveBytes(), chk.Equals, true)
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 60).ReserveBytes(), chk.Equals, true)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+
+	// but not one that would go a single byte past it, which stops the job
+	jptm := newTransferMgrForMaxTotalBytesTest(jpm, 1)
+	c.Assert(jptm.ReserveBytes(), chk.Equals, false)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.Cancelling())
+	c.Assert(jpm.Plan().CancelReason(), chk.Equals, common.EJobCancelReason.MaxTotalBytesReached())
+	c.Assert(jptm.IsJobStoppedByMaxTotalBytes(), chk.Equals, true)
+	c.Assert(jptm.WasCanceled(), chk.Equals, false) // those in flight are left to finish
+
+	// once stopped, nothing more is started, even what would fit
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 0).ReserveBytes(), chk.Equals, false)
+}
+
+func (s *maxTotalBytesTestSuite) TestMaxTotalBytesCountsEarlierRuns(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	jm.SetMaxTotalBytes(100)
+	jpm.Plan().AddBytesTransferred(80)
+	jm.resetBytesReserved()
+
+	// a paused transfer only needs what it has still to send, since the rest was counted when it was sent
+	paused := newTransferMgrForMaxTotalBytesTest(jpm, 50)
+	paused.jobPartPlanTransfer.atomicAttemptBytes = 30
+	c.Assert(paused.ReserveBytes(), chk.Equals, true)
+	// and a transfer that is rescheduled doesn't count twice
+	c.Assert(paused.ReserveBytes(), chk.Equals, true)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 1).ReserveBytes(), chk.Equals, false)
+	c.Assert(jpm.Plan().CancelReason(), chk.Equals, common.EJobCancelReason.MaxTotalBytesReached())
+}
+
+func (s *maxTotalBytesTestSuite) TestNoMaxTotalBytes(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 1<<50).ReserveBytes(), chk.Equals, true)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+	c.Assert(newTransferMgrForMaxTotalBytesTest(jpm, 0).IsJobStoppedByMaxTotalBytes(), chk.Equals, false)
+}
@@ -0,0 +1,69 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type md5ComparerSuite struct{}
+
+var _ = chk.Suite(&md5ComparerSuite{})
+
+func (s *md5ComparerSuite) TestExpectedHash(c *chk.C) {
+	md5Hash := []byte{1, 2, 3}
+	sha256Hash := sha256.Sum256([]byte("content"))
+	info := TransferInfo{SrcProperties: SrcProperties{
+		SrcHTTPHeaders: common.ResourceHTTPHeaders{ContentMD5: md5Hash},
+		SrcMetadata:    common.Metadata{"Azcopy_SHA256": hex.EncodeToString(sha256Hash[:])},
+	}}
+
+	c.Assert(expectedHash(info, common.EHashAlgorithm.MD5()), chk.DeepEquals, md5Hash)
+	c.Assert(expectedHash(info, common.EHashAlgorithm.SHA256()), chk.DeepEquals, sha256Hash[:])
+
+	// a value that isn't a SHA-256 hash is treated as missing
+	info.SrcMetadata = common.Metadata{common.SHA256MetadataKey: "not a hash"}
+	c.Assert(expectedHash(info, common.EHashAlgorithm.SHA256()), chk.IsNil)
+	info.SrcMetadata = common.Metadata{}
+	c.Assert(expectedHash(info, common.EHashAlgorithm.SHA256()), chk.IsNil)
+}
+
+func (s *md5ComparerSuite) TestCheckStreamedMD5(c *chk.C) {
+	var warnings []string
+	warn := func(msg string) { warnings = append(warnings, msg) }
+	md5Hash := []byte{1, 2, 3}
+
+	c.Assert(CheckStreamedMD5(md5Hash, md5Hash, common.EHashValidationOption.FailIfDifferent(), warn), chk.IsNil)
+	c.Assert(CheckStreamedMD5(md5Hash, []byte{4}, common.EHashValidationOption.FailIfDifferent(), warn), chk.Equals, errMd5Mismatch)
+	c.Assert(CheckStreamedMD5(md5Hash, []byte{4}, common.EHashValidationOption.NoCheck(), warn), chk.IsNil)
+	c.Assert(warnings, chk.HasLen, 0)
+
+	// differences and missing hashes are only warned about, unless they must fail
+	c.Assert(CheckStreamedMD5(md5Hash, []byte{4}, common.EHashValidationOption.LogOnly(), warn), chk.IsNil)
+	c.Assert(CheckStreamedMD5(nil, []byte{4}, common.EHashValidationOption.FailIfDifferent(), warn), chk.IsNil)
+	c.Assert(warnings, chk.DeepEquals, []string{errMd5Mismatch.Error(), noMD5Stored})
+	c.Assert(CheckStreamedMD5(nil, []byte{4}, common.EHashValidationOption.FailIfDifferentOrMissing(), warn), chk.Equals, errExpectedMd5Missing)
+}
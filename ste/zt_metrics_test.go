@@ -0,0 +1,147 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type metricsSuite struct{}
+
+var _ = chk.Suite(&metricsSuite{})
+
+// scrapeMetrics gets the metrics from the endpoint and parses the exposition format, returning the value of each sample
+// (keyed by its name and labels) and the declared type of each metric
+func scrapeMetrics(c *chk.C, url string) (samples map[string]float64, types map[string]string) {
+	resp, err := http.Get(url + metricsPath)
+	c.Assert(err, chk.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, chk.Equals, http.StatusOK)
+	c.Assert(strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4"), chk.Equals, true)
+
+	samples, types = map[string]float64{}, map[string]string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			c.Assert(fields, chk.HasLen, 4)
+			types[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		sep := strings.LastIndex(line, " ")
+		c.Assert(sep > 0, chk.Equals, true, chk.Commentf("malformed sample %q", line))
+		value, err := strconv.ParseFloat(line[sep+1:], 64)
+		c.Assert(err, chk.IsNil)
+		key := line[:sep]
+		name := key
+		if brace := strings.Index(key, "{"); brace >= 0 {
+			c.Assert(strings.HasSuffix(key, "}"), chk.Equals, true)
+			name = key[:brace]
+		}
+		_, declared := types[name]
+		c.Assert(declared, chk.Equals, true, chk.Commentf("sample of %s before its TYPE line", name))
+		samples[key] = value
+	}
+	c.Assert(scanner.Err(), chk.IsNil)
+	return
+}
+
+func (s *metricsSuite) TestMetricsAreServedFromProgressCounters(c *chk.C) {
+	ja := &jobsAdmin{pacer: newTokenBucketPacer(0, 0), jobIDToJobMgr: newJobIDToJobMgr(), atomicCurrentMainPoolSize: 16}
+	defer ja.pacer.Close()
+
+	// a job with two parts, whose counters are summed, and an idle job
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	_, secondPart := newJobMgrForMaxDurationTest(c, time.Now())
+	jm.jobPartMgrs.Set(1, secondPart)
+	jobID := common.NewJobID()
+	ja.jobIDToJobMgr.Set(jobID, jm)
+	idle, _ := newJobMgrForMaxDurationTest(c, time.Now())
+	defer idle.cancel()
+	idleJobID := common.NewJobID()
+	ja.jobIDToJobMgr.Set(idleJobID, idle)
+
+	jpm.Plan().AddBytesTransferred(1000)
+	secondPart.Plan().AddBytesTransferred(500)
+	jpm.updateJobPartProgress(common.ETransferStatus.Success())
+	secondPart.updateJobPartProgress(common.ETransferStatus.Success())
+	jpm.updateJobPartProgress(common.ETransferStatus.Failed())
+	secondPart.updateJobPartProgress(common.ETransferStatus.SkippedEntityAlreadyExists())
+
+	atomic.StoreInt64(&ja.pacer.atomicGrandTotal, 4000)
+	server := httptest.NewServer(newMetricsHandler(ja))
+	defer server.Close()
+
+	samples, types := scrapeMetrics(c, server.URL)
+
+	label := `{job_id="` + jobID.String() + `"}`
+	c.Assert(samples["azcopy_bytes_transferred_total"+label], chk.Equals, float64(1500))
+	c.Assert(samples["azcopy_transfers_completed_total"+label], chk.Equals, float64(2))
+	c.Assert(samples["azcopy_transfers_failed_total"+label], chk.Equals, float64(1))
+	c.Assert(samples["azcopy_transfers_skipped_total"+label], chk.Equals, float64(1))
+	idleLabel := `{job_id="` + idleJobID.String() + `"}`
+	c.Assert(samples["azcopy_bytes_transferred_total"+idleLabel], chk.Equals, float64(0))
+	c.Assert(samples["azcopy_transfers_completed_total"+idleLabel], chk.Equals, float64(0))
+
+	c.Assert(samples["azcopy_bytes_over_wire_total"], chk.Equals, float64(4000))
+	c.Assert(samples["azcopy_concurrency"], chk.Equals, float64(16))
+
+	c.Assert(types["azcopy_bytes_transferred_total"], chk.Equals, "counter")
+	c.Assert(types["azcopy_transfers_failed_total"], chk.Equals, "counter")
+	c.Assert(types["azcopy_bytes_over_wire_total"], chk.Equals, "counter")
+	c.Assert(types["azcopy_concurrency"], chk.Equals, "gauge")
+
+	// scraping changes nothing, so a second scraper sees the same values
+	again, _ := scrapeMetrics(c, server.URL)
+	c.Assert(again, chk.DeepEquals, samples)
+}
+
+func (s *metricsSuite) TestMetricsEndpointOnlyServesMetricsPath(c *chk.C) {
+	ja := &jobsAdmin{pacer: newTokenBucketPacer(0, 0), jobIDToJobMgr: newJobIDToJobMgr()}
+	defer ja.pacer.Close()
+	server := httptest.NewServer(newMetricsHandler(ja))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/other")
+	c.Assert(err, chk.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, chk.Equals, http.StatusNotFound)
+
+	resp, err = http.Post(server.URL+metricsPath, "text/plain", strings.NewReader(""))
+	c.Assert(err, chk.IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, chk.Equals, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,200 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	chk "gopkg.in/check.v1"
+)
+
+type pageBlobResumeSuite struct{}
+
+var _ = chk.Suite(&pageBlobResumeSuite{})
+
+// pageBlobResumeTestServer is a blob endpoint that holds one page blob, and records what is done to it
+type pageBlobResumeTestServer struct {
+	mu      sync.Mutex
+	created int
+	exists  bool
+	length  int64
+	pages   []int64 // the offsets of the pages written
+}
+
+func (t *pageBlobResumeTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	comp := r.URL.Query().Get("comp")
+	switch {
+	case r.Method == http.MethodHead && !t.exists:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", strconv.FormatInt(t.length, 10))
+		w.Header().Set("x-ms-blob-type", "PageBlob")
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && comp == "page":
+		start := strings.TrimPrefix(strings.Split(r.Header.Get("x-ms-range"), "-")[0], "bytes=")
+		offset, _ := strconv.ParseInt(start, 10, 64)
+		t.pages = append(t.pages, offset)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && comp == "properties":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && comp == "":
+		t.created++
+		t.exists = true
+		t.length, _ = strconv.ParseInt(r.Header.Get("x-ms-blob-content-length"), 10, 64)
+		t.pages = nil
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// pageBlobResumeTestChunk is a chunk that is already in memory
+type pageBlobResumeTestChunk struct {
+	common.SingleChunkReader
+	data []byte
+	r    *bytes.Reader
+}
+
+func newPageBlobResumeTestChunk(data []byte) *pageBlobResumeTestChunk {
+	return &pageBlobResumeTestChunk{data: data, r: bytes.NewReader(data)}
+}
+
+func (r *pageBlobResumeTestChunk) Read(p []byte) (int, error) { return r.r.Read(p) }
+func (r *pageBlobResumeTestChunk) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+func (r *pageBlobResumeTestChunk) Close() error  { return nil }
+func (r *pageBlobResumeTestChunk) Length() int64 { return int64(len(r.data)) }
+func (r *pageBlobResumeTestChunk) HasPrefetchedEntirelyZeros() bool {
+	return bytes.Equal(r.data, make([]byte, len(r.data)))
+}
+
+func (s *pageBlobResumeSuite) TestPausedUploadResumesFromThePagesWritten(c *chk.C) {
+	const chunkSize, numChunks = azblob.PageBlobPageBytes, 4
+	server := &pageBlobResumeTestServer{}
+	destination := httptest.NewServer(server)
+	defer destination.Close()
+
+	jpm, plain := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	info := *plain.transferInfo
+	info.Destination = destination.URL + "/account/container/disk.vhd"
+	info.SourceSize = chunkSize * numChunks
+	info.BlockSize = chunkSize
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+
+	// the third page of the source is all zeros, so it's never written
+	chunkData := func(chunk int64) []byte {
+		data := make([]byte, chunkSize)
+		if chunk != 2 {
+			data[0] = 1
+		}
+		return data
+	}
+	// each run sends the given chunks, in order
+	upload := func(chunks int64) {
+		t := jpm.newTransferMgr(context.Background(), 0)
+		t.transferInfo = &info
+		jptm := &resumeTestJptm{jobPartTransferMgr: t}
+		snd, err := newPageBlobUploader(jptm, info.Destination, p, newNullAutoPacer(), resumeTestSource{})
+		c.Assert(err, chk.IsNil)
+		u := snd.(*pageBlobUploader)
+		c.Assert(u.NumChunks(), chk.Equals, uint32(numChunks))
+		u.Prologue(common.PrologueState{})
+		for chunk := int64(0); chunk < chunks; chunk++ {
+			id := common.NewChunkID(info.Source, chunk*chunkSize, chunkSize)
+			u.GenerateUploadFunc(id, int32(chunk), newPageBlobResumeTestChunk(chunkData(chunk)), false)(0)
+		}
+		c.Assert(jptm.IsLive(), chk.Equals, true, chk.Commentf("%v", jpm.Plan().ErrorMessage(0)))
+		u.md5Channel <- make([]byte, 16)
+		u.Epilogue()
+	}
+
+	// the first run is paused before it sends the last page
+	upload(numChunks - 1)
+	c.Assert(server.created, chk.Equals, 1)
+	c.Assert(server.pages, chk.DeepEquals, []int64{0, 512})
+
+	// so the resumed run doesn't create the blob again, and only writes the page that is left
+	server.pages = nil
+	upload(numChunks)
+	c.Assert(server.created, chk.Equals, 1)
+	c.Assert(server.pages, chk.DeepEquals, []int64{1536})
+
+	// but if the blob has gone, it's created, and all its pages are written, again
+	server.exists = false
+	upload(numChunks)
+	c.Assert(server.created, chk.Equals, 2)
+	c.Assert(server.pages, chk.DeepEquals, []int64{0, 512, 1536})
+}
+
+func (s *pageBlobResumeSuite) TestPausedUploadKeepsItsPageBlob(c *chk.C) {
+	var deletes int
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deletes++
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer destination.Close()
+
+	jpm, t := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	t.transferInfo.Destination = destination.URL + "/account/container/disk.vhd"
+	t.transferInfo.SourceSize = azblob.PageBlobPageBytes
+	t.transferInfo.BlockSize = azblob.PageBlobPageBytes
+	ctx, cancel := context.WithCancel(context.Background())
+	t.ctx = ctx
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	snd, err := newPageBlobUploader(t, t.transferInfo.Destination, p, newNullAutoPacer(), resumeTestSource{})
+	c.Assert(err, chk.IsNil)
+	t.SetDestinationIsModified()
+	cancel()
+
+	t.SetStatus(common.ETransferStatus.Paused())
+	snd.Cleanup()
+	c.Assert(deletes, chk.Equals, 0)
+
+	t.SetStatus(common.ETransferStatus.Cancelled())
+	snd.Cleanup()
+	c.Assert(deletes, chk.Equals, 1)
+}
+
+func (s *pageBlobResumeSuite) TestSourceThatIsNotWholePagesIsRefused(c *chk.C) {
+	jpm, t := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	t.transferInfo.SourceSize = azblob.PageBlobPageBytes + 1
+	p := pipeline.NewPipeline(nil, pipeline.Options{})
+	_, err := newPageBlobUploader(t, t.transferInfo.Destination, p, newNullAutoPacer(), resumeTestSource{})
+	c.Assert(err, chk.ErrorMatches, ".*not a multiple of 512 bytes.*")
+}
@@ -0,0 +1,194 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type pauseJobSuite struct{}
+
+var _ = chk.Suite(&pauseJobSuite{})
+
+func (s *pauseJobSuite) TestPauseStopsDispatchAndInflightTransfers(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	jobID := common.NewJobID()
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	defer jm.cancel()
+	JobsAdmin.(*jobsAdmin).jobIDToJobMgr.Set(jobID, jm)
+	jpm.Plan().SetJobStatus(common.EJobStatus.InProgress())
+	jptm := &jobPartTransferMgr{jobPartMgr: jpm, ctx: jm.ctx}
+
+	resp := CancelPauseJobOrder(jobID, common.EJobStatus.Paused())
+	c.Assert(resp.CancelledPauseResumed, chk.Equals, true)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.Paused())
+
+	// transfers that haven't started must not be, and those in flight are stopped, to carry on from where they were when resumed
+	c.Assert(jptm.IsJobPaused(), chk.Equals, true)
+	c.Assert(jptm.WasCanceled(), chk.Equals, true)
+
+	// a paused job can still be cancelled, but one being cancelled can't be paused
+	c.Assert(CancelPauseJobOrder(jobID, common.EJobStatus.Cancelling()).CancelledPauseResumed, chk.Equals, true)
+	c.Assert(CancelPauseJobOrder(jobID, common.EJobStatus.Paused()).CancelledPauseResumed, chk.Equals, false)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.Cancelling())
+}
+
+func (s *pauseJobSuite) TestPauseSurvivesRestart(c *chk.C) {
+	planDir := c.MkDir()
+	defer useTestJobsAdmin(c, &jobsAdmin{planDir: planDir})()
+
+	jobID := common.NewJobID()
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.Version = DataSchemaVersion
+	jpph.SetJobStatus(common.EJobStatus.InProgress())
+	planFile := writeTestPlanFile(c, jobID, 0, testPlanBytes(jpph, testPlanSize(jpph)))
+
+	// the job is paused through its plan file, as the engine running it would
+	mmf := planFile.Map()
+	mmf.Plan().SetJobStatus(common.EJobStatus.Paused())
+	mmf.Plan().Transfer(0).SetTransferStatus(common.ETransferStatus.Paused(), false)
+	mmf.Unmap()
+
+	// after a restart, the job is still paused, and nothing that acts on running jobs picks it up again
+	JobsAdmin = &jobsAdmin{planDir: planDir, jobIDToJobMgr: newJobIDToJobMgr()}
+	jobs := JobsAdmin.ListJobPlans()
+	c.Assert(jobs, chk.HasLen, 1)
+	c.Assert(jobs[0].JobId, chk.Equals, jobID)
+	c.Assert(jobs[0].JobStatus, chk.Equals, common.EJobStatus.Paused())
+	c.Assert(CancelAllJobs().CancelledJobIDs, chk.HasLen, 0)
+
+	mmf = planFile.Map()
+	defer mmf.Unmap()
+	c.Assert(mmf.Plan().JobStatus(), chk.Equals, common.EJobStatus.Paused())
+	c.Assert(mmf.Plan().Transfer(0).TransferStatus(), chk.Equals, common.ETransferStatus.Paused())
+}
+
+func (s *pauseJobSuite) TestPausedRunEndsWithPlanOnDisk(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	order := newTestOrder(common.NewJobID(), 0, "/a")
+	planFile := createTestPlanFile(order)
+
+	// the plan is only found under its real name, once it is complete
+	files, err := ioutil.ReadDir(JobsAdmin.AppPathFolder())
+	c.Assert(err, chk.IsNil)
+	c.Assert(files, chk.HasLen, 1)
+	c.Assert(files[0].Name(), chk.Equals, string(planFile))
+
+	mmf := planFile.Map()
+	defer mmf.Unmap()
+	jm := &jobMgr{jobID: order.JobID, jobPartMgrs: newJobPartToJobPartMgr(), logger: discardingJobLogger{},
+		chunkStatusLogger: common.NewChunkStatusLogger(order.JobID, common.NewNullCpuMonitor(), "", false),
+		maxDurationMu:     &sync.Mutex{}, sasExpiryMu: &sync.Mutex{}, jobPartProgress: make(chan jobPartProgressInfo)}
+	jm.planFlusher = newPlanFlusher(jm.flushPlanFiles, 0, 0)
+	atomic.StoreInt32(&jm.atomicFinalPartOrderedIndicator, 1)
+	jm.jobPartMgrs.Set(0, &jobPartMgr{jobMgr: jm, planMMF: mmf})
+	go jm.reportJobPartDoneHandler()
+
+	mmf.Plan().SetJobStatus(common.EJobStatus.Paused())
+	mmf.Plan().Transfer(0).SetTransferStatus(common.ETransferStatus.Paused(), false)
+	c.Assert(jm.runEnded(), chk.Equals, false)
+
+	// once the transfers in flight are done, the run ends, and the job is left paused, ready to be resumed
+	jm.ReportJobPartDone(jobPartProgressInfo{})
+	for deadline := time.Now().Add(5 * time.Second); !jm.runEnded() && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+	}
+	c.Assert(jm.runEnded(), chk.Equals, true)
+	c.Assert(mmf.Plan().JobStatus(), chk.Equals, common.EJobStatus.Paused())
+
+	onDisk, err := ioutil.ReadFile(planFile.GetJobPartPlanPath())
+	c.Assert(err, chk.IsNil)
+	plan, contents := newTestPlanBuffer(uintptr(len(onDisk)))
+	copy(contents, onDisk)
+	c.Assert(plan.JobStatus(), chk.Equals, common.EJobStatus.Paused())
+	c.Assert(plan.Transfer(0).TransferStatus(), chk.Equals, common.ETransferStatus.Paused())
+}
+
+// pausedDownloadJptm is a download whose completion is only noted, since there is no job to report it to
+type pausedDownloadJptm struct {
+	*jobPartTransferMgr
+	done bool
+}
+
+func (t *pausedDownloadJptm) HoldsDestinationLock() bool { return true }
+func (t *pausedDownloadJptm) EnsureDestinationUnlocked() {}
+func (t *pausedDownloadJptm) ReportTransferDone() uint32 { t.done = true; return 0 }
+
+func (s *pauseJobSuite) TestPausedDownloadResumesAfterTheChunksItSaved(c *chk.C) {
+	const chunkSize = 1024
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+
+	destinationFolder := c.MkDir()
+	order := common.CopyJobPartOrderRequest{
+		JobID:           common.NewJobID(),
+		FromTo:          common.EFromTo.BlobLocal(),
+		SourceRoot:      common.ResourceString{Value: "https://account.blob.core.windows.net/container"},
+		DestinationRoot: common.ResourceString{Value: destinationFolder},
+		Transfers:       []common.CopyTransfer{{Source: "/blob", Destination: "/file", SourceSize: 3 * chunkSize, EntityType: common.EEntityType.File()}},
+		IsFinalPart:     true,
+	}
+	mmf := createTestPlanFile(order).Map()
+	defer mmf.Unmap()
+
+	jm := &jobMgr{jobID: order.JobID, jobPartMgrs: newJobPartToJobPartMgr(), logger: discardingJobLogger{},
+		chunkStatusLogger: common.NewChunkStatusLogger(order.JobID, common.NewNullCpuMonitor(), "", false)}
+	jm.ctx, jm.cancel = context.WithCancel(context.Background())
+	defer jm.cancel()
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: mmf, jobCtx: jm.ctx}
+	jm.jobPartMgrs.Set(0, jpm)
+	JobsAdmin.(*jobsAdmin).jobIDToJobMgr.Set(order.JobID, jm)
+	mmf.Plan().SetJobStatus(common.EJobStatus.InProgress())
+
+	// the download has created its file at its full size, and saved its first chunk, when the job is paused
+	jptm := &pausedDownloadJptm{jobPartTransferMgr: jpm.newTransferMgr(jm.ctx, 0)}
+	info := jptm.Info()
+	c.Assert(ioutil.WriteFile(info.Destination, make([]byte, 3*chunkSize), 0644), chk.IsNil)
+	jptm.SetDestinationIsModified()
+	jptm.PrepareChunkTracking(chunkSize)
+	jptm.SetChunkStaged(0)
+
+	c.Assert(CancelPauseJobOrder(order.JobID, common.EJobStatus.Paused()).CancelledPauseResumed, chk.Equals, true)
+	c.Assert(jptm.WasCanceled(), chk.Equals, true)
+
+	// so the transfer stops, and is recorded as paused, with its file kept
+	jptm.SetStatus(common.ETransferStatus.Cancelled())
+	commonDownloaderCompletion(jptm, info, common.EEntityType.File())
+	c.Assert(jptm.done, chk.Equals, true)
+	c.Assert(mmf.Plan().Transfer(0).TransferStatus(), chk.Equals, common.ETransferStatus.Paused())
+	_, err := os.Stat(info.Destination)
+	c.Assert(err, chk.IsNil)
+
+	// and once resumed, the download carries on after the chunk it saved
+	mmf.Plan().SetJobStatus(common.EJobStatus.InProgress())
+	mmf.Plan().Transfer(0).SetTransferStatus(common.ETransferStatus.Started(), true)
+	resumed := jpm.newTransferMgr(context.Background(), 0)
+	c.Assert(savedDownloadPrefix(resumed, resumed.Info(), 3*chunkSize, chunkSize, 3), chk.Equals, int64(chunkSize))
+}
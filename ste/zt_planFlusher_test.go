@@ -0,0 +1,154 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type planFlusherTestSuite struct{}
+
+var _ = chk.Suite(&planFlusherTestSuite{})
+
+// flushCounter counts the flushes of a planFlusher
+type flushCounter struct {
+	atomicFlushes int32
+}
+
+func (fc *flushCounter) flush() { atomic.AddInt32(&fc.atomicFlushes, 1) }
+
+func (fc *flushCounter) flushes() int32 { return atomic.LoadInt32(&fc.atomicFlushes) }
+
+func (fc *flushCounter) waitForFlushes(n int32) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if fc.flushes() >= n {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *planFlusherTestSuite) TestPlanFlusherFlushesAfterTransfers(c *chk.C) {
+	counter := &flushCounter{}
+	flusher := newPlanFlusher(counter.flush, 0, 3)
+	flusher.start()
+
+	flusher.noteTransferDone()
+	flusher.noteTransferDone()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(counter.flushes(), chk.Equals, int32(0))
+	flusher.noteTransferDone()
+	c.Assert(counter.waitForFlushes(1), chk.Equals, true)
+
+	// once the run is over, the job flushes its plan files itself
+	flusher.end()
+	for i := 0; i < 3; i++ {
+		flusher.noteTransferDone()
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(counter.flushes(), chk.Equals, int32(1))
+}
+
+func (s *planFlusherTestSuite) TestPlanFlusherFlushesOnInterval(c *chk.C) {
+	counter := &flushCounter{}
+	flusher := newPlanFlusher(counter.flush, 10*time.Millisecond, 0)
+	flusher.start()
+	c.Assert(counter.waitForFlushes(2), chk.Equals, true)
+
+	flusher.end()
+	time.Sleep(20 * time.Millisecond) // for a flush that was under way
+	flushes := counter.flushes()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(counter.flushes(), chk.Equals, flushes)
+}
+
+func (s *planFlusherTestSuite) TestPlanFlusherDisabled(c *chk.C) {
+	counter := &flushCounter{}
+	flusher := newPlanFlusher(counter.flush, 0, 0)
+	flusher.start()
+	defer flusher.end()
+	c.Assert(flusher.stop, chk.IsNil)
+	flusher.noteTransferDone()
+	time.Sleep(20 * time.Millisecond)
+	c.Assert(counter.flushes(), chk.Equals, int32(0))
+}
+
+func (s *planFlusherTestSuite) TestPlanFlusherEndWaitsForFlushUnderWay(c *chk.C) {
+	flushing, release := make(chan struct{}), make(chan struct{})
+	flusher := newPlanFlusher(func() {
+		close(flushing)
+		<-release
+	}, 0, 1)
+	flusher.start()
+	flusher.noteTransferDone()
+	<-flushing
+
+	ended := make(chan struct{})
+	go func() {
+		flusher.end()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		c.Fatal("end returned while a flush was under way, so the plan files could be unmapped beneath it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		c.Fatal("end didn't return once the flush was over")
+	}
+}
+
+func (s *planFlusherTestSuite) TestJobFlushesPlanAsTransfersFinish(c *chk.C) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+	order := newTestOrder(common.NewJobID(), 0, "/file", "/file", "/file")
+	for i := range order.Transfers {
+		order.Transfers[i].SourceSize = int64(100 * (i + 1))
+	}
+	mmf := createTestPlanFile(order).Map()
+	defer mmf.Unmap()
+
+	// the job's flusher is given the job's own flush, as newJobMgr does
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr(), logger: discardingJobLogger{}}
+	counter := &flushCounter{}
+	jm.planFlusher = newPlanFlusher(func() {
+		jm.flushPlanFiles()
+		counter.flush()
+	}, 0, 2)
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: mmf}
+	jm.jobPartMgrs.Set(0, jpm)
+	jm.planFlusher.start()
+	defer jm.planFlusher.end()
+
+	// finishing transfers through the job part, as a run does, flushes the plan once every two of them
+	jpm.ReportTransferDone(common.ETransferStatus.Success())
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(counter.flushes(), chk.Equals, int32(0))
+	jpm.ReportTransferDone(common.ETransferStatus.Success())
+	c.Assert(counter.waitForFlushes(1), chk.Equals, true)
+}
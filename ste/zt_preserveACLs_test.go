@@ -0,0 +1,166 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/azbfs"
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	chk "gopkg.in/check.v1"
+)
+
+type preserveACLsSuite struct{}
+
+var _ = chk.Suite(&preserveACLsSuite{})
+
+func (s *preserveACLsSuite) TestDfsURL(c *chk.C) {
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/dir/file?sv=2019-12-12&sig=secret")
+	converted := dfsURL(*u)
+	c.Assert(converted.String(), chk.Equals, "https://account.dfs.core.windows.net/container/dir/file?sv=2019-12-12&sig=secret")
+	// the original is left alone
+	c.Assert(u.Host, chk.Equals, "account.blob.core.windows.net")
+
+	// hosts without a blob endpoint suffix, such as emulators, are used as they are
+	u, _ = url.Parse("http://127.0.0.1:10000/account/container/file")
+	converted = dfsURL(*u)
+	c.Assert(converted.String(), chk.Equals, u.String())
+}
+
+func (s *preserveACLsSuite) TestAccessControlRoundTrip(c *chk.C) {
+	const acl = "user::rwx,user:6a3b1f0e-7c9d-4e2a-9f1b-0c8d7e6f5a4b:r-x,group::r-x,mask::r-x,other::---,default:user::rwx,default:group::---,default:other::---"
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, chk.Equals, http.MethodHead)
+		c.Check(r.URL.Query().Get("action"), chk.Equals, "getAccessControl")
+		c.Check(r.URL.Query().Get("upn"), chk.Equals, "false")
+		w.Header().Set("x-ms-owner", "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0")
+		w.Header().Set("x-ms-group", "$superuser")
+		w.Header().Set("x-ms-acl", acl)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer source.Close()
+	var set *http.Request
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+
+	// as in a transfer, the requests go through the pipelines of the blob endpoint
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	srcURL, _ := url.Parse(source.URL + "/account/container/dir/file")
+	ac, err := azbfs.NewFileURL(*srcURL, p).GetAccessControl(context.Background())
+	c.Assert(err, chk.IsNil)
+	c.Assert(ac, chk.Equals, azbfs.BlobFSAccessControl{Owner: "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0", Group: "$superuser", ACL: acl})
+
+	dstURL, _ := url.Parse(destination.URL + "/account/container/dir/file")
+	_, err = azbfs.NewFileURL(*dstURL, p).SetAccessControl(context.Background(), ac)
+	c.Assert(err, chk.IsNil)
+	c.Assert(set, chk.NotNil)
+	c.Assert(set.Header.Get("X-Http-Method-Override"), chk.Equals, "PATCH")
+	c.Assert(set.URL.Query().Get("action"), chk.Equals, "setAccessControl")
+	c.Assert(set.URL.Path, chk.Equals, "/account/container/dir/file")
+	c.Assert(set.Header.Get("x-ms-owner"), chk.Equals, ac.Owner)
+	c.Assert(set.Header.Get("x-ms-group"), chk.Equals, ac.Group)
+	c.Assert(set.Header.Get("x-ms-acl"), chk.Equals, acl)
+}
+
+// sentFileSender is a sender whose file has already been sent, so that only the epilogue is left to run
+type sentFileSender struct{}
+
+func (sentFileSender) ChunkSize() int64                           { return 0 }
+func (sentFileSender) NumChunks() uint32                          { return 1 }
+func (sentFileSender) RemoteFileExists() (bool, time.Time, error) { return false, time.Time{}, nil }
+func (sentFileSender) Prologue(common.PrologueState) bool         { return true }
+func (sentFileSender) Epilogue()                                  {}
+func (sentFileSender) Cleanup()                                   {}
+func (sentFileSender) GetDestinationLength() (int64, error)       { return 0, nil }
+
+// remoteSourceInfoProvider is a remote source without an access control list
+type remoteSourceInfoProvider struct{}
+
+func (remoteSourceInfoProvider) Properties() (*SrcProperties, error) { return &SrcProperties{}, nil }
+func (remoteSourceInfoProvider) GetFreshFileLastModifiedTime() (time.Time, error) {
+	return time.Time{}, nil
+}
+func (remoteSourceInfoProvider) IsLocal() bool                 { return false }
+func (remoteSourceInfoProvider) EntityType() common.EntityType { return common.EEntityType.File() }
+
+// aclSourceInfoProvider is a remote source that has an access control list
+type aclSourceInfoProvider struct {
+	remoteSourceInfoProvider
+	ac azbfs.BlobFSAccessControl
+}
+
+func (p aclSourceInfoProvider) GetAccessControl() (azbfs.BlobFSAccessControl, error) {
+	return p.ac, nil
+}
+
+// newACLEpilogueTest returns the transfer of a file to the given destination, that preserves ACLs, and whose data has all been sent
+func newACLEpilogueTest(c *chk.C, destination string) (*jobMgr, *jobPartTransferMgr) {
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.FromTo = common.EFromTo.BlobBlob()
+	jm := &jobMgr{jobPartMgrs: newJobPartToJobPartMgr(), logger: discardingJobLogger{}, maxDurationMu: &sync.Mutex{},
+		chunkStatusLogger: common.NewChunkStatusLogger(common.NewJobID(), common.NewNullCpuMonitor(), "", false),
+		jobPartProgress:   make(chan jobPartProgressInfo, 1)}
+	jm.planFlusher = newPlanFlusher(jm.flushPlanFiles, 0, 0)
+	jpm := &jobPartMgr{jobMgr: jm, planMMF: newTestPlanMMF(c, jpph)}
+	jptm := jpm.newTransferMgr(context.Background(), 0)
+	jptm.transferInfo = &TransferInfo{Source: "https://src.blob.core.windows.net/container/file", Destination: destination,
+		EntityType: common.EEntityType.File(), PreserveACLs: true}
+	jptm.SetStatus(common.ETransferStatus.Started())
+	return jm, jptm
+}
+
+func (s *preserveACLsSuite) TestEpilogueSetsAccessControl(c *chk.C) {
+	var set *http.Request
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer destination.Close()
+	jm, jptm := newACLEpilogueTest(c, destination.URL+"/account/container/file")
+	sip := aclSourceInfoProvider{ac: azbfs.BlobFSAccessControl{Owner: "owner", Group: "group", ACL: "user::rwx,group::r-x,other::---"}}
+
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	epilogueWithCleanupSendToRemote(jptm, sentFileSender{}, sip, p)
+	c.Assert(set, chk.NotNil)
+	c.Assert(set.URL.Query().Get("action"), chk.Equals, "setAccessControl")
+	c.Assert(set.Header.Get("x-ms-acl"), chk.Equals, sip.ac.ACL)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Success())
+	c.Assert(<-jm.jobPartProgress, chk.Equals, jobPartProgressInfo{transfersCompleted: 1})
+}
+
+func (s *preserveACLsSuite) TestEpilogueFailsTransferOfSourceWithoutAccessControl(c *chk.C) {
+	jm, jptm := newACLEpilogueTest(c, "https://dst.blob.core.windows.net/container/file")
+
+	p := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})
+	epilogueWithCleanupSendToRemote(jptm, sentFileSender{}, remoteSourceInfoProvider{}, p)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(<-jm.jobPartProgress, chk.Equals, jobPartProgressInfo{transfersFailed: 1})
+}
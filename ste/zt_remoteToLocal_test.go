@@ -0,0 +1,118 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	chk "gopkg.in/check.v1"
+)
+
+type remoteToLocalTestSuite struct{}
+
+var _ = chk.Suite(&remoteToLocalTestSuite{})
+
+func (s *remoteToLocalTestSuite) TestCheckDownloadLength(c *chk.C) {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(path, []byte("0123456789"), 0644), chk.IsNil)
+	c.Assert(checkDownloadLength(path, 10), chk.IsNil)
+
+	// a download that was cut short, e.g. because the connection dropped without an error
+	c.Assert(ioutil.WriteFile(path, []byte("0123"), 0644), chk.IsNil)
+	err := checkDownloadLength(path, 10)
+	c.Assert(err, chk.NotNil)
+	c.Assert(err.Error(), chk.Equals, "destination length 4 did not match source length 10")
+
+	c.Assert(checkDownloadLength(filepath.Join(c.MkDir(), "missing"), 10), chk.NotNil)
+}
+
+func (s *remoteToLocalTestSuite) TestSetLastModifiedTime(c *chk.C) {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(path, []byte("0123456789"), 0644), chk.IsNil)
+
+	// the source's last modified time goes through the job plan as nanoseconds, so round trip it the same way
+	sourceLastModified := time.Date(2019, 3, 1, 10, 20, 30, 0, time.UTC)
+	c.Assert(setLastModifiedTime(path, time.Unix(0, sourceLastModified.UnixNano())), chk.IsNil)
+
+	fi, err := os.Stat(path)
+	c.Assert(err, chk.IsNil)
+	c.Assert(fi.ModTime().Equal(sourceLastModified), chk.Equals, true, chk.Commentf("got %v", fi.ModTime()))
+
+	// the caller reports this as a warning rather than failing the transfer
+	c.Assert(setLastModifiedTime(filepath.Join(c.MkDir(), "missing"), sourceLastModified), chk.NotNil)
+}
+
+// lastModifiedTimeTestJptm is a download whose job does, or doesn't, preserve last modified times, and that notes what it logs
+type lastModifiedTimeTestJptm struct {
+	IJobPartTransferMgr
+	lastModifiedTime time.Time
+	preserve         bool
+	warnings         []string
+}
+
+func (t *lastModifiedTimeTestJptm) PreserveLastModifiedTime() (time.Time, bool) {
+	return t.lastModifiedTime, t.preserve
+}
+
+func (t *lastModifiedTimeTestJptm) Log(level pipeline.LogLevel, msg string) {
+	if level == pipeline.LogWarning {
+		t.warnings = append(t.warnings, msg)
+	}
+}
+
+func (s *remoteToLocalTestSuite) TestDownloadPreservesLastModifiedTime(c *chk.C) {
+	sourceLastModified := time.Date(2019, 3, 1, 10, 20, 30, 0, time.UTC)
+	newFile := func() (path string, writtenAt time.Time) {
+		path = filepath.Join(c.MkDir(), "file")
+		c.Assert(ioutil.WriteFile(path, []byte("0123456789"), 0644), chk.IsNil)
+		fi, err := os.Stat(path)
+		c.Assert(err, chk.IsNil)
+		return path, fi.ModTime()
+	}
+	modTime := func(path string) time.Time {
+		fi, err := os.Stat(path)
+		c.Assert(err, chk.IsNil)
+		return fi.ModTime()
+	}
+
+	// the file gets the time of its source
+	path, _ := newFile()
+	jptm := &lastModifiedTimeTestJptm{lastModifiedTime: sourceLastModified, preserve: true}
+	preserveLastModifiedTime(jptm, TransferInfo{Destination: path})
+	c.Assert(modTime(path).Equal(sourceLastModified), chk.Equals, true)
+	c.Assert(jptm.warnings, chk.HasLen, 0)
+
+	// unless the job doesn't preserve it, or the SMB properties (which include the time) are restored instead
+	path, writtenAt := newFile()
+	preserveLastModifiedTime(&lastModifiedTimeTestJptm{lastModifiedTime: sourceLastModified}, TransferInfo{Destination: path})
+	c.Assert(modTime(path).Equal(writtenAt), chk.Equals, true)
+	preserveLastModifiedTime(&lastModifiedTimeTestJptm{lastModifiedTime: sourceLastModified, preserve: true}, TransferInfo{Destination: path, PreserveSMBInfo: true})
+	c.Assert(modTime(path).Equal(writtenAt), chk.Equals, true)
+
+	// a file system that won't set it only gets a warning
+	jptm = &lastModifiedTimeTestJptm{lastModifiedTime: sourceLastModified, preserve: true}
+	preserveLastModifiedTime(jptm, TransferInfo{Destination: filepath.Join(c.MkDir(), "missing")})
+	c.Assert(jptm.warnings, chk.HasLen, 1)
+}
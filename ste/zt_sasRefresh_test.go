@@ -0,0 +1,177 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type sasRefreshTestSuite struct{}
+
+var _ = chk.Suite(&sasRefreshTestSuite{})
+
+// fakeSASTokenProvider hands out the SAS tokens it is given, by role
+type fakeSASTokenProvider struct {
+	mu     *sync.Mutex
+	tokens map[string]string
+	err    error
+	// roleErrs fails the roles it names, whatever err is
+	roleErrs map[string]error
+	calls    int
+}
+
+func (p *fakeSASTokenProvider) NewSAS(ctx context.Context, role string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if err := p.roleErrs[role]; err != nil {
+		return "", err
+	}
+	return p.tokens[role], p.err
+}
+
+func sasExpiringAt(expiry time.Time, sig string) string {
+	return "sv=2019-12-12&sp=rw&se=" + url.QueryEscape(expiry.UTC().Format(time.RFC3339)) + "&sig=" + sig
+}
+
+func (s *sasRefreshTestSuite) TestReplacedSASIsSwappedInURL(c *chk.C) {
+	tokens := newJobSASTokens()
+	tokens.set("sv=2019-12-12&se=2020-10-22&sr=c&sig=oldsrc", "sv=2019-12-12&se=2020-10-22&sig=olddst")
+
+	// nothing is swapped before a refresh
+	u := "https://account.blob.core.windows.net/c/b?blockid=AAA%3D&comp=block&se=2020-10-22&sig=olddst&sv=2019-12-12"
+	c.Assert(tokens.updateURL(u), chk.Equals, u)
+
+	tokens.set("sv=2019-12-12&se=2020-10-22&sr=c&sig=oldsrc", "sv=2020-02-10&se=2020-10-23&sig=newdst")
+	c.Assert(tokens.updateURL(u), chk.Equals, "https://account.blob.core.windows.net/c/b?blockid=AAA%3D&comp=block&se=2020-10-23&sig=newdst&sv=2020-02-10")
+
+	// the source token was not replaced, and other URLs are left alone
+	src := "https://account.blob.core.windows.net/c/b?se=2020-10-22&sig=oldsrc&sr=c&sv=2019-12-12&versionId=1"
+	c.Assert(tokens.updateURL(src), chk.Equals, src)
+	c.Assert(tokens.updateURL("https://account.blob.core.windows.net/c/b"), chk.Equals, "https://account.blob.core.windows.net/c/b")
+
+	// the SAS parameters of the old token are all dropped, even those the new token does not have
+	tokens.set("sv=2019-12-12&se=2020-10-23&sig=newsrc", "sv=2020-02-10&se=2020-10-23&sig=newdst")
+	c.Assert(tokens.updateURL(src), chk.Equals, "https://account.blob.core.windows.net/c/b?se=2020-10-23&sig=newsrc&sv=2019-12-12&versionId=1")
+}
+
+func (s *sasRefreshTestSuite) TestRefreshSASTokens(c *chk.C) {
+	now := time.Now()
+	soon := sasExpiringAt(now.Add(5*time.Minute), "soon")
+	later := sasExpiringAt(now.Add(time.Hour), "later")
+	refreshed := sasExpiringAt(now.Add(2*time.Hour), "refreshed")
+	provider := &fakeSASTokenProvider{mu: &sync.Mutex{}, tokens: map[string]string{sasRoleSource: refreshed, sasRoleDestination: refreshed}}
+
+	// only the token that expires before the deadline is refreshed
+	tokens := newJobSASTokens()
+	tokens.set(soon, later)
+	c.Assert(refreshSASTokens(context.Background(), provider, tokens, now.Add(sasRefreshLeadTime)), chk.IsNil)
+	source, destination := tokens.current()
+	c.Assert(source, chk.Equals, refreshed)
+	c.Assert(destination, chk.Equals, later)
+	c.Assert(provider.calls, chk.Equals, 1)
+
+	// a token that does not last longer than the old one is refused
+	tokens.set(soon, "")
+	provider.tokens[sasRoleSource] = sasExpiringAt(now.Add(time.Minute), "shorter")
+	c.Assert(refreshSASTokens(context.Background(), provider, tokens, now.Add(sasRefreshLeadTime)), chk.NotNil)
+	source, _ = tokens.current()
+	c.Assert(source, chk.Equals, soon)
+
+	// the destination is still refreshed when the source cannot be
+	tokens.set(soon, soon)
+	provider.tokens[sasRoleSource] = refreshed
+	provider.roleErrs = map[string]error{sasRoleSource: errors.New("source account unavailable")}
+	c.Assert(refreshSASTokens(context.Background(), provider, tokens, now.Add(sasRefreshLeadTime)), chk.NotNil)
+	source, destination = tokens.current()
+	c.Assert(source, chk.Equals, soon)
+	c.Assert(destination, chk.Equals, refreshed)
+	provider.roleErrs = nil
+
+	provider.err = errors.New("no token today")
+	c.Assert(refreshSASTokens(context.Background(), provider, tokens, now.Add(sasRefreshLeadTime)), chk.NotNil)
+}
+
+func (s *sasRefreshTestSuite) TestMissingSASSwitches(c *chk.C) {
+	// an endpoint that did not use a SAS token (e.g. Azure AD, S3 or local) needs none to resume
+	plan := &JobPartPlanHeader{}
+	c.Assert(missingSASSwitches(plan, "", ""), chk.Equals, "")
+
+	plan.SourceSASRequired = true
+	c.Assert(missingSASSwitches(plan, "", "sig=dst"), chk.Matches, "The source-sas .*")
+	c.Assert(missingSASSwitches(plan, "sig=src", ""), chk.Equals, "")
+
+	plan.SourceSASRequired, plan.DestinationSASRequired = false, true
+	c.Assert(missingSASSwitches(plan, "sig=src", ""), chk.Matches, "The destination-sas .*")
+
+	plan.SourceSASRequired = true
+	c.Assert(missingSASSwitches(plan, "", ""), chk.Matches, "Both .*")
+	c.Assert(missingSASSwitches(plan, "sig=src", "sig=dst"), chk.Equals, "")
+}
+
+func (s *sasRefreshTestSuite) TestJobRefreshesSASBeforeExpiry(c *chk.C) {
+	jm, jpm := newJobMgrForMaxDurationTest(c, time.Now())
+	jm.sasExpiryMu = &sync.Mutex{}
+	jm.sasTokens = newJobSASTokens()
+	jpm.Plan().SetJobStatus(common.EJobStatus.InProgress())
+
+	// SAS expiry times are to the second, so allow a couple of seconds before the refresh is due
+	expiring := sasExpiringAt(time.Now().Add(sasRefreshLeadTime+2*time.Second), "expiring")
+	refreshed := sasExpiringAt(time.Now().Add(2*time.Hour), "refreshed")
+	provider := &fakeSASTokenProvider{mu: &sync.Mutex{}, tokens: map[string]string{sasRoleSource: refreshed}}
+	jm.setInMemoryTransitJobState(InMemoryTransitJobState{sasTokenProvider: provider})
+	jm.startSASExpiryTimer(expiring, "")
+	defer jm.stopSASExpiryTimer()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if source, _ := jm.sasTokens.current(); source == refreshed {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	source, _ := jm.sasTokens.current()
+	c.Assert(source, chk.Equals, refreshed)
+	c.Assert(jpm.Plan().JobStatus(), chk.Equals, common.EJobStatus.InProgress())
+}
+
+func (s *sasRefreshTestSuite) TestCommandSASTokenProvider(c *chk.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("the command is written for sh")
+	}
+	sas, err := NewCommandSASTokenProvider(`echo "?sv=2019-12-12&sig=for-$AZCOPY_SAS_ROLE"`).NewSAS(context.Background(), sasRoleDestination)
+	c.Assert(err, chk.IsNil)
+	c.Assert(sas, chk.Equals, "sv=2019-12-12&sig=for-destination")
+
+	_, err = NewCommandSASTokenProvider("exit 3").NewSAS(context.Background(), sasRoleSource)
+	c.Assert(err, chk.NotNil)
+	_, err = NewCommandSASTokenProvider("true").NewSAS(context.Background(), sasRoleSource)
+	c.Assert(err, chk.NotNil)
+}
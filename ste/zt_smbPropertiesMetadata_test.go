@@ -0,0 +1,106 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	"github.com/Azure/azure-storage-file-go/azfile"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+)
+
+type smbPropertiesMetadataSuite struct{}
+
+var _ = chk.Suite(&smbPropertiesMetadataSuite{})
+
+// testSMBPropertySource stands in for a local Windows file
+type testSMBPropertySource struct {
+	ISourceInfoProvider
+	sddl  string
+	props smbPropertiesFromMetadata
+}
+
+func (s testSMBPropertySource) GetSDDL() (string, error) {
+	return s.sddl, nil
+}
+
+func (s testSMBPropertySource) GetSMBProperties() (TypedSMBPropertyHolder, error) {
+	return s.props, nil
+}
+
+func (s *smbPropertiesMetadataSuite) TestRoundTrip(c *chk.C) {
+	source := testSMBPropertySource{
+		sddl: "O:S-1-5-32-544G:S-1-5-32-544D:P(A;;FA;;;S-1-1-0)",
+		props: smbPropertiesFromMetadata{
+			attributes:    azfile.FileAttributeFlags(0x1 | 0x2 | 0x4), // read only, hidden, system
+			creationTime:  time.Date(2019, 3, 1, 10, 20, 30, 123456700, time.UTC),
+			lastWriteTime: time.Date(2020, 4, 2, 11, 21, 31, 0, time.UTC),
+		},
+	}
+	info := TransferInfo{PreserveSMBPermissions: common.EPreservePermissionsOption.OwnershipAndACLs(), PreserveSMBInfo: true}
+	original := common.Metadata{"foo": "bar"}
+
+	m, err := addSMBPropertiesToMetadata(source, info, original)
+	c.Assert(err, chk.IsNil)
+	c.Assert(m["foo"], chk.Equals, "bar")
+	c.Assert(m[smbAttributesMeta], chk.Equals, "7")
+	c.Assert(original, chk.HasLen, 1) // the caller's map is left alone
+
+	restored := metadataSMBPropertyProvider{metadata: m}
+	sddlString, err := restored.GetSDDL()
+	c.Assert(err, chk.IsNil)
+	c.Assert(sddlString, chk.Equals, source.sddl)
+	c.Assert(restored.hasSMBProperties(), chk.Equals, true)
+	props, err := restored.GetSMBProperties()
+	c.Assert(err, chk.IsNil)
+	c.Assert(props.FileAttributes(), chk.Equals, source.props.attributes)
+	c.Assert(props.FileCreationTime().Equal(source.props.creationTime), chk.Equals, true)
+	c.Assert(props.FileLastWriteTime().Equal(source.props.lastWriteTime), chk.Equals, true)
+}
+
+func (s *smbPropertiesMetadataSuite) TestOnlyRequestedPropertiesAreSaved(c *chk.C) {
+	source := testSMBPropertySource{sddl: "D:(A;;FA;;;S-1-1-0)"}
+
+	m, err := addSMBPropertiesToMetadata(source, TransferInfo{PreserveSMBPermissions: common.EPreservePermissionsOption.OwnershipAndACLs()}, nil)
+	c.Assert(err, chk.IsNil)
+	c.Assert(m, chk.HasLen, 1)
+	c.Assert(m[smbSDDLMeta], chk.Equals, source.sddl)
+
+	restored := metadataSMBPropertyProvider{metadata: m}
+	c.Assert(restored.hasSMBProperties(), chk.Equals, false)
+}
+
+func (s *smbPropertiesMetadataSuite) TestInvalidMetadata(c *chk.C) {
+	m := common.Metadata{
+		smbAttributesMeta:    "32",
+		smbCreationTimeMeta:  "yesterday",
+		smbLastWriteTimeMeta: "2020-04-02T11:21:31Z",
+	}
+	_, err := metadataSMBPropertyProvider{metadata: m}.GetSMBProperties()
+	c.Assert(err, chk.NotNil)
+
+	m[smbCreationTimeMeta] = m[smbLastWriteTimeMeta]
+	m[smbAttributesMeta] = "-1"
+	_, err = metadataSMBPropertyProvider{metadata: m}.GetSMBProperties()
+	c.Assert(err, chk.NotNil)
+}
@@ -0,0 +1,103 @@
+// +build windows
+
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-file-go/azfile"
+	"golang.org/x/sys/windows"
+	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-azcopy/sddl"
+)
+
+// getTestDACL returns the DACL of the file at path, as SDDL
+func getTestDACL(c *chk.C, path string) string {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	c.Assert(err, chk.IsNil)
+	return sd.String()
+}
+
+func (s *smbPropertiesMetadataSuite) TestRoundTripOfACLdFile(c *chk.C) {
+	dir, err := ioutil.TempDir("", "smbprops")
+	c.Assert(err, chk.IsNil)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	dest := filepath.Join(dir, "dest")
+	c.Assert(ioutil.WriteFile(source, []byte("a"), 0666), chk.IsNil)
+	c.Assert(ioutil.WriteFile(dest, []byte("a"), 0666), chk.IsNil)
+
+	// give the source a protected DACL that differs from what it inherits: full control for Everyone, read for Users
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;FA;;;WD)(A;;FR;;;BU)")
+	c.Assert(err, chk.IsNil)
+	dacl, _, err := sd.DACL()
+	c.Assert(err, chk.IsNil)
+	err = windows.SetNamedSecurityInfo(source, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+	c.Assert(err, chk.IsNil)
+
+	// capture it as an upload would (see localFileSourceInfoProvider.GetSDDL), and save it in metadata
+	sourceSDDL := getTestDACL(c, source)
+	parsed, err := sddl.ParseSDDL(sourceSDDL)
+	c.Assert(err, chk.IsNil)
+	creationTime := time.Date(2019, 3, 1, 10, 20, 30, 0, time.UTC)
+	local := testSMBPropertySource{
+		sddl: parsed.PortableString(),
+		props: smbPropertiesFromMetadata{
+			attributes:    azfile.FileAttributeFlags(windows.FILE_ATTRIBUTE_HIDDEN),
+			creationTime:  creationTime,
+			lastWriteTime: creationTime.Add(time.Hour),
+		},
+	}
+	info := TransferInfo{
+		Destination:            dest,
+		PreserveSMBPermissions: common.EPreservePermissionsOption.ACLsOnly(), // setting the owner may take privileges that the test doesn't have
+		PreserveSMBInfo:        true,
+	}
+	m, err := addSMBPropertiesToMetadata(local, info, nil)
+	c.Assert(err, chk.IsNil)
+
+	// restore it as a download would
+	restored := metadataSMBPropertyProvider{metadata: m}
+	c.Assert(putLocalSDDL(restored, info, dir, false), chk.IsNil)
+	c.Assert(putLocalSMBProperties(restored, info), chk.IsNil)
+
+	c.Assert(getTestDACL(c, dest), chk.Equals, sourceSDDL)
+
+	destPtr, err := syscall.UTF16PtrFromString(dest)
+	c.Assert(err, chk.IsNil)
+	attributes, err := windows.GetFileAttributes(destPtr)
+	c.Assert(err, chk.IsNil)
+	c.Assert(attributes&windows.FILE_ATTRIBUTE_HIDDEN, chk.Not(chk.Equals), uint32(0))
+
+	fileInfo, err := common.GetFileInformation(dest)
+	c.Assert(err, chk.IsNil)
+	c.Assert(time.Unix(0, fileInfo.CreationTime.Nanoseconds()).Equal(creationTime), chk.Equals, true)
+}
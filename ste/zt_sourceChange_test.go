@@ -0,0 +1,192 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+type sourceChangeSuite struct{}
+
+var _ = chk.Suite(&sourceChangeSuite{})
+
+// newSourceChangeTest returns the transfer, in a part of its own, of an upload of the given local file, as it was when it was enumerated
+func newSourceChangeTest(c *chk.C, path string, retryChangedFiles bool, maxRetries int32) (*jobPartMgr, *jobPartTransferMgr) {
+	info, err := os.Stat(path)
+	c.Assert(err, chk.IsNil)
+	jpph := newTestPlanWithOneTransfer(0)
+	jpph.FromTo = common.EFromTo.LocalBlob()
+	jpph.RetryChangedFiles = retryChangedFiles
+	jpph.MaxRetries = maxRetries
+	jpph.TotalBytes = uint64(info.Size())
+	jpph.Transfer(0).EntityType = common.EEntityType.File()
+	jpph.Transfer(0).SourceSize = info.Size()
+	jpph.Transfer(0).ModifiedTime = info.ModTime().UnixNano()
+
+	jpm := newTestJobPartMgr(newTestPlanMMF(c, jpph))
+	jptm := jpm.newTransferMgr(jpm.jobCtx, 0)
+	jptm.transferInfo = &TransferInfo{Source: path, Destination: "https://account.blob.core.windows.net/container/file.txt",
+		SourceSize: info.Size(), EntityType: common.EEntityType.File()}
+	jptm.SetStatus(common.ETransferStatus.Started())
+	return jpm, jptm
+}
+
+func writeSourceFile(c *chk.C, contents string) string {
+	path := filepath.Join(c.MkDir(), "file.txt")
+	c.Assert(ioutil.WriteFile(path, []byte(contents), 0644), chk.IsNil)
+	return path
+}
+
+func (s *sourceChangeSuite) TestUnchangedSourcePasses(c *chk.C) {
+	path := writeSourceFile(c, "some data")
+	_, jptm := newSourceChangeTest(c, path, false, 0)
+	sip, _ := newLocalSourceInfoProvider(jptm)
+
+	checkSourceUnchanged(jptm, sip)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Started())
+	c.Assert(jptm.WasCanceled(), chk.Equals, false)
+}
+
+func (s *sourceChangeSuite) TestSourceChangedDuringTransferFailsIt(c *chk.C) {
+	path := writeSourceFile(c, "some data")
+	jpm, jptm := newSourceChangeTest(c, path, false, 0)
+	sip, _ := newLocalSourceInfoProvider(jptm)
+
+	// the file is appended to while it is being sent
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	c.Assert(err, chk.IsNil)
+	_, err = file.WriteString(", and some more")
+	c.Assert(err, chk.IsNil)
+	c.Assert(file.Close(), chk.IsNil)
+	changedAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	c.Assert(os.Chtimes(path, changedAt, changedAt), chk.IsNil)
+
+	checkSourceUnchanged(jptm, sip)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(jptm.WasCanceled(), chk.Equals, true)
+	c.Assert(jptm.retryAfterSourceChange, chk.Equals, false)
+
+	// the plan now describes the file as it is, so that a retry sends (and checks against) that
+	plan := jpm.Plan()
+	c.Assert(plan.Transfer(0).SourceSize, chk.Equals, int64(len("some data, and some more")))
+	c.Assert(time.Unix(0, plan.Transfer(0).ModifiedTime).Equal(changedAt), chk.Equals, true)
+	c.Assert(plan.TotalBytes, chk.Equals, uint64(len("some data, and some more")))
+}
+
+func (s *sourceChangeSuite) TestChangedTimeAloneFailsTransfer(c *chk.C) {
+	path := writeSourceFile(c, "some data")
+	jpm, jptm := newSourceChangeTest(c, path, false, 0)
+	changedAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	c.Assert(os.Chtimes(path, changedAt, changedAt), chk.IsNil)
+
+	// as if the source couldn't tell its size, so only its last modified time is compared
+	jptm.FailSourceChanged("testing", changedAt, jptm.Info().SourceSize)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(jpm.Plan().Transfer(0).SourceSize, chk.Equals, int64(len("some data")))
+	c.Assert(time.Unix(0, jpm.Plan().Transfer(0).ModifiedTime).Equal(changedAt), chk.Equals, true)
+}
+
+func (s *sourceChangeSuite) TestChangedSourceIsRetriedWhenTheJobSaysSo(c *chk.C) {
+	scheduled := make(chan IJobPartTransferMgr, 1)
+	defer useTestJobsAdmin(c, &jobsAdmin{coordinatorChannels: CoordinatorChannels{normalTransferCh: scheduled}})()
+
+	path := writeSourceFile(c, "some data")
+	jpm, jptm := newSourceChangeTest(c, path, true, 1)
+	c.Assert(ioutil.WriteFile(path, []byte("other data, of another size"), 0644), chk.IsNil)
+	sip, _ := newLocalSourceInfoProvider(jptm)
+
+	checkSourceUnchanged(jptm, sip)
+	c.Assert(jptm.retryAfterSourceChange, chk.Equals, true)
+	// the transfer isn't done, since it is to be started again
+	c.Assert(jptm.ReportTransferDone(), chk.Equals, uint32(0))
+	c.Assert(jpm.Plan().Transfer(0).TransferStatus(), chk.Equals, common.ETransferStatus.Started())
+	c.Assert(jpm.Plan().Transfer(0).RetryCount(), chk.Equals, uint32(1))
+
+	// after the back-off, a fresh run of it is scheduled
+	select {
+	case retried := <-scheduled:
+		c.Assert(retried, chk.Not(chk.Equals), IJobPartTransferMgr(jptm))
+		c.Assert(retried.Info().SourceSize, chk.Equals, int64(len("other data, of another size")))
+	case <-time.After(5 * time.Second):
+		c.Fatal("the changed transfer was not retried")
+	}
+
+	// but once it has had the retries the job allows, it stays failed
+	c.Assert(jpm.retryTransfer(0), chk.Equals, false)
+	c.Assert(jpm.Plan().Transfer(0).RetryCount(), chk.Equals, uint32(1))
+}
+
+// newDigestTest returns the transfer of an upload of a 20-byte file, in a plan with room for its digest, as the engine lays it out
+func newDigestTest(c *chk.C) (*jobPartMgr, *jobPartTransferMgr) {
+	defer useTestJobsAdmin(c, &jobsAdmin{})()
+	order := newTestOrder(common.NewJobID(), 0, "/file")
+	order.Transfers[0].SourceSize = 20
+
+	jpm := newTestJobPartMgr(createTestPlanFile(order).Map())
+	jptm := jpm.newTransferMgr(jpm.jobCtx, 0)
+	jptm.transferInfo = &TransferInfo{Source: testSourceRoot + "/file", Destination: testDestinationRoot + "/file",
+		SourceSize: 20, EntityType: common.EEntityType.File()}
+	jptm.SetStatus(common.ETransferStatus.Started())
+	return jpm, jptm
+}
+
+func (s *sourceChangeSuite) TestSourceChangeSinceEarlierRunIsCaughtByItsDigest(c *chk.C) {
+	earlier, now := make([]byte, 16), make([]byte, 16)
+	earlier[0], now[0] = 1, 2
+
+	// the earlier run hashed the file and staged its first chunk; the file has changed since
+	jpm, jptm := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	jptm.SetContentDigest(earlier, jptm.LastModifiedTime(), 20)
+	jptm.SetChunkStaged(0)
+	verifyRecordedDigest(jptm, 2, now)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(jpm.Plan().ErrorMessage(0), chk.Matches, ".*"+errSourceChangedSinceEarlierRun.Error()+".*")
+	// so that a retry sends all of it again
+	c.Assert(jptm.IsChunkStaged(0), chk.Equals, false)
+}
+
+func (s *sourceChangeSuite) TestUnchangedDigestKeepsStagedChunks(c *chk.C) {
+	digest := make([]byte, 16)
+	digest[0] = 1
+
+	jpm, jptm := newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	jptm.SetContentDigest(digest, jptm.LastModifiedTime(), 20)
+	jptm.SetChunkStaged(0)
+	verifyRecordedDigest(jptm, 2, digest)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Started())
+	c.Assert(jptm.IsChunkStaged(0), chk.Equals, true)
+
+	// with nothing staged by the earlier run, a changed source is simply sent as it is now
+	jpm, jptm = newDigestTest(c)
+	defer jpm.planMMF.Unmap()
+	jptm.SetContentDigest(digest, jptm.LastModifiedTime(), 20)
+	verifyRecordedDigest(jptm, 2, make([]byte, 16))
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Started())
+}
@@ -0,0 +1,151 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"unsafe"
+
+	"github.com/Azure/azure-storage-azcopy/common"
+
+	chk "gopkg.in/check.v1"
+)
+
+// The roots of the upload that newTestOrder orders
+const (
+	testSourceRoot      = "/src"
+	testDestinationRoot = "https://account.blob.core.windows.net/container"
+)
+
+// useTestJobsAdmin makes ja the JobsAdmin, until the returned func is called to bring back the one before it.
+// Unless ja says otherwise, its plan files go in a folder of their own, and it starts with no jobs.
+func useTestJobsAdmin(c *chk.C, ja *jobsAdmin) (restore func()) {
+	if ja.planDir == "" {
+		ja.planDir = c.MkDir()
+	}
+	if ja.jobIDToJobMgr.m == nil {
+		ja.jobIDToJobMgr = newJobIDToJobMgr()
+	}
+	saved := JobsAdmin
+	JobsAdmin = ja
+	return func() { JobsAdmin = saved }
+}
+
+// newTestOrder returns the order of a part, the final one, of a job that uploads the given files from testSourceRoot to testDestinationRoot.
+// The files keep their names at the destination.
+func newTestOrder(jobID common.JobID, partNum common.PartNumber, files ...string) common.CopyJobPartOrderRequest {
+	order := common.CopyJobPartOrderRequest{
+		JobID:           jobID,
+		PartNum:         partNum,
+		IsFinalPart:     true,
+		FromTo:          common.EFromTo.LocalBlob(),
+		SourceRoot:      common.ResourceString{Value: testSourceRoot},
+		DestinationRoot: common.ResourceString{Value: testDestinationRoot},
+	}
+	for _, file := range files {
+		order.Transfers = append(order.Transfers, common.CopyTransfer{Source: file, Destination: file, EntityType: common.EEntityType.File()})
+	}
+	return order
+}
+
+// createTestPlanFile creates the plan file of the given order in the plan folder of JobsAdmin, as the engine does when the part is ordered
+func createTestPlanFile(order common.CopyJobPartOrderRequest) JobPartPlanFileName {
+	planFile := JobsAdmin.NewJobPartPlanFileName(order.JobID, order.PartNum)
+	planFile.Create(order)
+	return planFile
+}
+
+// newTestJobPartMgr returns the manager of a job part whose plan is mapped by mmf, with just enough of a job manager to log to
+func newTestJobPartMgr(mmf *JobPartPlanMMF) *jobPartMgr {
+	return &jobPartMgr{jobMgr: &jobMgr{logger: discardingJobLogger{}}, planMMF: mmf, jobCtx: context.Background()}
+}
+
+// newTestPlanBuffer allocates size bytes in which a test can lay out a plan, aligned as a mapped plan file is.
+// It returns the header of the plan, at the start of the buffer, and the whole buffer, e.g. to write to a plan file.
+func newTestPlanBuffer(size uintptr) (*JobPartPlanHeader, []byte) {
+	buf := make([]uint64, size/8+1)
+	jpph := (*JobPartPlanHeader)(unsafe.Pointer(&buf[0]))
+	return jpph, testPlanBytes(jpph, size)
+}
+
+// testPlanBytes returns the first size bytes of a plan that was laid out in memory (e.g. by newTestPlanBuffer).
+// They must all lie in the buffer that was allocated for the plan.
+func testPlanBytes(jpph *JobPartPlanHeader, size uintptr) []byte {
+	contents := []byte{}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&contents))
+	sh.Data = uintptr(unsafe.Pointer(jpph))
+	sh.Len = int(size)
+	sh.Cap = sh.Len
+	return contents
+}
+
+// newTestPlanWithOneTransfer lays out, in memory, a plan with a single transfer that has the given number of overflow words
+func newTestPlanWithOneTransfer(overflowWords uint32) *JobPartPlanHeader {
+	headerSize := unsafe.Sizeof(JobPartPlanHeader{})
+	transferSize := unsafe.Sizeof(JobPartPlanTransfer{})
+	jpph, _ := newTestPlanBuffer(headerSize + transferSize + uintptr(overflowWords)*8)
+
+	jpph.NumTransfers = 1
+	jppt := jpph.Transfer(0)
+	jppt.ChunkBitmapOffset = int64(headerSize + transferSize)
+	jppt.ChunkBitmapOverflowWords = overflowWords
+	return jpph
+}
+
+// testPlanSize returns how many bytes of a plan that was laid out in memory (e.g. by newTestPlanWithOneTransfer) belong to it:
+// its header, its transfers and their chunk bitmaps
+func testPlanSize(jpph *JobPartPlanHeader) uintptr {
+	size := unsafe.Sizeof(JobPartPlanHeader{}) + uintptr(jpph.NumTransfers)*unsafe.Sizeof(JobPartPlanTransfer{})
+	for t := uint32(0); t < jpph.NumTransfers; t++ {
+		jppt := jpph.Transfer(t)
+		if end := uintptr(jppt.ChunkBitmapOffset) + uintptr(jppt.ChunkBitmapOverflowWords)*8; end > size {
+			size = end
+		}
+	}
+	return size
+}
+
+// writeTestPlanFile writes a plan that was laid out in memory to the plan file of the given job part, in the plan folder of JobsAdmin
+func writeTestPlanFile(c *chk.C, jobID common.JobID, partNum common.PartNumber, contents []byte) JobPartPlanFileName {
+	planFile := JobsAdmin.NewJobPartPlanFileName(jobID, partNum)
+	c.Assert(ioutil.WriteFile(planFile.GetJobPartPlanPath(), contents, 0644), chk.IsNil)
+	return planFile
+}
+
+// newTestPlanMMF writes a plan that was laid out in memory (e.g. by newTestPlanWithOneTransfer) to a file of its own, and maps it
+// as the plan file of a job part would be, so that a job part manager can be tested on it. From then on, the test must read and
+// change the plan through the returned mapping, rather than through jpph.
+func newTestPlanMMF(c *chk.C, jpph *JobPartPlanHeader) *JobPartPlanMMF {
+	size := testPlanSize(jpph)
+	path := filepath.Join(c.MkDir(), "plan")
+	c.Assert(ioutil.WriteFile(path, testPlanBytes(jpph, size), 0644), chk.IsNil)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	c.Assert(err, chk.IsNil)
+	defer file.Close()
+	mmf, err := common.NewMMF(file, true, 0, int64(size))
+	c.Assert(err, chk.IsNil)
+	return (*JobPartPlanMMF)(mmf)
+}
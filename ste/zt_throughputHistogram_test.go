@@ -0,0 +1,72 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type throughputHistogramTestSuite struct{}
+
+var _ = chk.Suite(&throughputHistogramTestSuite{})
+
+// assertWithinHistogramError checks that an estimate from the histogram is as close to the real value as its buckets allow
+func assertWithinHistogramError(c *chk.C, estimate, expected float64) {
+	c.Assert(estimate > expected*0.95 && estimate < expected*1.05, chk.Equals, true, chk.Commentf("estimated %v, expected %v", estimate, expected))
+}
+
+func (s *throughputHistogramTestSuite) TestPercentiles(c *chk.C) {
+	h := throughputHistogram{}
+	c.Assert(h.percentiles().TimedTransfers, chk.Equals, uint32(0))
+	c.Assert(h.percentile(50), chk.Equals, float64(0))
+
+	// transfers of 1 to 100 MB that each took a second, i.e. at 1 to 100 MB/s, in no particular order
+	for i := int64(100); i > 0; i-- {
+		h.add(((i*37)%100+1)*1000*1000, time.Second)
+	}
+	// nothing is learnt from empty files, or transfers that took no time
+	h.add(0, time.Second)
+	h.add(1000, 0)
+
+	p := h.percentiles()
+	c.Assert(p.TimedTransfers, chk.Equals, uint32(100))
+	assertWithinHistogramError(c, p.P50MBps, 50)
+	assertWithinHistogramError(c, p.P90MBps, 90)
+	assertWithinHistogramError(c, p.P99MBps, 99)
+}
+
+func (s *throughputHistogramTestSuite) TestPercentilesShowLongTail(c *chk.C) {
+	h := throughputHistogram{}
+	// most transfers are fast, but a few small ones crawl
+	for i := 0; i < 95; i++ {
+		h.add(8*1024*1024, 100*time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		h.add(1024, 2*time.Second)
+	}
+
+	assertWithinHistogramError(c, h.percentile(5), 512)
+	assertWithinHistogramError(c, h.percentile(6), 80*1024*1024)
+	assertWithinHistogramError(c, h.percentile(50), 80*1024*1024)
+	assertWithinHistogramError(c, h.percentile(100), 80*1024*1024)
+}
@@ -0,0 +1,131 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type tokenBucketPacerTestSuite struct{}
+
+var _ = chk.Suite(&tokenBucketPacerTestSuite{})
+
+func (s *tokenBucketPacerTestSuite) TestSustainedThroughputStaysUnderCap(c *chk.C) {
+	const bytesPerSecond = 2 * 1024 * 1024
+	const requestSize = 64 * 1024
+	const numWorkers = 4
+	const testDuration = 2 * time.Second
+
+	p := newTokenBucketPacer(bytesPerSecond, 0)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p.RequestTrafficAllocation(ctx, requestSize) == nil {
+			}
+		}()
+	}
+	wg.Wait()
+	elapsedSeconds := time.Since(start).Seconds()
+
+	// allow for the initial seeding of the bucket, on top of what the rate allows
+	ceiling := int64(bytesPerSecond*elapsedSeconds) + bytesPerSecond/4
+	total := p.GetTotalTraffic()
+	c.Assert(total <= ceiling, chk.Equals, true, chk.Commentf("issued %d bytes, but the ceiling was %d", total, ceiling))
+	c.Assert(total >= ceiling/2, chk.Equals, true, chk.Commentf("issued only %d bytes, expected close to %d", total, ceiling))
+}
+
+func (s *tokenBucketPacerTestSuite) TestRequestBiggerThanBucketDoesNotDeadlock(c *chk.C) {
+	const bytesPerSecond = 1024 * 1024
+	p := newTokenBucketPacer(bytesPerSecond, 0)
+	defer p.Close()
+
+	// more than the bucket can ever hold, e.g. a whole chunk with a very low cap
+	chunkSize := 2 * p.maxBucketSize(bytesPerSecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Assert(p.RequestTrafficAllocation(ctx, chunkSize), chk.IsNil)
+
+	// the bucket is now in debt, so even small requests must wait for it to be paid off
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer shortCancel()
+	c.Assert(p.RequestTrafficAllocation(shortCtx, 1024), chk.NotNil)
+}
+
+func (s *tokenBucketPacerTestSuite) TestCapCanBeChangedWhileRunning(c *chk.C) {
+	p := newTokenBucketPacer(1, 0) // so slow that nothing will get through
+	defer p.Close()
+
+	var granted int32
+	go func() {
+		if p.RequestTrafficAllocation(context.Background(), 1024*1024) == nil {
+			atomic.StoreInt32(&granted, 1)
+		}
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&granted), chk.Equals, int32(0))
+
+	// remove the cap, and the waiting request must be let through
+	p.setTargetBytesPerSecond(0)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&granted) == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt32(&granted), chk.Equals, int32(1))
+
+	// with no cap, requests never wait
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Assert(p.RequestTrafficAllocation(ctx, 1024*1024*1024), chk.IsNil)
+	c.Assert(p.GetTotalTraffic(), chk.Equals, int64(1024*1024+1024*1024*1024))
+}
+
+func (s *tokenBucketPacerTestSuite) TestUncappedPacerPassesRequestsStraightThrough(c *chk.C) {
+	// as initJobsAdmin makes it when there's no cap
+	p := newTokenBucketPacer(0, 0)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 1000; i++ {
+		c.Assert(p.RequestTrafficAllocation(ctx, 8*1024*1024), chk.IsNil)
+	}
+	c.Assert(p.GetTotalTraffic(), chk.Equals, int64(1000*8*1024*1024))
+
+	// until it's given a cap
+	p.setTargetBytesPerSecond(1)
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer shortCancel()
+	c.Assert(p.RequestTrafficAllocation(shortCtx, 1024*1024), chk.NotNil)
+}
@@ -0,0 +1,73 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"time"
+
+	chk "gopkg.in/check.v1"
+)
+
+type transferStallDetectorSuite struct{}
+
+var _ = chk.Suite(&transferStallDetectorSuite{})
+
+func (s *transferStallDetectorSuite) TestTransferProgress(c *chk.C) {
+	tp := newTransferProgress()
+	later := time.Now().Add(time.Hour)
+
+	// nothing in flight, so not stalled however long it has been
+	c.Assert(tp.stalledFor(later), chk.Equals, time.Duration(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	endTry := tp.trackTry(cancel)
+	c.Assert(tp.stalledFor(later) > 50*time.Minute, chk.Equals, true)
+
+	// moving data restarts the clock
+	tp.recordBytes(10)
+	c.Assert(tp.bytesMoved(), chk.Equals, int64(10))
+	c.Assert(tp.stalledFor(time.Now()) < time.Minute, chk.Equals, true)
+
+	// a stall cancels the tries in flight, but they stay in flight until the retry policy ends them
+	c.Assert(tp.cancelTries(), chk.Equals, 1)
+	c.Assert(ctx.Err(), chk.Equals, context.Canceled)
+	c.Assert(tp.stalledFor(later) > 0, chk.Equals, true)
+
+	endTry()
+	c.Assert(tp.stalledFor(later), chk.Equals, time.Duration(0))
+	c.Assert(tp.cancelTries(), chk.Equals, 0)
+}
+
+func (s *transferStallDetectorSuite) TestTransferProgressNotTracked(c *chk.C) {
+	ctx := context.Background()
+	c.Assert(transferProgressFromContext(ctx), chk.IsNil)
+
+	// without a transferProgress, tries and bytes are simply not tracked
+	var tp *transferProgress
+	tp.recordBytes(10)
+	cancelled := false
+	tp.trackTry(func() { cancelled = true })()
+	c.Assert(cancelled, chk.Equals, true)
+
+	tp = newTransferProgress()
+	c.Assert(transferProgressFromContext(withTransferProgress(ctx, tp)), chk.Equals, tp)
+}
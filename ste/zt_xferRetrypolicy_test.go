@@ -0,0 +1,212 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-azcopy/common"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	chk "gopkg.in/check.v1"
+)
+
+type xferRetryPolicySuite struct{}
+
+var _ = chk.Suite(&xferRetryPolicySuite{})
+
+// serverBusyError is what the blob SDK reports for a 503 response
+type serverBusyError struct {
+	response *http.Response
+}
+
+func (e serverBusyError) Error() string                       { return "503 Server Busy" }
+func (e serverBusyError) Timeout() bool                       { return false }
+func (e serverBusyError) Temporary() bool                     { return true }
+func (e serverBusyError) Response() *http.Response            { return e.response }
+func (e serverBusyError) ServiceCode() azblob.ServiceCodeType { return azblob.ServiceCodeServerBusy }
+
+// blobNotFoundError is what the blob SDK reports for a 404 response
+type blobNotFoundError struct {
+	response *http.Response
+}
+
+func (e blobNotFoundError) Error() string            { return "404 The specified blob does not exist." }
+func (e blobNotFoundError) Timeout() bool            { return false }
+func (e blobNotFoundError) Temporary() bool          { return false }
+func (e blobNotFoundError) Response() *http.Response { return e.response }
+func (e blobNotFoundError) ServiceCode() azblob.ServiceCodeType {
+	return azblob.ServiceCodeBlobNotFound
+}
+
+func newBlobNotFoundResponse() *http.Response {
+	return &http.Response{StatusCode: http.StatusNotFound, Status: "404 The specified blob does not exist.", Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+}
+
+func newServerBusyResponse(retryAfter string) *http.Response {
+	r := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+	if retryAfter != "" {
+		r.Header.Set("Retry-After", retryAfter)
+	}
+	return r
+}
+
+func (s *xferRetryPolicySuite) TestRetryAfterFromResponse(c *chk.C) {
+	now := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+
+	c.Assert(retryAfterFromResponse(nil, now), chk.Equals, time.Duration(0))
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse("")), now), chk.Equals, time.Duration(0))
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse("7")), now), chk.Equals, 7*time.Second)
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse("-7")), now), chk.Equals, time.Duration(0))
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse("soon")), now), chk.Equals, time.Duration(0))
+
+	// an HTTP date is relative to now, and is ignored once it has passed
+	date := now.Add(90 * time.Second).Format(http.TimeFormat)
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse(date)), now), chk.Equals, 90*time.Second)
+	c.Assert(retryAfterFromResponse(pipeline.NewHTTPResponse(newServerBusyResponse(date)), now.Add(time.Hour)), chk.Equals, time.Duration(0))
+}
+
+func (s *xferRetryPolicySuite) TestCalcDelayHonoringRetryAfter(c *chk.C) {
+	o := XferRetryOptions{Policy: RetryPolicyExponential, MaxTries: 10, RetryDelay: time.Second, MaxRetryDelay: 30 * time.Second}.defaults()
+
+	// without a Retry-After, the delays grow exponentially, with jitter of [0.8, 1.3)
+	previous := time.Duration(0)
+	for try := int32(2); try <= 5; try++ {
+		delay := o.calcDelayHonoringRetryAfter(try, 0)
+		c.Assert(delay > previous, chk.Equals, true, chk.Commentf("try %d: %v after %v", try, delay, previous))
+		previous = delay
+	}
+
+	// a longer Retry-After is honored, a shorter one doesn't cut the backoff short, and neither exceeds the maximum
+	c.Assert(o.calcDelayHonoringRetryAfter(2, 10*time.Second), chk.Equals, 10*time.Second)
+	c.Assert(o.calcDelayHonoringRetryAfter(5, time.Second) >= time.Duration(float32(15*time.Second)*0.8), chk.Equals, true)
+	c.Assert(o.calcDelayHonoringRetryAfter(2, time.Hour), chk.Equals, 30*time.Second)
+}
+
+func (s *xferRetryPolicySuite) TestBlobRetriesOfServerBusy(c *chk.C) {
+	// the service is busy for the first three tries, and asks us to wait a second after the first
+	retryAfters := []string{"1", "", ""}
+	var tryTimes []time.Time
+	fakeService := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			tryTimes = append(tryTimes, time.Now())
+			if len(tryTimes) <= len(retryAfters) {
+				r := newServerBusyResponse(retryAfters[len(tryTimes)-1])
+				return pipeline.NewHTTPResponse(r), serverBusyError{response: r}
+			}
+			return pipeline.NewHTTPResponse(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}), nil
+		}
+	})
+	o := XferRetryOptions{Policy: RetryPolicyExponential, MaxTries: 4, RetryDelay: 10 * time.Millisecond, MaxRetryDelay: 5 * time.Second}
+	p := pipeline.NewPipeline([]pipeline.Factory{NewBlobXferRetryPolicyFactory(o), fakeService}, pipeline.Options{})
+
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+	request, err := pipeline.NewRequest(http.MethodGet, *u, nil)
+	c.Assert(err, chk.IsNil)
+	response, err := p.Do(context.Background(), nil, request)
+	c.Assert(err, chk.IsNil)
+	c.Assert(response.Response().StatusCode, chk.Equals, http.StatusOK)
+	c.Assert(tryTimes, chk.HasLen, 4)
+
+	// the first retry waited as asked, which is much longer than the backoff alone (of about 10ms)
+	c.Assert(tryTimes[1].Sub(tryTimes[0]) >= time.Second, chk.Equals, true)
+	// and later ones back off exponentially: about 30ms, then about 70ms
+	c.Assert(tryTimes[3].Sub(tryTimes[2]) > tryTimes[2].Sub(tryTimes[1]), chk.Equals, true)
+	c.Assert(tryTimes[2].Sub(tryTimes[1]) < time.Second, chk.Equals, true)
+}
+
+// doWithAlwaysFailingService sends a request through the blob retry policy to a service that always fails with the given
+// error, and returns the error and the number of tries
+func doWithAlwaysFailingService(c *chk.C, o XferRetryOptions, failure func() (*http.Response, error)) (tries int, err error) {
+	fakeService := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			tries++
+			r, err := failure()
+			return pipeline.NewHTTPResponse(r), err
+		}
+	})
+	p := pipeline.NewPipeline([]pipeline.Factory{NewBlobXferRetryPolicyFactory(o), fakeService}, pipeline.Options{})
+
+	u, _ := url.Parse("https://account.blob.core.windows.net/container/blob")
+	request, err := pipeline.NewRequest(http.MethodGet, *u, nil)
+	c.Assert(err, chk.IsNil)
+	_, err = p.Do(context.Background(), nil, request)
+	return tries, err
+}
+
+func notFound() (*http.Response, error) {
+	r := newBlobNotFoundResponse()
+	return r, blobNotFoundError{response: r}
+}
+
+func serverBusy() (*http.Response, error) {
+	r := newServerBusyResponse("")
+	return r, serverBusyError{response: r}
+}
+
+func (s *xferRetryPolicySuite) TestNotFoundFailsFastWhileServerBusyIsRetried(c *chk.C) {
+	o := XferRetryOptions{Policy: RetryPolicyExponential, MaxTries: 4, RetryDelay: 10 * time.Millisecond, MaxRetryDelay: 5 * time.Second}
+
+	tries, err := doWithAlwaysFailingService(c, o, notFound)
+	c.Assert(err, chk.FitsTypeOf, blobNotFoundError{})
+	c.Assert(tries, chk.Equals, 1)
+
+	// and so the transfer fails straight away, with the status recorded
+	jpm := newTestJobPartMgr(newTestPlanMMF(c, newTestPlanWithOneTransfer(0)))
+	jptm := jpm.newTransferMgr(context.Background(), 0)
+	jptm.transferInfo = &TransferInfo{Source: "https://account.blob.core.windows.net/container/blob", Destination: "/data/blob"}
+	jptm.FailActiveDownload("downloading the blob", err)
+	c.Assert(jptm.TransferStatusIgnoringCancellation(), chk.Equals, common.ETransferStatus.Failed())
+	c.Assert(jptm.ErrorCode(), chk.Equals, int32(http.StatusNotFound))
+
+	// whereas a 503 is retried, backing off each time: about 10ms, 30ms and 70ms
+	start := time.Now()
+	tries, err = doWithAlwaysFailingService(c, o, serverBusy)
+	c.Assert(err, chk.FitsTypeOf, serverBusyError{})
+	c.Assert(tries, chk.Equals, 4)
+	c.Assert(time.Since(start) >= time.Duration(float32(110*time.Millisecond)*0.8), chk.Equals, true)
+}
+
+func (s *xferRetryPolicySuite) TestRetryableStatusCodesCanBeConfigured(c *chk.C) {
+	o := XferRetryOptions{Policy: RetryPolicyExponential, MaxTries: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Second,
+		RetryableStatusCodes: []int{http.StatusNotFound}}
+
+	tries, _ := doWithAlwaysFailingService(c, o, notFound)
+	c.Assert(tries, chk.Equals, 3)
+	tries, _ = doWithAlwaysFailingService(c, o, serverBusy)
+	c.Assert(tries, chk.Equals, 1)
+}
+
+func (s *xferRetryPolicySuite) TestParseRetryableStatusCodes(c *chk.C) {
+	codes, err := ParseRetryableStatusCodes(" 500, 503,429 ")
+	c.Assert(err, chk.IsNil)
+	c.Assert(codes, chk.DeepEquals, []int{500, 503, 429})
+
+	for _, invalid := range []string{"", " , ", "503,busy", "99", "600"} {
+		_, err = ParseRetryableStatusCodes(invalid)
+		c.Assert(err, chk.NotNil, chk.Commentf("%q", invalid))
+	}
+}